@@ -0,0 +1,159 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/mailer"
+	"github.com/ericflo/gradientzoo/models"
+	"github.com/ericflo/gradientzoo/ratelimit"
+	"github.com/ericflo/gradientzoo/utils"
+)
+
+var concurrency = ratelimit.NewConcurrency()
+
+var privateDownloads = newDownloadTracker()
+
+// downloadTracker remembers which private models each user downloaded
+// recently, in memory like the rate limiter.
+type downloadTracker struct {
+	mu        sync.Mutex
+	seen      map[string]map[string]time.Time
+	lastSweep time.Time
+}
+
+func newDownloadTracker() *downloadTracker {
+	return &downloadTracker{
+		seen:      map[string]map[string]time.Time{},
+		lastSweep: time.Now(),
+	}
+}
+
+// Add records that the user downloaded the model, and returns how many
+// different models they've downloaded within window.
+func (t *downloadTracker) Add(userId, modelId string, window time.Duration) int {
+	now := time.Now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	// Forget users who haven't downloaded anything in a while, so the map
+	// doesn't grow without bound
+	if now.Sub(t.lastSweep) > window {
+		for key, downloaded := range t.seen {
+			fresh := false
+			for _, seen := range downloaded {
+				if now.Sub(seen) < window {
+					fresh = true
+					break
+				}
+			}
+			if !fresh {
+				delete(t.seen, key)
+			}
+		}
+		t.lastSweep = now
+	}
+
+	downloaded, ok := t.seen[userId]
+	if !ok {
+		downloaded = map[string]time.Time{}
+		t.seen[userId] = downloaded
+	}
+	downloaded[modelId] = now
+	count := 0
+	for id, seen := range downloaded {
+		if now.Sub(seen) < window {
+			count++
+		} else {
+			delete(downloaded, id)
+		}
+	}
+	return count
+}
+
+// Reset forgets the user's downloads, so that one burst is only flagged once.
+func (t *downloadTracker) Reset(userId string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.seen, userId)
+}
+
+// refuseThrottled responds with when the signed in user may download again if
+// they've been throttled for abuse, and reports whether it did.  Downloading a
+// private model counts towards being flagged, and the download that crosses
+// the line is refused too.
+func refuseThrottled(c *Context, w http.ResponseWriter, req *http.Request, clog *log.Entry, m *models.Model) bool {
+	if c.User == nil {
+		return false
+	}
+	until, err := c.Api.AbuseFlag.ThrottledUntil(c.User.Id)
+	if err != nil {
+		clog.WithField("err", err).Error("Could not look up abuse throttle")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not get your file, please try again soon"))
+		return true
+	}
+	if !until.Valid && m.Visibility == "private" && utils.Conf.AbusePrivateModels > 0 {
+		window := time.Duration(utils.Conf.AbuseWindowMinutes) * time.Minute
+		count := privateDownloads.Add(c.User.Id, m.Id, window)
+		if count >= utils.Conf.AbusePrivateModels {
+			privateDownloads.Reset(c.User.Id)
+			flag := models.NewAbuseFlag(c.User.Id, models.ABUSE_PRIVATE_DOWNLOADS,
+				map[string]interface{}{
+					"private_models": count,
+					"window_minutes": utils.Conf.AbuseWindowMinutes,
+					"ip":             clientIp(req),
+				},
+				time.Duration(utils.Conf.AbuseThrottleMinutes)*time.Minute)
+			if err = c.Api.AbuseFlag.Save(flag); err != nil {
+				clog.WithField("err", err).Error("Could not save abuse flag")
+			} else {
+				until = flag.ThrottledUntil
+				clog.WithField("abuse_flag_id", flag.Id).Warn("Flagged user for abuse")
+				audit(c, req, "", c.User.Id, models.AUDIT_ABUSE_FLAG, "abuse_flag",
+					flag.Id, flag.Details)
+				goBackground(func() { alertAbuse(c.Mailer, c.User, flag) })
+			}
+		}
+	}
+	if !until.Valid {
+		return false
+	}
+	wait := until.Time.Sub(time.Now())
+	retry := int(math.Ceil(wait.Seconds()))
+	w.Header().Set("Retry-After", fmt.Sprintf("%d", retry))
+	c.Render.JSON(w, http.StatusTooManyRequests,
+		ApiErr(ERR_DOWNLOADS_PAUSED, "Downloads from this account are paused after unusual activity, "+
+			"please try again later or contact support"))
+	return true
+}
+
+// alertAbuse e-mails Conf.AlertEmail about a new abuse flag, if it's set.
+// It's meant to be run in its own goroutine.
+func alertAbuse(mail mailer.Mailer, user *models.User, flag *models.AbuseFlag) {
+	clog := log.WithFields(log.Fields{
+		"user_id":       user.Id,
+		"abuse_flag_id": flag.Id,
+	})
+	defer func() {
+		if r := recover(); r != nil {
+			clog.WithField("err", r).Error("Panic while sending abuse alert")
+		}
+	}()
+
+	if utils.Conf.AlertEmail == "" {
+		return
+	}
+	body := fmt.Sprintf(
+		"%s was flagged for %s (%s) and can't download until %s.\n\n"+
+			"Review the abuse queue at %s/admin/abuse.\n",
+		user.Username, flag.Kind, flag.DetailsString,
+		flag.ThrottledUntil.Time.Format(time.RFC1123), utils.Conf.WwwUrl)
+	if err := mail.Send(utils.Conf.AlertEmail, "User flagged for abuse", body); err != nil {
+		clog.WithField("err", err).Error("Could not send abuse alert")
+	}
+}
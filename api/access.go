@@ -0,0 +1,77 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/models"
+)
+
+// accessModel looks up the model named by the username and slug params,
+// responding and returning nil if it can't.
+func accessModel(c *Context, w http.ResponseWriter, clog *log.Entry) *models.Model {
+	return lookupModel(c, w, clog, c.Params.ByName("username"), c.Params.ByName("slug"))
+}
+
+// lookupModel is accessModel for a username and slug that didn't come from
+// the path.
+func lookupModel(c *Context, w http.ResponseWriter, clog *log.Entry, username, slug string) *models.Model {
+	user, err := c.Api.User.ByUsername(username)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up user by username")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not get that model, please try again soon"))
+		return nil
+	}
+	if err == sql.ErrNoRows || user == nil {
+		c.Render.JSON(w, http.StatusNotFound,
+			ApiErr(ERR_USER_NOT_FOUND, "No user by that username could be found"))
+		return nil
+	}
+
+	m, err := c.Api.Model.ByUserIdSlug(user.Id, slug)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up model by username & slug")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not get that model, please try again soon"))
+		return nil
+	}
+	if m == nil || err == sql.ErrNoRows {
+		c.Render.JSON(w, http.StatusNotFound, ApiErr(ERR_MODEL_NOT_FOUND, "That model was not found"))
+		return nil
+	}
+	return m
+}
+
+// accessRequestFor looks up the access request named by the id param along
+// with its model, responding and returning nil if it can't.  Only the model's
+// owner and whoever made the request can see it.
+func accessRequestFor(c *Context, w http.ResponseWriter, clog *log.Entry) (*models.AccessRequest, *models.Model) {
+	r, err := c.Api.AccessRequest.ById(c.Params.ByName("id"))
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up access request")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not get that access request, please try again soon"))
+		return nil, nil
+	}
+	if r == nil || err == sql.ErrNoRows {
+		c.Render.JSON(w, http.StatusNotFound,
+			ApiErr(ERR_NOT_FOUND, "No access request with that id was found"))
+		return nil, nil
+	}
+
+	m, err := c.Api.Model.ById(r.ModelId)
+	if err != nil {
+		clog.WithField("err", err).Error("Could not look up model by id")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not get that access request, please try again soon"))
+		return nil, nil
+	}
+	if !can(c, m, ACTION_MANAGE) && r.UserId != c.User.Id {
+		c.Render.JSON(w, http.StatusNotFound,
+			ApiErr(ERR_NOT_FOUND, "No access request with that id was found"))
+		return nil, nil
+	}
+	return r, m
+}
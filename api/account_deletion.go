@@ -0,0 +1,109 @@
+package api
+
+import (
+	"fmt"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/blobstorage"
+	"github.com/ericflo/gradientzoo/mailer"
+	"github.com/ericflo/gradientzoo/models"
+	"github.com/ericflo/gradientzoo/utils"
+)
+
+const accountDeletionInterval = time.Hour
+const accountDeletionBatch = 20
+
+// deleteScheduledAccounts runs forever, deleting accounts whose grace period
+// has run out.  It's meant to be run in its own goroutine.
+func deleteScheduledAccounts(api *models.ApiCollection, blob blobstorage.BlobStorage) {
+	for {
+		deleteDueAccounts(api, blob)
+		time.Sleep(accountDeletionInterval)
+	}
+}
+
+func deleteDueAccounts(api *models.ApiCollection, blob blobstorage.BlobStorage) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			log.WithField("err", rec).Error("Panic while deleting accounts")
+		}
+	}()
+
+	users, err := api.User.DueForDeletion(time.Now().UTC(), accountDeletionBatch)
+	if err != nil {
+		log.WithField("err", err).Error("Could not look up accounts to delete")
+		return
+	}
+	for _, user := range users {
+		clog := log.WithField("user_id", user.Id)
+		// Anything that fails is tried again next time around
+		if err = deleteAccount(api, blob, user); err != nil {
+			clog.WithField("err", err).Error("Could not delete account")
+			continue
+		}
+		clog.Info("Deleted account")
+		e := models.NewAuditEvent("", "", models.AUDIT_ACCOUNT_DELETED, "user",
+			user.Id, map[string]interface{}{"username": user.Username})
+		if err = api.AuditEvent.Record(e); err != nil {
+			clog.WithField("err", err).Error("Could not record audit event")
+		}
+	}
+}
+
+// deleteAccount deletes the user's service accounts, the blobs of all of the
+// user's files, and then everything about them in the database.
+func deleteAccount(api *models.ApiCollection, blob blobstorage.BlobStorage, user *models.User) error {
+	// Service accounts go along with whoever made them
+	services, err := api.User.ServiceAccounts(user.Id, "")
+	if err != nil {
+		return err
+	}
+	for _, service := range services {
+		if err = deleteAccount(api, blob, service); err != nil {
+			return err
+		}
+	}
+
+	ms, err := api.Model.ByUserId(user.Id)
+	if err != nil {
+		return err
+	}
+	for _, m := range ms {
+		files, err := api.File.ByModelId(m.Id)
+		if err != nil {
+			return err
+		}
+		for _, f := range files {
+			if err = blob.Delete(f.BlobFilename()); err != nil {
+				return err
+			}
+		}
+	}
+	if user.AvatarFilename != "" {
+		if err = blob.Delete(user.AvatarFilename); err != nil {
+			return err
+		}
+	}
+	return api.User.DeleteAccount(user.Id)
+}
+
+// sendAccountDeletionEmail is meant to be run in its own goroutine.
+func sendAccountDeletionEmail(mail mailer.Mailer, user *models.User) {
+	clog := log.WithField("user_id", user.Id)
+	defer func() {
+		if r := recover(); r != nil {
+			clog.WithField("err", r).Error("Panic while sending account deletion e-mail")
+		}
+	}()
+
+	body := fmt.Sprintf(
+		"Hi %s,\n\nYour Gradientzoo account, along with all of your models "+
+			"and files, will be deleted on %s. Until then you can sign in and "+
+			"cancel the deletion, or download a copy of your data from %s/account.\n",
+		user.Username, user.DeletionTime.Time.Format("January 2, 2006"),
+		utils.Conf.WwwUrl)
+	if err := mail.Send(user.Email, "Your account will be deleted", body); err != nil {
+		clog.WithField("err", err).Error("Could not send account deletion e-mail")
+	}
+}
@@ -0,0 +1,103 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/mailer"
+	"github.com/ericflo/gradientzoo/models"
+	"github.com/ericflo/gradientzoo/utils"
+	"github.com/pborman/uuid"
+)
+
+const (
+	TOKEN_PURPOSE_VERIFY_EMAIL   = "verify_email"
+	TOKEN_PURPOSE_PASSWORD_RESET = "password_reset"
+)
+
+const verifyEmailTTL = 7 * 24 * time.Hour
+const passwordResetTTL = time.Hour
+
+// The tokens depend on the address and the password hash respectively, so
+// that changing either of them makes older links stop working
+func verifyEmailToken(user *models.User) string {
+	return utils.MakeSignedToken(TOKEN_PURPOSE_VERIFY_EMAIL, user.Id, user.Email,
+		time.Now().Add(verifyEmailTTL))
+}
+
+func passwordResetToken(user *models.User) string {
+	return utils.MakeSignedToken(TOKEN_PURPOSE_PASSWORD_RESET, user.Id,
+		user.PasswordHash, time.Now().Add(passwordResetTTL))
+}
+
+// sendVerificationEmail is meant to be run in its own goroutine.
+func sendVerificationEmail(mail mailer.Mailer, user *models.User) {
+	clog := log.WithField("user_id", user.Id)
+	defer func() {
+		if r := recover(); r != nil {
+			clog.WithField("err", r).Error("Panic while sending verification e-mail")
+		}
+	}()
+
+	link := fmt.Sprintf("%s/verify-email?token=%s", utils.Conf.WwwUrl,
+		url.QueryEscape(verifyEmailToken(user)))
+	body := fmt.Sprintf(
+		"Hi %s,\n\nPlease confirm your e-mail address for Gradientzoo by "+
+			"following this link:\n\n%s\n\nThe link works for a week.\n",
+		user.Username, link)
+	if err := mail.Send(user.Email, "Confirm your e-mail address", body); err != nil {
+		clog.WithField("err", err).Error("Could not send verification e-mail")
+	}
+}
+
+// sendPasswordResetEmail is meant to be run in its own goroutine.
+func sendPasswordResetEmail(mail mailer.Mailer, user *models.User) {
+	clog := log.WithField("user_id", user.Id)
+	defer func() {
+		if r := recover(); r != nil {
+			clog.WithField("err", r).Error("Panic while sending password reset e-mail")
+		}
+	}()
+
+	link := fmt.Sprintf("%s/password-reset?token=%s", utils.Conf.WwwUrl,
+		url.QueryEscape(passwordResetToken(user)))
+	body := fmt.Sprintf(
+		"Hi %s,\n\nSomeone asked to reset the password for your Gradientzoo "+
+			"account. If it was you, follow this link to choose a new one:\n\n"+
+			"%s\n\nThe link works for an hour. If you didn't ask for this, you "+
+			"can ignore this e-mail.\n",
+		user.Username, link)
+	if err := mail.Send(user.Email, "Reset your password", body); err != nil {
+		clog.WithField("err", err).Error("Could not send password reset e-mail")
+	}
+}
+
+// userFromSignedToken finds the user a signed token was made for, and checks
+// the token against them.  It returns nil if the token isn't valid.
+func userFromSignedToken(c *Context, token, purpose string) (*models.User, error) {
+	userId, err := utils.ParseSignedToken(token)
+	if err != nil || uuid.Parse(userId) == nil {
+		return nil, nil
+	}
+	user, err := c.Api.User.ById(userId)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	state := user.Email
+	switch purpose {
+	case TOKEN_PURPOSE_PASSWORD_RESET:
+		state = user.PasswordHash
+	case TOKEN_PURPOSE_UNLOCK_ACCOUNT:
+		state = user.LockedUntil.Time.UTC().Format(time.RFC3339)
+	}
+	if utils.CheckSignedToken(token, purpose, state) != nil {
+		return nil, nil
+	}
+	return user, nil
+}
@@ -0,0 +1,152 @@
+package api
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/blobstorage"
+	"github.com/ericflo/gradientzoo/models"
+	"github.com/ericflo/gradientzoo/utils"
+	"gopkg.in/guregu/null.v3"
+)
+
+// Ranges longer than this are generated in the background instead of being
+// streamed straight back
+const syncAnalyticsRange = 7 * 24 * time.Hour
+const maxAnalyticsRange = 366 * 24 * time.Hour
+
+// How long the link to a finished export works for
+const analyticsExportUrlTTL = 10 * time.Minute
+
+var analyticsColumns = []string{
+	"hour",
+	"file_id",
+	"filename",
+	"framework",
+	"downloader",
+	"downloads",
+}
+
+// downloaderHash stands in for an IP address in exports.  It's the same for
+// the same address throughout one model's exports, so downloaders can still
+// be told apart, but it can't be reversed, or matched up across models.
+func downloaderHash(modelId string, ip null.String) string {
+	if !ip.Valid || ip.String == "" {
+		return ""
+	}
+	mac := hmac.New(sha256.New, []byte(utils.Conf.SecretKey))
+	mac.Write([]byte("downloader:" + modelId + ":" + ip.String))
+	return hex.EncodeToString(mac.Sum(nil))[:16]
+}
+
+// writeAnalytics writes the model's download events out as CSV or JSON lines.
+func writeAnalytics(out io.Writer, format, modelId string, events []*models.DownloadEvent) error {
+	if format == "jsonl" {
+		enc := json.NewEncoder(out)
+		for _, e := range events {
+			err := enc.Encode(map[string]interface{}{
+				"hour":       e.Hour,
+				"file_id":    e.FileId,
+				"filename":   e.Filename,
+				"framework":  e.Framework,
+				"downloader": downloaderHash(modelId, e.Ip),
+				"downloads":  e.Downloads,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	cw := csv.NewWriter(out)
+	cw.Write(analyticsColumns)
+	for _, e := range events {
+		cw.Write([]string{
+			e.Hour.UTC().Format(time.RFC3339),
+			e.FileId,
+			e.Filename,
+			e.Framework,
+			downloaderHash(modelId, e.Ip),
+			strconv.Itoa(e.Downloads),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// generateAnalyticsExport writes the export to blob storage and marks it
+// ready.
+func generateAnalyticsExport(api *models.ApiCollection, blob blobstorage.BlobStorage, export *models.AnalyticsExport) error {
+	events, err := api.DownloadHour.EventsByModel(export.ModelId, export.StartTime, export.EndTime)
+	if err != nil {
+		return fmt.Errorf("Could not look up download events: %s", err)
+	}
+	var buf bytes.Buffer
+	contentType := "text/csv; charset=utf-8"
+	if export.Format == "jsonl" {
+		contentType = "application/x-ndjson; charset=utf-8"
+	}
+	if err = writeAnalytics(&buf, export.Format, export.ModelId, events); err != nil {
+		return fmt.Errorf("Could not write analytics export: %s", err)
+	}
+	if err = blob.Save(buf.Bytes(), export.BlobFilename, contentType); err != nil {
+		return fmt.Errorf("Could not save analytics export: %s", err)
+	}
+
+	export.Status = models.EXPORT_READY
+	export.CompletedTime = null.TimeFrom(time.Now().UTC())
+	if err = api.AnalyticsExport.Save(export); err != nil {
+		return fmt.Errorf("Could not save analytics export: %s", err)
+	}
+	log.WithFields(log.Fields{
+		"analytics_export_id": export.Id,
+		"model_id":            export.ModelId,
+		"events":              len(events),
+	}).Info("Analytics export generated")
+	return nil
+}
+
+// runAnalyticsExportJob generates the export the job's for, marking it failed
+// if this is the job's last attempt and it doesn't work out.
+func runAnalyticsExportJob(api *models.ApiCollection, blob blobstorage.BlobStorage, job *models.Job) error {
+	var payload struct {
+		ExportId string `json:"analytics_export_id"`
+	}
+	if err := job.Decode(&payload); err != nil {
+		return err
+	}
+	export, err := api.AnalyticsExport.ById(payload.ExportId)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if export.Status != models.EXPORT_PENDING {
+		return nil
+	}
+
+	err = generateAnalyticsExport(api, blob, export)
+	if err != nil && job.LastAttempt() {
+		export.Status = models.EXPORT_FAILED
+		export.CompletedTime = null.TimeFrom(time.Now().UTC())
+		if saveErr := api.AnalyticsExport.Save(export); saveErr != nil {
+			log.WithFields(log.Fields{
+				"err":                 saveErr,
+				"analytics_export_id": export.Id,
+			}).Error("Could not save analytics export")
+		}
+	}
+	return err
+}
@@ -0,0 +1,50 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/models"
+)
+
+const DefaultAppKeyUsageDays = 30
+const MaxAppKeyUsageDays = 365
+
+const MaxAppKeyRateMultiplier = 1000
+
+// appKeyUsageRespond renders the key along with its daily usage over the
+// number of days in the days param.
+func appKeyUsageRespond(c *Context, w http.ResponseWriter, req *http.Request, clog *log.Entry, appKey *models.AppKey) {
+	days := DefaultAppKeyUsageDays
+	if daysStr := req.URL.Query().Get("days"); daysStr != "" {
+		var err error
+		days, err = strconv.Atoi(daysStr)
+		if err != nil || days < 1 || days > MaxAppKeyUsageDays {
+			c.Render.JSON(w, http.StatusBadRequest,
+				ApiErr(ERR_INVALID_REQUEST, "Days must be a number from 1 to 365"))
+			return
+		}
+	}
+
+	since := time.Now().UTC().AddDate(0, 0, -(days - 1))
+	usage, err := c.Api.AppKey.Usage(appKey.Id, since)
+	if err != nil {
+		clog.WithField("err", err).Error("Could not look up app key usage")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not get app key usage, please try again soon"))
+		return
+	}
+
+	total := 0
+	for _, day := range usage {
+		total += day.Requests
+	}
+
+	c.Render.JSON(w, http.StatusOK, map[string]interface{}{
+		"app_key": appKey,
+		"usage":   usage,
+		"total":   total,
+	})
+}
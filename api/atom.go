@@ -0,0 +1,113 @@
+package api
+
+import (
+	"encoding/xml"
+	"net/http"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/models"
+	"github.com/ericflo/gradientzoo/utils"
+)
+
+// How many entries go in each Atom feed.  Readers only ever want what's new.
+const atomFeedSize = 50
+
+type atomLink struct {
+	Rel  string `xml:"rel,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+type atomPerson struct {
+	Name string `xml:"name"`
+	Uri  string `xml:"uri,omitempty"`
+}
+
+type atomText struct {
+	Type string `xml:"type,attr,omitempty"`
+	Body string `xml:",chardata"`
+}
+
+type atomEntry struct {
+	Id        string      `xml:"id"`
+	Title     string      `xml:"title"`
+	Link      *atomLink   `xml:"link"`
+	Author    *atomPerson `xml:"author,omitempty"`
+	Published string      `xml:"published,omitempty"`
+	Updated   string      `xml:"updated"`
+	Summary   *atomText   `xml:"summary,omitempty"`
+}
+
+type atomFeed struct {
+	XMLName xml.Name     `xml:"http://www.w3.org/2005/Atom feed"`
+	Id      string       `xml:"id"`
+	Title   string       `xml:"title"`
+	Link    *atomLink    `xml:"link"`
+	Updated string       `xml:"updated"`
+	Entries []*atomEntry `xml:"entry"`
+}
+
+func atomTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+// userUrl is where a user's profile lives on the frontend
+func userUrl(username string) string {
+	return utils.Conf.WwwUrl + "/" + username
+}
+
+// newAtomFeed starts a feed for the frontend page at url.  A feed is as new as
+// its newest entry, or the epoch if it has none, so it's stable across
+// requests when nothing's changed.
+func newAtomFeed(title, url string, entries []*atomEntry) *atomFeed {
+	updated := atomTime(time.Unix(0, 0))
+	for _, e := range entries {
+		if e.Updated > updated {
+			updated = e.Updated
+		}
+	}
+	return &atomFeed{
+		Id:      url,
+		Title:   title,
+		Link:    &atomLink{Rel: "alternate", Href: url},
+		Updated: updated,
+		Entries: entries,
+	}
+}
+
+// renderAtom writes out the feed with the content type feed readers expect,
+// which Render.XML won't set.
+func renderAtom(w http.ResponseWriter, feed *atomFeed, clog *log.Entry) {
+	w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write([]byte(xml.Header)); err != nil {
+		clog.WithField("err", err).Error("Could not write Atom feed")
+		return
+	}
+	if err := xml.NewEncoder(w).Encode(feed); err != nil {
+		clog.WithField("err", err).Error("Could not write Atom feed")
+	}
+}
+
+// modelAtomEntry makes an entry for a model owned by username.
+func modelAtomEntry(m *models.Model, username string) *atomEntry {
+	e := &atomEntry{
+		Id:        "urn:uuid:" + m.Id,
+		Title:     m.Name,
+		Link:      &atomLink{Rel: "alternate", Href: modelUrl(username, m.Slug)},
+		Author:    &atomPerson{Name: username, Uri: userUrl(username)},
+		Published: atomTime(m.CreatedTime),
+		Updated:   atomTime(m.UpdatedTime),
+	}
+	if m.Description != "" {
+		e.Summary = &atomText{Type: "text", Body: m.Description}
+	}
+	return e
+}
+
+// modelsByNewest sorts models newest first
+type modelsByNewest []*models.Model
+
+func (ms modelsByNewest) Len() int           { return len(ms) }
+func (ms modelsByNewest) Swap(i, j int)      { ms[i], ms[j] = ms[j], ms[i] }
+func (ms modelsByNewest) Less(i, j int) bool { return ms[i].CreatedTime.After(ms[j].CreatedTime) }
@@ -0,0 +1,118 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/models"
+	"gopkg.in/guregu/null.v3"
+)
+
+const maxAuditUserAgent = 500
+
+// audit records a security-relevant action in the audit log, along with where
+// the request came from.  Not being able to record it is logged, but doesn't
+// fail the request, since the action has already happened by now.  Actions
+// that make for security events are posted to the owner's webhook, too.
+func audit(c *Context, req *http.Request, actorId, ownerId, action, objectType, objectId string, details map[string]interface{}) {
+	// Anything done while impersonating was really done by the admin
+	if c.AuthToken != nil && c.AuthToken.ImpersonatorId.Valid {
+		if details == nil {
+			details = map[string]interface{}{}
+		}
+		details["impersonator_id"] = c.AuthToken.ImpersonatorId.String
+	}
+	e := models.NewAuditEvent(actorId, ownerId, action, objectType, objectId, details)
+	e.Ip = clientIp(req)
+	e.UserAgent = req.UserAgent()
+	if len(e.UserAgent) > maxAuditUserAgent {
+		e.UserAgent = e.UserAgent[:maxAuditUserAgent]
+	}
+	event := ""
+	if ownerId != "" {
+		event = securityWebhookEvent(c, action, ownerId, e.Ip)
+	}
+	if err := c.Api.AuditEvent.Record(e); err != nil {
+		c.Log().WithFields(log.Fields{
+			"err":      err,
+			"action":   action,
+			"actor_id": actorId,
+			"owner_id": ownerId,
+		}).Error("Could not record audit event")
+	}
+	if event != "" {
+		sendSecurityWebhook(c.Api, ownerId, event, e)
+	}
+}
+
+// modelOwnerId is who to show an audit event about the model to.  It's only
+// for the audit log, so failing to find the model isn't an error.
+func modelOwnerId(c *Context, modelId string) string {
+	m, err := c.Api.Model.ById(modelId)
+	if err != nil || m == nil {
+		return ""
+	}
+	return m.UserId
+}
+
+const DefaultAuditPageSize = 50
+const MaxAuditPageSize = 200
+
+// auditPage reads the params used to page through the audit log, newest
+// first.  Pages start before a cursor like any other listing, or before the
+// sequence number given as before, which is how it used to be done.
+func auditPage(req *http.Request) (int64, int, error) {
+	limit, after, err := pageParams(req, "audit", DefaultAuditPageSize, MaxAuditPageSize)
+	if err != nil {
+		return 0, 0, err
+	}
+	var before int64
+	if after != nil {
+		if len(after.Keys) != 1 {
+			return 0, 0, errBadCursor
+		}
+		if before, err = strconv.ParseInt(after.Keys[0], 10, 64); err != nil || before < 1 {
+			return 0, 0, errBadCursor
+		}
+	} else if beforeStr := req.URL.Query().Get("before"); beforeStr != "" {
+		if before, err = strconv.ParseInt(beforeStr, 10, 64); err != nil || before < 1 {
+			return 0, 0, errors.New("Before must be a positive number")
+		}
+	}
+	return before, limit, nil
+}
+
+// auditResponse adds the users involved in the events, and where the next
+// page starts if there might be one.
+func auditResponse(c *Context, events []*models.AuditEvent, limit int) (map[string]interface{}, error) {
+	seen := map[string]bool{}
+	userIds := []interface{}{}
+	for _, e := range events {
+		for _, id := range []null.String{e.ActorId, e.OwnerId} {
+			if id.Valid && !seen[id.String] {
+				seen[id.String] = true
+				userIds = append(userIds, id.String)
+			}
+		}
+	}
+	users, err := c.Api.User.ByIds(userIds)
+	if err != nil {
+		return nil, err
+	}
+	resp := map[string]interface{}{
+		"events":      events,
+		"users":       users,
+		"next_before": nil,
+		"next_cursor": nil,
+	}
+	if len(events) == limit {
+		seq := events[len(events)-1].Seq
+		resp["next_before"] = seq
+		resp["next_cursor"] = encodeCursor("audit", &models.PageKey{
+			Keys: []string{strconv.FormatInt(seq, 10)},
+		})
+	}
+	return resp, nil
+}
@@ -0,0 +1,166 @@
+package api
+
+import (
+	"net/http"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/models"
+)
+
+// What can be done with a model.  Handlers say which one they need, and
+// modelPolicies says who gets to do it, so that every handler doing the same
+// kind of thing checks the same thing.
+const (
+	ACTION_READ   = "read"   // See the model and download its files
+	ACTION_WRITE  = "write"  // Upload, rename, delete, or annotate its files
+	ACTION_MANAGE = "manage" // Delete it, share it, and decide who gets access
+)
+
+// The roles someone can have with respect to a model
+const (
+	ROLE_PUBLIC     = "public"     // Anybody at all, for public models
+	ROLE_OWNER      = "owner"      // Whoever made the model
+	ROLE_GRANTEE    = "grantee"    // Users whose access request was approved
+	ROLE_ORG_MEMBER = "org_member" // Members of the owner's organization
+)
+
+// modelPolicies lists the roles allowed to take each action.  Teams work on
+// each other's models, but only their owners decide who else gets to.  Admins
+// get no say here: what they do to other people's models goes through the
+// /admin routes, which check for two-factor and keep an audit trail.
+var modelPolicies = map[string][]string{
+	ACTION_READ:   {ROLE_PUBLIC, ROLE_OWNER, ROLE_GRANTEE, ROLE_ORG_MEMBER},
+	ACTION_WRITE:  {ROLE_OWNER, ROLE_ORG_MEMBER},
+	ACTION_MANAGE: {ROLE_OWNER},
+}
+
+// modelRoles works out the roles the signed in user has with the model.  If a
+// grant or organization can't be looked up it errs on the side of leaving that
+// role out.
+func modelRoles(c *Context, m *models.Model) []string {
+	roles := []string{}
+	if m.Visibility != "private" {
+		roles = append(roles, ROLE_PUBLIC)
+	}
+	if c.User == nil {
+		return roles
+	}
+	if m.UserId == c.User.Id {
+		return append(roles, ROLE_OWNER)
+	}
+	same, err := c.Load.sameOrganization(c.User.Id, m.UserId)
+	if err != nil {
+		c.Log().WithFields(log.Fields{
+			"err":      err,
+			"user_id":  c.User.Id,
+			"model_id": m.Id,
+		}).Error("Could not look up organizations")
+	} else if same {
+		roles = append(roles, ROLE_ORG_MEMBER)
+	}
+	if m.Visibility == "private" {
+		granted, err := c.Load.granted(c.User.Id, m)
+		if err != nil {
+			c.Log().WithFields(log.Fields{
+				"err":      err,
+				"user_id":  c.User.Id,
+				"model_id": m.Id,
+			}).Error("Could not look up access grant")
+		} else if granted {
+			roles = append(roles, ROLE_GRANTEE)
+		}
+	}
+	return roles
+}
+
+// hasRole says whether the user has any of the roles the action needs.
+func hasRole(c *Context, m *models.Model, action string) bool {
+	allowed := map[string]bool{}
+	for _, role := range modelPolicies[action] {
+		allowed[role] = true
+	}
+	for _, role := range modelRoles(c, m) {
+		if allowed[role] {
+			return true
+		}
+	}
+	return false
+}
+
+// tokenAllows says whether the token the request was made with may be used
+// for the action.  Tokens limited to some models can't be used with any
+// others, except to read the ones anybody can.
+func tokenAllows(c *Context, m *models.Model, action string) bool {
+	if c.AuthToken == nil || c.AuthToken.AllowsModel(m.Id) {
+		return true
+	}
+	return action == ACTION_READ && m.Visibility != "private"
+}
+
+// can says whether the signed in user may take the action on the model.
+func can(c *Context, m *models.Model, action string) bool {
+	return hasRole(c, m, action) && tokenAllows(c, m, action)
+}
+
+// visibleModels is the models the signed in user can read, with the grants
+// for private ones and the owners' organizations looked up all at once rather
+// than one by one.
+func visibleModels(c *Context, ms []*models.Model) []*models.Model {
+	if c.User != nil {
+		if err := c.Load.LoadGrants(c.User.Id, ms); err != nil {
+			c.Log().WithFields(log.Fields{
+				"err":     err,
+				"user_id": c.User.Id,
+			}).Error("Could not look up access grants")
+		}
+		userIds := []string{c.User.Id}
+		for _, m := range ms {
+			userIds = append(userIds, m.UserId)
+		}
+		if err := c.Load.LoadOrganizations(userIds); err != nil {
+			c.Log().WithFields(log.Fields{
+				"err":     err,
+				"user_id": c.User.Id,
+			}).Error("Could not look up organizations")
+		}
+	}
+	visible := make([]*models.Model, 0, len(ms))
+	for _, m := range ms {
+		if can(c, m, ACTION_READ) {
+			visible = append(visible, m)
+		}
+	}
+	return visible
+}
+
+// visibleFiles is visibleModels for files, dropping the ones that belong to
+// models the signed in user can't read.
+func visibleFiles(c *Context, files []*models.File, ms []*models.Model) ([]*models.File, []*models.Model) {
+	ms = visibleModels(c, ms)
+	readable := map[string]bool{}
+	for _, m := range ms {
+		readable[m.Id] = true
+	}
+	visible := make([]*models.File, 0, len(files))
+	for _, f := range files {
+		if readable[f.ModelId] {
+			visible = append(visible, f)
+		}
+	}
+	return visible, ms
+}
+
+// authorize responds with msg and returns false if the signed in user may not
+// take the action on the model.
+func authorize(c *Context, w http.ResponseWriter, m *models.Model, action, msg string) bool {
+	if !hasRole(c, m, action) {
+		c.Render.JSON(w, http.StatusUnauthorized, ApiErr(ERR_FORBIDDEN, msg))
+		return false
+	}
+	if !tokenAllows(c, m, action) {
+		c.Render.JSON(w, http.StatusUnauthorized,
+			ApiErr(ERR_INSUFFICIENT_SCOPE, "This token can't be used with that model"))
+		return false
+	}
+	return true
+}
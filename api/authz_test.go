@@ -0,0 +1,132 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/ericflo/gradientzoo/models"
+)
+
+// authzUsers are who the tests take actions as.  The owner and teammate share
+// an organization, the grantee was let into the owner's private model, and
+// the admin and stranger have nothing to do with any of it.
+var authzUsers = map[string]*models.User{
+	"owner":    {Id: "owner"},
+	"teammate": {Id: "teammate"},
+	"grantee":  {Id: "grantee"},
+	"stranger": {Id: "stranger"},
+	"admin":    {Id: "admin", IsAdmin: true},
+}
+
+// authzContext is a request from the user, already knowing everything can
+// would otherwise look up, so that no database is needed.
+func authzContext(username string, token *models.AuthToken) *Context {
+	l := newLoader(nil)
+	l.grants["private"] = username == "grantee"
+	l.grants["limited"] = false
+	for id := range authzUsers {
+		l.orgs[id] = ""
+	}
+	l.orgs["owner"] = "team"
+	l.orgs["teammate"] = "team"
+	return &Context{User: authzUsers[username], AuthToken: token, Load: l}
+}
+
+func TestCan(t *testing.T) {
+	public := &models.Model{Id: "public", UserId: "owner", Visibility: "public"}
+	private := &models.Model{Id: "private", UserId: "owner", Visibility: "private"}
+	limited := &models.Model{Id: "limited", UserId: "owner", Visibility: "private"}
+
+	// A token for the owner that's only good for the private model
+	ci := models.NewApiToken("owner", "ci", nil, []string{"private"})
+
+	tests := []struct {
+		username string
+		token    *models.AuthToken
+		model    *models.Model
+		action   string
+		want     bool
+	}{
+		{"", nil, public, ACTION_READ, true},
+		{"", nil, public, ACTION_WRITE, false},
+		{"", nil, public, ACTION_MANAGE, false},
+		{"", nil, private, ACTION_READ, false},
+
+		{"owner", nil, public, ACTION_READ, true},
+		{"owner", nil, public, ACTION_WRITE, true},
+		{"owner", nil, public, ACTION_MANAGE, true},
+		{"owner", nil, private, ACTION_READ, true},
+		{"owner", nil, private, ACTION_WRITE, true},
+		{"owner", nil, private, ACTION_MANAGE, true},
+
+		{"teammate", nil, public, ACTION_WRITE, true},
+		{"teammate", nil, private, ACTION_READ, true},
+		{"teammate", nil, private, ACTION_WRITE, true},
+		{"teammate", nil, private, ACTION_MANAGE, false},
+
+		{"grantee", nil, private, ACTION_READ, true},
+		{"grantee", nil, private, ACTION_WRITE, false},
+		{"grantee", nil, private, ACTION_MANAGE, false},
+		{"grantee", nil, limited, ACTION_READ, false},
+
+		{"stranger", nil, public, ACTION_READ, true},
+		{"stranger", nil, public, ACTION_WRITE, false},
+		{"stranger", nil, private, ACTION_READ, false},
+
+		// Admins only step in through the admin routes
+		{"admin", nil, public, ACTION_READ, true},
+		{"admin", nil, private, ACTION_READ, false},
+		{"admin", nil, private, ACTION_WRITE, false},
+		{"admin", nil, private, ACTION_MANAGE, false},
+
+		// Limited tokens only reach other models to read public ones
+		{"owner", ci, private, ACTION_WRITE, true},
+		{"owner", ci, public, ACTION_READ, true},
+		{"owner", ci, public, ACTION_WRITE, false},
+		{"owner", ci, limited, ACTION_READ, false},
+		{"owner", ci, limited, ACTION_MANAGE, false},
+	}
+	for _, test := range tests {
+		c := authzContext(test.username, test.token)
+		if got := can(c, test.model, test.action); got != test.want {
+			t.Errorf("can(%q, token=%v, %s model, %s) = %v, want %v", test.username,
+				test.token != nil, test.model.Id, test.action, got, test.want)
+		}
+	}
+}
+
+func TestVisibleModels(t *testing.T) {
+	ms := []*models.Model{
+		{Id: "public", UserId: "owner", Visibility: "public"},
+		{Id: "private", UserId: "owner", Visibility: "private"},
+		{Id: "limited", UserId: "owner", Visibility: "private"},
+	}
+
+	tests := []struct {
+		username string
+		want     []string
+	}{
+		{"", []string{"public"}},
+		{"stranger", []string{"public"}},
+		{"admin", []string{"public"}},
+		{"grantee", []string{"public", "private"}},
+		{"teammate", []string{"public", "private", "limited"}},
+		{"owner", []string{"public", "private", "limited"}},
+	}
+	for _, test := range tests {
+		visible := visibleModels(authzContext(test.username, nil), ms)
+		got := make([]string, 0, len(visible))
+		for _, m := range visible {
+			got = append(got, m.Id)
+		}
+		if len(got) != len(test.want) {
+			t.Errorf("visibleModels(%q) = %v, want %v", test.username, got, test.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != test.want[i] {
+				t.Errorf("visibleModels(%q) = %v, want %v", test.username, got, test.want)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package api
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	_ "image/gif"
+	_ "image/jpeg"
+	"image/png"
+	"time"
+)
+
+const MaxAvatarSize = 5 * 1024 * 1024 // 5MB max upload
+const AvatarPixels = 256
+
+// Avatars this large would take too much memory to decode, whatever their size
+// on disk
+const maxAvatarSourcePixels = 4096 * 4096
+
+// How long the links to avatars in profile responses work for
+const avatarUrlExpiry = time.Hour
+
+var errAvatarTooLarge = errors.New("Avatar image is too large")
+
+// resizeAvatar decodes a PNG, JPEG, or GIF image, crops it to a square around
+// its center, and scales it to AvatarPixels on a side, encoded as a PNG.
+func resizeAvatar(data []byte) ([]byte, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Width*cfg.Height > maxAvatarSourcePixels {
+		return nil, errAvatarTooLarge
+	}
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	// Crop to the largest square in the middle
+	b := src.Bounds()
+	side := b.Dx()
+	if b.Dy() < side {
+		side = b.Dy()
+	}
+	if side == 0 {
+		return nil, errors.New("Avatar image is empty")
+	}
+	x0 := b.Min.X + (b.Dx()-side)/2
+	y0 := b.Min.Y + (b.Dy()-side)/2
+
+	// Each output pixel is the average of the source pixels it covers, which
+	// looks fine for shrinking, and for the occasional tiny image that gets
+	// scaled up it's the same as nearest neighbor
+	dst := image.NewNRGBA(image.Rect(0, 0, AvatarPixels, AvatarPixels))
+	for y := 0; y < AvatarPixels; y++ {
+		sy0 := y * side / AvatarPixels
+		sy1 := (y + 1) * side / AvatarPixels
+		if sy1 <= sy0 {
+			sy1 = sy0 + 1
+		}
+		for x := 0; x < AvatarPixels; x++ {
+			sx0 := x * side / AvatarPixels
+			sx1 := (x + 1) * side / AvatarPixels
+			if sx1 <= sx0 {
+				sx1 = sx0 + 1
+			}
+			var r, g, bl, a, n uint64
+			for sy := sy0; sy < sy1; sy++ {
+				for sx := sx0; sx < sx1; sx++ {
+					c := color.NRGBA64Model.Convert(src.At(x0+sx, y0+sy)).(color.NRGBA64)
+					r += uint64(c.R)
+					g += uint64(c.G)
+					bl += uint64(c.B)
+					a += uint64(c.A)
+					n++
+				}
+			}
+			dst.SetNRGBA(x, y, color.NRGBA{
+				R: uint8(r / n >> 8),
+				G: uint8(g / n >> 8),
+				B: uint8(bl / n >> 8),
+				A: uint8(a / n >> 8),
+			})
+		}
+	}
+
+	var buf bytes.Buffer
+	if err = png.Encode(&buf, dst); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,114 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/mailer"
+	"github.com/ericflo/gradientzoo/models"
+	"github.com/ericflo/gradientzoo/utils"
+)
+
+const bandwidthInterval = 15 * time.Minute
+
+// Owners are warned as their organization's bandwidth passes each of these
+// percentages of its quota, once each per month
+var bandwidthWarnPercents = []int{80, 100}
+
+// checkBandwidth runs forever, warning organization owners as they use up
+// their bandwidth.  It's meant to be run in its own goroutine.
+func checkBandwidth(api *models.ApiCollection, mail mailer.Mailer) {
+	for {
+		checkBandwidthOnce(api, mail)
+		time.Sleep(bandwidthInterval)
+	}
+}
+
+func checkBandwidthOnce(api *models.ApiCollection, mail mailer.Mailer) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			log.WithField("err", rec).Error("Panic while checking bandwidth")
+		}
+	}()
+
+	orgs, err := api.Organization.All()
+	if err != nil {
+		log.WithField("err", err).Error("Could not look up organizations")
+		return
+	}
+	now := time.Now().UTC()
+	for _, org := range orgs {
+		clog := log.WithField("organization_id", org.Id)
+		quota := org.BandwidthQuota()
+		if quota <= 0 {
+			continue
+		}
+		usage, err := organizationUsage(api, org)
+		if err != nil {
+			clog.WithField("err", err).Error("Could not look up organization usage")
+			continue
+		}
+		percent := usage.BandwidthBytes * 100 / quota
+		warn := 0
+		for _, p := range bandwidthWarnPercents {
+			if percent >= int64(p) && p > org.BandwidthWarned(usage.Since) {
+				warn = p
+			}
+		}
+		if warn == 0 {
+			continue
+		}
+
+		// Marking it first means nobody gets told twice, at the cost of maybe
+		// not being told at all if sending fails
+		if err = api.Organization.MarkBandwidthWarned(org.Id, warn, now); err != nil {
+			clog.WithField("err", err).Error("Could not mark bandwidth warning")
+			continue
+		}
+		owner, err := api.User.ById(org.OwnerId)
+		if err != nil {
+			clog.WithField("err", err).Error("Could not look up organization owner")
+			continue
+		}
+		body := fmt.Sprintf(
+			"%s has used %d%% of its bandwidth for the month (%d of %d bytes), "+
+				"which resets on %s.",
+			org.Name, percent, usage.BandwidthBytes, quota,
+			usage.Until.Format("January 2"))
+		if warn >= 100 && utils.Conf.BandwidthHardCutoff {
+			body += " Until then, its members' files can't be downloaded."
+		}
+		body += fmt.Sprintf(" Upgrading its plan raises the limit:\n\n%s/org\n",
+			utils.Conf.WwwUrl)
+		err = notify(api, mail, owner, models.NOTIFY_BANDWIDTH_QUOTA,
+			fmt.Sprintf("Your organization has used %d%% of its bandwidth", warn), body)
+		if err != nil {
+			clog.WithField("err", err).Error("Could not send bandwidth notification")
+		}
+	}
+}
+
+// refuseOverBandwidth responds if the model's owner belongs to an organization
+// that has used up its bandwidth for the month and cutoffs are enforced, and
+// reports whether it did.  It goes by the last check of the organization's
+// usage, so downloads stop within bandwidthInterval of the quota running out.
+func refuseOverBandwidth(c *Context, w http.ResponseWriter, clog *log.Entry, m *models.Model) bool {
+	if !utils.Conf.BandwidthHardCutoff {
+		return false
+	}
+	org, err := userOrganization(c.Api, m.UserId)
+	if err != nil {
+		clog.WithField("err", err).Error("Could not look up organization")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not get your file, please try again soon"))
+		return true
+	}
+	if org == nil || org.BandwidthWarned(monthStart(time.Now())) < 100 {
+		return false
+	}
+	c.Render.JSON(w, http.StatusPaymentRequired,
+		ApiErr(ERR_QUOTA_EXCEEDED, "This model's organization has used all of its bandwidth for the month"))
+	return true
+}
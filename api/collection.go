@@ -0,0 +1,116 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/models"
+)
+
+const (
+	maxCollectionTitleLength       = 100
+	maxCollectionDescriptionLength = 2000
+)
+
+// canSeeCollection says whether the signed in user can see the collection,
+// which for private ones means being its owner.
+func canSeeCollection(c *Context, collection *models.Collection) bool {
+	return collection.Visibility != "private" ||
+		(c.User != nil && c.User.Id == collection.UserId)
+}
+
+// collectionFor looks up the collection named by the id param, responding and
+// returning nil if it can't or the signed in user can't see it.
+func collectionFor(c *Context, w http.ResponseWriter, clog *log.Entry) *models.Collection {
+	collection, err := c.Api.Collection.ById(c.Params.ByName("id"))
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up collection")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not get that collection, please try again soon"))
+		return nil
+	}
+	// Private collections are as good as not there to anyone else
+	if collection == nil || err == sql.ErrNoRows || !canSeeCollection(c, collection) {
+		c.Render.JSON(w, http.StatusNotFound, ApiErr(ERR_NOT_FOUND, "That collection was not found"))
+		return nil
+	}
+	return collection
+}
+
+// ownCollection is collectionFor, but only for the collection's owner.
+func ownCollection(c *Context, w http.ResponseWriter, clog *log.Entry) *models.Collection {
+	collection := collectionFor(c, w, clog)
+	if collection == nil {
+		return nil
+	}
+	if collection.UserId != c.User.Id {
+		c.Render.JSON(w, http.StatusUnauthorized,
+			ApiErr(ERR_FORBIDDEN, "You're only allowed to change your own collections"))
+		return nil
+	}
+	return collection
+}
+
+// checkCollectionModels makes sure that the models can go in a collection:
+// that there aren't too many, none is in twice, and they're all models the
+// signed in user can see.  It responds and returns false if not.
+func checkCollectionModels(c *Context, w http.ResponseWriter, clog *log.Entry, modelIds []string) bool {
+	if len(modelIds) > models.MAX_COLLECTION_MODELS {
+		c.Render.JSON(w, http.StatusBadRequest,
+			ApiErr(ERR_QUOTA_EXCEEDED, "Collections may have 100 models maximum"))
+		return false
+	}
+	ids := make([]interface{}, 0, len(modelIds))
+	seen := map[string]bool{}
+	for _, id := range modelIds {
+		if seen[id] {
+			c.Render.JSON(w, http.StatusBadRequest,
+				ApiErr(ERR_INVALID_REQUEST, "Each model may only be in a collection once"))
+			return false
+		}
+		seen[id] = true
+		ids = append(ids, id)
+	}
+	ms, err := c.Api.Model.ByIds(ids)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up collection models")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not save that collection, please try again soon"))
+		return false
+	}
+	if len(visibleModels(c, ms)) != len(modelIds) {
+		c.Render.JSON(w, http.StatusBadRequest,
+			ApiErr(ERR_MODEL_NOT_FOUND, "Some of those models could not be found"))
+		return false
+	}
+	return true
+}
+
+// collectionModels loads the collection's models in order, leaving out any
+// the signed in user can't see.
+func collectionModels(c *Context, collection *models.Collection) ([]*models.Model, error) {
+	modelIds, err := c.Api.Collection.ModelIds(collection.Id)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	ids := make([]interface{}, 0, len(modelIds))
+	for _, id := range modelIds {
+		ids = append(ids, id)
+	}
+	ms, err := c.Api.Model.ByIds(ids)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	byId := make(map[string]*models.Model, len(ms))
+	for _, m := range visibleModels(c, ms) {
+		byId[m.Id] = m
+	}
+	ordered := make([]*models.Model, 0, len(ms))
+	for _, id := range modelIds {
+		if m, ok := byId[id]; ok {
+			ordered = append(ordered, m)
+		}
+	}
+	return ordered, nil
+}
@@ -0,0 +1,148 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/blobstorage"
+	"github.com/ericflo/gradientzoo/inspect"
+	"github.com/ericflo/gradientzoo/models"
+	"github.com/ericflo/gradientzoo/utils"
+)
+
+type compareFilesPayload struct {
+	FileDiffId string `json:"file_diff_id"`
+}
+
+// queueCompareFiles records that two versions of a file are waiting to be
+// compared, and queues the job that compares them, so that nothing more than
+// the job workers can take on is ever being compared at once.
+func queueCompareFiles(api *models.ApiCollection, userId string, fd *models.FileDiff) error {
+	if err := api.FileDiff.Save(fd); err != nil {
+		return err
+	}
+	_, err := enqueueJob(api, JOB_COMPARE_FILES, userId, &compareFilesPayload{FileDiffId: fd.Id})
+	return err
+}
+
+// runCompareFilesJob computes how much the weights changed between the two
+// versions of the job's file diff and stores the result.  Both versions are
+// read from blob storage into temporary files, and ones bigger than
+// MaxCompareMB aren't compared at all, since every weight in both has to be
+// held in memory.
+func runCompareFilesJob(api *models.ApiCollection, blob blobstorage.BlobStorage, job *models.Job) error {
+	var payload compareFilesPayload
+	if err := job.Decode(&payload); err != nil {
+		return err
+	}
+	fd, err := api.FileDiff.ById(payload.FileDiffId)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	clog := log.WithFields(log.Fields{
+		"file_diff_id": fd.Id,
+		"old_file_id":  fd.OldFileId,
+		"new_file_id":  fd.NewFileId,
+	})
+
+	fail := func(status, msg string) error {
+		fd.Status = status
+		fd.Error = msg
+		return api.FileDiff.Save(fd)
+	}
+
+	files, err := api.File.ByIds([]interface{}{fd.OldFileId, fd.NewFileId})
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	var oldFile, newFile *models.File
+	for _, f := range files {
+		if f.Id == fd.OldFileId {
+			oldFile = f
+		} else if f.Id == fd.NewFileId {
+			newFile = f
+		}
+	}
+	if oldFile == nil || newFile == nil {
+		// One of them was pruned since the comparison was asked for
+		return fail(models.DIFF_FAILED, "That version of the file no longer exists")
+	}
+
+	max := int64(utils.Conf.MaxCompareMB) << 20
+	spool := func(f *models.File, which string) (*os.File, int64, error) {
+		tmp, size, err := spoolBlob(blob, f.BlobFilename(), max)
+		if err == errBlobTooLarge {
+			return nil, 0, fail(models.DIFF_UNSUPPORTED,
+				fmt.Sprintf("Versions over %d MB can't be compared", utils.Conf.MaxCompareMB))
+		}
+		if err != nil {
+			clog.WithField("err", err).Error("Could not get " + which + " file from blob storage")
+			if job.LastAttempt() {
+				if saveErr := fail(models.DIFF_FAILED, "Could not download the "+which+" version"); saveErr != nil {
+					clog.WithField("err", saveErr).Error("Could not save file diff")
+				}
+			}
+			return nil, 0, err
+		}
+		return tmp, size, nil
+	}
+
+	oldTmp, oldSize, err := spool(oldFile, "old")
+	if oldTmp == nil {
+		return err
+	}
+	defer os.Remove(oldTmp.Name())
+	defer oldTmp.Close()
+	newTmp, newSize, err := spool(newFile, "new")
+	if newTmp == nil {
+		return err
+	}
+	defer os.Remove(newTmp.Name())
+	defer newTmp.Close()
+
+	compareFiles(clog, fd, oldTmp, oldSize, newTmp, newSize)
+
+	if err = api.FileDiff.Save(fd); err != nil {
+		return err
+	}
+
+	clog.WithField("file_diff_status", fd.Status).Info("Files compared")
+	return nil
+}
+
+// compareFiles fills in how much the weights changed between the checkpoints
+// in oldR and newR, or why that couldn't be worked out.
+func compareFiles(clog *log.Entry, fd *models.FileDiff, oldR io.ReaderAt, oldSize int64, newR io.ReaderAt, newSize int64) {
+	// A malformed file should never be able to take down the server
+	defer func() {
+		if rec := recover(); rec != nil {
+			clog.WithField("err", rec).Error("Panic while comparing files")
+			fd.Status = models.DIFF_FAILED
+			fd.Error = "Could not parse these files"
+		}
+	}()
+
+	d, err := inspect.CompareReaders(oldR, oldSize, newR, newSize)
+	switch {
+	case err == inspect.ErrUnsupported, err == inspect.ErrFormatMismatch:
+		fd.Status = models.DIFF_UNSUPPORTED
+		fd.Error = err.Error()
+	case err != nil:
+		clog.WithField("err", err).Info("Could not compare files")
+		fd.Status = models.DIFF_FAILED
+		fd.Error = err.Error()
+	default:
+		if err = fd.SetDiff(d); err != nil {
+			clog.WithField("err", err).Error("Could not encode file diff")
+			fd.Status = models.DIFF_FAILED
+			fd.Error = "Could not encode the comparison"
+		}
+	}
+}
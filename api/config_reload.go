@@ -0,0 +1,43 @@
+package api
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/utils"
+)
+
+// reloadConfig reloads the config, logging what changed, or why it couldn't.
+func reloadConfig(source string) ([]*utils.ConfigChange, []error) {
+	clog := log.WithField("source", source)
+	changes, errs := utils.Reload()
+	if len(errs) > 0 {
+		for _, err := range errs {
+			clog.WithField("err", err).Error("Config is invalid, so it wasn't reloaded")
+		}
+		return nil, errs
+	}
+	for _, change := range changes {
+		fields := log.Fields{"setting": change.Name, "old": change.Old, "new": change.New}
+		if change.Applied {
+			clog.WithFields(fields).Info("Config setting changed")
+		} else {
+			clog.WithFields(fields).Warn("Config setting changed, but needs a restart")
+		}
+	}
+	clog.WithField("changes", len(changes)).Info("Reloaded config")
+	return changes, nil
+}
+
+// reloadOnHangup reloads the config whenever the server is sent SIGHUP.  The
+// environment of a running server can't change, so that's for changes to
+// the config file.  It's meant to be run in its own goroutine.
+func reloadOnHangup() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	for range hup {
+		reloadConfig("SIGHUP")
+	}
+}
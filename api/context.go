@@ -1,7 +1,10 @@
 package api
 
 import (
+	log "github.com/Sirupsen/logrus"
 	"github.com/ericflo/gradientzoo/blobstorage"
+	"github.com/ericflo/gradientzoo/geoip"
+	"github.com/ericflo/gradientzoo/mailer"
 	"github.com/ericflo/gradientzoo/models"
 	"github.com/julienschmidt/httprouter"
 	"gopkg.in/unrolled/render.v1"
@@ -14,4 +17,31 @@ type Context struct {
 	User      *models.User
 	Api       *models.ApiCollection
 	Blob      blobstorage.BlobStorage
+	Mailer    mailer.Mailer
+	GeoIp     geoip.Locator
+
+	// Set instead of AuthToken when the user still has to enter their
+	// two-factor code
+	PendingAuthToken *models.AuthToken
+
+	// Set for anonymous requests from third-party tools, which get higher
+	// rate limits
+	AppKey *models.AppKey
+
+	// Set by Limited when it turns the request away
+	RateLimited bool
+
+	// What the request has looked up by id, so far
+	Load *Loader
+
+	// The id the request log gave the request
+	RequestId string
+}
+
+// Log is an entry for logging while serving the request, which carries its id
+func (c *Context) Log() *log.Entry {
+	if c == nil || c.RequestId == "" {
+		return log.NewEntry(log.StandardLogger())
+	}
+	return log.WithField("request_id", c.RequestId)
 }
@@ -0,0 +1,150 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/models"
+	"github.com/ericflo/gradientzoo/utils"
+)
+
+// The v1 discovery API is for package managers and framework hubs, which
+// want public models without signing in.  Its responses are their own types
+// rather than the models package's, so that they stay the same however the
+// rest of the API changes, and they're the same for everybody, so they can be
+// cached for a long time.
+
+// How long discovery responses can be cached.  Listings change as models are
+// published; a model's details and files change only when it's updated.
+const (
+	discoveryListMaxAge  = 10 * time.Minute
+	discoveryModelMaxAge = time.Hour
+)
+
+type DiscoveryModel struct {
+	Username    string    `json:"username"`
+	Slug        string    `json:"slug"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	License     string    `json:"license"`
+	Url         string    `json:"url"`
+	FilesUrl    string    `json:"files_url"`
+	Downloads   int       `json:"downloads"`
+	Stars       int       `json:"stars"`
+	CreatedTime time.Time `json:"created_time"`
+	UpdatedTime time.Time `json:"updated_time"`
+}
+
+type DiscoveryFile struct {
+	Filename         string    `json:"filename"`
+	Framework        string    `json:"framework"`
+	FrameworkVersion string    `json:"framework_version"`
+	SizeBytes        int       `json:"size_bytes"`
+	Sha256           string    `json:"sha256"`
+	DownloadUrl      string    `json:"download_url"`
+	CreatedTime      time.Time `json:"created_time"`
+}
+
+// cacheFor lets clients and proxies keep the response for maxAge.
+func cacheFor(w http.ResponseWriter, maxAge time.Duration) {
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(maxAge.Seconds())))
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+}
+
+// apiUrl is the absolute URL of path on this API, escaped as need be.  In
+// production everything is served over https.
+func apiUrl(req *http.Request, path string) string {
+	u := &url.URL{Scheme: "http", Host: req.Host, Path: path}
+	if utils.Conf.Production {
+		u.Scheme = "https"
+	}
+	return u.String()
+}
+
+func discoveryModel(req *http.Request, m *models.Model, username string) *DiscoveryModel {
+	dm := &DiscoveryModel{
+		Username:    username,
+		Slug:        m.Slug,
+		Name:        m.Name,
+		Description: m.Description,
+		License:     m.License,
+		Url:         modelUrl(username, m.Slug),
+		FilesUrl:    apiUrl(req, "/v1/model/"+username+"/"+m.Slug+"/files"),
+		Stars:       m.Stars,
+		CreatedTime: m.CreatedTime,
+		UpdatedTime: m.UpdatedTime,
+	}
+	if m.Downloads != nil {
+		dm.Downloads = m.Downloads.All
+	}
+	return dm
+}
+
+// discoveryModels hydrates the models and looks up their owners' usernames.
+func discoveryModels(c *Context, req *http.Request, ms []*models.Model) ([]*DiscoveryModel, error) {
+	if err := c.Api.Model.Hydrate(ms); err != nil {
+		return nil, err
+	}
+	userIds := make([]interface{}, 0, len(ms))
+	seen := map[string]bool{}
+	for _, m := range ms {
+		if !seen[m.UserId] {
+			seen[m.UserId] = true
+			userIds = append(userIds, m.UserId)
+		}
+	}
+	users, err := c.Api.User.ByIds(userIds)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	usernames := make(map[string]string, len(users))
+	for _, u := range users {
+		usernames[u.Id] = u.Username
+	}
+	dms := make([]*DiscoveryModel, 0, len(ms))
+	for _, m := range ms {
+		dms = append(dms, discoveryModel(req, m, usernames[m.UserId]))
+	}
+	return dms, nil
+}
+
+// discoveryFiles leaves out quarantined files, which can't be downloaded.
+// The files must be hydrated.
+func discoveryFiles(req *http.Request, username, slug string, files []*models.File) []*DiscoveryFile {
+	dfs := make([]*DiscoveryFile, 0, len(files))
+	for _, f := range files {
+		if f.Quarantine != nil {
+			continue
+		}
+		dfs = append(dfs, &DiscoveryFile{
+			Filename:         f.Filename,
+			Framework:        f.Framework,
+			FrameworkVersion: f.FrameworkVersion,
+			SizeBytes:        f.SizeBytes,
+			Sha256:           f.Sha256,
+			DownloadUrl: apiUrl(req, "/file/"+username+"/"+slug+"/"+f.Framework+
+				"/"+f.Filename),
+			CreatedTime: f.CreatedTime,
+		})
+	}
+	return dfs
+}
+
+// publicModel is lookupModel for the discovery API, where anything that isn't
+// public is as good as not there, even to its owner, since responses are the
+// same for everybody.
+func publicModel(c *Context, w http.ResponseWriter, clog *log.Entry, username, slug string) *models.Model {
+	m := lookupModel(c, w, clog, username, slug)
+	if m == nil {
+		return nil
+	}
+	if m.Visibility != "public" {
+		c.Render.JSON(w, http.StatusNotFound, ApiErr(ERR_MODEL_NOT_FOUND, "That model was not found"))
+		return nil
+	}
+	return m
+}
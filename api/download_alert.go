@@ -0,0 +1,86 @@
+package api
+
+import (
+	"fmt"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/mailer"
+	"github.com/ericflo/gradientzoo/models"
+	"github.com/ericflo/gradientzoo/utils"
+)
+
+// Spikes are checked for often, since the point is to hear about them while
+// they're happening
+const downloadAlertInterval = 5 * time.Minute
+
+// Once an alert goes off it stays quiet this long, so a model that's popular
+// all day is one alert and not twenty-four
+const downloadAlertQuiet = 24 * time.Hour
+
+// checkDownloadAlerts runs forever, telling owners when their models' downloads
+// spike.  It's meant to be run in its own goroutine.
+func checkDownloadAlerts(api *models.ApiCollection, mail mailer.Mailer) {
+	for {
+		checkDownloadAlertsOnce(api, mail)
+		time.Sleep(downloadAlertInterval)
+	}
+}
+
+func checkDownloadAlertsOnce(api *models.ApiCollection, mail mailer.Mailer) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			log.WithField("err", rec).Error("Panic while checking download alerts")
+		}
+	}()
+
+	now := time.Now().UTC()
+	spikes, err := api.DownloadAlert.Spiking(now.Truncate(time.Hour), now.Add(-downloadAlertQuiet))
+	if err != nil {
+		log.WithField("err", err).Error("Could not look up download spikes")
+		return
+	}
+	for _, s := range spikes {
+		clog := log.WithFields(log.Fields{
+			"model_id":          s.ModelId,
+			"download_alert_id": s.Id,
+		})
+		// Marking it first means nobody gets told twice, at the cost of maybe
+		// not being told at all if sending fails
+		if err = api.DownloadAlert.MarkAlerted(s.Id, now); err != nil {
+			clog.WithField("err", err).Error("Could not mark download alert")
+			continue
+		}
+
+		e := models.NewAuditEvent("", s.UserId, models.AUDIT_DOWNLOAD_SPIKE,
+			"model", s.ModelId, map[string]interface{}{
+				"downloads":  s.Downloads,
+				"average":    s.Average,
+				"multiplier": s.Multiplier,
+			})
+		if err = api.AuditEvent.Record(e); err != nil {
+			clog.WithField("err", err).Error("Could not record download spike")
+		}
+		if s.Webhook {
+			sendSecurityWebhook(api, s.UserId, WEBHOOK_DOWNLOAD_SPIKE, e)
+		}
+		if !s.Email {
+			continue
+		}
+
+		owner, err := api.User.ById(s.UserId)
+		if err != nil {
+			clog.WithField("err", err).Error("Could not look up model owner")
+			continue
+		}
+		body := fmt.Sprintf(
+			"%s has been downloaded %d times this hour, against %.1f in an "+
+				"average hour over the last week:\n\n%s/%s/%s\n",
+			s.Name, s.Downloads, s.Average, utils.Conf.WwwUrl, owner.Username, s.Slug)
+		err = notify(api, mail, owner, models.NOTIFY_DOWNLOAD_SPIKE,
+			fmt.Sprintf("Downloads of %s are spiking", s.Name), body)
+		if err != nil {
+			clog.WithField("err", err).Error("Could not send download spike notification")
+		}
+	}
+}
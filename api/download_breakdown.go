@@ -0,0 +1,72 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/geoip"
+	"github.com/ericflo/gradientzoo/models"
+	"github.com/ericflo/gradientzoo/utils"
+)
+
+// Client names and frameworks are whatever clients say they are, so they're
+// cut down to size before they're counted
+const maxClientNameLength = 64
+
+// downloadCountry says which country the request came from, trusting the
+// CDN's header if it's configured to send one
+func downloadCountry(c *Context, req *http.Request) string {
+	if utils.Conf.CountryHeader != "" {
+		country := strings.ToUpper(strings.TrimSpace(req.Header.Get(utils.Conf.CountryHeader)))
+		// CDNs use XX for unknown and T1 for Tor, neither of which is a country
+		if len(country) == 2 && country != "XX" && country != "T1" {
+			return country
+		}
+	}
+	country := c.GeoIp.Country(clientIp(req))
+	if country == "" {
+		country = geoip.Unknown
+	}
+	return country
+}
+
+// downloadClient says which client made the request, and for which framework.
+// Our own clients say so in headers, and for anything else the product at the
+// start of the User-Agent (e.g. curl/7.43.0) does.
+func downloadClient(req *http.Request) (string, string) {
+	clientName := req.Header.Get("X-Gradientzoo-Client-Name")
+	if clientName == "" {
+		clientName = strings.SplitN(req.UserAgent(), "/", 2)[0]
+	}
+	framework := req.Header.Get("X-Gradientzoo-Framework")
+	return cleanClientName(clientName), cleanClientName(framework)
+}
+
+func cleanClientName(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if len(name) > maxClientNameLength {
+		name = name[:maxClientNameLength]
+	}
+	if name == "" {
+		name = models.CLIENT_UNKNOWN
+	}
+	return name
+}
+
+// markDownloadBreakdowns counts a download of the file towards the country it
+// came from and the client that made it.  They're only for stats, so they
+// never get in the way of the download.
+func markDownloadBreakdowns(c *Context, req *http.Request, clog *log.Entry, fileId string) {
+	now := time.Now().UTC()
+	err := c.Api.DownloadCountry.MarkDownload(fileId, downloadCountry(c, req), now)
+	if err != nil {
+		clog.WithField("err", err).Error("Could not mark download country")
+	}
+	clientName, framework := downloadClient(req)
+	err = c.Api.DownloadClient.MarkDownload(fileId, clientName, framework, now)
+	if err != nil {
+		clog.WithField("err", err).Error("Could not mark download client")
+	}
+}
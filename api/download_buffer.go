@@ -0,0 +1,416 @@
+package api
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/models"
+	"github.com/ericflo/gradientzoo/utils"
+	"github.com/pborman/uuid"
+	"gopkg.in/guregu/null.v3"
+)
+
+var downloads = &downloadBuffer{counts: map[downloadKey]int{}}
+
+// downloadKey is everything one download is counted under.  Downloads with the
+// same key in the same hour are added up before they're written out.
+type downloadKey struct {
+	FileId     string `json:"file_id"`
+	UserId     string `json:"user_id"`
+	Ip         string `json:"ip"`
+	Country    string `json:"country"`
+	ClientName string `json:"client_name"`
+	Framework  string `json:"framework"`
+	Hour       int64  `json:"hour"` // Unix time, since time.Time makes a poor map key
+
+	// Whether whoever downloaded it was signed in
+	Authenticated bool `json:"authenticated"`
+}
+
+// journalEntry is one line of the journal, a count of downloads under a key
+type journalEntry struct {
+	downloadKey
+	Downloads int `json:"downloads"`
+}
+
+// downloadBuffer counts downloads in memory so that they can be written to the
+// database a batch at a time, rather than with several writes per download.
+// Each download is appended to a journal file before it's counted, and the
+// journal is only cleared once a batch has been written, so if the server dies
+// in between the downloads are replayed when it starts up again.  Dying just
+// as a batch is written can count it twice, which is better than never.  Raw
+// downloads are only for analytics, so they're buffered but not journaled.
+type downloadBuffer struct {
+	mu      sync.Mutex
+	counts  map[downloadKey]int
+	raw     []*models.RawDownload
+	journal *os.File
+	path    string // Where the journal is, which isn't journal.Name() once replayed
+
+	// Held for the whole of a flush, so that the ticker and shutdown can't
+	// flush at once and count a batch twice or lose its journal
+	flushMu sync.Mutex
+}
+
+// Open replays whatever an earlier run left in the journal at path, and keeps
+// journaling there from now on.
+func (b *downloadBuffer) Open(path string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// Batches that were being written when the server died are in flushing
+	// journals, and anything since then in the journal itself
+	flushing, err := filepath.Glob(path + ".flushing*")
+	if err != nil {
+		return err
+	}
+	for _, p := range append(flushing, path) {
+		if err = b.replay(p); err != nil {
+			return err
+		}
+	}
+	// Only once everything replayed is safe in one journal can the old ones
+	// go
+	b.path = path
+	if err = b.rewrite(); err != nil {
+		return err
+	}
+	for _, p := range flushing {
+		if err = os.Remove(p); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *downloadBuffer) replay(path string) error {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	replayed := 0
+	for scanner.Scan() {
+		var e journalEntry
+		// The last line is cut short if the server died writing it
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			log.WithFields(log.Fields{"path": path, "err": err}).Warn(
+				"Skipping unreadable download journal entry")
+			continue
+		}
+		b.counts[e.downloadKey] += e.Downloads
+		replayed += e.Downloads
+	}
+	if replayed > 0 {
+		log.WithFields(log.Fields{"path": path, "downloads": replayed}).Info(
+			"Replayed downloads from journal")
+	}
+	return scanner.Err()
+}
+
+// rewrite journals everything counted so far afresh, in place of the journal
+// at b.path, which is only replaced once the new one is safely written.  If it
+// fails, the old journal is left as it was, and still journaled to.
+func (b *downloadBuffer) rewrite() error {
+	tmp := b.path + ".rewriting"
+	journal, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	old := b.journal
+	b.journal = journal
+	for key, n := range b.counts {
+		if err = b.write(key, n); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = journal.Sync()
+	}
+	if err == nil {
+		err = os.Rename(tmp, b.path)
+	}
+	if err != nil {
+		journal.Close()
+		os.Remove(tmp)
+		b.journal = old
+		return err
+	}
+	if old != nil {
+		old.Close()
+	}
+	return nil
+}
+
+// setAside moves the journal to flushing and starts a new one in its place.
+// If it fails, the journal is put back and reopened, so that downloads keep
+// being journaled to it, unless it can't be reopened either, in which case
+// they fail to be.
+func (b *downloadBuffer) setAside(flushing string) error {
+	err := b.journal.Close()
+	if err == nil {
+		err = os.Rename(b.path, flushing)
+		if err == nil {
+			if err = b.reopen(); err == nil {
+				return nil
+			}
+			os.Rename(flushing, b.path)
+		}
+	}
+	if rerr := b.reopen(); rerr != nil {
+		log.WithFields(log.Fields{"path": b.path, "err": rerr}).Error(
+			"Could not reopen download journal")
+	}
+	return err
+}
+
+func (b *downloadBuffer) reopen() error {
+	journal, err := os.OpenFile(b.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	b.journal = journal
+	return nil
+}
+
+func (b *downloadBuffer) write(key downloadKey, n int) error {
+	line, err := json.Marshal(&journalEntry{downloadKey: key, Downloads: n})
+	if err != nil {
+		return err
+	}
+	_, err = b.journal.Write(append(line, '\n'))
+	return err
+}
+
+// Add counts a download, which is safe once Add returns, along with its raw
+// download if there is one.
+func (b *downloadBuffer) Add(key downloadKey, raw *models.RawDownload) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.journal != nil {
+		if err := b.write(key, 1); err != nil {
+			return err
+		}
+	}
+	b.counts[key]++
+	if raw != nil {
+		b.raw = append(b.raw, raw)
+	}
+	return nil
+}
+
+// Depth is how many downloads are waiting to be written out.
+func (b *downloadBuffer) Depth() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	depth := 0
+	for _, n := range b.counts {
+		depth += n
+	}
+	return depth
+}
+
+// Flush writes out everything counted so far.  If that fails, it's all kept
+// to try again next time.
+func (b *downloadBuffer) Flush(api *models.ApiCollection) error {
+	b.flushMu.Lock()
+	defer b.flushMu.Unlock()
+
+	b.mu.Lock()
+	counts, raw := b.counts, b.raw
+	if len(counts) == 0 {
+		b.mu.Unlock()
+		return nil
+	}
+	b.counts, b.raw = map[downloadKey]int{}, nil
+
+	// Set the journal aside while the batch is written, so that downloads
+	// can keep being journaled in the meantime.  Each batch gets its own, so
+	// one that's left behind for the next start to replay is never clobbered.
+	var flushing string
+	if b.journal != nil {
+		flushing = b.path + ".flushing." + uuid.New()
+		if err := b.setAside(flushing); err != nil {
+			b.counts, b.raw = counts, append(raw, b.raw...)
+			b.mu.Unlock()
+			return err
+		}
+	}
+	b.mu.Unlock()
+
+	if err := writeDownloads(api, counts); err != nil {
+		// Put it all back, then journal it all again so the flushing journal
+		// can go.  The journal is rewritten whole rather than appended to, so
+		// that if that fails partway the two journals are left as they were,
+		// without any downloads in both.
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		b.raw = append(raw, b.raw...)
+		for key, n := range counts {
+			b.counts[key] += n
+		}
+		if flushing != "" {
+			if jerr := b.rewrite(); jerr != nil {
+				// Leave the flushing journal for the next start to replay
+				log.WithField("err", jerr).Error("Could not journal unflushed downloads again")
+				return err
+			}
+			os.Remove(flushing)
+		}
+		return err
+	}
+	if err := api.RawDownload.Record(raw); err != nil {
+		log.WithField("err", err).Error("Could not record download events")
+	}
+	if flushing != "" {
+		return os.Remove(flushing)
+	}
+	return nil
+}
+
+// writeDownloads adds up the counts by table and writes each in one batch.
+func writeDownloads(api *models.ApiCollection, counts map[downloadKey]int) error {
+	hours := map[downloadKey]*models.DownloadHour{}
+	countries := map[downloadKey]*models.DownloadCountry{}
+	clients := map[downloadKey]*models.DownloadClient{}
+	for key, n := range counts {
+		t := time.Unix(key.Hour, 0).UTC()
+		day := t.Truncate(24 * time.Hour)
+
+		hk := downloadKey{FileId: key.FileId, UserId: key.UserId, Ip: key.Ip, Hour: key.Hour}
+		h, ok := hours[hk]
+		if !ok {
+			h = &models.DownloadHour{
+				FileId: key.FileId,
+				Hour:   t,
+				Ip:     null.StringFrom(key.Ip),
+				UserId: null.StringFrom(key.UserId),
+			}
+			hours[hk] = h
+		}
+		h.Downloads += n
+		if key.Authenticated {
+			h.Authenticated += n
+		}
+
+		ck := downloadKey{FileId: key.FileId, Country: key.Country, Hour: day.Unix()}
+		if c, ok := countries[ck]; ok {
+			c.Downloads += n
+		} else {
+			countries[ck] = &models.DownloadCountry{
+				FileId:    key.FileId,
+				Day:       day,
+				Country:   key.Country,
+				Downloads: n,
+			}
+		}
+
+		lk := downloadKey{FileId: key.FileId, ClientName: key.ClientName,
+			Framework: key.Framework, Hour: day.Unix()}
+		if c, ok := clients[lk]; ok {
+			c.Downloads += n
+		} else {
+			clients[lk] = &models.DownloadClient{
+				FileId:     key.FileId,
+				Day:        day,
+				ClientName: key.ClientName,
+				Framework:  key.Framework,
+				Downloads:  n,
+			}
+		}
+	}
+
+	hourRows := make([]*models.DownloadHour, 0, len(hours))
+	for _, h := range hours {
+		hourRows = append(hourRows, h)
+	}
+	if err := api.DownloadHour.MarkDownloads(hourRows); err != nil {
+		return err
+	}
+	// The breakdowns are only for stats, so they don't hold up the batch
+	countryRows := make([]*models.DownloadCountry, 0, len(countries))
+	for _, c := range countries {
+		countryRows = append(countryRows, c)
+	}
+	if err := api.DownloadCountry.MarkDownloads(countryRows); err != nil {
+		log.WithField("err", err).Error("Could not write download countries")
+	}
+	clientRows := make([]*models.DownloadClient, 0, len(clients))
+	for _, c := range clients {
+		clientRows = append(clientRows, c)
+	}
+	if err := api.DownloadClient.MarkDownloads(clientRows); err != nil {
+		log.WithField("err", err).Error("Could not write download clients")
+	}
+	return nil
+}
+
+// flushDownloads runs forever, writing out buffered downloads every
+// DownloadFlushSeconds.  It's meant to be run in its own goroutine.
+func flushDownloads(api *models.ApiCollection) {
+	interval := time.Duration(utils.Conf.DownloadFlushSeconds) * time.Second
+	for {
+		time.Sleep(interval)
+		flushDownloadsOnce(api)
+	}
+}
+
+func flushDownloadsOnce(api *models.ApiCollection) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			log.WithField("err", rec).Error("Panic while flushing downloads")
+		}
+	}()
+
+	if err := downloads.Flush(api); err != nil {
+		log.WithField("err", err).Error("Could not flush downloads")
+	}
+}
+
+// markDownload counts a download of the file, either in the buffer or right
+// away if downloads aren't buffered.  userId is who the download counts
+// towards, which is the file's owner.
+func markDownload(c *Context, req *http.Request, clog *log.Entry, f *models.File, userId, ip string) error {
+	downloadBytes.Add(float64(f.SizeBytes))
+
+	fileId := f.Id
+	now := time.Now().UTC()
+	authenticated := c.User != nil
+	raw := rawDownload(req, fileId, ip, now)
+	if utils.Conf.DownloadFlushSeconds <= 0 {
+		err := c.Api.DownloadHour.MarkDownload(fileId, userId, ip, authenticated, now)
+		if err != nil {
+			return err
+		}
+		markDownloadBreakdowns(c, req, clog, fileId)
+		if raw != nil {
+			if err = c.Api.RawDownload.Record([]*models.RawDownload{raw}); err != nil {
+				clog.WithField("err", err).Error("Could not record download event")
+			}
+		}
+		return nil
+	}
+
+	clientName, framework := downloadClient(req)
+	return downloads.Add(downloadKey{
+		FileId:     fileId,
+		UserId:     userId,
+		Ip:         ip,
+		Country:    downloadCountry(c, req),
+		ClientName: clientName,
+		Framework:  framework,
+		Hour:       now.Truncate(time.Hour).Unix(),
+
+		Authenticated: authenticated,
+	}, raw)
+}
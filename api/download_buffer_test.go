@@ -0,0 +1,252 @@
+package api
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ericflo/gradientzoo/models"
+)
+
+// fakeDownloadHours keeps the batches it's given, or fails them with err.
+// Anything else a test calls panics on the nil embedded interface.
+type fakeDownloadHours struct {
+	models.DownloadHourApi
+	err       error
+	downloads int
+}
+
+func (f *fakeDownloadHours) MarkDownloads(rows []*models.DownloadHour) error {
+	if f.err != nil {
+		return f.err
+	}
+	for _, row := range rows {
+		f.downloads += row.Downloads
+	}
+	return nil
+}
+
+type fakeDownloadCountries struct{ models.DownloadCountryApi }
+
+func (fakeDownloadCountries) MarkDownloads([]*models.DownloadCountry) error { return nil }
+
+type fakeDownloadClients struct{ models.DownloadClientApi }
+
+func (fakeDownloadClients) MarkDownloads([]*models.DownloadClient) error { return nil }
+
+type fakeRawDownloads struct{ models.RawDownloadApi }
+
+func (fakeRawDownloads) Record([]*models.RawDownload) error { return nil }
+
+func fakeDownloadApi(hours *fakeDownloadHours) *models.ApiCollection {
+	return &models.ApiCollection{
+		DownloadHour:    hours,
+		DownloadCountry: fakeDownloadCountries{},
+		DownloadClient:  fakeDownloadClients{},
+		RawDownload:     fakeRawDownloads{},
+	}
+}
+
+// journalPath is where a test keeps its journal, which is removed along with
+// anything set aside next to it when the test is done.
+func journalPath(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "gradientzoo-downloads")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return filepath.Join(dir, "downloads.journal"), func() { os.RemoveAll(dir) }
+}
+
+func openDownloads(t *testing.T, path string) *downloadBuffer {
+	b := &downloadBuffer{counts: map[downloadKey]int{}}
+	if err := b.Open(path); err != nil {
+		t.Fatalf("Could not open journal: %v", err)
+	}
+	return b
+}
+
+func testDownloadKey(fileId string) downloadKey {
+	return downloadKey{FileId: fileId, UserId: "user", Ip: "10.0.0.1",
+		Hour: time.Now().Truncate(time.Hour).Unix()}
+}
+
+func flushingJournals(t *testing.T, path string) []string {
+	flushing, err := filepath.Glob(path + ".flushing*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return flushing
+}
+
+func TestDownloadJournalReplay(t *testing.T) {
+	path, cleanup := journalPath(t)
+	defer cleanup()
+
+	b := openDownloads(t, path)
+	for _, id := range []string{"a", "a", "b"} {
+		if err := b.Add(testDownloadKey(id), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Batches that were being flushed when the server died, from before and
+	// after each batch got its own journal
+	b2 := openDownloads(t, path+".flushing")
+	b2.Add(testDownloadKey("c"), nil)
+	b3 := openDownloads(t, path+".flushing.batch")
+	b3.Add(testDownloadKey("c"), nil)
+	// The last line is cut short if the server died writing it
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"file_id":"d","downl`)
+	f.Close()
+
+	b = openDownloads(t, path)
+	if depth := b.Depth(); depth != 5 {
+		t.Errorf("Depth after replay = %d, want 5", depth)
+	}
+	if flushing := flushingJournals(t, path); len(flushing) != 0 {
+		t.Errorf("Flushing journals left after replay: %v", flushing)
+	}
+
+	// Everything replayed is journaled again, once
+	b = openDownloads(t, path)
+	if depth := b.Depth(); depth != 5 {
+		t.Errorf("Depth after replaying twice = %d, want 5", depth)
+	}
+}
+
+func TestDownloadFlush(t *testing.T) {
+	path, cleanup := journalPath(t)
+	defer cleanup()
+
+	b := openDownloads(t, path)
+	for _, id := range []string{"a", "a", "b"} {
+		b.Add(testDownloadKey(id), nil)
+	}
+	hours := &fakeDownloadHours{}
+	if err := b.Flush(fakeDownloadApi(hours)); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	if hours.downloads != 3 {
+		t.Errorf("Flush wrote %d downloads, want 3", hours.downloads)
+	}
+	if depth := b.Depth(); depth != 0 {
+		t.Errorf("Depth after flush = %d, want 0", depth)
+	}
+	if flushing := flushingJournals(t, path); len(flushing) != 0 {
+		t.Errorf("Flushing journals left after flush: %v", flushing)
+	}
+
+	// Downloads during or after the flush are still journaled
+	b.Add(testDownloadKey("c"), nil)
+	if depth := openDownloads(t, path).Depth(); depth != 1 {
+		t.Errorf("Depth replayed after flush = %d, want 1", depth)
+	}
+}
+
+func TestDownloadFlushFailure(t *testing.T) {
+	path, cleanup := journalPath(t)
+	defer cleanup()
+
+	b := openDownloads(t, path)
+	b.Add(testDownloadKey("a"), nil)
+	b.Add(testDownloadKey("b"), nil)
+	hours := &fakeDownloadHours{err: errors.New("database is down")}
+	if err := b.Flush(fakeDownloadApi(hours)); err != hours.err {
+		t.Fatalf("Flush = %v, want %v", err, hours.err)
+	}
+	if depth := b.Depth(); depth != 2 {
+		t.Errorf("Depth after failed flush = %d, want 2", depth)
+	}
+	if flushing := flushingJournals(t, path); len(flushing) != 0 {
+		t.Errorf("Flushing journals left after failed flush: %v", flushing)
+	}
+	// The batch is journaled again, but not twice
+	if depth := openDownloads(t, path).Depth(); depth != 2 {
+		t.Errorf("Depth replayed after failed flush = %d, want 2", depth)
+	}
+
+	hours.err = nil
+	if err := b.Flush(fakeDownloadApi(hours)); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	if hours.downloads != 2 {
+		t.Errorf("Retried flush wrote %d downloads, want 2", hours.downloads)
+	}
+}
+
+func TestDownloadFlushFailureUnjournaled(t *testing.T) {
+	path, cleanup := journalPath(t)
+	defer cleanup()
+
+	b := openDownloads(t, path)
+	b.Add(testDownloadKey("a"), nil)
+	b.Add(testDownloadKey("b"), nil)
+	// Nothing can be journaled again while something's in the way of the
+	// new journal
+	if err := os.Mkdir(path+".rewriting", 0700); err != nil {
+		t.Fatal(err)
+	}
+	hours := &fakeDownloadHours{err: errors.New("database is down")}
+	if err := b.Flush(fakeDownloadApi(hours)); err != hours.err {
+		t.Fatalf("Flush = %v, want %v", err, hours.err)
+	}
+	if depth := b.Depth(); depth != 2 {
+		t.Errorf("Depth after failed flush = %d, want 2", depth)
+	}
+	// The batch is left in its flushing journal, and only there
+	b.Add(testDownloadKey("c"), nil)
+	if flushing := flushingJournals(t, path); len(flushing) != 1 {
+		t.Errorf("Flushing journals left after failed flush = %v, want 1", flushing)
+	}
+	os.Remove(path + ".rewriting")
+	if depth := openDownloads(t, path).Depth(); depth != 3 {
+		t.Errorf("Depth replayed after failed flush = %d, want 3", depth)
+	}
+}
+
+func TestDownloadFlushConcurrent(t *testing.T) {
+	path, cleanup := journalPath(t)
+	defer cleanup()
+
+	// The ticker and shutdown flushing at once, while downloads come in
+	b := openDownloads(t, path)
+	hours := &fakeDownloadHours{}
+	api := fakeDownloadApi(hours)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				b.Add(testDownloadKey("a"), nil)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if err := b.Flush(api); err != nil {
+				t.Errorf("Flush: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if err := b.Flush(api); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+
+	if hours.downloads != 100 {
+		t.Errorf("Flushes wrote %d downloads, want 100", hours.downloads)
+	}
+	if flushing := flushingJournals(t, path); len(flushing) != 0 {
+		t.Errorf("Flushing journals left after flushes: %v", flushing)
+	}
+	if depth := openDownloads(t, path).Depth(); depth != 0 {
+		t.Errorf("Depth replayed after flushes = %d, want 0", depth)
+	}
+}
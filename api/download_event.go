@@ -0,0 +1,111 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/models"
+	"github.com/ericflo/gradientzoo/utils"
+)
+
+const scrubInterval = time.Hour
+
+// Addresses are cut down to the network they're in before they're hashed, so
+// that the hash can't pick out one household or machine
+var (
+	ipv4Network = net.CIDRMask(24, 32)
+	ipv6Network = net.CIDRMask(48, 128)
+)
+
+// Substrings of User-Agents that give away what kind of client made a request
+var (
+	botAgents    = []string{"bot", "crawler", "spider", "slurp"}
+	scriptAgents = []string{"curl", "wget", "python", "go-http-client", "java", "okhttp", "ruby", "node"}
+)
+
+// networkHash stands in for the network an IP address is in.  It's keyed with
+// the secret key, so it can't be reversed by hashing every network.
+func networkHash(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ""
+	}
+	if v4 := parsed.To4(); v4 != nil {
+		parsed = v4.Mask(ipv4Network)
+	} else {
+		parsed = parsed.Mask(ipv6Network)
+	}
+	mac := hmac.New(sha256.New, []byte(utils.Conf.SecretKey))
+	mac.Write([]byte("network:" + parsed.String()))
+	return hex.EncodeToString(mac.Sum(nil))[:16]
+}
+
+// agentClass sorts the request's client into one of a few broad kinds.
+func agentClass(req *http.Request) string {
+	if req.Header.Get("X-Gradientzoo-Client-Name") != "" {
+		return models.AGENT_CLIENT
+	}
+	agent := strings.ToLower(req.UserAgent())
+	for _, s := range botAgents {
+		if strings.Contains(agent, s) {
+			return models.AGENT_BOT
+		}
+	}
+	for _, s := range scriptAgents {
+		if strings.Contains(agent, s) {
+			return models.AGENT_SCRIPT
+		}
+	}
+	if strings.HasPrefix(agent, "mozilla/") {
+		return models.AGENT_BROWSER
+	}
+	return models.AGENT_OTHER
+}
+
+// rawDownload is the download for the download_event table, or nil if raw
+// downloads aren't being kept.
+func rawDownload(req *http.Request, fileId, ip string, t time.Time) *models.RawDownload {
+	if utils.Conf.DownloadEventRetentionDays <= 0 {
+		return nil
+	}
+	return &models.RawDownload{
+		FileId:      fileId,
+		NetworkHash: networkHash(ip),
+		AgentClass:  agentClass(req),
+		CreatedTime: t,
+	}
+}
+
+// scrubDownloadEvents runs forever, deleting raw downloads once they're older
+// than DownloadEventRetentionDays.  It's meant to be run in its own goroutine.
+func scrubDownloadEvents(api *models.ApiCollection) {
+	for {
+		scrubDownloadEventsOnce(api)
+		time.Sleep(scrubInterval)
+	}
+}
+
+func scrubDownloadEventsOnce(api *models.ApiCollection) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			log.WithField("err", rec).Error("Panic while scrubbing download events")
+		}
+	}()
+
+	// With retention turned off, everything goes
+	retention := time.Duration(utils.Conf.DownloadEventRetentionDays) * 24 * time.Hour
+	n, err := api.RawDownload.Scrub(time.Now().UTC().Add(-retention))
+	if err != nil {
+		log.WithField("err", err).Error("Could not scrub download events")
+		return
+	}
+	if n > 0 {
+		log.WithField("deleted", n).Info("Scrubbed download events")
+	}
+}
@@ -0,0 +1,41 @@
+package api
+
+import (
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/models"
+	"github.com/ericflo/gradientzoo/utils"
+)
+
+const rollupInterval = time.Hour
+
+// Download counts read the last two days from download_hour, so it has to be
+// kept at least that long
+const minDownloadHourRetention = 2 * 24 * time.Hour
+
+// rollupDownloads runs forever, rolling hourly downloads up into days and
+// months and pruning the hourly rows nobody needs any more.  It's meant to be
+// run in its own goroutine.
+func rollupDownloads(api *models.ApiCollection) {
+	for {
+		rollupDownloadsOnce(api)
+		time.Sleep(rollupInterval)
+	}
+}
+
+func rollupDownloadsOnce(api *models.ApiCollection) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			log.WithField("err", rec).Error("Panic while rolling up downloads")
+		}
+	}()
+
+	retention := time.Duration(utils.Conf.DownloadHourRetentionDays) * 24 * time.Hour
+	if retention < minDownloadHourRetention {
+		retention = minDownloadHourRetention
+	}
+	if err := api.DownloadHour.Rollup(time.Now().UTC().Add(-retention)); err != nil {
+		log.WithField("err", err).Error("Could not roll up downloads")
+	}
+}
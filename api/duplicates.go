@@ -0,0 +1,93 @@
+package api
+
+import (
+	"database/sql"
+
+	"github.com/ericflo/gradientzoo/models"
+)
+
+// Responses list at most this many possible duplicates
+const maxPossibleDuplicates = 5
+
+// PossibleDuplicate is a public model that a new one might be a copy of.
+// It's only advice: nothing stops anybody creating the new one anyway.
+type PossibleDuplicate struct {
+	Username string `json:"username"`
+	Slug     string `json:"slug"`
+	Name     string `json:"name"`
+	Url      string `json:"url"`
+	Reason   string `json:"reason"`
+}
+
+// possibleDuplicates fills in the owners of the models, which are keyed by
+// model id, with the reason each might be a duplicate.
+func possibleDuplicates(api *models.ApiCollection, ms []*models.Model, reasons map[string]string) ([]*PossibleDuplicate, error) {
+	userIds := make([]interface{}, 0, len(ms))
+	for _, m := range ms {
+		userIds = append(userIds, m.UserId)
+	}
+	users, err := api.User.ByIds(userIds)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	usernames := make(map[string]string, len(users))
+	for _, u := range users {
+		usernames[u.Id] = u.Username
+	}
+	dups := make([]*PossibleDuplicate, 0, len(ms))
+	for _, m := range ms {
+		username := usernames[m.UserId]
+		dups = append(dups, &PossibleDuplicate{
+			Username: username,
+			Slug:     m.Slug,
+			Name:     m.Name,
+			Url:      modelUrl(username, m.Slug),
+			Reason:   reasons[m.Id],
+		})
+	}
+	return dups, nil
+}
+
+// duplicatesByText finds public models whose name or description closely
+// match the model's.
+func duplicatesByText(api *models.ApiCollection, m *models.Model) ([]*PossibleDuplicate, error) {
+	found, err := api.Model.PossibleDuplicates(m.Name, m.Description, m.Id,
+		maxPossibleDuplicates)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	ms := make([]*models.Model, 0, len(found))
+	reasons := make(map[string]string, len(found))
+	for _, d := range found {
+		ms = append(ms, &d.Model)
+		reasons[d.Id] = d.Reason
+	}
+	return possibleDuplicates(api, ms, reasons)
+}
+
+// duplicatesByFile finds public models, other than m, with a file that has
+// the same contents as the one hashing to sha256.
+func duplicatesByFile(api *models.ApiCollection, m *models.Model, sha256 string) ([]*PossibleDuplicate, error) {
+	// Asking for one more allows for the model's own file
+	files, err := api.File.BySha256(sha256, "", maxPossibleDuplicates+1)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	modelIds := []interface{}{}
+	reasons := map[string]string{}
+	for _, f := range files {
+		if f.ModelId == m.Id || reasons[f.ModelId] != "" {
+			continue
+		}
+		modelIds = append(modelIds, f.ModelId)
+		reasons[f.ModelId] = models.DUPLICATE_FILE
+	}
+	if len(modelIds) > maxPossibleDuplicates {
+		modelIds = modelIds[:maxPossibleDuplicates]
+	}
+	ms, err := api.Model.ByIds(modelIds)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	return possibleDuplicates(api, ms, reasons)
+}
@@ -0,0 +1,140 @@
+package api
+
+import (
+	"net/http"
+)
+
+// Errors are sent as {"code": "...", "error": "..."}.  The error is a message
+// for people, and can be reworded at any time; the code is for programs to
+// branch on, and never changes once it's in use.  Every code there is is in
+// errorCatalog, which is served at /errors, and ERRORS.md lists which of them
+// each endpoint can send.
+const (
+	ERR_INVALID_REQUEST          = "invalid_request"
+	ERR_UNAUTHENTICATED          = "unauthenticated"
+	ERR_INVALID_CREDENTIALS      = "invalid_credentials"
+	ERR_SESSION_EXPIRED          = "session_expired"
+	ERR_EXPIRED                  = "expired"
+	ERR_INSUFFICIENT_SCOPE       = "insufficient_scope"
+	ERR_FORBIDDEN                = "forbidden"
+	ERR_CSRF_FAILED              = "csrf_failed"
+	ERR_IP_NOT_ALLOWED           = "ip_not_allowed"
+	ERR_TWO_FACTOR_REQUIRED      = "two_factor_required"
+	ERR_SSO_REQUIRED             = "sso_required"
+	ERR_PASSWORD_CHANGE_REQUIRED = "password_change_required"
+	ERR_ACCOUNT_SUSPENDED        = "account_suspended"
+	ERR_ACCOUNT_LOCKED           = "account_locked"
+	ERR_NOT_FOUND                = "not_found"
+	ERR_MODEL_NOT_FOUND          = "model_not_found"
+	ERR_USER_NOT_FOUND           = "user_not_found"
+	ERR_FILE_NOT_FOUND           = "file_not_found"
+	ERR_ALREADY_EXISTS           = "already_exists"
+	ERR_INVALID_STATE            = "invalid_state"
+	ERR_QUOTA_EXCEEDED           = "quota_exceeded"
+	ERR_PAYMENT_REQUIRED         = "payment_required"
+	ERR_FILE_QUARANTINED         = "file_quarantined"
+	ERR_RATE_LIMITED             = "rate_limited"
+	ERR_DOWNLOADS_PAUSED         = "downloads_paused"
+	ERR_UNAVAILABLE              = "unavailable"
+	ERR_INTERNAL                 = "internal_error"
+
+	// Device authorization (RFC 8628) has codes of its own, which are also
+	// its messages
+	ERR_AUTHORIZATION_PENDING = "authorization_pending"
+	ERR_SLOW_DOWN             = "slow_down"
+	ERR_ACCESS_DENIED         = "access_denied"
+	ERR_EXPIRED_TOKEN         = "expired_token"
+)
+
+// ErrorCode describes one of the codes errors can have, and the statuses it's
+// sent with.
+type ErrorCode struct {
+	Code        string `json:"code"`
+	Statuses    []int  `json:"statuses"`
+	Description string `json:"description"`
+}
+
+var errorCatalog = []*ErrorCode{
+	{ERR_INVALID_REQUEST, []int{http.StatusBadRequest},
+		"Something in the request is missing, malformed, or out of range; fields says what, if it can"},
+	{ERR_UNAUTHENTICATED, []int{http.StatusUnauthorized, http.StatusBadRequest},
+		"The endpoint needs a token or app key, and none was sent"},
+	{ERR_INVALID_CREDENTIALS, []int{http.StatusUnauthorized, http.StatusBadRequest},
+		"The username, password, code, or key sent isn't right"},
+	{ERR_SESSION_EXPIRED, []int{http.StatusUnauthorized, http.StatusBadRequest},
+		"The token or sign in has run out, and the user has to sign in again"},
+	{ERR_EXPIRED, []int{http.StatusBadRequest, http.StatusNotFound, http.StatusGone},
+		"The link, code, or share used has expired or was never valid"},
+	{ERR_INSUFFICIENT_SCOPE, []int{http.StatusUnauthorized},
+		"The token doesn't have the scope, or isn't for the models, that this needs"},
+	{ERR_FORBIDDEN, []int{http.StatusUnauthorized, http.StatusBadRequest},
+		"The user isn't allowed to do this"},
+	{ERR_CSRF_FAILED, []int{http.StatusForbidden},
+		"A request signed in by cookie didn't carry the CSRF token"},
+	{ERR_IP_NOT_ALLOWED, []int{http.StatusForbidden},
+		"The token can't be used from this address"},
+	{ERR_TWO_FACTOR_REQUIRED, []int{http.StatusUnauthorized, http.StatusBadRequest},
+		"The user has to set up two-factor authentication first"},
+	{ERR_SSO_REQUIRED, []int{http.StatusUnauthorized},
+		"The user's organization signs in with single sign-on, not a password"},
+	{ERR_PASSWORD_CHANGE_REQUIRED, []int{http.StatusForbidden},
+		"The user has to choose a new password, from the link they were e-mailed"},
+	{ERR_ACCOUNT_SUSPENDED, []int{http.StatusForbidden},
+		"The account is suspended, and can't change anything"},
+	{ERR_ACCOUNT_LOCKED, []int{http.StatusForbidden},
+		"The account is locked after too many failed logins"},
+	{ERR_NOT_FOUND, []int{http.StatusNotFound},
+		"Whatever was asked for doesn't exist, or the user can't see it"},
+	{ERR_MODEL_NOT_FOUND, []int{http.StatusNotFound, http.StatusBadRequest},
+		"The model doesn't exist, or the user can't see it"},
+	{ERR_USER_NOT_FOUND, []int{http.StatusNotFound},
+		"There's no user by that username or id"},
+	{ERR_FILE_NOT_FOUND, []int{http.StatusNotFound},
+		"The file, or the version of it, doesn't exist"},
+	{ERR_ALREADY_EXISTS, []int{http.StatusBadRequest, http.StatusConflict},
+		"Something with that name, address, or account already exists"},
+	{ERR_INVALID_STATE, []int{http.StatusBadRequest, http.StatusConflict},
+		"It can't be done to the thing as it is now, e.g. resolving something already resolved"},
+	{ERR_QUOTA_EXCEEDED, []int{http.StatusBadRequest, http.StatusForbidden, http.StatusPaymentRequired},
+		"The plan's storage, bandwidth, versions, or how many of something it can have is used up"},
+	{ERR_PAYMENT_REQUIRED, []int{http.StatusBadRequest},
+		"A payment source has to be connected first"},
+	{ERR_FILE_QUARANTINED, []int{StatusUnavailableForLegalReasons},
+		"The file has been taken down, and can't be downloaded"},
+	{ERR_RATE_LIMITED, []int{http.StatusTooManyRequests},
+		"Too many requests; wait for the Retry-After header, if there is one"},
+	{ERR_DOWNLOADS_PAUSED, []int{http.StatusTooManyRequests},
+		"Downloads from the account are paused after unusual activity"},
+	{ERR_UNAVAILABLE, []int{http.StatusBadGateway, http.StatusServiceUnavailable},
+		"Something went wrong on our end, or the server is too busy; it's safe to try again soon, after Retry-After if it's sent"},
+	{ERR_INTERNAL, []int{http.StatusInternalServerError},
+		"Something we didn't expect went wrong on our end; request_id says which request, for reporting it"},
+	{ERR_AUTHORIZATION_PENDING, []int{http.StatusBadRequest},
+		"The device hasn't been approved yet; keep polling"},
+	{ERR_SLOW_DOWN, []int{http.StatusBadRequest},
+		"The device is polling too often; poll less often"},
+	{ERR_ACCESS_DENIED, []int{http.StatusBadRequest},
+		"The user refused to approve the device"},
+	{ERR_EXPIRED_TOKEN, []int{http.StatusBadRequest},
+		"The device code has expired; start over"},
+}
+
+// ApiError is the body of every error response.  Requests that fail
+// validation also get what's wrong with each field, and unexpected errors
+// the id of the request, which is also in the X-Request-Id header.
+type ApiError struct {
+	Code      string        `json:"code"`
+	Message   string        `json:"error"`
+	Fields    []*FieldError `json:"fields,omitempty"`
+	RequestId string        `json:"request_id,omitempty"`
+}
+
+func ApiErr(code, msg string) *ApiError {
+	return &ApiError{Code: code, Message: msg}
+}
+
+func HandleErrors(c *Context, w http.ResponseWriter, req *http.Request) {
+	c.Render.JSON(w, http.StatusOK, map[string]interface{}{
+		"errors": errorCatalog,
+	})
+}
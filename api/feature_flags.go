@@ -0,0 +1,54 @@
+package api
+
+import (
+	"database/sql"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// Feature flags for things that are being rolled out gradually.  Each one is
+// off until an admin saves it at /admin/feature-flags, and can be turned off
+// again there if it goes wrong.
+const (
+	// Uploads of exactly what's already the latest version of a file don't
+	// make a new version
+	FLAG_UPLOAD_DEDUP = "upload_dedup"
+)
+
+// featureEnabled says whether the flag is on for whoever made the request.
+// Flags that can't be looked up are off, so that trouble with the database
+// never turns on something risky.
+func featureEnabled(c *Context, name string) bool {
+	flag, err := c.Api.FeatureFlag.ByName(name)
+	if err == sql.ErrNoRows {
+		return false
+	}
+	if err != nil {
+		c.Log().WithFields(log.Fields{
+			"err":  err,
+			"flag": name,
+		}).Error("Could not look up feature flag")
+		return false
+	}
+
+	userId, orgId := "", ""
+	if c.User != nil {
+		userId = c.User.Id
+		if c.User.ServiceOrgId.Valid {
+			orgId = c.User.ServiceOrgId.String
+		} else if flag.NeedsOrganization(userId) {
+			org, err := c.Api.Organization.ByUserId(userId)
+			if err != nil && err != sql.ErrNoRows {
+				c.Log().WithFields(log.Fields{
+					"err":     err,
+					"flag":    name,
+					"user_id": userId,
+				}).Error("Could not look up organization for feature flag")
+			}
+			if org != nil {
+				orgId = org.Id
+			}
+		}
+	}
+	return flag.EnabledFor(userId, orgId)
+}
@@ -0,0 +1,37 @@
+package api
+
+import (
+	"time"
+
+	"github.com/ericflo/gradientzoo/models"
+	"github.com/ericflo/gradientzoo/utils"
+)
+
+// Feed cursors start after the updated time and id of the last model on a
+// page
+func feedCursor(m *models.FeedModel) string {
+	return encodeCursor("feed", &models.PageKey{
+		Keys: []string{m.UpdatedTime.UTC().Format(time.RFC3339Nano)},
+		Id:   m.Id,
+	})
+}
+
+func parseFeedCursor(cursor string) (time.Time, string, error) {
+	key, err := decodeCursor("feed", cursor)
+	if err != nil {
+		return time.Time{}, "", err
+	}
+	if len(key.Keys) != 1 || key.Id == "" {
+		return time.Time{}, "", errBadCursor
+	}
+	t, err := time.Parse(time.RFC3339Nano, key.Keys[0])
+	if err != nil {
+		return time.Time{}, "", errBadCursor
+	}
+	return t, key.Id, nil
+}
+
+// modelUrl is where a model lives on the frontend
+func modelUrl(username, slug string) string {
+	return utils.Conf.WwwUrl + "/" + username + "/" + slug
+}
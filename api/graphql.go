@@ -0,0 +1,417 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/graphql"
+	"github.com/ericflo/gradientzoo/models"
+)
+
+// The most items any list field in the schema will give back
+const maxGraphqlListSize = 100
+
+var errGraphqlUnavailable = errors.New("Could not get that, please try again soon")
+
+// graphqlSchema is the schema served at /graphql.  Every model reachable from
+// it has been checked with can, so nothing needs checking further down.
+var graphqlSchema = newGraphqlSchema()
+
+func gqlContext(p interface{}) *Context {
+	switch p := p.(type) {
+	case *graphql.Params:
+		return p.Context.(*Context)
+	case *graphql.BatchParams:
+		return p.Context.(*Context)
+	}
+	return nil
+}
+
+func gqlLimit(args graphql.Args, def int) int {
+	limit := args.Int("limit", def)
+	if limit < 1 {
+		return 1
+	}
+	if limit > maxGraphqlListSize {
+		return maxGraphqlListSize
+	}
+	return limit
+}
+
+// gqlModels gets the models the viewer is allowed to see out of ms.
+func gqlModels(c *Context, ms []*models.Model) []*models.Model {
+	return visibleModels(c, ms)
+}
+
+// hydrateGraphqlModels hydrates whichever of the sources haven't been yet,
+// all at once, since several fields need it.
+func hydrateGraphqlModels(c *Context, sources []interface{}) ([]*models.Model, error) {
+	ms := make([]*models.Model, len(sources))
+	var unhydrated []*models.Model
+	for i, s := range sources {
+		ms[i] = s.(*models.Model)
+		if ms[i].Downloads == nil {
+			unhydrated = append(unhydrated, ms[i])
+		}
+	}
+	if len(unhydrated) == 0 {
+		return ms, nil
+	}
+	return ms, c.Api.Model.Hydrate(unhydrated)
+}
+
+func hydrateGraphqlFiles(c *Context, sources []interface{}) ([]*models.File, error) {
+	files := make([]*models.File, len(sources))
+	var unhydrated []*models.File
+	for i, s := range sources {
+		files[i] = s.(*models.File)
+		if files[i].Downloads == nil {
+			unhydrated = append(unhydrated, files[i])
+		}
+	}
+	if len(unhydrated) == 0 {
+		return files, nil
+	}
+	return files, c.Api.File.Hydrate(unhydrated)
+}
+
+// Most fields just read a struct field off of their source
+func userField(t graphql.Type, get func(*models.User) interface{}) *graphql.Field {
+	return &graphql.Field{Type: t, Resolve: func(p *graphql.Params) (interface{}, error) {
+		return get(p.Source.(*models.User)), nil
+	}}
+}
+
+func modelField(t graphql.Type, get func(*models.Model) interface{}) *graphql.Field {
+	return &graphql.Field{Type: t, Resolve: func(p *graphql.Params) (interface{}, error) {
+		return get(p.Source.(*models.Model)), nil
+	}}
+}
+
+func fileField(t graphql.Type, get func(*models.File) interface{}) *graphql.Field {
+	return &graphql.Field{Type: t, Resolve: func(p *graphql.Params) (interface{}, error) {
+		return get(p.Source.(*models.File)), nil
+	}}
+}
+
+func countsField(t graphql.Type, get func(*models.DownloadCounts) interface{}) *graphql.Field {
+	return &graphql.Field{Type: t, Resolve: func(p *graphql.Params) (interface{}, error) {
+		return get(p.Source.(*models.DownloadCounts)), nil
+	}}
+}
+
+func pointField(t graphql.Type, get func(*models.ModelPoint) interface{}) *graphql.Field {
+	return &graphql.Field{Type: t, Resolve: func(p *graphql.Params) (interface{}, error) {
+		return get(p.Source.(*models.ModelPoint)), nil
+	}}
+}
+
+func newGraphqlSchema() *graphql.Schema {
+	user := &graphql.Object{Name: "User"}
+	model := &graphql.Object{Name: "Model"}
+	file := &graphql.Object{Name: "File"}
+	downloads := &graphql.Object{Name: "DownloadCounts"}
+	point := &graphql.Object{Name: "DownloadPoint"}
+
+	user.Fields = map[string]*graphql.Field{
+		"id":          userField(graphql.ID, func(u *models.User) interface{} { return u.Id }),
+		"username":    userField(graphql.String, func(u *models.User) interface{} { return u.Username }),
+		"displayName": userField(graphql.String, func(u *models.User) interface{} { return u.DisplayName }),
+		"bio":         userField(graphql.String, func(u *models.User) interface{} { return u.Bio }),
+		"affiliation": userField(graphql.String, func(u *models.User) interface{} { return u.Affiliation }),
+		"website":     userField(graphql.String, func(u *models.User) interface{} { return u.Website }),
+		"createdTime": userField(graphql.Time, func(u *models.User) interface{} { return u.CreatedTime }),
+		"models": {
+			Type: graphql.ListOf(model),
+			Resolve: func(p *graphql.Params) (interface{}, error) {
+				c := gqlContext(p)
+				u := p.Source.(*models.User)
+				ms, err := c.Api.Model.ByUserId(u.Id)
+				if err != nil && err != sql.ErrNoRows {
+					log.WithFields(log.Fields{"err": err, "user_id": u.Id}).Error("Could not look up models by user id")
+					return nil, errGraphqlUnavailable
+				}
+				ms = gqlModels(c, ms)
+				if limit := gqlLimit(p.Args, maxGraphqlListSize); len(ms) > limit {
+					ms = ms[:limit]
+				}
+				return ms, nil
+			},
+		},
+	}
+
+	model.Fields = map[string]*graphql.Field{
+		"id":          modelField(graphql.ID, func(m *models.Model) interface{} { return m.Id }),
+		"slug":        modelField(graphql.String, func(m *models.Model) interface{} { return m.Slug }),
+		"name":        modelField(graphql.String, func(m *models.Model) interface{} { return m.Name }),
+		"description": modelField(graphql.String, func(m *models.Model) interface{} { return m.Description }),
+		"readme":      modelField(graphql.String, func(m *models.Model) interface{} { return m.Readme }),
+		"visibility":  modelField(graphql.String, func(m *models.Model) interface{} { return m.Visibility }),
+		"license":     modelField(graphql.String, func(m *models.Model) interface{} { return m.License }),
+		"createdTime": modelField(graphql.Time, func(m *models.Model) interface{} { return m.CreatedTime }),
+		"updatedTime": modelField(graphql.Time, func(m *models.Model) interface{} { return m.UpdatedTime }),
+		"user": {
+			Type: user,
+			Batch: func(p *graphql.BatchParams) ([]interface{}, error) {
+				c := gqlContext(p)
+				userIds := make([]string, 0, len(p.Sources))
+				for _, s := range p.Sources {
+					userIds = append(userIds, s.(*models.Model).UserId)
+				}
+				users, err := c.Load.Users(userIds)
+				if err != nil {
+					log.WithField("err", err).Error("Could not get users by id")
+					return nil, errGraphqlUnavailable
+				}
+				byId := make(map[string]*models.User, len(users))
+				for _, u := range users {
+					byId[u.Id] = u
+				}
+				values := make([]interface{}, len(p.Sources))
+				for i, s := range p.Sources {
+					values[i] = byId[s.(*models.Model).UserId]
+				}
+				return values, nil
+			},
+		},
+		"stars": {
+			Type: graphql.Int,
+			Batch: func(p *graphql.BatchParams) ([]interface{}, error) {
+				ms, err := hydrateGraphqlModels(gqlContext(p), p.Sources)
+				if err != nil {
+					log.WithField("err", err).Error("Could not hydrate")
+					return nil, errGraphqlUnavailable
+				}
+				values := make([]interface{}, len(ms))
+				for i, m := range ms {
+					values[i] = m.Stars
+				}
+				return values, nil
+			},
+		},
+		"downloads": {
+			Type: downloads,
+			Batch: func(p *graphql.BatchParams) ([]interface{}, error) {
+				ms, err := hydrateGraphqlModels(gqlContext(p), p.Sources)
+				if err != nil {
+					log.WithField("err", err).Error("Could not hydrate")
+					return nil, errGraphqlUnavailable
+				}
+				values := make([]interface{}, len(ms))
+				for i, m := range ms {
+					values[i] = m.Downloads
+				}
+				return values, nil
+			},
+		},
+		"files": {
+			Type: graphql.ListOf(file),
+			Batch: func(p *graphql.BatchParams) ([]interface{}, error) {
+				c := gqlContext(p)
+				modelIds := make([]interface{}, 0, len(p.Sources))
+				for _, s := range p.Sources {
+					modelIds = append(modelIds, s.(*models.Model).Id)
+				}
+				files, err := c.Api.File.LatestByModelIds(modelIds)
+				if err != nil && err != sql.ErrNoRows {
+					log.WithField("err", err).Error("Could not look up files by model ids")
+					return nil, errGraphqlUnavailable
+				}
+				byModelId := map[string][]*models.File{}
+				for _, f := range files {
+					byModelId[f.ModelId] = append(byModelId[f.ModelId], f)
+				}
+				values := make([]interface{}, len(p.Sources))
+				for i, s := range p.Sources {
+					fs := byModelId[s.(*models.Model).Id]
+					if fs == nil {
+						fs = []*models.File{}
+					}
+					values[i] = fs
+				}
+				return values, nil
+			},
+		},
+		"versions": {
+			Type: graphql.ListOf(file),
+			Resolve: func(p *graphql.Params) (interface{}, error) {
+				c := gqlContext(p)
+				m := p.Source.(*models.Model)
+				files, err := c.Api.File.Releases(m.Id, gqlLimit(p.Args, 20))
+				if err != nil && err != sql.ErrNoRows {
+					log.WithFields(log.Fields{"err": err, "model_id": m.Id}).Error("Could not look up model releases")
+					return nil, errGraphqlUnavailable
+				}
+				return files, nil
+			},
+		},
+		"stats": {
+			Type: graphql.ListOf(point),
+			Resolve: func(p *graphql.Params) (interface{}, error) {
+				c := gqlContext(p)
+				m := p.Source.(*models.Model)
+				granularity := p.Args.String("granularity")
+				if granularity == "" {
+					granularity = models.GRANULARITY_DAY
+				}
+				maxRange, ok := maxStatsRange[granularity]
+				if !ok {
+					return nil, errors.New("Granularity must be one of 'hour', 'day'")
+				}
+				end := time.Now().UTC()
+				if e := p.Args.String("end"); e != "" {
+					var err error
+					if end, err = time.Parse(time.RFC3339, e); err != nil {
+						return nil, errors.New("End must be an RFC 3339 time, like 2016-05-01T00:00:00Z")
+					}
+				}
+				start := end.Add(-defaultStatsRange[granularity])
+				if s := p.Args.String("start"); s != "" {
+					var err error
+					if start, err = time.Parse(time.RFC3339, s); err != nil {
+						return nil, errors.New("Start must be an RFC 3339 time, like 2016-04-01T00:00:00Z")
+					}
+				}
+				if !start.Before(end) {
+					return nil, errors.New("Start must be before end")
+				}
+				if end.Sub(start) > maxRange {
+					return nil, errors.New("That range is too long, ask for a shorter one")
+				}
+				series, err := c.Api.DownloadHour.TotalSeries(m.Id, granularity, start, end)
+				if err != nil && err != sql.ErrNoRows {
+					log.WithFields(log.Fields{"err": err, "model_id": m.Id}).Error("Could not get download series")
+					return nil, errGraphqlUnavailable
+				}
+				return series, nil
+			},
+		},
+	}
+
+	file.Fields = map[string]*graphql.Field{
+		"id":               fileField(graphql.ID, func(f *models.File) interface{} { return f.Id }),
+		"filename":         fileField(graphql.String, func(f *models.File) interface{} { return f.Filename }),
+		"status":           fileField(graphql.String, func(f *models.File) interface{} { return f.Status }),
+		"framework":        fileField(graphql.String, func(f *models.File) interface{} { return f.Framework }),
+		"frameworkVersion": fileField(graphql.String, func(f *models.File) interface{} { return f.FrameworkVersion }),
+		"clientName":       fileField(graphql.String, func(f *models.File) interface{} { return f.ClientName }),
+		"sizeBytes":        fileField(graphql.Int, func(f *models.File) interface{} { return f.SizeBytes }),
+		"sha256":           fileField(graphql.String, func(f *models.File) interface{} { return f.Sha256 }),
+		"createdTime":      fileField(graphql.Time, func(f *models.File) interface{} { return f.CreatedTime }),
+		"downloads": {
+			Type: downloads,
+			Batch: func(p *graphql.BatchParams) ([]interface{}, error) {
+				files, err := hydrateGraphqlFiles(gqlContext(p), p.Sources)
+				if err != nil {
+					log.WithField("err", err).Error("Could not hydrate files")
+					return nil, errGraphqlUnavailable
+				}
+				values := make([]interface{}, len(files))
+				for i, f := range files {
+					values[i] = f.Downloads
+				}
+				return values, nil
+			},
+		},
+		"quarantined": {
+			Type: graphql.Boolean,
+			Batch: func(p *graphql.BatchParams) ([]interface{}, error) {
+				files, err := hydrateGraphqlFiles(gqlContext(p), p.Sources)
+				if err != nil {
+					log.WithField("err", err).Error("Could not hydrate files")
+					return nil, errGraphqlUnavailable
+				}
+				values := make([]interface{}, len(files))
+				for i, f := range files {
+					values[i] = f.Quarantine != nil
+				}
+				return values, nil
+			},
+		},
+	}
+
+	downloads.Fields = map[string]*graphql.Field{
+		"day":         countsField(graphql.Int, func(d *models.DownloadCounts) interface{} { return d.Day }),
+		"week":        countsField(graphql.Int, func(d *models.DownloadCounts) interface{} { return d.Week }),
+		"month":       countsField(graphql.Int, func(d *models.DownloadCounts) interface{} { return d.Month }),
+		"all":         countsField(graphql.Int, func(d *models.DownloadCounts) interface{} { return d.All }),
+		"downloaders": countsField(graphql.Int, func(d *models.DownloadCounts) interface{} { return d.Downloaders }),
+	}
+
+	point.Fields = map[string]*graphql.Field{
+		"time":      pointField(graphql.Time, func(pt *models.ModelPoint) interface{} { return pt.Time }),
+		"downloads": pointField(graphql.Int, func(pt *models.ModelPoint) interface{} { return pt.Downloads }),
+	}
+
+	query := &graphql.Object{Name: "Query"}
+	query.Fields = map[string]*graphql.Field{
+		"me": {
+			Type: user,
+			Resolve: func(p *graphql.Params) (interface{}, error) {
+				return gqlContext(p).User, nil
+			},
+		},
+		"user": {
+			Type: user,
+			Resolve: func(p *graphql.Params) (interface{}, error) {
+				c := gqlContext(p)
+				u, err := c.Api.User.ByUsername(p.Args.String("username"))
+				if err == sql.ErrNoRows {
+					return nil, nil
+				} else if err != nil {
+					log.WithField("err", err).Error("Could not look up user by username")
+					return nil, errGraphqlUnavailable
+				}
+				return u, nil
+			},
+		},
+		"model": {
+			Type: model,
+			Resolve: func(p *graphql.Params) (interface{}, error) {
+				c := gqlContext(p)
+				u, err := c.Api.User.ByUsername(p.Args.String("username"))
+				if err == sql.ErrNoRows || u == nil {
+					return nil, nil
+				} else if err != nil {
+					log.WithField("err", err).Error("Could not look up user by username")
+					return nil, errGraphqlUnavailable
+				}
+				m, err := c.Api.Model.ByUserIdSlug(u.Id, p.Args.String("slug"))
+				if err == sql.ErrNoRows || m == nil {
+					return nil, nil
+				} else if err != nil {
+					log.WithField("err", err).Error("Could not look up model by username & slug")
+					return nil, errGraphqlUnavailable
+				}
+				// Models the viewer can't see look just like ones that don't exist
+				if !can(c, m, ACTION_READ) {
+					return nil, nil
+				}
+				return m, nil
+			},
+		},
+		"models": {
+			Type: graphql.ListOf(model),
+			Resolve: func(p *graphql.Params) (interface{}, error) {
+				c := gqlContext(p)
+				sort := p.Args.String("sort")
+				if sort == "" {
+					sort = models.MODEL_SORT_CREATED
+				}
+				if !models.ValidModelSort(sort) {
+					return nil, errors.New("Sort must be one of 'created', 'updated', 'downloads', 'stars', 'name'")
+				}
+				ms, _, err := c.Api.Model.ByVisibility("public", nil, sort, gqlLimit(p.Args, 20), nil)
+				if err != nil && err != sql.ErrNoRows {
+					log.WithField("err", err).Error("Could not look up public models")
+					return nil, errGraphqlUnavailable
+				}
+				return ms, nil
+			},
+		},
+	}
+
+	return &graphql.Schema{Query: query, MaxDepth: 8, MaxComplexity: 1000}
+}
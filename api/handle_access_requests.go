@@ -0,0 +1,78 @@
+package api
+
+import (
+	"net/http"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/models"
+)
+
+// AccessRequestWithUser is an access request along with who made it, so
+// owners can tell who they're letting in.
+type AccessRequestWithUser struct {
+	*models.AccessRequest
+	User *models.User `json:"user"`
+}
+
+func HandleAccessRequests(c *Context, w http.ResponseWriter, req *http.Request) {
+	clog := c.Log().WithFields(log.Fields{
+		"user_id":  c.User.Id,
+		"username": c.Params.ByName("username"),
+		"slug":     c.Params.ByName("slug"),
+	})
+
+	// Pending requests by default, or ?status=all for every one
+	status := req.URL.Query().Get("status")
+	switch status {
+	case "":
+		status = models.ACCESS_PENDING
+	case "all":
+		status = ""
+	case models.ACCESS_PENDING, models.ACCESS_APPROVED, models.ACCESS_DENIED:
+	default:
+		c.Render.JSON(w, http.StatusBadRequest,
+			ApiErr(ERR_INVALID_REQUEST, "Status must be one of pending, approved, denied, or all"))
+		return
+	}
+
+	m := accessModel(c, w, clog)
+	if m == nil {
+		return
+	}
+	clog = clog.WithField("model_id", m.Id)
+	if !authorize(c, w, m, ACTION_MANAGE,
+		"Only the owner of a model can see who asked for access") {
+		return
+	}
+
+	rs, err := c.Api.AccessRequest.ByModelId(m.Id, status)
+	if err != nil {
+		clog.WithField("err", err).Error("Could not look up access requests")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not get access requests, please try again soon"))
+		return
+	}
+
+	userIds := make([]interface{}, 0, len(rs))
+	for _, r := range rs {
+		userIds = append(userIds, r.UserId)
+	}
+	users, err := c.Api.User.ByIds(userIds)
+	if err != nil {
+		clog.WithField("err", err).Error("Could not look up requesting users")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not get access requests, please try again soon"))
+		return
+	}
+	byId := map[string]*models.User{}
+	for _, u := range users {
+		byId[u.Id] = u
+	}
+
+	resp := make([]*AccessRequestWithUser, 0, len(rs))
+	for _, r := range rs {
+		resp = append(resp, &AccessRequestWithUser{r, byId[r.UserId]})
+	}
+
+	c.Render.JSON(w, http.StatusOK, map[string]interface{}{"access_requests": resp})
+}
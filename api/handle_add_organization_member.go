@@ -0,0 +1,77 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/ericflo/gradientzoo/models"
+)
+
+type AddOrganizationMemberForm struct {
+	Username string `json:"username"`
+}
+
+func HandleAddOrganizationMember(c *Context, w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+
+	clog := c.Log().WithField("user_id", c.User.Id)
+
+	// Parse the JSON POST body
+	var form AddOrganizationMemberForm
+	if !decodeForm(c, w, req, clog, "member", &form) {
+		return
+	}
+
+	org, err := userOrganization(c.Api, c.User.Id)
+	if err != nil {
+		clog.WithField("err", err).Error("Could not look up organization")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not add that member, please try again soon"))
+		return
+	}
+	if org == nil || org.OwnerId != c.User.Id {
+		c.Render.JSON(w, http.StatusUnauthorized,
+			ApiErr(ERR_FORBIDDEN, "Only an organization's owner can add members"))
+		return
+	}
+
+	clog = clog.WithField("organization_id", org.Id)
+
+	member, err := c.Api.User.ByUsername(form.Username)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up user by username")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not add that member, please try again soon"))
+		return
+	}
+	if err == sql.ErrNoRows || member == nil {
+		c.Render.JSON(w, http.StatusNotFound,
+			ApiErr(ERR_USER_NOT_FOUND, "No user by that username could be found"))
+		return
+	}
+
+	existing, err := userOrganization(c.Api, member.Id)
+	if err != nil {
+		clog.WithField("err", err).Error("Could not look up member's organization")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not add that member, please try again soon"))
+		return
+	}
+	if existing != nil {
+		c.Render.JSON(w, http.StatusBadRequest,
+			ApiErr(ERR_INVALID_STATE, "That user already belongs to an organization"))
+		return
+	}
+
+	if err = c.Api.Organization.AddMember(org.Id, member.Id); err != nil {
+		clog.WithField("err", err).Error("Could not add organization member")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not add that member, please try again soon"))
+		return
+	}
+
+	audit(c, req, c.User.Id, member.Id, models.AUDIT_ORG_MEMBER_ADD,
+		"organization", org.Id, map[string]interface{}{"username": member.Username})
+
+	c.Render.JSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
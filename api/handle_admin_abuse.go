@@ -0,0 +1,39 @@
+package api
+
+import (
+	"net/http"
+)
+
+func HandleAdminAbuse(c *Context, w http.ResponseWriter, req *http.Request) {
+	clog := c.Log().WithField("user_id", c.User.Id)
+
+	flags, err := c.Api.AbuseFlag.Unresolved(200)
+	if err != nil {
+		clog.WithField("err", err).Error("Could not look up abuse flags")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not get the abuse queue, please try again soon"))
+		return
+	}
+
+	// Admins need to know who they're looking at
+	userIds := []interface{}{}
+	seen := map[string]bool{}
+	for _, flag := range flags {
+		if !seen[flag.UserId] {
+			seen[flag.UserId] = true
+			userIds = append(userIds, flag.UserId)
+		}
+	}
+	users, err := c.Api.User.ByIds(userIds)
+	if err != nil {
+		clog.WithField("err", err).Error("Could not look up flagged users")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not get the abuse queue, please try again soon"))
+		return
+	}
+
+	c.Render.JSON(w, http.StatusOK, map[string]interface{}{
+		"flags": flags,
+		"users": users,
+	})
+}
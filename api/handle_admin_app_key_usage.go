@@ -0,0 +1,32 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+func HandleAdminAppKeyUsage(c *Context, w http.ResponseWriter, req *http.Request) {
+	id := c.Params.ByName("id")
+
+	clog := c.Log().WithFields(log.Fields{
+		"user_id":    c.User.Id,
+		"app_key_id": id,
+	})
+
+	appKey, err := c.Api.AppKey.ById(id)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up app key")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not get app key usage, please try again soon"))
+		return
+	}
+	if err == sql.ErrNoRows || appKey == nil {
+		c.Render.JSON(w, http.StatusNotFound,
+			ApiErr(ERR_NOT_FOUND, "No app key with that id could be found"))
+		return
+	}
+
+	appKeyUsageRespond(c, w, req, clog, appKey)
+}
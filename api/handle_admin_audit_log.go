@@ -0,0 +1,57 @@
+package api
+
+import (
+	"net/http"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/models"
+	"github.com/pborman/uuid"
+)
+
+func HandleAdminAuditLog(c *Context, w http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+	filter := &models.AuditFilter{
+		ActorId: query.Get("actor_id"),
+		OwnerId: query.Get("owner_id"),
+		Action:  query.Get("action"),
+	}
+
+	clog := c.Log().WithFields(log.Fields{
+		"auth_user_id": c.User.Id,
+		"actor_id":     filter.ActorId,
+		"owner_id":     filter.OwnerId,
+		"action":       filter.Action,
+	})
+
+	for _, id := range []string{filter.ActorId, filter.OwnerId} {
+		if id != "" && uuid.Parse(id) == nil {
+			c.Render.JSON(w, http.StatusBadRequest,
+				ApiErr(ERR_INVALID_REQUEST, "User ids must be valid UUIDs"))
+			return
+		}
+	}
+
+	before, limit, err := auditPage(req)
+	if err != nil {
+		c.Render.JSON(w, http.StatusBadRequest, ApiErr(ERR_INVALID_REQUEST, err.Error()))
+		return
+	}
+
+	events, err := c.Api.AuditEvent.Search(filter, before, limit)
+	if err != nil {
+		clog.WithField("err", err).Error("Could not search audit events")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not get the audit log, please try again soon"))
+		return
+	}
+
+	resp, err := auditResponse(c, events, limit)
+	if err != nil {
+		clog.WithField("err", err).Error("Could not get audit event users")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not get the audit log, please try again soon"))
+		return
+	}
+
+	c.Render.JSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,16 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/ericflo/gradientzoo/utils"
+)
+
+// HandleAdminConfig shows the config the server is running with, with its
+// secrets redacted, to help work out why it's behaving the way it is.
+func HandleAdminConfig(c *Context, w http.ResponseWriter, req *http.Request) {
+	c.Render.JSON(w, http.StatusOK, map[string]interface{}{
+		"config":      utils.Live().Redacted(),
+		"config_file": utils.ConfigFile,
+	})
+}
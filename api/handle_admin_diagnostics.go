@@ -0,0 +1,98 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"runtime"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/blobstorage"
+	"github.com/ericflo/gradientzoo/utils"
+)
+
+// How busy the database pool is.  Main points this at the real pool.
+var dbStats = func() sql.DBStats { return sql.DBStats{} }
+
+// How many of the most recent GC pauses are shown
+const recentGcPauses = 10
+
+// HandleAdminDiagnostics shows what the server's runtime is up to: its
+// goroutines, heap and GC, and the work that's under way or waiting, for
+// working out where memory is going, e.g. during big uploads.  With gc=true
+// it collects garbage first, so that the heap is only what's still in use.
+func HandleAdminDiagnostics(c *Context, w http.ResponseWriter, req *http.Request) {
+	clog := c.Log().WithFields(log.Fields{"user_id": c.User.Id})
+
+	if req.URL.Query().Get("gc") == "true" {
+		runtime.GC()
+	}
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	// The pauses are in a ring, most recent at (NumGC+255)%256
+	pauses := []float64{}
+	for i := uint32(0); i < recentGcPauses && i < mem.NumGC; i++ {
+		pause := mem.PauseNs[(mem.NumGC-i+255)%256]
+		pauses = append(pauses, time.Duration(pause).Seconds())
+	}
+	var lastGc *time.Time
+	if mem.LastGC > 0 {
+		t := time.Unix(0, int64(mem.LastGC)).UTC()
+		lastGc = &t
+	}
+
+	jobs, err := c.Api.Job.Depths()
+	if err != nil {
+		clog.WithFields(log.Fields{"err": err}).Error("Could not count jobs")
+		c.Render.JSON(w, http.StatusBadGateway, ApiErr(ERR_UNAVAILABLE, "Could not count jobs"))
+		return
+	}
+	searchDepth, err := c.Api.SearchIndex.Depth()
+	if err != nil {
+		clog.WithFields(log.Fields{"err": err}).Error("Could not count search index updates")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not count search index updates"))
+		return
+	}
+
+	// Only storage that's instrumented keeps track of what it's doing
+	var blobStats *blobstorage.Stats
+	if b, ok := c.Blob.(*blobstorage.InstrumentedBlobStorage); ok {
+		stats := b.Stats()
+		blobStats = &stats
+	}
+
+	c.Render.JSON(w, http.StatusOK, map[string]interface{}{
+		"goroutines": runtime.NumGoroutine(),
+		"cpus":       runtime.NumCPU(),
+		"go_version": runtime.Version(),
+		"heap": map[string]interface{}{
+			"alloc_bytes":    mem.HeapAlloc,
+			"in_use_bytes":   mem.HeapInuse,
+			"idle_bytes":     mem.HeapIdle,
+			"released_bytes": mem.HeapReleased,
+			"objects":        mem.HeapObjects,
+			"stack_bytes":    mem.StackInuse,
+			"sys_bytes":      mem.Sys,
+			"total_alloc":    mem.TotalAlloc,
+		},
+		"gc": map[string]interface{}{
+			"count":                 mem.NumGC,
+			"next_heap_bytes":       mem.NextGC,
+			"last_time":             lastGc,
+			"pause_total_seconds":   time.Duration(mem.PauseTotalNs).Seconds(),
+			"recent_pauses_seconds": pauses,
+			"cpu_fraction":          mem.GCCPUFraction,
+		},
+		"requests_in_flight": shedder.InFlight(),
+		"db_pool": map[string]interface{}{
+			"open_connections": dbStats().OpenConnections,
+			"max_connections":  utils.Conf.PostgresqlMaxOpenConns,
+		},
+		"blob":               blobStats,
+		"jobs":               jobs,
+		"search_index_depth": searchDepth,
+		"download_depth":     downloads.Depth(),
+	})
+}
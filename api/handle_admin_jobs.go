@@ -0,0 +1,58 @@
+package api
+
+import (
+	"net/http"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/models"
+)
+
+// HandleAdminJobs lists the jobs in a status, dead ones by default, along with
+// how deep the queue is for each kind of job.
+func HandleAdminJobs(c *Context, w http.ResponseWriter, req *http.Request) {
+	status := req.URL.Query().Get("status")
+	kind := req.URL.Query().Get("kind")
+
+	clog := c.Log().WithFields(log.Fields{
+		"user_id": c.User.Id,
+		"status":  status,
+		"kind":    kind,
+	})
+
+	// Dead jobs are what need an admin's attention, so they're the default
+	if status == "" {
+		status = models.JOB_DEAD
+	}
+	if status != models.JOB_QUEUED &&
+		status != models.JOB_RUNNING &&
+		status != models.JOB_DONE &&
+		status != models.JOB_DEAD {
+		c.Render.JSON(w, http.StatusBadRequest,
+			ApiErr(ERR_INVALID_REQUEST, "Status must be one of 'queued', 'running', 'done', 'dead'"))
+		return
+	}
+	if _, ok := jobKinds[kind]; kind != "" && !ok {
+		c.Render.JSON(w, http.StatusBadRequest, ApiErr(ERR_INVALID_REQUEST, "There's no kind of job by that name"))
+		return
+	}
+
+	jobs, err := c.Api.Job.ByStatus(status, kind, 200)
+	if err != nil {
+		clog.WithField("err", err).Error("Could not look up jobs by status")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not get those jobs, please try again soon"))
+		return
+	}
+	depths, err := c.Api.Job.Depths()
+	if err != nil {
+		clog.WithField("err", err).Error("Could not look up job queue depths")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not get those jobs, please try again soon"))
+		return
+	}
+
+	c.Render.JSON(w, http.StatusOK, map[string]interface{}{
+		"jobs":   jobs,
+		"depths": depths,
+	})
+}
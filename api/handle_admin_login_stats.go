@@ -0,0 +1,20 @@
+package api
+
+import (
+	"expvar"
+	"net/http"
+)
+
+func HandleAdminLoginStats(c *Context, w http.ResponseWriter, req *http.Request) {
+	counts := map[string]int64{}
+	loginStats.Do(func(kv expvar.KeyValue) {
+		if i, ok := kv.Value.(*expvar.Int); ok {
+			counts[kv.Key] = i.Value()
+		}
+	})
+
+	c.Render.JSON(w, http.StatusOK, map[string]interface{}{
+		"counts":     counts,
+		"locked_ips": ipLockouts.Locked(),
+	})
+}
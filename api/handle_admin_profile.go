@@ -0,0 +1,82 @@
+package api
+
+import (
+	"net/http"
+	"net/http/pprof"
+	rpprof "runtime/pprof"
+	"strconv"
+	"sync/atomic"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// CPU profiles and traces slow the whole server down while they run, so
+// they're kept short, and only one runs at a time
+const (
+	MaxProfileSeconds     = 60
+	DefaultProfileSeconds = 30
+)
+
+var profiling int32
+
+// HandleAdminProfiles lists the profiles that can be fetched from
+// /admin/debug/pprof/:profile, with how many samples are in each so far.
+func HandleAdminProfiles(c *Context, w http.ResponseWriter, req *http.Request) {
+	profiles := map[string]int{}
+	for _, p := range rpprof.Profiles() {
+		profiles[p.Name()] = p.Count()
+	}
+	c.Render.JSON(w, http.StatusOK, map[string]interface{}{
+		"profiles": profiles,
+		"sampled":  []string{"profile", "trace"},
+	})
+}
+
+// HandleAdminProfile serves a profile in the format go tool pprof reads,
+// like net/http/pprof does, but only to admins.  The heap and goroutine
+// profiles are sent right away, and a CPU profile or execution trace after
+// sampling for the number of seconds asked for.  (Importing net/http/pprof
+// also adds its handlers to http.DefaultServeMux, but that's never served.)
+func HandleAdminProfile(c *Context, w http.ResponseWriter, req *http.Request) {
+	name := c.Params.ByName("profile")
+
+	if name != "profile" && name != "trace" {
+		if rpprof.Lookup(name) == nil {
+			c.Render.JSON(w, http.StatusNotFound, ApiErr(ERR_NOT_FOUND, "There's no profile by that name"))
+			return
+		}
+		pprof.Handler(name).ServeHTTP(w, req)
+		return
+	}
+
+	seconds := DefaultProfileSeconds
+	v := NewValidator()
+	v.Field("seconds", "Seconds").Int(req.URL.Query().Get("seconds"), &seconds).
+		Range(seconds, 1, MaxProfileSeconds)
+	if v.Refuse(c, w) {
+		return
+	}
+
+	if !atomic.CompareAndSwapInt32(&profiling, 0, 1) {
+		c.Render.JSON(w, http.StatusConflict,
+			ApiErr(ERR_INVALID_STATE, "Another profile is being taken, please wait for it to finish"))
+		return
+	}
+	defer atomic.StoreInt32(&profiling, 0)
+
+	c.Log().WithFields(log.Fields{
+		"user_id": c.User.Id,
+		"profile": name,
+		"seconds": seconds,
+	}).Info("Profiling")
+
+	// The handlers read how long to sample for from the query
+	q := req.URL.Query()
+	q.Set("seconds", strconv.Itoa(seconds))
+	req.URL.RawQuery = q.Encode()
+	if name == "trace" {
+		pprof.Trace(w, req)
+	} else {
+		pprof.Profile(w, req)
+	}
+}
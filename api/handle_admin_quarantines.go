@@ -0,0 +1,40 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/models"
+)
+
+func HandleAdminQuarantines(c *Context, w http.ResponseWriter, req *http.Request) {
+	status := req.URL.Query().Get("status")
+
+	clog := c.Log().WithFields(log.Fields{
+		"user_id": c.User.Id,
+		"status":  status,
+	})
+
+	// Appeals are what need an admin's attention, so they're the default
+	if status == "" {
+		status = models.QUARANTINE_APPEALED
+	}
+	if status != models.QUARANTINE_QUARANTINED &&
+		status != models.QUARANTINE_APPEALED &&
+		status != models.QUARANTINE_RESTORED {
+		c.Render.JSON(w, http.StatusBadRequest,
+			ApiErr(ERR_INVALID_REQUEST, "Status must be one of 'quarantined', 'appealed', 'restored'"))
+		return
+	}
+
+	quarantines, err := c.Api.FileQuarantine.ByStatus(status, 200)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up quarantines by status")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not get those quarantines, please try again soon"))
+		return
+	}
+
+	c.Render.JSON(w, http.StatusOK, map[string][]*models.FileQuarantine{"quarantines": quarantines})
+}
@@ -0,0 +1,107 @@
+package api
+
+import (
+	"net/http"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/models"
+	"github.com/pborman/uuid"
+)
+
+type AdminRevokeTokensForm struct {
+	UserIds             []string `json:"user_ids"`
+	All                 bool     `json:"all"`
+	IncludeApiTokens    bool     `json:"include_api_tokens"`
+	ForcePasswordChange bool     `json:"force_password_change"`
+}
+
+// For responding to a credential leak: signs the given users, or everyone,
+// out everywhere, and optionally makes them pick a new password before they
+// can sign in with one again.  Doing it for everyone signs out the admin
+// making the request, too.
+func HandleAdminRevokeTokens(c *Context, w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+
+	clog := c.Log().WithField("auth_user_id", c.User.Id)
+
+	// Parse the JSON POST body
+	var form AdminRevokeTokensForm
+	if !decodeForm(c, w, req, clog, "revoke", &form) {
+		return
+	}
+
+	// Everyone has to be asked for explicitly, so that forgetting the user ids
+	// doesn't sign out the whole site
+	v := NewValidator()
+	ids := v.Field("user_ids", "User ids").Check(form.All != (len(form.UserIds) > 0),
+		"must be given, or else all, but not both")
+	var userIds []string
+	if !form.All {
+		userIds = form.UserIds
+		for _, id := range userIds {
+			ids.Check(uuid.Parse(id) != nil, "must be valid, and "+id+" isn't")
+		}
+	}
+	if v.Refuse(c, w) {
+		return
+	}
+
+	clog = clog.WithFields(log.Fields{
+		"all":                   form.All,
+		"user_count":            len(userIds),
+		"include_api_tokens":    form.IncludeApiTokens,
+		"force_password_change": form.ForcePasswordChange,
+	})
+
+	// Make them change their password first, so nobody can sign back in with
+	// a leaked one in between
+	var forced int64
+	if form.ForcePasswordChange {
+		var err error
+		if forced, err = c.Api.User.RequirePasswordChange(userIds); err != nil {
+			clog.WithField("err", err).Error("Could not require password changes")
+			c.Render.JSON(w, http.StatusBadGateway,
+				ApiErr(ERR_UNAVAILABLE, "Could not revoke tokens, please try again soon"))
+			return
+		}
+	}
+	if err := c.Api.RefreshToken.DeleteByUserIds(userIds); err != nil {
+		clog.WithField("err", err).Error("Could not delete refresh tokens")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not revoke tokens, please try again soon"))
+		return
+	}
+	kinds := []string{models.TOKEN_KIND_SESSION, models.TOKEN_KIND_PENDING}
+	if form.IncludeApiTokens {
+		kinds = append(kinds, models.TOKEN_KIND_API)
+	}
+	for _, kind := range kinds {
+		if err := c.Api.AuthToken.DeleteByKind(kind, userIds); err != nil {
+			clog.WithFields(log.Fields{
+				"err":  err,
+				"kind": kind,
+			}).Error("Could not delete tokens")
+			c.Render.JSON(w, http.StatusBadGateway,
+				ApiErr(ERR_UNAVAILABLE, "Could not revoke tokens, please try again soon"))
+			return
+		}
+	}
+
+	clog.Warn("Admin revoked tokens")
+	details := map[string]interface{}{
+		"all":                   form.All,
+		"include_api_tokens":    form.IncludeApiTokens,
+		"force_password_change": form.ForcePasswordChange,
+	}
+	if form.All {
+		audit(c, req, c.User.Id, "", models.AUDIT_ADMIN_REVOKE_TOKENS, "", "", details)
+	}
+	for _, id := range userIds {
+		audit(c, req, c.User.Id, id, models.AUDIT_ADMIN_REVOKE_TOKENS, "user", id, details)
+	}
+
+	c.Render.JSON(w, http.StatusOK, map[string]interface{}{
+		"status":                 "ok",
+		"password_change_forced": forced,
+	})
+}
@@ -0,0 +1,80 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/models"
+	"gopkg.in/guregu/null.v3"
+)
+
+const MaxAdminUsersPageSize = 200
+
+// AdminUser shows admins the parts of a user that are hidden from everyone
+// else.
+type AdminUser struct {
+	Id                 string    `json:"id"`
+	Username           string    `json:"username"`
+	Email              string    `json:"email"`
+	EmailVerified      bool      `json:"email_verified"`
+	IsAdmin            bool      `json:"is_admin"`
+	HasTwoFactor       bool      `json:"has_two_factor"`
+	HasStripe          bool      `json:"has_stripe_customer_id"`
+	SuspendedTime      null.Time `json:"suspended_time"`
+	SuspendedReason    string    `json:"suspended_reason"`
+	MustChangePassword bool      `json:"must_change_password"`
+	CreatedTime        time.Time `json:"created_time"`
+}
+
+func NewAdminUser(user *models.User) *AdminUser {
+	return &AdminUser{
+		Id:                 user.Id,
+		Username:           user.Username,
+		Email:              user.Email,
+		EmailVerified:      user.EmailVerified,
+		IsAdmin:            user.IsAdmin,
+		HasTwoFactor:       user.TotpEnabled,
+		HasStripe:          user.StripeCustomerId != "",
+		SuspendedTime:      user.SuspendedTime,
+		SuspendedReason:    user.SuspendedReason,
+		MustChangePassword: user.MustChangePassword,
+		CreatedTime:        user.CreatedTime,
+	}
+}
+
+func HandleAdminUsers(c *Context, w http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+	q := query.Get("q")
+
+	clog := c.Log().WithFields(log.Fields{
+		"auth_user_id": c.User.Id,
+		"q":            q,
+	})
+
+	// A cursor only goes with the search it came from
+	kind := "admin_users:" + q
+	limit, after, err := pageParams(req, kind, 50, MaxAdminUsersPageSize)
+	if err != nil {
+		c.Render.JSON(w, http.StatusBadRequest, ApiErr(ERR_INVALID_REQUEST, err.Error()))
+		return
+	}
+
+	users, next, err := c.Api.User.Search(q, limit, after)
+	if err != nil {
+		clog.WithField("err", err).Error("Could not search users")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not search users, please try again soon"))
+		return
+	}
+
+	resp := make([]*AdminUser, 0, len(users))
+	for _, user := range users {
+		resp = append(resp, NewAdminUser(user))
+	}
+
+	c.Render.JSON(w, http.StatusOK, map[string]interface{}{
+		"users":       resp,
+		"next_cursor": nextCursor(kind, next),
+	})
+}
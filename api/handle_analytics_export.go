@@ -0,0 +1,139 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/models"
+)
+
+// HandleAnalyticsExport exports the model's download events over a range of
+// time.  Short ranges are streamed straight back, and longer ones are
+// generated in the background, to be picked up from the export they return.
+func HandleAnalyticsExport(c *Context, w http.ResponseWriter, req *http.Request) {
+	format := req.URL.Query().Get("format")
+
+	clog := c.Log().WithFields(log.Fields{
+		"user_id":  c.User.Id,
+		"username": c.Params.ByName("username"),
+		"slug":     c.Params.ByName("slug"),
+		"format":   format,
+	})
+
+	// Validation
+	if format == "" {
+		format = "csv"
+	}
+	if format != "csv" && format != "jsonl" {
+		c.Render.JSON(w, http.StatusBadRequest,
+			ApiErr(ERR_INVALID_REQUEST, "Format must be one of 'csv', 'jsonl'"))
+		return
+	}
+	start, end, ok := statsRange(c, w, req, syncAnalyticsRange, maxAnalyticsRange)
+	if !ok {
+		return
+	}
+
+	m := accessModel(c, w, clog)
+	if m == nil {
+		return
+	}
+	if !authorize(c, w, m, ACTION_MANAGE,
+		"You don't have permission to export this model's analytics") {
+		return
+	}
+
+	clog = clog.WithField("model_id", m.Id)
+
+	if end.Sub(start) > syncAnalyticsRange {
+		export := models.NewAnalyticsExport(m.Id, c.User.Id, format, start, end)
+		if err := c.Api.AnalyticsExport.Save(export); err != nil {
+			clog.WithField("err", err).Error("Could not save analytics export")
+			c.Render.JSON(w, http.StatusBadGateway,
+				ApiErr(ERR_UNAVAILABLE, "Could not export those analytics, please try again soon"))
+			return
+		}
+		job, err := enqueueJob(c.Api, JOB_ANALYTICS_EXPORT, c.User.Id, map[string]string{
+			"analytics_export_id": export.Id,
+		})
+		if err != nil {
+			clog.WithField("err", err).Error("Could not queue analytics export")
+			c.Render.JSON(w, http.StatusBadGateway,
+				ApiErr(ERR_UNAVAILABLE, "Could not export those analytics, please try again soon"))
+			return
+		}
+		clog.WithField("analytics_export_id", export.Id).Info("Analytics export started")
+		c.Render.JSON(w, http.StatusAccepted, map[string]interface{}{
+			"export": export,
+			"job":    job,
+		})
+		return
+	}
+
+	events, err := c.Api.DownloadHour.EventsByModel(m.Id, start, end)
+	if err != nil {
+		clog.WithField("err", err).Error("Could not look up download events")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not export those analytics, please try again soon"))
+		return
+	}
+
+	contentType := "text/csv; charset=utf-8"
+	if format == "jsonl" {
+		contentType = "application/x-ndjson; charset=utf-8"
+	}
+	attachment := fmt.Sprintf("%s-%s-downloads-%s.%s", c.Params.ByName("username"),
+		m.Slug, start.Format("2006-01-02"), format)
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition",
+		fmt.Sprintf("attachment; filename=%q", attachment))
+	w.WriteHeader(http.StatusOK)
+
+	if err = writeAnalytics(w, format, m.Id, events); err != nil {
+		clog.WithField("err", err).Error("Could not write analytics export")
+		return
+	}
+	clog.WithField("events", len(events)).Info("Analytics exported")
+}
+
+// HandleAnalyticsExportStatus shows how a background export is getting on,
+// with a link to download it once it's ready.  Only whoever asked for it can
+// see it.
+func HandleAnalyticsExportStatus(c *Context, w http.ResponseWriter, req *http.Request) {
+	id := c.Params.ByName("id")
+	clog := c.Log().WithFields(log.Fields{
+		"user_id":             c.User.Id,
+		"analytics_export_id": id,
+	})
+
+	export, err := c.Api.AnalyticsExport.ById(id)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up analytics export")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not get that export, please try again soon"))
+		return
+	}
+	if export == nil || export.UserId != c.User.Id {
+		c.Render.JSON(w, http.StatusNotFound,
+			ApiErr(ERR_NOT_FOUND, "No export with that id was found"))
+		return
+	}
+
+	resp := map[string]interface{}{
+		"export": export,
+		"url":    nil,
+	}
+	if export.Status == models.EXPORT_READY {
+		u, err := c.Blob.MakeUrl(export.BlobFilename, analyticsExportUrlTTL)
+		if err != nil {
+			clog.WithField("err", err).Error("Could not make export url")
+			c.Render.JSON(w, http.StatusBadGateway,
+				ApiErr(ERR_UNAVAILABLE, "Could not get that export, please try again soon"))
+			return
+		}
+		resp["url"] = u
+	}
+	c.Render.JSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,26 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/ericflo/gradientzoo/models"
+)
+
+func HandleApiTokens(c *Context, w http.ResponseWriter, req *http.Request) {
+	apiTokensRespond(c, w, c.User)
+}
+
+func apiTokensRespond(c *Context, w http.ResponseWriter, user *models.User) {
+	clog := c.Log().WithField("user_id", user.Id)
+
+	authTokens, err := c.Api.AuthToken.ByUserIdKind(user.Id, models.TOKEN_KIND_API)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up api tokens")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not get your tokens, please try again soon"))
+		return
+	}
+
+	c.Render.JSON(w, http.StatusOK, map[string][]*models.AuthToken{"tokens": authTokens})
+}
@@ -0,0 +1,17 @@
+package api
+
+import (
+	"net/http"
+)
+
+func HandleAppKeyUsage(c *Context, w http.ResponseWriter, req *http.Request) {
+	if c.AppKey == nil {
+		c.Render.JSON(w, http.StatusBadRequest,
+			ApiErr(ERR_UNAUTHENTICATED, "Must send an app key in the X-App-Key header"))
+		return
+	}
+
+	clog := c.Log().WithField("app_key_id", c.AppKey.Id)
+
+	appKeyUsageRespond(c, w, req, clog, c.AppKey)
+}
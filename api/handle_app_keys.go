@@ -0,0 +1,23 @@
+package api
+
+import (
+	"net/http"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/models"
+)
+
+func HandleAppKeys(c *Context, w http.ResponseWriter, req *http.Request) {
+	appKeys, err := c.Api.AppKey.All()
+	if err != nil {
+		c.Log().WithFields(log.Fields{
+			"err":     err,
+			"user_id": c.User.Id,
+		}).Error("Could not list app keys")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not get app keys, please try again soon"))
+		return
+	}
+
+	c.Render.JSON(w, http.StatusOK, map[string][]*models.AppKey{"app_keys": appKeys})
+}
@@ -0,0 +1,104 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/models"
+)
+
+type AppealFileQuarantineForm struct {
+	Appeal string `json:"appeal"`
+}
+
+func HandleAppealFileQuarantine(c *Context, w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+
+	id := c.Params.ByName("id")
+
+	clog := c.Log().WithFields(log.Fields{
+		"user_id": c.User.Id,
+		"file_id": id,
+	})
+
+	// Parse the JSON POST body
+	var form AppealFileQuarantineForm
+	if !decodeForm(c, w, req, clog, "appeal", &form) {
+		return
+	}
+	if strings.TrimSpace(form.Appeal) == "" {
+		c.Render.JSON(w, http.StatusBadRequest,
+			ApiErr(ERR_INVALID_REQUEST, "Must explain why the file should be restored"))
+		return
+	}
+
+	f, err := c.Api.File.ById(id)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up file")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not appeal that quarantine, please try again soon"))
+		return
+	}
+	if err == sql.ErrNoRows || f == nil {
+		c.Render.JSON(w, http.StatusNotFound,
+			ApiErr(ERR_FILE_NOT_FOUND, "There is no file with that id"))
+		return
+	}
+
+	clog = clog.WithField("file_model_id", f.ModelId)
+
+	// Only the model's owner may appeal
+	m, err := c.Api.Model.ById(f.ModelId)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up model by id")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not appeal that quarantine, please try again soon"))
+		return
+	}
+	if err == sql.ErrNoRows || m == nil {
+		c.Render.JSON(w, http.StatusNotFound,
+			ApiErr(ERR_FILE_NOT_FOUND, "There is no file with that id"))
+		return
+	}
+	if !authorize(c, w, m, ACTION_MANAGE,
+		"You're only allowed to appeal quarantines of your own files") {
+		return
+	}
+
+	q, err := c.Api.FileQuarantine.ActiveByFileId(f.Id)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up file quarantine")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not appeal that quarantine, please try again soon"))
+		return
+	}
+	if err == sql.ErrNoRows || q == nil {
+		c.Render.JSON(w, http.StatusNotFound,
+			ApiErr(ERR_NOT_FOUND, "That file is not quarantined"))
+		return
+	}
+	if q.Status == models.QUARANTINE_APPEALED {
+		c.Render.JSON(w, http.StatusConflict,
+			ApiErr(ERR_INVALID_STATE, "That quarantine has already been appealed"))
+		return
+	}
+
+	clog = clog.WithField("file_quarantine_id", q.Id)
+
+	q.Status = models.QUARANTINE_APPEALED
+	q.Appeal = form.Appeal
+	_, err = c.Api.FileQuarantine.Record(q, c.User.Id,
+		models.QUARANTINE_ACTION_APPEAL, form.Appeal)
+	if err != nil {
+		clog.WithField("err", err).Error("Could not save file quarantine")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not appeal that quarantine, please try again soon"))
+		return
+	}
+
+	clog.Info("File quarantine appealed")
+
+	c.Render.JSON(w, http.StatusOK, map[string]*models.FileQuarantine{"quarantine": q})
+}
@@ -0,0 +1,51 @@
+package api
+
+import (
+	"net/http"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/models"
+	"gopkg.in/guregu/null.v3"
+)
+
+type ApproveDeviceForm struct {
+	Approve bool `json:"approve"`
+}
+
+func HandleApproveDevice(c *Context, w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+
+	clog := c.Log().WithField("user_id", c.User.Id)
+
+	// Parse the JSON POST body
+	var form ApproveDeviceForm
+	if !decodeForm(c, w, req, clog, "approval", &form) {
+		return
+	}
+
+	d := deviceAuthorizationFor(c, w, c.Params.ByName("user_code"))
+	if d == nil {
+		return
+	}
+
+	clog = clog.WithFields(log.Fields{
+		"device_user_code": d.UserCode,
+		"approve":          form.Approve,
+	})
+
+	d.UserId = null.StringFrom(c.User.Id)
+	d.Status = models.DEVICE_DENIED
+	if form.Approve {
+		d.Status = models.DEVICE_APPROVED
+	}
+	if err := c.Api.DeviceAuthorization.Save(d); err != nil {
+		clog.WithField("err", err).Error("Could not save device authorization")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not save your answer, please try again soon"))
+		return
+	}
+
+	clog.Info("Device authorization answered")
+
+	c.Render.JSON(w, http.StatusOK, map[string]string{"status": d.Status})
+}
@@ -0,0 +1,33 @@
+package api
+
+import (
+	"net/http"
+)
+
+func HandleAuditLog(c *Context, w http.ResponseWriter, req *http.Request) {
+	clog := c.Log().WithField("user_id", c.User.Id)
+
+	before, limit, err := auditPage(req)
+	if err != nil {
+		c.Render.JSON(w, http.StatusBadRequest, ApiErr(ERR_INVALID_REQUEST, err.Error()))
+		return
+	}
+
+	events, err := c.Api.AuditEvent.ByOwnerId(c.User.Id, before, limit)
+	if err != nil {
+		clog.WithField("err", err).Error("Could not get audit events")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not get your audit log, please try again soon"))
+		return
+	}
+
+	resp, err := auditResponse(c, events, limit)
+	if err != nil {
+		clog.WithField("err", err).Error("Could not get audit event users")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not get your audit log, please try again soon"))
+		return
+	}
+
+	c.Render.JSON(w, http.StatusOK, resp)
+}
@@ -13,7 +13,7 @@ func HandleAuthUser(c *Context, w http.ResponseWriter, req *http.Request) {
 	if user != nil {
 		// Hydrate the user object
 		if err := c.Api.User.Hydrate([]*models.User{user}); err != nil {
-			log.WithFields(log.Fields{
+			c.Log().WithFields(log.Fields{
 				"err":     err,
 				"user_id": user.Id,
 			}).Error("Could not hydrate")
@@ -21,7 +21,12 @@ func HandleAuthUser(c *Context, w http.ResponseWriter, req *http.Request) {
 		}
 	}
 
-	c.Render.JSON(w, http.StatusOK, map[string]interface{}{
+	resp := map[string]interface{}{
 		"auth_user": user,
-	})
+	}
+	// Only the user themselves gets to see that their account is going away
+	if user != nil {
+		resp["deletion_time"] = user.DeletionTime
+	}
+	c.Render.JSON(w, http.StatusOK, resp)
 }
@@ -0,0 +1,98 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/models"
+)
+
+// Pickers ask again with every key pressed, so suggestions are kept for a
+// while, both here and by whoever's asking
+const (
+	autocompleteTTL     = time.Minute
+	autocompleteLimit   = 8
+	autocompleteEntries = 5000
+)
+
+var userSuggestions = &suggestionCache{entries: map[string]*suggestions{}}
+
+// suggestion is just enough of a user to pick them out of a list
+type suggestion struct {
+	Username    string `json:"username"`
+	DisplayName string `json:"display_name"`
+}
+
+type suggestions struct {
+	users    []*suggestion
+	computed time.Time
+}
+
+// suggestionCache keeps recent suggestions by lowercased prefix, starting
+// over whenever it fills up.
+type suggestionCache struct {
+	mu      sync.Mutex
+	entries map[string]*suggestions
+}
+
+func (s *suggestionCache) Get(api *models.ApiCollection, prefix string) ([]*suggestion, error) {
+	key := strings.ToLower(prefix)
+	s.mu.Lock()
+	if e, ok := s.entries[key]; ok && time.Since(e.computed) < autocompleteTTL {
+		s.mu.Unlock()
+		return e.users, nil
+	}
+	s.mu.Unlock()
+
+	users, err := api.User.ByPrefix(prefix, autocompleteLimit, 0)
+	if err != nil {
+		return nil, err
+	}
+	found := make([]*suggestion, 0, len(users))
+	for _, user := range users {
+		found = append(found, &suggestion{
+			Username:    user.Username,
+			DisplayName: user.DisplayName,
+		})
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.entries) >= autocompleteEntries {
+		s.entries = map[string]*suggestions{}
+	}
+	s.entries[key] = &suggestions{users: found, computed: time.Now()}
+	return found, nil
+}
+
+func HandleAutocompleteUsers(c *Context, w http.ResponseWriter, req *http.Request) {
+	q := req.URL.Query().Get("q")
+
+	fields := log.Fields{"q": q}
+	if c.User != nil {
+		fields["auth_user_id"] = c.User.Id
+	}
+	clog := c.Log().WithFields(fields)
+
+	// Validation
+	if q == "" {
+		c.Render.JSON(w, http.StatusBadRequest, ApiErr(ERR_INVALID_REQUEST, "Q is required"))
+		return
+	}
+
+	found, err := userSuggestions.Get(c.Api, q)
+	if err != nil {
+		clog.WithField("err", err).Error("Could not look up user suggestions")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not search users, please try again soon"))
+		return
+	}
+
+	w.Header().Set("Cache-Control", "public, max-age=60")
+	c.Render.JSON(w, http.StatusOK, map[string]interface{}{
+		"users": found,
+	})
+}
@@ -0,0 +1,139 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/models"
+)
+
+func HandleBestFile(c *Context, w http.ResponseWriter, req *http.Request) {
+	username := c.Params.ByName("username")
+	slug := c.Params.ByName("slug")
+	framework := c.Params.ByName("framework")
+	filename := c.Params.ByName("filename")
+
+	fields := log.Fields{
+		"file_username":   username,
+		"file_model_slug": slug,
+		"file_framework":  framework,
+		"filename":        filename,
+	}
+	if c.User != nil {
+		fields["auth_user_id"] = c.User.Id
+	}
+	clog := c.Log().WithFields(fields)
+
+	// First let's look up the user by their username
+	user, err := c.Api.User.ByUsername(username)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up user by username")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not get your file, please try again soon"))
+		return
+	}
+
+	if err == sql.ErrNoRows || user == nil {
+		c.Render.JSON(w, http.StatusNotFound,
+			ApiErr(ERR_USER_NOT_FOUND, "No user by that username could be found"))
+		return
+	}
+
+	clog = clog.WithField("file_user_id", user.Id)
+
+	// Now we get the model
+	m, err := c.Api.Model.ByUserIdSlug(user.Id, slug)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up model by username & slug")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not get your file, please try again soon"))
+		return
+	}
+	if err == sql.ErrNoRows || m == nil {
+		c.Render.JSON(w, http.StatusNotFound,
+			ApiErr(ERR_MODEL_NOT_FOUND, "No model by that username and slug could be found"))
+		return
+	}
+	if !authorize(c, w, m, ACTION_READ,
+		"You don't have permission to access this file") {
+		return
+	}
+
+	clog = clog.WithField("file_model_id", m.Id)
+
+	// Find out which version is currently the best
+	policy, err := c.Api.FilePolicy.ByModelIdFilename(m.Id, filename)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up file policy")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not get your file, please try again soon"))
+		return
+	}
+	if policy == nil || !policy.BestFileId.Valid {
+		c.Render.JSON(w, http.StatusNotFound,
+			ApiErr(ERR_FILE_NOT_FOUND, "There is no best version of a file by that name"))
+		return
+	}
+
+	// Get the best file
+	f, err := c.Api.File.ById(policy.BestFileId.String)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up file")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not get your file, please try again soon"))
+		return
+	}
+	if err == sql.ErrNoRows || f == nil {
+		c.Render.JSON(w, http.StatusNotFound,
+			ApiErr(ERR_FILE_NOT_FOUND, "There is no file by that name"))
+		return
+	}
+
+	clog = clog.WithField("file_id", f.Id)
+
+	// Files that have been taken down can't be downloaded by anyone
+	if refuseQuarantined(c, w, clog, f) {
+		return
+	}
+
+	// So are users who look like they're scraping private models
+	if refuseThrottled(c, w, req, clog, m) {
+		return
+	}
+
+	// And so are files whose organization is out of bandwidth
+	if refuseOverBandwidth(c, w, clog, m) {
+		return
+	}
+
+	u, err := c.Blob.MakeUrl(f.BlobFilename(), 120*time.Second)
+	if err != nil {
+		clog.WithField("err", err).Error("Could not make file url")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not get your file, please try again soon"))
+		return
+	}
+
+	err = markDownload(c, req, clog, f, user.Id, clientIp(req))
+	if err != nil {
+		clog.WithField("err", err).Error("Could not mark download")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not get your file, please try again soon"))
+		return
+	}
+
+	// Hydrate the file object
+	if err = c.Api.File.Hydrate([]*models.File{f}); err != nil {
+		clog.WithField("err", err).Error("Could not hydrate")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not get your file, please try again soon"))
+		return
+	}
+
+	c.Render.JSON(w, http.StatusOK, map[string]interface{}{
+		"url":  u,
+		"file": f,
+	})
+}
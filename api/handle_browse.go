@@ -0,0 +1,139 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/models"
+)
+
+const MaxBrowsePageSize = 100
+
+// HandleBrowse counts public models, and the users who own them, under each
+// letter of the alphabet, for a directory to browse them by.
+func HandleBrowse(c *Context, w http.ResponseWriter, req *http.Request) {
+	fields := log.Fields{}
+	if c.User != nil {
+		fields["auth_user_id"] = c.User.Id
+	}
+	clog := c.Log().WithFields(fields)
+
+	modelCounts, err := c.Api.Model.Initials()
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not count models by initial")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not get the directory, please try again soon"))
+		return
+	}
+	namespaceCounts, err := c.Api.Model.NamespaceInitials()
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not count namespaces by initial")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not get the directory, please try again soon"))
+		return
+	}
+
+	// Counting every model isn't cheap, and nobody minds them being a bit behind
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	c.Render.JSON(w, http.StatusOK, map[string]interface{}{
+		"models":     modelCounts,
+		"namespaces": namespaceCounts,
+	})
+}
+
+// HandleBrowseModels lists the public models whose names start with the
+// initial param, alphabetically.  Names that don't start with a letter are
+// under "#", which has to be escaped as %23 in the URL.
+func HandleBrowseModels(c *Context, w http.ResponseWriter, req *http.Request) {
+	initial := strings.ToLower(c.Params.ByName("initial"))
+
+	fields := log.Fields{"initial": initial}
+	if c.User != nil {
+		fields["auth_user_id"] = c.User.Id
+	}
+	clog := c.Log().WithFields(fields)
+
+	// Validation
+	if !models.ValidInitial(initial) {
+		c.Render.JSON(w, http.StatusBadRequest,
+			ApiErr(ERR_INVALID_REQUEST, "Initial must be a letter or '#'"))
+		return
+	}
+	kind := "browse:" + initial
+	limit, after, err := pageParams(req, kind, 50, MaxBrowsePageSize)
+	if err != nil {
+		c.Render.JSON(w, http.StatusBadRequest, ApiErr(ERR_INVALID_REQUEST, err.Error()))
+		return
+	}
+
+	ms, next, err := c.Api.Model.ByInitial(initial, limit, after)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up models by initial")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not get those models, please try again soon"))
+		return
+	}
+
+	// Hydrate the model objects
+	if err = c.Api.Model.Hydrate(ms); err != nil {
+		clog.WithField("err", err).Error("Could not hydrate")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not get those models, please try again soon"))
+		return
+	}
+
+	// Get the users who own the models, so that clients can link to them
+	// Look up whoever owns the models, once each
+	users, err := c.Load.Owners(ms)
+	if err != nil {
+		clog.WithField("err", err).Error("Could not get users by id")
+		users = []*models.User{}
+	}
+
+	c.Render.JSON(w, http.StatusOK, map[string]interface{}{
+		"models":      ms,
+		"users":       users,
+		"next_cursor": nextCursor(kind, next),
+	})
+}
+
+// HandleBrowseNamespaces lists the users who own public models, with how
+// many, alphabetically.  The initial query param narrows it down to the
+// usernames that start with a letter, or "#" for the rest.
+func HandleBrowseNamespaces(c *Context, w http.ResponseWriter, req *http.Request) {
+	initial := strings.ToLower(req.URL.Query().Get("initial"))
+
+	fields := log.Fields{"initial": initial}
+	if c.User != nil {
+		fields["auth_user_id"] = c.User.Id
+	}
+	clog := c.Log().WithFields(fields)
+
+	// Validation
+	if initial != "" && !models.ValidInitial(initial) {
+		c.Render.JSON(w, http.StatusBadRequest,
+			ApiErr(ERR_INVALID_REQUEST, "Initial must be a letter or '#'"))
+		return
+	}
+	kind := "namespaces:" + initial
+	limit, after, err := pageParams(req, kind, 50, MaxBrowsePageSize)
+	if err != nil {
+		c.Render.JSON(w, http.StatusBadRequest, ApiErr(ERR_INVALID_REQUEST, err.Error()))
+		return
+	}
+
+	namespaces, next, err := c.Api.Model.Namespaces(initial, limit, after)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up namespaces")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not get those users, please try again soon"))
+		return
+	}
+
+	c.Render.JSON(w, http.StatusOK, map[string]interface{}{
+		"namespaces":  namespaces,
+		"next_cursor": nextCursor(kind, next),
+	})
+}
@@ -0,0 +1,32 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/ericflo/gradientzoo/models"
+	"gopkg.in/guregu/null.v3"
+)
+
+func HandleCancelAccountDeletion(c *Context, w http.ResponseWriter, req *http.Request) {
+	clog := c.Log().WithField("user_id", c.User.Id)
+
+	if !c.User.DeletionTime.Valid {
+		c.Render.JSON(w, http.StatusBadRequest,
+			ApiErr(ERR_INVALID_STATE, "Your account isn't scheduled for deletion"))
+		return
+	}
+
+	c.User.DeletionTime = null.Time{}
+	if err := c.Api.User.Save(c.User); err != nil {
+		clog.WithField("err", err).Error("Could not save user")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not cancel deleting your account, please try again soon"))
+		return
+	}
+
+	clog.Info("Cancelled account deletion")
+	audit(c, req, c.User.Id, c.User.Id, models.AUDIT_ACCOUNT_DELETE_CANCEL,
+		"user", c.User.Id, nil)
+
+	c.Render.JSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
@@ -0,0 +1,69 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/models"
+)
+
+type ChangeModelPlanForm struct {
+	Keep int `json:"keep"`
+}
+
+func HandleChangeModelPlan(c *Context, w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+
+	id := c.Params.ByName("id")
+
+	clog := c.Log().WithFields(log.Fields{
+		"auth_user_id": c.User.Id,
+		"model_id":     id,
+	})
+
+	// Parse the JSON POST body
+	var form ChangeModelPlanForm
+	if !decodeForm(c, w, req, clog, "plan", &form) {
+		return
+	}
+	if !models.ValidPlanKeep(form.Keep) {
+		c.Render.JSON(w, http.StatusBadRequest,
+			ApiErr(ERR_INVALID_REQUEST, fmt.Sprintf("Keep must be one of %v", models.PLAN_KEEPS)))
+		return
+	}
+
+	m, err := c.Api.Model.ById(id)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up model")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not change that model's plan, please try again soon"))
+		return
+	}
+	if err == sql.ErrNoRows || m == nil {
+		c.Render.JSON(w, http.StatusNotFound, ApiErr(ERR_MODEL_NOT_FOUND, "That model was not found"))
+		return
+	}
+
+	oldKeep := m.Keep
+	m.Keep = form.Keep
+	if err = c.Api.Model.Save(m); err != nil {
+		clog.WithField("err", err).Error("Could not save model")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not change that model's plan, please try again soon"))
+		return
+	}
+
+	clog.WithFields(log.Fields{
+		"old_keep": oldKeep,
+		"keep":     m.Keep,
+	}).Info("Model plan changed")
+	audit(c, req, c.User.Id, m.UserId, models.AUDIT_MODEL_PLAN_CHANGE, "model",
+		m.Id, map[string]interface{}{
+			"old_keep": oldKeep,
+			"keep":     m.Keep,
+		})
+
+	c.Render.JSON(w, http.StatusOK, map[string]*models.Model{"model": m})
+}
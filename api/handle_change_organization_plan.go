@@ -0,0 +1,71 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/models"
+)
+
+type ChangeOrganizationPlanForm struct {
+	Keep int `json:"keep"`
+}
+
+func HandleChangeOrganizationPlan(c *Context, w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+
+	clog := c.Log().WithField("user_id", c.User.Id)
+
+	// Parse the JSON POST body
+	var form ChangeOrganizationPlanForm
+	if !decodeForm(c, w, req, clog, "plan", &form) {
+		return
+	}
+	if !models.ValidPlanKeep(form.Keep) {
+		c.Render.JSON(w, http.StatusBadRequest,
+			ApiErr(ERR_INVALID_REQUEST, fmt.Sprintf("Keep must be one of %v", models.PLAN_KEEPS)))
+		return
+	}
+
+	org, err := userOrganization(c.Api, c.User.Id)
+	if err != nil {
+		clog.WithField("err", err).Error("Could not look up organization")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not change your organization's plan, please try again soon"))
+		return
+	}
+	if org == nil || org.OwnerId != c.User.Id {
+		c.Render.JSON(w, http.StatusUnauthorized,
+			ApiErr(ERR_FORBIDDEN, "Only an organization's owner can change its plan"))
+		return
+	}
+	// The owner pays for the whole organization
+	if form.Keep != 10 && c.User.StripeCustomerId == "" {
+		c.Render.JSON(w, http.StatusBadRequest,
+			ApiErr(ERR_PAYMENT_REQUIRED, "Must connect a payment source before you can choose that plan"))
+		return
+	}
+
+	oldKeep := org.Keep
+	org.Keep = form.Keep
+	if err = c.Api.Organization.Save(org); err != nil {
+		clog.WithField("err", err).Error("Could not save organization")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not change your organization's plan, please try again soon"))
+		return
+	}
+
+	clog.WithFields(log.Fields{
+		"organization_id": org.Id,
+		"old_keep":        oldKeep,
+		"keep":            org.Keep,
+	}).Info("Organization plan changed")
+	audit(c, req, c.User.Id, c.User.Id, models.AUDIT_ORG_PLAN_CHANGE,
+		"organization", org.Id, map[string]interface{}{
+			"old_keep": oldKeep,
+			"keep":     org.Keep,
+		})
+
+	c.Render.JSON(w, http.StatusOK, map[string]*models.Organization{"organization": org})
+}
@@ -0,0 +1,51 @@
+package api
+
+import (
+	"net/http"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/models"
+)
+
+func HandleCollection(c *Context, w http.ResponseWriter, req *http.Request) {
+	fields := log.Fields{"collection_id": c.Params.ByName("id")}
+	if c.User != nil {
+		fields["auth_user_id"] = c.User.Id
+	}
+	clog := c.Log().WithFields(fields)
+
+	collection := collectionFor(c, w, clog)
+	if collection == nil {
+		return
+	}
+
+	ms, err := collectionModels(c, collection)
+	if err != nil {
+		clog.WithField("err", err).Error("Could not look up collection models")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not get that collection, please try again soon"))
+		return
+	}
+
+	// Hydrate the model objects
+	if err = c.Api.Model.Hydrate(ms); err != nil {
+		clog.WithField("err", err).Error("Could not hydrate")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not get that collection, please try again soon"))
+		return
+	}
+
+	// Look up whoever owns the models, once each, and whoever put the
+	// collection together
+	users, err := c.Load.Owners(ms, collection.UserId)
+	if err != nil {
+		clog.WithField("err", err).Error("Could not get users by id")
+		users = []*models.User{}
+	}
+
+	c.Render.JSON(w, http.StatusOK, map[string]interface{}{
+		"collection": collection,
+		"models":     ms,
+		"users":      users,
+	})
+}
@@ -0,0 +1,95 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/models"
+)
+
+const MaxCollectionsPageSize = 50
+
+// HandlePublicCollections lists public collections, featured ones first.
+func HandlePublicCollections(c *Context, w http.ResponseWriter, req *http.Request) {
+	fields := log.Fields{}
+	if c.User != nil {
+		fields["auth_user_id"] = c.User.Id
+	}
+	clog := c.Log().WithFields(fields)
+
+	// Validation
+	limit, after, err := pageParams(req, "public_collections", 20, MaxCollectionsPageSize)
+	if err != nil {
+		c.Render.JSON(w, http.StatusBadRequest, ApiErr(ERR_INVALID_REQUEST, err.Error()))
+		return
+	}
+
+	collections, next, err := c.Api.Collection.Public(limit, after)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up public collections")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not get those collections, please try again soon"))
+		return
+	}
+
+	c.Render.JSON(w, http.StatusOK, map[string]interface{}{
+		"collections": collections,
+		"next_cursor": nextCursor("public_collections", next),
+	})
+}
+
+// HandleCollectionsByUsername lists a user's collections, including their
+// private ones if it's them asking.
+func HandleCollectionsByUsername(c *Context, w http.ResponseWriter, req *http.Request) {
+	username := c.Params.ByName("username")
+
+	fields := log.Fields{"username": username}
+	if c.User != nil {
+		fields["auth_user_id"] = c.User.Id
+	}
+	clog := c.Log().WithFields(fields)
+
+	user, err := c.Api.User.ByUsername(username)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up user by username")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not get those collections, please try again soon"))
+		return
+	}
+	if err == sql.ErrNoRows || user == nil {
+		c.Render.JSON(w, http.StatusNotFound,
+			ApiErr(ERR_USER_NOT_FOUND, "No user by that username could be found"))
+		return
+	}
+
+	clog = clog.WithField("user_id", user.Id)
+
+	kind := "user_collections:" + user.Id
+	limit, after, err := pageParams(req, kind, MaxCollectionsPageSize, MaxCollectionsPageSize)
+	if err != nil {
+		c.Render.JSON(w, http.StatusBadRequest, ApiErr(ERR_INVALID_REQUEST, err.Error()))
+		return
+	}
+
+	collections, next, err := c.Api.Collection.ByUserId(user.Id, limit, after)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up collections by user")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not get those collections, please try again soon"))
+		return
+	}
+
+	// Filter out any collections the user isn't allowed to see
+	visible := make([]*models.Collection, 0, len(collections))
+	for _, collection := range collections {
+		if canSeeCollection(c, collection) {
+			visible = append(visible, collection)
+		}
+	}
+
+	c.Render.JSON(w, http.StatusOK, map[string]interface{}{
+		"collections": visible,
+		"next_cursor": nextCursor(kind, next),
+	})
+}
@@ -0,0 +1,76 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/ericflo/gradientzoo/models"
+)
+
+type CompletePasswordResetForm struct {
+	Password string `json:"password"`
+}
+
+func HandleCompletePasswordReset(c *Context, w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+
+	// Parse the JSON POST body
+	var form CompletePasswordResetForm
+	if !decodeForm(c, w, req, c.Log().WithField("path", req.URL.Path), "password reset", &form) {
+		return
+	}
+	if len(form.Password) < 5 {
+		c.Render.JSON(w, http.StatusBadRequest,
+			ApiErr(ERR_INVALID_REQUEST, "Password must be at least 5 characters long"))
+		return
+	}
+
+	user, err := userFromSignedToken(c, c.Params.ByName("token"),
+		TOKEN_PURPOSE_PASSWORD_RESET)
+	if err != nil {
+		c.Log().WithField("err", err).Error("Could not look up user for token")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not reset your password, please try again soon"))
+		return
+	}
+	if user == nil {
+		c.Render.JSON(w, http.StatusBadRequest,
+			ApiErr(ERR_EXPIRED, "That link is not valid or has expired"))
+		return
+	}
+
+	clog := c.Log().WithField("user_id", user.Id)
+
+	// Changing the hash also means this link can't be used again.  Getting the
+	// link proves they can read mail sent to the address, too.
+	if err = user.SetPassword(form.Password); err != nil {
+		clog.WithField("err", err).Error("Could not set password")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not reset your password, please try again soon"))
+		return
+	}
+	user.EmailVerified = true
+	user.MustChangePassword = false
+	if err = c.Api.User.Save(user); err != nil {
+		clog.WithField("err", err).Error("Could not save user")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not reset your password, please try again soon"))
+		return
+	}
+
+	// Whoever knew the old password shouldn't stay signed in
+	if err = c.Api.AuthToken.DeleteByUserIdKind(user.Id, models.TOKEN_KIND_SESSION); err != nil {
+		clog.WithField("err", err).Error("Could not delete sessions")
+	}
+	if err = c.Api.RefreshToken.DeleteByUserId(user.Id); err != nil {
+		clog.WithField("err", err).Error("Could not delete refresh tokens")
+	}
+	// Proving they own the e-mail address is as good as an unlock link
+	if err = c.Api.User.ResetFailedLogins(user.Id); err != nil {
+		clog.WithField("err", err).Error("Could not reset failed logins")
+	}
+
+	clog.Info("Password was reset")
+	audit(c, req, user.Id, user.Id, models.AUDIT_PASSWORD_RESET, "user", user.Id, nil)
+
+	c.Render.JSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
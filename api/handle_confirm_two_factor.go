@@ -0,0 +1,68 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/ericflo/gradientzoo/models"
+	"github.com/ericflo/gradientzoo/utils"
+)
+
+func HandleConfirmTwoFactor(c *Context, w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+
+	// Parse the JSON POST body
+	var form TwoFactorForm
+	if !decodeForm(c, w, req, c.Log().WithField("path", req.URL.Path), "two-factor", &form) {
+		return
+	}
+
+	clog := c.Log().WithField("user_id", c.User.Id)
+
+	if c.User.TotpEnabled {
+		c.Render.JSON(w, http.StatusBadRequest,
+			ApiErr(ERR_INVALID_STATE, "Two-factor authentication is already enabled"))
+		return
+	}
+	if c.User.TotpSecret == "" {
+		c.Render.JSON(w, http.StatusBadRequest,
+			ApiErr(ERR_TWO_FACTOR_REQUIRED, "Must enroll in two-factor authentication first"))
+		return
+	}
+
+	counter := utils.CheckTotp(c.User.TotpSecret, form.Code, time.Now())
+	if counter < 0 {
+		c.Render.JSON(w, http.StatusBadRequest,
+			ApiErr(ERR_INVALID_CREDENTIALS, "That code is not correct, check your authenticator app's clock"))
+		return
+	}
+	if _, err := c.Api.User.UseTotpCounter(c.User.Id, counter); err != nil {
+		clog.WithField("err", err).Error("Could not use totp counter")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not enable two-factor authentication, please try again soon"))
+		return
+	}
+
+	codes, err := c.Api.BackupCode.Generate(c.User.Id)
+	if err != nil {
+		clog.WithField("err", err).Error("Could not generate backup codes")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not enable two-factor authentication, please try again soon"))
+		return
+	}
+
+	c.User.TotpEnabled = true
+	if err = c.Api.User.Save(c.User); err != nil {
+		clog.WithField("err", err).Error("Could not save user")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not enable two-factor authentication, please try again soon"))
+		return
+	}
+
+	clog.Info("Enabled two-factor authentication")
+	audit(c, req, c.User.Id, c.User.Id, models.AUDIT_TWO_FACTOR_ENABLE, "", "", nil)
+
+	c.Render.JSON(w, http.StatusOK, map[string]interface{}{
+		"backup_codes": codes,
+	})
+}
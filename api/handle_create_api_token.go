@@ -0,0 +1,108 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/models"
+)
+
+const MaxApiTokenNameLength = 100
+
+const MaxApiTokenModels = 50
+
+type CreateApiTokenForm struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+	// Slugs of the models the token is limited to, or empty for all of them
+	Models []string `json:"models"`
+}
+
+func HandleCreateApiToken(c *Context, w http.ResponseWriter, req *http.Request) {
+	createApiToken(c, w, req, c.User)
+}
+
+// createApiToken makes a token for user, who is either the signed in user or
+// one of the service accounts they manage.
+func createApiToken(c *Context, w http.ResponseWriter, req *http.Request, user *models.User) {
+	defer req.Body.Close()
+
+	clog := c.Log().WithFields(log.Fields{
+		"auth_user_id": c.User.Id,
+		"user_id":      user.Id,
+	})
+
+	// Parse the JSON POST body
+	var form CreateApiTokenForm
+	if !decodeForm(c, w, req, clog, "token", &form) {
+		return
+	}
+
+	clog = clog.WithFields(log.Fields{
+		"name":   form.Name,
+		"scopes": form.Scopes,
+		"models": form.Models,
+	})
+
+	// Validation
+	form.Name = strings.TrimSpace(form.Name)
+	v := NewValidator()
+	v.Field("name", "Name").Required(form.Name).MaxLength(form.Name, MaxApiTokenNameLength)
+	scopes := []string{}
+	seen := map[string]bool{}
+	scopeCheck := v.Field("scopes", "Scopes").Check(len(form.Scopes) > 0,
+		"must include at least one scope")
+	for _, scope := range form.Scopes {
+		scopeCheck.Check(models.ValidScope(scope), "must be some of 'read', 'upload', 'admin'")
+		if !seen[scope] {
+			seen[scope] = true
+			scopes = append(scopes, scope)
+		}
+	}
+	v.Field("models", "Models").MaxItems(len(form.Models), MaxApiTokenModels)
+	if v.Refuse(c, w) {
+		return
+	}
+
+	modelIds := []string{}
+	seenModels := map[string]bool{}
+	for _, slug := range form.Models {
+		m, err := c.Api.Model.ByUserIdSlug(user.Id, slug)
+		if err != nil && err != sql.ErrNoRows {
+			clog.WithField("err", err).Error("Could not look up model by slug")
+			c.Render.JSON(w, http.StatusBadGateway,
+				ApiErr(ERR_UNAVAILABLE, "Could not create your token, please try again soon"))
+			return
+		}
+		if m == nil || err == sql.ErrNoRows {
+			c.Render.JSON(w, http.StatusBadRequest,
+				ApiErr(ERR_MODEL_NOT_FOUND, "You don't have a model called "+slug))
+			return
+		}
+		if !seenModels[m.Id] {
+			seenModels[m.Id] = true
+			modelIds = append(modelIds, m.Id)
+		}
+	}
+
+	authToken := models.NewApiToken(user.Id, form.Name, scopes, modelIds)
+	if err := c.Api.AuthToken.Save(authToken); err != nil {
+		clog.WithField("err", err).Error("Could not save api token")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not create your token, please try again soon"))
+		return
+	}
+
+	clog.Info("Api token created")
+
+	audit(c, req, c.User.Id, user.Id, models.AUDIT_TOKEN_CREATE, "auth_token",
+		authToken.Id, map[string]interface{}{
+			"name":      authToken.Name,
+			"scopes":    authToken.Scopes,
+			"model_ids": authToken.ModelIds,
+		})
+
+	c.Render.JSON(w, http.StatusOK, map[string]*models.AuthToken{"token": authToken})
+}
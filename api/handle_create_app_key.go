@@ -0,0 +1,55 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/ericflo/gradientzoo/models"
+)
+
+type CreateAppKeyForm struct {
+	Name           string `json:"name"`
+	ContactEmail   string `json:"contact_email"`
+	RateMultiplier int    `json:"rate_multiplier"`
+}
+
+func HandleCreateAppKey(c *Context, w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+
+	clog := c.Log().WithField("user_id", c.User.Id)
+
+	// Parse the JSON POST body
+	var form CreateAppKeyForm
+	if !decodeForm(c, w, req, clog, "app key", &form) {
+		return
+	}
+	form.Name = strings.TrimSpace(form.Name)
+	form.ContactEmail = strings.TrimSpace(form.ContactEmail)
+	v := NewValidator()
+	v.Field("name", "Name").Required(form.Name)
+	v.Field("contact_email", "Contact e-mail address").Email(form.ContactEmail)
+	// Zero leaves the multiplier at its default
+	if form.RateMultiplier != 0 {
+		v.Field("rate_multiplier", "Rate multiplier").Range(form.RateMultiplier, 1,
+			MaxAppKeyRateMultiplier)
+	}
+	if v.Refuse(c, w) {
+		return
+	}
+
+	appKey := models.NewAppKey(form.Name, form.ContactEmail, c.User.Id)
+	if form.RateMultiplier > 0 {
+		appKey.RateMultiplier = form.RateMultiplier
+	}
+	if err := c.Api.AppKey.Save(appKey); err != nil {
+		clog.WithField("err", err).Error("Could not save app key")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not create app key, please try again soon"))
+		return
+	}
+
+	audit(c, req, c.User.Id, "", models.AUDIT_APP_KEY_CREATE, "app_key",
+		appKey.Id, map[string]interface{}{"name": appKey.Name})
+
+	c.Render.JSON(w, http.StatusOK, map[string]*models.AppKey{"app_key": appKey})
+}
@@ -0,0 +1,59 @@
+package api
+
+import (
+	"net/http"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/models"
+)
+
+type CreateCollectionForm struct {
+	Title       string   `json:"title"`
+	Description string   `json:"description"`
+	Visibility  string   `json:"visibility"`
+	ModelIds    []string `json:"model_ids"`
+}
+
+func HandleCreateCollection(c *Context, w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+
+	clog := c.Log().WithFields(log.Fields{
+		"auth_user_id": c.User.Id,
+	})
+
+	// Parse the JSON POST body
+	var form CreateCollectionForm
+	if !decodeForm(c, w, req, clog, "collection", &form) {
+		return
+	}
+
+	// Validation
+	v := NewValidator()
+	v.Field("title", "Title").Length(form.Title, 3, maxCollectionTitleLength)
+	v.Field("description", "Description").MaxLength(form.Description, maxCollectionDescriptionLength)
+	v.Field("visibility", "Visibility").OneOf(form.Visibility, "public", "private")
+	if v.Refuse(c, w) {
+		return
+	}
+	if !checkCollectionModels(c, w, clog, form.ModelIds) {
+		return
+	}
+
+	collection := models.NewCollection(c.User.Id, form.Title, form.Description,
+		form.Visibility)
+	clog = clog.WithField("collection_id", collection.Id)
+	if err := c.Api.Collection.Save(collection); err != nil {
+		clog.WithField("err", err).Error("Could not save collection")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not create your collection, please try again soon"))
+		return
+	}
+	if err := c.Api.Collection.SetModels(collection.Id, form.ModelIds); err != nil {
+		clog.WithField("err", err).Error("Could not save collection models")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not create your collection, please try again soon"))
+		return
+	}
+
+	c.Render.JSON(w, http.StatusOK, map[string]*models.Collection{"collection": collection})
+}
@@ -0,0 +1,97 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/models"
+)
+
+const MaxFileShareDuration = 365 * 24 * time.Hour
+
+type CreateFileShareForm struct {
+	ExpiresTime time.Time `json:"expires_time"`
+	Note        string    `json:"note"`
+}
+
+func HandleCreateFileShare(c *Context, w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+
+	id := c.Params.ByName("id")
+
+	clog := c.Log().WithFields(log.Fields{
+		"user_id": c.User.Id,
+		"file_id": id,
+	})
+
+	// Parse the JSON POST body
+	var form CreateFileShareForm
+	if !decodeForm(c, w, req, clog, "file share", &form) {
+		return
+	}
+
+	clog = clog.WithField("expires_time", form.ExpiresTime)
+
+	// Validation
+	now := time.Now()
+	v := NewValidator()
+	v.Field("expires_time", "Expiry time").
+		Check(form.ExpiresTime.After(now), "must be in the future").
+		Check(form.ExpiresTime.Sub(now) <= MaxFileShareDuration, "must be at most a year away")
+	if v.Refuse(c, w) {
+		return
+	}
+
+	// Get the file by its id
+	f, err := c.Api.File.ById(id)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up file")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not share that file, please try again soon"))
+		return
+	}
+	if err == sql.ErrNoRows || f == nil || f.Status == "pending" {
+		c.Render.JSON(w, http.StatusNotFound,
+			ApiErr(ERR_FILE_NOT_FOUND, "There is no file with that id"))
+		return
+	}
+
+	clog = clog.WithField("file_model_id", f.ModelId)
+
+	// Only the model's owner may share its files
+	m, err := c.Api.Model.ById(f.ModelId)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up model by id")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not share that file, please try again soon"))
+		return
+	}
+	if err == sql.ErrNoRows || m == nil {
+		c.Render.JSON(w, http.StatusNotFound,
+			ApiErr(ERR_FILE_NOT_FOUND, "There is no file with that id"))
+		return
+	}
+	if !authorize(c, w, m, ACTION_MANAGE,
+		"You're only allowed to share files in your own models") {
+		return
+	}
+
+	share := models.NewFileShare(f.Id, m.Id, form.Note, form.ExpiresTime)
+	if err = c.Api.FileShare.Save(share); err != nil {
+		clog.WithField("err", err).Error("Could not save file share")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not share that file, please try again soon"))
+		return
+	}
+
+	clog.WithField("file_share_id", share.Id).Info("File shared")
+	audit(c, req, c.User.Id, m.UserId, models.AUDIT_FILE_SHARE_CREATE,
+		"file_share", share.Id, map[string]interface{}{
+			"file_id":      f.Id,
+			"expires_time": share.ExpiresTime,
+		})
+
+	c.Render.JSON(w, http.StatusOK, map[string]*models.FileShare{"file_share": share})
+}
@@ -0,0 +1,99 @@
+package api
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/ericflo/gradientzoo/models"
+)
+
+const MaxIpAllowlistEntries = 100
+
+type CreateIpAllowlistEntryForm struct {
+	Cidr string `json:"cidr"`
+	Note string `json:"note"`
+}
+
+// HandleCreateIpAllowlistEntry adds a network to the ones the organization's
+// members can use their tokens from.  Only the owner can, and not in a way
+// that would lock them out.
+func HandleCreateIpAllowlistEntry(c *Context, w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+
+	clog := c.Log().WithField("user_id", c.User.Id)
+
+	// Parse the JSON POST body
+	var form CreateIpAllowlistEntryForm
+	if !decodeForm(c, w, req, clog, "allowlist", &form) {
+		return
+	}
+
+	// Single addresses are allowed as a shorthand for a network of one
+	cidr := strings.TrimSpace(form.Cidr)
+	if ip := net.ParseIP(cidr); ip != nil {
+		if ip.To4() != nil {
+			cidr += "/32"
+		} else {
+			cidr += "/128"
+		}
+	}
+	_, network, err := net.ParseCIDR(cidr)
+	v := NewValidator()
+	v.Field("cidr", "Network").Check(err == nil,
+		"must be an IP address or a network in CIDR notation, like 10.0.0.0/8")
+	v.Field("note", "Note").MaxLength(form.Note, 200)
+	if v.Refuse(c, w) {
+		return
+	}
+
+	org, err := userOrganization(c.Api, c.User.Id)
+	if err != nil {
+		clog.WithField("err", err).Error("Could not look up organization")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not update your organization's IP allowlist, please try again soon"))
+		return
+	}
+	if org == nil || org.OwnerId != c.User.Id {
+		c.Render.JSON(w, http.StatusUnauthorized,
+			ApiErr(ERR_FORBIDDEN, "Only an organization's owner can change its IP allowlist"))
+		return
+	}
+
+	clog = clog.WithField("organization_id", org.Id)
+
+	entries, err := c.Api.IpAllowlist.ByOrganizationId(org.Id)
+	if err != nil {
+		clog.WithField("err", err).Error("Could not get ip allowlist")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not update your organization's IP allowlist, please try again soon"))
+		return
+	}
+	if len(entries) >= MaxIpAllowlistEntries {
+		c.Render.JSON(w, http.StatusBadRequest,
+			ApiErr(ERR_QUOTA_EXCEEDED, "Your organization already has as many allowlist entries as it can"))
+		return
+	}
+
+	// Store the network rather than what was typed, e.g. 10.1.2.3/8 becomes
+	// 10.0.0.0/8, which is what Postgres would insist on anyway
+	entry := models.NewIpAllowlistEntry(org.Id, network.String(), form.Note)
+	if ip := clientIp(req); !models.IpAllowed(append(entries, entry), ip) {
+		c.Render.JSON(w, http.StatusBadRequest,
+			ApiErr(ERR_INVALID_STATE, "That would lock you out, since you're using "+ip+"; allow it first"))
+		return
+	}
+	if err = c.Api.IpAllowlist.Save(entry); err != nil {
+		clog.WithField("err", err).Error("Could not save ip allowlist entry")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not update your organization's IP allowlist, please try again soon"))
+		return
+	}
+
+	audit(c, req, c.User.Id, c.User.Id, models.AUDIT_IP_ALLOWLIST_ADD,
+		"ip_allowlist", entry.Id, map[string]interface{}{"cidr": entry.Cidr})
+
+	c.Render.JSON(w, http.StatusOK, map[string]*models.IpAllowlistEntry{
+		"entry": entry,
+	})
+}
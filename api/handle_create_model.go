@@ -2,7 +2,6 @@ package api
 
 import (
 	"database/sql"
-	"encoding/json"
 	"net/http"
 
 	log "github.com/Sirupsen/logrus"
@@ -14,23 +13,20 @@ type CreateModelForm struct {
 	Name        string `json:"name"`
 	Description string `json:"description"`
 	Visibility  string `json:"visibility"`
+	License     string `json:"license"`
 	Keep        int    `jsno:"keep"`
 }
 
 func HandleCreateModel(c *Context, w http.ResponseWriter, req *http.Request) {
 	defer req.Body.Close()
 
-	clog := log.WithFields(log.Fields{
+	clog := c.Log().WithFields(log.Fields{
 		"user_id": c.User.Id,
 	})
 
 	// Parse the JSON POST body
-	decoder := json.NewDecoder(req.Body)
 	var form CreateModelForm
-	if err := decoder.Decode(&form); err != nil {
-		msg := "Could not decode model form"
-		clog.WithField("err", err).Error(msg)
-		c.Render.JSON(w, http.StatusBadRequest, JsonErr(msg))
+	if !decodeForm(c, w, req, clog, "model", &form) {
 		return
 	}
 
@@ -41,10 +37,14 @@ func HandleCreateModel(c *Context, w http.ResponseWriter, req *http.Request) {
 	})
 
 	// Validation
-
-	if len(form.Slug) < 3 {
-		c.Render.JSON(w, http.StatusBadRequest,
-			JsonErr("Slug must be at least 3 characters long"))
+	form.License = normalizeLicense(form.License)
+	v := NewValidator()
+	v.Field("slug", "Slug").MinLength(form.Slug, 3)
+	v.Field("name", "Name").MinLength(form.Name, 3)
+	v.Field("description", "Short description").MaxLength(form.Description, 200)
+	v.Field("license", "License").MaxLength(form.License, maxLicenseLength)
+	v.Field("visibility", "Visibility").OneOf(form.Visibility, "public", "private")
+	if v.Refuse(c, w) {
 		return
 	}
 
@@ -52,38 +52,28 @@ func HandleCreateModel(c *Context, w http.ResponseWriter, req *http.Request) {
 	if err != nil && err != sql.ErrNoRows {
 		clog.WithField("err", err).Error("Could not look up model by user and slug")
 		c.Render.JSON(w, http.StatusBadGateway,
-			JsonErr("Could not sign you up, please try again soon"))
+			ApiErr(ERR_UNAVAILABLE, "Could not sign you up, please try again soon"))
 		return
 	}
 	if err == nil && model != nil {
 		c.Render.JSON(w, http.StatusBadRequest,
-			JsonErr("You already have a model with that slug"))
-		return
-	}
-
-	if len(form.Name) < 3 {
-		c.Render.JSON(w, http.StatusBadRequest,
-			JsonErr("Name must be at least 3 characters long"))
+			ApiErr(ERR_ALREADY_EXISTS, "You already have a model with that slug"))
 		return
 	}
 
-	if len(form.Description) > 200 {
-		c.Render.JSON(w, http.StatusBadRequest,
-			JsonErr("Short description may be 200 characters maximum"))
-		return
-	}
-
-	if form.Visibility != "public" && form.Visibility != "private" {
-		c.Render.JSON(w, http.StatusBadRequest,
-			JsonErr("Visibility must be one of 'public', 'private'"))
+	// Members of an organization can use its plan instead of paying themselves
+	covered, err := organizationCoversPlan(c.Api, c.User, form.Keep)
+	if err != nil {
+		clog.WithField("err", err).Error("Could not look up organization plan")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not create your model, please try again soon"))
 		return
 	}
-
-	if (form.Keep != 10 && c.User.StripeCustomerId == "") ||
+	if !covered && ((form.Keep != 10 && c.User.StripeCustomerId == "") ||
 		(form.Keep == 10 && form.Visibility == "private" &&
-			c.User.StripeCustomerId == "") {
+			c.User.StripeCustomerId == "")) {
 		c.Render.JSON(w, http.StatusBadRequest,
-			JsonErr("Must connect a payment source before you can create a model "+
+			ApiErr(ERR_PAYMENT_REQUIRED, "Must connect a payment source before you can create a model "+
 				"that size"))
 		return
 	}
@@ -91,7 +81,7 @@ func HandleCreateModel(c *Context, w http.ResponseWriter, req *http.Request) {
 	/*
 		if form.Keep != 10 {
 			c.Render.JSON(w, http.StatusBadRequest,
-				JsonErr("Sorry, during our alpha testing period you can keep only "+
+				ApiErr(ERR_QUOTA_EXCEEDED, "Sorry, during our alpha testing period you can keep only "+
 					"ten historical model files"))
 			return
 		}
@@ -105,7 +95,7 @@ func HandleCreateModel(c *Context, w http.ResponseWriter, req *http.Request) {
 		if err != nil && err != sql.ErrNoRows {
 			clog.WithField("err", err).Error("Could not look up models by user id")
 			c.Render.JSON(w, http.StatusBadGateway,
-				JsonErr("Could not create your model, please try again soon"))
+				ApiErr(ERR_UNAVAILABLE, "Could not create your model, please try again soon"))
 			return
 		}
 
@@ -118,7 +108,7 @@ func HandleCreateModel(c *Context, w http.ResponseWriter, req *http.Request) {
 		// If so, disallow creation of a new one
 		if form.Visibility == "private" && privateCount > 0 {
 			c.Render.JSON(w, http.StatusBadGateway,
-				JsonErr("Sorry, during our alpha testing period you can have only "+
+				ApiErr(ERR_UNAVAILABLE, "Sorry, during our alpha testing period you can have only "+
 					"one private model"))
 			return
 		}
@@ -127,15 +117,32 @@ func HandleCreateModel(c *Context, w http.ResponseWriter, req *http.Request) {
 	// Now we can create the new model
 	model = models.NewModel(c.User.Id, form.Slug, form.Name, form.Description,
 		form.Visibility, form.Keep)
+	model.License = form.License
 	if err = c.Api.Model.Save(model); err != nil {
 		clog.WithField("err", err).Error("Could not save model")
 		c.Render.JSON(w, http.StatusBadGateway,
-			JsonErr("Could not create your model, please try again soon"))
+			ApiErr(ERR_UNAVAILABLE, "Could not create your model, please try again soon"))
 		return
 	}
 
 	clog = clog.WithField("model_id", model.Id)
 
-	// Return the new user and auth token objects
-	c.Render.JSON(w, http.StatusOK, map[string]*models.Model{"model": model})
+	audit(c, req, c.User.Id, c.User.Id, models.AUDIT_MODEL_CREATE, "model",
+		model.Id, map[string]interface{}{
+			"slug":       model.Slug,
+			"visibility": model.Visibility,
+		})
+
+	// Point out public models this might be a copy of, though it's only
+	// advice, so the model is created either way
+	resp := map[string]interface{}{"model": model}
+	dups, err := duplicatesByText(c.Api, model)
+	if err != nil {
+		clog.WithField("err", err).Error("Could not look for duplicate models")
+	} else if len(dups) > 0 {
+		resp["possible_duplicates"] = dups
+	}
+
+	// Return the new model object
+	c.Render.JSON(w, http.StatusOK, resp)
 }
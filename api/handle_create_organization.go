@@ -0,0 +1,68 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/ericflo/gradientzoo/models"
+)
+
+type CreateOrganizationForm struct {
+	Name string `json:"name"`
+}
+
+func HandleCreateOrganization(c *Context, w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+
+	clog := c.Log().WithField("user_id", c.User.Id)
+
+	// Parse the JSON POST body
+	var form CreateOrganizationForm
+	if !decodeForm(c, w, req, clog, "organization", &form) {
+		return
+	}
+	if c.User.IsService() {
+		c.Render.JSON(w, http.StatusUnauthorized,
+			ApiErr(ERR_FORBIDDEN, "Service accounts can't own organizations"))
+		return
+	}
+	form.Name = strings.TrimSpace(form.Name)
+	v := NewValidator()
+	v.Field("name", "Name").Length(form.Name, 3, 100)
+	if v.Refuse(c, w) {
+		return
+	}
+
+	existing, err := userOrganization(c.Api, c.User.Id)
+	if err != nil {
+		clog.WithField("err", err).Error("Could not look up organization")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not create your organization, please try again soon"))
+		return
+	}
+	if existing != nil {
+		c.Render.JSON(w, http.StatusBadRequest,
+			ApiErr(ERR_INVALID_STATE, "You already belong to an organization"))
+		return
+	}
+
+	org := models.NewOrganization(form.Name, c.User.Id)
+	if err = c.Api.Organization.Save(org); err != nil {
+		clog.WithField("err", err).Error("Could not save organization")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not create your organization, please try again soon"))
+		return
+	}
+	if err = c.Api.Organization.AddMember(org.Id, c.User.Id); err != nil {
+		clog.WithField("err", err).Error("Could not add owner to organization")
+		c.Api.Organization.Delete(org.Id)
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not create your organization, please try again soon"))
+		return
+	}
+
+	audit(c, req, c.User.Id, c.User.Id, models.AUDIT_ORG_CREATE, "organization",
+		org.Id, map[string]interface{}{"name": org.Name})
+
+	c.Render.JSON(w, http.StatusOK, map[string]*models.Organization{"organization": org})
+}
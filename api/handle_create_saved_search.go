@@ -0,0 +1,74 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/ericflo/gradientzoo/models"
+)
+
+type CreateSavedSearchForm struct {
+	Name   string            `json:"name"`
+	Query  string            `json:"query"`
+	Filter map[string]string `json:"filter"`
+	Notify bool              `json:"notify"`
+}
+
+func HandleCreateSavedSearch(c *Context, w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+
+	clog := c.Log().WithField("auth_user_id", c.User.Id)
+
+	// Parse the JSON POST body
+	var form CreateSavedSearchForm
+	if !decodeForm(c, w, req, clog, "saved search", &form) {
+		return
+	}
+
+	// Validation
+	form.Name = strings.TrimSpace(form.Name)
+	form.Query = strings.TrimSpace(form.Query)
+	if form.Filter == nil {
+		form.Filter = map[string]string{}
+	}
+	v := NewValidator()
+	v.Field("name", "Name").Length(form.Name, 1, maxSavedSearchNameLength)
+	queryCheck := v.Field("query", "Query").MaxLength(form.Query, maxSavedSearchQueryLength)
+	filter, err := savedSearchFilter(form.Filter)
+	if err != nil {
+		v.Add("filter", err.Error())
+	} else {
+		queryCheck.Check(form.Query != "" || !filter.Empty(), "is required unless there's a filter")
+	}
+	if v.Refuse(c, w) {
+		return
+	}
+
+	searches, err := c.Api.SavedSearch.ByUserId(c.User.Id)
+	if err != nil {
+		clog.WithField("err", err).Error("Could not get saved searches")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not save your search, please try again soon"))
+		return
+	}
+	if len(searches) >= models.MAX_SAVED_SEARCHES {
+		c.Render.JSON(w, http.StatusBadRequest,
+			ApiErr(ERR_QUOTA_EXCEEDED, "You already have as many saved searches as you can"))
+		return
+	}
+
+	s, err := models.NewSavedSearch(c.User.Id, form.Name, form.Query, form.Filter,
+		form.Notify)
+	if err == nil {
+		clog = clog.WithField("saved_search_id", s.Id)
+		err = c.Api.SavedSearch.Save(s)
+	}
+	if err != nil {
+		clog.WithField("err", err).Error("Could not save saved search")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not save your search, please try again soon"))
+		return
+	}
+
+	c.Render.JSON(w, http.StatusOK, map[string]*models.SavedSearch{"saved_search": s})
+}
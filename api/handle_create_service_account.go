@@ -0,0 +1,105 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/ericflo/gradientzoo/models"
+	"github.com/ericflo/gradientzoo/utils"
+)
+
+type CreateServiceAccountForm struct {
+	Username string `json:"username"`
+	// Whether the account belongs to the user's organization rather than them
+	Organization bool `json:"organization"`
+}
+
+func HandleCreateServiceAccount(c *Context, w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+
+	clog := c.Log().WithField("user_id", c.User.Id)
+
+	// Parse the JSON POST body
+	var form CreateServiceAccountForm
+	if !decodeForm(c, w, req, clog, "service account", &form) {
+		return
+	}
+
+	if c.User.IsService() {
+		c.Render.JSON(w, http.StatusUnauthorized,
+			ApiErr(ERR_FORBIDDEN, "Service accounts can't make other service accounts"))
+		return
+	}
+	v := NewValidator()
+	v.Field("username", "Username").
+		Matches(form.Username, SlugReg, "can contain only letters, numbers, and underscore").
+		Length(form.Username, 3, 20).
+		Check(!utils.Live().Reserved(form.Username), "is reserved")
+	if v.Refuse(c, w) {
+		return
+	}
+
+	clog = clog.WithField("username", form.Username)
+
+	orgId := ""
+	if form.Organization {
+		org, err := userOrganization(c.Api, c.User.Id)
+		if err != nil {
+			clog.WithField("err", err).Error("Could not look up organization")
+			c.Render.JSON(w, http.StatusBadGateway,
+				ApiErr(ERR_UNAVAILABLE, "Could not create that service account, please try again soon"))
+			return
+		}
+		if org == nil {
+			c.Render.JSON(w, http.StatusBadRequest,
+				ApiErr(ERR_INVALID_STATE, "You don't belong to an organization"))
+			return
+		}
+		orgId = org.Id
+	}
+
+	existing, err := c.Api.User.ByUsername(form.Username)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up user by username")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not create that service account, please try again soon"))
+		return
+	}
+	if err == nil && existing != nil {
+		c.Render.JSON(w, http.StatusBadRequest,
+			ApiErr(ERR_ALREADY_EXISTS, "A user with that username already exists"))
+		return
+	}
+
+	service := models.NewServiceAccount(form.Username, c.User.Id, orgId)
+	if err = c.Api.User.Save(service); err != nil {
+		clog.WithField("err", err).Error("Could not save service account")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not create that service account, please try again soon"))
+		return
+	}
+
+	// Organization service accounts share the organization's plan and quota
+	if orgId != "" {
+		if err = c.Api.Organization.AddMember(orgId, service.Id); err != nil {
+			clog.WithField("err", err).Error("Could not add service account to organization")
+			c.Render.JSON(w, http.StatusBadGateway,
+				ApiErr(ERR_UNAVAILABLE, "Could not create that service account, please try again soon"))
+			return
+		}
+	}
+
+	clog.WithField("service_account_id", service.Id).Info("Service account created")
+	audit(c, req, c.User.Id, c.User.Id, models.AUDIT_SERVICE_ACCT_ADD, "user",
+		service.Id, map[string]interface{}{
+			"username":        service.Username,
+			"organization_id": orgId,
+		})
+
+	// Hydrate the user object
+	if err = c.Api.User.Hydrate([]*models.User{service}); err != nil {
+		clog.WithField("err", err).Error("Could not hydrate")
+	}
+
+	c.Render.JSON(w, http.StatusOK, map[string]*models.User{"service_account": service})
+}
@@ -0,0 +1,11 @@
+package api
+
+import (
+	"net/http"
+)
+
+func HandleCreateServiceAccountToken(c *Context, w http.ResponseWriter, req *http.Request) {
+	if service := serviceAccountFor(c, w, c.Params.ByName("id")); service != nil {
+		createApiToken(c, w, req, service)
+	}
+}
@@ -0,0 +1,67 @@
+package api
+
+import (
+	"net/http"
+)
+
+// quotaStatus is how much of their organization's plan a user's organization
+// has used, for users who belong to one
+type quotaStatus struct {
+	*OrganizationUsage
+	StoragePercent   int64 `json:"storage_percent"`
+	BandwidthPercent int64 `json:"bandwidth_percent"`
+	OverQuota        bool  `json:"over_quota"`
+}
+
+func HandleDashboard(c *Context, w http.ResponseWriter, req *http.Request) {
+	clog := c.Log().WithField("user_id", c.User.Id)
+
+	ms, err := c.Api.Model.DashboardByUserId(c.User.Id)
+	if err != nil {
+		clog.WithField("err", err).Error("Could not look up dashboard")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not get your dashboard, please try again soon"))
+		return
+	}
+
+	var storageBytes int64
+	for _, m := range ms {
+		storageBytes += m.StorageBytes
+	}
+
+	// Only organizations have quotas
+	var quota *quotaStatus
+	org, err := userOrganization(c.Api, c.User.Id)
+	if err != nil {
+		clog.WithField("err", err).Error("Could not look up organization")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not get your dashboard, please try again soon"))
+		return
+	}
+	if org != nil {
+		usage, err := organizationUsage(c.Api, org)
+		if err != nil {
+			clog.WithField("err", err).Error("Could not look up organization usage")
+			c.Render.JSON(w, http.StatusBadGateway,
+				ApiErr(ERR_UNAVAILABLE, "Could not get your dashboard, please try again soon"))
+			return
+		}
+		// Other members' usage is for the owner to see
+		usage.Members = nil
+		quota = &quotaStatus{OrganizationUsage: usage}
+		if usage.StorageQuota > 0 {
+			quota.StoragePercent = usage.StorageBytes * 100 / usage.StorageQuota
+			quota.OverQuota = usage.StorageBytes >= usage.StorageQuota
+		}
+		if usage.BandwidthQuota > 0 {
+			quota.BandwidthPercent = usage.BandwidthBytes * 100 / usage.BandwidthQuota
+			quota.OverQuota = quota.OverQuota || usage.BandwidthBytes >= usage.BandwidthQuota
+		}
+	}
+
+	c.Render.JSON(w, http.StatusOK, map[string]interface{}{
+		"models":        ms,
+		"storage_bytes": storageBytes,
+		"quota":         quota,
+	})
+}
@@ -0,0 +1,80 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/models"
+	"gopkg.in/guregu/null.v3"
+)
+
+const maxAccessExpiryDays = 365
+
+type DecideAccessRequestForm struct {
+	Approve       bool `json:"approve"`
+	ExpiresInDays int  `json:"expires_in_days"`
+}
+
+func HandleDecideAccessRequest(c *Context, w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+
+	clog := c.Log().WithFields(log.Fields{
+		"user_id":           c.User.Id,
+		"access_request_id": c.Params.ByName("id"),
+	})
+
+	// Parse the JSON POST body
+	var form DecideAccessRequestForm
+	if !decodeForm(c, w, req, clog, "access decision", &form) {
+		return
+	}
+
+	// Validation, where zero days means the grant doesn't expire
+	v := NewValidator()
+	v.Field("expires_in_days", "Expiry in days").Range(form.ExpiresInDays, 0, maxAccessExpiryDays)
+	if v.Refuse(c, w) {
+		return
+	}
+
+	r, m := accessRequestFor(c, w, clog)
+	if r == nil {
+		return
+	}
+	clog = clog.WithField("model_id", m.Id)
+	if !authorize(c, w, m, ACTION_MANAGE,
+		"Only the owner of a model can decide who gets access") {
+		return
+	}
+
+	now := time.Now().UTC()
+	r.DecidedTime = null.TimeFrom(now)
+	r.DecidedById = null.StringFrom(c.User.Id)
+	r.ExpiresTime = null.Time{}
+	action := models.AUDIT_ACCESS_DENY
+	if form.Approve {
+		r.Status = models.ACCESS_APPROVED
+		if form.ExpiresInDays > 0 {
+			r.ExpiresTime = null.TimeFrom(now.Add(time.Duration(form.ExpiresInDays) * 24 * time.Hour))
+		}
+		action = models.AUDIT_ACCESS_GRANT
+	} else {
+		r.Status = models.ACCESS_DENIED
+	}
+	if err := c.Api.AccessRequest.Save(r); err != nil {
+		clog.WithField("err", err).Error("Could not save access request")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not save your decision, please try again soon"))
+		return
+	}
+
+	clog.WithField("status", r.Status).Info("Decided access request")
+	audit(c, req, c.User.Id, m.UserId, action, "access_request", r.Id,
+		map[string]interface{}{
+			"model_id":        m.Id,
+			"grantee_id":      r.UserId,
+			"expires_in_days": form.ExpiresInDays,
+		})
+
+	c.Render.JSON(w, http.StatusOK, map[string]*models.AccessRequest{"access_request": r})
+}
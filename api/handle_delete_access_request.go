@@ -0,0 +1,38 @@
+package api
+
+import (
+	"net/http"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/models"
+)
+
+// The owner deleting a request revokes whatever access it granted, and the
+// requester deleting it withdraws it
+func HandleDeleteAccessRequest(c *Context, w http.ResponseWriter, req *http.Request) {
+	clog := c.Log().WithFields(log.Fields{
+		"user_id":           c.User.Id,
+		"access_request_id": c.Params.ByName("id"),
+	})
+
+	r, m := accessRequestFor(c, w, clog)
+	if r == nil {
+		return
+	}
+	clog = clog.WithField("model_id", m.Id)
+
+	if err := c.Api.AccessRequest.Delete(r.Id); err != nil {
+		clog.WithField("err", err).Error("Could not delete access request")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not delete that access request, please try again soon"))
+		return
+	}
+
+	clog.Info("Deleted access request")
+	if r.Active() {
+		audit(c, req, c.User.Id, m.UserId, models.AUDIT_ACCESS_REVOKE, "access_request",
+			r.Id, map[string]interface{}{"model_id": m.Id, "grantee_id": r.UserId})
+	}
+
+	c.Render.JSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
@@ -0,0 +1,65 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/ericflo/gradientzoo/models"
+	"github.com/ericflo/gradientzoo/utils"
+	"gopkg.in/guregu/null.v3"
+)
+
+type DeleteAccountForm struct {
+	Password string `json:"password"`
+}
+
+func HandleDeleteAccount(c *Context, w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+
+	// Parse the JSON POST body
+	var form DeleteAccountForm
+	if !decodeForm(c, w, req, c.Log().WithField("path", req.URL.Path), "delete account", &form) {
+		return
+	}
+
+	clog := c.Log().WithField("user_id", c.User.Id)
+
+	if c.User.IsAdmin {
+		c.Render.JSON(w, http.StatusBadRequest,
+			ApiErr(ERR_FORBIDDEN, "Admins can't delete their accounts"))
+		return
+	}
+
+	// A stolen session alone shouldn't be enough to delete everything
+	if c.User.HasPassword() && c.User.CheckPassword(form.Password) != nil {
+		c.Render.JSON(w, http.StatusUnauthorized,
+			ApiErr(ERR_INVALID_CREDENTIALS, "Password didn't match, please re-type it or try another one"))
+		return
+	}
+
+	if c.User.DeletionTime.Valid {
+		c.Render.JSON(w, http.StatusOK, map[string]interface{}{
+			"deletion_time": c.User.DeletionTime,
+		})
+		return
+	}
+
+	grace := time.Duration(utils.Conf.AccountDeletionDays) * 24 * time.Hour
+	c.User.DeletionTime = null.TimeFrom(time.Now().UTC().Add(grace))
+	if err := c.Api.User.Save(c.User); err != nil {
+		clog.WithField("err", err).Error("Could not save user")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not delete your account, please try again soon"))
+		return
+	}
+
+	clog.Info("Scheduled account deletion")
+	audit(c, req, c.User.Id, c.User.Id, models.AUDIT_ACCOUNT_DELETE, "user",
+		c.User.Id, map[string]interface{}{"deletion_time": c.User.DeletionTime.Time})
+
+	goBackground(func() { sendAccountDeletionEmail(c.Mailer, c.User) })
+
+	c.Render.JSON(w, http.StatusOK, map[string]interface{}{
+		"deletion_time": c.User.DeletionTime,
+	})
+}
@@ -0,0 +1,50 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/models"
+)
+
+func HandleDeleteApiToken(c *Context, w http.ResponseWriter, req *http.Request) {
+	deleteApiToken(c, w, req, c.User, c.Params.ByName("id"))
+}
+
+func deleteApiToken(c *Context, w http.ResponseWriter, req *http.Request, user *models.User, id string) {
+	clog := c.Log().WithFields(log.Fields{
+		"auth_user_id": c.User.Id,
+		"user_id":      user.Id,
+	})
+
+	authToken, err := c.Api.AuthToken.ById(id)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up api token")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not revoke that token, please try again soon"))
+		return
+	}
+	// Other users' tokens are reported as missing, so that this can't be used
+	// to check whether a token exists
+	if err == sql.ErrNoRows || authToken == nil ||
+		authToken.UserId != user.Id || authToken.Kind != models.TOKEN_KIND_API {
+		c.Render.JSON(w, http.StatusNotFound,
+			ApiErr(ERR_NOT_FOUND, "There is no token with that id"))
+		return
+	}
+
+	if err = c.Api.AuthToken.Delete(authToken.Id); err != nil {
+		clog.WithField("err", err).Error("Could not delete api token")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not revoke that token, please try again soon"))
+		return
+	}
+
+	clog.WithField("name", authToken.Name).Info("Api token revoked")
+
+	audit(c, req, c.User.Id, user.Id, models.AUDIT_TOKEN_DELETE, "auth_token",
+		authToken.Id, map[string]interface{}{"name": authToken.Name})
+
+	c.Render.JSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
@@ -0,0 +1,29 @@
+package api
+
+import (
+	"net/http"
+)
+
+func HandleDeleteAvatar(c *Context, w http.ResponseWriter, req *http.Request) {
+	clog := c.Log().WithField("user_id", c.User.Id)
+
+	user := c.User
+	if user.AvatarFilename == "" {
+		c.Render.JSON(w, http.StatusOK, map[string]string{"status": "ok"})
+		return
+	}
+
+	oldFilename := user.AvatarFilename
+	user.AvatarFilename = ""
+	if err := c.Api.User.Save(user); err != nil {
+		clog.WithField("err", err).Error("Could not save user")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not delete your avatar, please try again soon"))
+		return
+	}
+	if err := c.Blob.Delete(oldFilename); err != nil {
+		clog.WithField("err", err).Error("Could not delete avatar")
+	}
+
+	c.Render.JSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
@@ -0,0 +1,30 @@
+package api
+
+import (
+	"net/http"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+func HandleDeleteCollection(c *Context, w http.ResponseWriter, req *http.Request) {
+	clog := c.Log().WithFields(log.Fields{
+		"collection_id": c.Params.ByName("id"),
+		"auth_user_id":  c.User.Id,
+	})
+
+	collection := ownCollection(c, w, clog)
+	if collection == nil {
+		return
+	}
+
+	if err := c.Api.Collection.Delete(collection.Id); err != nil {
+		clog.WithField("err", err).Error("Could not delete collection")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not delete your collection, please try again soon"))
+		return
+	}
+
+	clog.Info("Deleted collection")
+
+	c.Render.JSON(w, http.StatusOK, map[string]interface{}{"collection": collection})
+}
@@ -0,0 +1,46 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/models"
+)
+
+// HandleDeleteFeatureFlag deletes a feature flag, which turns it off for
+// everybody.
+func HandleDeleteFeatureFlag(c *Context, w http.ResponseWriter, req *http.Request) {
+	name := c.Params.ByName("name")
+
+	clog := c.Log().WithFields(log.Fields{
+		"user_id": c.User.Id,
+		"flag":    name,
+	})
+
+	flag, err := c.Api.FeatureFlag.ByName(name)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up feature flag")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not delete that feature flag, please try again soon"))
+		return
+	}
+	if err == sql.ErrNoRows || flag == nil {
+		c.Render.JSON(w, http.StatusNotFound,
+			ApiErr(ERR_NOT_FOUND, "Could not find that feature flag"))
+		return
+	}
+
+	if err = c.Api.FeatureFlag.Delete(flag.Name); err != nil {
+		clog.WithField("err", err).Error("Could not delete feature flag")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not delete that feature flag, please try again soon"))
+		return
+	}
+
+	clog.Warn("Admin deleted feature flag")
+	audit(c, req, c.User.Id, "", models.AUDIT_FEATURE_FLAG_DELETE, "feature_flag",
+		flag.Name, nil)
+
+	c.Render.JSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
@@ -0,0 +1,124 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/models"
+)
+
+func HandleDeleteFile(c *Context, w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+
+	username := c.Params.ByName("username")
+	slug := c.Params.ByName("slug")
+	filename := c.Params.ByName("filename")
+
+	clog := c.Log().WithFields(log.Fields{
+		"user_id":         c.User.Id,
+		"file_username":   username,
+		"file_model_slug": slug,
+		"filename":        filename,
+	})
+
+	// First let's look up the user by their username
+	user, err := c.Api.User.ByUsername(username)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up user by username")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not delete that file, please try again soon"))
+		return
+	}
+	if err == sql.ErrNoRows || user == nil {
+		c.Render.JSON(w, http.StatusNotFound,
+			ApiErr(ERR_USER_NOT_FOUND, "No user by that username could be found"))
+		return
+	}
+
+	clog = clog.WithField("file_user_id", user.Id)
+
+	// Now we get the model
+	m, err := c.Api.Model.ByUserIdSlug(user.Id, slug)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up model by username & slug")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not delete that file, please try again soon"))
+		return
+	}
+	if err == sql.ErrNoRows || m == nil {
+		c.Render.JSON(w, http.StatusNotFound,
+			ApiErr(ERR_MODEL_NOT_FOUND, "No model by that username and slug could be found"))
+		return
+	}
+	if !authorize(c, w, m, ACTION_WRITE,
+		"You're only allowed to delete files from your own models") {
+		return
+	}
+
+	clog = clog.WithField("file_model_id", m.Id)
+
+	// Grab every version of this file
+	files, err := c.Api.File.ByModelIdFilename(m.Id, filename)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up files by filename")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not delete that file, please try again soon"))
+		return
+	}
+	if len(files) == 0 {
+		c.Render.JSON(w, http.StatusNotFound,
+			ApiErr(ERR_FILE_NOT_FOUND, "There is no file by that name"))
+		return
+	}
+
+	for _, f := range files {
+		// Delete the data blob
+		fn := f.BlobFilename()
+		if err = c.Blob.Delete(fn); err != nil {
+			clog.WithFields(log.Fields{
+				"err":                  err,
+				"delete_blob_filename": fn,
+			}).Error("Could not delete file from blob storage")
+			c.Render.JSON(w, http.StatusBadGateway,
+				ApiErr(ERR_UNAVAILABLE, "Could not delete that file, please try again soon"))
+			return
+		}
+
+		// Then delete the database row
+		if err = c.Api.File.Delete(f.Id); err != nil {
+			clog.WithFields(log.Fields{
+				"err":            err,
+				"delete_file_id": f.Id,
+			}).Error("Could not delete file object")
+			c.Render.JSON(w, http.StatusBadGateway,
+				ApiErr(ERR_UNAVAILABLE, "Could not delete that file, please try again soon"))
+			return
+		}
+	}
+
+	// Clean up any retention policy for this filename
+	policy, err := c.Api.FilePolicy.ByModelIdFilename(m.Id, filename)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up file policy")
+	} else if policy != nil {
+		if err = c.Api.FilePolicy.Delete(policy.Id); err != nil {
+			clog.WithField("err", err).Error("Could not delete file policy")
+		}
+	}
+
+	// Take it out of its group, so the rest of the group can still commit
+	if err = c.Api.FileGroup.RemoveFilename(m.Id, filename); err != nil {
+		clog.WithField("err", err).Error("Could not remove file from its group")
+	}
+
+	clog.WithField("deleted_versions", len(files)).Info("File deleted")
+	audit(c, req, c.User.Id, c.User.Id, models.AUDIT_FILE_DELETE, "model", m.Id,
+		map[string]interface{}{
+			"filename":         filename,
+			"deleted_versions": len(files),
+		})
+
+	// Return success
+	c.Render.JSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
@@ -0,0 +1,82 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+func HandleDeleteFileGroup(c *Context, w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+
+	username := c.Params.ByName("username")
+	slug := c.Params.ByName("slug")
+	name := c.Params.ByName("name")
+
+	clog := c.Log().WithFields(log.Fields{
+		"user_id":    c.User.Id,
+		"username":   username,
+		"model_slug": slug,
+		"group_name": name,
+	})
+
+	// First let's look up the user by their username
+	user, err := c.Api.User.ByUsername(username)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up user by username")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not delete that file group, please try again soon"))
+		return
+	}
+	if err == sql.ErrNoRows || user == nil {
+		c.Render.JSON(w, http.StatusNotFound,
+			ApiErr(ERR_USER_NOT_FOUND, "No user by that username could be found"))
+		return
+	}
+
+	clog = clog.WithField("model_user_id", user.Id)
+
+	// Now we get the model
+	m, err := c.Api.Model.ByUserIdSlug(user.Id, slug)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up model by username & slug")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not delete that file group, please try again soon"))
+		return
+	}
+	if err == sql.ErrNoRows || m == nil {
+		c.Render.JSON(w, http.StatusNotFound,
+			ApiErr(ERR_MODEL_NOT_FOUND, "No model by that username and slug could be found"))
+		return
+	}
+	if !authorize(c, w, m, ACTION_WRITE,
+		"You're only allowed to change file groups for your own models") {
+		return
+	}
+
+	clog = clog.WithField("model_id", m.Id)
+
+	group, err := c.Api.FileGroup.ByModelIdName(m.Id, name)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up file group")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not delete that file group, please try again soon"))
+		return
+	}
+	if group == nil {
+		c.Render.JSON(w, http.StatusNotFound,
+			ApiErr(ERR_NOT_FOUND, "There is no file group by that name"))
+		return
+	}
+
+	if err = c.Api.FileGroup.Delete(group.Id); err != nil {
+		clog.WithField("err", err).Error("Could not delete file group")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not delete that file group, please try again soon"))
+		return
+	}
+
+	// Return success
+	c.Render.JSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
@@ -0,0 +1,82 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+func HandleDeleteFilePolicy(c *Context, w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+
+	username := c.Params.ByName("username")
+	slug := c.Params.ByName("slug")
+	filename := c.Params.ByName("filename")
+
+	clog := c.Log().WithFields(log.Fields{
+		"user_id":    c.User.Id,
+		"username":   username,
+		"model_slug": slug,
+		"filename":   filename,
+	})
+
+	// First let's look up the user by their username
+	user, err := c.Api.User.ByUsername(username)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up user by username")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not delete that file policy, please try again soon"))
+		return
+	}
+	if err == sql.ErrNoRows || user == nil {
+		c.Render.JSON(w, http.StatusNotFound,
+			ApiErr(ERR_USER_NOT_FOUND, "No user by that username could be found"))
+		return
+	}
+
+	clog = clog.WithField("model_user_id", user.Id)
+
+	// Now we get the model
+	m, err := c.Api.Model.ByUserIdSlug(user.Id, slug)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up model by username & slug")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not delete that file policy, please try again soon"))
+		return
+	}
+	if err == sql.ErrNoRows || m == nil {
+		c.Render.JSON(w, http.StatusNotFound,
+			ApiErr(ERR_MODEL_NOT_FOUND, "No model by that username and slug could be found"))
+		return
+	}
+	if !authorize(c, w, m, ACTION_WRITE,
+		"You're only allowed to change file policies for your own models") {
+		return
+	}
+
+	clog = clog.WithField("model_id", m.Id)
+
+	policy, err := c.Api.FilePolicy.ByModelIdFilename(m.Id, filename)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up file policy")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not delete that file policy, please try again soon"))
+		return
+	}
+	if policy == nil {
+		c.Render.JSON(w, http.StatusNotFound,
+			ApiErr(ERR_NOT_FOUND, "There is no policy for a file by that name"))
+		return
+	}
+
+	if err = c.Api.FilePolicy.Delete(policy.Id); err != nil {
+		clog.WithField("err", err).Error("Could not delete file policy")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not delete that file policy, please try again soon"))
+		return
+	}
+
+	// Return success
+	c.Render.JSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
@@ -0,0 +1,64 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/models"
+)
+
+func HandleDeleteFileShare(c *Context, w http.ResponseWriter, req *http.Request) {
+	id := c.Params.ByName("id")
+
+	clog := c.Log().WithFields(log.Fields{
+		"user_id":       c.User.Id,
+		"file_share_id": id,
+	})
+
+	share, err := c.Api.FileShare.ById(id)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up file share")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not revoke that share, please try again soon"))
+		return
+	}
+	if err == sql.ErrNoRows || share == nil {
+		c.Render.JSON(w, http.StatusNotFound,
+			ApiErr(ERR_NOT_FOUND, "There is no share with that id"))
+		return
+	}
+
+	clog = clog.WithField("file_model_id", share.ModelId)
+
+	m, err := c.Api.Model.ById(share.ModelId)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up model by id")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not revoke that share, please try again soon"))
+		return
+	}
+	if err == sql.ErrNoRows || m == nil {
+		c.Render.JSON(w, http.StatusNotFound,
+			ApiErr(ERR_NOT_FOUND, "There is no share with that id"))
+		return
+	}
+	if !authorize(c, w, m, ACTION_MANAGE,
+		"You're only allowed to revoke shares of your own files") {
+		return
+	}
+
+	if err = c.Api.FileShare.Delete(share.Id); err != nil {
+		clog.WithField("err", err).Error("Could not delete file share")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not revoke that share, please try again soon"))
+		return
+	}
+
+	clog.Info("File share revoked")
+
+	audit(c, req, c.User.Id, m.UserId, models.AUDIT_FILE_SHARE_DELETE,
+		"file_share", share.Id, map[string]interface{}{"file_id": share.FileId})
+
+	c.Render.JSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
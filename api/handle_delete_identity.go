@@ -0,0 +1,58 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/models"
+)
+
+func HandleDeleteIdentity(c *Context, w http.ResponseWriter, req *http.Request) {
+	id := c.Params.ByName("id")
+
+	clog := c.Log().WithFields(log.Fields{
+		"identity_id": id,
+		"user_id":     c.User.Id,
+	})
+
+	idents, err := c.Api.UserIdentity.ByUserId(c.User.Id)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not get identities")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not unlink that account, please try again soon"))
+		return
+	}
+
+	found := false
+	for _, ident := range idents {
+		if ident.Id == id {
+			found = true
+		}
+	}
+	if !found {
+		c.Render.JSON(w, http.StatusNotFound,
+			ApiErr(ERR_NOT_FOUND, "Could not find that linked account"))
+		return
+	}
+
+	// Don't let people lock themselves out
+	if len(idents) == 1 && !c.User.HasPassword() {
+		c.Render.JSON(w, http.StatusBadRequest,
+			ApiErr(ERR_INVALID_STATE, "You must set a password or link another account before "+
+				"unlinking your only way to sign in"))
+		return
+	}
+
+	if err = c.Api.UserIdentity.Delete(id); err != nil {
+		clog.WithField("err", err).Error("Could not delete identity")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not unlink that account, please try again soon"))
+		return
+	}
+
+	audit(c, req, c.User.Id, c.User.Id, models.AUDIT_OAUTH_UNLINK,
+		"user_identity", id, nil)
+
+	c.Render.JSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
@@ -0,0 +1,74 @@
+package api
+
+import (
+	"net/http"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/models"
+)
+
+// HandleDeleteIpAllowlistEntry takes a network out of the organization's
+// allowlist.  Like adding one, only the owner can, and not in a way that
+// would lock them out.
+func HandleDeleteIpAllowlistEntry(c *Context, w http.ResponseWriter, req *http.Request) {
+	id := c.Params.ByName("id")
+
+	clog := c.Log().WithFields(log.Fields{
+		"user_id":         c.User.Id,
+		"ip_allowlist_id": id,
+	})
+
+	org, err := userOrganization(c.Api, c.User.Id)
+	if err != nil {
+		clog.WithField("err", err).Error("Could not look up organization")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not update your organization's IP allowlist, please try again soon"))
+		return
+	}
+	if org == nil || org.OwnerId != c.User.Id {
+		c.Render.JSON(w, http.StatusUnauthorized,
+			ApiErr(ERR_FORBIDDEN, "Only an organization's owner can change its IP allowlist"))
+		return
+	}
+
+	clog = clog.WithField("organization_id", org.Id)
+
+	entries, err := c.Api.IpAllowlist.ByOrganizationId(org.Id)
+	if err != nil {
+		clog.WithField("err", err).Error("Could not get ip allowlist")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not update your organization's IP allowlist, please try again soon"))
+		return
+	}
+	var entry *models.IpAllowlistEntry
+	remaining := []*models.IpAllowlistEntry{}
+	for _, e := range entries {
+		if e.Id == id {
+			entry = e
+		} else {
+			remaining = append(remaining, e)
+		}
+	}
+	if entry == nil {
+		c.Render.JSON(w, http.StatusNotFound,
+			ApiErr(ERR_NOT_FOUND, "Could not find that allowlist entry"))
+		return
+	}
+	if ip := clientIp(req); !models.IpAllowed(remaining, ip) {
+		c.Render.JSON(w, http.StatusBadRequest,
+			ApiErr(ERR_INVALID_STATE, "That would lock you out, since you're using "+ip+"; allow it first"))
+		return
+	}
+
+	if err = c.Api.IpAllowlist.Delete(entry.Id); err != nil {
+		clog.WithField("err", err).Error("Could not delete ip allowlist entry")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not update your organization's IP allowlist, please try again soon"))
+		return
+	}
+
+	audit(c, req, c.User.Id, c.User.Id, models.AUDIT_IP_ALLOWLIST_DELETE,
+		"ip_allowlist", entry.Id, map[string]interface{}{"cidr": entry.Cidr})
+
+	c.Render.JSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
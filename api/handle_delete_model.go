@@ -5,6 +5,7 @@ import (
 	"net/http"
 
 	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/models"
 )
 
 func HandleDeleteModel(c *Context, w http.ResponseWriter, req *http.Request) {
@@ -12,7 +13,7 @@ func HandleDeleteModel(c *Context, w http.ResponseWriter, req *http.Request) {
 
 	modelId := c.Params.ByName("id")
 
-	clog := log.WithFields(log.Fields{
+	clog := c.Log().WithFields(log.Fields{
 		"user_id":  c.User.Id,
 		"model_id": modelId,
 	})
@@ -21,17 +22,16 @@ func HandleDeleteModel(c *Context, w http.ResponseWriter, req *http.Request) {
 	if err != nil && err != sql.ErrNoRows {
 		clog.WithField("err", err).Error("Could not look up model by id")
 		c.Render.JSON(w, http.StatusBadGateway,
-			JsonErr("Could not delete that model, please try again soon"))
+			ApiErr(ERR_UNAVAILABLE, "Could not delete that model, please try again soon"))
 		return
 	}
 	if m == nil || err == sql.ErrNoRows {
 		c.Render.JSON(w, http.StatusNotFound,
-			JsonErr("No model with that id was found"))
+			ApiErr(ERR_MODEL_NOT_FOUND, "No model with that id was found"))
 		return
 	}
-	if m.UserId != c.User.Id {
-		c.Render.JSON(w, http.StatusUnauthorized,
-			JsonErr("You're only allowed to delete your own models"))
+	if !authorize(c, w, m, ACTION_MANAGE,
+		"You're only allowed to delete your own models") {
 		return
 	}
 
@@ -40,7 +40,7 @@ func HandleDeleteModel(c *Context, w http.ResponseWriter, req *http.Request) {
 	if err != nil && err != sql.ErrNoRows {
 		clog.WithField("err", err).Error("Could not delete old files")
 		c.Render.JSON(w, http.StatusBadGateway,
-			JsonErr("Could not delete that model, please try again soon"))
+			ApiErr(ERR_UNAVAILABLE, "Could not delete that model, please try again soon"))
 		return
 	}
 
@@ -53,7 +53,7 @@ func HandleDeleteModel(c *Context, w http.ResponseWriter, req *http.Request) {
 				"delete_blob_filename": fn,
 			}).Error("Could not delete old file from blob storage")
 			c.Render.JSON(w, http.StatusBadGateway,
-				JsonErr("Could not delete that model, please try again soon"))
+				ApiErr(ERR_UNAVAILABLE, "Could not delete that model, please try again soon"))
 			return
 		}
 
@@ -64,7 +64,7 @@ func HandleDeleteModel(c *Context, w http.ResponseWriter, req *http.Request) {
 				"delete_file_id": f.Id,
 			}).Error("Could not delete old file object")
 			c.Render.JSON(w, http.StatusBadGateway,
-				JsonErr("Could not delete that model, please try again soon"))
+				ApiErr(ERR_UNAVAILABLE, "Could not delete that model, please try again soon"))
 			return
 		}
 	}
@@ -73,10 +73,13 @@ func HandleDeleteModel(c *Context, w http.ResponseWriter, req *http.Request) {
 	if err = c.Api.Model.Delete(m.Id); err != nil {
 		clog.WithField("err", err).Error("Could not save model")
 		c.Render.JSON(w, http.StatusBadGateway,
-			JsonErr("Could not delete your model, please try again soon"))
+			ApiErr(ERR_UNAVAILABLE, "Could not delete your model, please try again soon"))
 		return
 	}
 
+	audit(c, req, c.User.Id, c.User.Id, models.AUDIT_MODEL_DELETE, "model",
+		m.Id, map[string]interface{}{"slug": m.Slug})
+
 	// Return success
 	c.Render.JSON(w, http.StatusOK, map[string]string{"status": "ok"})
 }
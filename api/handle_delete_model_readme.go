@@ -0,0 +1,68 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+func HandleDeleteModelReadme(c *Context, w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+
+	modelId := c.Params.ByName("id")
+	language := c.Params.ByName("language")
+
+	clog := c.Log().WithFields(log.Fields{
+		"user_id":  c.User.Id,
+		"model_id": modelId,
+		"language": language,
+	})
+
+	m, err := c.Api.Model.ById(modelId)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up model by id")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not delete that translation, please try again soon"))
+		return
+	}
+	if m == nil || err == sql.ErrNoRows {
+		c.Render.JSON(w, http.StatusNotFound,
+			ApiErr(ERR_MODEL_NOT_FOUND, "No model with that id was found"))
+		return
+	}
+	if !authorize(c, w, m, ACTION_WRITE,
+		"You're only allowed to update the readme for your own models") {
+		return
+	}
+
+	// The readme itself can be replaced, but not deleted
+	if language == m.ReadmeLanguage {
+		c.Render.JSON(w, http.StatusBadRequest,
+			ApiErr(ERR_INVALID_REQUEST, "That's the language of the model's readme, not a translation"))
+		return
+	}
+
+	r, err := c.Api.ModelReadme.Get(m.Id, language)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up readme translation")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not delete that translation, please try again soon"))
+		return
+	}
+	if r == nil || err == sql.ErrNoRows {
+		c.Render.JSON(w, http.StatusNotFound,
+			ApiErr(ERR_NOT_FOUND, "There is no translation into that language"))
+		return
+	}
+
+	if err = c.Api.ModelReadme.Remove(m.Id, language); err != nil {
+		clog.WithField("err", err).Error("Could not delete readme translation")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not delete that translation, please try again soon"))
+		return
+	}
+
+	// Return success
+	c.Render.JSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
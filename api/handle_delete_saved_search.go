@@ -0,0 +1,29 @@
+package api
+
+import (
+	"net/http"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/models"
+)
+
+func HandleDeleteSavedSearch(c *Context, w http.ResponseWriter, req *http.Request) {
+	clog := c.Log().WithFields(log.Fields{
+		"saved_search_id": c.Params.ByName("id"),
+		"auth_user_id":    c.User.Id,
+	})
+
+	s := ownSavedSearch(c, w, clog)
+	if s == nil {
+		return
+	}
+
+	if err := c.Api.SavedSearch.Delete(s.Id); err != nil {
+		clog.WithField("err", err).Error("Could not delete saved search")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not delete your saved search, please try again soon"))
+		return
+	}
+
+	c.Render.JSON(w, http.StatusOK, map[string]*models.SavedSearch{"saved_search": s})
+}
@@ -0,0 +1,37 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/ericflo/gradientzoo/models"
+)
+
+func HandleDeleteSecurityWebhook(c *Context, w http.ResponseWriter, req *http.Request) {
+	clog := c.Log().WithField("user_id", c.User.Id)
+
+	hook, err := c.Api.SecurityWebhook.ByUserId(c.User.Id)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up security webhook")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not delete your webhook, please try again soon"))
+		return
+	}
+	if hook == nil {
+		c.Render.JSON(w, http.StatusOK, map[string]string{"status": "ok"})
+		return
+	}
+
+	if err = c.Api.SecurityWebhook.Delete(hook.Id); err != nil {
+		clog.WithField("err", err).Error("Could not delete security webhook")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not delete your webhook, please try again soon"))
+		return
+	}
+
+	clog.WithField("security_webhook_id", hook.Id).Info("Deleted security webhook")
+	audit(c, req, c.User.Id, c.User.Id, models.AUDIT_SECURITY_HOOK_DELETE,
+		"security_webhook", hook.Id, map[string]interface{}{"url": hook.Url})
+
+	c.Render.JSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
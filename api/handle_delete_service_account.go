@@ -0,0 +1,35 @@
+package api
+
+import (
+	"net/http"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/models"
+)
+
+func HandleDeleteServiceAccount(c *Context, w http.ResponseWriter, req *http.Request) {
+	service := serviceAccountFor(c, w, c.Params.ByName("id"))
+	if service == nil {
+		return
+	}
+
+	clog := c.Log().WithFields(log.Fields{
+		"user_id":            c.User.Id,
+		"service_account_id": service.Id,
+	})
+
+	// Unlike people, service accounts are deleted right away, along with
+	// their models and files
+	if err := deleteAccount(c.Api, c.Blob, service); err != nil {
+		clog.WithField("err", err).Error("Could not delete service account")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not delete that service account, please try again soon"))
+		return
+	}
+
+	clog.Info("Service account deleted")
+	audit(c, req, c.User.Id, c.User.Id, models.AUDIT_SERVICE_ACCT_DELETE, "user",
+		service.Id, map[string]interface{}{"username": service.Username})
+
+	c.Render.JSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
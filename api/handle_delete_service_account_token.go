@@ -0,0 +1,11 @@
+package api
+
+import (
+	"net/http"
+)
+
+func HandleDeleteServiceAccountToken(c *Context, w http.ResponseWriter, req *http.Request) {
+	if service := serviceAccountFor(c, w, c.Params.ByName("id")); service != nil {
+		deleteApiToken(c, w, req, service, c.Params.ByName("token_id"))
+	}
+}
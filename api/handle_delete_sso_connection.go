@@ -0,0 +1,43 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/models"
+)
+
+func HandleDeleteSsoConnection(c *Context, w http.ResponseWriter, req *http.Request) {
+	id := c.Params.ByName("id")
+
+	clog := c.Log().WithFields(log.Fields{
+		"user_id":           c.User.Id,
+		"sso_connection_id": id,
+	})
+
+	conn, err := c.Api.SsoConnection.ById(id)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up sso connection")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not delete that sso connection, please try again soon"))
+		return
+	}
+	if err == sql.ErrNoRows || conn == nil {
+		c.Render.JSON(w, http.StatusNotFound,
+			ApiErr(ERR_NOT_FOUND, "Could not find that sso connection"))
+		return
+	}
+
+	if err = c.Api.SsoConnection.Delete(conn.Id); err != nil {
+		clog.WithField("err", err).Error("Could not delete sso connection")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not delete that sso connection, please try again soon"))
+		return
+	}
+
+	audit(c, req, c.User.Id, "", models.AUDIT_SSO_CONNECTION_DELETE,
+		"sso_connection", conn.Id, map[string]interface{}{"domain": conn.Domain})
+
+	c.Render.JSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
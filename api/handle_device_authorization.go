@@ -0,0 +1,40 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/models"
+)
+
+// deviceAuthorizationFor looks up the pending authorization a user code is
+// for, responding and returning nil if there isn't one.
+func deviceAuthorizationFor(c *Context, w http.ResponseWriter, userCode string) *models.DeviceAuthorization {
+	userCode = models.NormalizeUserCode(userCode)
+
+	d, err := c.Api.DeviceAuthorization.ByUserCode(userCode)
+	if err != nil && err != sql.ErrNoRows {
+		c.Log().WithFields(log.Fields{
+			"err":     err,
+			"user_id": c.User.Id,
+		}).Error("Could not look up device authorization")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not look up that code, please try again soon"))
+		return nil
+	}
+	if d == nil || d.Expired() || d.Status != models.DEVICE_PENDING {
+		c.Render.JSON(w, http.StatusNotFound,
+			ApiErr(ERR_EXPIRED, "That code is not valid or has expired"))
+		return nil
+	}
+	return d
+}
+
+func HandleDeviceAuthorization(c *Context, w http.ResponseWriter, req *http.Request) {
+	d := deviceAuthorizationFor(c, w, c.Params.ByName("user_code"))
+	if d == nil {
+		return
+	}
+	c.Render.JSON(w, http.StatusOK, map[string]*models.DeviceAuthorization{"device": d})
+}
@@ -0,0 +1,76 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/ericflo/gradientzoo/models"
+	"github.com/ericflo/gradientzoo/utils"
+)
+
+type DeviceAuthorizeForm struct {
+	ClientName string   `json:"client_name"`
+	Scopes     []string `json:"scopes"`
+}
+
+func HandleDeviceAuthorize(c *Context, w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+
+	// Parse the JSON POST body
+	var form DeviceAuthorizeForm
+	if !decodeForm(c, w, req, c.Log().WithField("path", req.URL.Path), "device", &form) {
+		return
+	}
+
+	form.ClientName = strings.TrimSpace(form.ClientName)
+	if form.ClientName == "" {
+		form.ClientName = "Gradientzoo client"
+	}
+	if len(form.ClientName) > MaxApiTokenNameLength {
+		c.Render.JSON(w, http.StatusBadRequest,
+			ApiErr(ERR_INVALID_REQUEST, "Client names must be at most 100 characters"))
+		return
+	}
+	// Clients that don't say otherwise get what the command line client needs
+	if len(form.Scopes) == 0 {
+		form.Scopes = []string{models.SCOPE_READ, models.SCOPE_UPLOAD}
+	}
+	for _, scope := range form.Scopes {
+		if !models.ValidScope(scope) {
+			c.Render.JSON(w, http.StatusBadRequest,
+				ApiErr(ERR_INVALID_REQUEST, "Scopes must be some of 'read', 'upload', 'admin'"))
+			return
+		}
+	}
+
+	clog := c.Log().WithField("client_name", form.ClientName)
+
+	// Nothing else cleans these up, and this is when new ones pile in
+	if err := c.Api.DeviceAuthorization.DeleteExpired(); err != nil {
+		clog.WithField("err", err).Error("Could not delete expired device authorizations")
+	}
+
+	d, err := models.NewDeviceAuthorization(form.ClientName, form.Scopes)
+	if err == nil {
+		err = c.Api.DeviceAuthorization.Save(d)
+	}
+	if err != nil {
+		clog.WithField("err", err).Error("Could not save device authorization")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not start signing in, please try again soon"))
+		return
+	}
+
+	verificationUri := utils.Conf.WwwUrl + "/device"
+	c.Render.JSON(w, http.StatusOK, map[string]interface{}{
+		"device_code":      d.Id,
+		"user_code":        d.UserCode,
+		"verification_uri": verificationUri,
+		"verification_uri_complete": fmt.Sprintf("%s?code=%s", verificationUri,
+			url.QueryEscape(d.UserCode)),
+		"expires_in": int(models.DEVICE_AUTHORIZATION_TTL.Seconds()),
+		"interval":   int(models.DEVICE_POLL_INTERVAL.Seconds()),
+	})
+}
@@ -0,0 +1,106 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/ericflo/gradientzoo/models"
+	"gopkg.in/guregu/null.v3"
+)
+
+type DeviceTokenForm struct {
+	DeviceCode string `json:"device_code"`
+}
+
+// HandleDeviceToken answers the client's polls with the errors from the OAuth
+// device flow until the user approves it, and then with an API token.
+func HandleDeviceToken(c *Context, w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+
+	// Parse the JSON POST body
+	var form DeviceTokenForm
+	if !decodeForm(c, w, req, c.Log().WithField("path", req.URL.Path), "device token", &form) {
+		return
+	}
+
+	d, err := c.Api.DeviceAuthorization.ById(form.DeviceCode)
+	if err != nil && err != sql.ErrNoRows {
+		c.Log().WithField("err", err).Error("Could not look up device authorization")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not sign you in, please try again soon"))
+		return
+	}
+	if d == nil || d.Expired() {
+		c.Render.JSON(w, http.StatusBadRequest, ApiErr(ERR_EXPIRED_TOKEN, "expired_token"))
+		return
+	}
+
+	clog := c.Log().WithField("device_user_code", d.UserCode)
+
+	switch d.Status {
+	case models.DEVICE_DENIED:
+		if err = c.Api.DeviceAuthorization.Delete(d.Id); err != nil {
+			clog.WithField("err", err).Error("Could not delete device authorization")
+		}
+		c.Render.JSON(w, http.StatusBadRequest, ApiErr(ERR_ACCESS_DENIED, "access_denied"))
+		return
+	case models.DEVICE_PENDING:
+		tooSoon := d.LastPollTime.Valid &&
+			time.Since(d.LastPollTime.Time) < models.DEVICE_POLL_INTERVAL
+		d.LastPollTime = null.TimeFrom(time.Now().UTC())
+		if err = c.Api.DeviceAuthorization.Save(d); err != nil {
+			clog.WithField("err", err).Error("Could not save device authorization")
+		}
+		if tooSoon {
+			c.Render.JSON(w, http.StatusBadRequest, ApiErr(ERR_SLOW_DOWN, "slow_down"))
+		} else {
+			c.Render.JSON(w, http.StatusBadRequest, ApiErr(ERR_AUTHORIZATION_PENDING, "authorization_pending"))
+		}
+		return
+	}
+
+	// Approved, so trade it in, exactly once
+	d, err = c.Api.DeviceAuthorization.Claim(d.Id)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not claim device authorization")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not sign you in, please try again soon"))
+		return
+	}
+	if d == nil {
+		c.Render.JSON(w, http.StatusBadRequest, ApiErr(ERR_EXPIRED_TOKEN, "expired_token"))
+		return
+	}
+
+	clog = clog.WithField("user_id", d.UserId.String)
+
+	user, err := c.Api.User.ById(d.UserId.String)
+	if err != nil {
+		clog.WithField("err", err).Error("Could not look up user")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not sign you in, please try again soon"))
+		return
+	}
+
+	authToken := models.NewApiToken(user.Id, d.ClientName, d.Scopes, nil)
+	if err = c.Api.AuthToken.Save(authToken); err != nil {
+		clog.WithField("err", err).Error("Could not save api token")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not sign you in, please try again soon"))
+		return
+	}
+
+	clog.Info("Api token created through device authorization")
+	audit(c, req, user.Id, user.Id, models.AUDIT_TOKEN_CREATE, "auth_token",
+		authToken.Id, map[string]interface{}{
+			"name":   authToken.Name,
+			"scopes": authToken.Scopes,
+			"device": true,
+		})
+
+	c.Render.JSON(w, http.StatusOK, map[string]interface{}{
+		"token":    authToken,
+		"username": user.Username,
+	})
+}
@@ -0,0 +1,56 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/ericflo/gradientzoo/models"
+)
+
+func HandleDisableTwoFactor(c *Context, w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+
+	// Parse the JSON POST body
+	var form TwoFactorForm
+	if !decodeForm(c, w, req, c.Log().WithField("path", req.URL.Path), "two-factor", &form) {
+		return
+	}
+
+	clog := c.Log().WithField("user_id", c.User.Id)
+
+	if !c.User.TotpEnabled {
+		c.Render.JSON(w, http.StatusBadRequest,
+			ApiErr(ERR_INVALID_STATE, "Two-factor authentication is not enabled"))
+		return
+	}
+
+	// A stolen session alone shouldn't be enough to turn this off
+	ok, err := checkSecondFactor(c, c.User, form.Code)
+	if err != nil {
+		clog.WithField("err", err).Error("Could not check two-factor code")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not disable two-factor authentication, please try again soon"))
+		return
+	}
+	if !ok {
+		c.Render.JSON(w, http.StatusUnauthorized,
+			ApiErr(ERR_INVALID_CREDENTIALS, "That code is not correct"))
+		return
+	}
+
+	c.User.TotpEnabled = false
+	c.User.TotpSecret = ""
+	if err = c.Api.User.Save(c.User); err != nil {
+		clog.WithField("err", err).Error("Could not save user")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not disable two-factor authentication, please try again soon"))
+		return
+	}
+	if err = c.Api.BackupCode.DeleteByUserId(c.User.Id); err != nil {
+		clog.WithField("err", err).Error("Could not delete backup codes")
+	}
+
+	clog.Info("Disabled two-factor authentication")
+	audit(c, req, c.User.Id, c.User.Id, models.AUDIT_TWO_FACTOR_DISABLE, "", "", nil)
+
+	c.Render.JSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
@@ -0,0 +1,42 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+func HandleDownloadAlert(c *Context, w http.ResponseWriter, req *http.Request) {
+	clog := c.Log().WithFields(log.Fields{
+		"username":     c.Params.ByName("username"),
+		"slug":         c.Params.ByName("slug"),
+		"auth_user_id": c.User.Id,
+	})
+
+	m := accessModel(c, w, clog)
+	if m == nil {
+		return
+	}
+	if !authorize(c, w, m, ACTION_MANAGE,
+		"You don't have permission to manage this model's alerts") {
+		return
+	}
+
+	clog = clog.WithField("model_id", m.Id)
+
+	alert, err := c.Api.DownloadAlert.ByModelId(m.Id)
+	if err == sql.ErrNoRows {
+		c.Render.JSON(w, http.StatusNotFound,
+			ApiErr(ERR_NOT_FOUND, "This model doesn't have a download alert"))
+		return
+	}
+	if err != nil {
+		clog.WithField("err", err).Error("Could not look up download alert")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not get the download alert, please try again soon"))
+		return
+	}
+
+	c.Render.JSON(w, http.StatusOK, map[string]interface{}{"download_alert": alert})
+}
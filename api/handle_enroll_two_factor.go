@@ -0,0 +1,39 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/ericflo/gradientzoo/utils"
+)
+
+func HandleEnrollTwoFactor(c *Context, w http.ResponseWriter, req *http.Request) {
+	clog := c.Log().WithField("user_id", c.User.Id)
+
+	if c.User.TotpEnabled {
+		c.Render.JSON(w, http.StatusBadRequest,
+			ApiErr(ERR_INVALID_STATE, "Two-factor authentication is already enabled"))
+		return
+	}
+
+	// The secret isn't used for signing in until it's confirmed with a code,
+	// so enrolling again just starts over with a new one
+	secret, err := utils.NewTotpSecret()
+	if err != nil {
+		clog.WithField("err", err).Error("Could not make totp secret")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not set up two-factor authentication, please try again soon"))
+		return
+	}
+	c.User.TotpSecret = secret
+	if err = c.Api.User.Save(c.User); err != nil {
+		clog.WithField("err", err).Error("Could not save user")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not set up two-factor authentication, please try again soon"))
+		return
+	}
+
+	c.Render.JSON(w, http.StatusOK, map[string]string{
+		"secret": secret,
+		"uri":    utils.TotpUri(totpIssuer, c.User.Username, secret),
+	})
+}
@@ -0,0 +1,214 @@
+package api
+
+import (
+	"compress/gzip"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/models"
+)
+
+// The columns that come before the flattened metadata in every export
+var fileHistoryColumns = []string{
+	"id",
+	"filename",
+	"framework",
+	"framework_version",
+	"client_name",
+	"status",
+	"size_bytes",
+	"sha256",
+	"created_time",
+	"downloads",
+	"downloaders",
+}
+
+func HandleExportFileHistory(c *Context, w http.ResponseWriter, req *http.Request) {
+	username := c.Params.ByName("username")
+	slug := c.Params.ByName("slug")
+	format := req.URL.Query().Get("format")
+	useGzip := req.URL.Query().Get("gzip") == "true"
+
+	fields := log.Fields{
+		"username": username,
+		"slug":     slug,
+		"format":   format,
+		"gzip":     useGzip,
+	}
+	if c.User != nil {
+		fields["auth_user_id"] = c.User.Id
+	}
+	clog := c.Log().WithFields(fields)
+
+	// Validation
+	if format == "" {
+		format = "csv"
+	}
+	var since, until time.Time
+	v := NewValidator()
+	v.Field("format", "Format").OneOf(format, "csv", "jsonl")
+	v.Field("since", "Since").Time(req.URL.Query().Get("since"), &since)
+	v.Field("until", "Until").Time(req.URL.Query().Get("until"), &until)
+	if v.Refuse(c, w) {
+		return
+	}
+
+	user, err := c.Api.User.ByUsername(username)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up user by username")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not export that file history, please try again soon"))
+		return
+	}
+	if err == sql.ErrNoRows || user == nil {
+		c.Render.JSON(w, http.StatusNotFound,
+			ApiErr(ERR_USER_NOT_FOUND, "No user by that username could be found"))
+		return
+	}
+
+	clog = clog.WithField("user_id", user.Id)
+
+	m, err := c.Api.Model.ByUserIdSlug(user.Id, slug)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up model by username & slug")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not export that file history, please try again soon"))
+		return
+	}
+	if err == sql.ErrNoRows || m == nil {
+		c.Render.JSON(w, http.StatusNotFound, ApiErr(ERR_MODEL_NOT_FOUND, "That model was not found"))
+		return
+	}
+	if !authorize(c, w, m, ACTION_READ,
+		"You don't have permission to access this model") {
+		return
+	}
+
+	clog = clog.WithField("model_id", m.Id)
+
+	files, err := c.Api.File.History(m.Id, since, until)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up file history")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not export that file history, please try again soon"))
+		return
+	}
+
+	// Hydrate the file objects
+	if err = c.Api.File.Hydrate(files); err != nil {
+		clog.WithField("err", err).Error("Could not hydrate files")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not export that file history, please try again soon"))
+		return
+	}
+
+	// Flatten all of the metadata up front, since a CSV header has to list
+	// every metadata key that any version uses
+	flattened := make([]map[string]interface{}, len(files))
+	keySet := map[string]bool{}
+	for i, f := range files {
+		flattened[i] = models.FlattenMetadata(f.Metadata)
+		for k := range flattened[i] {
+			keySet[k] = true
+		}
+	}
+	keys := make([]string, 0, len(keySet))
+	for k := range keySet {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	attachment := fmt.Sprintf("%s-%s-files.%s", user.Username, m.Slug, format)
+	contentType := "text/csv; charset=utf-8"
+	if format == "jsonl" {
+		contentType = "application/x-ndjson; charset=utf-8"
+	}
+	var out io.Writer = w
+	if useGzip {
+		attachment += ".gz"
+		contentType = "application/gzip"
+		gz := gzip.NewWriter(w)
+		defer gz.Close()
+		out = gz
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition",
+		fmt.Sprintf("attachment; filename=%q", attachment))
+	w.WriteHeader(http.StatusOK)
+
+	if format == "jsonl" {
+		enc := json.NewEncoder(out)
+		for i, f := range files {
+			row := map[string]interface{}{
+				"id":                f.Id,
+				"filename":          f.Filename,
+				"framework":         f.Framework,
+				"framework_version": f.FrameworkVersion,
+				"client_name":       f.ClientName,
+				"status":            f.Status,
+				"size_bytes":        f.SizeBytes,
+				"sha256":            f.Sha256,
+				"created_time":      f.CreatedTime,
+				"downloads":         f.Downloads.All,
+				"downloaders":       f.Downloads.Downloaders,
+			}
+			for k, v := range flattened[i] {
+				row["metadata."+k] = v
+			}
+			if err = enc.Encode(row); err != nil {
+				clog.WithField("err", err).Error("Could not write file history")
+				return
+			}
+		}
+	} else {
+		cw := csv.NewWriter(out)
+		header := append([]string{}, fileHistoryColumns...)
+		for _, k := range keys {
+			header = append(header, "metadata."+k)
+		}
+		cw.Write(header)
+		for i, f := range files {
+			record := []string{
+				f.Id,
+				f.Filename,
+				f.Framework,
+				f.FrameworkVersion,
+				f.ClientName,
+				f.Status,
+				strconv.Itoa(f.SizeBytes),
+				f.Sha256,
+				f.CreatedTime.UTC().Format(time.RFC3339Nano),
+				strconv.Itoa(f.Downloads.All),
+				strconv.Itoa(f.Downloads.Downloaders),
+			}
+			for _, k := range keys {
+				// Strings are written as is, and anything else as JSON
+				switch v := flattened[i][k].(type) {
+				case nil:
+					record = append(record, "")
+				case string:
+					record = append(record, v)
+				default:
+					encoded, _ := json.Marshal(v)
+					record = append(record, string(encoded))
+				}
+			}
+			cw.Write(record)
+		}
+		cw.Flush()
+		if err = cw.Error(); err != nil {
+			clog.WithField("err", err).Error("Could not write file history")
+			return
+		}
+	}
+
+	clog.WithField("exported_versions", len(files)).Info("File history exported")
+}
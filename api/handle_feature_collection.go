@@ -0,0 +1,61 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/models"
+)
+
+type FeatureCollectionForm struct {
+	Featured bool `json:"featured"`
+}
+
+// HandleFeatureCollection lets admins put a public collection at the top of
+// the listing, or take it back off.
+func HandleFeatureCollection(c *Context, w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+
+	id := c.Params.ByName("id")
+
+	clog := c.Log().WithFields(log.Fields{
+		"auth_user_id":  c.User.Id,
+		"collection_id": id,
+	})
+
+	// Parse the JSON POST body
+	var form FeatureCollectionForm
+	if !decodeForm(c, w, req, clog, "feature", &form) {
+		return
+	}
+
+	collection, err := c.Api.Collection.ById(id)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up collection")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not feature that collection, please try again soon"))
+		return
+	}
+	if err == sql.ErrNoRows || collection == nil {
+		c.Render.JSON(w, http.StatusNotFound, ApiErr(ERR_NOT_FOUND, "That collection was not found"))
+		return
+	}
+	if form.Featured && collection.Visibility == "private" {
+		c.Render.JSON(w, http.StatusBadRequest,
+			ApiErr(ERR_INVALID_STATE, "Only public collections can be featured"))
+		return
+	}
+
+	collection.Featured = form.Featured
+	if err = c.Api.Collection.Save(collection); err != nil {
+		clog.WithField("err", err).Error("Could not save collection")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not feature that collection, please try again soon"))
+		return
+	}
+
+	clog.WithField("featured", collection.Featured).Info("Collection featuring changed")
+
+	c.Render.JSON(w, http.StatusOK, map[string]*models.Collection{"collection": collection})
+}
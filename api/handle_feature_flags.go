@@ -0,0 +1,23 @@
+package api
+
+import (
+	"net/http"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/models"
+)
+
+func HandleFeatureFlags(c *Context, w http.ResponseWriter, req *http.Request) {
+	flags, err := c.Api.FeatureFlag.All()
+	if err != nil {
+		c.Log().WithFields(log.Fields{
+			"err":     err,
+			"user_id": c.User.Id,
+		}).Error("Could not list feature flags")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not get feature flags, please try again soon"))
+		return
+	}
+
+	c.Render.JSON(w, http.StatusOK, map[string][]*models.FeatureFlag{"feature_flags": flags})
+}
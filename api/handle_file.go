@@ -3,7 +3,6 @@ package api
 import (
 	"database/sql"
 	"net/http"
-	"strings"
 	"time"
 
 	log "github.com/Sirupsen/logrus"
@@ -15,26 +14,31 @@ func HandleFile(c *Context, w http.ResponseWriter, req *http.Request) {
 	slug := c.Params.ByName("slug")
 	framework := c.Params.ByName("framework")
 	filename := c.Params.ByName("filename")
+	compatible := req.URL.Query().Get("compatible")
 
 	fields := log.Fields{
 		"file_username":   username,
 		"file_model_slug": slug,
 		"file_framework":  framework,
 		"filename":        filename,
+		"compatible":      compatible,
 	}
 	if c.User != nil {
 		fields["auth_user_id"] = c.User.Id
 	}
-	clog := log.WithFields(fields)
-
-	// Get the remote IP
-	var ip string
-	ips := strings.Split(req.Header.Get("X-Forwarded-For"), ", ")
-	if len(ips) > 0 {
-		ip = ips[0]
-	} else {
-		clog.Warn("X-Forwarded-For header not found, falling back to remote addr")
-		ip = req.RemoteAddr
+	clog := c.Log().WithFields(fields)
+
+	// Clients can ask for the latest version that works with their framework,
+	// e.g. ?compatible=keras<=1.2
+	var compatFramework string
+	var constraints []*models.VersionConstraint
+	if compatible != "" {
+		var err error
+		compatFramework, constraints, err = models.ParseFrameworkConstraint(compatible)
+		if err != nil {
+			c.Render.JSON(w, http.StatusBadRequest, ApiErr(ERR_INVALID_REQUEST, err.Error()))
+			return
+		}
 	}
 
 	// First let's look up the user by their username
@@ -42,13 +46,13 @@ func HandleFile(c *Context, w http.ResponseWriter, req *http.Request) {
 	if err != nil && err != sql.ErrNoRows {
 		clog.WithField("err", err).Error("Could not look up user by username")
 		c.Render.JSON(w, http.StatusBadGateway,
-			JsonErr("Could not get your file, please try again soon"))
+			ApiErr(ERR_UNAVAILABLE, "Could not get your file, please try again soon"))
 		return
 	}
 
 	if err == sql.ErrNoRows || user == nil {
 		c.Render.JSON(w, http.StatusNotFound,
-			JsonErr("No user by that username could be found"))
+			ApiErr(ERR_USER_NOT_FOUND, "No user by that username could be found"))
 		return
 	}
 
@@ -59,51 +63,98 @@ func HandleFile(c *Context, w http.ResponseWriter, req *http.Request) {
 	if err != nil && err != sql.ErrNoRows {
 		clog.WithField("err", err).Error("Could not look up model by username & slug")
 		c.Render.JSON(w, http.StatusBadGateway,
-			JsonErr("Could not get your file, please try again soon"))
+			ApiErr(ERR_UNAVAILABLE, "Could not get your file, please try again soon"))
 		return
 	}
 	if err == sql.ErrNoRows || user == nil {
 		c.Render.JSON(w, http.StatusNotFound,
-			JsonErr("No model by that username and slug could be found"))
+			ApiErr(ERR_MODEL_NOT_FOUND, "No model by that username and slug could be found"))
 		return
 	}
-	if m.Visibility == "private" && (c.User == nil || m.UserId != c.User.Id) {
-		c.Render.JSON(w, http.StatusUnauthorized,
-			JsonErr("You don't have permission to access this file"))
+	if !authorize(c, w, m, ACTION_READ,
+		"You don't have permission to access this file") {
 		return
 	}
 
 	clog = clog.WithField("file_model_id", m.Id)
 
 	// Get the latest file
-	f, err := c.Api.File.ByModelIdFilenameLatest(m.Id, filename)
-	if err != nil && err != sql.ErrNoRows {
-		clog.WithField("err", err).Error("Could not look up file")
-		c.Render.JSON(w, http.StatusBadGateway,
-			JsonErr("Could not get your file, please try again soon"))
+	var f *models.File
+	if compatible == "" {
+		f, err = c.Api.File.ByModelIdFilenameLatest(m.Id, filename)
+		if err != nil && err != sql.ErrNoRows {
+			clog.WithField("err", err).Error("Could not look up file")
+			c.Render.JSON(w, http.StatusBadGateway,
+				ApiErr(ERR_UNAVAILABLE, "Could not get your file, please try again soon"))
+			return
+		}
+		if err == sql.ErrNoRows || f == nil {
+			c.Render.JSON(w, http.StatusNotFound,
+				ApiErr(ERR_FILE_NOT_FOUND, "There is no file by that name"))
+			return
+		}
+	} else {
+		// Versions come back newest first, so the first match is the latest
+		files, err := c.Api.File.ByModelIdFilename(m.Id, filename)
+		if err != nil && err != sql.ErrNoRows {
+			clog.WithField("err", err).Error("Could not look up files by filename")
+			c.Render.JSON(w, http.StatusBadGateway,
+				ApiErr(ERR_UNAVAILABLE, "Could not get your file, please try again soon"))
+			return
+		}
+		for _, candidate := range files {
+			if candidate.Status == "pending" || candidate.Framework != compatFramework {
+				continue
+			}
+			matches := true
+			for _, constraint := range constraints {
+				if !constraint.Matches(candidate.FrameworkVersion) {
+					matches = false
+					break
+				}
+			}
+			if matches {
+				f = candidate
+				break
+			}
+		}
+		if f == nil {
+			c.Render.JSON(w, http.StatusNotFound,
+				ApiErr(ERR_FILE_NOT_FOUND, "No version of that file is compatible with "+compatible))
+			return
+		}
+	}
+
+	clog = clog.WithField("file_id", f.Id)
+
+	// Files that have been taken down can't be downloaded by anyone
+	if refuseQuarantined(c, w, clog, f) {
 		return
 	}
-	if err == sql.ErrNoRows || f == nil {
-		c.Render.JSON(w, http.StatusNotFound,
-			JsonErr("There is no file by that name"))
+
+	// So are users who look like they're scraping private models
+	if refuseThrottled(c, w, req, clog, m) {
 		return
 	}
 
-	clog = clog.WithField("file_id", f.Id)
+	// And so are files whose organization is out of bandwidth
+	if refuseOverBandwidth(c, w, clog, m) {
+		return
+	}
 
 	u, err := c.Blob.MakeUrl(f.BlobFilename(), 120*time.Second)
 	if err != nil {
 		clog.WithField("err", err).Error("Could not make file url")
 		c.Render.JSON(w, http.StatusBadGateway,
-			JsonErr("Could not get your file, please try again soon"))
+			ApiErr(ERR_UNAVAILABLE, "Could not get your file, please try again soon"))
 		return
 	}
 
-	err = c.Api.DownloadHour.MarkDownload(f.Id, user.Id, ip, time.Now().UTC())
+	err = markDownload(c, req, clog, f, user.Id, clientIp(req))
 	if err != nil {
 		clog.WithField("err", err).Error("Could not mark download")
 		c.Render.JSON(w, http.StatusBadGateway,
-			JsonErr("Could not get your file, please try again soon"))
+			ApiErr(ERR_UNAVAILABLE, "Could not get your file, please try again soon"))
 		return
 	}
 
@@ -111,7 +162,7 @@ func HandleFile(c *Context, w http.ResponseWriter, req *http.Request) {
 	if err = c.Api.File.Hydrate([]*models.File{f}); err != nil {
 		clog.WithField("err", err).Error("Could not hydrate")
 		c.Render.JSON(w, http.StatusBadGateway,
-			JsonErr("Could not get your file, please try again soon"))
+			ApiErr(ERR_UNAVAILABLE, "Could not get your file, please try again soon"))
 		return
 	}
 
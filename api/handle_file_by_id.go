@@ -3,7 +3,6 @@ package api
 import (
 	"database/sql"
 	"net/http"
-	"strings"
 	"time"
 
 	log "github.com/Sirupsen/logrus"
@@ -17,33 +16,23 @@ func HandleFileById(c *Context, w http.ResponseWriter, req *http.Request) {
 	if c.User != nil {
 		fields["auth_user_id"] = c.User.Id
 	}
-	clog := log.WithFields(fields)
-
-	// Get the remote IP
-	var ip string
-	ips := strings.Split(req.Header.Get("X-Forwarded-For"), ", ")
-	if len(ips) > 0 {
-		ip = ips[0]
-	} else {
-		clog.Warn("X-Forwarded-For header not found, falling back to remote addr")
-		ip = req.RemoteAddr
-	}
+	clog := c.Log().WithFields(fields)
 
 	// Get the file by its id
 	f, err := c.Api.File.ById(id)
 	if err != nil && err != sql.ErrNoRows {
 		clog.WithField("err", err).Error("Could not look up file")
 		c.Render.JSON(w, http.StatusBadGateway,
-			JsonErr("Could not get your file, please try again soon"))
+			ApiErr(ERR_UNAVAILABLE, "Could not get your file, please try again soon"))
 		return
 	}
 	if err == sql.ErrNoRows || f == nil {
 		c.Render.JSON(w, http.StatusNotFound,
-			JsonErr("There is no file with that id"))
+			ApiErr(ERR_FILE_NOT_FOUND, "There is no file with that id"))
 		return
 	}
 
-	clog = log.WithFields(log.Fields{
+	clog = c.Log().WithFields(log.Fields{
 		"file_framework": f.Framework,
 		"filename":       f.Filename,
 	})
@@ -53,13 +42,13 @@ func HandleFileById(c *Context, w http.ResponseWriter, req *http.Request) {
 	if err != nil && err != sql.ErrNoRows {
 		clog.WithField("err", err).Error("Could not look up user by username")
 		c.Render.JSON(w, http.StatusBadGateway,
-			JsonErr("Could not get your file, please try again soon"))
+			ApiErr(ERR_UNAVAILABLE, "Could not get your file, please try again soon"))
 		return
 	}
 
 	if err == sql.ErrNoRows || user == nil {
 		c.Render.JSON(w, http.StatusNotFound,
-			JsonErr("No user by that username could be found"))
+			ApiErr(ERR_USER_NOT_FOUND, "No user by that username could be found"))
 		return
 	}
 
@@ -73,17 +62,16 @@ func HandleFileById(c *Context, w http.ResponseWriter, req *http.Request) {
 	if err != nil && err != sql.ErrNoRows {
 		clog.WithField("err", err).Error("Could not look up model by username & slug")
 		c.Render.JSON(w, http.StatusBadGateway,
-			JsonErr("Could not get your file, please try again soon"))
+			ApiErr(ERR_UNAVAILABLE, "Could not get your file, please try again soon"))
 		return
 	}
 	if err == sql.ErrNoRows || user == nil {
 		c.Render.JSON(w, http.StatusNotFound,
-			JsonErr("No model by that username and slug could be found"))
+			ApiErr(ERR_MODEL_NOT_FOUND, "No model by that username and slug could be found"))
 		return
 	}
-	if m.Visibility == "private" && (c.User == nil || m.UserId != c.User.Id) {
-		c.Render.JSON(w, http.StatusUnauthorized,
-			JsonErr("You don't have permission to access this file"))
+	if !authorize(c, w, m, ACTION_READ,
+		"You don't have permission to access this file") {
 		return
 	}
 
@@ -92,19 +80,34 @@ func HandleFileById(c *Context, w http.ResponseWriter, req *http.Request) {
 		"file_model_id":   m.Id,
 	})
 
+	// Files that have been taken down can't be downloaded by anyone
+	if refuseQuarantined(c, w, clog, f) {
+		return
+	}
+
+	// So are users who look like they're scraping private models
+	if refuseThrottled(c, w, req, clog, m) {
+		return
+	}
+
+	// And so are files whose organization is out of bandwidth
+	if refuseOverBandwidth(c, w, clog, m) {
+		return
+	}
+
 	u, err := c.Blob.MakeUrl(f.BlobFilename(), 120*time.Second)
 	if err != nil {
 		clog.WithField("err", err).Error("Could not make file url")
 		c.Render.JSON(w, http.StatusBadGateway,
-			JsonErr("Could not get your file, please try again soon"))
+			ApiErr(ERR_UNAVAILABLE, "Could not get your file, please try again soon"))
 		return
 	}
 
-	err = c.Api.DownloadHour.MarkDownload(f.Id, user.Id, ip, time.Now().UTC())
+	err = markDownload(c, req, clog, f, user.Id, clientIp(req))
 	if err != nil {
 		clog.WithField("err", err).Error("Could not mark download")
 		c.Render.JSON(w, http.StatusBadGateway,
-			JsonErr("Could not get your file, please try again soon"))
+			ApiErr(ERR_UNAVAILABLE, "Could not get your file, please try again soon"))
 		return
 	}
 
@@ -112,7 +115,7 @@ func HandleFileById(c *Context, w http.ResponseWriter, req *http.Request) {
 	if err = c.Api.File.Hydrate([]*models.File{f}); err != nil {
 		clog.WithField("err", err).Error("Could not hydrate")
 		c.Render.JSON(w, http.StatusBadGateway,
-			JsonErr("Could not get your file, please try again soon"))
+			ApiErr(ERR_UNAVAILABLE, "Could not get your file, please try again soon"))
 		return
 	}
 
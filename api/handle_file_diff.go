@@ -0,0 +1,122 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/models"
+)
+
+func HandleFileDiff(c *Context, w http.ResponseWriter, req *http.Request) {
+	username := c.Params.ByName("username")
+	slug := c.Params.ByName("slug")
+	filename := c.Params.ByName("filename")
+	id := c.Params.ByName("id")
+	oldId := c.Params.ByName("old_id")
+
+	fields := log.Fields{
+		"username":    username,
+		"slug":        slug,
+		"filename":    filename,
+		"new_file_id": id,
+		"old_file_id": oldId,
+	}
+	if c.User != nil {
+		fields["auth_user_id"] = c.User.Id
+	}
+	clog := c.Log().WithFields(fields)
+
+	if id == oldId {
+		c.Render.JSON(w, http.StatusBadRequest,
+			ApiErr(ERR_INVALID_REQUEST, "Can't compare a version with itself"))
+		return
+	}
+
+	user, err := c.Api.User.ByUsername(username)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up user by username")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not compare those versions, please try again soon"))
+		return
+	}
+	if err == sql.ErrNoRows || user == nil {
+		c.Render.JSON(w, http.StatusNotFound,
+			ApiErr(ERR_USER_NOT_FOUND, "No user by that username could be found"))
+		return
+	}
+
+	clog = clog.WithField("user_id", user.Id)
+
+	m, err := c.Api.Model.ByUserIdSlug(user.Id, slug)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up model by username & slug")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not compare those versions, please try again soon"))
+		return
+	}
+	if err == sql.ErrNoRows || m == nil {
+		c.Render.JSON(w, http.StatusNotFound, ApiErr(ERR_MODEL_NOT_FOUND, "That model was not found"))
+		return
+	}
+	if !authorize(c, w, m, ACTION_READ,
+		"You don't have permission to access this file") {
+		return
+	}
+
+	clog = clog.WithField("model_id", m.Id)
+
+	files, err := c.Api.File.ByIds([]interface{}{oldId, id})
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up files")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not compare those versions, please try again soon"))
+		return
+	}
+	var oldFile, newFile *models.File
+	for _, f := range files {
+		if f.ModelId != m.Id || f.Filename != filename {
+			continue
+		}
+		if f.Id == oldId {
+			oldFile = f
+		} else if f.Id == id {
+			newFile = f
+		}
+	}
+	if oldFile == nil || newFile == nil {
+		c.Render.JSON(w, http.StatusNotFound,
+			ApiErr(ERR_FILE_NOT_FOUND, "There are no versions of that file with those ids"))
+		return
+	}
+
+	fd, err := c.Api.FileDiff.ByFileIds(oldFile.Id, newFile.Id)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up file diff")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not compare those versions, please try again soon"))
+		return
+	}
+	if err == nil && fd != nil {
+		c.Render.JSON(w, http.StatusOK, map[string]*models.FileDiff{
+			"file_diff": fd,
+		})
+		return
+	}
+
+	// Nobody has asked to compare these versions yet, so queue comparing them
+	// and let the client poll for the result
+	fd = models.NewFileDiff(oldFile.Id, newFile.Id)
+	if err = queueCompareFiles(c.Api, m.UserId, fd); err != nil {
+		clog.WithField("err", err).Error("Could not queue file comparison")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not compare those versions, please try again soon"))
+		return
+	}
+
+	clog.WithField("file_diff_id", fd.Id).Info("File comparison queued")
+
+	c.Render.JSON(w, http.StatusAccepted, map[string]*models.FileDiff{
+		"file_diff": fd,
+	})
+}
@@ -0,0 +1,80 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/models"
+)
+
+func HandleFileLog(c *Context, w http.ResponseWriter, req *http.Request) {
+	username := c.Params.ByName("username")
+	slug := c.Params.ByName("slug")
+
+	fields := log.Fields{"username": username, "slug": slug}
+	if c.User != nil {
+		fields["auth_user_id"] = c.User.Id
+	}
+	clog := c.Log().WithFields(fields)
+
+	user, err := c.Api.User.ByUsername(username)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up user by username")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not get that file log, please try again soon"))
+		return
+	}
+	if err == sql.ErrNoRows || user == nil {
+		c.Render.JSON(w, http.StatusNotFound,
+			ApiErr(ERR_USER_NOT_FOUND, "No user by that username could be found"))
+		return
+	}
+
+	clog = clog.WithField("user_id", user.Id)
+
+	m, err := c.Api.Model.ByUserIdSlug(user.Id, slug)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up model by username & slug")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not get that file log, please try again soon"))
+		return
+	}
+	if err == sql.ErrNoRows || m == nil {
+		c.Render.JSON(w, http.StatusNotFound, ApiErr(ERR_MODEL_NOT_FOUND, "That model was not found"))
+		return
+	}
+	if !authorize(c, w, m, ACTION_READ,
+		"You don't have permission to access this model") {
+		return
+	}
+
+	clog = clog.WithField("model_id", m.Id)
+
+	entries, err := c.Api.FileLog.ByModelId(m.Id)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up file log by model id")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not get that file log, please try again soon"))
+		return
+	}
+
+	// Check the chain before handing it out, so consumers who don't verify it
+	// themselves still find out if it's been tampered with
+	resp := map[string]interface{}{
+		"entries":      entries,
+		"genesis_hash": models.FILE_LOG_GENESIS_HASH,
+		"verified":     true,
+	}
+	if badSeq, err := models.VerifyFileLog(entries); err != nil {
+		clog.WithFields(log.Fields{
+			"err":     err,
+			"bad_seq": badSeq,
+		}).Error("File log failed verification")
+		resp["verified"] = false
+		resp["broken_at"] = badSeq
+		resp["error"] = err.Error()
+	}
+
+	c.Render.JSON(w, http.StatusOK, resp)
+}
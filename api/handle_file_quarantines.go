@@ -0,0 +1,109 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/models"
+)
+
+// FileQuarantineHistory is a quarantine along with everything that's been
+// done to it.
+type FileQuarantineHistory struct {
+	*models.FileQuarantine
+	Events []*models.FileQuarantineEvent `json:"events"`
+}
+
+func HandleFileQuarantines(c *Context, w http.ResponseWriter, req *http.Request) {
+	clog, f := fileForQuarantines(c, w)
+	if f == nil {
+		return
+	}
+
+	// Only the model's owner gets to see the history here, while admins
+	// have their own route for it
+	m, err := c.Api.Model.ById(f.ModelId)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up model by id")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not get that file's quarantines, please try again soon"))
+		return
+	}
+	if err == sql.ErrNoRows || m == nil {
+		c.Render.JSON(w, http.StatusNotFound,
+			ApiErr(ERR_FILE_NOT_FOUND, "There is no file with that id"))
+		return
+	}
+	if !authorize(c, w, m, ACTION_MANAGE,
+		"You're only allowed to see quarantines of your own files") {
+		return
+	}
+
+	renderQuarantineHistory(c, w, clog, f)
+}
+
+func HandleAdminFileQuarantines(c *Context, w http.ResponseWriter, req *http.Request) {
+	clog, f := fileForQuarantines(c, w)
+	if f == nil {
+		return
+	}
+	renderQuarantineHistory(c, w, clog, f)
+}
+
+// fileForQuarantines looks up the file whose quarantines were asked for, or
+// responds with why it couldn't and returns nil.
+func fileForQuarantines(c *Context, w http.ResponseWriter) (*log.Entry, *models.File) {
+	id := c.Params.ByName("id")
+
+	clog := c.Log().WithFields(log.Fields{
+		"user_id": c.User.Id,
+		"file_id": id,
+	})
+
+	f, err := c.Api.File.ById(id)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up file")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not get that file's quarantines, please try again soon"))
+		return clog, nil
+	}
+	if err == sql.ErrNoRows || f == nil {
+		c.Render.JSON(w, http.StatusNotFound,
+			ApiErr(ERR_FILE_NOT_FOUND, "There is no file with that id"))
+		return clog, nil
+	}
+
+	return clog.WithField("file_model_id", f.ModelId), f
+}
+
+// renderQuarantineHistory responds with every quarantine of the file, along
+// with everything that's been done to each.
+func renderQuarantineHistory(c *Context, w http.ResponseWriter, clog *log.Entry, f *models.File) {
+	quarantines, err := c.Api.FileQuarantine.ByFileId(f.Id)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up file quarantines")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not get that file's quarantines, please try again soon"))
+		return
+	}
+
+	quarantineIds := make([]string, 0, len(quarantines))
+	for _, q := range quarantines {
+		quarantineIds = append(quarantineIds, q.Id)
+	}
+	events, err := c.Api.FileQuarantine.EventsByQuarantineIds(quarantineIds)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up file quarantine events")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not get that file's quarantines, please try again soon"))
+		return
+	}
+
+	history := make([]*FileQuarantineHistory, 0, len(quarantines))
+	for _, q := range quarantines {
+		history = append(history, &FileQuarantineHistory{q, events[q.Id]})
+	}
+
+	c.Render.JSON(w, http.StatusOK, map[string]interface{}{"quarantines": history})
+}
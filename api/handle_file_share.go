@@ -0,0 +1,115 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/models"
+)
+
+func HandleFileShare(c *Context, w http.ResponseWriter, req *http.Request) {
+	id := c.Params.ByName("id")
+
+	fields := log.Fields{"file_share_id": id}
+	if c.User != nil {
+		fields["auth_user_id"] = c.User.Id
+	}
+	clog := c.Log().WithFields(fields)
+
+	share, err := c.Api.FileShare.ById(id)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up file share")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not get that shared file, please try again soon"))
+		return
+	}
+	if err == sql.ErrNoRows || share == nil {
+		c.Render.JSON(w, http.StatusNotFound,
+			ApiErr(ERR_NOT_FOUND, "There is no share with that id"))
+		return
+	}
+
+	clog = clog.WithFields(log.Fields{
+		"file_id":       share.FileId,
+		"file_model_id": share.ModelId,
+	})
+
+	m, err := c.Api.Model.ById(share.ModelId)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up model by id")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not get that shared file, please try again soon"))
+		return
+	}
+	if err == sql.ErrNoRows || m == nil {
+		c.Render.JSON(w, http.StatusNotFound,
+			ApiErr(ERR_NOT_FOUND, "There is no share with that id"))
+		return
+	}
+
+	// Once a share expires, only the owner can still use it
+	if share.Expired() && !can(c, m, ACTION_MANAGE) {
+		c.Render.JSON(w, http.StatusGone, ApiErr(ERR_EXPIRED, "This share has expired"))
+		return
+	}
+
+	f, err := c.Api.File.ById(share.FileId)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up file")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not get that shared file, please try again soon"))
+		return
+	}
+	if err == sql.ErrNoRows || f == nil {
+		c.Render.JSON(w, http.StatusNotFound,
+			ApiErr(ERR_FILE_NOT_FOUND, "The shared file no longer exists"))
+		return
+	}
+
+	// Files that have been taken down can't be downloaded by anyone
+	if refuseQuarantined(c, w, clog, f) {
+		return
+	}
+
+	// So are users who look like they're scraping private models
+	if refuseThrottled(c, w, req, clog, m) {
+		return
+	}
+
+	// And so are files whose organization is out of bandwidth
+	if refuseOverBandwidth(c, w, clog, m) {
+		return
+	}
+
+	u, err := c.Blob.MakeUrl(f.BlobFilename(), 120*time.Second)
+	if err != nil {
+		clog.WithField("err", err).Error("Could not make file url")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not get that shared file, please try again soon"))
+		return
+	}
+
+	err = markDownload(c, req, clog, f, m.UserId, clientIp(req))
+	if err != nil {
+		clog.WithField("err", err).Error("Could not mark download")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not get that shared file, please try again soon"))
+		return
+	}
+
+	// Hydrate the file object
+	if err = c.Api.File.Hydrate([]*models.File{f}); err != nil {
+		clog.WithField("err", err).Error("Could not hydrate")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not get that shared file, please try again soon"))
+		return
+	}
+
+	c.Render.JSON(w, http.StatusOK, map[string]interface{}{
+		"url":        u,
+		"file":       f,
+		"file_share": share,
+	})
+}
@@ -0,0 +1,100 @@
+package api
+
+import (
+	"database/sql"
+	"math"
+	"net/http"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+type FileSize struct {
+	FileId      string    `json:"file_id"`
+	Seq         int64     `json:"seq"`
+	SizeBytes   int64     `json:"size_bytes"`
+	ChangeBytes int64     `json:"change_bytes"`
+	ChangePct   *float64  `json:"change_pct"`
+	CreatedTime time.Time `json:"created_time"`
+}
+
+func HandleFileSizes(c *Context, w http.ResponseWriter, req *http.Request) {
+	username := c.Params.ByName("username")
+	slug := c.Params.ByName("slug")
+	filename := c.Params.ByName("filename")
+
+	fields := log.Fields{
+		"username": username,
+		"slug":     slug,
+		"filename": filename,
+	}
+	if c.User != nil {
+		fields["auth_user_id"] = c.User.Id
+	}
+	clog := c.Log().WithFields(fields)
+
+	user, err := c.Api.User.ByUsername(username)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up user by username")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not get that file's size history, please try again soon"))
+		return
+	}
+	if err == sql.ErrNoRows || user == nil {
+		c.Render.JSON(w, http.StatusNotFound,
+			ApiErr(ERR_USER_NOT_FOUND, "No user by that username could be found"))
+		return
+	}
+
+	clog = clog.WithField("user_id", user.Id)
+
+	m, err := c.Api.Model.ByUserIdSlug(user.Id, slug)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up model by username & slug")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not get that file's size history, please try again soon"))
+		return
+	}
+	if err == sql.ErrNoRows || m == nil {
+		c.Render.JSON(w, http.StatusNotFound, ApiErr(ERR_MODEL_NOT_FOUND, "That model was not found"))
+		return
+	}
+	if !authorize(c, w, m, ACTION_READ,
+		"You don't have permission to access this model") {
+		return
+	}
+
+	clog = clog.WithField("model_id", m.Id)
+
+	// The log is used rather than the files themselves, since it remembers the
+	// versions that have been pruned
+	entries, err := c.Api.FileLog.ByModelIdFilename(m.Id, filename)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up file log by filename")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not get that file's size history, please try again soon"))
+		return
+	}
+
+	sizes := make([]*FileSize, len(entries))
+	for i, e := range entries {
+		sizes[i] = &FileSize{
+			FileId:      e.FileId,
+			Seq:         e.Seq,
+			SizeBytes:   e.SizeBytes,
+			CreatedTime: e.CreatedTime,
+		}
+		if i > 0 {
+			prev := entries[i-1].SizeBytes
+			sizes[i].ChangeBytes = e.SizeBytes - prev
+			if pct := sizeChangePercent(prev, e.SizeBytes); !math.IsInf(pct, 0) {
+				sizes[i].ChangePct = &pct
+			}
+		}
+	}
+
+	c.Render.JSON(w, http.StatusOK, map[string]interface{}{
+		"filename": filename,
+		"sizes":    sizes,
+	})
+}
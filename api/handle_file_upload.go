@@ -1,16 +1,23 @@
 package api
 
 import (
+	"crypto/sha256"
 	"database/sql"
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"net/http"
+	"reflect"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/ericflo/gradientzoo/models"
+	"github.com/ericflo/gradientzoo/tracing"
+	"github.com/ericflo/gradientzoo/utils"
 )
 
-const MaxFileSize = 500 * 1024 * 1024 // 500MB max
+const MaxFilenameLength = 255
+const MaxFrameworkLength = 64
+const MaxClientNameLength = 64
 
 func HandleFileUpload(c *Context, w http.ResponseWriter, req *http.Request) {
 	username := c.Params.ByName("username")
@@ -19,17 +26,13 @@ func HandleFileUpload(c *Context, w http.ResponseWriter, req *http.Request) {
 	frameworkVersion := req.Header.Get("X-Gradientzoo-Framework-Version")
 	filename := c.Params.ByName("filename")
 	clientName := req.Header.Get("X-Gradientzoo-Client-Name")
-	metadataString := req.FormValue("metadata")
 
-	var metadata map[string]interface{}
-	if err := json.Unmarshal([]byte(metadataString), &metadata); err != nil {
-		msg := "Could not decode metadata"
-		log.WithField("err", err).Error(msg)
-		c.Render.JSON(w, http.StatusBadRequest, JsonErr(msg))
-		return
-	}
+	// Getting at the metadata parses the whole multipart body, upload and all
+	parse := tracing.StartChild(req.Context(), "parse upload", tracing.KIND_INTERNAL)
+	metadataString := req.FormValue("metadata")
+	parse.Finish()
 
-	clog := log.WithFields(log.Fields{
+	clog := c.Log().WithFields(log.Fields{
 		"user_id":                c.User.Id,
 		"file_username":          username,
 		"file_model_slug":        slug,
@@ -39,18 +42,33 @@ func HandleFileUpload(c *Context, w http.ResponseWriter, req *http.Request) {
 		"client_name":            clientName,
 	})
 
+	// Validation
+	var metadata map[string]interface{}
+	v := NewValidator()
+	if err := json.Unmarshal([]byte(metadataString), &metadata); err != nil {
+		clog.WithField("err", err).Info("Could not decode metadata")
+		v.Add("metadata", "Metadata must be a JSON object")
+	}
+	v.Field("filename", "Filename").MaxLength(filename, MaxFilenameLength)
+	v.Field("framework", "Framework").MaxLength(framework, MaxFrameworkLength)
+	v.Field("framework_version", "Framework version").MaxLength(frameworkVersion, MaxFrameworkLength)
+	v.Field("client_name", "Client name").MaxLength(clientName, MaxClientNameLength)
+	if v.Refuse(c, w) {
+		return
+	}
+
 	// First let's look up the user by their username
 	user, err := c.Api.User.ByUsername(username)
 	if err != nil && err != sql.ErrNoRows {
 		clog.WithField("err", err).Error("Could not look up user by username")
 		c.Render.JSON(w, http.StatusBadGateway,
-			JsonErr("Could not get that model, please try again soon"))
+			ApiErr(ERR_UNAVAILABLE, "Could not get that model, please try again soon"))
 		return
 	}
 
 	if err == sql.ErrNoRows || user == nil {
 		c.Render.JSON(w, http.StatusNotFound,
-			JsonErr("No user by that username could be found"))
+			ApiErr(ERR_USER_NOT_FOUND, "No user by that username could be found"))
 		return
 	}
 
@@ -61,42 +79,33 @@ func HandleFileUpload(c *Context, w http.ResponseWriter, req *http.Request) {
 	if err != nil && err != sql.ErrNoRows {
 		clog.WithField("err", err).Error("Could not look up model by username & slug")
 		c.Render.JSON(w, http.StatusBadGateway,
-			JsonErr("Could not save your file, please try again soon"))
+			ApiErr(ERR_UNAVAILABLE, "Could not save your file, please try again soon"))
 		return
 	}
 	if err == sql.ErrNoRows || user == nil {
 		c.Render.JSON(w, http.StatusNotFound,
-			JsonErr("No model by that username and slug could be found"))
+			ApiErr(ERR_MODEL_NOT_FOUND, "No model by that username and slug could be found"))
 		return
 	}
-	if m.UserId != c.User.Id {
-		c.Render.JSON(w, http.StatusUnauthorized,
-			JsonErr("You're only allowed to upload files for your own models"))
+	if !authorize(c, w, m, ACTION_WRITE,
+		"You're only allowed to upload files for your own models") {
 		return
 	}
 
 	clog = clog.WithField("file_model_id", m.Id)
 
 	// Limit file size based on plan
-	switch m.Keep {
-	case 10:
-		req.Body = http.MaxBytesReader(w, req.Body, 500*1024*1024) // 500MB
-	case 100:
-		req.Body = http.MaxBytesReader(w, req.Body, 1024*1024*1024) // 1GB
-	case 1000:
-		req.Body = http.MaxBytesReader(w, req.Body, 2*1024*1024*1024) // 2GB
-	case 10000:
-		req.Body = http.MaxBytesReader(w, req.Body, 4*1024*1024*1024) // 4GB
-	default:
-		req.Body = http.MaxBytesReader(w, req.Body, 500*1024*1024) // 500MB
-	}
+	req.Body = http.MaxBytesReader(w, req.Body, utils.Live().UploadLimit(m.Keep))
 
 	// Open the file from the request
+	read := tracing.StartChild(req.Context(), "read upload", tracing.KIND_INTERNAL)
 	file, _, err := req.FormFile("file")
 	if err != nil {
+		read.SetError(err)
+		read.Finish()
 		clog.WithField("err", err).Error("Could not get uploaded file")
 		c.Render.JSON(w, http.StatusBadRequest,
-			JsonErr("Could not get uploaded file"))
+			ApiErr(ERR_INVALID_REQUEST, "Could not get uploaded file"))
 		return
 	}
 	defer file.Close()
@@ -104,36 +113,79 @@ func HandleFileUpload(c *Context, w http.ResponseWriter, req *http.Request) {
 	// Read the file into memory (S3 requires exact content length) :(
 	// TODO: buffer into a file if the upload is large
 	data, err := ioutil.ReadAll(file)
+	read.SetError(err)
+	read.Finish()
 	if err != nil {
 		clog.WithField("err", err).Error("Could not read uploaded file")
 		c.Render.JSON(w, http.StatusBadRequest,
-			JsonErr("Could not read uploaded file"))
+			ApiErr(ERR_INVALID_REQUEST, "Could not read uploaded file"))
 		return
 	}
 
 	clog = clog.WithField("file_size_bytes", len(data))
+	sum := fmt.Sprintf("%x", sha256.Sum256(data))
+
+	// Clients that upload after every epoch often upload the same thing again,
+	// which with dedup on doesn't make a new version
+	if featureEnabled(c, FLAG_UPLOAD_DEDUP) {
+		if latest := unchangedUpload(c, clog, m.Id, filename, framework, sum, metadata); latest != nil {
+			clog.WithField("file_id", latest.Id).Info("Upload is the same as the latest version")
+			if err = c.Api.File.Hydrate([]*models.File{latest}); err != nil {
+				clog.WithField("err", err).Error("Could not hydrate")
+			}
+			c.Render.JSON(w, http.StatusOK, map[string]interface{}{
+				"file":      latest,
+				"unchanged": true,
+			})
+			return
+		}
+	}
+
+	// Organizations share one storage quota between all of their members
+	hasRoom, err := organizationHasRoom(c.Api, c.User, int64(len(data)))
+	if err != nil {
+		clog.WithField("err", err).Error("Could not check organization storage")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not save your file, please try again soon"))
+		return
+	}
+	if !hasRoom {
+		c.Render.JSON(w, http.StatusForbidden,
+			ApiErr(ERR_QUOTA_EXCEEDED, "Your organization has used all of its storage, "+
+				"upgrade its plan or delete some files"))
+		return
+	}
 
 	// Delete any pending files
 	if err = c.Api.File.DeletePending(m.Id, filename); err != nil {
 		clog.WithField("err", err).Error("Could not delete pending files")
 		c.Render.JSON(w, http.StatusBadGateway,
-			JsonErr("Could not save your file, please try again soon"))
+			ApiErr(ERR_UNAVAILABLE, "Could not save your file, please try again soon"))
 		return
 	}
 
+	// A model's first file is checked against everybody else's, to catch
+	// straight re-uploads of somebody else's model
+	latest, err := c.Api.File.ByModelIdLatest(m.Id)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up latest files")
+	}
+	firstFile := err == nil && len(latest) == 0
+
 	// Now let's create the new file object
 	f, err := models.NewFile(c.User.Id, m.Id, filename, framework,
 		frameworkVersion, clientName, len(data), metadata)
 	if err != nil {
 		clog.WithField("err", err).Error("Could not create file")
 		c.Render.JSON(w, http.StatusBadGateway,
-			JsonErr("Could not save your file, please try again soon"))
+			ApiErr(ERR_UNAVAILABLE, "Could not save your file, please try again soon"))
 		return
 	}
+	f.Sha256 = sum
 	if err = c.Api.File.Save(f); err != nil {
 		clog.WithField("err", err).Error("Could not save file to database")
 		c.Render.JSON(w, http.StatusBadGateway,
-			JsonErr("Could not save your file, please try again soon"))
+			ApiErr(ERR_UNAVAILABLE, "Could not save your file, please try again soon"))
 		return
 	}
 
@@ -141,19 +193,81 @@ func HandleFileUpload(c *Context, w http.ResponseWriter, req *http.Request) {
 	if err = c.Blob.Save(data, f.BlobFilename(), "application/octet-stream"); err != nil {
 		clog.WithField("err", err).Error("Could not store the image")
 		c.Render.JSON(w, http.StatusBadGateway,
-			JsonErr("Could not save your file, please try again soon"))
+			ApiErr(ERR_UNAVAILABLE, "Could not save your file, please try again soon"))
 		return
 	}
+	uploadBytes.Add(float64(len(data)))
 
-	// Now we commit this new pending file
-	if err = c.Api.File.CommitPending(m.Id, filename, f.Id); err != nil {
-		clog.WithField("err", err).Error("Could not commit pending")
+	// Files that belong to a group are only committed along with the rest of
+	// their group
+	group, err := c.Api.FileGroup.ByModelIdFilename(m.Id, filename)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up file group")
 		c.Render.JSON(w, http.StatusBadGateway,
-			JsonErr("Could not finalize file upload, please try again soon"))
+			ApiErr(ERR_UNAVAILABLE, "Could not finalize file upload, please try again soon"))
 		return
 	}
 
-	files, err := c.Api.File.ToDelete(m.Id, filename, 10)
+	committed := []*models.File{f}
+	missing := []string{}
+	if group == nil {
+		// Now we commit this new pending file
+		if err = c.Api.File.CommitPending(m.Id, filename, f.Id); err != nil {
+			clog.WithField("err", err).Error("Could not commit pending")
+			c.Render.JSON(w, http.StatusBadGateway,
+				ApiErr(ERR_UNAVAILABLE, "Could not finalize file upload, please try again soon"))
+			return
+		}
+	} else {
+		clog = clog.WithField("file_group_id", group.Id)
+		committed, missing, err = c.Api.File.CommitGroup(m.Id, group.Filenames)
+		if err != nil {
+			clog.WithField("err", err).Error("Could not commit file group")
+			c.Render.JSON(w, http.StatusBadGateway,
+				ApiErr(ERR_UNAVAILABLE, "Could not finalize file upload, please try again soon"))
+			return
+		}
+		for _, cf := range committed {
+			if cf.Id == f.Id {
+				f = cf
+			}
+		}
+	}
+
+	// Work out what's inside it in the background, from what was stored
+	if err = queueInspectFile(c.Api, f); err != nil {
+		clog.WithField("err", err).Error("Could not queue file inspection")
+	}
+
+	for _, cf := range committed {
+		// Add this version to the model's tamper-evident log
+		if _, err = c.Api.FileLog.Append(cf); err != nil {
+			clog.WithField("err", err).Error("Could not append file to log")
+		} else {
+			cf := cf
+			goBackground(func() { checkFileSize(c.Api, c.Mailer, m, user, cf) })
+		}
+
+		// Move the "best" alias if this version beats the previous best, before
+		// pruning so that the best version is never deleted
+		if _, err = c.Api.FilePolicy.UpdateBest(m.Id, cf.Filename); err != nil {
+			clog.WithField("err", err).Error("Could not update best file")
+		}
+	}
+
+	var files []*models.File
+	switch {
+	case len(committed) == 0:
+		// Nothing new was committed, so there's nothing to prune yet
+	case group == nil:
+		files, err = c.Api.File.ToDelete(m.Id, filename, m.Keep)
+	default:
+		keep := m.Keep
+		if group.Keep > 0 && group.Keep < keep {
+			keep = group.Keep
+		}
+		files, err = c.Api.File.ToDeleteGroup(m.Id, group.Filenames, keep)
+	}
 	if err != nil && err != sql.ErrNoRows {
 		clog.WithField("err", err).Error("Could not delete old files")
 	}
@@ -176,11 +290,57 @@ func HandleFileUpload(c *Context, w http.ResponseWriter, req *http.Request) {
 
 	clog.Info("Upload successful")
 
+	// Take the size now so the upload itself isn't held onto
+	size := int64(len(data))
+	goBackground(func() { checkStorageQuota(c.Api, c.Mailer, c.User, size) })
+
 	// Hydrate the file object
 	if err = c.Api.File.Hydrate([]*models.File{f}); err != nil {
 		clog.WithField("err", err).Error("Could not hydrate")
 	}
 
-	// Return the new user and auth token objects
-	c.Render.JSON(w, http.StatusOK, map[string]*models.File{"file": f})
+	// Return the new file object, and for grouped files, which other files the
+	// group is still waiting on
+	resp := map[string]interface{}{"file": f}
+	if group != nil {
+		resp["file_group"] = group
+		resp["missing"] = missing
+	}
+	if firstFile {
+		dups, err := duplicatesByFile(c.Api, m, f.Sha256)
+		if err != nil {
+			clog.WithField("err", err).Error("Could not look for duplicate models")
+		} else if len(dups) > 0 {
+			resp["possible_duplicates"] = dups
+		}
+	}
+	c.Render.JSON(w, http.StatusOK, resp)
+}
+
+// unchangedUpload finds the latest version of the file, if it's exactly the
+// same as what's being uploaded: the same contents, framework and metadata.
+// Files in groups are committed along with the rest of their group, so
+// they're never skipped.
+func unchangedUpload(c *Context, clog *log.Entry, modelId, filename, framework, sum string,
+	metadata map[string]interface{}) *models.File {
+	group, err := c.Api.FileGroup.ByModelIdFilename(modelId, filename)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up file group")
+		return nil
+	}
+	if group != nil {
+		return nil
+	}
+	latest, err := c.Api.File.ByModelIdFilenameLatest(modelId, filename)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			clog.WithField("err", err).Error("Could not look up latest version")
+		}
+		return nil
+	}
+	if latest.Sha256 != sum || latest.Framework != framework ||
+		!reflect.DeepEqual(latest.Metadata, metadata) {
+		return nil
+	}
+	return latest
 }
@@ -5,7 +5,6 @@ import (
 	"net/http"
 
 	log "github.com/Sirupsen/logrus"
-	"github.com/ericflo/gradientzoo/models"
 )
 
 func HandleFileVersions(c *Context, w http.ResponseWriter, req *http.Request) {
@@ -23,19 +22,19 @@ func HandleFileVersions(c *Context, w http.ResponseWriter, req *http.Request) {
 	if c.User != nil {
 		fields["auth_user_id"] = c.User.Id
 	}
-	clog := log.WithFields(fields)
+	clog := c.Log().WithFields(fields)
 
 	user, err := c.Api.User.ByUsername(username)
 	if err != nil && err != sql.ErrNoRows {
 		clog.WithField("err", err).Error("Could not look up user by username")
 		c.Render.JSON(w, http.StatusBadGateway,
-			JsonErr("Could not get those files, please try again soon"))
+			ApiErr(ERR_UNAVAILABLE, "Could not get those files, please try again soon"))
 		return
 	}
 
 	if err == sql.ErrNoRows || user == nil {
 		c.Render.JSON(w, http.StatusNotFound,
-			JsonErr("No user by that username could be found"))
+			ApiErr(ERR_USER_NOT_FOUND, "No user by that username could be found"))
 		return
 	}
 
@@ -45,27 +44,33 @@ func HandleFileVersions(c *Context, w http.ResponseWriter, req *http.Request) {
 	if err != nil && err != sql.ErrNoRows {
 		clog.WithField("err", err).Error("Could not look up model by username & slug")
 		c.Render.JSON(w, http.StatusBadGateway,
-			JsonErr("Could not get those files, please try again soon"))
+			ApiErr(ERR_UNAVAILABLE, "Could not get those files, please try again soon"))
 		return
 	}
 	if err == sql.ErrNoRows || m == nil {
-		c.Render.JSON(w, http.StatusNotFound, JsonErr("That model was not found"))
+		c.Render.JSON(w, http.StatusNotFound, ApiErr(ERR_MODEL_NOT_FOUND, "That model was not found"))
 		return
 	}
-	if m.Visibility == "private" && (c.User == nil || m.UserId != c.User.Id) {
-		c.Render.JSON(w, http.StatusUnauthorized,
-			JsonErr("You don't have permission to access those files"))
+	if !authorize(c, w, m, ACTION_READ,
+		"You don't have permission to access those files") {
 		return
 	}
 
 	clog = clog.WithField("model_id", m.Id)
 
-	files, err := c.Api.File.ByModelIdFrameworkFilename(m.Id, framework, filename)
+	kind := "versions:" + m.Id
+	limit, after, err := pageParams(req, kind, MaxPageSize, MaxPageSize)
+	if err != nil {
+		c.Render.JSON(w, http.StatusBadRequest, ApiErr(ERR_INVALID_REQUEST, err.Error()))
+		return
+	}
+
+	files, next, err := c.Api.File.ByModelIdFrameworkFilename(m.Id, framework, filename, limit, after)
 	if err != nil && err != sql.ErrNoRows {
 		clog.WithField("err", err).Error("Could not look up files by model id, " +
 			"framework, and file name")
 		c.Render.JSON(w, http.StatusBadGateway,
-			JsonErr("Could not get those files, please try again soon"))
+			ApiErr(ERR_UNAVAILABLE, "Could not get those files, please try again soon"))
 		return
 	}
 
@@ -73,9 +78,15 @@ func HandleFileVersions(c *Context, w http.ResponseWriter, req *http.Request) {
 	if err = c.Api.File.Hydrate(files); err != nil {
 		clog.WithField("err", err).Error("Could not hydrate file")
 		c.Render.JSON(w, http.StatusBadGateway,
-			JsonErr("Could not get those files, please try again soon"))
+			ApiErr(ERR_UNAVAILABLE, "Could not get those files, please try again soon"))
 		return
 	}
 
-	c.Render.JSON(w, http.StatusOK, map[string][]*models.File{"files": files})
+	// Only send the metadata keys the client asked for
+	projectFileMetadata(req, files)
+
+	c.Render.JSON(w, http.StatusOK, map[string]interface{}{
+		"files":       files,
+		"next_cursor": nextCursor(kind, next),
+	})
 }
@@ -0,0 +1,91 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"regexp"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/models"
+)
+
+const MaxHashLookupResults = 100
+
+var sha256Regexp = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+func HandleFilesByHash(c *Context, w http.ResponseWriter, req *http.Request) {
+	hash := strings.ToLower(c.Params.ByName("sha256"))
+
+	fields := log.Fields{"sha256": hash}
+	viewerId := ""
+	if c.User != nil {
+		fields["auth_user_id"] = c.User.Id
+		viewerId = c.User.Id
+	}
+	clog := c.Log().WithFields(fields)
+
+	if !sha256Regexp.MatchString(hash) {
+		c.Render.JSON(w, http.StatusBadRequest,
+			ApiErr(ERR_INVALID_REQUEST, "Must specify a SHA-256 hash as 64 hex characters"))
+		return
+	}
+
+	// Private models only show up for their owner
+	files, err := c.Api.File.BySha256(hash, viewerId, MaxHashLookupResults)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up files by hash")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not look up that hash, please try again soon"))
+		return
+	}
+
+	// Hydrate the file objects
+	if err = c.Api.File.Hydrate(files); err != nil {
+		clog.WithField("err", err).Error("Could not hydrate files")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not look up that hash, please try again soon"))
+		return
+	}
+
+	// Only send the metadata keys the client asked for
+	projectFileMetadata(req, files)
+
+	// Build up a unique list of model ids in the keys of a map
+	modelIdKeys := map[string]bool{}
+	for _, f := range files {
+		modelIdKeys[f.ModelId] = true
+	}
+
+	// Now extract those model id keys into a slice
+	modelIds := make([]interface{}, 0, len(modelIdKeys))
+	for modelId := range modelIdKeys {
+		modelIds = append(modelIds, modelId)
+	}
+
+	// Get the models those files belong to
+	ms, err := c.Api.Model.ByIds(modelIds)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithFields(log.Fields{
+			"err":      err,
+			"modelIds": modelIds,
+		}).Error("Could not get models by id")
+		ms = []*models.Model{}
+	}
+
+	// Drop anything the token the lookup was made with can't read
+	files, ms = visibleFiles(c, files, ms)
+
+	// And the users who own those models, so that clients can link to them
+	users, err := c.Load.Owners(ms)
+	if err != nil {
+		clog.WithField("err", err).Error("Could not get users by id")
+		users = []*models.User{}
+	}
+
+	c.Render.JSON(w, http.StatusOK, map[string]interface{}{
+		"files":  files,
+		"models": ms,
+		"users":  users,
+	})
+}
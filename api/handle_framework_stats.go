@@ -0,0 +1,112 @@
+package api
+
+import (
+	"net/http"
+	"sort"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/models"
+)
+
+// The widest range of framework uploads that can be asked for at each
+// granularity, and how far back it goes when no start is given
+var maxFrameworkStatsRange = map[string]time.Duration{
+	"day":   92 * 24 * time.Hour,
+	"week":  2 * 366 * 24 * time.Hour,
+	"month": 5 * 366 * 24 * time.Hour,
+}
+var defaultFrameworkStatsRange = map[string]time.Duration{
+	"day":   30 * 24 * time.Hour,
+	"week":  26 * 7 * 24 * time.Hour,
+	"month": 366 * 24 * time.Hour,
+}
+
+// HandleFrameworkStats shows how many files are uploaded to public models from
+// each framework and version over time, so adoption of new versions can be
+// followed.  The totals add up each series over the whole range.
+func HandleFrameworkStats(c *Context, w http.ResponseWriter, req *http.Request) {
+	granularity := req.URL.Query().Get("granularity")
+	versions := req.URL.Query().Get("versions")
+
+	fields := log.Fields{
+		"granularity": granularity,
+		"versions":    versions,
+	}
+	if c.User != nil {
+		fields["auth_user_id"] = c.User.Id
+	}
+	clog := c.Log().WithFields(fields)
+
+	// Validation
+	if granularity == "" {
+		granularity = "week"
+	}
+	maxRange, ok := maxFrameworkStatsRange[granularity]
+	if !ok {
+		c.Render.JSON(w, http.StatusBadRequest,
+			ApiErr(ERR_INVALID_REQUEST, "Granularity must be one of 'day', 'week', 'month'"))
+		return
+	}
+	if versions == "" {
+		versions = models.VERSIONS_MAJOR
+	}
+	if versions != models.VERSIONS_MAJOR && versions != models.VERSIONS_FULL &&
+		versions != models.VERSIONS_NONE {
+		c.Render.JSON(w, http.StatusBadRequest,
+			ApiErr(ERR_INVALID_REQUEST, "Versions must be one of 'major', 'full', 'none'"))
+		return
+	}
+	start, end, ok := statsRange(c, w, req, defaultFrameworkStatsRange[granularity], maxRange)
+	if !ok {
+		return
+	}
+
+	uploads, err := c.Api.File.FrameworkUploads(granularity, versions, start, end)
+	if err != nil {
+		clog.WithField("err", err).Error("Could not look up framework uploads")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not get those stats, please try again soon"))
+		return
+	}
+
+	// Total up each framework version, most uploads first
+	totals := []*frameworkTotal{}
+	byVersion := map[string]*frameworkTotal{}
+	for _, u := range uploads {
+		key := u.Framework + " " + u.FrameworkVersion
+		if t, ok := byVersion[key]; ok {
+			t.Uploads += u.Uploads
+			continue
+		}
+		t := &frameworkTotal{
+			Framework:        u.Framework,
+			FrameworkVersion: u.FrameworkVersion,
+			Uploads:          u.Uploads,
+		}
+		byVersion[key] = t
+		totals = append(totals, t)
+	}
+	sort.Stable(byUploads(totals))
+
+	c.Render.JSON(w, http.StatusOK, map[string]interface{}{
+		"granularity": granularity,
+		"versions":    versions,
+		"start":       start,
+		"end":         end,
+		"series":      uploads,
+		"totals":      totals,
+	})
+}
+
+type frameworkTotal struct {
+	Framework        string `json:"framework"`
+	FrameworkVersion string `json:"framework_version"`
+	Uploads          int    `json:"uploads"`
+}
+
+type byUploads []*frameworkTotal
+
+func (s byUploads) Len() int           { return len(s) }
+func (s byUploads) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byUploads) Less(i, j int) bool { return s[i].Uploads > s[j].Uploads }
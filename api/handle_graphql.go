@@ -0,0 +1,63 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/graphql"
+)
+
+const MaxGraphqlRequestSize = 64 * 1024 // 64KB max
+
+type GraphqlForm struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// HandleGraphql runs a GraphQL query, from the JSON body of a POST or the
+// query params of a GET.  Errors in the query itself still come back as 200s,
+// alongside whatever data could be resolved, as GraphQL clients expect.
+func HandleGraphql(c *Context, w http.ResponseWriter, req *http.Request) {
+	fields := log.Fields{}
+	if c.User != nil {
+		fields["auth_user_id"] = c.User.Id
+	}
+	clog := c.Log().WithFields(fields)
+
+	var form GraphqlForm
+	if req.Method == "POST" {
+		req.Body = http.MaxBytesReader(w, req.Body, MaxGraphqlRequestSize)
+		defer req.Body.Close()
+		decoder := json.NewDecoder(req.Body)
+		if err := decoder.Decode(&form); err != nil {
+			msg := "Could not decode GraphQL request"
+			clog.WithField("err", err).Error(msg)
+			c.Render.JSON(w, http.StatusBadRequest, ApiErr(ERR_INVALID_REQUEST, msg))
+			return
+		}
+	} else {
+		q := req.URL.Query()
+		form.Query = q.Get("query")
+		form.OperationName = q.Get("operationName")
+		if vars := q.Get("variables"); vars != "" {
+			if err := json.Unmarshal([]byte(vars), &form.Variables); err != nil {
+				c.Render.JSON(w, http.StatusBadRequest,
+					ApiErr(ERR_INVALID_REQUEST, "Variables must be a JSON object"))
+				return
+			}
+		}
+	}
+	if form.Query == "" {
+		c.Render.JSON(w, http.StatusBadRequest, ApiErr(ERR_INVALID_REQUEST, "Query must not be empty"))
+		return
+	}
+	if len(form.Query) > MaxGraphqlRequestSize {
+		c.Render.JSON(w, http.StatusBadRequest, ApiErr(ERR_INVALID_REQUEST, "That query is too long"))
+		return
+	}
+
+	result := graphql.Do(graphqlSchema, c, form.Query, form.OperationName, form.Variables)
+	c.Render.JSON(w, http.StatusOK, result)
+}
@@ -0,0 +1,24 @@
+package api
+
+import (
+	"net/http"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+func HandleIdentities(c *Context, w http.ResponseWriter, req *http.Request) {
+	idents, err := c.Api.UserIdentity.ByUserId(c.User.Id)
+	if err != nil {
+		c.Log().WithFields(log.Fields{
+			"err":     err,
+			"user_id": c.User.Id,
+		}).Error("Could not get identities")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not get linked accounts, please try again soon"))
+		return
+	}
+	c.Render.JSON(w, http.StatusOK, map[string]interface{}{
+		"identities":   idents,
+		"has_password": c.User.HasPassword(),
+	})
+}
@@ -0,0 +1,62 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/models"
+)
+
+func HandleImpersonateUser(c *Context, w http.ResponseWriter, req *http.Request) {
+	id := c.Params.ByName("id")
+
+	clog := c.Log().WithFields(log.Fields{
+		"auth_user_id": c.User.Id,
+		"user_id":      id,
+	})
+
+	user, err := c.Api.User.ById(id)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up user")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not sign in as that user, please try again soon"))
+		return
+	}
+	if err == sql.ErrNoRows || user == nil {
+		c.Render.JSON(w, http.StatusNotFound,
+			ApiErr(ERR_USER_NOT_FOUND, "No user with that id could be found"))
+		return
+	}
+	// Otherwise this would be a way around another admin's two-factor
+	if user.IsAdmin {
+		c.Render.JSON(w, http.StatusBadRequest,
+			ApiErr(ERR_FORBIDDEN, "Admins can't be impersonated"))
+		return
+	}
+
+	authToken := models.NewImpersonationToken(user.Id, c.User.Id)
+	if err = c.Api.AuthToken.Save(authToken); err != nil {
+		clog.WithField("err", err).Error("Could not save auth token")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not sign in as that user, please try again soon"))
+		return
+	}
+
+	clog.Warn("Admin is impersonating user")
+	audit(c, req, c.User.Id, user.Id, models.AUDIT_IMPERSONATE, "auth_token",
+		authToken.Id, nil)
+
+	// Hydrate the user object
+	if err = c.Api.User.Hydrate([]*models.User{user}); err != nil {
+		clog.WithField("err", err).Error("Could not hydrate")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not sign in as that user, please try again soon"))
+		return
+	}
+
+	c.Render.JSON(w, http.StatusOK, map[string]interface{}{
+		"auth_user":  user,
+		"auth_token": authToken,
+	})
+}
@@ -10,5 +10,11 @@ func HandleIndex(c *Context, w http.ResponseWriter, req *http.Request) {
 	//if err := c.Publisher.Publish("testing", "", "Hello, world"); err != nil {
 	//	log.WithField("err", err).Error("Could not publish message")
 	//}
+	// Failing the health check gets the load balancer to stop sending us
+	// requests before we stop taking them
+	if ShuttingDown() {
+		c.Render.JSON(w, http.StatusServiceUnavailable, ApiErr(ERR_UNAVAILABLE, "Shutting down"))
+		return
+	}
 	c.Render.JSON(w, http.StatusOK, map[string]string{"hello": "world"})
 }
@@ -0,0 +1,42 @@
+package api
+
+import (
+	"net/http"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// HandleIpAllowlist lists the networks the user's organization allows its
+// members' tokens to be used from.  Every member can see it, so they can
+// tell why they're refused.
+func HandleIpAllowlist(c *Context, w http.ResponseWriter, req *http.Request) {
+	clog := c.Log().WithField("user_id", c.User.Id)
+
+	org, err := userOrganization(c.Api, c.User.Id)
+	if err != nil {
+		clog.WithField("err", err).Error("Could not look up organization")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not get your organization's IP allowlist, please try again soon"))
+		return
+	}
+	if org == nil {
+		c.Render.JSON(w, http.StatusNotFound,
+			ApiErr(ERR_NOT_FOUND, "You don't belong to an organization"))
+		return
+	}
+
+	entries, err := c.Api.IpAllowlist.ByOrganizationId(org.Id)
+	if err != nil {
+		clog.WithFields(log.Fields{
+			"err":             err,
+			"organization_id": org.Id,
+		}).Error("Could not get ip allowlist")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not get your organization's IP allowlist, please try again soon"))
+		return
+	}
+	c.Render.JSON(w, http.StatusOK, map[string]interface{}{
+		"entries": entries,
+		"your_ip": clientIp(req),
+	})
+}
@@ -0,0 +1,32 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/models"
+)
+
+// HandleJob is how a job that's being done for the user is going.
+func HandleJob(c *Context, w http.ResponseWriter, req *http.Request) {
+	id := c.Params.ByName("id")
+	clog := c.Log().WithFields(log.Fields{
+		"user_id": c.User.Id,
+		"job_id":  id,
+	})
+
+	job, err := c.Api.Job.ById(id)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up job")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not get that job, please try again soon"))
+		return
+	}
+	if job == nil || !job.UserId.Valid || job.UserId.String != c.User.Id {
+		c.Render.JSON(w, http.StatusNotFound, ApiErr(ERR_NOT_FOUND, "No job with that id was found"))
+		return
+	}
+
+	c.Render.JSON(w, http.StatusOK, map[string]*models.Job{"job": job})
+}
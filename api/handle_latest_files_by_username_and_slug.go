@@ -16,19 +16,19 @@ func HandleLatestFilesByUsernameAndSlug(c *Context, w http.ResponseWriter, req *
 	if c.User != nil {
 		fields["auth_user_id"] = c.User.Id
 	}
-	clog := log.WithFields(fields)
+	clog := c.Log().WithFields(fields)
 
 	user, err := c.Api.User.ByUsername(username)
 	if err != nil && err != sql.ErrNoRows {
 		clog.WithField("err", err).Error("Could not look up user by username")
 		c.Render.JSON(w, http.StatusBadGateway,
-			JsonErr("Could not get those files, please try again soon"))
+			ApiErr(ERR_UNAVAILABLE, "Could not get those files, please try again soon"))
 		return
 	}
 
 	if err == sql.ErrNoRows || user == nil {
 		c.Render.JSON(w, http.StatusNotFound,
-			JsonErr("No user by that username could be found"))
+			ApiErr(ERR_USER_NOT_FOUND, "No user by that username could be found"))
 		return
 	}
 
@@ -38,16 +38,15 @@ func HandleLatestFilesByUsernameAndSlug(c *Context, w http.ResponseWriter, req *
 	if err != nil && err != sql.ErrNoRows {
 		clog.WithField("err", err).Error("Could not look up model by username & slug")
 		c.Render.JSON(w, http.StatusBadGateway,
-			JsonErr("Could not get those files, please try again soon"))
+			ApiErr(ERR_UNAVAILABLE, "Could not get those files, please try again soon"))
 		return
 	}
 	if err == sql.ErrNoRows || m == nil {
-		c.Render.JSON(w, http.StatusNotFound, JsonErr("That model was not found"))
+		c.Render.JSON(w, http.StatusNotFound, ApiErr(ERR_MODEL_NOT_FOUND, "That model was not found"))
 		return
 	}
-	if m.Visibility == "private" && (c.User == nil || m.UserId != c.User.Id) {
-		c.Render.JSON(w, http.StatusUnauthorized,
-			JsonErr("You don't have permission to access those files"))
+	if !authorize(c, w, m, ACTION_READ,
+		"You don't have permission to access those files") {
 		return
 	}
 
@@ -57,7 +56,7 @@ func HandleLatestFilesByUsernameAndSlug(c *Context, w http.ResponseWriter, req *
 	if err != nil && err != sql.ErrNoRows {
 		clog.WithField("err", err).Error("Could not look up files by model id")
 		c.Render.JSON(w, http.StatusBadGateway,
-			JsonErr("Could not get those files, please try again soon"))
+			ApiErr(ERR_UNAVAILABLE, "Could not get those files, please try again soon"))
 		return
 	}
 
@@ -65,9 +64,12 @@ func HandleLatestFilesByUsernameAndSlug(c *Context, w http.ResponseWriter, req *
 	if err = c.Api.File.Hydrate(files); err != nil {
 		clog.WithField("err", err).Error("Could not hydrate file")
 		c.Render.JSON(w, http.StatusBadGateway,
-			JsonErr("Could not get those files, please try again soon"))
+			ApiErr(ERR_UNAVAILABLE, "Could not get those files, please try again soon"))
 		return
 	}
 
+	// Only send the metadata keys the client asked for
+	projectFileMetadata(req, files)
+
 	c.Render.JSON(w, http.StatusOK, map[string][]*models.File{"files": files})
 }
@@ -13,13 +13,35 @@ func HandleLatestPublicModels(c *Context, w http.ResponseWriter, req *http.Reque
 	if c.User != nil {
 		fields["auth_user_id"] = c.User.Id
 	}
-	clog := log.WithFields(fields)
+	clog := c.Log().WithFields(fields)
 
-	ms, err := c.Api.Model.ByVisibility("public", 10, "")
+	// Validation
+	filter, ok := modelFilter(c, w, req)
+	if !ok {
+		return
+	}
+	sort := req.URL.Query().Get("sort")
+	if sort == "" {
+		sort = models.MODEL_SORT_CREATED
+	}
+	if !models.ValidModelSort(sort) {
+		c.Render.JSON(w, http.StatusBadRequest,
+			ApiErr(ERR_INVALID_REQUEST, "Sort must be one of 'created', 'updated', 'downloads', 'stars', 'name'"))
+		return
+	}
+
+	kind := "public:" + sort
+	limit, after, err := pageParams(req, kind, 10, MaxPageSize)
+	if err != nil {
+		c.Render.JSON(w, http.StatusBadRequest, ApiErr(ERR_INVALID_REQUEST, err.Error()))
+		return
+	}
+
+	ms, next, err := c.Api.Model.ByVisibility("public", filter, sort, limit, after)
 	if err != nil && err != sql.ErrNoRows {
 		clog.WithField("err", err).Error("Could not look up latest public models")
 		c.Render.JSON(w, http.StatusBadGateway,
-			JsonErr("Could not get those models, please try again soon"))
+			ApiErr(ERR_UNAVAILABLE, "Could not get those models, please try again soon"))
 		return
 	}
 
@@ -27,39 +49,30 @@ func HandleLatestPublicModels(c *Context, w http.ResponseWriter, req *http.Reque
 	if err = c.Api.Model.Hydrate(ms); err != nil {
 		clog.WithField("err", err).Error("Could not hydrate")
 		c.Render.JSON(w, http.StatusBadGateway,
-			JsonErr("Could not get those models, please try again soon"))
+			ApiErr(ERR_UNAVAILABLE, "Could not get those models, please try again soon"))
 		return
 	}
 
-	// Build up a unique list of user ids in the keys of a map
-	userIdKeys := map[string]bool{}
-	for _, m := range ms {
-		userIdKeys[m.UserId] = true
-	}
-
-	// Now extract those user id keys into a slice
-	userIds := make([]interface{}, 0, len(userIdKeys))
-	for userId := range userIdKeys {
-		userIds = append(userIds, userId)
-	}
-
-	// Get a list of users based on those ids
-	users, err := c.Api.User.ByIds(userIds)
-	if err != nil && err != sql.ErrNoRows {
-		clog.WithFields(log.Fields{
-			"err":     err,
-			"userIds": userIds,
-		}).Error("Could not get users by id")
+	// Look up whoever owns the models, once each
+	users, err := c.Load.Owners(ms)
+	if err != nil {
+		clog.WithField("err", err).Error("Could not get users by id")
 		users = []*models.User{}
 	}
 
-	// Hydrate the user objects
-	if err = c.Api.User.Hydrate(users); err != nil {
-		clog.WithField("err", err).Error("Could not hydrate users")
+	resp := map[string]interface{}{
+		"models":      ms,
+		"users":       users,
+		"sort":        sort,
+		"next_cursor": nextCursor(kind, next),
 	}
-
-	c.Render.JSON(w, http.StatusOK, map[string]interface{}{
-		"models": ms,
-		"users":  users,
-	})
+	// Only counted when it's cheap, which it isn't with filters
+	if filter.Empty() {
+		if total, err := c.Api.Model.CountByVisibility("public"); err != nil {
+			clog.WithField("err", err).Error("Could not count public models")
+		} else {
+			resp["total"] = total
+		}
+	}
+	c.Render.JSON(w, http.StatusOK, resp)
 }
@@ -2,7 +2,6 @@ package api
 
 import (
 	"database/sql"
-	"encoding/json"
 	"net/http"
 
 	log "github.com/Sirupsen/logrus"
@@ -18,28 +17,28 @@ func HandleLogin(c *Context, w http.ResponseWriter, req *http.Request) {
 	defer req.Body.Close()
 
 	// Parse the JSON POST body
-	decoder := json.NewDecoder(req.Body)
 	var form LoginForm
-	if err := decoder.Decode(&form); err != nil {
-		msg := "Could not decode login form"
-		log.WithField("err", err).Error(msg)
-		c.Render.JSON(w, http.StatusBadRequest, JsonErr(msg))
+	if !decodeForm(c, w, req, c.Log().WithField("path", req.URL.Path), "login", &form) {
 		return
 	}
 
 	// TODO: Form validation / sanity / pre-auth check
 
-	clog := log.WithFields(log.Fields{
+	clog := c.Log().WithFields(log.Fields{
 		"email_or_username": form.EmailOrUsername,
 		"empty_password":    form.Password == "",
 	})
 
+	if loginThrottled(c, w, req, nil) {
+		return
+	}
+
 	// First let's check if we have a user with this e-mail address
 	user, err := c.Api.User.ByEmail(form.EmailOrUsername)
 	if err != nil && err != sql.ErrNoRows {
 		clog.WithField("err", err).Error("Could not look up user by email")
 		c.Render.JSON(w, http.StatusBadGateway,
-			JsonErr("Could not log you in, please try again soon"))
+			ApiErr(ERR_UNAVAILABLE, "Could not log you in, please try again soon"))
 		return
 	}
 
@@ -49,45 +48,112 @@ func HandleLogin(c *Context, w http.ResponseWriter, req *http.Request) {
 		if err != nil && err != sql.ErrNoRows {
 			clog.WithField("err", err).Error("Could not look up user by username")
 			c.Render.JSON(w, http.StatusBadGateway,
-				JsonErr("Could not log you in, please try again soon"))
+				ApiErr(ERR_UNAVAILABLE, "Could not log you in, please try again soon"))
 			return
 		}
 	}
 
 	if err == sql.ErrNoRows {
+		loginFailed(c, req, nil)
+		audit(c, req, "", "", models.AUDIT_LOGIN_FAILED, "", "",
+			map[string]interface{}{"email_or_username": form.EmailOrUsername})
+		c.Render.JSON(w, http.StatusUnauthorized,
+			ApiErr(ERR_INVALID_CREDENTIALS, "No user by that e-mail or username was found"))
+		return
+	}
+
+	if user.IsService() {
 		c.Render.JSON(w, http.StatusUnauthorized,
-			JsonErr("No user by that e-mail or username was found"))
+			ApiErr(ERR_FORBIDDEN, "Service accounts can't sign in, use one of their API tokens"))
+		return
+	}
+	if user.Locked() {
+		c.Render.JSON(w, http.StatusForbidden,
+			ApiErr(ERR_ACCOUNT_LOCKED, "This account is locked after too many failed logins, "+
+				"check your e-mail to unlock it"))
+		return
+	}
+	if loginThrottled(c, w, req, user) {
+		return
+	}
+
+	// People in a domain with single sign-on have to sign in through it
+	conn, err := c.Api.SsoConnection.ByDomain(models.EmailDomain(user.Email))
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up sso connection")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not log you in, please try again soon"))
+		return
+	}
+	if conn != nil && conn.Enabled {
+		c.Render.JSON(w, http.StatusUnauthorized, map[string]interface{}{
+			"code":  ERR_SSO_REQUIRED,
+			"error": "Your organization signs in with single sign-on",
+			"sso":   true,
+		})
 		return
 	}
 
 	// Check their password
 	if user.CheckPassword(form.Password) == nil {
+		if user.FailedLogins > 0 || user.LockedUntil.Valid {
+			if err = c.Api.User.ResetFailedLogins(user.Id); err != nil {
+				clog.WithField("err", err).Error("Could not reset failed logins")
+			}
+		}
+		// After a leak the password might be known to someone else, so it
+		// has to be replaced through a link sent to their e-mail address
+		if user.MustChangePassword {
+			goBackground(func() { sendPasswordResetEmail(c.Mailer, user) })
+			c.Render.JSON(w, http.StatusForbidden, map[string]interface{}{
+				"code": ERR_PASSWORD_CHANGE_REQUIRED,
+				"error": "You need to choose a new password, we've e-mailed " +
+					"you a link to do so",
+				"password_change_required": true,
+			})
+			return
+		}
+		// If they have two-factor authentication, they only get far enough
+		// to enter their code
+		if user.TotpEnabled {
+			pendingRespond(c, w, clog, user)
+			return
+		}
 		// If it's correct, create a new auth token for this user
 		authToken := models.NewAuthToken(user.Id)
 		if err = c.Api.AuthToken.Save(authToken); err != nil {
 			clog.WithField("err", err).Error("Could not save user")
 			c.Render.JSON(w, http.StatusBadGateway,
-				JsonErr("Could not log you in, please try again soon"))
+				ApiErr(ERR_UNAVAILABLE, "Could not log you in, please try again soon"))
+			return
+		}
+		refreshToken := models.NewRefreshToken(user.Id)
+		if err = c.Api.RefreshToken.Save(refreshToken); err != nil {
+			clog.WithField("err", err).Error("Could not save refresh token")
+			c.Render.JSON(w, http.StatusBadGateway,
+				ApiErr(ERR_UNAVAILABLE, "Could not log you in, please try again soon"))
 			return
 		}
 		// Hydrate the user object
 		if err = c.Api.User.Hydrate([]*models.User{user}); err != nil {
 			clog.WithField("err", err).Error("Could not hydrate")
 			c.Render.JSON(w, http.StatusBadGateway,
-				JsonErr("Could not log you in, please try again soon"))
+				ApiErr(ERR_UNAVAILABLE, "Could not log you in, please try again soon"))
 			return
 		}
-		// Return the user object and the new auth token
-		c.Render.JSON(w, http.StatusOK, map[string]interface{}{
-			"auth_user":  user,
-			"auth_token": authToken,
-		})
+		audit(c, req, user.Id, user.Id, models.AUDIT_LOGIN, "auth_token",
+			authToken.Id, map[string]interface{}{"method": "password"})
+		// Return the user object and the new auth and refresh tokens
+		sessionRespond(c, w, req, user, authToken, refreshToken)
 	} else {
 		// If the password is incorrect, return a message saying so
 		// (Yes, I know it's safer to be vague about this error, but it's so much
 		//  better as a user to get a helpful message that I'm willing to make this
 		//  tradeoff until convinced otherwise.)
+		loginFailed(c, req, user)
+		audit(c, req, "", user.Id, models.AUDIT_LOGIN_FAILED, "", "",
+			map[string]interface{}{"email_or_username": form.EmailOrUsername})
 		c.Render.JSON(w, http.StatusUnauthorized,
-			JsonErr("Password didn't match, please re-type it or try another one"))
+			ApiErr(ERR_INVALID_CREDENTIALS, "Password didn't match, please re-type it or try another one"))
 	}
 }
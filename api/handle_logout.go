@@ -1,25 +1,52 @@
 package api
 
 import (
+	"encoding/json"
 	"net/http"
 
 	log "github.com/Sirupsen/logrus"
 )
 
+type LogoutForm struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
 func HandleLogout(c *Context, w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+
+	// The body is optional, and only needed to revoke the refresh token too
+	var form LogoutForm
+	json.NewDecoder(req.Body).Decode(&form)
+
+	// Browser sessions are logged out of by clearing their cookies too
+	if cookie, err := req.Cookie(REFRESH_COOKIE); err == nil {
+		if form.RefreshToken == "" {
+			form.RefreshToken = cookie.Value
+		}
+		clearSessionCookies(w)
+	} else if _, err := req.Cookie(SESSION_COOKIE); err == nil {
+		clearSessionCookies(w)
+	}
+
+	if form.RefreshToken != "" {
+		if err := c.Api.RefreshToken.Delete(form.RefreshToken); err != nil {
+			c.Log().WithField("err", err).Info("Could not delete refresh token")
+		}
+	}
+
 	if c.AuthToken == nil {
 		c.Render.JSON(w, http.StatusOK, map[string]string{"status": "ok"})
 		return
 	}
 
 	if err := c.Api.AuthToken.Delete(c.AuthToken.Id); err != nil {
-		log.WithFields(log.Fields{
+		c.Log().WithFields(log.Fields{
 			"err":           err,
 			"auth_token_id": c.AuthToken.Id,
 			"user_id":       c.User.Id,
 		}).Error("Could not delete auth token")
 		c.Render.JSON(w, http.StatusBadGateway,
-			JsonErr("Could not log you out, please try again soon"))
+			ApiErr(ERR_UNAVAILABLE, "Could not log you out, please try again soon"))
 		return
 	}
 	c.Render.JSON(w, http.StatusOK, map[string]string{"status": "ok"})
@@ -6,6 +6,7 @@ import (
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/ericflo/gradientzoo/models"
+	"gopkg.in/guregu/null.v3/zero"
 )
 
 func HandleModelByUsernameAndSlug(c *Context, w http.ResponseWriter, req *http.Request) {
@@ -16,19 +17,19 @@ func HandleModelByUsernameAndSlug(c *Context, w http.ResponseWriter, req *http.R
 	if c.User != nil {
 		fields["auth_user_id"] = c.User.Id
 	}
-	clog := log.WithFields(fields)
+	clog := c.Log().WithFields(fields)
 
 	user, err := c.Api.User.ByUsername(username)
 	if err != nil && err != sql.ErrNoRows {
 		clog.WithField("err", err).Error("Could not look up user by username")
 		c.Render.JSON(w, http.StatusBadGateway,
-			JsonErr("Could not get that model, please try again soon"))
+			ApiErr(ERR_UNAVAILABLE, "Could not get that model, please try again soon"))
 		return
 	}
 
 	if err == sql.ErrNoRows || user == nil {
 		c.Render.JSON(w, http.StatusNotFound,
-			JsonErr("No user by that username could be found"))
+			ApiErr(ERR_USER_NOT_FOUND, "No user by that username could be found"))
 		return
 	}
 
@@ -38,16 +39,15 @@ func HandleModelByUsernameAndSlug(c *Context, w http.ResponseWriter, req *http.R
 	if err != nil && err != sql.ErrNoRows {
 		clog.WithField("err", err).Error("Could not look up model by username & slug")
 		c.Render.JSON(w, http.StatusBadGateway,
-			JsonErr("Could not get that model, please try again soon"))
+			ApiErr(ERR_UNAVAILABLE, "Could not get that model, please try again soon"))
 		return
 	}
 	if m == nil || err == sql.ErrNoRows {
-		c.Render.JSON(w, http.StatusNotFound, JsonErr("That model was not found"))
+		c.Render.JSON(w, http.StatusNotFound, ApiErr(ERR_MODEL_NOT_FOUND, "That model was not found"))
 		return
 	}
-	if m.Visibility == "private" && (c.User == nil || m.UserId != c.User.Id) {
-		c.Render.JSON(w, http.StatusUnauthorized,
-			JsonErr("You don't have permission to access this file"))
+	if !authorize(c, w, m, ACTION_READ,
+		"You don't have permission to access this file") {
 		return
 	}
 
@@ -57,9 +57,41 @@ func HandleModelByUsernameAndSlug(c *Context, w http.ResponseWriter, req *http.R
 	if err = c.Api.Model.Hydrate([]*models.Model{m}); err != nil {
 		clog.WithField("err", err).Error("Could not hydrate")
 		c.Render.JSON(w, http.StatusBadGateway,
-			JsonErr("Could not get that model, please try again soon"))
+			ApiErr(ERR_UNAVAILABLE, "Could not get that model, please try again soon"))
 		return
 	}
 
-	c.Render.JSON(w, http.StatusOK, map[string]*models.Model{"model": m})
+	// Serve the readme in whichever language suits the reader best
+	translations, err := c.Api.ModelReadme.Languages(m.Id)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up readme translations")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not get that model, please try again soon"))
+		return
+	}
+	languages := append([]string{m.ReadmeLanguage}, translations...)
+	language := bestLanguage(req.Header.Get("Accept-Language"), languages,
+		m.ReadmeLanguage)
+	if language != m.ReadmeLanguage {
+		r, err := c.Api.ModelReadme.Get(m.Id, language)
+		if err != nil && err != sql.ErrNoRows {
+			clog.WithField("err", err).Error("Could not look up readme translation")
+			c.Render.JSON(w, http.StatusBadGateway,
+				ApiErr(ERR_UNAVAILABLE, "Could not get that model, please try again soon"))
+			return
+		}
+		if r != nil && err != sql.ErrNoRows {
+			m.HydratedReadme = zero.StringFrom(r.Readme)
+		} else {
+			// It was removed since the languages were looked up
+			language = m.ReadmeLanguage
+		}
+	}
+	readmeLanguageHeaders(w, language)
+
+	c.Render.JSON(w, http.StatusOK, map[string]interface{}{
+		"model":            m,
+		"readme_language":  language,
+		"readme_languages": languages,
+	})
 }
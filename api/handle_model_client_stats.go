@@ -0,0 +1,61 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+const maxClientStatsRange = 366 * 24 * time.Hour
+
+func HandleModelClientStats(c *Context, w http.ResponseWriter, req *http.Request) {
+	fields := log.Fields{
+		"username": c.Params.ByName("username"),
+		"slug":     c.Params.ByName("slug"),
+	}
+	if c.User != nil {
+		fields["auth_user_id"] = c.User.Id
+	}
+	clog := c.Log().WithFields(fields)
+
+	start, end, ok := statsRange(c, w, req, 30*24*time.Hour, maxClientStatsRange)
+	if !ok {
+		return
+	}
+
+	m := accessModel(c, w, clog)
+	if m == nil {
+		return
+	}
+	if !authorize(c, w, m, ACTION_READ,
+		"You don't have permission to access this model") {
+		return
+	}
+
+	clog = clog.WithField("model_id", m.Id)
+
+	api := c.Api
+	cached, err := cachedStats(req, "clients", m.Id, "", start, end,
+		func(start, end time.Time) (interface{}, error) {
+			clients, err := api.DownloadClient.ByModelId(m.Id, start, end)
+			if err == sql.ErrNoRows {
+				err = nil
+			}
+			return clients, err
+		})
+	if err != nil {
+		clog.WithField("err", err).Error("Could not look up downloads by client")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not get those stats, please try again soon"))
+		return
+	}
+
+	c.Render.JSON(w, http.StatusOK, map[string]interface{}{
+		"start":         cached.Start,
+		"end":           cached.End,
+		"clients":       cached.Value,
+		"computed_time": cached.Computed,
+	})
+}
@@ -0,0 +1,132 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/models"
+)
+
+// comparedModel is one side of a comparison, with its downloads in each of the
+// comparison's buckets
+type comparedModel struct {
+	Model     *models.Model `json:"model"`
+	Downloads int           `json:"downloads"`
+	Series    []int         `json:"series"`
+}
+
+func HandleModelCompareStats(c *Context, w http.ResponseWriter, req *http.Request) {
+	with := req.URL.Query().Get("with")
+	granularity := req.URL.Query().Get("granularity")
+
+	fields := log.Fields{
+		"username":    c.Params.ByName("username"),
+		"slug":        c.Params.ByName("slug"),
+		"with":        with,
+		"granularity": granularity,
+	}
+	if c.User != nil {
+		fields["auth_user_id"] = c.User.Id
+	}
+	clog := c.Log().WithFields(fields)
+
+	// Validation
+	parts := strings.Split(with, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		c.Render.JSON(w, http.StatusBadRequest,
+			ApiErr(ERR_INVALID_REQUEST, "With must be the model to compare to, like username/slug"))
+		return
+	}
+	granularity, ok := statsGranularity(c, w, granularity)
+	if !ok {
+		return
+	}
+	start, end, ok := statsRange(c, w, req, defaultStatsRange[granularity],
+		maxStatsRange[granularity])
+	if !ok {
+		return
+	}
+
+	m := accessModel(c, w, clog)
+	if m == nil {
+		return
+	}
+	if !authorize(c, w, m, ACTION_READ,
+		"You don't have permission to access this model") {
+		return
+	}
+	other := lookupModel(c, w, clog, parts[0], parts[1])
+	if other == nil {
+		return
+	}
+	if !authorize(c, w, other, ACTION_READ,
+		"You don't have permission to access the model to compare to") {
+		return
+	}
+
+	clog = clog.WithFields(log.Fields{"model_id": m.Id, "with_model_id": other.Id})
+
+	// Both sides are cached on their own, so comparing against a popular model
+	// shares its series with everyone else doing the same
+	api := c.Api
+	compared := []*comparedModel{}
+	var cachedStart, cachedEnd, computed time.Time
+	buckets := map[int]map[time.Time]int{}
+	for i, cm := range []*models.Model{m, other} {
+		modelId := cm.Id
+		cached, err := cachedStats(req, "total", modelId, granularity, start, end,
+			func(start, end time.Time) (interface{}, error) {
+				points, err := api.DownloadHour.TotalSeries(modelId, granularity, start, end)
+				if err == sql.ErrNoRows {
+					err = nil
+				}
+				return points, err
+			})
+		if err != nil {
+			clog.WithField("err", err).Error("Could not look up download series")
+			c.Render.JSON(w, http.StatusBadGateway,
+				ApiErr(ERR_UNAVAILABLE, "Could not get those stats, please try again soon"))
+			return
+		}
+		// The sides can have been cached at different times, so the range
+		// shown is the first side's, and the oldest computed time
+		if i == 0 {
+			cachedStart, cachedEnd, computed = cached.Start, cached.End, cached.Computed
+		} else if cached.Computed.Before(computed) {
+			computed = cached.Computed
+		}
+		buckets[i] = map[time.Time]int{}
+		for _, p := range cached.Value.([]*models.ModelPoint) {
+			buckets[i][p.Time.UTC()] += p.Downloads
+		}
+		compared = append(compared, &comparedModel{Model: cm, Series: []int{}})
+	}
+
+	// Every bucket in the range is there for both, downloaded in or not, so
+	// the two series line up one for one
+	step := 24 * time.Hour
+	if granularity == models.GRANULARITY_HOUR {
+		step = time.Hour
+	}
+	times := []time.Time{}
+	for t := cachedStart.UTC().Truncate(step); t.Before(cachedEnd); t = t.Add(step) {
+		times = append(times, t)
+		for i, cm := range compared {
+			n := buckets[i][t]
+			cm.Downloads += n
+			cm.Series = append(cm.Series, n)
+		}
+	}
+
+	c.Render.JSON(w, http.StatusOK, map[string]interface{}{
+		"granularity":   granularity,
+		"start":         cachedStart,
+		"end":           cachedEnd,
+		"times":         times,
+		"models":        compared,
+		"computed_time": computed,
+	})
+}
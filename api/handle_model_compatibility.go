@@ -0,0 +1,87 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"sort"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/models"
+)
+
+func HandleModelCompatibility(c *Context, w http.ResponseWriter, req *http.Request) {
+	username := c.Params.ByName("username")
+	slug := c.Params.ByName("slug")
+
+	fields := log.Fields{"username": username, "slug": slug}
+	if c.User != nil {
+		fields["auth_user_id"] = c.User.Id
+	}
+	clog := c.Log().WithFields(fields)
+
+	user, err := c.Api.User.ByUsername(username)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up user by username")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not get that compatibility summary, please try again soon"))
+		return
+	}
+	if err == sql.ErrNoRows || user == nil {
+		c.Render.JSON(w, http.StatusNotFound,
+			ApiErr(ERR_USER_NOT_FOUND, "No user by that username could be found"))
+		return
+	}
+
+	clog = clog.WithField("user_id", user.Id)
+
+	m, err := c.Api.Model.ByUserIdSlug(user.Id, slug)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up model by username & slug")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not get that compatibility summary, please try again soon"))
+		return
+	}
+	if err == sql.ErrNoRows || m == nil {
+		c.Render.JSON(w, http.StatusNotFound, ApiErr(ERR_MODEL_NOT_FOUND, "That model was not found"))
+		return
+	}
+	if !authorize(c, w, m, ACTION_READ,
+		"You don't have permission to access this model") {
+		return
+	}
+
+	clog = clog.WithField("model_id", m.Id)
+
+	compat, err := c.Api.File.Compatibility(m.Id)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up framework compatibility")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not get that compatibility summary, please try again soon"))
+		return
+	}
+
+	// Also list every framework version each framework has been used with,
+	// oldest first
+	frameworks := map[string][]string{}
+	for _, fc := range compat {
+		versions := frameworks[fc.Framework]
+		found := false
+		for _, v := range versions {
+			if v == fc.FrameworkVersion {
+				found = true
+				break
+			}
+		}
+		if !found {
+			frameworks[fc.Framework] = append(versions, fc.FrameworkVersion)
+		}
+	}
+	for _, versions := range frameworks {
+		sort.Sort(models.ByVersion(versions))
+	}
+
+	c.Render.JSON(w, http.StatusOK, map[string]interface{}{
+		"compatibility": compat,
+		"frameworks":    frameworks,
+	})
+}
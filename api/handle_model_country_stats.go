@@ -0,0 +1,77 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/models"
+)
+
+// Countries with fewer downloads than this are lumped together, so that a
+// handful of downloads can't be pinned on the one person in some small place
+const minCountryDownloads = 5
+
+const maxCountryStatsRange = 366 * 24 * time.Hour
+
+func HandleModelCountryStats(c *Context, w http.ResponseWriter, req *http.Request) {
+	fields := log.Fields{
+		"username": c.Params.ByName("username"),
+		"slug":     c.Params.ByName("slug"),
+	}
+	if c.User != nil {
+		fields["auth_user_id"] = c.User.Id
+	}
+	clog := c.Log().WithFields(fields)
+
+	start, end, ok := statsRange(c, w, req, 30*24*time.Hour, maxCountryStatsRange)
+	if !ok {
+		return
+	}
+
+	m := accessModel(c, w, clog)
+	if m == nil {
+		return
+	}
+	if !authorize(c, w, m, ACTION_READ,
+		"You don't have permission to access this model") {
+		return
+	}
+
+	clog = clog.WithField("model_id", m.Id)
+
+	api := c.Api
+	cached, err := cachedStats(req, "countries", m.Id, "", start, end,
+		func(start, end time.Time) (interface{}, error) {
+			countries, err := api.DownloadCountry.ByModelId(m.Id, start, end)
+			if err == sql.ErrNoRows {
+				err = nil
+			}
+			return countries, err
+		})
+	if err != nil {
+		clog.WithField("err", err).Error("Could not look up downloads by country")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not get those stats, please try again soon"))
+		return
+	}
+
+	shown := []*models.CountryDownloads{}
+	other := 0
+	for _, cd := range cached.Value.([]*models.CountryDownloads) {
+		if cd.Downloads < minCountryDownloads {
+			other += cd.Downloads
+		} else {
+			shown = append(shown, cd)
+		}
+	}
+
+	c.Render.JSON(w, http.StatusOK, map[string]interface{}{
+		"start":         cached.Start,
+		"end":           cached.End,
+		"countries":     shown,
+		"other":         other,
+		"computed_time": cached.Computed,
+	})
+}
@@ -0,0 +1,93 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+const DefaultFeedPageSize = 100
+const MaxFeedPageSize = 1000
+
+// HandleModelFeed lists public models by when they were last updated, so that
+// aggregators can start from ?since= and keep following next_cursor to pick up
+// only what's changed.
+func HandleModelFeed(c *Context, w http.ResponseWriter, req *http.Request) {
+	since := req.URL.Query().Get("since")
+	cursor := req.URL.Query().Get("cursor")
+
+	fields := log.Fields{"since": since, "cursor": cursor}
+	if c.User != nil {
+		fields["auth_user_id"] = c.User.Id
+	}
+	clog := c.Log().WithFields(fields)
+
+	// Validation
+	limit := DefaultFeedPageSize
+	if limitStr := req.URL.Query().Get("limit"); limitStr != "" {
+		var err error
+		if limit, err = strconv.Atoi(limitStr); err != nil || limit < 1 {
+			c.Render.JSON(w, http.StatusBadRequest,
+				ApiErr(ERR_INVALID_REQUEST, "Limit must be a positive number"))
+			return
+		}
+		if limit > MaxFeedPageSize {
+			limit = MaxFeedPageSize
+		}
+	}
+	var afterTime time.Time
+	var afterModelId string
+	if cursor != "" {
+		var err error
+		if afterTime, afterModelId, err = parseFeedCursor(cursor); err != nil {
+			c.Render.JSON(w, http.StatusBadRequest, ApiErr(ERR_INVALID_REQUEST, err.Error()))
+			return
+		}
+	} else if since != "" {
+		var err error
+		if afterTime, err = time.Parse(time.RFC3339, since); err != nil {
+			c.Render.JSON(w, http.StatusBadRequest,
+				ApiErr(ERR_INVALID_REQUEST, "Since must be an RFC 3339 time, like 2016-06-01T00:00:00Z"))
+			return
+		}
+	}
+
+	feed, err := c.Api.Model.Feed(afterTime, afterModelId, limit)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not get model feed")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not get those models, please try again soon"))
+		return
+	}
+
+	// Even a short page gets a cursor, since there may be more updates by the
+	// time the client comes back
+	next := cursor
+	if len(feed) > 0 {
+		next = feedCursor(feed[len(feed)-1])
+	}
+
+	items := make([]map[string]interface{}, 0, len(feed))
+	for _, m := range feed {
+		items = append(items, map[string]interface{}{
+			"id":           m.Id,
+			"username":     m.Username,
+			"slug":         m.Slug,
+			"name":         m.Name,
+			"description":  m.Description,
+			"license":      m.License,
+			"url":          modelUrl(m.Username, m.Slug),
+			"created_time": m.CreatedTime,
+			"updated_time": m.UpdatedTime,
+		})
+	}
+
+	c.Render.JSON(w, http.StatusOK, map[string]interface{}{
+		"models":      items,
+		"has_more":    len(feed) == limit,
+		"next_cursor": next,
+	})
+}
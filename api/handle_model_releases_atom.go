@@ -0,0 +1,64 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// HandleModelReleasesAtom is an Atom feed of every file version uploaded to a
+// public model, newest first.
+func HandleModelReleasesAtom(c *Context, w http.ResponseWriter, req *http.Request) {
+	username := c.Params.ByName("username")
+	slug := c.Params.ByName("slug")
+
+	clog := c.Log().WithFields(log.Fields{
+		"feed":     "model_releases",
+		"username": username,
+		"slug":     slug,
+	})
+
+	m := lookupModel(c, w, clog, username, slug)
+	if m == nil {
+		return
+	}
+	// Feed readers are anonymous, so only public models have feeds
+	if m.Visibility != "public" {
+		c.Render.JSON(w, http.StatusNotFound, ApiErr(ERR_MODEL_NOT_FOUND, "That model was not found"))
+		return
+	}
+
+	clog = clog.WithField("model_id", m.Id)
+
+	files, err := c.Api.File.Releases(m.Id, atomFeedSize)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up model releases")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not get that feed, please try again soon"))
+		return
+	}
+
+	url := modelUrl(username, m.Slug)
+	entries := make([]*atomEntry, 0, len(files))
+	for _, f := range files {
+		summary := fmt.Sprintf("%s, %d bytes, sha256 %s", f.Framework, f.SizeBytes, f.Sha256)
+		if f.FrameworkVersion != "" {
+			summary = fmt.Sprintf("%s %s, %d bytes, sha256 %s",
+				f.Framework, f.FrameworkVersion, f.SizeBytes, f.Sha256)
+		}
+		entries = append(entries, &atomEntry{
+			Id:        "urn:uuid:" + f.Id,
+			Title:     fmt.Sprintf("%s: new version of %s", m.Name, f.Filename),
+			Link:      &atomLink{Rel: "alternate", Href: url},
+			Author:    &atomPerson{Name: username, Uri: userUrl(username)},
+			Published: atomTime(f.CreatedTime),
+			Updated:   atomTime(f.CreatedTime),
+			Summary:   &atomText{Type: "text", Body: summary},
+		})
+	}
+
+	title := m.Name + " releases on Gradientzoo"
+	renderAtom(w, newAtomFeed(title, url, entries), clog)
+}
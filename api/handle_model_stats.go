@@ -0,0 +1,76 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/models"
+)
+
+func HandleModelStats(c *Context, w http.ResponseWriter, req *http.Request) {
+	granularity := req.URL.Query().Get("granularity")
+
+	fields := log.Fields{
+		"username":    c.Params.ByName("username"),
+		"slug":        c.Params.ByName("slug"),
+		"granularity": granularity,
+	}
+	if c.User != nil {
+		fields["auth_user_id"] = c.User.Id
+	}
+	clog := c.Log().WithFields(fields)
+
+	// Validation
+	granularity, ok := statsGranularity(c, w, granularity)
+	if !ok {
+		return
+	}
+	start, end, ok := statsRange(c, w, req, defaultStatsRange[granularity],
+		maxStatsRange[granularity])
+	if !ok {
+		return
+	}
+
+	m := accessModel(c, w, clog)
+	if m == nil {
+		return
+	}
+	if !authorize(c, w, m, ACTION_READ,
+		"You don't have permission to access this model") {
+		return
+	}
+
+	clog = clog.WithField("model_id", m.Id)
+
+	api := c.Api
+	cached, err := cachedStats(req, "series", m.Id, granularity, start, end,
+		func(start, end time.Time) (interface{}, error) {
+			points, err := api.DownloadHour.SeriesByModel(m.Id, granularity, start, end)
+			if err == sql.ErrNoRows {
+				err = nil
+			}
+			return points, err
+		})
+	if err != nil {
+		clog.WithField("err", err).Error("Could not look up download series")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not get those stats, please try again soon"))
+		return
+	}
+
+	// Split the points up by filename, each series staying oldest first
+	series := map[string][]*models.DownloadPoint{}
+	for _, p := range cached.Value.([]*models.DownloadPoint) {
+		series[p.Filename] = append(series[p.Filename], p)
+	}
+
+	c.Render.JSON(w, http.StatusOK, map[string]interface{}{
+		"granularity":   granularity,
+		"start":         cached.Start,
+		"end":           cached.End,
+		"files":         series,
+		"computed_time": cached.Computed,
+	})
+}
@@ -0,0 +1,147 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/models"
+)
+
+// versionStats is how one version of a file has been downloaded over the range
+type versionStats struct {
+	File      *models.File           `json:"file"`
+	Downloads int                    `json:"downloads"`
+	Series    []*models.VersionPoint `json:"series"`
+}
+
+// adoptionPoint is the share of a bucket's downloads that went to the newest
+// version, which climbs towards 1 as downloaders move over to it
+type adoptionPoint struct {
+	Time  time.Time `json:"time"`
+	Share float64   `json:"share"`
+}
+
+func HandleModelVersionStats(c *Context, w http.ResponseWriter, req *http.Request) {
+	filename := req.URL.Query().Get("filename")
+	granularity := req.URL.Query().Get("granularity")
+
+	fields := log.Fields{
+		"username":    c.Params.ByName("username"),
+		"slug":        c.Params.ByName("slug"),
+		"filename":    filename,
+		"granularity": granularity,
+	}
+	if c.User != nil {
+		fields["auth_user_id"] = c.User.Id
+	}
+	clog := c.Log().WithFields(fields)
+
+	// Validation
+	if filename == "" {
+		c.Render.JSON(w, http.StatusBadRequest, ApiErr(ERR_INVALID_REQUEST, "Filename is required"))
+		return
+	}
+	granularity, ok := statsGranularity(c, w, granularity)
+	if !ok {
+		return
+	}
+	start, end, ok := statsRange(c, w, req, defaultStatsRange[granularity],
+		maxStatsRange[granularity])
+	if !ok {
+		return
+	}
+
+	m := accessModel(c, w, clog)
+	if m == nil {
+		return
+	}
+	if !authorize(c, w, m, ACTION_READ,
+		"You don't have permission to access this model") {
+		return
+	}
+
+	clog = clog.WithField("model_id", m.Id)
+
+	// Newest first
+	files, err := c.Api.File.ByModelIdFilename(m.Id, filename)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up file versions")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not get those stats, please try again soon"))
+		return
+	}
+	if len(files) == 0 {
+		c.Render.JSON(w, http.StatusNotFound,
+			ApiErr(ERR_FILE_NOT_FOUND, "Could not find any versions of "+filename))
+		return
+	}
+
+	api := c.Api
+	cached, err := cachedStats(req, "versions:"+filename, m.Id, granularity, start, end,
+		func(start, end time.Time) (interface{}, error) {
+			points, err := api.DownloadHour.VersionSeries(m.Id, filename, granularity, start, end)
+			if err == sql.ErrNoRows {
+				err = nil
+			}
+			return points, err
+		})
+	if err != nil {
+		clog.WithField("err", err).Error("Could not look up version series")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not get those stats, please try again soon"))
+		return
+	}
+
+	versions := make([]*versionStats, 0, len(files))
+	byId := map[string]*versionStats{}
+	for _, f := range files {
+		v := &versionStats{File: f, Series: []*models.VersionPoint{}}
+		versions = append(versions, v)
+		byId[f.Id] = v
+	}
+
+	// Points come oldest first, so the adoption series does too
+	newestId := files[0].Id
+	adoption := []*adoptionPoint{}
+	var bucket time.Time
+	bucketTotal, bucketNewest := 0, 0
+	flush := func() {
+		if bucketTotal > 0 {
+			adoption = append(adoption, &adoptionPoint{
+				Time:  bucket,
+				Share: float64(bucketNewest) / float64(bucketTotal),
+			})
+		}
+	}
+	for _, p := range cached.Value.([]*models.VersionPoint) {
+		v, ok := byId[p.FileId]
+		if !ok {
+			// Deleted since it was downloaded
+			continue
+		}
+		v.Downloads += p.Downloads
+		v.Series = append(v.Series, p)
+
+		if !p.Time.Equal(bucket) {
+			flush()
+			bucket, bucketTotal, bucketNewest = p.Time, 0, 0
+		}
+		bucketTotal += p.Downloads
+		if p.FileId == newestId {
+			bucketNewest += p.Downloads
+		}
+	}
+	flush()
+
+	c.Render.JSON(w, http.StatusOK, map[string]interface{}{
+		"filename":      filename,
+		"granularity":   granularity,
+		"start":         cached.Start,
+		"end":           cached.End,
+		"versions":      versions,
+		"adoption":      adoption,
+		"computed_time": cached.Computed,
+	})
+}
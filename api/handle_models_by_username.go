@@ -15,46 +15,49 @@ func HandleModelsByUsername(c *Context, w http.ResponseWriter, req *http.Request
 	if c.User != nil {
 		fields["auth_user_id"] = c.User.Id
 	}
-	clog := log.WithFields(fields)
+	clog := c.Log().WithFields(fields)
 
 	user, err := c.Api.User.ByUsername(username)
 	if err != nil && err != sql.ErrNoRows {
 		clog.WithField("err", err).Error("Could not look up user by username")
 		c.Render.JSON(w, http.StatusBadGateway,
-			JsonErr("Could not get those models, please try again soon"))
+			ApiErr(ERR_UNAVAILABLE, "Could not get those models, please try again soon"))
 		return
 	}
 
 	if err == sql.ErrNoRows || user == nil {
 		c.Render.JSON(w, http.StatusNotFound,
-			JsonErr("No user by that username could be found"))
+			ApiErr(ERR_USER_NOT_FOUND, "No user by that username could be found"))
 		return
 	}
 
 	clog = clog.WithField("user_id", user.Id)
 
-	ms, err := c.Api.Model.ByUserId(user.Id)
+	kind := "user_models:" + user.Id
+	limit, after, err := pageParams(req, kind, MaxPageSize, MaxPageSize)
+	if err != nil {
+		c.Render.JSON(w, http.StatusBadRequest, ApiErr(ERR_INVALID_REQUEST, err.Error()))
+		return
+	}
+
+	// Pages can come back short once models the user can't see are filtered
+	// out, so it's next_cursor that says whether there are more
+	ms, next, err := c.Api.Model.ByUserIdPage(user.Id, limit, after)
 	if err != nil && err != sql.ErrNoRows {
 		clog.WithField("err", err).Error("Could not look up models by username")
 		c.Render.JSON(w, http.StatusBadGateway,
-			JsonErr("Could not get those models, please try again soon"))
+			ApiErr(ERR_UNAVAILABLE, "Could not get those models, please try again soon"))
 		return
 	}
 
 	// Filter out any models the user isn't allowed to see
-	filteredModels := make([]*models.Model, 0, len(ms))
-	for _, m := range ms {
-		if m.Visibility == "private" && (c.User == nil || m.UserId != c.User.Id) {
-			continue
-		}
-		filteredModels = append(filteredModels, m)
-	}
+	filteredModels := visibleModels(c, ms)
 
 	// Hydrate the model objects
 	if err = c.Api.Model.Hydrate(filteredModels); err != nil {
 		clog.WithField("err", err).Error("Could not hydrate")
 		c.Render.JSON(w, http.StatusBadGateway,
-			JsonErr("Could not get those models, please try again soon"))
+			ApiErr(ERR_UNAVAILABLE, "Could not get those models, please try again soon"))
 		return
 	}
 
@@ -62,14 +65,15 @@ func HandleModelsByUsername(c *Context, w http.ResponseWriter, req *http.Request
 
 	// Hydrate the user object
 	if err = c.Api.User.Hydrate(users); err != nil {
-		log.WithFields(log.Fields{
+		c.Log().WithFields(log.Fields{
 			"err":     err,
 			"user_id": user.Id,
 		}).Error("Could not hydrate")
 	}
 
 	c.Render.JSON(w, http.StatusOK, map[string]interface{}{
-		"models": filteredModels,
-		"users":  users,
+		"models":      filteredModels,
+		"users":       users,
+		"next_cursor": nextCursor(kind, next),
 	})
 }
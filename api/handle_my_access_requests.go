@@ -0,0 +1,19 @@
+package api
+
+import (
+	"net/http"
+)
+
+func HandleMyAccessRequests(c *Context, w http.ResponseWriter, req *http.Request) {
+	clog := c.Log().WithField("user_id", c.User.Id)
+
+	rs, err := c.Api.AccessRequest.ByUserId(c.User.Id)
+	if err != nil {
+		clog.WithField("err", err).Error("Could not look up access requests")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not get your access requests, please try again soon"))
+		return
+	}
+
+	c.Render.JSON(w, http.StatusOK, map[string]interface{}{"access_requests": rs})
+}
@@ -0,0 +1,46 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/ericflo/gradientzoo/models"
+	"github.com/ericflo/gradientzoo/utils"
+)
+
+// HandleNewModelsAtom is an Atom feed of the newest public models sitewide.
+func HandleNewModelsAtom(c *Context, w http.ResponseWriter, req *http.Request) {
+	clog := c.Log().WithField("feed", "new_models")
+
+	ms, _, err := c.Api.Model.ByVisibility("public", nil, models.MODEL_SORT_CREATED, atomFeedSize, nil)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up latest public models")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not get that feed, please try again soon"))
+		return
+	}
+
+	// Look up whoever owns the models, once each
+	users, err := c.Load.Owners(ms)
+	if err != nil {
+		clog.WithField("err", err).Error("Could not get users by id")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not get that feed, please try again soon"))
+		return
+	}
+	usernames := make(map[string]string, len(users))
+	for _, u := range users {
+		usernames[u.Id] = u.Username
+	}
+
+	entries := make([]*atomEntry, 0, len(ms))
+	for _, m := range ms {
+		username, ok := usernames[m.UserId]
+		if !ok {
+			continue
+		}
+		entries = append(entries, modelAtomEntry(m, username))
+	}
+
+	renderAtom(w, newAtomFeed("New models on Gradientzoo", utils.Conf.WwwUrl, entries), clog)
+}
@@ -0,0 +1,19 @@
+package api
+
+import (
+	"net/http"
+)
+
+func HandleNotificationPreferences(c *Context, w http.ResponseWriter, req *http.Request) {
+	clog := c.Log().WithField("user_id", c.User.Id)
+
+	prefs, err := c.Api.Notification.Preferences(c.User.Id)
+	if err != nil {
+		clog.WithField("err", err).Error("Could not look up notification preferences")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not get your notification settings, please try again soon"))
+		return
+	}
+
+	c.Render.JSON(w, http.StatusOK, map[string]interface{}{"preferences": prefs})
+}
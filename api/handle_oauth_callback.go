@@ -0,0 +1,209 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/models"
+	"github.com/pborman/uuid"
+)
+
+type OAuthCallbackForm struct {
+	Code  string `json:"code"`
+	State string `json:"state"`
+}
+
+func HandleOAuthCallback(c *Context, w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+
+	providerName := c.Params.ByName("provider")
+
+	provider, ok := oauthProviders[providerName]
+	if !ok || !provider.Enabled() {
+		c.Render.JSON(w, http.StatusNotFound,
+			ApiErr(ERR_NOT_FOUND, "Signing in with "+providerName+" is not supported"))
+		return
+	}
+
+	// Parse the JSON POST body
+	var form OAuthCallbackForm
+	if !decodeForm(c, w, req, c.Log().WithField("path", req.URL.Path), "oauth callback", &form) {
+		return
+	}
+	if form.Code == "" || uuid.Parse(form.State) == nil {
+		c.Render.JSON(w, http.StatusBadRequest,
+			ApiErr(ERR_INVALID_REQUEST, "Must specify a code and state"))
+		return
+	}
+
+	clog := c.Log().WithFields(log.Fields{
+		"provider": provider.Name,
+		"state":    form.State,
+	})
+
+	// Make sure this sign in was started here, and only finish it once
+	state, err := c.Api.UserIdentity.TakeState(form.State)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not take oauth state")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not sign you in, please try again soon"))
+		return
+	}
+	if state == nil || state.Provider != provider.Name || state.Expired() {
+		c.Render.JSON(w, http.StatusBadRequest,
+			ApiErr(ERR_SESSION_EXPIRED, "That sign in has expired, please try again"))
+		return
+	}
+
+	accessToken, err := provider.Exchange(form.Code)
+	if err != nil {
+		clog.WithField("err", err).Info("Could not exchange oauth code")
+		c.Render.JSON(w, http.StatusBadRequest,
+			ApiErr(ERR_INVALID_CREDENTIALS, "Could not sign you in with "+provider.Name+", please try again"))
+		return
+	}
+	profile, err := provider.Profile(accessToken)
+	if err != nil {
+		clog.WithField("err", err).Error("Could not get oauth profile")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not sign you in with "+provider.Name+", please try again soon"))
+		return
+	}
+
+	clog = clog.WithField("provider_user_id", profile.Id)
+
+	ident, err := c.Api.UserIdentity.ByProvider(provider.Name, profile.Id)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up identity")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not sign you in, please try again soon"))
+		return
+	}
+
+	// Linking the provider to an account that's already signed in
+	if state.UserId.Valid {
+		clog = clog.WithField("auth_user_id", state.UserId.String)
+		if ident != nil {
+			if ident.UserId != state.UserId.String {
+				c.Render.JSON(w, http.StatusBadRequest,
+					ApiErr(ERR_ALREADY_EXISTS, "That "+provider.Name+" account is already linked to another user"))
+				return
+			}
+		} else {
+			ident = models.NewUserIdentity(state.UserId.String, provider.Name,
+				profile.Id, profile.Email)
+			if err = c.Api.UserIdentity.Save(ident); err != nil {
+				clog.WithField("err", err).Error("Could not save identity")
+				c.Render.JSON(w, http.StatusBadGateway,
+					ApiErr(ERR_UNAVAILABLE, "Could not link your account, please try again soon"))
+				return
+			}
+			clog.Info("Linked oauth identity")
+			audit(c, req, ident.UserId, ident.UserId, models.AUDIT_OAUTH_LINK,
+				"user_identity", ident.Id,
+				map[string]interface{}{"provider": provider.Name})
+		}
+		c.Render.JSON(w, http.StatusOK, map[string]interface{}{
+			"identity": ident,
+		})
+		return
+	}
+
+	var user *models.User
+	if ident != nil {
+		if user, err = c.Api.User.ById(ident.UserId); err != nil {
+			clog.WithField("err", err).Error("Could not look up user by id")
+			c.Render.JSON(w, http.StatusBadGateway,
+				ApiErr(ERR_UNAVAILABLE, "Could not sign you in, please try again soon"))
+			return
+		}
+	} else {
+		if profile.Email == "" {
+			c.Render.JSON(w, http.StatusBadRequest,
+				ApiErr(ERR_INVALID_REQUEST, "Your "+provider.Name+" account needs a verified e-mail address"))
+			return
+		}
+
+		// Don't sign people into an existing account just because the e-mail
+		// matches, they have to prove they own it by linking while signed in
+		existing, err := c.Api.User.ByEmail(profile.Email)
+		if err != nil && err != sql.ErrNoRows {
+			clog.WithField("err", err).Error("Could not look up user by email")
+			c.Render.JSON(w, http.StatusBadGateway,
+				ApiErr(ERR_UNAVAILABLE, "Could not sign you in, please try again soon"))
+			return
+		}
+		if existing != nil {
+			c.Render.JSON(w, http.StatusConflict,
+				ApiErr(ERR_ALREADY_EXISTS, "A user with that e-mail address already exists, log in "+
+					"with your password to link your "+provider.Name+" account"))
+			return
+		}
+
+		username, err := oauthUsername(c, profile.Username)
+		if err != nil {
+			clog.WithField("err", err).Error("Could not pick a username")
+			c.Render.JSON(w, http.StatusBadGateway,
+				ApiErr(ERR_UNAVAILABLE, "Could not sign you up, please try again soon"))
+			return
+		}
+
+		// Users who sign up this way don't have a password until they set one
+		user = models.NewUser(profile.Email, username, "")
+		user.PasswordHash = ""
+		user.EmailVerified = true
+		if err = c.Api.User.Save(user); err != nil {
+			clog.WithField("err", err).Error("Could not save user")
+			c.Render.JSON(w, http.StatusBadGateway,
+				ApiErr(ERR_UNAVAILABLE, "Could not sign you up, please try again soon"))
+			return
+		}
+		ident = models.NewUserIdentity(user.Id, provider.Name, profile.Id,
+			profile.Email)
+		if err = c.Api.UserIdentity.Save(ident); err != nil {
+			clog.WithField("err", err).Error("Could not save identity")
+			c.Render.JSON(w, http.StatusBadGateway,
+				ApiErr(ERR_UNAVAILABLE, "Could not sign you up, please try again soon"))
+			return
+		}
+		clog.WithField("user_id", user.Id).Info("Signed up with oauth")
+		audit(c, req, user.Id, user.Id, models.AUDIT_REGISTER, "user", user.Id,
+			map[string]interface{}{"method": provider.Name})
+	}
+
+	clog = clog.WithField("user_id", user.Id)
+
+	if user.TotpEnabled {
+		pendingRespond(c, w, clog, user)
+		return
+	}
+
+	authToken := models.NewAuthToken(user.Id)
+	if err = c.Api.AuthToken.Save(authToken); err != nil {
+		clog.WithField("err", err).Error("Could not save auth token")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not sign you in, please try again soon"))
+		return
+	}
+	refreshToken := models.NewRefreshToken(user.Id)
+	if err = c.Api.RefreshToken.Save(refreshToken); err != nil {
+		clog.WithField("err", err).Error("Could not save refresh token")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not sign you in, please try again soon"))
+		return
+	}
+
+	// Hydrate the user object
+	if err = c.Api.User.Hydrate([]*models.User{user}); err != nil {
+		clog.WithField("err", err).Error("Could not hydrate")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not sign you in, please try again soon"))
+		return
+	}
+
+	audit(c, req, user.Id, user.Id, models.AUDIT_LOGIN, "auth_token",
+		authToken.Id, map[string]interface{}{"method": provider.Name})
+
+	sessionRespond(c, w, req, user, authToken, refreshToken)
+}
@@ -0,0 +1,43 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/ericflo/gradientzoo/models"
+)
+
+func HandleOAuthUrl(c *Context, w http.ResponseWriter, req *http.Request) {
+	providerName := c.Params.ByName("provider")
+
+	clog := c.Log().WithField("provider", providerName)
+
+	provider, ok := oauthProviders[providerName]
+	if !ok || !provider.Enabled() {
+		c.Render.JSON(w, http.StatusNotFound,
+			ApiErr(ERR_NOT_FOUND, "Signing in with "+providerName+" is not supported"))
+		return
+	}
+
+	// Users who are already signed in link the provider to their account,
+	// everybody else signs in with it
+	userId := ""
+	if c.User != nil && c.AuthToken.HasScope(models.SCOPE_ADMIN) &&
+		c.AuthToken.AccountWide() {
+		userId = c.User.Id
+		clog = clog.WithField("auth_user_id", c.User.Id)
+	}
+
+	state := models.NewOAuthState(provider.Name, userId)
+	if err := c.Api.UserIdentity.SaveState(state); err != nil {
+		clog.WithField("err", err).Error("Could not save oauth state")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not start signing in, please try again soon"))
+		return
+	}
+
+	c.Render.JSON(w, http.StatusOK, map[string]interface{}{
+		"url":   provider.AuthCodeUrl(state.Id),
+		"state": state.Id,
+		"link":  userId != "",
+	})
+}
@@ -0,0 +1,65 @@
+package api
+
+import (
+	"net/http"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/models"
+)
+
+type OrganizationTwoFactorForm struct {
+	RequireTwoFactor bool `json:"require_two_factor"`
+}
+
+// HandleOrganizationTwoFactor turns on or off the organization's requirement
+// that its members use two-factor authentication.  Members without it can't
+// use their tokens for anything but turning it on while it's required.
+func HandleOrganizationTwoFactor(c *Context, w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+
+	clog := c.Log().WithField("user_id", c.User.Id)
+
+	// Parse the JSON POST body
+	var form OrganizationTwoFactorForm
+	if !decodeForm(c, w, req, clog, "two-factor", &form) {
+		return
+	}
+
+	org, err := userOrganization(c.Api, c.User.Id)
+	if err != nil {
+		clog.WithField("err", err).Error("Could not look up organization")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not change your organization's settings, please try again soon"))
+		return
+	}
+	if org == nil || org.OwnerId != c.User.Id {
+		c.Render.JSON(w, http.StatusUnauthorized,
+			ApiErr(ERR_FORBIDDEN, "Only an organization's owner can change whether it requires two-factor"))
+		return
+	}
+	// Otherwise the owner would lock themselves out
+	if form.RequireTwoFactor && !c.User.TotpEnabled {
+		c.Render.JSON(w, http.StatusBadRequest,
+			ApiErr(ERR_TWO_FACTOR_REQUIRED, "Must turn on two-factor authentication for yourself first"))
+		return
+	}
+
+	org.RequireTwoFactor = form.RequireTwoFactor
+	if err = c.Api.Organization.Save(org); err != nil {
+		clog.WithField("err", err).Error("Could not save organization")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not change your organization's settings, please try again soon"))
+		return
+	}
+
+	clog.WithFields(log.Fields{
+		"organization_id":    org.Id,
+		"require_two_factor": org.RequireTwoFactor,
+	}).Info("Organization two-factor requirement changed")
+	audit(c, req, c.User.Id, c.User.Id, models.AUDIT_ORG_TWO_FACTOR,
+		"organization", org.Id, map[string]interface{}{
+			"require_two_factor": org.RequireTwoFactor,
+		})
+
+	c.Render.JSON(w, http.StatusOK, map[string]*models.Organization{"organization": org})
+}
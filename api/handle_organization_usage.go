@@ -0,0 +1,37 @@
+package api
+
+import (
+	"net/http"
+)
+
+func HandleOrganizationUsage(c *Context, w http.ResponseWriter, req *http.Request) {
+	clog := c.Log().WithField("user_id", c.User.Id)
+
+	org, err := userOrganization(c.Api, c.User.Id)
+	if err != nil {
+		clog.WithField("err", err).Error("Could not look up organization")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not get your organization's usage, please try again soon"))
+		return
+	}
+	if org == nil {
+		c.Render.JSON(w, http.StatusNotFound,
+			ApiErr(ERR_NOT_FOUND, "You don't belong to an organization"))
+		return
+	}
+	if org.OwnerId != c.User.Id {
+		c.Render.JSON(w, http.StatusUnauthorized,
+			ApiErr(ERR_FORBIDDEN, "Only the organization's owner can see its members' usage"))
+		return
+	}
+
+	usage, err := organizationUsage(c.Api, org)
+	if err != nil {
+		clog.WithField("err", err).Error("Could not look up organization usage")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not get your organization's usage, please try again soon"))
+		return
+	}
+
+	c.Render.JSON(w, http.StatusOK, map[string]*OrganizationUsage{"usage": usage})
+}
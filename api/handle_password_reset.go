@@ -0,0 +1,24 @@
+package api
+
+import (
+	"net/http"
+)
+
+func HandlePasswordReset(c *Context, w http.ResponseWriter, req *http.Request) {
+	user, err := userFromSignedToken(c, c.Params.ByName("token"),
+		TOKEN_PURPOSE_PASSWORD_RESET)
+	if err != nil {
+		c.Log().WithField("err", err).Error("Could not look up user for token")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not check that link, please try again soon"))
+		return
+	}
+	if user == nil {
+		c.Render.JSON(w, http.StatusBadRequest,
+			ApiErr(ERR_EXPIRED, "That link is not valid or has expired"))
+		return
+	}
+	c.Render.JSON(w, http.StatusOK, map[string]interface{}{
+		"username": user.Username,
+	})
+}
@@ -0,0 +1,160 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/models"
+)
+
+// PrunePreview lists what the next upload of a filename (or commit of a file
+// group) would delete.
+type PrunePreview struct {
+	Filenames      []string       `json:"filenames"`
+	FileGroup      string         `json:"file_group,omitempty"`
+	Keep           int            `json:"keep"`
+	Files          []*models.File `json:"files"`
+	ReclaimedBytes int64          `json:"reclaimed_bytes"`
+}
+
+func HandlePrunePreview(c *Context, w http.ResponseWriter, req *http.Request) {
+	username := c.Params.ByName("username")
+	slug := c.Params.ByName("slug")
+
+	fields := log.Fields{"username": username, "slug": slug}
+	if c.User != nil {
+		fields["auth_user_id"] = c.User.Id
+	}
+	clog := c.Log().WithFields(fields)
+
+	user, err := c.Api.User.ByUsername(username)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up user by username")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not preview pruning, please try again soon"))
+		return
+	}
+	if err == sql.ErrNoRows || user == nil {
+		c.Render.JSON(w, http.StatusNotFound,
+			ApiErr(ERR_USER_NOT_FOUND, "No user by that username could be found"))
+		return
+	}
+
+	clog = clog.WithField("user_id", user.Id)
+
+	m, err := c.Api.Model.ByUserIdSlug(user.Id, slug)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up model by username & slug")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not preview pruning, please try again soon"))
+		return
+	}
+	if err == sql.ErrNoRows || m == nil {
+		c.Render.JSON(w, http.StatusNotFound, ApiErr(ERR_MODEL_NOT_FOUND, "That model was not found"))
+		return
+	}
+	if !authorize(c, w, m, ACTION_READ,
+		"You don't have permission to access this model") {
+		return
+	}
+
+	clog = clog.WithField("model_id", m.Id)
+
+	latest, err := c.Api.File.ByModelIdLatest(m.Id)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up latest files")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not preview pruning, please try again soon"))
+		return
+	}
+	groups, err := c.Api.FileGroup.ByModelId(m.Id)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up file groups")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not preview pruning, please try again soon"))
+		return
+	}
+
+	// Grouped files are pruned a whole group at a time, so they get one
+	// preview per group, the same way uploads prune them
+	previews := []*PrunePreview{}
+	grouped := map[string]bool{}
+	for _, group := range groups {
+		keep := m.Keep
+		if group.Keep > 0 && group.Keep < keep {
+			keep = group.Keep
+		}
+		n := keep
+		if n > 0 {
+			n--
+		}
+		files, err := c.Api.File.ToDeleteGroup(m.Id, group.Filenames, n)
+		if err != nil && err != sql.ErrNoRows {
+			clog.WithFields(log.Fields{
+				"err":           err,
+				"file_group_id": group.Id,
+			}).Error("Could not look up file group versions to delete")
+			c.Render.JSON(w, http.StatusBadGateway,
+				ApiErr(ERR_UNAVAILABLE, "Could not preview pruning, please try again soon"))
+			return
+		}
+		for _, filename := range group.Filenames {
+			grouped[filename] = true
+		}
+		previews = append(previews, &PrunePreview{
+			Filenames: group.Filenames,
+			FileGroup: group.Name,
+			Keep:      keep,
+			Files:     files,
+		})
+	}
+
+	for _, f := range latest {
+		if grouped[f.Filename] {
+			continue
+		}
+		files, err := c.Api.File.NextToDelete(m.Id, f.Filename, m.Keep)
+		if err != nil && err != sql.ErrNoRows {
+			clog.WithFields(log.Fields{
+				"err":      err,
+				"filename": f.Filename,
+			}).Error("Could not look up file versions to delete")
+			c.Render.JSON(w, http.StatusBadGateway,
+				ApiErr(ERR_UNAVAILABLE, "Could not preview pruning, please try again soon"))
+			return
+		}
+		keep := m.Keep
+		policy, err := c.Api.FilePolicy.ByModelIdFilename(m.Id, f.Filename)
+		if err == nil && policy != nil && policy.Keep > 0 && policy.Keep < keep {
+			keep = policy.Keep
+		}
+		previews = append(previews, &PrunePreview{
+			Filenames: []string{f.Filename},
+			Keep:      keep,
+			Files:     files,
+		})
+	}
+
+	// Include how often each version is downloaded, so owners can spot the
+	// ones people actually use before they're gone
+	var total int64
+	for _, preview := range previews {
+		if err = c.Api.File.Hydrate(preview.Files); err != nil {
+			clog.WithField("err", err).Error("Could not hydrate files")
+			c.Render.JSON(w, http.StatusBadGateway,
+				ApiErr(ERR_UNAVAILABLE, "Could not preview pruning, please try again soon"))
+			return
+		}
+		for _, f := range preview.Files {
+			preview.ReclaimedBytes += int64(f.SizeBytes)
+		}
+		total += preview.ReclaimedBytes
+		projectFileMetadata(req, preview.Files)
+	}
+
+	c.Render.JSON(w, http.StatusOK, map[string]interface{}{
+		"previews":        previews,
+		"reclaimed_bytes": total,
+	})
+}
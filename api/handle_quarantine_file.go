@@ -0,0 +1,86 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/models"
+)
+
+type QuarantineFileForm struct {
+	Reason  string `json:"reason"`
+	Details string `json:"details"`
+}
+
+func HandleQuarantineFile(c *Context, w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+
+	id := c.Params.ByName("id")
+
+	clog := c.Log().WithFields(log.Fields{
+		"user_id": c.User.Id,
+		"file_id": id,
+	})
+
+	// Parse the JSON POST body
+	var form QuarantineFileForm
+	if !decodeForm(c, w, req, clog, "quarantine", &form) {
+		return
+	}
+
+	clog = clog.WithField("reason", form.Reason)
+
+	// Validation
+	v := NewValidator()
+	v.Field("reason", "Reason").Check(models.ValidQuarantineReason(form.Reason),
+		"must be one of 'dmca', 'malware', 'license', 'other'")
+	if v.Refuse(c, w) {
+		return
+	}
+
+	f, err := c.Api.File.ById(id)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up file")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not quarantine that file, please try again soon"))
+		return
+	}
+	if err == sql.ErrNoRows || f == nil {
+		c.Render.JSON(w, http.StatusNotFound,
+			ApiErr(ERR_FILE_NOT_FOUND, "There is no file with that id"))
+		return
+	}
+
+	existing, err := c.Api.FileQuarantine.ActiveByFileId(f.Id)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up file quarantine")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not quarantine that file, please try again soon"))
+		return
+	}
+	if existing != nil {
+		c.Render.JSON(w, http.StatusConflict,
+			ApiErr(ERR_INVALID_STATE, "That file is already quarantined"))
+		return
+	}
+
+	q := models.NewFileQuarantine(f, form.Reason, form.Details, c.User.Id)
+	_, err = c.Api.FileQuarantine.Record(q, c.User.Id,
+		models.QUARANTINE_ACTION_QUARANTINE, form.Details)
+	if err != nil {
+		clog.WithField("err", err).Error("Could not save file quarantine")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not quarantine that file, please try again soon"))
+		return
+	}
+
+	clog.WithField("file_quarantine_id", q.Id).Info("File quarantined")
+	audit(c, req, c.User.Id, modelOwnerId(c, f.ModelId), models.AUDIT_FILE_QUARANTINE,
+		"file_quarantine", q.Id, map[string]interface{}{
+			"file_id": f.Id,
+			"reason":  q.Reason,
+		})
+
+	c.Render.JSON(w, http.StatusOK, map[string]*models.FileQuarantine{"quarantine": q})
+}
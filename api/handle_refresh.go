@@ -0,0 +1,124 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/ericflo/gradientzoo/models"
+	"github.com/pborman/uuid"
+)
+
+type RefreshForm struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+func HandleRefresh(c *Context, w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+
+	clog := c.Log()
+
+	// Parse the JSON POST body, which browser sessions can leave empty
+	var form RefreshForm
+	if !cookieMode(req) || req.ContentLength != 0 {
+		if !decodeForm(c, w, req, clog, "refresh", &form) {
+			return
+		}
+	}
+	// Browser sessions keep it in a cookie instead.  Only our own pages can set
+	// the session mode header, so other sites can't refresh on the user's behalf.
+	if form.RefreshToken == "" && cookieMode(req) {
+		if cookie, err := req.Cookie(REFRESH_COOKIE); err == nil {
+			form.RefreshToken = cookie.Value
+		}
+	}
+	v := NewValidator()
+	v.Field("refresh_token", "Refresh token").Required(form.RefreshToken)
+	if v.Refuse(c, w) {
+		return
+	}
+	if uuid.Parse(form.RefreshToken) == nil {
+		c.Render.JSON(w, http.StatusUnauthorized,
+			ApiErr(ERR_SESSION_EXPIRED, "That refresh token is not valid, please log in again"))
+		return
+	}
+
+	rt, err := c.Api.RefreshToken.Use(form.RefreshToken)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not use refresh token")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not refresh your session, please try again soon"))
+		return
+	}
+	if err == sql.ErrNoRows || rt == nil {
+		c.Render.JSON(w, http.StatusUnauthorized,
+			ApiErr(ERR_SESSION_EXPIRED, "That refresh token is not valid, please log in again"))
+		return
+	}
+
+	clog = clog.WithField("user_id", rt.UserId)
+
+	// A refresh token that's already been used has been copied by someone, and
+	// there's no telling whether it was the user or not, so log everyone out
+	if rt.UsedTime.Valid {
+		clog.Warn("Refresh token was reused, revoking all sessions")
+		if err = c.Api.AuthToken.DeleteByUserIdKind(rt.UserId, models.TOKEN_KIND_SESSION); err != nil {
+			clog.WithField("err", err).Error("Could not delete sessions")
+		}
+		if err = c.Api.RefreshToken.DeleteByUserId(rt.UserId); err != nil {
+			clog.WithField("err", err).Error("Could not delete refresh tokens")
+		}
+		c.Render.JSON(w, http.StatusUnauthorized,
+			ApiErr(ERR_SESSION_EXPIRED, "That refresh token is not valid, please log in again"))
+		return
+	}
+	if rt.Expired() {
+		c.Render.JSON(w, http.StatusUnauthorized,
+			ApiErr(ERR_SESSION_EXPIRED, "Your session has expired, please log in again"))
+		return
+	}
+
+	// Whatever would keep them from logging in keeps them from staying logged
+	// in, too
+	user, err := c.Api.User.ById(rt.UserId)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up user")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not refresh your session, please try again soon"))
+		return
+	}
+	if err == sql.ErrNoRows || user == nil {
+		c.Render.JSON(w, http.StatusUnauthorized,
+			ApiErr(ERR_SESSION_EXPIRED, "That refresh token is not valid, please log in again"))
+		return
+	}
+	if user.Suspended() {
+		c.Render.JSON(w, http.StatusForbidden,
+			ApiErr(ERR_ACCOUNT_SUSPENDED, "This account is suspended: "+user.SuspendedReason))
+		return
+	}
+	if user.MustChangePassword {
+		c.Render.JSON(w, http.StatusForbidden, map[string]interface{}{
+			"code":                     ERR_PASSWORD_CHANGE_REQUIRED,
+			"error":                    "You need to choose a new password, please log in again",
+			"password_change_required": true,
+		})
+		return
+	}
+
+	authToken := models.NewAuthToken(rt.UserId)
+	if err = c.Api.AuthToken.Save(authToken); err != nil {
+		clog.WithField("err", err).Error("Could not save auth token")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not refresh your session, please try again soon"))
+		return
+	}
+	refreshToken := models.NewRefreshToken(rt.UserId)
+	if err = c.Api.RefreshToken.Save(refreshToken); err != nil {
+		clog.WithField("err", err).Error("Could not save refresh token")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not refresh your session, please try again soon"))
+		return
+	}
+
+	sessionRespond(c, w, req, nil, authToken, refreshToken)
+}
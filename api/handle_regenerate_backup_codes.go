@@ -0,0 +1,48 @@
+package api
+
+import (
+	"net/http"
+)
+
+func HandleRegenerateBackupCodes(c *Context, w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+
+	// Parse the JSON POST body
+	var form TwoFactorForm
+	if !decodeForm(c, w, req, c.Log().WithField("path", req.URL.Path), "two-factor", &form) {
+		return
+	}
+
+	clog := c.Log().WithField("user_id", c.User.Id)
+
+	if !c.User.TotpEnabled {
+		c.Render.JSON(w, http.StatusBadRequest,
+			ApiErr(ERR_INVALID_STATE, "Two-factor authentication is not enabled"))
+		return
+	}
+
+	ok, err := checkSecondFactor(c, c.User, form.Code)
+	if err != nil {
+		clog.WithField("err", err).Error("Could not check two-factor code")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not make new backup codes, please try again soon"))
+		return
+	}
+	if !ok {
+		c.Render.JSON(w, http.StatusUnauthorized,
+			ApiErr(ERR_INVALID_CREDENTIALS, "That code is not correct"))
+		return
+	}
+
+	codes, err := c.Api.BackupCode.Generate(c.User.Id)
+	if err != nil {
+		clog.WithField("err", err).Error("Could not generate backup codes")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not make new backup codes, please try again soon"))
+		return
+	}
+
+	c.Render.JSON(w, http.StatusOK, map[string]interface{}{
+		"backup_codes": codes,
+	})
+}
@@ -2,13 +2,12 @@ package api
 
 import (
 	"database/sql"
-	"encoding/json"
 	"net/http"
 	"regexp"
-	"strings"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/ericflo/gradientzoo/models"
+	"github.com/ericflo/gradientzoo/utils"
 )
 
 type RegisterForm struct {
@@ -23,36 +22,23 @@ func HandleRegister(c *Context, w http.ResponseWriter, req *http.Request) {
 	defer req.Body.Close()
 
 	// Parse the JSON POST body
-	decoder := json.NewDecoder(req.Body)
 	var form RegisterForm
-	if err := decoder.Decode(&form); err != nil {
-		msg := "Could not decode auth form"
-		log.WithField("err", err).Error(msg)
-		c.Render.JSON(w, http.StatusBadRequest, JsonErr(msg))
+	if !decodeForm(c, w, req, c.Log().WithField("path", req.URL.Path), "auth", &form) {
 		return
 	}
 
-	if len(form.Email) < 4 || !strings.Contains(form.Email, "@") {
-		c.Render.JSON(w, http.StatusBadRequest, JsonErr("Invalid e-mail address"))
-		return
-	}
-	if !SlugReg.MatchString(form.Username) {
-		c.Render.JSON(w, http.StatusBadRequest,
-			JsonErr("Username can contain only letters, numbers, and underscore"))
-		return
-	}
-	if len(form.Username) < 3 {
-		c.Render.JSON(w, http.StatusBadRequest,
-			JsonErr("Username must be at least 3 characters long"))
-		return
-	}
-	if len(form.Password) < 5 {
-		c.Render.JSON(w, http.StatusBadRequest,
-			JsonErr("Password must be at least 5 characters long"))
+	v := NewValidator()
+	v.Field("email", "E-mail address").Email(form.Email)
+	v.Field("username", "Username").
+		Matches(form.Username, SlugReg, "can contain only letters, numbers, and underscore").
+		MinLength(form.Username, 3).
+		Check(!utils.Live().Reserved(form.Username), "is reserved")
+	v.Field("password", "Password").MinLength(form.Password, 5)
+	if v.Refuse(c, w) {
 		return
 	}
 
-	clog := log.WithFields(log.Fields{
+	clog := c.Log().WithFields(log.Fields{
 		"email":          form.Email,
 		"username":       form.Username,
 		"empty_password": form.Password == "",
@@ -63,12 +49,12 @@ func HandleRegister(c *Context, w http.ResponseWriter, req *http.Request) {
 	if err != nil && err != sql.ErrNoRows {
 		clog.WithField("err", err).Error("Could not look up user by email")
 		c.Render.JSON(w, http.StatusBadGateway,
-			JsonErr("Could not sign you up, please try again soon"))
+			ApiErr(ERR_UNAVAILABLE, "Could not sign you up, please try again soon"))
 		return
 	}
 	if err == nil && user != nil {
 		c.Render.JSON(w, http.StatusBadRequest,
-			JsonErr("A user with that e-mail address already exists"))
+			ApiErr(ERR_ALREADY_EXISTS, "A user with that e-mail address already exists"))
 		return
 	}
 
@@ -77,12 +63,12 @@ func HandleRegister(c *Context, w http.ResponseWriter, req *http.Request) {
 	if err != nil && err != sql.ErrNoRows {
 		clog.WithField("err", err).Error("Could not look up user by username")
 		c.Render.JSON(w, http.StatusBadGateway,
-			JsonErr("Could not sign you up, please try again soon"))
+			ApiErr(ERR_UNAVAILABLE, "Could not sign you up, please try again soon"))
 		return
 	}
 	if err == nil && user != nil {
 		c.Render.JSON(w, http.StatusBadRequest,
-			JsonErr("A user with that username already exists"))
+			ApiErr(ERR_ALREADY_EXISTS, "A user with that username already exists"))
 		return
 	}
 
@@ -91,7 +77,7 @@ func HandleRegister(c *Context, w http.ResponseWriter, req *http.Request) {
 	if err = c.Api.User.Save(user); err != nil {
 		clog.WithField("err", err).Error("Could not save user")
 		c.Render.JSON(w, http.StatusBadGateway,
-			JsonErr("Could not log you in, please try again soon"))
+			ApiErr(ERR_UNAVAILABLE, "Could not log you in, please try again soon"))
 		return
 	}
 
@@ -99,24 +85,34 @@ func HandleRegister(c *Context, w http.ResponseWriter, req *http.Request) {
 	if err = c.Api.User.Hydrate([]*models.User{user}); err != nil {
 		clog.WithField("err", err).Error("Could not hydrate")
 		c.Render.JSON(w, http.StatusBadGateway,
-			JsonErr("Could not log you in, please try again soon"))
+			ApiErr(ERR_UNAVAILABLE, "Could not log you in, please try again soon"))
 		return
 	}
 
 	clog = clog.WithField("user_id", user.Id)
 
+	goBackground(func() { sendVerificationEmail(c.Mailer, user) })
+
 	// Now create a new auth token for the new user
 	authToken := models.NewAuthToken(user.Id)
 	if err = c.Api.AuthToken.Save(authToken); err != nil {
 		clog.WithField("err", err).Error("Could not save user")
 		c.Render.JSON(w, http.StatusBadGateway,
-			JsonErr("Could not log you in, please try again soon"))
+			ApiErr(ERR_UNAVAILABLE, "Could not log you in, please try again soon"))
 		return
 	}
 
-	// Return the new user and auth token objects
-	c.Render.JSON(w, http.StatusOK, map[string]interface{}{
-		"auth_user":  user,
-		"auth_token": authToken,
-	})
+	refreshToken := models.NewRefreshToken(user.Id)
+	if err = c.Api.RefreshToken.Save(refreshToken); err != nil {
+		clog.WithField("err", err).Error("Could not save refresh token")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not log you in, please try again soon"))
+		return
+	}
+
+	audit(c, req, user.Id, user.Id, models.AUDIT_REGISTER, "user", user.Id,
+		map[string]interface{}{"method": "password"})
+
+	// Return the new user, auth token, and refresh token objects
+	sessionRespond(c, w, req, user, authToken, refreshToken)
 }
@@ -0,0 +1,83 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/models"
+)
+
+func HandleRelatedModels(c *Context, w http.ResponseWriter, req *http.Request) {
+	fields := log.Fields{
+		"username": c.Params.ByName("username"),
+		"slug":     c.Params.ByName("slug"),
+	}
+	if c.User != nil {
+		fields["auth_user_id"] = c.User.Id
+	}
+	clog := c.Log().WithFields(fields)
+
+	// Validation
+	limit := 5
+	if limitStr := req.URL.Query().Get("limit"); limitStr != "" {
+		var err error
+		if limit, err = strconv.Atoi(limitStr); err != nil || limit <= 0 {
+			c.Render.JSON(w, http.StatusBadRequest,
+				ApiErr(ERR_INVALID_REQUEST, "Limit must be a positive number"))
+			return
+		}
+		if limit > relatedSize {
+			limit = relatedSize
+		}
+	}
+
+	m := accessModel(c, w, clog)
+	if m == nil {
+		return
+	}
+	if !authorize(c, w, m, ACTION_READ,
+		"You don't have permission to access this model") {
+		return
+	}
+
+	clog = clog.WithField("model_id", m.Id)
+
+	related, err := c.Api.ModelRelated.ByModelId(m.Id, limit)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up related models")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not get related models, please try again soon"))
+		return
+	}
+
+	// The models come back most related first, with why by id
+	ms := make([]*models.Model, 0, len(related))
+	byId := make(map[string]*models.RelatedModel, len(related))
+	for _, r := range related {
+		ms = append(ms, &r.Model)
+		byId[r.Id] = r
+	}
+
+	// Hydrate the model objects
+	if err = c.Api.Model.Hydrate(ms); err != nil {
+		clog.WithField("err", err).Error("Could not hydrate")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not get related models, please try again soon"))
+		return
+	}
+
+	// Look up whoever owns the models, once each
+	users, err := c.Load.Owners(ms)
+	if err != nil {
+		clog.WithField("err", err).Error("Could not get users by id")
+		users = []*models.User{}
+	}
+
+	c.Render.JSON(w, http.StatusOK, map[string]interface{}{
+		"models":  ms,
+		"users":   users,
+		"related": byId,
+	})
+}
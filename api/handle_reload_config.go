@@ -0,0 +1,35 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/ericflo/gradientzoo/models"
+)
+
+// HandleReloadConfig reloads the config file on the server that gets the
+// request, the same as sending it SIGHUP, and says what changed.  Each
+// server has to be reloaded separately.
+func HandleReloadConfig(c *Context, w http.ResponseWriter, req *http.Request) {
+	changes, errs := reloadConfig("admin")
+	if len(errs) > 0 {
+		msgs := make([]string, len(errs))
+		for i, err := range errs {
+			msgs[i] = err.Error()
+		}
+		c.Render.JSON(w, http.StatusConflict, ApiErr(ERR_INVALID_STATE,
+			"The config is invalid, so it wasn't reloaded: "+strings.Join(msgs, "; ")))
+		return
+	}
+
+	names := []string{}
+	for _, change := range changes {
+		names = append(names, change.Name)
+	}
+	audit(c, req, c.User.Id, "", models.AUDIT_CONFIG_RELOAD, "", "",
+		map[string]interface{}{"changed": names})
+
+	c.Render.JSON(w, http.StatusOK, map[string]interface{}{
+		"changes": changes,
+	})
+}
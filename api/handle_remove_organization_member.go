@@ -0,0 +1,61 @@
+package api
+
+import (
+	"net/http"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/models"
+)
+
+func HandleRemoveOrganizationMember(c *Context, w http.ResponseWriter, req *http.Request) {
+	memberId := c.Params.ByName("user_id")
+
+	clog := c.Log().WithFields(log.Fields{
+		"user_id":   c.User.Id,
+		"member_id": memberId,
+	})
+
+	org, err := userOrganization(c.Api, c.User.Id)
+	if err != nil {
+		clog.WithField("err", err).Error("Could not look up organization")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not remove that member, please try again soon"))
+		return
+	}
+	// Owners can remove anyone, and anyone can leave
+	if org == nil || (org.OwnerId != c.User.Id && memberId != c.User.Id) {
+		c.Render.JSON(w, http.StatusUnauthorized,
+			ApiErr(ERR_FORBIDDEN, "Only an organization's owner can remove other members"))
+		return
+	}
+	if memberId == org.OwnerId {
+		c.Render.JSON(w, http.StatusBadRequest,
+			ApiErr(ERR_INVALID_STATE, "An organization's owner can't leave it"))
+		return
+	}
+
+	memberOrg, err := userOrganization(c.Api, memberId)
+	if err != nil {
+		clog.WithField("err", err).Error("Could not look up member's organization")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not remove that member, please try again soon"))
+		return
+	}
+	if memberOrg == nil || memberOrg.Id != org.Id {
+		c.Render.JSON(w, http.StatusNotFound,
+			ApiErr(ERR_NOT_FOUND, "That user isn't a member of your organization"))
+		return
+	}
+
+	if err = c.Api.Organization.RemoveMember(org.Id, memberId); err != nil {
+		clog.WithField("err", err).Error("Could not remove organization member")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not remove that member, please try again soon"))
+		return
+	}
+
+	audit(c, req, c.User.Id, memberId, models.AUDIT_ORG_MEMBER_REMOVE,
+		"organization", org.Id, nil)
+
+	c.Render.JSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
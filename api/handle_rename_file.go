@@ -0,0 +1,194 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/models"
+)
+
+type RenameFileForm struct {
+	Filename string `json:"filename"`
+}
+
+func HandleRenameFile(c *Context, w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+
+	username := c.Params.ByName("username")
+	slug := c.Params.ByName("slug")
+	filename := c.Params.ByName("filename")
+
+	clog := c.Log().WithFields(log.Fields{
+		"user_id":         c.User.Id,
+		"file_username":   username,
+		"file_model_slug": slug,
+		"filename":        filename,
+	})
+
+	// Parse the JSON POST body
+	var form RenameFileForm
+	if !decodeForm(c, w, req, clog, "rename", &form) {
+		return
+	}
+
+	clog = clog.WithField("new_filename", form.Filename)
+
+	// Validation
+	v := NewValidator()
+	v.Field("filename", "Filename").
+		Required(form.Filename).
+		Check(!strings.Contains(form.Filename, "/"), "may not contain a slash").
+		MaxLength(form.Filename, MaxFilenameLength).
+		Check(form.Filename != filename, "must be different from the old one")
+	if v.Refuse(c, w) {
+		return
+	}
+
+	// First let's look up the user by their username
+	user, err := c.Api.User.ByUsername(username)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up user by username")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not rename that file, please try again soon"))
+		return
+	}
+	if err == sql.ErrNoRows || user == nil {
+		c.Render.JSON(w, http.StatusNotFound,
+			ApiErr(ERR_USER_NOT_FOUND, "No user by that username could be found"))
+		return
+	}
+
+	clog = clog.WithField("file_user_id", user.Id)
+
+	// Now we get the model
+	m, err := c.Api.Model.ByUserIdSlug(user.Id, slug)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up model by username & slug")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not rename that file, please try again soon"))
+		return
+	}
+	if err == sql.ErrNoRows || m == nil {
+		c.Render.JSON(w, http.StatusNotFound,
+			ApiErr(ERR_MODEL_NOT_FOUND, "No model by that username and slug could be found"))
+		return
+	}
+	if !authorize(c, w, m, ACTION_WRITE,
+		"You're only allowed to rename files in your own models") {
+		return
+	}
+
+	clog = clog.WithField("file_model_id", m.Id)
+
+	// Make sure the new name isn't already taken
+	existing, err := c.Api.File.ByModelIdFilename(m.Id, form.Filename)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up files by new filename")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not rename that file, please try again soon"))
+		return
+	}
+	if len(existing) > 0 {
+		c.Render.JSON(w, http.StatusBadRequest,
+			ApiErr(ERR_ALREADY_EXISTS, "This model already has a file by that name"))
+		return
+	}
+
+	// Grab every version of the file we're renaming
+	files, err := c.Api.File.ByModelIdFilename(m.Id, filename)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up files by filename")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not rename that file, please try again soon"))
+		return
+	}
+	if len(files) == 0 {
+		c.Render.JSON(w, http.StatusNotFound,
+			ApiErr(ERR_FILE_NOT_FOUND, "There is no file by that name"))
+		return
+	}
+
+	// A pending version's blob may not be stored yet, and its upload would
+	// store it under the old name, so wait for uploads to finish first
+	for _, f := range files {
+		if f.Status == "pending" {
+			c.Render.JSON(w, http.StatusConflict,
+				ApiErr(ERR_INVALID_STATE, "That file is still being uploaded, please try again once it's done"))
+			return
+		}
+	}
+
+	// The blob key includes the filename, so copy every version over to its new
+	// key before touching the database.  If anything fails, including the
+	// database update, clean up the copies and leave the old file as it was.
+	oldBlobFilenames := make([]string, 0, len(files))
+	newBlobFilenames := make([]string, 0, len(files))
+	discardCopies := func() {
+		for _, fn := range newBlobFilenames {
+			if err := c.Blob.Delete(fn); err != nil {
+				clog.WithFields(log.Fields{
+					"err":                  err,
+					"delete_blob_filename": fn,
+				}).Error("Could not clean up copied file in blob storage")
+			}
+		}
+	}
+	for _, f := range files {
+		oldFn := f.BlobFilename()
+		f.Filename = form.Filename
+		newFn := f.BlobFilename()
+		if err = c.Blob.Copy(oldFn, newFn); err != nil {
+			clog.WithFields(log.Fields{
+				"err":               err,
+				"src_blob_filename": oldFn,
+				"dst_blob_filename": newFn,
+			}).Error("Could not copy file in blob storage")
+			discardCopies()
+			c.Render.JSON(w, http.StatusBadGateway,
+				ApiErr(ERR_UNAVAILABLE, "Could not rename that file, please try again soon"))
+			return
+		}
+		oldBlobFilenames = append(oldBlobFilenames, oldFn)
+		newBlobFilenames = append(newBlobFilenames, newFn)
+	}
+
+	// Now update the rows in place, which keeps their download history intact
+	if err = c.Api.File.Rename(m.Id, filename, form.Filename); err != nil {
+		clog.WithField("err", err).Error("Could not rename files")
+		discardCopies()
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not rename that file, please try again soon"))
+		return
+	}
+
+	// Carry any retention policy over to the new name
+	if err = c.Api.FilePolicy.Rename(m.Id, filename, form.Filename); err != nil {
+		clog.WithField("err", err).Error("Could not rename file policy")
+	}
+
+	// And keep its group membership
+	if err = c.Api.FileGroup.RenameFilename(m.Id, filename, form.Filename); err != nil {
+		clog.WithField("err", err).Error("Could not rename file in its group")
+	}
+
+	// Finally remove the blobs stored under the old name
+	for _, fn := range oldBlobFilenames {
+		if err = c.Blob.Delete(fn); err != nil {
+			clog.WithFields(log.Fields{
+				"err":                  err,
+				"delete_blob_filename": fn,
+			}).Error("Could not delete old file from blob storage")
+		}
+	}
+
+	clog.Info("File renamed")
+
+	// Hydrate the file objects
+	if err = c.Api.File.Hydrate(files); err != nil {
+		clog.WithField("err", err).Error("Could not hydrate file")
+	}
+
+	c.Render.JSON(w, http.StatusOK, map[string][]*models.File{"files": files})
+}
@@ -0,0 +1,87 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/models"
+)
+
+const maxAccessRequestMessage = 1000
+
+type RequestAccessForm struct {
+	Message string `json:"message"`
+}
+
+func HandleRequestAccess(c *Context, w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+
+	clog := c.Log().WithFields(log.Fields{
+		"user_id":  c.User.Id,
+		"username": c.Params.ByName("username"),
+		"slug":     c.Params.ByName("slug"),
+	})
+
+	// Parse the JSON POST body
+	var form RequestAccessForm
+	if !decodeForm(c, w, req, clog, "access request", &form) {
+		return
+	}
+
+	// Validation
+	v := NewValidator()
+	v.Field("message", "Message").MaxLength(form.Message, maxAccessRequestMessage)
+	if v.Refuse(c, w) {
+		return
+	}
+
+	m := accessModel(c, w, clog)
+	if m == nil {
+		return
+	}
+	clog = clog.WithField("model_id", m.Id)
+	if m.Visibility != "private" {
+		c.Render.JSON(w, http.StatusBadRequest,
+			ApiErr(ERR_INVALID_STATE, "That model is public, anybody can already download it"))
+		return
+	}
+	if m.UserId == c.User.Id {
+		c.Render.JSON(w, http.StatusBadRequest,
+			ApiErr(ERR_INVALID_STATE, "You can't request access to your own model"))
+		return
+	}
+
+	// Asking again while a request is pending or granted changes nothing, but
+	// asking again after being denied or after a grant ran out starts over
+	r, err := c.Api.AccessRequest.ByModelIdUserId(m.Id, c.User.Id)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up access request")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not request access, please try again soon"))
+		return
+	}
+	if r != nil && (r.Status == models.ACCESS_PENDING || r.Active()) {
+		c.Render.JSON(w, http.StatusOK, map[string]*models.AccessRequest{"access_request": r})
+		return
+	}
+	if r == nil {
+		r = models.NewAccessRequest(m.Id, c.User.Id, form.Message)
+	} else {
+		fresh := models.NewAccessRequest(m.Id, c.User.Id, form.Message)
+		fresh.Id = r.Id
+		r = fresh
+	}
+	if err = c.Api.AccessRequest.Save(r); err != nil {
+		clog.WithField("err", err).Error("Could not save access request")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not request access, please try again soon"))
+		return
+	}
+
+	clog.WithField("access_request_id", r.Id).Info("Requested access")
+	audit(c, req, c.User.Id, m.UserId, models.AUDIT_ACCESS_REQUEST, "access_request",
+		r.Id, map[string]interface{}{"model_id": m.Id})
+
+	c.Render.JSON(w, http.StatusOK, map[string]*models.AccessRequest{"access_request": r})
+}
@@ -0,0 +1,49 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/ericflo/gradientzoo/models"
+)
+
+type PasswordResetRequestForm struct {
+	EmailOrUsername string `json:"email_or_username"`
+}
+
+func HandleRequestPasswordReset(c *Context, w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+
+	// Parse the JSON POST body
+	var form PasswordResetRequestForm
+	if !decodeForm(c, w, req, c.Log().WithField("path", req.URL.Path), "password reset", &form) {
+		return
+	}
+
+	clog := c.Log().WithField("email_or_username", form.EmailOrUsername)
+
+	var user *models.User
+	var err error
+	if form.EmailOrUsername != "" {
+		user, err = c.Api.User.ByEmail(form.EmailOrUsername)
+		if err == sql.ErrNoRows {
+			user, err = c.Api.User.ByUsername(form.EmailOrUsername)
+		}
+		if err != nil && err != sql.ErrNoRows {
+			clog.WithField("err", err).Error("Could not look up user")
+			c.Render.JSON(w, http.StatusBadGateway,
+				ApiErr(ERR_UNAVAILABLE, "Could not reset your password, please try again soon"))
+			return
+		}
+	}
+
+	// Respond the same way whether or not there's such a user, so that this
+	// can't be used to find out who has an account.  Service accounts have
+	// nowhere to send it to.
+	if user != nil && err == nil && !user.IsService() {
+		clog.WithField("user_id", user.Id).Info("Sending password reset")
+		goBackground(func() { sendPasswordResetEmail(c.Mailer, user) })
+	}
+
+	c.Render.JSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
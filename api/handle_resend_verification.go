@@ -0,0 +1,15 @@
+package api
+
+import (
+	"net/http"
+)
+
+func HandleResendVerification(c *Context, w http.ResponseWriter, req *http.Request) {
+	if c.User.EmailVerified {
+		c.Render.JSON(w, http.StatusBadRequest,
+			ApiErr(ERR_INVALID_STATE, "Your e-mail address is already verified"))
+		return
+	}
+	goBackground(func() { sendVerificationEmail(c.Mailer, c.User) })
+	c.Render.JSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
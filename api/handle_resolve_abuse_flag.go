@@ -0,0 +1,73 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/models"
+	"gopkg.in/guregu/null.v3"
+)
+
+type ResolveAbuseFlagForm struct {
+	Note string `json:"note"`
+	// Whether the user can download again right away
+	LiftThrottle bool `json:"lift_throttle"`
+}
+
+func HandleResolveAbuseFlag(c *Context, w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+
+	id := c.Params.ByName("id")
+
+	clog := c.Log().WithFields(log.Fields{
+		"user_id":       c.User.Id,
+		"abuse_flag_id": id,
+	})
+
+	// Parse the JSON POST body
+	var form ResolveAbuseFlagForm
+	if !decodeForm(c, w, req, clog, "abuse", &form) {
+		return
+	}
+
+	flag, err := c.Api.AbuseFlag.ById(id)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up abuse flag")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not resolve that flag, please try again soon"))
+		return
+	}
+	if err == sql.ErrNoRows || flag == nil {
+		c.Render.JSON(w, http.StatusNotFound, ApiErr(ERR_NOT_FOUND, "That flag was not found"))
+		return
+	}
+	if flag.ResolvedTime.Valid {
+		c.Render.JSON(w, http.StatusBadRequest,
+			ApiErr(ERR_INVALID_STATE, "That flag has already been resolved"))
+		return
+	}
+
+	now := time.Now().UTC()
+	flag.ResolvedBy = null.StringFrom(c.User.Id)
+	flag.ResolvedTime = null.TimeFrom(now)
+	flag.ResolutionNote = form.Note
+	if form.LiftThrottle && flag.ThrottledUntil.Valid && flag.ThrottledUntil.Time.After(now) {
+		flag.ThrottledUntil = null.TimeFrom(now)
+	}
+	if err = c.Api.AbuseFlag.Save(flag); err != nil {
+		clog.WithField("err", err).Error("Could not save abuse flag")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not resolve that flag, please try again soon"))
+		return
+	}
+
+	audit(c, req, c.User.Id, flag.UserId, models.AUDIT_ABUSE_RESOLVE, "abuse_flag",
+		flag.Id, map[string]interface{}{
+			"note":          form.Note,
+			"lift_throttle": form.LiftThrottle,
+		})
+
+	c.Render.JSON(w, http.StatusOK, map[string]*models.AbuseFlag{"flag": flag})
+}
@@ -0,0 +1,88 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/models"
+	"gopkg.in/guregu/null.v3"
+)
+
+type ResolveFileQuarantineForm struct {
+	Action string `json:"action"`
+	Note   string `json:"note"`
+}
+
+func HandleResolveFileQuarantine(c *Context, w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+
+	id := c.Params.ByName("id")
+
+	clog := c.Log().WithFields(log.Fields{
+		"user_id": c.User.Id,
+		"file_id": id,
+	})
+
+	// Parse the JSON POST body
+	var form ResolveFileQuarantineForm
+	if !decodeForm(c, w, req, clog, "quarantine", &form) {
+		return
+	}
+
+	clog = clog.WithField("action", form.Action)
+
+	// Validation
+	v := NewValidator()
+	v.Field("action", "Action").OneOf(form.Action, models.QUARANTINE_ACTION_RESTORE,
+		models.QUARANTINE_ACTION_DENY_APPEAL)
+	if v.Refuse(c, w) {
+		return
+	}
+
+	q, err := c.Api.FileQuarantine.ActiveByFileId(id)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up file quarantine")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not resolve that quarantine, please try again soon"))
+		return
+	}
+	if err == sql.ErrNoRows || q == nil {
+		c.Render.JSON(w, http.StatusNotFound,
+			ApiErr(ERR_NOT_FOUND, "That file is not quarantined"))
+		return
+	}
+
+	clog = clog.WithField("file_quarantine_id", q.Id)
+
+	if form.Action == models.QUARANTINE_ACTION_RESTORE {
+		q.Status = models.QUARANTINE_RESTORED
+		q.ResolvedTime = null.TimeFrom(time.Now().UTC())
+	} else {
+		if q.Status != models.QUARANTINE_APPEALED {
+			c.Render.JSON(w, http.StatusConflict,
+				ApiErr(ERR_INVALID_STATE, "That quarantine hasn't been appealed"))
+			return
+		}
+		// The owner can appeal again, e.g. with more evidence
+		q.Status = models.QUARANTINE_QUARANTINED
+	}
+
+	if _, err = c.Api.FileQuarantine.Record(q, c.User.Id, form.Action, form.Note); err != nil {
+		clog.WithField("err", err).Error("Could not save file quarantine")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not resolve that quarantine, please try again soon"))
+		return
+	}
+
+	clog.Info("File quarantine resolved")
+	audit(c, req, c.User.Id, modelOwnerId(c, q.ModelId),
+		models.AUDIT_FILE_QUARANTINE_DONE, "file_quarantine", q.Id,
+		map[string]interface{}{
+			"file_id": q.FileId,
+			"action":  form.Action,
+		})
+
+	c.Render.JSON(w, http.StatusOK, map[string]*models.FileQuarantine{"quarantine": q})
+}
@@ -0,0 +1,43 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/models"
+)
+
+// HandleRetryJob queues a dead job to run again, with all its attempts.
+func HandleRetryJob(c *Context, w http.ResponseWriter, req *http.Request) {
+	id := c.Params.ByName("id")
+
+	clog := c.Log().WithFields(log.Fields{
+		"user_id": c.User.Id,
+		"job_id":  id,
+	})
+
+	retried, err := c.Api.Job.Retry(id)
+	if err != nil {
+		clog.WithField("err", err).Error("Could not retry job")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not retry that job, please try again soon"))
+		return
+	}
+	if !retried {
+		c.Render.JSON(w, http.StatusBadRequest,
+			ApiErr(ERR_INVALID_STATE, "Only dead jobs can be retried"))
+		return
+	}
+
+	job, err := c.Api.Job.ById(id)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up job")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not get that job, please try again soon"))
+		return
+	}
+
+	clog.Info("Retried job")
+	c.Render.JSON(w, http.StatusOK, map[string]*models.Job{"job": job})
+}
@@ -0,0 +1,54 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/ericflo/gradientzoo/models"
+)
+
+type RevokeAllForm struct {
+	IncludeApiTokens bool `json:"include_api_tokens"`
+}
+
+// Every request looks its token up in the database, so deleting the rows is
+// enough to kill a leaked token immediately.
+func HandleRevokeAll(c *Context, w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+
+	clog := c.Log().WithField("user_id", c.User.Id)
+
+	// Parse the JSON POST body
+	var form RevokeAllForm
+	if !decodeForm(c, w, req, clog, "revoke", &form) {
+		return
+	}
+
+	clog = clog.WithField("include_api_tokens", form.IncludeApiTokens)
+
+	if err := c.Api.RefreshToken.DeleteByUserId(c.User.Id); err != nil {
+		clog.WithField("err", err).Error("Could not delete refresh tokens")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not revoke your tokens, please try again soon"))
+		return
+	}
+	if err := c.Api.AuthToken.DeleteByUserIdKind(c.User.Id, models.TOKEN_KIND_SESSION); err != nil {
+		clog.WithField("err", err).Error("Could not delete sessions")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not revoke your tokens, please try again soon"))
+		return
+	}
+	if form.IncludeApiTokens {
+		if err := c.Api.AuthToken.DeleteByUserIdKind(c.User.Id, models.TOKEN_KIND_API); err != nil {
+			clog.WithField("err", err).Error("Could not delete api tokens")
+			c.Render.JSON(w, http.StatusBadGateway,
+				ApiErr(ERR_UNAVAILABLE, "Could not revoke your tokens, please try again soon"))
+			return
+		}
+	}
+
+	clog.Info("All tokens revoked")
+	audit(c, req, c.User.Id, c.User.Id, models.AUDIT_TOKEN_REVOKE_ALL, "", "",
+		map[string]interface{}{"include_api_tokens": form.IncludeApiTokens})
+
+	c.Render.JSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
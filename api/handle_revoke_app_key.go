@@ -0,0 +1,51 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/models"
+	"gopkg.in/guregu/null.v3"
+)
+
+func HandleRevokeAppKey(c *Context, w http.ResponseWriter, req *http.Request) {
+	id := c.Params.ByName("id")
+
+	clog := c.Log().WithFields(log.Fields{
+		"user_id":    c.User.Id,
+		"app_key_id": id,
+	})
+
+	appKey, err := c.Api.AppKey.ById(id)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up app key")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not revoke that app key, please try again soon"))
+		return
+	}
+	if err == sql.ErrNoRows || appKey == nil {
+		c.Render.JSON(w, http.StatusNotFound,
+			ApiErr(ERR_NOT_FOUND, "No app key with that id could be found"))
+		return
+	}
+	if appKey.Revoked() {
+		c.Render.JSON(w, http.StatusOK, map[string]*models.AppKey{"app_key": appKey})
+		return
+	}
+
+	// Revoked keys are kept around, along with their usage
+	appKey.RevokedTime = null.TimeFrom(time.Now().UTC())
+	if err = c.Api.AppKey.Save(appKey); err != nil {
+		clog.WithField("err", err).Error("Could not save app key")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not revoke that app key, please try again soon"))
+		return
+	}
+
+	audit(c, req, c.User.Id, "", models.AUDIT_APP_KEY_REVOKE, "app_key",
+		appKey.Id, map[string]interface{}{"name": appKey.Name})
+
+	c.Render.JSON(w, http.StatusOK, map[string]*models.AppKey{"app_key": appKey})
+}
@@ -0,0 +1,84 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/models"
+)
+
+// Anything less than doubling is just a busy hour
+const minDownloadAlertMultiplier = 2
+
+type SaveDownloadAlertForm struct {
+	Multiplier   float64 `json:"multiplier"`
+	MinDownloads int     `json:"min_downloads"`
+	Email        bool    `json:"email"`
+	Webhook      bool    `json:"webhook"`
+}
+
+// There's one download alert per model, and saving it again replaces it
+func HandleSaveDownloadAlert(c *Context, w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+
+	clog := c.Log().WithFields(log.Fields{
+		"username":     c.Params.ByName("username"),
+		"slug":         c.Params.ByName("slug"),
+		"auth_user_id": c.User.Id,
+	})
+
+	// Parse the JSON POST body
+	var form SaveDownloadAlertForm
+	if !decodeForm(c, w, req, clog, "download alert", &form) {
+		return
+	}
+
+	// Validation
+	v := NewValidator()
+	v.Field("multiplier", "Multiplier").Check(form.Multiplier >= minDownloadAlertMultiplier,
+		"must be at least 2")
+	v.Field("min_downloads", "Minimum downloads").Check(form.MinDownloads >= 1,
+		"must be at least 1")
+	v.Field("email", "Alerts").Check(form.Email || form.Webhook,
+		"must be sent by e-mail, webhook, or both")
+	if v.Refuse(c, w) {
+		return
+	}
+
+	m := accessModel(c, w, clog)
+	if m == nil {
+		return
+	}
+	if !authorize(c, w, m, ACTION_MANAGE,
+		"You don't have permission to manage this model's alerts") {
+		return
+	}
+
+	clog = clog.WithField("model_id", m.Id)
+
+	alert := models.NewDownloadAlert(m.Id, form.Multiplier, form.MinDownloads,
+		form.Email, form.Webhook)
+	old, err := c.Api.DownloadAlert.ByModelId(m.Id)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up download alert")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not save the download alert, please try again soon"))
+		return
+	}
+	if old != nil {
+		alert.Id = old.Id
+		alert.CreatedTime = old.CreatedTime
+		alert.LastAlertTime = old.LastAlertTime
+	}
+	if err = c.Api.DownloadAlert.Save(alert); err != nil {
+		clog.WithField("err", err).Error("Could not save download alert")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not save the download alert, please try again soon"))
+		return
+	}
+
+	clog.WithField("download_alert_id", alert.Id).Info("Saved download alert")
+
+	c.Render.JSON(w, http.StatusOK, map[string]interface{}{"download_alert": alert})
+}
@@ -0,0 +1,82 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/models"
+	"github.com/pborman/uuid"
+)
+
+// Flags can be turned on for at most this many users, and as many
+// organizations, by id; beyond that, roll them out by percentage
+const MaxFlagTargets = 1000
+
+type SaveFeatureFlagForm struct {
+	Name            string   `json:"name"`
+	Description     string   `json:"description"`
+	Enabled         bool     `json:"enabled"`
+	Percent         int      `json:"percent"`
+	UserIds         []string `json:"user_ids"`
+	OrganizationIds []string `json:"organization_ids"`
+}
+
+// HandleSaveFeatureFlag creates a feature flag, or replaces the one with the
+// same name.
+func HandleSaveFeatureFlag(c *Context, w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+
+	clog := c.Log().WithField("user_id", c.User.Id)
+
+	// Parse the JSON POST body
+	var form SaveFeatureFlagForm
+	if !decodeForm(c, w, req, clog, "feature flag", &form) {
+		return
+	}
+	form.Name = strings.TrimSpace(form.Name)
+	form.Description = strings.TrimSpace(form.Description)
+	v := NewValidator()
+	v.Field("name", "Name").Required(form.Name).Matches(form.Name, models.FlagNameReg,
+		"can contain only lowercase letters, numbers, and underscore, up to 64 of them")
+	v.Field("description", "Description").MaxLength(form.Description, 500)
+	v.Field("percent", "Percent").Range(form.Percent, 0, 100)
+	userIds := v.Field("user_ids", "User ids").MaxItems(len(form.UserIds), MaxFlagTargets)
+	for _, id := range form.UserIds {
+		userIds.Check(uuid.Parse(id) != nil, "must be valid, and "+id+" isn't")
+	}
+	orgIds := v.Field("organization_ids", "Organization ids").
+		MaxItems(len(form.OrganizationIds), MaxFlagTargets)
+	for _, id := range form.OrganizationIds {
+		orgIds.Check(uuid.Parse(id) != nil, "must be valid, and "+id+" isn't")
+	}
+	if v.Refuse(c, w) {
+		return
+	}
+	clog = clog.WithField("flag", form.Name)
+
+	flag := models.NewFeatureFlag(form.Name, form.Description)
+	flag.Enabled = form.Enabled
+	flag.Percent = form.Percent
+	flag.SetTargets(form.UserIds, form.OrganizationIds)
+	if err := c.Api.FeatureFlag.Save(flag); err != nil {
+		clog.WithField("err", err).Error("Could not save feature flag")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not save feature flag, please try again soon"))
+		return
+	}
+
+	clog.WithFields(log.Fields{
+		"enabled": flag.Enabled,
+		"percent": flag.Percent,
+	}).Warn("Admin saved feature flag")
+	audit(c, req, c.User.Id, "", models.AUDIT_FEATURE_FLAG_SAVE, "feature_flag",
+		flag.Name, map[string]interface{}{
+			"enabled":          flag.Enabled,
+			"percent":          flag.Percent,
+			"user_ids":         flag.UserIds,
+			"organization_ids": flag.OrganizationIds,
+		})
+
+	c.Render.JSON(w, http.StatusOK, map[string]*models.FeatureFlag{"feature_flag": flag})
+}
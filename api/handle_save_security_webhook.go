@@ -0,0 +1,76 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"net/url"
+
+	"github.com/ericflo/gradientzoo/models"
+	"github.com/ericflo/gradientzoo/utils"
+)
+
+type SaveSecurityWebhookForm struct {
+	Url string `json:"url"`
+}
+
+// Saving a webhook always makes a new secret, which is only ever shown here,
+// so saving the same URL again is how the secret gets rotated
+func HandleSaveSecurityWebhook(c *Context, w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+
+	clog := c.Log().WithField("user_id", c.User.Id)
+
+	// Parse the JSON POST body
+	var form SaveSecurityWebhookForm
+	if !decodeForm(c, w, req, clog, "security webhook", &form) {
+		return
+	}
+
+	// Validation, where the events are sensitive enough to need https outside
+	// of development
+	u, err := url.Parse(form.Url)
+	v := NewValidator()
+	v.Field("url", "Webhook").
+		WebUrl(form.Url).
+		Check(!utils.Conf.Production || (err == nil && u.Scheme == "https"),
+			"must be an https:// address")
+	if v.Refuse(c, w) {
+		return
+	}
+
+	hook, err := models.NewSecurityWebhook(c.User.Id, form.Url)
+	if err != nil {
+		clog.WithField("err", err).Error("Could not make security webhook")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not save your webhook, please try again soon"))
+		return
+	}
+
+	// There's only ever one per user
+	old, err := c.Api.SecurityWebhook.ByUserId(c.User.Id)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up security webhook")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not save your webhook, please try again soon"))
+		return
+	}
+	if old != nil {
+		hook.Id = old.Id
+		hook.CreatedTime = old.CreatedTime
+	}
+	if err = c.Api.SecurityWebhook.Save(hook); err != nil {
+		clog.WithField("err", err).Error("Could not save security webhook")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not save your webhook, please try again soon"))
+		return
+	}
+
+	clog.WithField("security_webhook_id", hook.Id).Info("Saved security webhook")
+	audit(c, req, c.User.Id, c.User.Id, models.AUDIT_SECURITY_HOOK_SAVE,
+		"security_webhook", hook.Id, map[string]interface{}{"url": hook.Url})
+
+	c.Render.JSON(w, http.StatusOK, map[string]interface{}{
+		"security_webhook": hook,
+		"secret":           hook.Secret,
+	})
+}
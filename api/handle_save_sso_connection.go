@@ -0,0 +1,112 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"strings"
+
+	"github.com/ericflo/gradientzoo/models"
+)
+
+type SaveSsoConnectionForm struct {
+	Domain       string            `json:"domain"`
+	Issuer       string            `json:"issuer"`
+	AuthUrl      string            `json:"auth_url"`
+	TokenUrl     string            `json:"token_url"`
+	UserinfoUrl  string            `json:"userinfo_url"`
+	ClientId     string            `json:"client_id"`
+	ClientSecret string            `json:"client_secret"`
+	RoleClaim    string            `json:"role_claim"`
+	RoleMap      map[string]string `json:"role_map"`
+	Enabled      *bool             `json:"enabled"`
+}
+
+func HandleSaveSsoConnection(c *Context, w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+
+	clog := c.Log().WithField("user_id", c.User.Id)
+
+	// Parse the JSON POST body
+	var form SaveSsoConnectionForm
+	if !decodeForm(c, w, req, clog, "sso connection", &form) {
+		return
+	}
+	form.Domain = strings.ToLower(strings.TrimSpace(form.Domain))
+	v := NewValidator()
+	v.Field("domain", "Domain").Check(form.Domain != "" && !strings.Contains(form.Domain, "@"),
+		"is required, like example.com")
+	roles := v.Field("role_map", "Roles")
+	for _, role := range form.RoleMap {
+		roles.Check(models.ValidSsoRole(role), "must be one of 'member', 'admin'")
+	}
+	if v.Refuse(c, w) {
+		return
+	}
+
+	clog = clog.WithField("domain", form.Domain)
+
+	// Saving a domain that already has a connection updates it
+	conn, err := c.Api.SsoConnection.ByDomain(form.Domain)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up sso connection")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not save that sso connection, please try again soon"))
+		return
+	}
+	if conn == nil {
+		conn = models.NewSsoConnection(form.Domain)
+	}
+
+	conn.Issuer = strings.TrimSpace(form.Issuer)
+	conn.AuthUrl = strings.TrimSpace(form.AuthUrl)
+	conn.TokenUrl = strings.TrimSpace(form.TokenUrl)
+	conn.UserinfoUrl = strings.TrimSpace(form.UserinfoUrl)
+	conn.ClientId = strings.TrimSpace(form.ClientId)
+	conn.RoleClaim = strings.TrimSpace(form.RoleClaim)
+	if form.ClientSecret != "" {
+		conn.ClientSecret = form.ClientSecret
+	}
+	if form.Enabled != nil {
+		conn.Enabled = *form.Enabled
+	}
+	if err = conn.SetRoleMap(form.RoleMap); err != nil {
+		clog.WithField("err", err).Error("Could not encode role map")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not save that sso connection, please try again soon"))
+		return
+	}
+	// The secret may have been given before, and kept
+	v.Field("issuer", "Issuer").Required(conn.Issuer)
+	v.Field("client_id", "Client id").Required(conn.ClientId)
+	v.Field("client_secret", "Client secret").Required(conn.ClientSecret)
+	if v.Refuse(c, w) {
+		return
+	}
+
+	// Endpoints that weren't given are looked up from the issuer
+	if conn.AuthUrl == "" || conn.TokenUrl == "" || conn.UserinfoUrl == "" {
+		if err = ssoDiscover(conn); err != nil {
+			clog.WithField("err", err).Info("Could not discover sso endpoints")
+			c.Render.JSON(w, http.StatusBadRequest,
+				ApiErr(ERR_INVALID_REQUEST, "Could not discover endpoints from that issuer, "+
+					"please specify them"))
+			return
+		}
+	}
+
+	if err = c.Api.SsoConnection.Save(conn); err != nil {
+		clog.WithField("err", err).Error("Could not save sso connection")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not save that sso connection, please try again soon"))
+		return
+	}
+
+	audit(c, req, c.User.Id, "", models.AUDIT_SSO_CONNECTION_SAVE,
+		"sso_connection", conn.Id, map[string]interface{}{
+			"domain":  conn.Domain,
+			"issuer":  conn.Issuer,
+			"enabled": conn.Enabled,
+		})
+
+	c.Render.JSON(w, http.StatusOK, map[string]*models.SsoConnection{"connection": conn})
+}
@@ -0,0 +1,21 @@
+package api
+
+import (
+	"net/http"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+func HandleSavedSearches(c *Context, w http.ResponseWriter, req *http.Request) {
+	searches, err := c.Api.SavedSearch.ByUserId(c.User.Id)
+	if err != nil {
+		c.Log().WithFields(log.Fields{
+			"err":          err,
+			"auth_user_id": c.User.Id,
+		}).Error("Could not get saved searches")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not get your saved searches, please try again soon"))
+		return
+	}
+	c.Render.JSON(w, http.StatusOK, map[string]interface{}{"saved_searches": searches})
+}
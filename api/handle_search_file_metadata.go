@@ -0,0 +1,119 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/models"
+)
+
+const MaxMetadataSearchResults = 200
+
+func HandleSearchFileMetadata(c *Context, w http.ResponseWriter, req *http.Request) {
+	username := c.Params.ByName("username")
+	query := req.URL.Query()
+
+	fields := log.Fields{"username": username, "where": query["where"]}
+	if c.User != nil {
+		fields["auth_user_id"] = c.User.Id
+	}
+	clog := c.Log().WithFields(fields)
+
+	// Parse the predicates, each of which looks like key<op>value
+	if len(query["where"]) == 0 {
+		c.Render.JSON(w, http.StatusBadRequest,
+			ApiErr(ERR_INVALID_REQUEST, "Must specify at least one 'where' predicate"))
+		return
+	}
+	preds := make([]*models.MetadataPredicate, 0, len(query["where"]))
+	for _, where := range query["where"] {
+		pred, err := models.ParseMetadataPredicate(where)
+		if err != nil {
+			c.Render.JSON(w, http.StatusBadRequest, ApiErr(ERR_INVALID_REQUEST, err.Error()))
+			return
+		}
+		preds = append(preds, pred)
+	}
+
+	limit := 50
+	if limitStr := query.Get("limit"); limitStr != "" {
+		var err error
+		if limit, err = strconv.Atoi(limitStr); err != nil || limit < 1 {
+			c.Render.JSON(w, http.StatusBadRequest,
+				ApiErr(ERR_INVALID_REQUEST, "Limit must be a positive number"))
+			return
+		}
+		if limit > MaxMetadataSearchResults {
+			limit = MaxMetadataSearchResults
+		}
+	}
+
+	user, err := c.Api.User.ByUsername(username)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up user by username")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not search those files, please try again soon"))
+		return
+	}
+	if err == sql.ErrNoRows || user == nil {
+		c.Render.JSON(w, http.StatusNotFound,
+			ApiErr(ERR_USER_NOT_FOUND, "No user by that username could be found"))
+		return
+	}
+
+	clog = clog.WithField("user_id", user.Id)
+
+	// Only the owner gets to search through their private models
+	includePrivate := c.User != nil && c.User.Id == user.Id
+
+	files, err := c.Api.File.SearchMetadata(user.Id, includePrivate, preds, limit)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not search file metadata")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not search those files, please try again soon"))
+		return
+	}
+
+	// Hydrate the file objects
+	if err = c.Api.File.Hydrate(files); err != nil {
+		clog.WithField("err", err).Error("Could not hydrate files")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not search those files, please try again soon"))
+		return
+	}
+
+	// Only send the metadata keys the client asked for
+	projectFileMetadata(req, files)
+
+	// Build up a unique list of model ids in the keys of a map
+	modelIdKeys := map[string]bool{}
+	for _, f := range files {
+		modelIdKeys[f.ModelId] = true
+	}
+
+	// Now extract those model id keys into a slice
+	modelIds := make([]interface{}, 0, len(modelIdKeys))
+	for modelId := range modelIdKeys {
+		modelIds = append(modelIds, modelId)
+	}
+
+	// Get the models those files belong to
+	ms, err := c.Api.Model.ByIds(modelIds)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithFields(log.Fields{
+			"err":      err,
+			"modelIds": modelIds,
+		}).Error("Could not get models by id")
+		ms = []*models.Model{}
+	}
+
+	// Drop anything the token the search was made with can't read
+	files, ms = visibleFiles(c, files, ms)
+
+	c.Render.JSON(w, http.StatusOK, map[string]interface{}{
+		"files":  files,
+		"models": ms,
+	})
+}
@@ -0,0 +1,83 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/models"
+)
+
+const MaxModelSearchPageSize = 50
+
+func HandleSearchModels(c *Context, w http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+	q := query.Get("q")
+
+	fields := log.Fields{"q": q}
+	var userId string
+	if c.User != nil {
+		userId = c.User.Id
+		fields["auth_user_id"] = userId
+	}
+	clog := c.Log().WithFields(fields)
+
+	// Validation
+	filter, ok := modelFilter(c, w, req)
+	if !ok {
+		return
+	}
+	limit := 20
+	offset := 0
+	v := NewValidator()
+	v.Field("q", "Q").Check(q != "" || !filter.Empty(), "is required unless there's a filter")
+	v.Field("limit", "Limit").Int(query.Get("limit"), &limit).Check(limit > 0, "must be a positive number")
+	v.Field("offset", "Offset").Int(query.Get("offset"), &offset).Check(offset >= 0, "must not be negative")
+	if v.Refuse(c, w) {
+		return
+	}
+	if limit > MaxModelSearchPageSize {
+		limit = MaxModelSearchPageSize
+	}
+
+	results, err := searcher.Search(req.Context(), q, userId, filter, limit, offset)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not search models")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not search models, please try again soon"))
+		return
+	}
+
+	// The models come back best match first, with how they matched by id
+	ms := make([]*models.Model, 0, len(results.Matches))
+	byId := make(map[string]*models.ModelMatch, len(results.Matches))
+	for _, match := range results.Matches {
+		ms = append(ms, &match.Model)
+		byId[match.Id] = match
+	}
+
+	// Hydrate the model objects
+	if err = c.Api.Model.Hydrate(ms); err != nil {
+		clog.WithField("err", err).Error("Could not hydrate")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not search models, please try again soon"))
+		return
+	}
+
+	// Look up whoever owns the models, once each
+	users, err := c.Load.Owners(ms)
+	if err != nil {
+		clog.WithField("err", err).Error("Could not get users by id")
+		users = []*models.User{}
+	}
+
+	resp := map[string]interface{}{
+		"models":  ms,
+		"users":   users,
+		"matches": byId,
+	}
+	if results.Facets != nil {
+		resp["facets"] = results.Facets
+	}
+	c.Render.JSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,66 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+const MaxUserSearchPageSize = 50
+
+func HandleSearchUsers(c *Context, w http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+	q := query.Get("q")
+
+	fields := log.Fields{"q": q}
+	if c.User != nil {
+		fields["auth_user_id"] = c.User.Id
+	}
+	clog := c.Log().WithFields(fields)
+
+	// Validation
+	if q == "" {
+		c.Render.JSON(w, http.StatusBadRequest, ApiErr(ERR_INVALID_REQUEST, "Q is required"))
+		return
+	}
+	limit := 20
+	if limitStr := query.Get("limit"); limitStr != "" {
+		var err error
+		if limit, err = strconv.Atoi(limitStr); err != nil || limit <= 0 {
+			c.Render.JSON(w, http.StatusBadRequest,
+				ApiErr(ERR_INVALID_REQUEST, "Limit must be a positive number"))
+			return
+		}
+		if limit > MaxUserSearchPageSize {
+			limit = MaxUserSearchPageSize
+		}
+	}
+	offset := 0
+	if offsetStr := query.Get("offset"); offsetStr != "" {
+		var err error
+		if offset, err = strconv.Atoi(offsetStr); err != nil || offset < 0 {
+			c.Render.JSON(w, http.StatusBadRequest,
+				ApiErr(ERR_INVALID_REQUEST, "Offset must not be negative"))
+			return
+		}
+	}
+
+	users, err := c.Api.User.ByPrefix(q, limit, offset)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not search users")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not search users, please try again soon"))
+		return
+	}
+
+	// Hydrate the user objects
+	if err = c.Api.User.Hydrate(users); err != nil {
+		clog.WithField("err", err).Error("Could not hydrate users")
+	}
+
+	c.Render.JSON(w, http.StatusOK, map[string]interface{}{
+		"users": users,
+	})
+}
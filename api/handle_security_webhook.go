@@ -0,0 +1,24 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/ericflo/gradientzoo/models"
+)
+
+func HandleSecurityWebhook(c *Context, w http.ResponseWriter, req *http.Request) {
+	clog := c.Log().WithField("user_id", c.User.Id)
+
+	hook, err := c.Api.SecurityWebhook.ByUserId(c.User.Id)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up security webhook")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not get your webhook, please try again soon"))
+		return
+	}
+
+	c.Render.JSON(w, http.StatusOK, map[string]*models.SecurityWebhook{
+		"security_webhook": hook,
+	})
+}
@@ -0,0 +1,11 @@
+package api
+
+import (
+	"net/http"
+)
+
+func HandleServiceAccountTokens(c *Context, w http.ResponseWriter, req *http.Request) {
+	if service := serviceAccountFor(c, w, c.Params.ByName("id")); service != nil {
+		apiTokensRespond(c, w, service)
+	}
+}
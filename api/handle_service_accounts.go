@@ -0,0 +1,39 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/ericflo/gradientzoo/models"
+)
+
+func HandleServiceAccounts(c *Context, w http.ResponseWriter, req *http.Request) {
+	clog := c.Log().WithField("user_id", c.User.Id)
+
+	// Organization owners manage all of their organization's service accounts
+	orgId := ""
+	org, err := userOrganization(c.Api, c.User.Id)
+	if err != nil {
+		clog.WithField("err", err).Error("Could not look up organization")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not get your service accounts, please try again soon"))
+		return
+	}
+	if org != nil && org.OwnerId == c.User.Id {
+		orgId = org.Id
+	}
+
+	services, err := c.Api.User.ServiceAccounts(c.User.Id, orgId)
+	if err != nil {
+		clog.WithField("err", err).Error("Could not look up service accounts")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not get your service accounts, please try again soon"))
+		return
+	}
+
+	// Hydrate the user objects
+	if err = c.Api.User.Hydrate(services); err != nil {
+		clog.WithField("err", err).Error("Could not hydrate")
+	}
+
+	c.Render.JSON(w, http.StatusOK, map[string][]*models.User{"service_accounts": services})
+}
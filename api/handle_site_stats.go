@@ -0,0 +1,68 @@
+package api
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/models"
+)
+
+// Sitewide stats only need to be about right, so they're worked out at most
+// this often and shared by everyone asking in between
+const siteStatsTTL = 10 * time.Minute
+
+const siteStatsFrameworks = 5
+
+var siteStats = &siteStatsCache{}
+
+// siteStatsCache keeps the last sitewide stats in memory, like the rate
+// limiter, so the homepage and dashboards polling them never hit the database
+// more than once per siteStatsTTL.
+type siteStatsCache struct {
+	mu       sync.Mutex
+	stats    *models.SiteStats
+	computed time.Time
+}
+
+// Get returns the cached stats, working them out again if they're stale.  The
+// lock is held while they are, so only one request ever does the work.
+func (s *siteStatsCache) Get(api *models.ApiCollection) (*models.SiteStats, time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stats != nil && time.Since(s.computed) < siteStatsTTL {
+		return s.stats, s.computed, nil
+	}
+	stats, err := api.Model.SiteStats(siteStatsFrameworks)
+	if err != nil {
+		return nil, s.computed, err
+	}
+	s.stats, s.computed = stats, time.Now().UTC()
+	return s.stats, s.computed, nil
+}
+
+func HandleSiteStats(c *Context, w http.ResponseWriter, req *http.Request) {
+	fields := log.Fields{}
+	if c.User != nil {
+		fields["auth_user_id"] = c.User.Id
+	}
+	clog := c.Log().WithFields(fields)
+
+	stats, computed, err := siteStats.Get(c.Api)
+	if err != nil {
+		clog.WithField("err", err).Error("Could not look up site stats")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not get the stats, please try again soon"))
+		return
+	}
+
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	c.Render.JSON(w, http.StatusOK, map[string]interface{}{
+		"models":         stats.Models,
+		"files":          stats.Files,
+		"week_downloads": stats.WeekDownloads,
+		"frameworks":     stats.Frameworks,
+		"computed_time":  computed,
+	})
+}
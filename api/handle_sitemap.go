@@ -0,0 +1,111 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/xml"
+	"net/http"
+	"net/url"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/models"
+	"github.com/ericflo/gradientzoo/utils"
+)
+
+// The most URLs the sitemap protocol allows in one file
+const sitemapPageSize = 50000
+
+type sitemapUrl struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+type sitemapUrlSet struct {
+	XMLName xml.Name      `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 urlset"`
+	Urls    []*sitemapUrl `xml:"url"`
+}
+
+type sitemapIndex struct {
+	XMLName  xml.Name      `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 sitemapindex"`
+	Sitemaps []*sitemapUrl `xml:"sitemap"`
+}
+
+// HandleSitemap serves the sitemap of public models.  It's meant to be proxied
+// at the frontend's /sitemap.xml, so that's where its own links point.  Once
+// there are too many models for one file it becomes an index of pages, each
+// starting after the ?cursor= of the last model on the page before it.
+func HandleSitemap(c *Context, w http.ResponseWriter, req *http.Request) {
+	cursor := req.URL.Query().Get("cursor")
+
+	clog := c.Log().WithField("cursor", cursor)
+
+	var afterTime time.Time
+	var afterModelId string
+	if cursor != "" {
+		var err error
+		if afterTime, afterModelId, err = parseFeedCursor(cursor); err != nil {
+			c.Render.JSON(w, http.StatusBadRequest, ApiErr(ERR_INVALID_REQUEST, err.Error()))
+			return
+		}
+	} else {
+		count, err := c.Api.Model.CountByVisibility("public")
+		if err != nil {
+			clog.WithField("err", err).Error("Could not count public models")
+			c.Render.JSON(w, http.StatusBadGateway,
+				ApiErr(ERR_UNAVAILABLE, "Could not build the sitemap, please try again soon"))
+			return
+		}
+		if count > sitemapPageSize {
+			handleSitemapIndex(c, w, clog, count)
+			return
+		}
+	}
+
+	feed, err := c.Api.Model.Feed(afterTime, afterModelId, sitemapPageSize)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not get model feed")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not build the sitemap, please try again soon"))
+		return
+	}
+
+	set := &sitemapUrlSet{Urls: make([]*sitemapUrl, 0, len(feed))}
+	for _, m := range feed {
+		set.Urls = append(set.Urls, &sitemapUrl{
+			Loc:     modelUrl(m.Username, m.Slug),
+			LastMod: m.UpdatedTime.UTC().Format(time.RFC3339),
+		})
+	}
+	c.Render.XML(w, http.StatusOK, set)
+}
+
+func handleSitemapIndex(c *Context, w http.ResponseWriter, clog *log.Entry, count int) {
+	ends, err := c.Api.Model.FeedPageEnds(sitemapPageSize)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not get sitemap pages")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not build the sitemap, please try again soon"))
+		return
+	}
+
+	// The first page has no cursor, but it can't be the bare sitemap URL or
+	// it would just be this index again
+	cursors := []string{feedCursor(&models.FeedModel{
+		Id: "00000000-0000-0000-0000-000000000000",
+	})}
+	for i, end := range ends {
+		// The last model ending a page doesn't start another one
+		if (i+1)*sitemapPageSize >= count {
+			break
+		}
+		cursors = append(cursors, feedCursor(end))
+	}
+
+	index := &sitemapIndex{Sitemaps: make([]*sitemapUrl, 0, len(cursors))}
+	for _, cursor := range cursors {
+		index.Sitemaps = append(index.Sitemaps, &sitemapUrl{
+			Loc: utils.Conf.WwwUrl + "/sitemap.xml?cursor=" + url.QueryEscape(cursor),
+		})
+	}
+	c.Render.XML(w, http.StatusOK, index)
+}
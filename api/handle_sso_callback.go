@@ -0,0 +1,193 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"strings"
+
+	"github.com/ericflo/gradientzoo/models"
+	"github.com/pborman/uuid"
+)
+
+func HandleSsoCallback(c *Context, w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+
+	// Parse the JSON POST body
+	var form OAuthCallbackForm
+	if !decodeForm(c, w, req, c.Log().WithField("path", req.URL.Path), "sso callback", &form) {
+		return
+	}
+	if form.Code == "" || uuid.Parse(form.State) == nil {
+		c.Render.JSON(w, http.StatusBadRequest,
+			ApiErr(ERR_INVALID_REQUEST, "Must specify a code and state"))
+		return
+	}
+
+	clog := c.Log().WithField("state", form.State)
+
+	// Make sure this sign in was started here, and only finish it once
+	state, err := c.Api.UserIdentity.TakeState(form.State)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not take oauth state")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not sign you in, please try again soon"))
+		return
+	}
+	if state == nil || !strings.HasPrefix(state.Provider, "sso:") || state.Expired() {
+		c.Render.JSON(w, http.StatusBadRequest,
+			ApiErr(ERR_SESSION_EXPIRED, "That sign in has expired, please try again"))
+		return
+	}
+
+	conn, err := c.Api.SsoConnection.ById(strings.TrimPrefix(state.Provider, "sso:"))
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up sso connection")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not sign you in, please try again soon"))
+		return
+	}
+	if conn == nil || !conn.Enabled {
+		c.Render.JSON(w, http.StatusNotFound,
+			ApiErr(ERR_NOT_FOUND, "Single sign-on is no longer set up for your domain"))
+		return
+	}
+
+	clog = clog.WithField("domain", conn.Domain)
+
+	provider := ssoProvider(conn)
+	accessToken, err := provider.Exchange(form.Code)
+	if err != nil {
+		clog.WithField("err", err).Info("Could not exchange sso code")
+		c.Render.JSON(w, http.StatusBadRequest,
+			ApiErr(ERR_INVALID_CREDENTIALS, "Could not sign you in with "+conn.Domain+", please try again"))
+		return
+	}
+	profile, err := provider.Profile(accessToken)
+	if err != nil {
+		clog.WithField("err", err).Error("Could not get sso profile")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not sign you in with "+conn.Domain+", please try again soon"))
+		return
+	}
+	if profile.Email == "" {
+		c.Render.JSON(w, http.StatusBadRequest,
+			ApiErr(ERR_INVALID_REQUEST, "Your identity provider didn't send a verified "+conn.Domain+
+				" e-mail address"))
+		return
+	}
+
+	clog = clog.WithField("provider_user_id", profile.Id)
+
+	ident, err := c.Api.UserIdentity.ByProvider(provider.Name, profile.Id)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up identity")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not sign you in, please try again soon"))
+		return
+	}
+
+	var user *models.User
+	if ident != nil {
+		user, err = c.Api.User.ById(ident.UserId)
+	} else {
+		// The identity provider speaks for the whole domain, so unlike other
+		// providers it may sign people into accounts that already exist
+		user, err = c.Api.User.ByEmail(profile.Email)
+	}
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up user")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not sign you in, please try again soon"))
+		return
+	}
+
+	if user == nil {
+		username, err := oauthUsername(c, profile.Username)
+		if err != nil {
+			clog.WithField("err", err).Error("Could not pick a username")
+			c.Render.JSON(w, http.StatusBadGateway,
+				ApiErr(ERR_UNAVAILABLE, "Could not sign you up, please try again soon"))
+			return
+		}
+		user = models.NewUser(profile.Email, username, "")
+		user.PasswordHash = ""
+		user.EmailVerified = true
+		if err = c.Api.User.Save(user); err != nil {
+			clog.WithField("err", err).Error("Could not save user")
+			c.Render.JSON(w, http.StatusBadGateway,
+				ApiErr(ERR_UNAVAILABLE, "Could not sign you up, please try again soon"))
+			return
+		}
+		clog.WithField("user_id", user.Id).Info("Provisioned user with sso")
+		audit(c, req, user.Id, user.Id, models.AUDIT_REGISTER, "user", user.Id,
+			map[string]interface{}{"method": "sso", "domain": conn.Domain})
+	}
+
+	clog = clog.WithField("user_id", user.Id)
+
+	if ident == nil {
+		ident = models.NewUserIdentity(user.Id, provider.Name, profile.Id,
+			profile.Email)
+		if err = c.Api.UserIdentity.Save(ident); err != nil {
+			clog.WithField("err", err).Error("Could not save identity")
+			c.Render.JSON(w, http.StatusBadGateway,
+				ApiErr(ERR_UNAVAILABLE, "Could not sign you in, please try again soon"))
+			return
+		}
+		audit(c, req, user.Id, user.Id, models.AUDIT_OAUTH_LINK,
+			"user_identity", ident.Id,
+			map[string]interface{}{"provider": "sso", "domain": conn.Domain})
+	}
+
+	// Roles come from the identity provider on every sign in, so taking
+	// someone out of a group there takes their role away here too
+	if conn.RoleClaim != "" {
+		role := conn.Role(ssoClaimValues(profile.Claims, conn.RoleClaim))
+		isAdmin := role == models.SSO_ROLE_ADMIN
+		if isAdmin != user.IsAdmin {
+			if err = c.Api.User.SetAdmin(user.Id, isAdmin); err != nil {
+				clog.WithField("err", err).Error("Could not update role")
+				c.Render.JSON(w, http.StatusBadGateway,
+					ApiErr(ERR_UNAVAILABLE, "Could not sign you in, please try again soon"))
+				return
+			}
+			user.IsAdmin = isAdmin
+			clog.WithField("role", role).Info("Changed role from sso")
+			audit(c, req, user.Id, user.Id, models.AUDIT_SSO_ROLE_CHANGE, "user",
+				user.Id, map[string]interface{}{"role": role, "domain": conn.Domain})
+		}
+	}
+
+	if user.TotpEnabled {
+		pendingRespond(c, w, clog, user)
+		return
+	}
+
+	authToken := models.NewAuthToken(user.Id)
+	if err = c.Api.AuthToken.Save(authToken); err != nil {
+		clog.WithField("err", err).Error("Could not save auth token")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not sign you in, please try again soon"))
+		return
+	}
+	refreshToken := models.NewRefreshToken(user.Id)
+	if err = c.Api.RefreshToken.Save(refreshToken); err != nil {
+		clog.WithField("err", err).Error("Could not save refresh token")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not sign you in, please try again soon"))
+		return
+	}
+
+	// Hydrate the user object
+	if err = c.Api.User.Hydrate([]*models.User{user}); err != nil {
+		clog.WithField("err", err).Error("Could not hydrate")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not sign you in, please try again soon"))
+		return
+	}
+
+	audit(c, req, user.Id, user.Id, models.AUDIT_LOGIN, "auth_token",
+		authToken.Id, map[string]interface{}{"method": "sso", "domain": conn.Domain})
+
+	sessionRespond(c, w, req, user, authToken, refreshToken)
+}
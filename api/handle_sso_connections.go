@@ -0,0 +1,23 @@
+package api
+
+import (
+	"net/http"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/models"
+)
+
+func HandleSsoConnections(c *Context, w http.ResponseWriter, req *http.Request) {
+	conns, err := c.Api.SsoConnection.All()
+	if err != nil {
+		c.Log().WithFields(log.Fields{
+			"err":     err,
+			"user_id": c.User.Id,
+		}).Error("Could not list sso connections")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not get sso connections, please try again soon"))
+		return
+	}
+
+	c.Render.JSON(w, http.StatusOK, map[string][]*models.SsoConnection{"connections": conns})
+}
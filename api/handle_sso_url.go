@@ -0,0 +1,59 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/ericflo/gradientzoo/models"
+)
+
+type SsoUrlForm struct {
+	Email string `json:"email"`
+}
+
+func HandleSsoUrl(c *Context, w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+
+	// Parse the JSON POST body
+	var form SsoUrlForm
+	if !decodeForm(c, w, req, c.Log().WithField("path", req.URL.Path), "sso", &form) {
+		return
+	}
+
+	domain := models.EmailDomain(form.Email)
+
+	clog := c.Log().WithField("domain", domain)
+
+	if domain == "" {
+		c.Render.JSON(w, http.StatusBadRequest,
+			ApiErr(ERR_INVALID_REQUEST, "Must specify an e-mail address"))
+		return
+	}
+
+	conn, err := c.Api.SsoConnection.ByDomain(domain)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up sso connection")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not start signing in, please try again soon"))
+		return
+	}
+	if conn == nil || !conn.Enabled {
+		c.Render.JSON(w, http.StatusNotFound,
+			ApiErr(ERR_NOT_FOUND, "Single sign-on isn't set up for "+domain))
+		return
+	}
+
+	provider := ssoProvider(conn)
+	state := models.NewOAuthState(provider.Name, "")
+	if err = c.Api.UserIdentity.SaveState(state); err != nil {
+		clog.WithField("err", err).Error("Could not save oauth state")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not start signing in, please try again soon"))
+		return
+	}
+
+	c.Render.JSON(w, http.StatusOK, map[string]interface{}{
+		"url":   provider.AuthCodeUrl(state.Id),
+		"state": state.Id,
+	})
+}
@@ -0,0 +1,57 @@
+package api
+
+import (
+	"net/http"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// HandleStarModel stars the model for the user, or unstars it for DELETE.
+// Starring something already starred, or unstarring something that isn't,
+// changes nothing.
+func HandleStarModel(c *Context, w http.ResponseWriter, req *http.Request) {
+	clog := c.Log().WithFields(log.Fields{
+		"user_id":  c.User.Id,
+		"username": c.Params.ByName("username"),
+		"slug":     c.Params.ByName("slug"),
+		"method":   req.Method,
+	})
+
+	m := accessModel(c, w, clog)
+	if m == nil {
+		return
+	}
+	if !authorize(c, w, m, ACTION_READ,
+		"You don't have permission to access this model") {
+		return
+	}
+
+	clog = clog.WithField("model_id", m.Id)
+
+	var err error
+	starred := req.Method != "DELETE"
+	if starred {
+		err = c.Api.ModelStar.Star(m.Id, c.User.Id)
+	} else {
+		err = c.Api.ModelStar.Unstar(m.Id, c.User.Id)
+	}
+	if err != nil {
+		clog.WithField("err", err).Error("Could not save star")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not star that model, please try again soon"))
+		return
+	}
+
+	stars, err := c.Api.ModelStar.CountsByModelIds([]string{m.Id})
+	if err != nil {
+		clog.WithField("err", err).Error("Could not count stars")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not star that model, please try again soon"))
+		return
+	}
+
+	c.Render.JSON(w, http.StatusOK, map[string]interface{}{
+		"starred": starred,
+		"stars":   stars[m.Id],
+	})
+}
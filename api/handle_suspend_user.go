@@ -0,0 +1,79 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/models"
+	"gopkg.in/guregu/null.v3"
+)
+
+type SuspendUserForm struct {
+	Reason string `json:"reason"`
+}
+
+func HandleSuspendUser(c *Context, w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+
+	id := c.Params.ByName("id")
+
+	clog := c.Log().WithFields(log.Fields{
+		"auth_user_id": c.User.Id,
+		"user_id":      id,
+	})
+
+	// Parse the JSON POST body
+	var form SuspendUserForm
+	if !decodeForm(c, w, req, clog, "suspend", &form) {
+		return
+	}
+	form.Reason = strings.TrimSpace(form.Reason)
+	v := NewValidator()
+	v.Field("reason", "Reason").Required(form.Reason)
+	if v.Refuse(c, w) {
+		return
+	}
+
+	user, err := c.Api.User.ById(id)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up user")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not suspend that user, please try again soon"))
+		return
+	}
+	if err == sql.ErrNoRows || user == nil {
+		c.Render.JSON(w, http.StatusNotFound,
+			ApiErr(ERR_USER_NOT_FOUND, "No user with that id could be found"))
+		return
+	}
+	if user.IsAdmin {
+		c.Render.JSON(w, http.StatusBadRequest,
+			ApiErr(ERR_FORBIDDEN, "Admins can't be suspended"))
+		return
+	}
+
+	user.SuspendedTime = null.TimeFrom(time.Now().UTC())
+	user.SuspendedReason = form.Reason
+	if err = c.Api.User.Save(user); err != nil {
+		clog.WithField("err", err).Error("Could not save user")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not suspend that user, please try again soon"))
+		return
+	}
+
+	// Their current session runs out, and can't be refreshed
+	if err = c.Api.RefreshToken.DeleteByUserId(user.Id); err != nil {
+		clog.WithField("err", err).Error("Could not delete refresh tokens")
+	}
+
+	clog.Info("User suspended")
+	audit(c, req, c.User.Id, user.Id, models.AUDIT_USER_SUSPEND, "user",
+		user.Id, map[string]interface{}{"reason": form.Reason})
+
+	c.Render.JSON(w, http.StatusOK, map[string]*AdminUser{
+		"user": NewAdminUser(user),
+	})
+}
@@ -0,0 +1,203 @@
+package api
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/models"
+)
+
+// takeoutFile is one file version in a takeout archive, along with where its
+// data is in the archive, if it's there.
+type takeoutFile struct {
+	*models.File
+	ArchivePath string `json:"archive_path"`
+}
+
+type takeoutModel struct {
+	*models.Model
+	Files []*takeoutFile `json:"files"`
+}
+
+func HandleTakeout(c *Context, w http.ResponseWriter, req *http.Request) {
+	clog := c.Log().WithField("user_id", c.User.Id)
+
+	// Gather everything up front, so that errors can still be reported before
+	// the archive starts streaming
+	ms, err := c.Api.Model.ByUserId(c.User.Id)
+	if err != nil {
+		clog.WithField("err", err).Error("Could not look up models")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not export your data, please try again soon"))
+		return
+	}
+	takeoutModels := []*takeoutModel{}
+	for _, m := range ms {
+		files, err := c.Api.File.ByModelId(m.Id)
+		if err != nil {
+			clog.WithField("err", err).Error("Could not look up files")
+			c.Render.JSON(w, http.StatusBadGateway,
+				ApiErr(ERR_UNAVAILABLE, "Could not export your data, please try again soon"))
+			return
+		}
+		fileIds := make([]string, len(files))
+		for i, f := range files {
+			fileIds[i] = f.Id
+		}
+		quarantines, err := c.Api.FileQuarantine.ActiveByFileIds(fileIds)
+		if err != nil {
+			clog.WithField("err", err).Error("Could not look up quarantines")
+			c.Render.JSON(w, http.StatusBadGateway,
+				ApiErr(ERR_UNAVAILABLE, "Could not export your data, please try again soon"))
+			return
+		}
+		tm := &takeoutModel{Model: m, Files: []*takeoutFile{}}
+		for _, f := range files {
+			tf := &takeoutFile{File: f}
+			// Quarantined data can't be downloaded, so it can't be exported
+			if q, ok := quarantines[f.Id]; ok {
+				f.Quarantine = q
+			} else if f.Status != "pending" {
+				tf.ArchivePath = fmt.Sprintf("files/%s/%s/%s/%s",
+					m.Slug, f.Framework, f.Id, f.Filename)
+			}
+			tm.Files = append(tm.Files, tf)
+		}
+		takeoutModels = append(takeoutModels, tm)
+	}
+	downloads, err := c.Api.DownloadHour.DailyByUserId(c.User.Id)
+	if err != nil {
+		clog.WithField("err", err).Error("Could not look up downloads")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not export your data, please try again soon"))
+		return
+	}
+	identities, err := c.Api.UserIdentity.ByUserId(c.User.Id)
+	if err != nil {
+		clog.WithField("err", err).Error("Could not look up identities")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not export your data, please try again soon"))
+		return
+	}
+	events := []*models.AuditEvent{}
+	var before int64
+	for {
+		page, err := c.Api.AuditEvent.ByOwnerId(c.User.Id, before, MaxAuditPageSize)
+		if err != nil {
+			clog.WithField("err", err).Error("Could not look up audit events")
+			c.Render.JSON(w, http.StatusBadGateway,
+				ApiErr(ERR_UNAVAILABLE, "Could not export your data, please try again soon"))
+			return
+		}
+		events = append(events, page...)
+		if len(page) < MaxAuditPageSize {
+			break
+		}
+		before = page[len(page)-1].Seq
+	}
+
+	// The user's own view of their account, which unlike the public one
+	// includes their e-mail address
+	account := map[string]interface{}{
+		"id":             c.User.Id,
+		"username":       c.User.Username,
+		"email":          c.User.Email,
+		"email_verified": c.User.EmailVerified,
+		"has_password":   c.User.HasPassword(),
+		"two_factor":     c.User.TotpEnabled,
+		"deletion_time":  c.User.DeletionTime,
+		"display_name":   c.User.DisplayName,
+		"bio":            c.User.Bio,
+		"affiliation":    c.User.Affiliation,
+		"website":        c.User.Website,
+		"created_time":   c.User.CreatedTime,
+	}
+
+	audit(c, req, c.User.Id, c.User.Id, models.AUDIT_TAKEOUT, "user",
+		c.User.Id, nil)
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(
+		"attachment; filename=\"gradientzoo-%s-%s.zip\"", c.User.Username,
+		time.Now().UTC().Format("20060102")))
+	w.WriteHeader(http.StatusOK)
+
+	// From here on the response has started, so errors can only be logged,
+	// which leaves the client with a truncated archive
+	zw := zip.NewWriter(w)
+	writeJson := func(name string, v interface{}) error {
+		fw, err := zw.Create(name)
+		if err != nil {
+			return err
+		}
+		enc, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fw.Write(enc)
+		return err
+	}
+	if err = writeJson("account.json", account); err != nil {
+		clog.WithField("err", err).Error("Could not write takeout archive")
+		return
+	}
+	if err = writeJson("models.json", takeoutModels); err != nil {
+		clog.WithField("err", err).Error("Could not write takeout archive")
+		return
+	}
+	if err = writeJson("downloads.json", downloads); err != nil {
+		clog.WithField("err", err).Error("Could not write takeout archive")
+		return
+	}
+	if err = writeJson("identities.json", identities); err != nil {
+		clog.WithField("err", err).Error("Could not write takeout archive")
+		return
+	}
+	if err = writeJson("audit.json", events); err != nil {
+		clog.WithField("err", err).Error("Could not write takeout archive")
+		return
+	}
+	// Blobs are streamed into the archive, since checkpoints can be far too
+	// big to hold in memory
+	writeBlob := func(name, blobFilename string) error {
+		rc, err := c.Blob.Open(blobFilename)
+		if err != nil {
+			return err
+		}
+		defer rc.Close()
+		fw, err := zw.Create(name)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(fw, rc)
+		return err
+	}
+	if c.User.AvatarFilename != "" {
+		if err = writeBlob("avatar.png", c.User.AvatarFilename); err != nil {
+			clog.WithField("err", err).Error("Could not write avatar to takeout archive")
+			return
+		}
+	}
+	for _, tm := range takeoutModels {
+		for _, tf := range tm.Files {
+			if tf.ArchivePath == "" {
+				continue
+			}
+			if err = writeBlob(tf.ArchivePath, tf.BlobFilename()); err != nil {
+				clog.WithFields(log.Fields{
+					"err":     err,
+					"file_id": tf.Id,
+				}).Error("Could not write file to takeout archive")
+				return
+			}
+		}
+	}
+	if err = zw.Close(); err != nil {
+		clog.WithField("err", err).Error("Could not write takeout archive")
+	}
+}
@@ -0,0 +1,39 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/ericflo/gradientzoo/models"
+)
+
+// Sends a test event right away, so people can check that their receiver
+// verifies signatures before relying on it
+func HandleTestSecurityWebhook(c *Context, w http.ResponseWriter, req *http.Request) {
+	clog := c.Log().WithField("user_id", c.User.Id)
+
+	hook, err := c.Api.SecurityWebhook.ByUserId(c.User.Id)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up security webhook")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not test your webhook, please try again soon"))
+		return
+	}
+	if hook == nil {
+		c.Render.JSON(w, http.StatusNotFound,
+			ApiErr(ERR_NOT_FOUND, "You haven't set up a security webhook"))
+		return
+	}
+
+	e := models.NewAuditEvent(c.User.Id, c.User.Id, WEBHOOK_TEST, "security_webhook",
+		hook.Id, nil)
+	e.Ip = clientIp(req)
+	e.UserAgent = req.UserAgent()
+	status := deliverSecurityWebhook(c.Api, hook, WEBHOOK_TEST, e)
+
+	c.Render.JSON(w, http.StatusOK, map[string]interface{}{
+		"status":          "ok",
+		"delivered":       status >= 200 && status < 300,
+		"response_status": status,
+	})
+}
@@ -0,0 +1,77 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/models"
+)
+
+const DefaultTrendingPageSize = 20
+const MaxTrendingPageSize = 100
+
+func HandleTrendingModels(c *Context, w http.ResponseWriter, req *http.Request) {
+	cursor := req.URL.Query().Get("cursor")
+
+	fields := log.Fields{"cursor": cursor}
+	if c.User != nil {
+		fields["auth_user_id"] = c.User.Id
+	}
+	clog := c.Log().WithFields(fields)
+
+	// Validation
+	limit, after, err := pageParams(req, "trending", DefaultTrendingPageSize, MaxTrendingPageSize)
+	if err != nil {
+		c.Render.JSON(w, http.StatusBadRequest, ApiErr(ERR_INVALID_REQUEST, err.Error()))
+		return
+	}
+	var afterScore float64
+	var afterModelId string
+	if after != nil {
+		if afterScore, afterModelId, err = trendingAfter(after); err != nil {
+			c.Render.JSON(w, http.StatusBadRequest, ApiErr(ERR_INVALID_REQUEST, err.Error()))
+			return
+		}
+	}
+
+	trending, err := c.Api.ModelTrending.Page(limit, afterScore, afterModelId)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up trending models")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not get those models, please try again soon"))
+		return
+	}
+
+	ms := make([]*models.Model, 0, len(trending))
+	for _, t := range trending {
+		ms = append(ms, &t.Model)
+	}
+
+	// Hydrate the model objects
+	if err = c.Api.Model.Hydrate(ms); err != nil {
+		clog.WithField("err", err).Error("Could not hydrate")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not get those models, please try again soon"))
+		return
+	}
+
+	// Look up whoever owns the models, once each
+	users, err := c.Load.Owners(ms)
+	if err != nil {
+		clog.WithField("err", err).Error("Could not get users by id")
+		users = []*models.User{}
+	}
+
+	// The next page starts after the last model on this one, if it was full
+	var next interface{}
+	if len(trending) == limit {
+		next = trendingCursor(trending[len(trending)-1])
+	}
+
+	c.Render.JSON(w, http.StatusOK, map[string]interface{}{
+		"models":      trending,
+		"users":       users,
+		"next_cursor": next,
+	})
+}
@@ -0,0 +1,44 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/ericflo/gradientzoo/models"
+)
+
+func HandleUnlockAccount(c *Context, w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+
+	// Parse the JSON POST body
+	var form SignedTokenForm
+	if !decodeForm(c, w, req, c.Log().WithField("path", req.URL.Path), "unlock", &form) {
+		return
+	}
+
+	user, err := userFromSignedToken(c, form.Token, TOKEN_PURPOSE_UNLOCK_ACCOUNT)
+	if err != nil {
+		c.Log().WithField("err", err).Error("Could not look up user for token")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not unlock your account, please try again soon"))
+		return
+	}
+	if user == nil {
+		c.Render.JSON(w, http.StatusBadRequest,
+			ApiErr(ERR_EXPIRED, "That link is not valid or has expired"))
+		return
+	}
+
+	clog := c.Log().WithField("user_id", user.Id)
+
+	if err = c.Api.User.ResetFailedLogins(user.Id); err != nil {
+		clog.WithField("err", err).Error("Could not reset failed logins")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not unlock your account, please try again soon"))
+		return
+	}
+
+	clog.Info("Unlocked account")
+	audit(c, req, user.Id, user.Id, models.AUDIT_ACCOUNT_UNLOCK, "user", user.Id, nil)
+
+	c.Render.JSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
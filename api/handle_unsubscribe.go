@@ -0,0 +1,66 @@
+package api
+
+import (
+	"net/http"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/models"
+)
+
+type UnsubscribeForm struct {
+	Token string `json:"token"`
+	Kind  string `json:"kind"`
+}
+
+// An empty kind is the link at the bottom of the weekly digest, which turns
+// off everything that was going into it
+func HandleUnsubscribe(c *Context, w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+
+	// Parse the JSON POST body
+	var form UnsubscribeForm
+	if !decodeForm(c, w, req, c.Log().WithField("path", req.URL.Path), "unsubscribe", &form) {
+		return
+	}
+
+	user, err := userFromSignedToken(c, form.Token, TOKEN_PURPOSE_UNSUBSCRIBE+":"+form.Kind)
+	if err != nil {
+		c.Log().WithField("err", err).Error("Could not look up user for token")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not unsubscribe you, please try again soon"))
+		return
+	}
+	if user == nil {
+		c.Render.JSON(w, http.StatusBadRequest,
+			ApiErr(ERR_EXPIRED, "That link is not valid or has expired"))
+		return
+	}
+
+	clog := c.Log().WithFields(log.Fields{"user_id": user.Id, "kind": form.Kind})
+
+	prefs, err := c.Api.Notification.Preferences(user.Id)
+	if err != nil {
+		clog.WithField("err", err).Error("Could not look up notification preferences")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not unsubscribe you, please try again soon"))
+		return
+	}
+	for kind, delivery := range prefs {
+		if form.Kind != "" && kind != form.Kind {
+			continue
+		}
+		if form.Kind == "" && delivery != models.DELIVERY_DIGEST {
+			continue
+		}
+		if err = c.Api.Notification.SetPreference(user.Id, kind, models.DELIVERY_OFF); err != nil {
+			clog.WithField("err", err).Error("Could not save notification preference")
+			c.Render.JSON(w, http.StatusBadGateway,
+				ApiErr(ERR_UNAVAILABLE, "Could not unsubscribe you, please try again soon"))
+			return
+		}
+	}
+
+	clog.Info("Unsubscribed")
+
+	c.Render.JSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
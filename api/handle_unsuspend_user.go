@@ -0,0 +1,54 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/models"
+	"gopkg.in/guregu/null.v3"
+)
+
+func HandleUnsuspendUser(c *Context, w http.ResponseWriter, req *http.Request) {
+	id := c.Params.ByName("id")
+
+	clog := c.Log().WithFields(log.Fields{
+		"auth_user_id": c.User.Id,
+		"user_id":      id,
+	})
+
+	user, err := c.Api.User.ById(id)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up user")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not unsuspend that user, please try again soon"))
+		return
+	}
+	if err == sql.ErrNoRows || user == nil {
+		c.Render.JSON(w, http.StatusNotFound,
+			ApiErr(ERR_USER_NOT_FOUND, "No user with that id could be found"))
+		return
+	}
+	if !user.Suspended() {
+		c.Render.JSON(w, http.StatusBadRequest,
+			ApiErr(ERR_INVALID_STATE, "That user isn't suspended"))
+		return
+	}
+
+	user.SuspendedTime = null.Time{}
+	user.SuspendedReason = ""
+	if err = c.Api.User.Save(user); err != nil {
+		clog.WithField("err", err).Error("Could not save user")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not unsuspend that user, please try again soon"))
+		return
+	}
+
+	clog.Info("User unsuspended")
+	audit(c, req, c.User.Id, user.Id, models.AUDIT_USER_UNSUSPEND, "user",
+		user.Id, nil)
+
+	c.Render.JSON(w, http.StatusOK, map[string]*AdminUser{
+		"user": NewAdminUser(user),
+	})
+}
@@ -0,0 +1,88 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/models"
+)
+
+// Anything left out of the form is left as it is.  ModelIds replaces all of
+// the collection's models, in the order given.
+type UpdateCollectionForm struct {
+	Title       *string   `json:"title"`
+	Description *string   `json:"description"`
+	Visibility  *string   `json:"visibility"`
+	ModelIds    *[]string `json:"model_ids"`
+}
+
+func HandleUpdateCollection(c *Context, w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+
+	clog := c.Log().WithFields(log.Fields{
+		"collection_id": c.Params.ByName("id"),
+		"auth_user_id":  c.User.Id,
+	})
+
+	// Parse the JSON PATCH body
+	var form UpdateCollectionForm
+	if !decodeForm(c, w, req, clog, "collection", &form) {
+		return
+	}
+
+	// Validation
+	v := NewValidator()
+	if form.Title != nil {
+		v.Field("title", "Title").Length(*form.Title, 3, maxCollectionTitleLength)
+	}
+	if form.Description != nil {
+		v.Field("description", "Description").MaxLength(*form.Description, maxCollectionDescriptionLength)
+	}
+	if form.Visibility != nil {
+		v.Field("visibility", "Visibility").OneOf(*form.Visibility, "public", "private")
+	}
+	if v.Refuse(c, w) {
+		return
+	}
+
+	collection := ownCollection(c, w, clog)
+	if collection == nil {
+		return
+	}
+
+	if form.ModelIds != nil {
+		if !checkCollectionModels(c, w, clog, *form.ModelIds) {
+			return
+		}
+		if err := c.Api.Collection.SetModels(collection.Id, *form.ModelIds); err != nil {
+			clog.WithField("err", err).Error("Could not save collection models")
+			c.Render.JSON(w, http.StatusBadGateway,
+				ApiErr(ERR_UNAVAILABLE, "Could not update your collection, please try again soon"))
+			return
+		}
+	}
+
+	if form.Title != nil {
+		collection.Title = *form.Title
+	}
+	if form.Description != nil {
+		collection.Description = *form.Description
+	}
+	if form.Visibility != nil {
+		collection.Visibility = *form.Visibility
+	}
+	// Only public collections can be featured
+	if collection.Visibility == "private" {
+		collection.Featured = false
+	}
+	collection.UpdatedTime = time.Now().UTC()
+	if err := c.Api.Collection.Save(collection); err != nil {
+		clog.WithField("err", err).Error("Could not save collection")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not update your collection, please try again soon"))
+		return
+	}
+
+	c.Render.JSON(w, http.StatusOK, map[string]*models.Collection{"collection": collection})
+}
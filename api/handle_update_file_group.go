@@ -0,0 +1,147 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/models"
+)
+
+type UpdateFileGroupForm struct {
+	Filenames []string `json:"filenames"`
+	Keep      int      `json:"keep"`
+}
+
+func HandleUpdateFileGroup(c *Context, w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+
+	username := c.Params.ByName("username")
+	slug := c.Params.ByName("slug")
+	name := c.Params.ByName("name")
+
+	clog := c.Log().WithFields(log.Fields{
+		"user_id":    c.User.Id,
+		"username":   username,
+		"model_slug": slug,
+		"group_name": name,
+	})
+
+	// Parse the JSON POST body
+	var form UpdateFileGroupForm
+	if !decodeForm(c, w, req, clog, "file group", &form) {
+		return
+	}
+
+	clog = clog.WithFields(log.Fields{
+		"filenames": form.Filenames,
+		"keep":      form.Keep,
+	})
+
+	// First let's look up the user by their username
+	user, err := c.Api.User.ByUsername(username)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up user by username")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not update that file group, please try again soon"))
+		return
+	}
+	if err == sql.ErrNoRows || user == nil {
+		c.Render.JSON(w, http.StatusNotFound,
+			ApiErr(ERR_USER_NOT_FOUND, "No user by that username could be found"))
+		return
+	}
+
+	clog = clog.WithField("model_user_id", user.Id)
+
+	// Now we get the model
+	m, err := c.Api.Model.ByUserIdSlug(user.Id, slug)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up model by username & slug")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not update that file group, please try again soon"))
+		return
+	}
+	if err == sql.ErrNoRows || m == nil {
+		c.Render.JSON(w, http.StatusNotFound,
+			ApiErr(ERR_MODEL_NOT_FOUND, "No model by that username and slug could be found"))
+		return
+	}
+	if !authorize(c, w, m, ACTION_WRITE,
+		"You're only allowed to change file groups for your own models") {
+		return
+	}
+
+	clog = clog.WithField("model_id", m.Id)
+
+	// Validation
+	v := NewValidator()
+	v.Field("keep", "Keep").Check(form.Keep >= 0,
+		"must not be negative (use zero for the model's default)")
+	filenames := v.Field("filenames", "A file group").Check(len(form.Filenames) > 0,
+		"must have at least one filename")
+	seen := map[string]bool{}
+	for _, fn := range form.Filenames {
+		filenames.Check(len(fn) > 0 && !strings.Contains(fn, "/"),
+			"must not have empty filenames or ones that contain a slash")
+		filenames.Check(!seen[fn], "lists "+fn+" more than once")
+		seen[fn] = true
+	}
+	if v.Refuse(c, w) {
+		return
+	}
+	if form.Keep > m.Keep {
+		c.Render.JSON(w, http.StatusBadRequest,
+			ApiErr(ERR_QUOTA_EXCEEDED, fmt.Sprintf("This model's plan only allows keeping %d "+
+				"versions of a file", m.Keep)))
+		return
+	}
+
+	// A filename can only belong to one group
+	for _, fn := range form.Filenames {
+		other, err := c.Api.FileGroup.ByModelIdFilename(m.Id, fn)
+		if err != nil && err != sql.ErrNoRows {
+			clog.WithField("err", err).Error("Could not look up file group by filename")
+			c.Render.JSON(w, http.StatusBadGateway,
+				ApiErr(ERR_UNAVAILABLE, "Could not update that file group, please try again soon"))
+			return
+		}
+		if other != nil && other.Name != name {
+			c.Render.JSON(w, http.StatusBadRequest,
+				ApiErr(ERR_INVALID_STATE, fmt.Sprintf("%s already belongs to the %s group", fn, other.Name)))
+			return
+		}
+	}
+
+	group, err := c.Api.FileGroup.ByModelIdName(m.Id, name)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up file group")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not update that file group, please try again soon"))
+		return
+	}
+	if group == nil {
+		group, err = models.NewFileGroup(m.Id, name, form.Filenames, form.Keep)
+	} else {
+		group.Keep = form.Keep
+		err = group.SetFilenames(form.Filenames)
+	}
+	if err != nil {
+		clog.WithField("err", err).Error("Could not create file group")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not update that file group, please try again soon"))
+		return
+	}
+
+	if err = c.Api.FileGroup.Save(group); err != nil {
+		clog.WithField("err", err).Error("Could not save file group")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not update that file group, please try again soon"))
+		return
+	}
+
+	c.Render.JSON(w, http.StatusOK,
+		map[string]*models.FileGroup{"file_group": group})
+}
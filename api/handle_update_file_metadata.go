@@ -0,0 +1,97 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/models"
+)
+
+const MaxMetadataPatchSize = 1024 * 1024 // 1MB max
+
+type UpdateFileMetadataForm struct {
+	Metadata map[string]interface{} `json:"metadata"`
+}
+
+func HandleUpdateFileMetadata(c *Context, w http.ResponseWriter, req *http.Request) {
+	req.Body = http.MaxBytesReader(w, req.Body, MaxMetadataPatchSize)
+	defer req.Body.Close()
+
+	id := c.Params.ByName("id")
+
+	clog := c.Log().WithFields(log.Fields{
+		"user_id": c.User.Id,
+		"file_id": id,
+	})
+
+	// Parse the JSON PATCH body
+	var form UpdateFileMetadataForm
+	if !decodeForm(c, w, req, clog, "metadata", &form) {
+		return
+	}
+	v := NewValidator()
+	v.Field("metadata", "Metadata to merge").Check(len(form.Metadata) > 0, "must not be empty")
+	if v.Refuse(c, w) {
+		return
+	}
+
+	// Get the file by its id
+	f, err := c.Api.File.ById(id)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up file")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not update that file's metadata, please try again soon"))
+		return
+	}
+	if err == sql.ErrNoRows || f == nil {
+		c.Render.JSON(w, http.StatusNotFound,
+			ApiErr(ERR_FILE_NOT_FOUND, "There is no file with that id"))
+		return
+	}
+
+	clog = clog.WithField("file_model_id", f.ModelId)
+
+	// Only the model's owner may change its files
+	m, err := c.Api.Model.ById(f.ModelId)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up model by id")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not update that file's metadata, please try again soon"))
+		return
+	}
+	if err == sql.ErrNoRows || m == nil {
+		c.Render.JSON(w, http.StatusNotFound,
+			ApiErr(ERR_FILE_NOT_FOUND, "There is no file with that id"))
+		return
+	}
+	if !authorize(c, w, m, ACTION_WRITE,
+		"You're only allowed to update files in your own models") {
+		return
+	}
+
+	f, rev, err := c.Api.File.UpdateMetadata(f.Id, c.User.Id, form.Metadata)
+	if err != nil {
+		clog.WithField("err", err).Error("Could not update file metadata")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not update that file's metadata, please try again soon"))
+		return
+	}
+
+	clog.WithField("revision", rev.Revision).Info("File metadata updated")
+
+	// Metric values may have changed, so the best version may have too
+	if _, err = c.Api.FilePolicy.UpdateBest(f.ModelId, f.Filename); err != nil {
+		clog.WithField("err", err).Error("Could not update best file")
+	}
+
+	// Hydrate the file object
+	if err = c.Api.File.Hydrate([]*models.File{f}); err != nil {
+		clog.WithField("err", err).Error("Could not hydrate")
+	}
+
+	c.Render.JSON(w, http.StatusOK, map[string]interface{}{
+		"file":     f,
+		"revision": rev,
+	})
+}
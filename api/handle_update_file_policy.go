@@ -0,0 +1,146 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/models"
+)
+
+type UpdateFilePolicyForm struct {
+	Keep             int    `json:"keep"`
+	MetricKey        string `json:"metric_key"`
+	MetricDirection  string `json:"metric_direction"`
+	SizeAlertPercent int    `json:"size_alert_percent"`
+	SizeAlertWebhook string `json:"size_alert_webhook"`
+	SizeAlertEmail   bool   `json:"size_alert_email"`
+}
+
+func HandleUpdateFilePolicy(c *Context, w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+
+	username := c.Params.ByName("username")
+	slug := c.Params.ByName("slug")
+	filename := c.Params.ByName("filename")
+
+	clog := c.Log().WithFields(log.Fields{
+		"user_id":    c.User.Id,
+		"username":   username,
+		"model_slug": slug,
+		"filename":   filename,
+	})
+
+	// Parse the JSON POST body
+	var form UpdateFilePolicyForm
+	if !decodeForm(c, w, req, clog, "file policy", &form) {
+		return
+	}
+
+	clog = clog.WithFields(log.Fields{
+		"keep":             form.Keep,
+		"metric_key":       form.MetricKey,
+		"metric_direction": form.MetricDirection,
+		"size_alert":       form.SizeAlertPercent,
+	})
+
+	// First let's look up the user by their username
+	user, err := c.Api.User.ByUsername(username)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up user by username")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not update that file policy, please try again soon"))
+		return
+	}
+	if err == sql.ErrNoRows || user == nil {
+		c.Render.JSON(w, http.StatusNotFound,
+			ApiErr(ERR_USER_NOT_FOUND, "No user by that username could be found"))
+		return
+	}
+
+	clog = clog.WithField("model_user_id", user.Id)
+
+	// Now we get the model
+	m, err := c.Api.Model.ByUserIdSlug(user.Id, slug)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up model by username & slug")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not update that file policy, please try again soon"))
+		return
+	}
+	if err == sql.ErrNoRows || m == nil {
+		c.Render.JSON(w, http.StatusNotFound,
+			ApiErr(ERR_MODEL_NOT_FOUND, "No model by that username and slug could be found"))
+		return
+	}
+	if !authorize(c, w, m, ACTION_WRITE,
+		"You're only allowed to change file policies for your own models") {
+		return
+	}
+
+	clog = clog.WithField("model_id", m.Id)
+
+	// Validation
+	if form.MetricKey == "" {
+		form.MetricDirection = ""
+	}
+	v := NewValidator()
+	v.Field("keep", "Keep").Check(form.Keep >= 0,
+		"must not be negative (use zero for the model's default)")
+	if form.MetricKey != "" {
+		v.Field("metric_direction", "Metric direction").Check(
+			models.ValidMetricDirection(form.MetricDirection),
+			"must be one of 'minimize', 'maximize'")
+	}
+	v.Field("size_alert_percent", "Size alert percentage").Check(form.SizeAlertPercent >= 0,
+		"must not be negative (use zero to turn it off)")
+	if form.SizeAlertWebhook != "" {
+		v.Field("size_alert_webhook", "Size alert webhook").WebUrl(form.SizeAlertWebhook)
+	}
+	if v.Refuse(c, w) {
+		return
+	}
+	if form.Keep > m.Keep {
+		c.Render.JSON(w, http.StatusBadRequest,
+			ApiErr(ERR_QUOTA_EXCEEDED, fmt.Sprintf("This model's plan only allows keeping %d "+
+				"versions of a file", m.Keep)))
+		return
+	}
+
+	policy, err := c.Api.FilePolicy.ByModelIdFilename(m.Id, filename)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up file policy")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not update that file policy, please try again soon"))
+		return
+	}
+	if policy == nil {
+		policy = models.NewFilePolicy(m.Id, filename, form.Keep)
+	} else {
+		policy.Keep = form.Keep
+	}
+	policy.MetricKey = form.MetricKey
+	policy.MetricDirection = form.MetricDirection
+	policy.SizeAlertPercent = form.SizeAlertPercent
+	policy.SizeAlertWebhook = form.SizeAlertWebhook
+	policy.SizeAlertEmail = form.SizeAlertEmail
+
+	if err = c.Api.FilePolicy.Save(policy); err != nil {
+		clog.WithField("err", err).Error("Could not save file policy")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not update that file policy, please try again soon"))
+		return
+	}
+
+	// The metric may have changed, so pick the best version again
+	if policy, err = c.Api.FilePolicy.UpdateBest(m.Id, filename); err != nil {
+		clog.WithField("err", err).Error("Could not update best file")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not update that file policy, please try again soon"))
+		return
+	}
+
+	c.Render.JSON(w, http.StatusOK,
+		map[string]*models.FilePolicy{"file_policy": policy})
+}
@@ -0,0 +1,74 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/models"
+)
+
+type UpdateModelLicenseForm struct {
+	License string `json:"license"`
+}
+
+func HandleUpdateModelLicense(c *Context, w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+
+	modelId := c.Params.ByName("id")
+
+	clog := c.Log().WithFields(log.Fields{
+		"user_id":  c.User.Id,
+		"model_id": modelId,
+	})
+
+	// Parse the JSON POST body
+	var form UpdateModelLicenseForm
+	if !decodeForm(c, w, req, clog, "license", &form) {
+		return
+	}
+
+	// Validation, an empty license clearing it
+	form.License = normalizeLicense(form.License)
+	v := NewValidator()
+	v.Field("license", "License").MaxLength(form.License, maxLicenseLength)
+	if v.Refuse(c, w) {
+		return
+	}
+
+	m, err := c.Api.Model.ById(modelId)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up model by id")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not update model license, please try again soon"))
+		return
+	}
+	if m == nil || err == sql.ErrNoRows {
+		c.Render.JSON(w, http.StatusNotFound,
+			ApiErr(ERR_MODEL_NOT_FOUND, "No model with that id was found"))
+		return
+	}
+	if !authorize(c, w, m, ACTION_WRITE,
+		"You're only allowed to update the license for your own models") {
+		return
+	}
+
+	m.License = form.License
+	if err = c.Api.Model.Save(m); err != nil {
+		clog.WithField("err", err).Error("Could not save model")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not update your model, please try again soon"))
+		return
+	}
+
+	// Hydrate the model object
+	if err = c.Api.Model.Hydrate([]*models.Model{m}); err != nil {
+		clog.WithField("err", err).Error("Could not hydrate")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not get that model, please try again soon"))
+		return
+	}
+
+	// Return the updated model
+	c.Render.JSON(w, http.StatusOK, map[string]*models.Model{"model": m})
+}
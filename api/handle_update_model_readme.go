@@ -2,8 +2,8 @@ package api
 
 import (
 	"database/sql"
-	"encoding/json"
 	"net/http"
+	"strings"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/ericflo/gradientzoo/models"
@@ -11,6 +11,11 @@ import (
 
 type UpdateModelReadmeForm struct {
 	Readme string `json:"readme"`
+	// The language the readme is in.  Leaving it out means the language the
+	// model's readme is already in; any other makes this a translation, unless
+	// Primary is set, when it replaces the model's readme and language.
+	Language string `json:"language"`
+	Primary  bool   `json:"primary"`
 }
 
 func HandleUpdateModelReadme(c *Context, w http.ResponseWriter, req *http.Request) {
@@ -18,25 +23,26 @@ func HandleUpdateModelReadme(c *Context, w http.ResponseWriter, req *http.Reques
 
 	modelId := c.Params.ByName("id")
 
-	clog := log.WithFields(log.Fields{
+	clog := c.Log().WithFields(log.Fields{
 		"user_id":  c.User.Id,
 		"model_id": modelId,
 	})
 
 	// Parse the JSON POST body
-	decoder := json.NewDecoder(req.Body)
 	var form UpdateModelReadmeForm
-	if err := decoder.Decode(&form); err != nil {
-		msg := "Could not decode readme form"
-		clog.WithField("err", err).Error(msg)
-		c.Render.JSON(w, http.StatusBadRequest, JsonErr(msg))
+	if !decodeForm(c, w, req, clog, "readme", &form) {
 		return
 	}
 
 	// Validation
-	if len(form.Readme) == 0 {
-		c.Render.JSON(w, http.StatusBadRequest,
-			JsonErr("Readme must not be empty"))
+	form.Language = strings.ToLower(strings.TrimSpace(form.Language))
+	v := NewValidator()
+	v.Field("readme", "Readme").Check(len(form.Readme) > 0, "must not be empty")
+	if form.Language != "" {
+		v.Field("language", "Language").Check(models.ValidLanguage(form.Language),
+			"must be a language code, like en or pt-br")
+	}
+	if v.Refuse(c, w) {
 		return
 	}
 
@@ -44,25 +50,41 @@ func HandleUpdateModelReadme(c *Context, w http.ResponseWriter, req *http.Reques
 	if err != nil && err != sql.ErrNoRows {
 		clog.WithField("err", err).Error("Could not look up model by id")
 		c.Render.JSON(w, http.StatusBadGateway,
-			JsonErr("Could not update model readme, please try again soon"))
+			ApiErr(ERR_UNAVAILABLE, "Could not update model readme, please try again soon"))
 		return
 	}
 	if m == nil || err == sql.ErrNoRows {
 		c.Render.JSON(w, http.StatusNotFound,
-			JsonErr("No model with that id was found"))
+			ApiErr(ERR_MODEL_NOT_FOUND, "No model with that id was found"))
 		return
 	}
-	if m.UserId != c.User.Id {
-		c.Render.JSON(w, http.StatusUnauthorized,
-			JsonErr("You're only allowed to update the readme for your own models"))
+	if !authorize(c, w, m, ACTION_WRITE,
+		"You're only allowed to update the readme for your own models") {
 		return
 	}
 
-	m.Readme = form.Readme
-	if err = c.Api.Model.Save(m); err != nil {
-		clog.WithField("err", err).Error("Could not save model")
+	if form.Language == "" || form.Language == m.ReadmeLanguage || form.Primary {
+		if form.Language != "" && form.Language != m.ReadmeLanguage {
+			// A translation into the new language would now be the readme twice
+			if err = c.Api.ModelReadme.Remove(m.Id, form.Language); err != nil {
+				clog.WithField("err", err).Error("Could not remove readme translation")
+				c.Render.JSON(w, http.StatusBadGateway,
+					ApiErr(ERR_UNAVAILABLE, "Could not update your model, please try again soon"))
+				return
+			}
+			m.ReadmeLanguage = form.Language
+		}
+		m.Readme = form.Readme
+		if err = c.Api.Model.Save(m); err != nil {
+			clog.WithField("err", err).Error("Could not save model")
+			c.Render.JSON(w, http.StatusBadGateway,
+				ApiErr(ERR_UNAVAILABLE, "Could not update your model, please try again soon"))
+			return
+		}
+	} else if err = c.Api.ModelReadme.Put(m.Id, form.Language, form.Readme); err != nil {
+		clog.WithField("err", err).Error("Could not save readme translation")
 		c.Render.JSON(w, http.StatusBadGateway,
-			JsonErr("Could not update your model, please try again soon"))
+			ApiErr(ERR_UNAVAILABLE, "Could not update your model, please try again soon"))
 		return
 	}
 
@@ -70,7 +92,7 @@ func HandleUpdateModelReadme(c *Context, w http.ResponseWriter, req *http.Reques
 	if err = c.Api.Model.Hydrate([]*models.Model{m}); err != nil {
 		clog.WithField("err", err).Error("Could not hydrate")
 		c.Render.JSON(w, http.StatusBadGateway,
-			JsonErr("Could not get that model, please try again soon"))
+			ApiErr(ERR_UNAVAILABLE, "Could not get that model, please try again soon"))
 		return
 	}
 
@@ -0,0 +1,45 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/ericflo/gradientzoo/models"
+)
+
+type NotificationPreferencesForm struct {
+	Preferences map[string]string `json:"preferences"`
+}
+
+func HandleUpdateNotificationPreferences(c *Context, w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+
+	clog := c.Log().WithField("user_id", c.User.Id)
+
+	// Parse the JSON POST body
+	var form NotificationPreferencesForm
+	if !decodeForm(c, w, req, clog, "notification preferences", &form) {
+		return
+	}
+
+	// Check everything before changing anything
+	v := NewValidator()
+	for kind, delivery := range form.Preferences {
+		v.Field("preferences."+kind, "Delivery").
+			Check(models.ValidNotificationKind(kind), "is for an unknown notification kind: "+kind).
+			Check(models.ValidDelivery(delivery), "must be one of off, immediate, or digest")
+	}
+	if v.Refuse(c, w) {
+		return
+	}
+
+	for kind, delivery := range form.Preferences {
+		if err := c.Api.Notification.SetPreference(c.User.Id, kind, delivery); err != nil {
+			clog.WithField("err", err).Error("Could not save notification preference")
+			c.Render.JSON(w, http.StatusBadGateway,
+				ApiErr(ERR_UNAVAILABLE, "Could not save your notification settings, please try again soon"))
+			return
+		}
+	}
+
+	HandleNotificationPreferences(c, w, req)
+}
@@ -0,0 +1,74 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/ericflo/gradientzoo/models"
+)
+
+const MaxDisplayNameLength = 100
+const MaxBioLength = 2000
+const MaxAffiliationLength = 200
+const MaxWebsiteLength = 500
+
+type UpdateProfileForm struct {
+	DisplayName *string `json:"display_name"`
+	Bio         *string `json:"bio"`
+	Affiliation *string `json:"affiliation"`
+	Website     *string `json:"website"`
+}
+
+func HandleUpdateProfile(c *Context, w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+
+	clog := c.Log().WithField("user_id", c.User.Id)
+
+	// Parse the JSON POST body
+	var form UpdateProfileForm
+	if !decodeForm(c, w, req, clog, "profile", &form) {
+		return
+	}
+
+	// Fields that weren't sent are left as they are
+	user := c.User
+	if form.DisplayName != nil {
+		user.DisplayName = strings.TrimSpace(*form.DisplayName)
+	}
+	if form.Bio != nil {
+		user.Bio = strings.TrimSpace(*form.Bio)
+	}
+	if form.Affiliation != nil {
+		user.Affiliation = strings.TrimSpace(*form.Affiliation)
+	}
+	if form.Website != nil {
+		user.Website = strings.TrimSpace(*form.Website)
+	}
+
+	v := NewValidator()
+	v.Field("display_name", "Display name").MaxLength(user.DisplayName, MaxDisplayNameLength)
+	v.Field("bio", "Bio").MaxLength(user.Bio, MaxBioLength)
+	v.Field("affiliation", "Affiliation").MaxLength(user.Affiliation, MaxAffiliationLength)
+	if user.Website != "" {
+		// Websites are shown as links, so only allow ones that are safe to
+		// link to
+		v.Field("website", "Website").WebUrl(user.Website).MaxLength(user.Website, MaxWebsiteLength)
+	}
+	if v.Refuse(c, w) {
+		return
+	}
+
+	if err := c.Api.User.Save(user); err != nil {
+		clog.WithField("err", err).Error("Could not save user")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not save your profile, please try again soon"))
+		return
+	}
+
+	// Hydrate the user object
+	if err := c.Api.User.Hydrate([]*models.User{user}); err != nil {
+		clog.WithField("err", err).Error("Could not hydrate")
+	}
+
+	c.Render.JSON(w, http.StatusOK, map[string]*models.User{"user": user})
+}
@@ -0,0 +1,67 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/models"
+)
+
+// Anything left out of the form is left as it is.  The search itself can't be
+// changed, since then it would be a different search.
+type UpdateSavedSearchForm struct {
+	Name   *string `json:"name"`
+	Notify *bool   `json:"notify"`
+}
+
+func HandleUpdateSavedSearch(c *Context, w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+
+	clog := c.Log().WithFields(log.Fields{
+		"saved_search_id": c.Params.ByName("id"),
+		"auth_user_id":    c.User.Id,
+	})
+
+	// Parse the JSON PATCH body
+	var form UpdateSavedSearchForm
+	if !decodeForm(c, w, req, clog, "saved search", &form) {
+		return
+	}
+
+	// Validation
+	v := NewValidator()
+	if form.Name != nil {
+		*form.Name = strings.TrimSpace(*form.Name)
+		v.Field("name", "Name").Length(*form.Name, 1, maxSavedSearchNameLength)
+	}
+	if v.Refuse(c, w) {
+		return
+	}
+
+	s := ownSavedSearch(c, w, clog)
+	if s == nil {
+		return
+	}
+
+	if form.Name != nil {
+		s.Name = *form.Name
+	}
+	if form.Notify != nil {
+		// Turning notifications back on starts from now, rather than
+		// catching up on everything published while they were off
+		if *form.Notify && !s.Notify {
+			s.CheckedTime = time.Now().UTC()
+		}
+		s.Notify = *form.Notify
+	}
+	if err := c.Api.SavedSearch.Save(s); err != nil {
+		clog.WithField("err", err).Error("Could not save saved search")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not update your saved search, please try again soon"))
+		return
+	}
+
+	c.Render.JSON(w, http.StatusOK, map[string]*models.SavedSearch{"saved_search": s})
+}
@@ -1,7 +1,6 @@
 package api
 
 import (
-	"encoding/json"
 	"fmt"
 	"net/http"
 
@@ -18,17 +17,13 @@ type PaymentForm struct {
 
 func HandleUpdateStripe(c *Context, w http.ResponseWriter, req *http.Request) {
 	// Parse the JSON POST body
-	decoder := json.NewDecoder(req.Body)
 	var form PaymentForm
-	if err := decoder.Decode(&form); err != nil {
-		msg := "Could not decode payment form"
-		log.WithField("err", err).Error(msg)
-		c.Render.JSON(w, http.StatusBadRequest, JsonErr(msg))
+	if !decodeForm(c, w, req, c.Log().WithField("path", req.URL.Path), "payment", &form) {
 		return
 	}
 	defer req.Body.Close()
 
-	clog := log.WithFields(log.Fields{
+	clog := c.Log().WithFields(log.Fields{
 		"user_id":      c.User.Id,
 		"stripe_token": form.StripeToken,
 	})
@@ -41,7 +36,7 @@ func HandleUpdateStripe(c *Context, w http.ResponseWriter, req *http.Request) {
 
 	// If the user already has a stripe customer id, something's wrong
 	if c.User.StripeCustomerId != "" {
-		c.Render.JSON(w, http.StatusBadRequest, JsonErr("Tried to send "+
+		c.Render.JSON(w, http.StatusBadRequest, ApiErr(ERR_INVALID_REQUEST, "Tried to send "+
 			"conflicting payment information"))
 		return
 	}
@@ -58,7 +53,7 @@ func HandleUpdateStripe(c *Context, w http.ResponseWriter, req *http.Request) {
 	customer, err := customer.New(customerParams)
 	if err != nil {
 		clog.WithField("err", err).Error("Could not create customer")
-		c.Render.JSON(w, http.StatusBadGateway, JsonErr("Could not "+
+		c.Render.JSON(w, http.StatusBadGateway, ApiErr(ERR_UNAVAILABLE, "Could not "+
 			"communicate with payment processor, please try again soon"))
 		return
 	}
@@ -68,7 +63,7 @@ func HandleUpdateStripe(c *Context, w http.ResponseWriter, req *http.Request) {
 	// Now update the user in the database
 	if err := c.Api.User.Save(c.User); err != nil {
 		clog.WithField("err", err).Error("Could not save user's stripe token")
-		c.Render.JSON(w, http.StatusBadGateway, JsonErr("Could not save token"))
+		c.Render.JSON(w, http.StatusBadGateway, ApiErr(ERR_UNAVAILABLE, "Could not save token"))
 		return
 	}
 
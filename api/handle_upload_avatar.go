@@ -0,0 +1,69 @@
+package api
+
+import (
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+func HandleUploadAvatar(c *Context, w http.ResponseWriter, req *http.Request) {
+	clog := c.Log().WithField("user_id", c.User.Id)
+
+	req.Body = http.MaxBytesReader(w, req.Body, MaxAvatarSize)
+
+	// Open the file from the request
+	file, _, err := req.FormFile("avatar")
+	if err != nil {
+		clog.WithField("err", err).Info("Could not get uploaded avatar")
+		c.Render.JSON(w, http.StatusBadRequest,
+			ApiErr(ERR_INVALID_REQUEST, "Could not get uploaded avatar, it must be at most 5MB"))
+		return
+	}
+	defer file.Close()
+
+	data, err := ioutil.ReadAll(file)
+	if err != nil {
+		clog.WithField("err", err).Info("Could not read uploaded avatar")
+		c.Render.JSON(w, http.StatusBadRequest,
+			ApiErr(ERR_INVALID_REQUEST, "Could not read uploaded avatar"))
+		return
+	}
+
+	resized, err := resizeAvatar(data)
+	if err != nil {
+		clog.WithField("err", err).Info("Could not resize avatar")
+		c.Render.JSON(w, http.StatusBadRequest,
+			ApiErr(ERR_INVALID_REQUEST, "Avatars must be PNG, JPEG, or GIF images of at most 4096x4096"))
+		return
+	}
+
+	user := c.User
+	oldFilename := user.AvatarFilename
+	user.AvatarFilename = user.AvatarBlobFilename(time.Now())
+	if err = c.Blob.Save(resized, user.AvatarFilename, "image/png"); err != nil {
+		clog.WithField("err", err).Error("Could not store the avatar")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not save your avatar, please try again soon"))
+		return
+	}
+	if err = c.Api.User.Save(user); err != nil {
+		clog.WithField("err", err).Error("Could not save user")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not save your avatar, please try again soon"))
+		return
+	}
+
+	// The old avatar is only cleaned up once nothing points at it any more
+	if oldFilename != "" {
+		if err = c.Blob.Delete(oldFilename); err != nil {
+			clog.WithField("err", err).Error("Could not delete old avatar")
+		}
+	}
+
+	avatarUrl, err := c.Blob.MakeUrl(user.AvatarFilename, avatarUrlExpiry)
+	if err != nil {
+		clog.WithField("err", err).Error("Could not make avatar url")
+	}
+
+	c.Render.JSON(w, http.StatusOK, map[string]string{"avatar_url": avatarUrl})
+}
@@ -0,0 +1,48 @@
+package api
+
+import (
+	"net/http"
+	"time"
+)
+
+// HandleUsage shows the signed in user how much they're storing and how much
+// bandwidth their files have taken this month, along with their organization's
+// totals against its quotas if they belong to one.
+func HandleUsage(c *Context, w http.ResponseWriter, req *http.Request) {
+	clog := c.Log().WithField("user_id", c.User.Id)
+
+	since := monthStart(time.Now())
+	usage, err := c.Api.Organization.UsageByUserId(c.User.Id, since)
+	if err != nil {
+		clog.WithField("err", err).Error("Could not look up usage")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not get your usage, please try again soon"))
+		return
+	}
+
+	org, err := userOrganization(c.Api, c.User.Id)
+	if err != nil {
+		clog.WithField("err", err).Error("Could not look up organization")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not get your usage, please try again soon"))
+		return
+	}
+	var orgUsage *OrganizationUsage
+	if org != nil {
+		if orgUsage, err = organizationUsage(c.Api, org); err != nil {
+			clog.WithField("err", err).Error("Could not look up organization usage")
+			c.Render.JSON(w, http.StatusBadGateway,
+				ApiErr(ERR_UNAVAILABLE, "Could not get your usage, please try again soon"))
+			return
+		}
+		// Other members' usage is for the owner to see
+		orgUsage.Members = nil
+	}
+
+	c.Render.JSON(w, http.StatusOK, map[string]interface{}{
+		"since":        since,
+		"until":        since.AddDate(0, 1, 0),
+		"usage":        usage,
+		"organization": orgUsage,
+	})
+}
@@ -15,19 +15,19 @@ func HandleUserByUsername(c *Context, w http.ResponseWriter, req *http.Request)
 	if c.User != nil {
 		fields["user_id"] = c.User.Id
 	}
-	clog := log.WithFields(fields)
+	clog := c.Log().WithFields(fields)
 
 	user, err := c.Api.User.ByUsername(username)
 	if err != nil && err != sql.ErrNoRows {
 		clog.WithField("err", err).Error("Could not look up user by username")
 		c.Render.JSON(w, http.StatusBadGateway,
-			JsonErr("Could not get that user, please try again soon"))
+			ApiErr(ERR_UNAVAILABLE, "Could not get that user, please try again soon"))
 		return
 	}
 
 	if err == sql.ErrNoRows || user == nil {
 		c.Render.JSON(w, http.StatusNotFound,
-			JsonErr("No user by that username could be found"))
+			ApiErr(ERR_USER_NOT_FOUND, "No user by that username could be found"))
 		return
 	}
 
@@ -35,7 +35,7 @@ func HandleUserByUsername(c *Context, w http.ResponseWriter, req *http.Request)
 	if err = c.Api.User.Hydrate([]*models.User{user}); err != nil {
 		clog.WithField("err", err).Error("Could not hydrate")
 		c.Render.JSON(w, http.StatusBadGateway,
-			JsonErr("Could get that user, please try again soon"))
+			ApiErr(ERR_UNAVAILABLE, "Could get that user, please try again soon"))
 		return
 	}
 
@@ -0,0 +1,56 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"sort"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// HandleUserModelsAtom is an Atom feed of a user's public models, newest
+// first.  Feed readers are anonymous, so private models never show up here,
+// even for whoever's signed in.
+func HandleUserModelsAtom(c *Context, w http.ResponseWriter, req *http.Request) {
+	username := c.Params.ByName("username")
+
+	clog := c.Log().WithFields(log.Fields{"feed": "user_models", "username": username})
+
+	user, err := c.Api.User.ByUsername(username)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up user by username")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not get that feed, please try again soon"))
+		return
+	}
+	if err == sql.ErrNoRows || user == nil {
+		c.Render.JSON(w, http.StatusNotFound,
+			ApiErr(ERR_USER_NOT_FOUND, "No user by that username could be found"))
+		return
+	}
+
+	clog = clog.WithField("user_id", user.Id)
+
+	ms, err := c.Api.Model.ByUserId(user.Id)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up models by username")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not get that feed, please try again soon"))
+		return
+	}
+	sort.Sort(modelsByNewest(ms))
+
+	entries := make([]*atomEntry, 0, atomFeedSize)
+	for _, m := range ms {
+		if m.Visibility != "public" {
+			continue
+		}
+		entries = append(entries, modelAtomEntry(m, user.Username))
+		if len(entries) == atomFeedSize {
+			break
+		}
+	}
+
+	title := "Models by " + user.Username + " on Gradientzoo"
+	renderAtom(w, newAtomFeed(title, userUrl(user.Username), entries), clog)
+}
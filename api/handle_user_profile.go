@@ -0,0 +1,89 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/models"
+)
+
+type UserProfile struct {
+	*models.User
+	AvatarUrl  string                `json:"avatar_url"`
+	ModelCount int                   `json:"model_count"`
+	Downloads  models.DownloadCounts `json:"downloads"`
+}
+
+func HandleUserProfile(c *Context, w http.ResponseWriter, req *http.Request) {
+	username := c.Params.ByName("username")
+
+	fields := log.Fields{"username": username}
+	if c.User != nil {
+		fields["auth_user_id"] = c.User.Id
+	}
+	clog := c.Log().WithFields(fields)
+
+	user, err := c.Api.User.ByUsername(username)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up user by username")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not get that profile, please try again soon"))
+		return
+	}
+
+	if err == sql.ErrNoRows || user == nil {
+		c.Render.JSON(w, http.StatusNotFound,
+			ApiErr(ERR_USER_NOT_FOUND, "No user by that username could be found"))
+		return
+	}
+
+	clog = clog.WithField("user_id", user.Id)
+
+	ms, err := c.Api.Model.ByUserId(user.Id)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up models by username")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not get that profile, please try again soon"))
+		return
+	}
+
+	// Only count the models the user is allowed to see, so private ones don't
+	// give themselves away
+	visible := visibleModels(c, ms)
+	modelIds := make([]string, 0, len(visible))
+	for _, m := range visible {
+		modelIds = append(modelIds, m.Id)
+	}
+
+	downloads, err := c.Api.DownloadHour.CountAcrossModels(modelIds)
+	if err != nil {
+		clog.WithField("err", err).Error("Could not count downloads")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not get that profile, please try again soon"))
+		return
+	}
+
+	// Hydrate the user object
+	if err = c.Api.User.Hydrate([]*models.User{user}); err != nil {
+		clog.WithField("err", err).Error("Could not hydrate")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not get that profile, please try again soon"))
+		return
+	}
+
+	profile := &UserProfile{
+		User:       user,
+		ModelCount: len(modelIds),
+		Downloads:  downloads,
+	}
+	if user.AvatarFilename != "" {
+		// A missing avatar isn't worth failing the whole profile over
+		profile.AvatarUrl, err = c.Blob.MakeUrl(user.AvatarFilename, avatarUrlExpiry)
+		if err != nil {
+			clog.WithField("err", err).Error("Could not make avatar url")
+		}
+	}
+
+	c.Render.JSON(w, http.StatusOK, map[string]*UserProfile{"profile": profile})
+}
@@ -0,0 +1,34 @@
+package api
+
+import (
+	"net/http"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/models"
+)
+
+// HandleV1Model gets a public model for the discovery API.
+func HandleV1Model(c *Context, w http.ResponseWriter, req *http.Request) {
+	username := c.Params.ByName("username")
+	slug := c.Params.ByName("slug")
+
+	clog := c.Log().WithFields(log.Fields{"api": "v1", "username": username, "slug": slug})
+
+	m := publicModel(c, w, clog, username, slug)
+	if m == nil {
+		return
+	}
+	clog = clog.WithField("model_id", m.Id)
+
+	if err := c.Api.Model.Hydrate([]*models.Model{m}); err != nil {
+		clog.WithField("err", err).Error("Could not hydrate")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not get that model, please try again soon"))
+		return
+	}
+
+	cacheFor(w, discoveryModelMaxAge)
+	c.Render.JSON(w, http.StatusOK, map[string]*DiscoveryModel{
+		"model": discoveryModel(req, m, username),
+	})
+}
@@ -0,0 +1,43 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// HandleV1ModelFiles lists the latest version of each of a public model's
+// files for the discovery API, with their checksums.
+func HandleV1ModelFiles(c *Context, w http.ResponseWriter, req *http.Request) {
+	username := c.Params.ByName("username")
+	slug := c.Params.ByName("slug")
+
+	clog := c.Log().WithFields(log.Fields{"api": "v1", "username": username, "slug": slug})
+
+	m := publicModel(c, w, clog, username, slug)
+	if m == nil {
+		return
+	}
+	clog = clog.WithField("model_id", m.Id)
+
+	files, err := c.Api.File.ByModelIdLatest(m.Id)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up files by model id")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not get those files, please try again soon"))
+		return
+	}
+	// Hydrating finds out which are quarantined
+	if err = c.Api.File.Hydrate(files); err != nil {
+		clog.WithField("err", err).Error("Could not hydrate file")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not get those files, please try again soon"))
+		return
+	}
+
+	cacheFor(w, discoveryModelMaxAge)
+	c.Render.JSON(w, http.StatusOK, map[string][]*DiscoveryFile{
+		"files": discoveryFiles(req, username, slug, files),
+	})
+}
@@ -0,0 +1,56 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/ericflo/gradientzoo/models"
+)
+
+// HandleV1Models lists public models for the discovery API, newest first
+// unless there's a sort, a page at a time.
+func HandleV1Models(c *Context, w http.ResponseWriter, req *http.Request) {
+	clog := c.Log().WithField("api", "v1")
+
+	// Validation
+	filter, ok := modelFilter(c, w, req)
+	if !ok {
+		return
+	}
+	sort := req.URL.Query().Get("sort")
+	if sort == "" {
+		sort = models.MODEL_SORT_CREATED
+	}
+	if !models.ValidModelSort(sort) {
+		c.Render.JSON(w, http.StatusBadRequest,
+			ApiErr(ERR_INVALID_REQUEST, "Sort must be one of 'created', 'updated', 'downloads', 'stars', 'name'"))
+		return
+	}
+	kind := "v1:" + sort
+	limit, after, err := pageParams(req, kind, 20, MaxPageSize)
+	if err != nil {
+		c.Render.JSON(w, http.StatusBadRequest, ApiErr(ERR_INVALID_REQUEST, err.Error()))
+		return
+	}
+
+	ms, next, err := c.Api.Model.ByVisibility("public", filter, sort, limit, after)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up public models")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not get those models, please try again soon"))
+		return
+	}
+	dms, err := discoveryModels(c, req, ms)
+	if err != nil {
+		clog.WithField("err", err).Error("Could not hydrate")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not get those models, please try again soon"))
+		return
+	}
+
+	cacheFor(w, discoveryListMaxAge)
+	c.Render.JSON(w, http.StatusOK, map[string]interface{}{
+		"models":      dms,
+		"next_cursor": nextCursor(kind, next),
+	})
+}
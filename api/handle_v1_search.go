@@ -0,0 +1,74 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/models"
+)
+
+// HandleV1Search searches public models for the discovery API, best match
+// first.
+func HandleV1Search(c *Context, w http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+	q := query.Get("q")
+
+	clog := c.Log().WithFields(log.Fields{"api": "v1", "q": q})
+
+	// Validation
+	filter, ok := modelFilter(c, w, req)
+	if !ok {
+		return
+	}
+	if q == "" && filter.Empty() {
+		c.Render.JSON(w, http.StatusBadRequest,
+			ApiErr(ERR_INVALID_REQUEST, "Q is required unless there's a filter"))
+		return
+	}
+	limit := 20
+	if limitStr := query.Get("limit"); limitStr != "" {
+		var err error
+		if limit, err = strconv.Atoi(limitStr); err != nil || limit <= 0 {
+			c.Render.JSON(w, http.StatusBadRequest,
+				ApiErr(ERR_INVALID_REQUEST, "Limit must be a positive number"))
+			return
+		}
+		if limit > MaxModelSearchPageSize {
+			limit = MaxModelSearchPageSize
+		}
+	}
+	offset := 0
+	if offsetStr := query.Get("offset"); offsetStr != "" {
+		var err error
+		if offset, err = strconv.Atoi(offsetStr); err != nil || offset < 0 {
+			c.Render.JSON(w, http.StatusBadRequest,
+				ApiErr(ERR_INVALID_REQUEST, "Offset must not be negative"))
+			return
+		}
+	}
+
+	// Nobody's signed in as far as the discovery API is concerned
+	results, err := searcher.Search(req.Context(), q, "", filter, limit, offset)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not search models")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not search models, please try again soon"))
+		return
+	}
+	ms := make([]*models.Model, 0, len(results.Matches))
+	for _, match := range results.Matches {
+		ms = append(ms, &match.Model)
+	}
+	dms, err := discoveryModels(c, req, ms)
+	if err != nil {
+		clog.WithField("err", err).Error("Could not hydrate")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not search models, please try again soon"))
+		return
+	}
+
+	cacheFor(w, discoveryListMaxAge)
+	c.Render.JSON(w, http.StatusOK, map[string]interface{}{"models": dms})
+}
@@ -0,0 +1,49 @@
+package api
+
+import (
+	"net/http"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+type SignedTokenForm struct {
+	Token string `json:"token"`
+}
+
+func HandleVerifyEmail(c *Context, w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+
+	// Parse the JSON POST body
+	var form SignedTokenForm
+	if !decodeForm(c, w, req, c.Log().WithField("path", req.URL.Path), "verification", &form) {
+		return
+	}
+
+	user, err := userFromSignedToken(c, form.Token, TOKEN_PURPOSE_VERIFY_EMAIL)
+	if err != nil {
+		c.Log().WithField("err", err).Error("Could not look up user for token")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not verify your e-mail address, please try again soon"))
+		return
+	}
+	if user == nil {
+		c.Render.JSON(w, http.StatusBadRequest,
+			ApiErr(ERR_EXPIRED, "That link is not valid or has expired"))
+		return
+	}
+
+	if !user.EmailVerified {
+		user.EmailVerified = true
+		if err = c.Api.User.Save(user); err != nil {
+			c.Log().WithFields(log.Fields{
+				"err":     err,
+				"user_id": user.Id,
+			}).Error("Could not save user")
+			c.Render.JSON(w, http.StatusBadGateway,
+				ApiErr(ERR_UNAVAILABLE, "Could not verify your e-mail address, please try again soon"))
+			return
+		}
+	}
+
+	c.Render.JSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
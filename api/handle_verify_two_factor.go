@@ -0,0 +1,86 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/ericflo/gradientzoo/models"
+)
+
+type TwoFactorForm struct {
+	Code string `json:"code"`
+}
+
+func HandleVerifyTwoFactor(c *Context, w http.ResponseWriter, req *http.Request) {
+	defer req.Body.Close()
+
+	if c.PendingAuthToken == nil {
+		c.Render.JSON(w, http.StatusUnauthorized,
+			ApiErr(ERR_SESSION_EXPIRED, "Your sign in has expired, please log in again"))
+		return
+	}
+
+	// Parse the JSON POST body
+	var form TwoFactorForm
+	if !decodeForm(c, w, req, c.Log().WithField("path", req.URL.Path), "two-factor", &form) {
+		return
+	}
+
+	clog := c.Log().WithField("user_id", c.PendingAuthToken.UserId)
+
+	user, err := c.Api.User.ById(c.PendingAuthToken.UserId)
+	if err != nil {
+		clog.WithField("err", err).Error("Could not look up user by id")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not log you in, please try again soon"))
+		return
+	}
+
+	ok, err := checkSecondFactor(c, user, form.Code)
+	if err != nil {
+		clog.WithField("err", err).Error("Could not check two-factor code")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not log you in, please try again soon"))
+		return
+	}
+	if !ok {
+		clog.Info("Incorrect two-factor code")
+		audit(c, req, user.Id, user.Id, models.AUDIT_TWO_FACTOR_FAILED, "", "", nil)
+		c.Render.JSON(w, http.StatusUnauthorized,
+			ApiErr(ERR_INVALID_CREDENTIALS, "That code is not correct"))
+		return
+	}
+
+	if err = c.Api.AuthToken.Delete(c.PendingAuthToken.Id); err != nil {
+		clog.WithField("err", err).Error("Could not delete pending auth token")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not log you in, please try again soon"))
+		return
+	}
+	authToken := models.NewAuthToken(user.Id)
+	if err = c.Api.AuthToken.Save(authToken); err != nil {
+		clog.WithField("err", err).Error("Could not save auth token")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not log you in, please try again soon"))
+		return
+	}
+	refreshToken := models.NewRefreshToken(user.Id)
+	if err = c.Api.RefreshToken.Save(refreshToken); err != nil {
+		clog.WithField("err", err).Error("Could not save refresh token")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not log you in, please try again soon"))
+		return
+	}
+
+	// Hydrate the user object
+	if err = c.Api.User.Hydrate([]*models.User{user}); err != nil {
+		clog.WithField("err", err).Error("Could not hydrate")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not log you in, please try again soon"))
+		return
+	}
+
+	audit(c, req, user.Id, user.Id, models.AUDIT_LOGIN, "auth_token",
+		authToken.Id, map[string]interface{}{"method": "two_factor"})
+
+	sessionRespond(c, w, req, user, authToken, refreshToken)
+}
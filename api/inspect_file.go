@@ -0,0 +1,145 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/blobstorage"
+	"github.com/ericflo/gradientzoo/inspect"
+	"github.com/ericflo/gradientzoo/models"
+)
+
+type inspectFilePayload struct {
+	FileId string `json:"file_id"`
+}
+
+// queueInspectFile records that a newly uploaded checkpoint is waiting to be
+// inspected, and queues the job that works out its structure, so that the
+// upload doesn't wait on parsing a large file.
+func queueInspectFile(api *models.ApiCollection, f *models.File) error {
+	if err := api.FileStructure.Save(models.NewFileStructure(f.Id)); err != nil {
+		return err
+	}
+	_, err := enqueueJob(api, JOB_INSPECT_FILE, f.UserId, &inspectFilePayload{FileId: f.Id})
+	return err
+}
+
+// runInspectFileJob works out the structure of the job's file and stores it.
+// The file is read from blob storage into a temporary file rather than into
+// memory, since checkpoints can be gigabytes, and only the parts that
+// describe its structure are read back.  Files that have been pruned since
+// they were uploaded are skipped.
+func runInspectFileJob(api *models.ApiCollection, blob blobstorage.BlobStorage, job *models.Job) error {
+	var payload inspectFilePayload
+	if err := job.Decode(&payload); err != nil {
+		return err
+	}
+	f, err := api.File.ById(payload.FileId)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	clog := log.WithFields(log.Fields{
+		"file_id":       f.Id,
+		"file_model_id": f.ModelId,
+		"filename":      f.Filename,
+	})
+
+	fs := models.NewFileStructure(f.Id)
+
+	tmp, size, err := spoolBlob(blob, f.BlobFilename(), 0)
+	if err != nil {
+		if job.LastAttempt() {
+			fs.Status = models.STRUCTURE_FAILED
+			fs.Error = "Could not read this file"
+			if saveErr := api.FileStructure.Save(fs); saveErr != nil {
+				clog.WithField("err", saveErr).Error("Could not save file structure")
+			}
+		}
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	inspectFile(clog, fs, tmp, size)
+
+	if err = api.FileStructure.Save(fs); err != nil {
+		return err
+	}
+
+	clog.WithFields(log.Fields{
+		"structure_status": fs.Status,
+		"total_params":     fs.TotalParams,
+	}).Info("File inspected")
+	return nil
+}
+
+// errBlobTooLarge is returned by spoolBlob for blobs over its limit.
+var errBlobTooLarge = errors.New("Blob is too large")
+
+// spoolBlob copies a blob into a temporary file, which the caller has to
+// close and remove.  Blobs of more than max bytes are refused, unless max is
+// 0.
+func spoolBlob(blob blobstorage.BlobStorage, filename string, max int64) (*os.File, int64, error) {
+	rc, err := blob.Open(filename)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rc.Close()
+
+	var r io.Reader = rc
+	if max > 0 {
+		r = io.LimitReader(rc, max+1)
+	}
+
+	tmp, err := ioutil.TempFile("", "gradientzoo-blob-")
+	if err != nil {
+		return nil, 0, err
+	}
+	size, err := io.Copy(tmp, r)
+	if err == nil && max > 0 && size > max {
+		err = errBlobTooLarge
+	}
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return nil, 0, err
+	}
+	return tmp, size, nil
+}
+
+// inspectFile fills in the structure of the checkpoint in r, or why it
+// doesn't have one.
+func inspectFile(clog *log.Entry, fs *models.FileStructure, r io.ReaderAt, size int64) {
+	// A malformed file should never be able to take down the server
+	defer func() {
+		if rec := recover(); rec != nil {
+			clog.WithField("err", rec).Error("Panic while inspecting file")
+			fs.Status = models.STRUCTURE_FAILED
+			fs.Error = "Could not parse this file"
+		}
+	}()
+
+	s, err := inspect.InspectReader(r, size)
+	switch {
+	case err == inspect.ErrUnsupported:
+		fs.Status = models.STRUCTURE_UNSUPPORTED
+	case err != nil:
+		clog.WithField("err", err).Info("Could not inspect file")
+		fs.Status = models.STRUCTURE_FAILED
+		fs.Error = err.Error()
+	default:
+		if err = fs.SetStructure(s); err != nil {
+			clog.WithField("err", err).Error("Could not encode file structure")
+			fs.Status = models.STRUCTURE_FAILED
+			fs.Error = "Could not parse this file"
+		}
+	}
+}
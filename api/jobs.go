@@ -0,0 +1,205 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/blobstorage"
+	"github.com/ericflo/gradientzoo/metrics"
+	"github.com/ericflo/gradientzoo/models"
+	"github.com/ericflo/gradientzoo/utils"
+	"gopkg.in/guregu/null.v3"
+)
+
+// Work that has to survive a restart, and be retried when it fails, is queued
+// as a job in Postgres rather than run in a goroutine.  Every server runs
+// workers that claim jobs from the queue, so whichever is free does the next
+// one.  A job that fails is tried again later, backing off each time, until
+// it's used up its attempts and is dead, which an admin can look into and
+// retry.
+
+const (
+	JOB_SECURITY_WEBHOOK = "security_webhook"
+	JOB_ANALYTICS_EXPORT = "analytics_export"
+	JOB_INSPECT_FILE     = "inspect_file"
+	JOB_COMPARE_FILES    = "compare_files"
+)
+
+// jobRunner does the job, returning an error if it should be tried again.
+type jobRunner func(api *models.ApiCollection, blob blobstorage.BlobStorage, job *models.Job) error
+
+// The kinds of jobs there are, how many attempts each gets, and how to run
+// them
+var jobKinds = map[string]struct {
+	maxAttempts int
+	run         jobRunner
+}{
+	JOB_SECURITY_WEBHOOK: {8, runSecurityWebhookJob},
+	JOB_ANALYTICS_EXPORT: {3, runAnalyticsExportJob},
+	JOB_INSPECT_FILE:     {3, runInspectFileJob},
+	JOB_COMPARE_FILES:    {3, runCompareFilesJob},
+}
+
+// How long a worker holds a job before it's taken to have died and the job is
+// handed to another
+const jobLease = 15 * time.Minute
+
+const jobPollInterval = 5 * time.Second
+
+// Retries wait this long after the first failure, twice as long after the
+// next, and so on up to the max
+const jobRetryBase = 30 * time.Second
+const jobRetryMax = 6 * time.Hour
+
+// Finished jobs are kept this long, so their status can still be looked up
+const jobRetention = 7 * 24 * time.Hour
+const jobCleanupInterval = time.Hour
+
+var (
+	jobDuration = metrics.NewHistogram("gradientzoo_job_duration_seconds",
+		"How long attempts at jobs take, by kind.", metrics.LatencyBuckets, "kind")
+	jobAttempts = metrics.NewCounter("gradientzoo_job_attempts_total",
+		"Attempts at jobs, by kind and whether they succeeded, will be retried, or died.",
+		"kind", "outcome")
+)
+
+// enqueueJob queues a job to be run as soon as a worker's free.  UserId is who
+// it's for, if anyone, who can look up how it's going.
+func enqueueJob(api *models.ApiCollection, kind, userId string, payload interface{}) (*models.Job, error) {
+	k, ok := jobKinds[kind]
+	if !ok {
+		return nil, fmt.Errorf("Unknown kind of job %q", kind)
+	}
+	job, err := models.NewJob(kind, userId, payload, k.maxAttempts)
+	if err != nil {
+		return nil, err
+	}
+	if err = api.Job.Save(job); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// jobBackoff is how long to wait before trying a job again after it's failed
+// that many attempts.
+func jobBackoff(attempts int) time.Duration {
+	wait := jobRetryBase
+	for i := 1; i < attempts && wait < jobRetryMax; i++ {
+		wait *= 2
+	}
+	if wait > jobRetryMax {
+		wait = jobRetryMax
+	}
+	return wait
+}
+
+// runJobs starts the workers, which run forever, or until the server starts
+// shutting down.  It also deletes old finished jobs now and then.
+func runJobs(api *models.ApiCollection, blob blobstorage.BlobStorage) {
+	for i := 0; i < utils.Conf.JobWorkers; i++ {
+		go func() {
+			for !ShuttingDown() {
+				// Keep going without a break while there's a backlog
+				if !runJobOnce(api, blob) {
+					time.Sleep(jobPollInterval)
+				}
+			}
+		}()
+	}
+	go func() {
+		for {
+			cleanupJobsOnce(api)
+			time.Sleep(jobCleanupInterval)
+		}
+	}()
+}
+
+// runJobOnce claims a job and runs it, and returns whether there was one.  A
+// shutdown waits for it to finish, and once it's waiting no more are claimed.
+func runJobOnce(api *models.ApiCollection, blob blobstorage.BlobStorage) bool {
+	if !startBackground() {
+		return false
+	}
+	defer background.Done()
+
+	job, err := api.Job.Claim(jobLease)
+	if err == sql.ErrNoRows {
+		return false
+	}
+	if err != nil {
+		log.WithField("err", err).Error("Could not claim job")
+		return false
+	}
+	clog := log.WithFields(log.Fields{
+		"job_id":  job.Id,
+		"kind":    job.Kind,
+		"attempt": job.Attempts,
+	})
+
+	start := time.Now()
+	err = runJob(api, blob, job)
+	jobDuration.Observe(time.Since(start).Seconds(), job.Kind)
+
+	now := time.Now().UTC()
+	outcome := "succeeded"
+	switch {
+	case err == nil:
+		job.Status = models.JOB_DONE
+		job.LastError = ""
+		job.FinishedTime = null.TimeFrom(now)
+	case job.LastAttempt():
+		outcome = "died"
+		job.Status = models.JOB_DEAD
+		job.LastError = err.Error()
+		job.FinishedTime = null.TimeFrom(now)
+		clog.WithField("err", err).Error("Job failed its last attempt")
+	default:
+		outcome = "retried"
+		job.Status = models.JOB_QUEUED
+		job.LastError = err.Error()
+		job.RunTime = now.Add(jobBackoff(job.Attempts))
+		clog.WithFields(log.Fields{
+			"err":      err,
+			"run_time": job.RunTime,
+		}).Warn("Job failed, will retry")
+	}
+	jobAttempts.Inc(job.Kind, outcome)
+
+	if err = api.Job.Finish(job); err != nil {
+		clog.WithField("err", err).Error("Could not record how job went")
+	}
+	return true
+}
+
+// runJob runs the job, turning a panic into an error so that it's retried
+// like any other failure.
+func runJob(api *models.ApiCollection, blob blobstorage.BlobStorage, job *models.Job) (err error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			err = fmt.Errorf("Panic while running job: %v", rec)
+		}
+	}()
+	k, ok := jobKinds[job.Kind]
+	if !ok {
+		return fmt.Errorf("Unknown kind of job %q", job.Kind)
+	}
+	return k.run(api, blob, job)
+}
+
+func cleanupJobsOnce(api *models.ApiCollection) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			log.WithField("err", rec).Error("Panic while deleting finished jobs")
+		}
+	}()
+	n, err := api.Job.DeleteFinished(time.Now().Add(-jobRetention))
+	if err != nil {
+		log.WithField("err", err).Error("Could not delete finished jobs")
+		return
+	}
+	if n > 0 {
+		log.WithField("jobs", n).Info("Deleted finished jobs")
+	}
+}
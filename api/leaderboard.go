@@ -0,0 +1,42 @@
+package api
+
+import (
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/models"
+)
+
+const leaderboardInterval = 10 * time.Minute
+
+// How many models each leaderboard keeps
+const leaderboardSize = 100
+
+var leaderboardVisibilities = []string{"public", "private"}
+
+// refreshLeaderboards runs forever, working out the most downloaded models
+// ahead of time so that serving them is a quick lookup.  It's meant to be run
+// in its own goroutine.
+func refreshLeaderboards(api *models.ApiCollection) {
+	for {
+		refreshLeaderboardsOnce(api)
+		time.Sleep(leaderboardInterval)
+	}
+}
+
+func refreshLeaderboardsOnce(api *models.ApiCollection) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			log.WithField("err", rec).Error("Panic while refreshing leaderboards")
+		}
+	}()
+
+	for _, visibility := range leaderboardVisibilities {
+		if err := api.ModelLeaderboard.Refresh(visibility, leaderboardSize); err != nil {
+			log.WithFields(log.Fields{
+				"err":        err,
+				"visibility": visibility,
+			}).Error("Could not refresh leaderboard")
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package api
+
+import (
+	"database/sql"
+
+	"github.com/ericflo/gradientzoo/models"
+)
+
+// Loader is a request's cache of what it's looked up by id.  Whatever it's
+// asked for that it doesn't have yet is loaded in one query, so that a listing
+// costs the same few queries however many items are on it, and nothing's
+// looked up twice however many places need it.  It's only used by the
+// goroutine serving the request.
+type Loader struct {
+	api *models.ApiCollection
+
+	// Hydrated users by id, or nil for ones that don't exist
+	users map[string]*models.User
+
+	// Whether the signed in user has a grant for each private model, by id
+	grants map[string]bool
+
+	// The organization each user is a member of by user id, or "" for ones
+	// that aren't in one
+	orgs map[string]string
+}
+
+func newLoader(api *models.ApiCollection) *Loader {
+	return &Loader{
+		api:    api,
+		users:  map[string]*models.User{},
+		grants: map[string]bool{},
+		orgs:   map[string]string{},
+	}
+}
+
+// Users loads the users, hydrated, once each and in the order of their ids.
+// Ones that don't exist are left out.
+func (l *Loader) Users(ids []string) ([]*models.User, error) {
+	var missing []interface{}
+	for _, id := range ids {
+		if _, ok := l.users[id]; !ok {
+			missing = append(missing, id)
+			l.users[id] = nil
+		}
+	}
+	if len(missing) > 0 {
+		users, err := l.api.User.ByIds(missing)
+		if err != nil && err != sql.ErrNoRows {
+			for _, id := range missing {
+				delete(l.users, id.(string))
+			}
+			return nil, err
+		}
+		if err = l.api.User.Hydrate(users); err != nil {
+			return nil, err
+		}
+		for _, u := range users {
+			l.users[u.Id] = u
+		}
+	}
+
+	users := make([]*models.User, 0, len(ids))
+	added := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		if u := l.users[id]; u != nil && !added[id] {
+			users = append(users, u)
+			added[id] = true
+		}
+	}
+	return users, nil
+}
+
+// Owners loads the users who own the models, along with any others whose ids
+// are given.
+func (l *Loader) Owners(ms []*models.Model, userIds ...string) ([]*models.User, error) {
+	ids := make([]string, 0, len(ms)+len(userIds))
+	for _, m := range ms {
+		ids = append(ids, m.UserId)
+	}
+	return l.Users(append(ids, userIds...))
+}
+
+// LoadGrants looks up which of the private models the user has grants for,
+// all at once, ahead of checking whether they can read each one.
+func (l *Loader) LoadGrants(userId string, ms []*models.Model) error {
+	var ids []string
+	for _, m := range ms {
+		if _, ok := l.grants[m.Id]; !ok && m.Visibility == "private" && m.UserId != userId {
+			ids = append(ids, m.Id)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	granted, err := l.api.AccessRequest.GrantedModelIds(userId, ids)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		l.grants[id] = granted[id]
+	}
+	return nil
+}
+
+// granted says whether the user has a grant for the model, looking it up if
+// LoadGrants didn't already.
+func (l *Loader) granted(userId string, m *models.Model) (bool, error) {
+	if granted, ok := l.grants[m.Id]; ok {
+		return granted, nil
+	}
+	granted, err := l.api.AccessRequest.HasGrant(m.Id, userId)
+	if err != nil {
+		return false, err
+	}
+	l.grants[m.Id] = granted
+	return granted, nil
+}
+
+// LoadOrganizations looks up which organizations the users are in, all at
+// once, ahead of checking whether they share one.
+func (l *Loader) LoadOrganizations(userIds []string) error {
+	var ids []string
+	for _, id := range userIds {
+		if _, ok := l.orgs[id]; !ok {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	orgIds, err := l.api.Organization.OrganizationIds(ids)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	for _, id := range ids {
+		l.orgs[id] = orgIds[id]
+	}
+	return nil
+}
+
+// sameOrganization says whether both users are members of one organization,
+// looking them up if LoadOrganizations didn't already.
+func (l *Loader) sameOrganization(userId, otherId string) (bool, error) {
+	if err := l.LoadOrganizations([]string{userId, otherId}); err != nil {
+		return false, err
+	}
+	return l.orgs[userId] != "" && l.orgs[userId] == l.orgs[otherId], nil
+}
@@ -0,0 +1,260 @@
+package api
+
+import (
+	"expvar"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/mailer"
+	"github.com/ericflo/gradientzoo/models"
+	"github.com/ericflo/gradientzoo/utils"
+)
+
+const TOKEN_PURPOSE_UNLOCK_ACCOUNT = "unlock_account"
+
+// Failed logins are forgotten after this long without another one
+const loginFailureWindow = time.Hour
+
+// After this many failed logins in a row, each attempt has to wait twice as
+// long as the last, up to maxLoginDelay
+const loginDelayAfter = 3
+const maxLoginDelay = time.Minute
+
+// Brute force alerts are sent at most this often
+const loginAlertInterval = 15 * time.Minute
+
+var loginStats = expvar.NewMap("login")
+
+var ipLockouts = newIpLockout()
+
+// loginDelay is how long after their last failed login the user has to wait
+// before trying again.
+func loginDelay(user *models.User) time.Duration {
+	if user.FailedLogins < loginDelayAfter || !user.LastFailedLogin.Valid {
+		return 0
+	}
+	delay := time.Second << uint(user.FailedLogins-loginDelayAfter)
+	if delay > maxLoginDelay || delay <= 0 {
+		delay = maxLoginDelay
+	}
+	wait := user.LastFailedLogin.Time.Add(delay).Sub(time.Now())
+	if wait < 0 || time.Since(user.LastFailedLogin.Time) > loginFailureWindow {
+		return 0
+	}
+	return wait
+}
+
+// ipLockout counts failed logins per IP address, in memory like the rate
+// limiter, and locks out addresses that fail too often across any accounts.
+type ipLockout struct {
+	mu        sync.Mutex
+	failures  map[string][]time.Time
+	locked    map[string]time.Time
+	lastSweep time.Time
+}
+
+func newIpLockout() *ipLockout {
+	return &ipLockout{
+		failures:  map[string][]time.Time{},
+		locked:    map[string]time.Time{},
+		lastSweep: time.Now(),
+	}
+}
+
+// LockedUntil returns when the lock on ip runs out, or the zero time.
+func (l *ipLockout) LockedUntil(ip string) time.Time {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	until, ok := l.locked[ip]
+	if ok && time.Now().After(until) {
+		delete(l.locked, ip)
+		return time.Time{}
+	}
+	return until
+}
+
+// Fail records a failed login from ip, and returns true if that locked it.
+func (l *ipLockout) Fail(ip string, lockAfter int, lockFor time.Duration) bool {
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// Forget addresses that haven't failed in a while, so the map doesn't grow
+	// without bound
+	if now.Sub(l.lastSweep) > loginFailureWindow {
+		for key, times := range l.failures {
+			if now.Sub(times[len(times)-1]) > loginFailureWindow {
+				delete(l.failures, key)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	recent := []time.Time{}
+	for _, t := range l.failures[ip] {
+		if now.Sub(t) < loginFailureWindow {
+			recent = append(recent, t)
+		}
+	}
+	recent = append(recent, now)
+	if lockAfter <= 0 || len(recent) < lockAfter {
+		l.failures[ip] = recent
+		return false
+	}
+	delete(l.failures, ip)
+	l.locked[ip] = now.Add(lockFor)
+	return true
+}
+
+// Locked lists the locked addresses along with when their locks run out.
+func (l *ipLockout) Locked() map[string]time.Time {
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	locked := map[string]time.Time{}
+	for ip, until := range l.locked {
+		if now.After(until) {
+			delete(l.locked, ip)
+		} else {
+			locked[ip] = until
+		}
+	}
+	return locked
+}
+
+func loginLockDuration() time.Duration {
+	return time.Duration(utils.Conf.LoginLockMinutes) * time.Minute
+}
+
+// The token depends on when the lock runs out, so the link only works for the
+// lock it was sent for
+func unlockAccountToken(user *models.User) string {
+	return utils.MakeSignedToken(TOKEN_PURPOSE_UNLOCK_ACCOUNT, user.Id,
+		user.LockedUntil.Time.UTC().Format(time.RFC3339), user.LockedUntil.Time)
+}
+
+// sendUnlockEmail is meant to be run in its own goroutine.
+func sendUnlockEmail(mail mailer.Mailer, user *models.User) {
+	clog := log.WithField("user_id", user.Id)
+	defer func() {
+		if r := recover(); r != nil {
+			clog.WithField("err", r).Error("Panic while sending unlock e-mail")
+		}
+	}()
+
+	link := fmt.Sprintf("%s/unlock?token=%s", utils.Conf.WwwUrl,
+		url.QueryEscape(unlockAccountToken(user)))
+	body := fmt.Sprintf(
+		"Hi %s,\n\nThere have been too many failed attempts to sign in to your "+
+			"Gradientzoo account, so we've locked it for %d minutes. If it was "+
+			"you, follow this link to unlock it now:\n\n%s\n\nIf it wasn't, "+
+			"someone may be guessing your password, and you might want to "+
+			"change it.\n",
+		user.Username, utils.Conf.LoginLockMinutes, link)
+	if err := mail.Send(user.Email, "Your account has been locked", body); err != nil {
+		clog.WithField("err", err).Error("Could not send unlock e-mail")
+	}
+}
+
+var lastLoginAlert struct {
+	sync.Mutex
+	sent map[string]time.Time
+}
+
+// alertBruteForce logs a lockout as a likely brute force attempt, and e-mails
+// Conf.AlertEmail about it, at most every loginAlertInterval for each kind of
+// lockout.  It's meant to be run in its own goroutine.
+func alertBruteForce(mail mailer.Mailer, kind, subject string) {
+	clog := log.WithFields(log.Fields{
+		"kind":    kind,
+		"subject": subject,
+	})
+	defer func() {
+		if r := recover(); r != nil {
+			clog.WithField("err", r).Error("Panic while sending brute force alert")
+		}
+	}()
+
+	clog.Warn("Possible brute force login attempt")
+	if utils.Conf.AlertEmail == "" {
+		return
+	}
+
+	lastLoginAlert.Lock()
+	if lastLoginAlert.sent == nil {
+		lastLoginAlert.sent = map[string]time.Time{}
+	}
+	if time.Since(lastLoginAlert.sent[kind]) < loginAlertInterval {
+		lastLoginAlert.Unlock()
+		return
+	}
+	lastLoginAlert.sent[kind] = time.Now()
+	lastLoginAlert.Unlock()
+
+	body := fmt.Sprintf(
+		"Too many failed logins locked out the %s %s.\n\nCurrent counts: %s\n\n"+
+			"Further alerts like this are held back for %s.\n",
+		kind, subject, loginStats.String(), loginAlertInterval)
+	err := mail.Send(utils.Conf.AlertEmail, "Possible brute force login attempt", body)
+	if err != nil {
+		clog.WithField("err", err).Error("Could not send brute force alert")
+	}
+}
+
+// loginFailed counts a failed login against the IP address it came from and,
+// if there is one, the account it was for, locking either if there have been
+// too many.
+func loginFailed(c *Context, req *http.Request, user *models.User) {
+	loginStats.Add("failures", 1)
+
+	ip := clientIp(req)
+	if ipLockouts.Fail(ip, utils.Conf.LoginLockIp, loginLockDuration()) {
+		loginStats.Add("ip_lockouts", 1)
+		goBackground(func() { alertBruteForce(c.Mailer, "ip", ip) })
+	}
+
+	if user == nil || utils.Conf.LoginLockAccount <= 0 {
+		return
+	}
+	clog := c.Log().WithField("user_id", user.Id)
+	wasLocked := user.Locked()
+	updated, err := c.Api.User.RecordFailedLogin(user.Id, loginFailureWindow,
+		utils.Conf.LoginLockAccount, loginLockDuration())
+	if err != nil {
+		clog.WithField("err", err).Error("Could not record failed login")
+		return
+	}
+	if updated.Locked() && !wasLocked {
+		loginStats.Add("account_lockouts", 1)
+		clog.Info("Locked account after failed logins")
+		audit(c, req, "", user.Id, models.AUDIT_ACCOUNT_LOCK, "user", user.Id,
+			map[string]interface{}{"failed_logins": updated.FailedLogins})
+		goBackground(func() { sendUnlockEmail(c.Mailer, updated) })
+		goBackground(func() { alertBruteForce(c.Mailer, "account", user.Username) })
+	}
+}
+
+// loginThrottled responds with when the client may try again, if the client's
+// IP address is locked or the user has to wait after their last failed login.
+func loginThrottled(c *Context, w http.ResponseWriter, req *http.Request, user *models.User) bool {
+	wait := time.Duration(0)
+	if until := ipLockouts.LockedUntil(clientIp(req)); !until.IsZero() {
+		wait = until.Sub(time.Now())
+	} else if user != nil {
+		wait = loginDelay(user)
+	}
+	if wait <= 0 {
+		return false
+	}
+	loginStats.Add("throttled", 1)
+	retry := int(math.Ceil(wait.Seconds()))
+	w.Header().Set("Retry-After", fmt.Sprintf("%d", retry))
+	c.Render.JSON(w, http.StatusTooManyRequests,
+		ApiErr(ERR_RATE_LIMITED, fmt.Sprintf("Too many failed logins, please try again in %d seconds", retry)))
+	return true
+}
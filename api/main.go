@@ -1,15 +1,24 @@
 package api
 
 import (
+	"database/sql"
 	"net/http"
+	"time"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/codegangsta/negroni"
 	"github.com/ericflo/gradientzoo/blobstorage"
+	"github.com/ericflo/gradientzoo/cache"
+	"github.com/ericflo/gradientzoo/errorreport"
+	"github.com/ericflo/gradientzoo/geoip"
+	"github.com/ericflo/gradientzoo/mailer"
 	"github.com/ericflo/gradientzoo/models"
+	"github.com/ericflo/gradientzoo/ratelimit"
+	"github.com/ericflo/gradientzoo/search"
+	"github.com/ericflo/gradientzoo/tracing"
 	"github.com/ericflo/gradientzoo/utils"
 	"github.com/julienschmidt/httprouter"
-	negronilogrus "github.com/meatballhat/negroni-logrus"
+	"github.com/pborman/uuid"
 	"github.com/phyber/negroni-gzip/gzip"
 	render "gopkg.in/unrolled/render.v1"
 )
@@ -19,18 +28,48 @@ type Handler func(c *Context, w http.ResponseWriter, req *http.Request)
 var rndr *render.Render = render.New()
 var api *models.ApiCollection
 var blob blobstorage.BlobStorage
+var mail mailer.Mailer
+var geo geoip.Locator
+var searcher search.Backend
 
 func handle(handler Handler) httprouter.Handle {
 	return func(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
-		var authToken *models.AuthToken
+		var authToken, pendingAuthToken *models.AuthToken
 		var user *models.User
-		if authTokenId := req.Header.Get("X-Auth-Token-Id"); authTokenId != "" {
+		authTokenId := req.Header.Get("X-Auth-Token-Id")
+		fromCookie := false
+		if authTokenId == "" {
+			if cookie, err := req.Cookie(SESSION_COOKIE); err == nil && cookie.Value != "" {
+				authTokenId = cookie.Value
+				fromCookie = true
+			}
+		}
+		// Browsers send cookies along with requests from any other site, so
+		// those have to prove they came from our own pages
+		if fromCookie && !csrfSafe(req) && !checkCsrf(req, authTokenId) {
+			rndr.JSON(w, http.StatusForbidden,
+				ApiErr(ERR_CSRF_FAILED, "Missing or invalid CSRF token, please reload the page"))
+			return
+		}
+		if authTokenId != "" {
 			var err error
 			if authToken, err = api.AuthToken.ById(authTokenId); err != nil {
 				log.WithFields(log.Fields{
 					"authTokenId": authTokenId,
 					"err":         err.Error(),
 				}).Error("Could not get auth token by id")
+			} else if authToken != nil && authToken.Expired() {
+				// Expired sessions have to be refreshed, so treat the request
+				// as anonymous
+				authToken = nil
+			} else if authToken != nil && fromCookie && authToken.Kind != models.TOKEN_KIND_SESSION {
+				// Only sessions are ever put in cookies
+				authToken = nil
+			} else if authToken != nil && authToken.Kind == models.TOKEN_KIND_PENDING {
+				// Half signed in, so anonymous everywhere except for the
+				// endpoint that finishes signing in
+				pendingAuthToken = authToken
+				authToken = nil
 			} else if authToken != nil {
 				if user, err = api.User.ById(authToken.UserId); err != nil {
 					log.WithFields(log.Fields{
@@ -38,6 +77,58 @@ func handle(handler Handler) httprouter.Handle {
 						"err":    err.Error(),
 					}).Info("Could not get user by id")
 				}
+				if err = api.AuthToken.MarkUsed(authToken, time.Now().UTC()); err != nil {
+					log.WithFields(log.Fields{
+						"authTokenId": authTokenId,
+						"err":         err.Error(),
+					}).Error("Could not mark auth token as used")
+				}
+			}
+		}
+		// Organizations can hold their members' tokens to rules of their own
+		if authToken != nil && user != nil {
+			status, apiErr, err := organizationRefuses(api, user, req)
+			if err != nil {
+				log.WithFields(log.Fields{
+					"userId": user.Id,
+					"err":    err.Error(),
+				}).Error("Could not check organization's rules")
+				rndr.JSON(w, http.StatusBadGateway,
+					ApiErr(ERR_UNAVAILABLE, "Could not check your token, please try again soon"))
+				return
+			}
+			if apiErr != nil {
+				rndr.JSON(w, status, apiErr)
+				return
+			}
+		}
+		// Tokens without the read scope can't see anything that anonymous users
+		// can't, e.g. upload-only tokens used by CI
+		if authToken != nil && !authToken.HasScope(models.SCOPE_READ) &&
+			(req.Method == "GET" || req.Method == "HEAD") {
+			authToken = nil
+			user = nil
+		}
+		// App keys only matter to anonymous requests
+		var appKey *models.AppKey
+		if appKeyId := req.Header.Get("X-App-Key"); appKeyId != "" && user == nil {
+			var err error
+			if uuid.Parse(appKeyId) != nil {
+				appKey, err = api.AppKey.ById(appKeyId)
+			}
+			if err != nil && err != sql.ErrNoRows {
+				log.WithFields(log.Fields{
+					"appKeyId": appKeyId,
+					"err":      err.Error(),
+				}).Error("Could not get app key by id")
+				rndr.JSON(w, http.StatusBadGateway,
+					ApiErr(ERR_UNAVAILABLE, "Could not check your app key, please try again soon"))
+				return
+			}
+			if appKey == nil || appKey.Revoked() {
+				rndr.JSON(w, http.StatusUnauthorized,
+					ApiErr(ERR_INVALID_CREDENTIALS, "That app key is not valid"))
+				return
 			}
 		}
 		c := &Context{
@@ -46,75 +137,324 @@ func handle(handler Handler) httprouter.Handle {
 			AuthToken: authToken,
 			User:      user,
 			Api:       api,
-			Blob:      blob,
+			Blob:      blobstorage.Traced(blob, tracing.FromContext(req.Context())),
+			Mailer:    mail,
+			GeoIp:     geo,
+
+			PendingAuthToken: pendingAuthToken,
+			AppKey:           appKey,
+			Load:             newLoader(api),
+		}
+		defer recoverPanic(w, req, c)
+		// No one user gets to tie up all of the server's connections
+		if max := utils.Live().MaxConcurrentRequests; user != nil && max > 0 {
+			if !concurrency.Acquire(user.Id, max) {
+				rndr.JSON(w, http.StatusTooManyRequests,
+					ApiErr(ERR_RATE_LIMITED, "Too many requests at once, please wait for some to finish"))
+				return
+			}
+			defer concurrency.Release(user.Id)
+		}
+		if r := requestFrom(req); r != nil {
+			c.RequestId = r.id
+			if user != nil {
+				r.userId = user.Id
+			}
+		}
+		if reads := routeReads(w, req, user); reads != api {
+			c.Api = reads
+			c.Load = newLoader(reads)
 		}
 		handler(c, w, req)
+		if appKey != nil {
+			goBackground(func() { markAppKeyRequest(api, appKey, c.RateLimited) })
+		}
 	}
 }
 
 func GET(r *httprouter.Router, path string, handler Handler) {
-	r.GET(path, handle(handler))
+	r.GET(path, instrument("GET", path, handle(handler)))
 }
 
 func POST(r *httprouter.Router, path string, handler Handler) {
-	r.POST(path, handle(handler))
+	r.POST(path, instrument("POST", path, handle(handler)))
 }
 
 func PUT(r *httprouter.Router, path string, handler Handler) {
-	r.PUT(path, handle(handler))
+	r.PUT(path, instrument("PUT", path, handle(handler)))
 }
 
 func DELETE(r *httprouter.Router, path string, handler Handler) {
-	r.DELETE(path, handle(handler))
+	r.DELETE(path, instrument("DELETE", path, handle(handler)))
 }
 
 func OPTIONS(r *httprouter.Router, path string, handler Handler) {
-	r.OPTIONS(path, handle(handler))
+	r.OPTIONS(path, instrument("OPTIONS", path, handle(handler)))
 }
 
 func PATCH(r *httprouter.Router, path string, handler Handler) {
-	r.PATCH(path, handle(handler))
-}
-
-func JsonErr(msg string) map[string]string {
-	return map[string]string{"error": msg}
+	r.PATCH(path, instrument("PATCH", path, handle(handler)))
 }
 
 func Authed(h Handler) Handler {
 	return Handler(func(c *Context, w http.ResponseWriter, req *http.Request) {
 		if c.AuthToken == nil {
 			c.Render.JSON(w, http.StatusUnauthorized,
-				JsonErr("Must be authenticated to access this resource"))
+				ApiErr(ERR_UNAUTHENTICATED, "Must be authenticated to access this resource"))
 		} else {
 			h(c, w, req)
 		}
 	})
 }
 
+// Scoped is like Authed, but also requires that the auth token was granted the
+// given scope.
+func Scoped(scope string, h Handler) Handler {
+	return Authed(Handler(func(c *Context, w http.ResponseWriter, req *http.Request) {
+		if !c.AuthToken.HasScope(scope) {
+			c.Render.JSON(w, http.StatusUnauthorized,
+				ApiErr(ERR_INSUFFICIENT_SCOPE, "This token does not have the '"+scope+"' scope"))
+		} else {
+			h(c, w, req)
+		}
+	}))
+}
+
+// AccountWide refuses tokens that are limited to some models, for endpoints
+// that manage the account or create new models.
+func AccountWide(h Handler) Handler {
+	return Handler(func(c *Context, w http.ResponseWriter, req *http.Request) {
+		if c.AuthToken != nil && !c.AuthToken.AccountWide() {
+			c.Render.JSON(w, http.StatusUnauthorized,
+				ApiErr(ERR_INSUFFICIENT_SCOPE, "This token is limited to some models, and can't be used here"))
+		} else {
+			h(c, w, req)
+		}
+	})
+}
+
+// Unsuspended refuses requests from suspended users, which keeps them from
+// uploading or changing their models.
+func Unsuspended(h Handler) Handler {
+	return Handler(func(c *Context, w http.ResponseWriter, req *http.Request) {
+		if c.User != nil && c.User.Suspended() {
+			c.Render.JSON(w, http.StatusForbidden,
+				ApiErr(ERR_ACCOUNT_SUSPENDED, "This account is suspended: "+c.User.SuspendedReason))
+		} else {
+			h(c, w, req)
+		}
+	})
+}
+
+func Admin(h Handler) Handler {
+	return Scoped(models.SCOPE_ADMIN, Handler(func(c *Context, w http.ResponseWriter, req *http.Request) {
+		if c.User == nil || !c.User.IsAdmin || !c.AuthToken.AccountWide() {
+			c.Render.JSON(w, http.StatusUnauthorized,
+				ApiErr(ERR_FORBIDDEN, "Must be an admin to access this resource"))
+		} else if utils.Conf.RequireAdminTwoFactor && !c.User.TotpEnabled {
+			c.Render.JSON(w, http.StatusUnauthorized,
+				ApiErr(ERR_TWO_FACTOR_REQUIRED, "Admins must enable two-factor authentication"))
+		} else {
+			h(c, w, req)
+		}
+	}))
+}
+
 func makeHandler() http.Handler {
 	router := httprouter.New()
 
 	GET(router, "/", HandleIndex)
+	GET(router, "/metrics", HandleMetrics)
+	GET(router, "/errors", HandleErrors)
 	GET(router, "/auth/user", HandleAuthUser)
-	POST(router, "/auth/login", HandleLogin)
-	POST(router, "/auth/register", HandleRegister)
+	POST(router, "/auth/login", Limited(loginLimit, HandleLogin))
+	POST(router, "/auth/register", Limited(loginLimit, HandleRegister))
 	POST(router, "/auth/logout", HandleLogout)
-	POST(router, "/auth/stripe", Authed(HandleUpdateStripe))
-	POST(router, "/model/create", Authed(HandleCreateModel))
+	POST(router, "/auth/refresh", Limited(loginLimit, HandleRefresh))
+	POST(router, "/auth/revoke-all", Scoped(models.SCOPE_ADMIN, AccountWide(HandleRevokeAll)))
+	POST(router, "/auth/verify-email", Limited(loginLimit, HandleVerifyEmail))
+	POST(router, "/auth/verify-email/resend", Scoped(models.SCOPE_ADMIN, AccountWide(HandleResendVerification)))
+	POST(router, "/auth/password-reset", Limited(loginLimit, HandleRequestPasswordReset))
+	GET(router, "/auth/password-reset/:token", HandlePasswordReset)
+	POST(router, "/auth/password-reset/:token", Limited(loginLimit, HandleCompletePasswordReset))
+	POST(router, "/auth/unlock", Limited(loginLimit, HandleUnlockAccount))
+	GET(router, "/auth/takeout", Scoped(models.SCOPE_ADMIN, AccountWide(HandleTakeout)))
+	POST(router, "/auth/delete-account", Scoped(models.SCOPE_ADMIN, AccountWide(HandleDeleteAccount)))
+	POST(router, "/auth/delete-account/cancel", Scoped(models.SCOPE_ADMIN, AccountWide(HandleCancelAccountDeletion)))
+	POST(router, "/auth/profile", Scoped(models.SCOPE_ADMIN, AccountWide(Unsuspended(HandleUpdateProfile))))
+	POST(router, "/auth/avatar", Scoped(models.SCOPE_ADMIN, AccountWide(Unsuspended(HandleUploadAvatar))))
+	DELETE(router, "/auth/avatar", Scoped(models.SCOPE_ADMIN, AccountWide(HandleDeleteAvatar)))
+	GET(router, "/auth/notifications/preferences", Scoped(models.SCOPE_ADMIN, AccountWide(HandleNotificationPreferences)))
+	POST(router, "/auth/notifications/preferences", Scoped(models.SCOPE_ADMIN, AccountWide(HandleUpdateNotificationPreferences)))
+	POST(router, "/notifications/unsubscribe", Limited(loginLimit, HandleUnsubscribe))
+	POST(router, "/auth/stripe", Scoped(models.SCOPE_ADMIN, AccountWide(HandleUpdateStripe)))
+	GET(router, "/auth/tokens", Scoped(models.SCOPE_ADMIN, AccountWide(HandleApiTokens)))
+	POST(router, "/auth/tokens", Scoped(models.SCOPE_ADMIN, AccountWide(HandleCreateApiToken)))
+	DELETE(router, "/auth/token/:id", Scoped(models.SCOPE_ADMIN, AccountWide(HandleDeleteApiToken)))
+	GET(router, "/auth/service-accounts", Scoped(models.SCOPE_ADMIN, AccountWide(HandleServiceAccounts)))
+	POST(router, "/auth/service-accounts", Scoped(models.SCOPE_ADMIN, AccountWide(Unsuspended(HandleCreateServiceAccount))))
+	DELETE(router, "/auth/service-account/:id", Scoped(models.SCOPE_ADMIN, AccountWide(HandleDeleteServiceAccount)))
+	GET(router, "/auth/service-account/:id/tokens", Scoped(models.SCOPE_ADMIN, AccountWide(HandleServiceAccountTokens)))
+	POST(router, "/auth/service-account/:id/tokens", Scoped(models.SCOPE_ADMIN, AccountWide(HandleCreateServiceAccountToken)))
+	DELETE(router, "/auth/service-account/:id/token/:token_id", Scoped(models.SCOPE_ADMIN, AccountWide(HandleDeleteServiceAccountToken)))
+	GET(router, "/auth/audit", Scoped(models.SCOPE_ADMIN, AccountWide(Shed(Limited(listLimit, HandleAuditLog)))))
+	GET(router, "/auth/security-webhook", Scoped(models.SCOPE_ADMIN, AccountWide(HandleSecurityWebhook)))
+	POST(router, "/auth/security-webhook", Scoped(models.SCOPE_ADMIN, AccountWide(HandleSaveSecurityWebhook)))
+	DELETE(router, "/auth/security-webhook", Scoped(models.SCOPE_ADMIN, AccountWide(HandleDeleteSecurityWebhook)))
+	POST(router, "/auth/security-webhook/test", Scoped(models.SCOPE_ADMIN, AccountWide(Limited(loginLimit, HandleTestSecurityWebhook))))
+	GET(router, "/auth/saved-searches", Scoped(models.SCOPE_ADMIN, AccountWide(HandleSavedSearches)))
+	POST(router, "/auth/saved-searches", Scoped(models.SCOPE_ADMIN, AccountWide(HandleCreateSavedSearch)))
+	PATCH(router, "/auth/saved-search/:id", Scoped(models.SCOPE_ADMIN, AccountWide(HandleUpdateSavedSearch)))
+	DELETE(router, "/auth/saved-search/:id", Scoped(models.SCOPE_ADMIN, AccountWide(HandleDeleteSavedSearch)))
+	GET(router, "/auth/access-requests", Scoped(models.SCOPE_READ, HandleMyAccessRequests))
+	GET(router, "/auth/oauth/:provider", HandleOAuthUrl)
+	POST(router, "/auth/oauth/:provider/callback", Limited(loginLimit, HandleOAuthCallback))
+	POST(router, "/auth/sso", Limited(loginLimit, HandleSsoUrl))
+	POST(router, "/auth/sso/callback", Limited(loginLimit, HandleSsoCallback))
+	POST(router, "/auth/device", Limited(loginLimit, HandleDeviceAuthorize))
+	POST(router, "/auth/device/token", Limited(listLimit, HandleDeviceToken))
+	GET(router, "/auth/device-code/:user_code", Scoped(models.SCOPE_ADMIN, AccountWide(Limited(loginLimit, HandleDeviceAuthorization))))
+	POST(router, "/auth/device-code/:user_code/approve", Scoped(models.SCOPE_ADMIN, AccountWide(Limited(loginLimit, HandleApproveDevice))))
+	GET(router, "/auth/identities", Scoped(models.SCOPE_ADMIN, AccountWide(HandleIdentities)))
+	DELETE(router, "/auth/identity/:id", Scoped(models.SCOPE_ADMIN, AccountWide(HandleDeleteIdentity)))
+	POST(router, "/auth/2fa/verify", Limited(loginLimit, HandleVerifyTwoFactor))
+	POST(router, "/auth/2fa/enroll", Scoped(models.SCOPE_ADMIN, AccountWide(HandleEnrollTwoFactor)))
+	POST(router, "/auth/2fa/confirm", Scoped(models.SCOPE_ADMIN, AccountWide(HandleConfirmTwoFactor)))
+	POST(router, "/auth/2fa/disable", Scoped(models.SCOPE_ADMIN, AccountWide(HandleDisableTwoFactor)))
+	POST(router, "/auth/2fa/backup-codes", Scoped(models.SCOPE_ADMIN, AccountWide(HandleRegenerateBackupCodes)))
+	POST(router, "/org", Scoped(models.SCOPE_ADMIN, AccountWide(Unsuspended(HandleCreateOrganization))))
+	GET(router, "/org", Scoped(models.SCOPE_ADMIN, AccountWide(HandleOrganization)))
+	GET(router, "/me/dashboard", Scoped(models.SCOPE_READ, AccountWide(HandleDashboard)))
+	GET(router, "/auth/usage", Scoped(models.SCOPE_READ, AccountWide(HandleUsage)))
+	GET(router, "/org/usage", Scoped(models.SCOPE_ADMIN, AccountWide(HandleOrganizationUsage)))
+	POST(router, "/org/plan", Scoped(models.SCOPE_ADMIN, AccountWide(HandleChangeOrganizationPlan)))
+	POST(router, "/org/two-factor", Scoped(models.SCOPE_ADMIN, AccountWide(HandleOrganizationTwoFactor)))
+	GET(router, "/org/ip-allowlist", Scoped(models.SCOPE_ADMIN, AccountWide(HandleIpAllowlist)))
+	POST(router, "/org/ip-allowlist", Scoped(models.SCOPE_ADMIN, AccountWide(HandleCreateIpAllowlistEntry)))
+	DELETE(router, "/org/ip-allowlist/:id", Scoped(models.SCOPE_ADMIN, AccountWide(HandleDeleteIpAllowlistEntry)))
+	POST(router, "/org/members", Scoped(models.SCOPE_ADMIN, AccountWide(HandleAddOrganizationMember)))
+	DELETE(router, "/org/member/:user_id", Scoped(models.SCOPE_ADMIN, AccountWide(HandleRemoveOrganizationMember)))
+	POST(router, "/model/create", Scoped(models.SCOPE_ADMIN, AccountWide(Unsuspended(HandleCreateModel))))
+	GET(router, "/app-key/usage", HandleAppKeyUsage)
 	GET(router, "/user/username/:username", HandleUserByUsername)
-	GET(router, "/models/username/:username", HandleModelsByUsername)
-	GET(router, "/models/public/latest", HandleLatestPublicModels)
-	GET(router, "/models/public/top/:period", HandleTopPublicModels)
+	GET(router, "/users/:username", HandleUserProfile)
+	GET(router, "/models/username/:username", Shed(Limited(listLimit, HandleModelsByUsername)))
+	GET(router, "/files/username/:username/search", Shed(Limited(listLimit, HandleSearchFileMetadata)))
+	GET(router, "/files/by-hash/:sha256", Shed(Limited(listLimit, HandleFilesByHash)))
+	GET(router, "/models/public/latest", Shed(Limited(listLimit, HandleLatestPublicModels)))
+	GET(router, "/models/public/top/:period", Shed(Limited(listLimit, HandleTopPublicModels)))
+	GET(router, "/models/trending", Shed(Limited(listLimit, HandleTrendingModels)))
+	GET(router, "/graphql", Shed(Limited(listLimit, HandleGraphql)))
+	POST(router, "/graphql", Shed(Limited(listLimit, HandleGraphql)))
+	GET(router, "/feed/models", Shed(Limited(listLimit, HandleModelFeed)))
+	GET(router, "/sitemap.xml", Shed(Limited(listLimit, HandleSitemap)))
+	GET(router, "/feed/models/atom", Shed(Limited(listLimit, HandleNewModelsAtom)))
+	GET(router, "/feed/username/:username/atom", Shed(Limited(listLimit, HandleUserModelsAtom)))
+	GET(router, "/feed/username/:username/slug/:slug/atom", Shed(Limited(listLimit, HandleModelReleasesAtom)))
+	GET(router, "/models/search", Shed(Limited(listLimit, HandleSearchModels)))
+	GET(router, "/search/users", Shed(Limited(listLimit, HandleSearchUsers)))
+	GET(router, "/search/users/autocomplete", Shed(Limited(listLimit, HandleAutocompleteUsers)))
+	GET(router, "/browse", Shed(Limited(listLimit, HandleBrowse)))
+	GET(router, "/browse/models/:initial", Shed(Limited(listLimit, HandleBrowseModels)))
+	GET(router, "/browse/namespaces", Shed(Limited(listLimit, HandleBrowseNamespaces)))
+	GET(router, "/v1/models", Shed(Limited(listLimit, HandleV1Models)))
+	GET(router, "/v1/search", Shed(Limited(listLimit, HandleV1Search)))
+	GET(router, "/v1/model/:username/:slug", Shed(Limited(listLimit, HandleV1Model)))
+	GET(router, "/v1/model/:username/:slug/files", Shed(Limited(listLimit, HandleV1ModelFiles)))
+	GET(router, "/collections", Shed(Limited(listLimit, HandlePublicCollections)))
+	POST(router, "/collections", Scoped(models.SCOPE_ADMIN, AccountWide(Unsuspended(HandleCreateCollection))))
+	GET(router, "/collections/username/:username", Shed(Limited(listLimit, HandleCollectionsByUsername)))
+	GET(router, "/collection/id/:id", Shed(Limited(listLimit, HandleCollection)))
+	PATCH(router, "/collection/id/:id", Scoped(models.SCOPE_ADMIN, AccountWide(Unsuspended(HandleUpdateCollection))))
+	DELETE(router, "/collection/id/:id", Scoped(models.SCOPE_ADMIN, AccountWide(HandleDeleteCollection)))
+	GET(router, "/stats", Shed(Limited(listLimit, HandleSiteStats)))
+	GET(router, "/stats/frameworks", Shed(Limited(listLimit, HandleFrameworkStats)))
 	GET(router, "/model/username/:username/slug/:slug", HandleModelByUsernameAndSlug)
-	POST(router, "/model/id/:id/readme", Authed(HandleUpdateModelReadme))
-	POST(router, "/model/id/:id/deleted", Authed(HandleDeleteModel))
-	POST(router, "/file/:username/:slug/:framework/:filename", Authed(HandleFileUpload))
-	GET(router, "/file/:username/:slug/:framework/:filename", HandleFile)
-	GET(router, "/file-id/:id", HandleFileById)
-	GET(router, "/file-versions/:username/:slug/:framework/:filename", HandleFileVersions)
-	GET(router, "/model/username/:username/slug/:slug/latest-files", HandleLatestFilesByUsernameAndSlug)
+	POST(router, "/model/id/:id/readme", Scoped(models.SCOPE_ADMIN, Unsuspended(HandleUpdateModelReadme)))
+	DELETE(router, "/model/id/:id/readme/:language", Scoped(models.SCOPE_ADMIN, Unsuspended(HandleDeleteModelReadme)))
+	POST(router, "/model/id/:id/license", Scoped(models.SCOPE_ADMIN, Unsuspended(HandleUpdateModelLicense)))
+	POST(router, "/model/id/:id/deleted", Scoped(models.SCOPE_ADMIN, Unsuspended(HandleDeleteModel)))
+	POST(router, "/file/:username/:slug/:framework/:filename", Scoped(models.SCOPE_UPLOAD, Unsuspended(Limited(uploadLimit, HandleFileUpload))))
+	GET(router, "/file/:username/:slug/:framework/:filename", Sampled(Limited(downloadLimit, HandleFile)))
+	GET(router, "/file/:username/:slug/:framework/:filename/best", Sampled(Limited(downloadLimit, HandleBestFile)))
+	PATCH(router, "/file/:username/:slug/:filename", Scoped(models.SCOPE_ADMIN, Unsuspended(HandleRenameFile)))
+	DELETE(router, "/file/:username/:slug/:filename", Scoped(models.SCOPE_ADMIN, Unsuspended(HandleDeleteFile)))
+	GET(router, "/file-id/:id", Sampled(Limited(downloadLimit, HandleFileById)))
+	PATCH(router, "/file-id/:id/metadata", Scoped(models.SCOPE_UPLOAD, Unsuspended(HandleUpdateFileMetadata)))
+	GET(router, "/file-id/:id/metadata-revisions", Shed(Limited(listLimit, HandleFileMetadataRevisions)))
+	GET(router, "/file-id/:id/shares", Scoped(models.SCOPE_ADMIN, HandleFileShares))
+	POST(router, "/file-id/:id/shares", Scoped(models.SCOPE_ADMIN, Unsuspended(HandleCreateFileShare)))
+	GET(router, "/share/:id", Sampled(Limited(downloadLimit, HandleFileShare)))
+	DELETE(router, "/share/:id", Scoped(models.SCOPE_ADMIN, HandleDeleteFileShare))
+	GET(router, "/file-id/:id/quarantines", Scoped(models.SCOPE_READ, HandleFileQuarantines))
+	POST(router, "/file-id/:id/quarantine/appeal", Scoped(models.SCOPE_ADMIN, HandleAppealFileQuarantine))
+	POST(router, "/admin/file-id/:id/quarantine", Admin(HandleQuarantineFile))
+	POST(router, "/admin/file-id/:id/quarantine/resolve", Admin(HandleResolveFileQuarantine))
+	GET(router, "/admin/quarantines", Admin(HandleAdminQuarantines))
+	GET(router, "/admin/file-id/:id/quarantines", Admin(HandleAdminFileQuarantines))
+	GET(router, "/admin/audit", Admin(HandleAdminAuditLog))
+	GET(router, "/admin/login-stats", Admin(HandleAdminLoginStats))
+	GET(router, "/admin/config", Admin(HandleAdminConfig))
+	POST(router, "/admin/config/reload", Admin(HandleReloadConfig))
+	GET(router, "/admin/feature-flags", Admin(HandleFeatureFlags))
+	POST(router, "/admin/feature-flags", Admin(HandleSaveFeatureFlag))
+	DELETE(router, "/admin/feature-flag/:name", Admin(HandleDeleteFeatureFlag))
+	GET(router, "/admin/diagnostics", Admin(HandleAdminDiagnostics))
+	GET(router, "/admin/debug/pprof", Admin(HandleAdminProfiles))
+	GET(router, "/admin/debug/pprof/:profile", Admin(HandleAdminProfile))
+	GET(router, "/admin/jobs", Admin(HandleAdminJobs))
+	POST(router, "/admin/job/:id/retry", Admin(HandleRetryJob))
+	GET(router, "/admin/abuse", Admin(HandleAdminAbuse))
+	POST(router, "/admin/abuse/:id/resolve", Admin(HandleResolveAbuseFlag))
+	GET(router, "/admin/users", Admin(HandleAdminUsers))
+	POST(router, "/admin/user/id/:id/suspend", Admin(HandleSuspendUser))
+	POST(router, "/admin/user/id/:id/unsuspend", Admin(HandleUnsuspendUser))
+	POST(router, "/admin/user/id/:id/impersonate", Admin(HandleImpersonateUser))
+	POST(router, "/admin/revoke-tokens", Admin(HandleAdminRevokeTokens))
+	POST(router, "/admin/model/id/:id/plan", Admin(HandleChangeModelPlan))
+	POST(router, "/admin/collection/id/:id/featured", Admin(HandleFeatureCollection))
+	GET(router, "/admin/app-keys", Admin(HandleAppKeys))
+	POST(router, "/admin/app-keys", Admin(HandleCreateAppKey))
+	POST(router, "/admin/app-key/:id/revoke", Admin(HandleRevokeAppKey))
+	GET(router, "/admin/app-key/:id/usage", Admin(HandleAdminAppKeyUsage))
+	GET(router, "/admin/sso", Admin(HandleSsoConnections))
+	POST(router, "/admin/sso", Admin(HandleSaveSsoConnection))
+	DELETE(router, "/admin/sso/:id", Admin(HandleDeleteSsoConnection))
+	GET(router, "/file-versions/:username/:slug/:framework/:filename", Shed(Limited(listLimit, HandleFileVersions)))
+	GET(router, "/file-versions/:username/:slug/:framework/:filename/:id/structure", Shed(Limited(listLimit, HandleFileStructure)))
+	GET(router, "/file-versions/:username/:slug/:framework/:filename/:id/diff/:old_id", Shed(Limited(listLimit, HandleFileDiff)))
+	GET(router, "/model/username/:username/slug/:slug/latest-files", Shed(Limited(listLimit, HandleLatestFilesByUsernameAndSlug)))
+	GET(router, "/model/username/:username/slug/:slug/file-policies", HandleFilePolicies)
+	GET(router, "/model/username/:username/slug/:slug/prune-preview", HandlePrunePreview)
+	GET(router, "/model/username/:username/slug/:slug/file-log", Shed(Limited(listLimit, HandleFileLog)))
+	GET(router, "/model/username/:username/slug/:slug/access-requests", Scoped(models.SCOPE_READ, Shed(Limited(listLimit, HandleAccessRequests))))
+	POST(router, "/model/username/:username/slug/:slug/access-requests", Scoped(models.SCOPE_ADMIN, Unsuspended(Limited(listLimit, HandleRequestAccess))))
+	POST(router, "/access-request/:id/decide", Scoped(models.SCOPE_ADMIN, Unsuspended(HandleDecideAccessRequest)))
+	DELETE(router, "/access-request/:id", Scoped(models.SCOPE_ADMIN, HandleDeleteAccessRequest))
+	GET(router, "/model/username/:username/slug/:slug/file-sizes/:filename", HandleFileSizes)
+	GET(router, "/model/username/:username/slug/:slug/file-history", Shed(Limited(listLimit, HandleExportFileHistory)))
+	GET(router, "/model/username/:username/slug/:slug/compatibility", HandleModelCompatibility)
+	GET(router, "/model/username/:username/slug/:slug/stats", Shed(Limited(listLimit, HandleModelStats)))
+	GET(router, "/model/username/:username/slug/:slug/stats/countries", Shed(Limited(listLimit, HandleModelCountryStats)))
+	GET(router, "/model/username/:username/slug/:slug/stats/clients", Shed(Limited(listLimit, HandleModelClientStats)))
+	GET(router, "/model/username/:username/slug/:slug/stats/versions", Shed(Limited(listLimit, HandleModelVersionStats)))
+	GET(router, "/model/username/:username/slug/:slug/stats/compare", Shed(Limited(listLimit, HandleModelCompareStats)))
+	GET(router, "/model/username/:username/slug/:slug/related", Shed(Limited(listLimit, HandleRelatedModels)))
+	POST(router, "/model/username/:username/slug/:slug/star", Scoped(models.SCOPE_ADMIN, Unsuspended(HandleStarModel)))
+	DELETE(router, "/model/username/:username/slug/:slug/star", Scoped(models.SCOPE_ADMIN, HandleStarModel))
+	GET(router, "/model/username/:username/slug/:slug/analytics-export", Scoped(models.SCOPE_READ, Shed(Limited(listLimit, HandleAnalyticsExport))))
+	GET(router, "/model/username/:username/slug/:slug/download-alert", Scoped(models.SCOPE_READ, HandleDownloadAlert))
+	POST(router, "/model/username/:username/slug/:slug/download-alert", Scoped(models.SCOPE_ADMIN, HandleSaveDownloadAlert))
+	DELETE(router, "/model/username/:username/slug/:slug/download-alert", Scoped(models.SCOPE_ADMIN, HandleDeleteDownloadAlert))
+	GET(router, "/analytics-export/:id", Scoped(models.SCOPE_READ, HandleAnalyticsExportStatus))
+	GET(router, "/job/:id", Scoped(models.SCOPE_READ, HandleJob))
+	POST(router, "/model/username/:username/slug/:slug/file-policy/:filename", Scoped(models.SCOPE_ADMIN, Unsuspended(HandleUpdateFilePolicy)))
+	DELETE(router, "/model/username/:username/slug/:slug/file-policy/:filename", Scoped(models.SCOPE_ADMIN, Unsuspended(HandleDeleteFilePolicy)))
+	GET(router, "/model/username/:username/slug/:slug/file-groups", Shed(Limited(listLimit, HandleFileGroups)))
+	POST(router, "/model/username/:username/slug/:slug/file-group/:name", Scoped(models.SCOPE_ADMIN, Unsuspended(HandleUpdateFileGroup)))
+	DELETE(router, "/model/username/:username/slug/:slug/file-group/:name", Scoped(models.SCOPE_ADMIN, Unsuspended(HandleDeleteFileGroup)))
 
-	n := negroni.New(negroni.NewLogger())
+	n := negroni.New(NewRequestLogger(), NewPanicRecovery())
 
 	// In production, redirect all traffic to https (except /, for LB health check)
 	if utils.Conf.Production {
@@ -129,32 +469,193 @@ func makeHandler() http.Handler {
 	}
 
 	n.Use(gzip.Gzip(gzip.BestCompression))
-	n.Use(negronilogrus.NewMiddleware())
 	n.UseHandler(router)
 
 	return n
 }
 
+// NewHandler makes the HTTP handlers around the given pieces, instead of the
+// ones Main makes from the config, and without any of the background work
+// Main starts.  It's how the apitest harness runs the API inside its tests.
+func NewHandler(a *models.ApiCollection, b blobstorage.BlobStorage, m mailer.Mailer) http.Handler {
+	api = a
+	blob = b
+	mail = m
+	geo = geoip.NewNoLocator()
+	searcher = search.NewPostgresBackend(a)
+	limiter = ratelimit.NewMemoryLimiter()
+	return makeHandler()
+}
+
 func Main() {
+	// Refuse to start with a config that doesn't make sense
+	if errs := utils.Conf.Validate(); len(errs) > 0 {
+		for _, err := range errs {
+			log.Error(err.Error())
+		}
+		log.Fatal("The configuration is not valid")
+	}
+
 	// Connect to the Postgres DB
 	db, err := models.NewDB()
 	if err != nil {
 		log.WithFields(log.Fields{"err": err}).Error("Could not connect to db")
 	}
 
+	// Bring the schema up to date before anything uses it
+	MigrateOnStart(db)
+
+	if utils.Conf.Production && utils.Conf.SecretKey == "development-secret-key" {
+		log.Error("SECRET_KEY is not set, password reset links can be forged")
+	}
+
 	// Create API Collection
 	api = models.NewApiCollection(db)
 
+	// Send reads that can be a little behind to the replica, if there is one
+	if utils.Conf.PostgresqlReplicaHost != "" {
+		replica, err := models.NewReplicaDB()
+		if err != nil {
+			log.WithField("err", err).Fatal("Could not connect to replica db")
+		}
+		api.SetReplica(replica)
+		go watchReplica(api)
+	}
+
+	// Cache hot lookups, unless told not to
+	cacheTTL := time.Duration(utils.Conf.CacheTTLSeconds) * time.Second
+	switch utils.Conf.CacheBackend {
+	case "none":
+	case "memory":
+		api.SetCache(cache.NewMemoryCache(), cacheTTL)
+	case "redis":
+		c, err := cache.NewRedisCache(utils.Conf.RedisUrl)
+		if err != nil {
+			log.WithField("err", err).Fatal("Could not connect to Redis")
+		}
+		api.SetCache(c, cacheTTL)
+	default:
+		log.WithField("backend", utils.Conf.CacheBackend).Fatal(
+			"CACHE_BACKEND must be one of 'none', 'memory', 'redis'")
+	}
+
 	// Initialize blob storage
-	blob = blobstorage.NewS3BlobStorage(
+	blob = blobstorage.NewInstrumentedBlobStorage(blobstorage.NewS3BlobStorage(
 		utils.Conf.AWSBucket,
 		utils.Conf.AWSRegion,
-	)
+	))
+
+	// Initialize e-mail, which just gets logged if there's no SMTP server
+	if utils.Conf.SMTPHost != "" {
+		mail = mailer.NewSMTPMailer(
+			utils.Conf.SMTPHost,
+			utils.Conf.SMTPPort,
+			utils.Conf.SMTPUser,
+			utils.Conf.SMTPPassword,
+			utils.Conf.MailFrom,
+		)
+	} else {
+		mail = mailer.NewLogMailer()
+	}
+
+	// Place downloads in countries, if there's a GeoIP database to do it with
+	geo = geoip.NewNoLocator()
+	if utils.Conf.GeoIpCsv != "" {
+		if geo, err = geoip.LoadCsvLocator(utils.Conf.GeoIpCsv); err != nil {
+			log.WithField("err", err).Fatal("Could not load GeoIP database")
+		}
+	}
+
+	// Search with Postgres unless there's a search index to use instead
+	switch utils.Conf.SearchBackend {
+	case "postgres":
+		searcher = search.NewPostgresBackend(api)
+	case "elasticsearch":
+		if searcher, err = search.NewElasticsearchBackend(utils.Conf.ElasticsearchUrl,
+			utils.Conf.ElasticsearchIndex, api); err != nil {
+			log.WithField("err", err).Fatal("Could not connect to Elasticsearch")
+		}
+	default:
+		log.WithField("backend", utils.Conf.SearchBackend).Fatal(
+			"SEARCH_BACKEND must be one of 'postgres', 'elasticsearch'")
+	}
+
+	// Count downloads in memory and write them out in batches, replaying any
+	// that didn't make it out before the last shutdown
+	if utils.Conf.DownloadFlushSeconds > 0 {
+		if utils.Conf.DownloadJournal != "" {
+			if err = downloads.Open(utils.Conf.DownloadJournal); err != nil {
+				log.WithField("err", err).Fatal("Could not open download journal")
+			}
+		}
+		go flushDownloads(api)
+	}
+
+	// Delete accounts once their grace period is up
+	go deleteScheduledAccounts(api, blob)
+
+	// Tell people about download milestones and send weekly digests
+	go sendNotifications(api, mail)
+
+	// Roll hourly downloads up into days and months
+	go rollupDownloads(api)
+
+	// Delete raw downloads once they've been kept long enough
+	go scrubDownloadEvents(api)
+
+	// Work out which models are trending
+	go computeTrending(api)
+
+	// Work out the most downloaded models
+	go refreshLeaderboards(api)
+
+	// Tell owners when their models' downloads spike
+	go checkDownloadAlerts(api, mail)
+
+	// Warn organizations as they use up their bandwidth
+	go checkBandwidth(api, mail)
+
+	// Keep the search index up to date with models as they change
+	go indexSearch(api, searcher)
+
+	// Work out which models are related to each other
+	go refreshRelated(api)
+
+	// Tell people about new models that match their saved searches
+	go checkSavedSearches(api, mail)
+
+	// Run queued jobs, like webhook deliveries and analytics exports
+	runJobs(api, blob)
+
+	// Keep an eye on the queues for /metrics
+	registerQueueMetrics(api, db)
+
+	// Turn away listings and stats when overloaded, to keep up with the rest
+	shedder = newShedder(db)
+	dbStats = db.DB.Stats
+
+	// Let rate limits and the like be tuned without a restart
+	go reloadOnHangup()
+
+	// Trace requests, if there's somewhere to send the traces
+	if utils.Conf.TraceEndpoint != "" {
+		tracing.Start(utils.Conf.TraceEndpoint, utils.Conf.TraceHeaders,
+			utils.Conf.TraceServiceName, float64(utils.Conf.TraceSamplePercent)/100)
+	}
+
+	// Report panics to Sentry, if there's a DSN, rather than only logging them
+	if utils.Conf.ErrorReportDsn != "" {
+		sentry, err := errorreport.NewSentryReporter(utils.Conf.ErrorReportDsn, utils.Conf.Flavor)
+		if err != nil {
+			log.WithFields(log.Fields{"err": err}).Fatal("Could not set up error reporting")
+		}
+		reporter = sentry
+	}
 
 	// Make the HTTP handlers
 	handler := makeHandler()
 
-	// Start the HTTP server
+	// Start the HTTP server, which shuts down gracefully when it's told to stop
 	log.WithFields(log.Fields{"port": utils.Conf.Port}).Info("Serving")
-	http.ListenAndServe(":"+utils.Conf.Port, handler)
+	serve(api, handler)
 }
@@ -0,0 +1,30 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/ericflo/gradientzoo/models"
+)
+
+// projectFileMetadata trims the metadata of each file down to the keys listed
+// in the request's metadata_keys parameter, which can be comma separated or
+// repeated.  Passing an empty metadata_keys leaves out metadata entirely, and
+// leaving the parameter off returns all of it.
+func projectFileMetadata(req *http.Request, files []*models.File) {
+	values, ok := req.URL.Query()["metadata_keys"]
+	if !ok {
+		return
+	}
+	keys := []string{}
+	for _, value := range values {
+		for _, key := range strings.Split(value, ",") {
+			if key = strings.TrimSpace(key); key != "" {
+				keys = append(keys, key)
+			}
+		}
+	}
+	for _, f := range files {
+		f.Metadata = models.ProjectMetadata(f.Metadata, keys)
+	}
+}
@@ -0,0 +1,139 @@
+package api
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"runtime"
+	"strconv"
+	"time"
+
+	"github.com/codegangsta/negroni"
+	"github.com/ericflo/gradientzoo/metrics"
+	"github.com/ericflo/gradientzoo/models"
+	"github.com/ericflo/gradientzoo/tracing"
+	"github.com/ericflo/gradientzoo/utils"
+	"github.com/julienschmidt/httprouter"
+	runner "gopkg.in/mgutz/dat.v1/sqlx-runner"
+)
+
+var (
+	httpDuration = metrics.NewHistogram("gradientzoo_http_request_duration_seconds",
+		"How long requests take to handle, by method and route.", metrics.LatencyBuckets,
+		"method", "route")
+	httpRequests = metrics.NewCounter("gradientzoo_http_requests_total",
+		"Requests handled, by method, route and status code.", "method", "route", "code")
+	httpInFlight = metrics.NewGauge("gradientzoo_http_requests_in_flight",
+		"Requests being handled right now.")
+	uploadBytes = metrics.NewCounter("gradientzoo_upload_bytes_total",
+		"Bytes of model files uploaded.")
+	downloadBytes = metrics.NewCounter("gradientzoo_download_bytes_total",
+		"Bytes of model files downloaded.")
+)
+
+// instrument times requests to the route, which is its pattern rather than
+// the path asked for, so that there's one series per endpoint.  It also
+// starts the request's trace span, which the request's context carries.
+func instrument(method, route string, h httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+		start := time.Now()
+		httpInFlight.Add(1)
+		defer httpInFlight.Add(-1)
+		shedder.Begin()
+		defer shedder.End()
+
+		span := tracing.StartRequest(req, method+" "+route)
+		span.SetAttribute("http.method", method)
+		span.SetAttribute("http.route", route)
+		if r := requestFrom(req); r != nil {
+			r.route = route
+			span.SetAttribute("request_id", r.id)
+		}
+		req = req.WithContext(tracing.NewContext(req.Context(), span))
+
+		h(w, req, ps)
+
+		// Negroni keeps track of the status, which is 200 if nothing was
+		// written
+		code := http.StatusOK
+		if rw, ok := w.(negroni.ResponseWriter); ok && rw.Status() != 0 {
+			code = rw.Status()
+		}
+		httpDuration.Observe(time.Since(start).Seconds(), method, route)
+		httpRequests.Inc(method, route, strconv.Itoa(code))
+
+		span.SetAttribute("http.status_code", strconv.Itoa(code))
+		if code >= 500 {
+			span.SetError(errors.New(http.StatusText(code)))
+		}
+		span.Finish()
+	}
+}
+
+// registerQueueMetrics adds the gauges that are looked up when they're
+// scraped: how much work is waiting, and how busy the database is.
+func registerQueueMetrics(api *models.ApiCollection, db *runner.DB) {
+	metrics.NewGaugeFunc("gradientzoo_search_index_queue_depth",
+		"Models waiting to be indexed for search.", func() (float64, error) {
+			n, err := api.SearchIndex.Depth()
+			return float64(n), err
+		})
+	metrics.NewGaugeFunc("gradientzoo_job_queue_depth",
+		"Jobs queued or running, of every kind.", func() (float64, error) {
+			return jobDepth(api, models.JOB_QUEUED, models.JOB_RUNNING)
+		})
+	metrics.NewGaugeFunc("gradientzoo_jobs_dead",
+		"Jobs that failed every attempt, waiting for an admin.", func() (float64, error) {
+			return jobDepth(api, models.JOB_DEAD)
+		})
+	metrics.NewGaugeFunc("gradientzoo_download_buffer_depth",
+		"Downloads counted in memory and waiting to be written out.", func() (float64, error) {
+			return float64(downloads.Depth()), nil
+		})
+	metrics.NewGaugeFunc("gradientzoo_db_open_connections",
+		"Connections open to the database.", func() (float64, error) {
+			return float64(db.DB.Stats().OpenConnections), nil
+		})
+	metrics.NewGaugeFunc("gradientzoo_goroutines",
+		"Goroutines that exist right now.", func() (float64, error) {
+			return float64(runtime.NumGoroutine()), nil
+		})
+}
+
+// jobDepth counts the jobs in any of the statuses.
+func jobDepth(api *models.ApiCollection, statuses ...string) (float64, error) {
+	depths, err := api.Job.Depths()
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, d := range depths {
+		for _, status := range statuses {
+			if d.Status == status {
+				n += d.Count
+			}
+		}
+	}
+	return float64(n), nil
+}
+
+// HandleMetrics serves metrics for Prometheus to scrape.  In production it
+// needs the metrics token, since they say more than the public should know.
+func HandleMetrics(c *Context, w http.ResponseWriter, req *http.Request) {
+	token := utils.Conf.MetricsToken
+	if token == "" && utils.Conf.Production {
+		c.Render.JSON(w, http.StatusNotFound, ApiErr(ERR_NOT_FOUND, "Not found"))
+		return
+	}
+	if token != "" {
+		given := []byte(req.Header.Get("Authorization"))
+		if subtle.ConstantTimeCompare(given, []byte("Bearer "+token)) != 1 {
+			c.Render.JSON(w, http.StatusUnauthorized,
+				ApiErr(ERR_UNAUTHENTICATED, "Must send the metrics token to access this resource"))
+			return
+		}
+	}
+	w.Header().Set("Content-Type", metrics.ContentType)
+	w.WriteHeader(http.StatusOK)
+	metrics.Default.Write(w)
+}
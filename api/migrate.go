@@ -0,0 +1,105 @@
+package api
+
+import (
+	"fmt"
+	"os"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/migrate"
+	"github.com/ericflo/gradientzoo/models"
+	"github.com/ericflo/gradientzoo/utils"
+	runner "gopkg.in/mgutz/dat.v1/sqlx-runner"
+)
+
+const migrateUsage = `Usage: gradientzoo migrate <command>
+
+Commands:
+    up        Apply every migration that hasn't been
+    down      Roll back the most recent migration
+    redo      Roll back the most recent migration and apply it again
+    status    List the migrations and whether they've been applied
+
+Migrations are read from MIGRATIONS_DIR (%s)
+`
+
+// Migrate runs the migrate subcommand, with the arguments after it.
+func Migrate(args []string) {
+	if len(args) != 1 {
+		fmt.Fprintf(os.Stderr, migrateUsage, utils.Conf.MigrationsDir)
+		os.Exit(2)
+	}
+
+	ms, err := migrate.Load(utils.Conf.MigrationsDir)
+	if err != nil {
+		log.WithField("err", err).Fatal("Could not load migrations")
+	}
+	db, err := models.NewDB()
+	if err != nil {
+		log.WithField("err", err).Fatal("Could not connect to db")
+	}
+
+	switch args[0] {
+	case "up":
+		migrateUp(db, ms)
+	case "down":
+		migrateDown(db, ms)
+	case "redo":
+		if m := migrateDown(db, ms); m != nil {
+			migrateUp(db, []*migrate.Migration{m})
+		}
+	case "status":
+		statuses, err := migrate.Statuses(db.DB.DB, ms)
+		if err != nil {
+			log.WithField("err", err).Fatal("Could not get the status of migrations")
+		}
+		for _, s := range statuses {
+			applied := "Pending"
+			if s.Applied {
+				applied = s.AppliedTime.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%-20s %s\n", applied, s.Migration.Filename)
+		}
+	default:
+		fmt.Fprintf(os.Stderr, migrateUsage, utils.Conf.MigrationsDir)
+		os.Exit(2)
+	}
+}
+
+// MigrateOnStart applies any pending migrations as the server starts up, if
+// it's configured to.
+func MigrateOnStart(db *runner.DB) {
+	if !utils.Conf.MigrateOnStart {
+		return
+	}
+	ms, err := migrate.Load(utils.Conf.MigrationsDir)
+	if err != nil {
+		log.WithField("err", err).Fatal("Could not load migrations")
+	}
+	migrateUp(db, ms)
+}
+
+func migrateUp(db *runner.DB, ms []*migrate.Migration) {
+	done, err := migrate.Up(db.DB.DB, ms)
+	for _, m := range done {
+		log.WithField("migration", m.Filename).Info("Applied migration")
+	}
+	if err != nil {
+		log.WithField("err", err).Fatal("Could not apply migration")
+	}
+	if len(done) == 0 {
+		log.Info("No migrations to apply")
+	}
+}
+
+func migrateDown(db *runner.DB, ms []*migrate.Migration) *migrate.Migration {
+	m, err := migrate.Down(db.DB.DB, ms)
+	if err != nil {
+		log.WithField("err", err).Fatal("Could not roll back migration")
+	}
+	if m == nil {
+		log.Info("No migrations to roll back")
+	} else {
+		log.WithField("migration", m.Filename).Info("Rolled back migration")
+	}
+	return m
+}
@@ -0,0 +1,78 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ericflo/gradientzoo/models"
+)
+
+const maxLicenseLength = 64
+
+// normalizeLicense makes licenses compare the same however they're written,
+// e.g. "MIT" and "mit".
+func normalizeLicense(license string) string {
+	return strings.ToLower(strings.TrimSpace(license))
+}
+
+// modelFilter reads the query params that narrow down model listings.  It
+// responds and returns false if any of them aren't valid.
+func modelFilter(c *Context, w http.ResponseWriter, req *http.Request) (*models.ModelFilter, bool) {
+	filter, err := parseModelFilter(req.URL.Query())
+	if err != nil {
+		c.Render.JSON(w, http.StatusBadRequest, ApiErr(ERR_INVALID_REQUEST, err.Error()))
+		return nil, false
+	}
+	return filter, true
+}
+
+// parseModelFilter reads the framework, framework_version, license, max_size,
+// min_downloads and updated_since params into a filter.
+func parseModelFilter(query url.Values) (*models.ModelFilter, error) {
+	filter := &models.ModelFilter{
+		Framework: query.Get("framework"),
+		License:   normalizeLicense(query.Get("license")),
+	}
+	if s := strings.TrimSpace(query.Get("framework_version")); s != "" {
+		if filter.Framework == "" {
+			return nil, errors.New("Framework version needs a framework to go with it")
+		}
+		// A bare version means exactly that version
+		if !strings.ContainsAny(s[:1], "<>=!") {
+			s = "==" + s
+		}
+		_, constraints, err := models.ParseFrameworkConstraint(filter.Framework + s)
+		if err != nil {
+			return nil, err
+		}
+		for _, constraint := range constraints {
+			if !constraint.Comparable() {
+				return nil, errors.New("Framework versions must start with a number, like 1.0")
+			}
+		}
+		filter.FrameworkVersions = constraints
+	}
+	if s := query.Get("max_size"); s != "" {
+		var err error
+		if filter.MaxSizeBytes, err = strconv.ParseInt(s, 10, 64); err != nil || filter.MaxSizeBytes <= 0 {
+			return nil, errors.New("Max size must be a positive number of bytes")
+		}
+	}
+	if s := query.Get("min_downloads"); s != "" {
+		var err error
+		if filter.MinDownloads, err = strconv.Atoi(s); err != nil || filter.MinDownloads < 0 {
+			return nil, errors.New("Min downloads must not be negative")
+		}
+	}
+	if s := query.Get("updated_since"); s != "" {
+		var err error
+		if filter.UpdatedSince, err = time.Parse(time.RFC3339, s); err != nil {
+			return nil, errors.New("Updated since must be an RFC 3339 time, like 2016-01-01T00:00:00Z")
+		}
+	}
+	return filter, nil
+}
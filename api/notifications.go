@@ -0,0 +1,234 @@
+package api
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/mailer"
+	"github.com/ericflo/gradientzoo/models"
+	"github.com/ericflo/gradientzoo/utils"
+	"gopkg.in/guregu/null.v3"
+)
+
+const TOKEN_PURPOSE_UNSUBSCRIBE = "unsubscribe"
+
+const notificationInterval = time.Hour
+const digestBatch = 50
+
+// Notifications wait this long for the weekly digest, counted from the oldest
+// one waiting
+const digestAfter = 7 * 24 * time.Hour
+
+// Unsubscribe links have to keep working for as long as people keep old mail
+const unsubscribeTTL = 365 * 24 * time.Hour
+
+// Owners hear about their organization's storage once it's this full
+const storageWarnPercent = 90
+
+// The unsubscribe token is for one kind of notification, and depends on the
+// address so that it stops working if the account changes hands
+func unsubscribeToken(user *models.User, kind string) string {
+	return utils.MakeSignedToken(TOKEN_PURPOSE_UNSUBSCRIBE+":"+kind, user.Id,
+		user.Email, time.Now().Add(unsubscribeTTL))
+}
+
+func unsubscribeLink(user *models.User, kind string) string {
+	return fmt.Sprintf("%s/unsubscribe?kind=%s&token=%s", utils.Conf.WwwUrl,
+		url.QueryEscape(kind), url.QueryEscape(unsubscribeToken(user, kind)))
+}
+
+// notify tells the user about something the way they asked to hear about that
+// kind of thing: right away, in the next digest, or not at all.
+func notify(api *models.ApiCollection, mail mailer.Mailer, user *models.User, kind, subject, body string) error {
+	// Service accounts have no real address to send to
+	if user.IsService() {
+		return nil
+	}
+	prefs, err := api.Notification.Preferences(user.Id)
+	if err != nil {
+		return err
+	}
+	n := models.NewNotification(user.Id, kind, subject, body)
+	switch prefs[kind] {
+	case models.DELIVERY_OFF:
+		return nil
+	case models.DELIVERY_DIGEST:
+		return api.Notification.Save(n)
+	}
+
+	text := fmt.Sprintf(
+		"Hi %s,\n\n%s\n\n--\nTo stop getting these e-mails, follow this "+
+			"link:\n%s\nor change your settings at %s/settings/notifications\n",
+		user.Username, body, unsubscribeLink(user, kind), utils.Conf.WwwUrl)
+	if err = mail.Send(user.Email, subject, text); err != nil {
+		return err
+	}
+	n.SentTime = null.TimeFrom(time.Now().UTC())
+	return api.Notification.Save(n)
+}
+
+// checkStorageQuota warns the owner of the user's organization once an upload
+// of sizeBytes takes its storage past storageWarnPercent of its quota.  It's
+// meant to be run in its own goroutine.
+func checkStorageQuota(api *models.ApiCollection, mail mailer.Mailer, user *models.User, sizeBytes int64) {
+	clog := log.WithField("user_id", user.Id)
+	defer func() {
+		if rec := recover(); rec != nil {
+			clog.WithField("err", rec).Error("Panic while checking storage quota")
+		}
+	}()
+
+	org, err := userOrganization(api, user.Id)
+	if err != nil || org == nil {
+		return
+	}
+	clog = clog.WithField("organization_id", org.Id)
+	usage, err := organizationUsage(api, org)
+	if err != nil {
+		clog.WithField("err", err).Error("Could not look up organization usage")
+		return
+	}
+	threshold := usage.StorageQuota * storageWarnPercent / 100
+	if usage.StorageBytes < threshold || usage.StorageBytes-sizeBytes >= threshold {
+		return
+	}
+	owner, err := api.User.ById(org.OwnerId)
+	if err != nil {
+		clog.WithField("err", err).Error("Could not look up organization owner")
+		return
+	}
+	body := fmt.Sprintf(
+		"%s has used %d%% of its storage (%d of %d bytes). Once it's full, "+
+			"uploads will be refused until its plan is upgraded or some files "+
+			"are deleted:\n\n%s/org\n",
+		org.Name, usage.StorageBytes*100/usage.StorageQuota, usage.StorageBytes,
+		usage.StorageQuota, utils.Conf.WwwUrl)
+	err = notify(api, mail, owner, models.NOTIFY_STORAGE_QUOTA,
+		"Your organization is running out of storage", body)
+	if err != nil {
+		clog.WithField("err", err).Error("Could not send storage notification")
+	}
+}
+
+// sendNotifications runs forever, noticing download milestones and sending
+// weekly digests.  It's meant to be run in its own goroutine.
+func sendNotifications(api *models.ApiCollection, mail mailer.Mailer) {
+	for {
+		checkDownloadMilestones(api, mail)
+		sendDueDigests(api, mail)
+		time.Sleep(notificationInterval)
+	}
+}
+
+// milestoneFor is the largest of the configured milestones that total has
+// reached, or 0 if it hasn't reached any.
+func milestoneFor(total int) int {
+	milestone := 0
+	for _, m := range utils.Conf.DownloadMilestones {
+		if m <= total && m > milestone {
+			milestone = m
+		}
+	}
+	return milestone
+}
+
+// checkDownloadMilestones tells owners when their models pass a download
+// milestone, by notification, in the audit log, and on their webhook.
+func checkDownloadMilestones(api *models.ApiCollection, mail mailer.Mailer) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			log.WithField("err", rec).Error("Panic while checking download milestones")
+		}
+	}()
+
+	totals, err := api.Model.PastDownloadMilestone(utils.Conf.DownloadMilestones)
+	if err != nil {
+		log.WithField("err", err).Error("Could not look up download milestones")
+		return
+	}
+	for _, t := range totals {
+		clog := log.WithField("model_id", t.Id)
+		m := t.Model
+		m.DownloadMilestone = milestoneFor(t.Total)
+		// Saving first means nobody gets told twice, at the cost of maybe not
+		// being told at all if sending fails
+		if err = api.Model.Save(&m); err != nil {
+			clog.WithField("err", err).Error("Could not save download milestone")
+			continue
+		}
+
+		e := models.NewAuditEvent("", m.UserId, models.AUDIT_DOWNLOAD_MILESTONE,
+			"model", m.Id, map[string]interface{}{
+				"milestone": m.DownloadMilestone,
+				"downloads": t.Total,
+			})
+		if err = api.AuditEvent.Record(e); err != nil {
+			clog.WithField("err", err).Error("Could not record download milestone")
+		}
+		sendSecurityWebhook(api, m.UserId, WEBHOOK_DOWNLOAD_MILESTONE, e)
+
+		owner, err := api.User.ById(m.UserId)
+		if err != nil {
+			clog.WithField("err", err).Error("Could not look up model owner")
+			continue
+		}
+		body := fmt.Sprintf("%s has been downloaded more than %d times:\n\n%s/%s/%s\n",
+			m.Name, m.DownloadMilestone, utils.Conf.WwwUrl, owner.Username, m.Slug)
+		err = notify(api, mail, owner, models.NOTIFY_DOWNLOAD_MILESTONE,
+			fmt.Sprintf("%s passed %d downloads", m.Name, m.DownloadMilestone), body)
+		if err != nil {
+			clog.WithField("err", err).Error("Could not send milestone notification")
+		}
+	}
+}
+
+func sendDueDigests(api *models.ApiCollection, mail mailer.Mailer) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			log.WithField("err", rec).Error("Panic while sending digests")
+		}
+	}()
+
+	userIds, err := api.Notification.DigestUserIds(time.Now().UTC().Add(-digestAfter),
+		digestBatch)
+	if err != nil {
+		log.WithField("err", err).Error("Could not look up digests to send")
+		return
+	}
+	for _, userId := range userIds {
+		clog := log.WithField("user_id", userId)
+		// Anything that fails is tried again next time around
+		if err = sendDigest(api, mail, userId); err != nil {
+			clog.WithField("err", err).Error("Could not send digest")
+		}
+	}
+}
+
+func sendDigest(api *models.ApiCollection, mail mailer.Mailer, userId string) error {
+	user, err := api.User.ById(userId)
+	if err != nil {
+		return err
+	}
+	ns, err := api.Notification.Unsent(userId)
+	if err != nil || len(ns) == 0 {
+		return err
+	}
+
+	body := fmt.Sprintf("Hi %s,\n\nHere's what happened on Gradientzoo this week.\n",
+		user.Username)
+	ids := make([]string, 0, len(ns))
+	for _, n := range ns {
+		body += fmt.Sprintf("\n* %s\n\n%s\n", n.Subject, n.Body)
+		ids = append(ids, n.Id)
+	}
+	body += fmt.Sprintf("\n--\nTo stop getting these e-mails, follow this "+
+		"link:\n%s\nor change your settings at %s/settings/notifications\n",
+		unsubscribeLink(user, ""), utils.Conf.WwwUrl)
+
+	if err = mail.Send(user.Email, "Your weekly Gradientzoo digest", body); err != nil {
+		return err
+	}
+	return api.Notification.MarkSent(ids, time.Now().UTC())
+}
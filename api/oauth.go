@@ -0,0 +1,216 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ericflo/gradientzoo/utils"
+)
+
+var oauthClient = &http.Client{Timeout: 10 * time.Second}
+
+// oauthProfile is what we need to know about someone from their provider in
+// order to sign them in or create an account for them.
+type oauthProfile struct {
+	Id       string
+	Email    string
+	Username string
+
+	// Claims is everything the provider said about them, for SSO role mapping
+	Claims map[string]interface{}
+}
+
+type oauthProvider struct {
+	Name         string
+	CallbackName string
+	AuthUrl      string
+	TokenUrl     string
+	Scope        string
+	ClientId     string
+	ClientSecret string
+	Profile      func(accessToken string) (*oauthProfile, error)
+}
+
+var oauthProviders = map[string]*oauthProvider{
+	"github": &oauthProvider{
+		Name:         "github",
+		AuthUrl:      "https://github.com/login/oauth/authorize",
+		TokenUrl:     "https://github.com/login/oauth/access_token",
+		Scope:        "user:email",
+		ClientId:     utils.Conf.GitHubClientId,
+		ClientSecret: utils.Conf.GitHubClientSecret,
+		Profile:      githubProfile,
+	},
+	"google": &oauthProvider{
+		Name:         "google",
+		AuthUrl:      "https://accounts.google.com/o/oauth2/v2/auth",
+		TokenUrl:     "https://www.googleapis.com/oauth2/v4/token",
+		Scope:        "openid email",
+		ClientId:     utils.Conf.GoogleClientId,
+		ClientSecret: utils.Conf.GoogleClientSecret,
+		Profile:      googleProfile,
+	},
+}
+
+func (p *oauthProvider) Enabled() bool {
+	return p.ClientId != "" && p.ClientSecret != ""
+}
+
+func (p *oauthProvider) RedirectUrl() string {
+	name := p.CallbackName
+	if name == "" {
+		name = p.Name
+	}
+	return strings.TrimRight(utils.Conf.OAuthRedirectUrl, "/") + "/" + name
+}
+
+func (p *oauthProvider) AuthCodeUrl(state string) string {
+	return p.AuthUrl + "?" + url.Values{
+		"client_id":     {p.ClientId},
+		"redirect_uri":  {p.RedirectUrl()},
+		"response_type": {"code"},
+		"scope":         {p.Scope},
+		"state":         {state},
+	}.Encode()
+}
+
+// Exchange trades the code the provider sent back for an access token.
+func (p *oauthProvider) Exchange(code string) (string, error) {
+	req, err := http.NewRequest("POST", p.TokenUrl, strings.NewReader(url.Values{
+		"client_id":     {p.ClientId},
+		"client_secret": {p.ClientSecret},
+		"code":          {code},
+		"redirect_uri":  {p.RedirectUrl()},
+		"grant_type":    {"authorization_code"},
+	}.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	resp, err := oauthClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var token struct {
+		AccessToken      string `json:"access_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", err
+	}
+	if token.Error != "" {
+		return "", fmt.Errorf("%s: %s", token.Error, token.ErrorDescription)
+	}
+	if token.AccessToken == "" {
+		return "", errors.New("No access token in response")
+	}
+	return token.AccessToken, nil
+}
+
+func oauthGet(u, authorization string, v interface{}) error {
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return err
+	}
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := oauthClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Got status %d from %s", resp.StatusCode, u)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func githubProfile(accessToken string) (*oauthProfile, error) {
+	var user struct {
+		Id    int64  `json:"id"`
+		Login string `json:"login"`
+	}
+	if err := oauthGet("https://api.github.com/user", "token "+accessToken, &user); err != nil {
+		return nil, err
+	}
+
+	// The e-mail on the profile is only there if it's public, and might not be
+	// verified, so look for the verified primary address instead
+	var emails []struct {
+		Email    string `json:"email"`
+		Primary  bool   `json:"primary"`
+		Verified bool   `json:"verified"`
+	}
+	if err := oauthGet("https://api.github.com/user/emails", "token "+accessToken, &emails); err != nil {
+		return nil, err
+	}
+	profile := &oauthProfile{
+		Id:       fmt.Sprintf("%d", user.Id),
+		Username: user.Login,
+	}
+	for _, e := range emails {
+		if e.Primary && e.Verified {
+			profile.Email = e.Email
+		}
+	}
+	return profile, nil
+}
+
+func googleProfile(accessToken string) (*oauthProfile, error) {
+	var user struct {
+		Sub           string `json:"sub"`
+		Email         string `json:"email"`
+		EmailVerified bool   `json:"email_verified"`
+	}
+	err := oauthGet("https://www.googleapis.com/oauth2/v3/userinfo",
+		"Bearer "+accessToken, &user)
+	if err != nil {
+		return nil, err
+	}
+	profile := &oauthProfile{Id: user.Sub}
+	if user.EmailVerified {
+		profile.Email = user.Email
+		profile.Username = strings.SplitN(user.Email, "@", 2)[0]
+	}
+	return profile, nil
+}
+
+// oauthUsername picks a free username for someone signing up through a
+// provider, based on the name they have there.
+func oauthUsername(c *Context, name string) (string, error) {
+	base := strings.Map(func(r rune) rune {
+		if SlugReg.MatchString(string(r)) {
+			return r
+		}
+		return '_'
+	}, name)
+	for len(base) < 3 {
+		base += "_"
+	}
+	username := base
+	for i := 2; i < 100; i++ {
+		if !utils.Live().Reserved(username) {
+			_, err := c.Api.User.ByUsername(username)
+			if err == sql.ErrNoRows {
+				return username, nil
+			}
+			if err != nil {
+				return "", err
+			}
+		}
+		username = fmt.Sprintf("%s%d", base, i)
+	}
+	return "", errors.New("Could not find a free username for " + name)
+}
@@ -0,0 +1,126 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/models"
+)
+
+// OrganizationUsage is an organization's plan along with how much of it its
+// members have used, in total and one by one.  Bandwidth is counted from Since
+// up to Until, the calendar month it's billed for.
+type OrganizationUsage struct {
+	StorageBytes   int64                 `json:"storage_bytes"`
+	StorageQuota   int64                 `json:"storage_quota"`
+	BandwidthBytes int64                 `json:"bandwidth_bytes"`
+	BandwidthQuota int64                 `json:"bandwidth_quota"`
+	Since          time.Time             `json:"since"`
+	Until          time.Time             `json:"until"`
+	Members        []*models.MemberUsage `json:"members,omitempty"`
+}
+
+// monthStart is when bandwidth started being counted for the current month.
+func monthStart(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+func organizationUsage(api *models.ApiCollection, org *models.Organization) (*OrganizationUsage, error) {
+	since := monthStart(time.Now())
+	members, err := api.Organization.Usage(org.Id, since)
+	if err != nil {
+		return nil, err
+	}
+	usage := &OrganizationUsage{
+		StorageQuota:   org.StorageQuota(),
+		BandwidthQuota: org.BandwidthQuota(),
+		Since:          since,
+		Until:          since.AddDate(0, 1, 0),
+		Members:        members,
+	}
+	for _, m := range members {
+		usage.StorageBytes += m.StorageBytes
+		usage.BandwidthBytes += m.BandwidthBytes
+	}
+	return usage, nil
+}
+
+// userOrganization looks up the organization the user belongs to, if any.
+func userOrganization(api *models.ApiCollection, userId string) (*models.Organization, error) {
+	org, err := api.Organization.ByUserId(userId)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return org, err
+}
+
+// organizationCoversPlan says whether the user's organization pays for models
+// that keep this many versions, so they don't have to pay for their own.
+func organizationCoversPlan(api *models.ApiCollection, user *models.User, keep int) (bool, error) {
+	org, err := userOrganization(api, user.Id)
+	if err != nil || org == nil || keep > org.Keep {
+		return false, err
+	}
+	owner, err := api.User.ById(org.OwnerId)
+	if err != nil {
+		return false, err
+	}
+	return owner.StripeCustomerId != "", nil
+}
+
+// organizationHasRoom says whether the user's organization, if they have one,
+// has room in its storage quota for another sizeBytes.
+func organizationHasRoom(api *models.ApiCollection, user *models.User, sizeBytes int64) (bool, error) {
+	org, err := userOrganization(api, user.Id)
+	if err != nil || org == nil {
+		return true, err
+	}
+	usage, err := organizationUsage(api, org)
+	if err != nil {
+		return false, err
+	}
+	return usage.StorageBytes+sizeBytes <= usage.StorageQuota, nil
+}
+
+// Members of an organization that requires two-factor authentication can
+// still use these to find out why they're being refused, and to turn it on
+var twoFactorSetupPaths = map[string]bool{
+	"/auth/user":        true,
+	"/auth/logout":      true,
+	"/auth/2fa/enroll":  true,
+	"/auth/2fa/confirm": true,
+}
+
+// organizationRefuses says why the user's organization won't let them use
+// their token for the request, if it won't.  Organizations can require their
+// members to turn on two-factor authentication, which service accounts are
+// exempt from, since they can't, and can allow their members' tokens to be
+// used only from some networks.
+func organizationRefuses(api *models.ApiCollection, user *models.User, req *http.Request) (int, *ApiError, error) {
+	org, err := userOrganization(api, user.Id)
+	if err != nil || org == nil {
+		return 0, nil, err
+	}
+	if org.RequireTwoFactor && !user.TotpEnabled && !user.IsService() && !twoFactorSetupPaths[req.URL.Path] {
+		return http.StatusUnauthorized, ApiErr(ERR_TWO_FACTOR_REQUIRED,
+			"Your organization requires two-factor authentication, please turn it on first"), nil
+	}
+
+	entries, err := api.IpAllowlist.ByOrganizationId(org.Id)
+	if err != nil {
+		return 0, nil, err
+	}
+	if ip := clientIp(req); !models.IpAllowed(entries, ip) {
+		log.WithFields(log.Fields{
+			"user_id":         user.Id,
+			"organization_id": org.Id,
+			"ip":              ip,
+		}).Warn("Token used from outside its organization's allowlist")
+		return http.StatusForbidden, ApiErr(ERR_IP_NOT_ALLOWED,
+			"Your organization doesn't allow tokens to be used from "+ip), nil
+	}
+	return 0, nil, nil
+}
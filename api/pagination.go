@@ -0,0 +1,77 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/ericflo/gradientzoo/models"
+	"github.com/pborman/uuid"
+)
+
+// The most rows any list endpoint gives back at once
+const MaxPageSize = 100
+
+var errBadCursor = errors.New("That cursor is not valid")
+
+// Cursors are opaque to clients, but they're just the page key of the last
+// row on a page, along with the kind of listing it came from (including its
+// sort) so that a cursor from one listing can't be used with another.
+func encodeCursor(kind string, key *models.PageKey) string {
+	raw, _ := json.Marshal(append([]string{kind, key.Id}, key.Keys...))
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeCursor(kind, cursor string) (*models.PageKey, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, errBadCursor
+	}
+	var parts []string
+	if err = json.Unmarshal(raw, &parts); err != nil {
+		return nil, errBadCursor
+	}
+	if len(parts) < 2 || parts[0] != kind {
+		return nil, errBadCursor
+	}
+	if parts[1] != "" && uuid.Parse(parts[1]) == nil {
+		return nil, errBadCursor
+	}
+	return &models.PageKey{Id: parts[1], Keys: parts[2:]}, nil
+}
+
+// nextCursor is what list endpoints send back as their next_cursor: null once
+// there are no more pages.
+func nextCursor(kind string, next *models.PageKey) interface{} {
+	if next == nil {
+		return nil
+	}
+	return encodeCursor(kind, next)
+}
+
+// pageParams reads the limit and cursor query params that list endpoints
+// take, for a listing of the kind.  Limits over maxSize are capped, rather
+// than turned away.
+func pageParams(req *http.Request, kind string, defaultSize, maxSize int) (int, *models.PageKey, error) {
+	query := req.URL.Query()
+	limit := defaultSize
+	if limitStr := query.Get("limit"); limitStr != "" {
+		var err error
+		if limit, err = strconv.Atoi(limitStr); err != nil || limit < 1 {
+			return 0, nil, errors.New("Limit must be a positive number")
+		}
+		if limit > maxSize {
+			limit = maxSize
+		}
+	}
+	var after *models.PageKey
+	if cursor := query.Get("cursor"); cursor != "" {
+		var err error
+		if after, err = decodeCursor(kind, cursor); err != nil {
+			return 0, nil, err
+		}
+	}
+	return limit, after, nil
+}
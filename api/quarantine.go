@@ -0,0 +1,36 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/models"
+)
+
+// StatusUnavailableForLegalReasons is from RFC 7725, which net/http doesn't
+// know about yet
+const StatusUnavailableForLegalReasons = 451
+
+// refuseQuarantined responds with the reason a file was taken down if it's
+// quarantined, and reports whether it did, in which case the caller must not
+// hand out the file.
+func refuseQuarantined(c *Context, w http.ResponseWriter, clog *log.Entry, f *models.File) bool {
+	q, err := c.Api.FileQuarantine.ActiveByFileId(f.Id)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up file quarantine")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not get your file, please try again soon"))
+		return true
+	}
+	if err == sql.ErrNoRows || q == nil {
+		return false
+	}
+	clog.WithField("file_quarantine_id", q.Id).Info("Refused download of quarantined file")
+	c.Render.JSON(w, StatusUnavailableForLegalReasons, map[string]interface{}{
+		"code":       ERR_FILE_QUARANTINED,
+		"error":      "This file has been taken down",
+		"quarantine": q,
+	})
+	return true
+}
@@ -0,0 +1,115 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/models"
+	"github.com/ericflo/gradientzoo/ratelimit"
+	"github.com/ericflo/gradientzoo/utils"
+)
+
+var limiter ratelimit.Limiter = ratelimit.NewMemoryLimiter()
+
+// The rate limits are looked up for each request, since they can be
+// reloaded
+var (
+	loginLimit = func() ratelimit.Limit {
+		return ratelimit.Limit{Name: "login", Count: utils.Live().RateLimitLogin, Period: time.Minute}
+	}
+	uploadLimit = func() ratelimit.Limit {
+		return ratelimit.Limit{Name: "upload", Count: utils.Live().RateLimitUpload, Period: time.Minute}
+	}
+	downloadLimit = func() ratelimit.Limit {
+		return ratelimit.Limit{Name: "download", Count: utils.Live().RateLimitDownload, Period: time.Minute}
+	}
+	listLimit = func() ratelimit.Limit {
+		return ratelimit.Limit{Name: "list", Count: utils.Live().RateLimitList, Period: time.Minute}
+	}
+)
+
+// clientIp is the address of whoever made the request.  Each proxy in front
+// of us adds to the end of X-Forwarded-For, so the client's address is
+// TrustedProxyHops from the end, and anything before it could have been made
+// up by the client.  Requests that didn't come through the proxies get the
+// address they came from.
+func clientIp(req *http.Request) string {
+	hops := utils.Conf.TrustedProxyHops
+	// Proxies can add their own header rather than appending to one
+	if forwarded := req.Header["X-Forwarded-For"]; hops > 0 && len(forwarded) > 0 {
+		ips := strings.Split(strings.Join(forwarded, ","), ",")
+		if len(ips) >= hops {
+			if ip := strings.TrimSpace(ips[len(ips)-hops]); ip != "" {
+				return ip
+			}
+		}
+	}
+	if host, _, err := net.SplitHostPort(req.RemoteAddr); err == nil {
+		return host
+	}
+	return req.RemoteAddr
+}
+
+// Limited applies the rate limit to the handler, counting requests per user,
+// per app key, or per IP for other anonymous requests.  App keys get a
+// multiple of the limit.
+func Limited(limitFor func() ratelimit.Limit, h Handler) Handler {
+	return Handler(func(c *Context, w http.ResponseWriter, req *http.Request) {
+		limit := limitFor()
+		if !limit.Enabled() {
+			h(c, w, req)
+			return
+		}
+		key := "ip:" + clientIp(req)
+		keyLimit := limit
+		if c.User != nil {
+			key = "user:" + c.User.Id
+		} else if c.AppKey != nil {
+			key = "app:" + c.AppKey.Id
+			if c.AppKey.RateMultiplier > 1 {
+				keyLimit.Count *= c.AppKey.RateMultiplier
+			}
+		}
+		res, err := limiter.Take(key, keyLimit)
+		if err != nil {
+			// Better to let people through than to go down with the limiter
+			c.Log().WithFields(log.Fields{
+				"err":   err,
+				"limit": limit.Name,
+			}).Error("Could not check rate limit")
+			h(c, w, req)
+			return
+		}
+		w.Header().Set("X-RateLimit-Limit", fmt.Sprintf("%d", res.Limit))
+		w.Header().Set("X-RateLimit-Remaining", fmt.Sprintf("%d", res.Remaining))
+		w.Header().Set("X-RateLimit-Reset", fmt.Sprintf("%d", res.Reset.Unix()))
+		if !res.Allowed {
+			c.RateLimited = true
+			retry := int(math.Ceil(res.RetryAfter.Seconds()))
+			w.Header().Set("Retry-After", fmt.Sprintf("%d", retry))
+			c.Render.JSON(w, http.StatusTooManyRequests,
+				ApiErr(ERR_RATE_LIMITED, "Too many requests, please try again in a little while"))
+			return
+		}
+		h(c, w, req)
+	})
+}
+
+// markAppKeyRequest counts a request towards the app key's usage stats.  It's
+// meant to be run in its own goroutine.
+func markAppKeyRequest(api *models.ApiCollection, appKey *models.AppKey, rateLimited bool) {
+	clog := log.WithField("app_key_id", appKey.Id)
+	defer func() {
+		if rec := recover(); rec != nil {
+			clog.WithField("err", rec).Error("Panic while counting app key request")
+		}
+	}()
+	if err := api.AppKey.MarkRequest(appKey.Id, time.Now(), rateLimited); err != nil {
+		clog.WithField("err", err).Error("Could not count app key request")
+	}
+}
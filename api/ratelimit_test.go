@@ -0,0 +1,47 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/ericflo/gradientzoo/utils"
+)
+
+func TestClientIp(t *testing.T) {
+	defer func(hops int) { utils.Conf.TrustedProxyHops = hops }(utils.Conf.TrustedProxyHops)
+
+	tests := []struct {
+		hops      int
+		forwarded []string
+		want      string
+	}{
+		// With no proxy, the header is whatever the client made up
+		{0, nil, "10.0.0.9"},
+		{0, []string{"1.2.3.4"}, "10.0.0.9"},
+
+		// A proxy that adds the client's address
+		{1, []string{"1.2.3.4"}, "1.2.3.4"},
+		{1, []string{"6.6.6.6, 1.2.3.4"}, "1.2.3.4"},
+
+		// Google's load balancer adds the client's address and its own
+		{2, []string{"1.2.3.4, 130.211.0.1"}, "1.2.3.4"},
+		{2, []string{"6.6.6.6, 7.7.7.7, 1.2.3.4, 130.211.0.1"}, "1.2.3.4"},
+		{2, []string{"6.6.6.6", "1.2.3.4,130.211.0.1"}, "1.2.3.4"},
+
+		// Requests that didn't come through every proxy
+		{2, []string{"1.2.3.4"}, "10.0.0.9"},
+		{2, nil, "10.0.0.9"},
+		{2, []string{", 130.211.0.1"}, "10.0.0.9"},
+	}
+	for _, test := range tests {
+		utils.Conf.TrustedProxyHops = test.hops
+		req := &http.Request{Header: http.Header{}, RemoteAddr: "10.0.0.9:51234"}
+		if test.forwarded != nil {
+			req.Header["X-Forwarded-For"] = test.forwarded
+		}
+		if got := clientIp(req); got != test.want {
+			t.Errorf("clientIp with %d hops and %q = %s, want %s",
+				test.hops, test.forwarded, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package api
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// acceptedLanguage is one of the languages in an Accept-Language header, with
+// how much it's wanted.
+type acceptedLanguage struct {
+	tag string
+	q   float64
+}
+
+type byQuality []acceptedLanguage
+
+func (a byQuality) Len() int           { return len(a) }
+func (a byQuality) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a byQuality) Less(i, j int) bool { return a[i].q > a[j].q }
+
+// acceptedLanguages reads an Accept-Language header like "pt-BR, pt;q=0.8,
+// en;q=0.5" into its languages, most wanted first.  Ones with a quality of
+// zero aren't wanted at all, and are left out, as is the "*" wildcard.
+func acceptedLanguages(header string) []acceptedLanguage {
+	accepted := []acceptedLanguage{}
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		tag := strings.ToLower(strings.TrimSpace(fields[0]))
+		if tag == "" || tag == "*" {
+			continue
+		}
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				var err error
+				if q, err = strconv.ParseFloat(param[2:], 64); err != nil {
+					q = 0
+				}
+			}
+		}
+		if q > 0 {
+			accepted = append(accepted, acceptedLanguage{tag: tag, q: q})
+		}
+	}
+	sort.Stable(byQuality(accepted))
+	return accepted
+}
+
+// primarySubtag is the language without its region or script, e.g. "pt" for
+// "pt-br".
+func primarySubtag(language string) string {
+	if i := strings.Index(language, "-"); i >= 0 {
+		return language[:i]
+	}
+	return language
+}
+
+// bestLanguage picks which of the available languages to serve for an
+// Accept-Language header, going by the most wanted language that there's an
+// exact match for, or failing that one in the same language from another
+// region.  It returns fallback if none of them will do.
+func bestLanguage(header string, available []string, fallback string) string {
+	for _, a := range acceptedLanguages(header) {
+		for _, language := range available {
+			if language == a.tag {
+				return language
+			}
+		}
+		for _, language := range available {
+			if primarySubtag(language) == primarySubtag(a.tag) {
+				return language
+			}
+		}
+	}
+	return fallback
+}
+
+// readmeLanguageHeaders says which language the readme was served in, and
+// that a different Accept-Language might get another.
+func readmeLanguageHeaders(w http.ResponseWriter, language string) {
+	w.Header().Set("Content-Language", language)
+	w.Header().Add("Vary", "Accept-Language")
+}
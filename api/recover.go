@@ -0,0 +1,95 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"time"
+
+	"github.com/codegangsta/negroni"
+	"github.com/ericflo/gradientzoo/errorreport"
+	"github.com/ericflo/gradientzoo/metrics"
+)
+
+// Where panics are reported.  Main sends them to Sentry if there's a DSN.
+var reporter errorreport.Reporter = errorreport.NewLogReporter()
+
+var panics = metrics.NewCounter("gradientzoo_panics_total",
+	"Panics recovered from while serving requests, by route.", "route")
+
+// Headers that help make sense of a panic, and are never secret
+var reportedHeaders = []string{
+	"User-Agent",
+	"Content-Type",
+	"Content-Length",
+	"X-Gradientzoo-Client-Name",
+	"X-Gradientzoo-Framework",
+	"X-Gradientzoo-Framework-Version",
+}
+
+// recoverPanic turns a panic while serving a request into a 500, and reports
+// it along with who was being served, if that's known yet.  It has to be
+// deferred itself, since that's the only way recover works.
+func recoverPanic(w http.ResponseWriter, req *http.Request, c *Context) {
+	rec := recover()
+	if rec == nil {
+		return
+	}
+
+	e := &errorreport.Event{
+		Message: fmt.Sprintf("Panic: %v", rec),
+		Stack:   string(debug.Stack()),
+		Time:    time.Now().UTC(),
+		Method:  req.Method,
+		Url:     req.URL.String(),
+		Headers: map[string]string{},
+		Tags:    map[string]string{},
+	}
+	for _, h := range reportedHeaders {
+		if v := req.Header.Get(h); v != "" {
+			e.Headers[h] = v
+		}
+	}
+	if r := requestFrom(req); r != nil {
+		e.RequestId = r.id
+		e.Route = r.route
+	}
+	if c != nil {
+		if c.User != nil {
+			e.UserId = c.User.Id
+			e.Username = c.User.Username
+		}
+		if c.AppKey != nil {
+			e.Tags["app_key_id"] = c.AppKey.Id
+		}
+		// Route params say what the request was about, e.g. which model
+		for _, p := range c.Params {
+			e.Tags["param."+p.Key] = p.Value
+		}
+	}
+	errorreport.Scrub(e)
+	panics.Inc(e.Route)
+	reporter.Report(e)
+
+	// Once the response has started it's too late to change its status, and
+	// all that can be done is to stop
+	if rw, ok := w.(negroni.ResponseWriter); ok && rw.Written() {
+		return
+	}
+	apiErr := ApiErr(ERR_INTERNAL, "Something went wrong on our end, please try again soon")
+	apiErr.RequestId = e.RequestId
+	rndr.JSON(w, http.StatusInternalServerError, apiErr)
+}
+
+// PanicRecovery is the middleware that catches panics outside of the
+// handlers, which catch their own so that they know who they were serving.
+type PanicRecovery struct{}
+
+func NewPanicRecovery() *PanicRecovery {
+	return &PanicRecovery{}
+}
+
+func (p *PanicRecovery) ServeHTTP(rw http.ResponseWriter, req *http.Request, next http.HandlerFunc) {
+	defer recoverPanic(rw, req, nil)
+	next(rw, req)
+}
@@ -0,0 +1,46 @@
+package api
+
+import (
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/models"
+)
+
+const relatedInterval = 6 * time.Hour
+
+// Related models are worked out from downloads over this window, which has to
+// fit within DownloadHourRetentionDays since it's hourly downloads that still
+// have addresses
+const relatedWindow = 30 * 24 * time.Hour
+
+const (
+	relatedMinCoDownloads  = 3  // Addresses that have to download both models
+	relatedMaxModelsPerIp  = 50 // More than this and it's a mirror or crawler
+	relatedFrameworkWeight = 2  // Sharing a framework counts as this many addresses
+	relatedSize            = 20 // How many related models each model keeps
+)
+
+// refreshRelated runs forever, working out which models are related ahead of
+// time.  It's meant to be run in its own goroutine.
+func refreshRelated(api *models.ApiCollection) {
+	for {
+		refreshRelatedOnce(api)
+		time.Sleep(relatedInterval)
+	}
+}
+
+func refreshRelatedOnce(api *models.ApiCollection) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			log.WithField("err", rec).Error("Panic while refreshing related models")
+		}
+	}()
+
+	since := time.Now().UTC().Add(-relatedWindow)
+	err := api.ModelRelated.Refresh(since, relatedMinCoDownloads,
+		relatedMaxModelsPerIp, relatedFrameworkWeight, relatedSize)
+	if err != nil {
+		log.WithField("err", err).Error("Could not refresh related models")
+	}
+}
@@ -0,0 +1,138 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/metrics"
+	"github.com/ericflo/gradientzoo/models"
+	"github.com/ericflo/gradientzoo/utils"
+)
+
+// GET requests read from the replica, if there is one, unless whoever's
+// asking has written something in the last ReplicaStalenessSeconds, which the
+// replica might not have yet.  Writers are remembered by user id on the
+// server they wrote to, and browsers also get a cookie saying until when, so
+// that it works whichever server they go to next.
+
+const REPLICA_COOKIE = "gz_wrote"
+
+const replicaCheckInterval = 5 * time.Second
+
+// When each user last wrote something on this server
+var recentWrites = struct {
+	sync.Mutex
+	byUser map[string]time.Time
+}{byUser: map[string]time.Time{}}
+
+var replicaLag = metrics.NewGauge("gradientzoo_db_replica_lag_seconds",
+	"How far behind the primary the read replica is.")
+
+// routeReads decides where the request's reads go, and returns the Api
+// collection that sends them there.
+func routeReads(w http.ResponseWriter, req *http.Request, user *models.User) *models.ApiCollection {
+	if api.Replica() == nil {
+		return api
+	}
+	if req.Method != "GET" && req.Method != "HEAD" {
+		markWrite(w, user)
+		return api
+	}
+	if wroteRecently(req, user) {
+		return api
+	}
+	return api.ReadingReplica()
+}
+
+// markWrite remembers that the user, or whoever sent the request, is writing
+// something they'll expect to read back.
+func markWrite(w http.ResponseWriter, user *models.User) {
+	staleness := time.Duration(utils.Conf.ReplicaStalenessSeconds) * time.Second
+	if staleness == 0 {
+		return
+	}
+	until := time.Now().Add(staleness)
+	setCookie(w, &http.Cookie{
+		Name:     REPLICA_COOKIE,
+		Value:    strconv.FormatInt(until.Unix(), 10),
+		Path:     "/",
+		MaxAge:   utils.Conf.ReplicaStalenessSeconds,
+		HttpOnly: true,
+	})
+	if user != nil {
+		recentWrites.Lock()
+		recentWrites.byUser[user.Id] = until
+		recentWrites.Unlock()
+	}
+}
+
+func wroteRecently(req *http.Request, user *models.User) bool {
+	now := time.Now()
+	if cookie, err := req.Cookie(REPLICA_COOKIE); err == nil {
+		until, err := strconv.ParseInt(cookie.Value, 10, 64)
+		if err == nil && now.Unix() < until {
+			return true
+		}
+	}
+	if user == nil {
+		return false
+	}
+	recentWrites.Lock()
+	defer recentWrites.Unlock()
+	until, ok := recentWrites.byUser[user.Id]
+	return ok && now.Before(until)
+}
+
+// watchReplica runs forever, keeping reads off the replica while it's too far
+// behind, and forgetting writers once it's caught up with them.  It's meant to
+// be run in its own goroutine.
+func watchReplica(api *models.ApiCollection) {
+	healthy := true
+	for {
+		healthy = watchReplicaOnce(api, healthy)
+		time.Sleep(replicaCheckInterval)
+	}
+}
+
+// watchReplicaOnce checks on the replica, and returns whether it can be read
+// from.
+func watchReplicaOnce(api *models.ApiCollection, wasHealthy bool) (healthy bool) {
+	healthy = wasHealthy
+	defer func() {
+		if rec := recover(); rec != nil {
+			log.WithField("err", rec).Error("Panic while checking on the replica")
+		}
+	}()
+
+	now := time.Now()
+	recentWrites.Lock()
+	for userId, until := range recentWrites.byUser {
+		if now.After(until) {
+			delete(recentWrites.byUser, userId)
+		}
+	}
+	recentWrites.Unlock()
+
+	lag, err := api.ReplicaLag()
+	healthy = err == nil && lag <= float64(utils.Conf.ReplicaMaxLagSeconds)
+	if err == nil {
+		replicaLag.Set(lag)
+	}
+	models.SetReplicaHealthy(healthy)
+
+	if healthy != wasHealthy {
+		clog := log.WithField("lag_seconds", lag)
+		if err != nil {
+			clog = clog.WithField("err", err)
+		}
+		if healthy {
+			clog.Info("Replica caught up, reading from it again")
+		} else {
+			clog.Warn("Replica is behind or unreachable, reading from the primary")
+		}
+	}
+	return healthy
+}
@@ -0,0 +1,110 @@
+package api
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"regexp"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/codegangsta/negroni"
+	"github.com/ericflo/gradientzoo/utils"
+	"github.com/pborman/uuid"
+)
+
+// Every request gets an id, which is sent back in the X-Request-Id header and
+// added to everything handlers log through their Context's Log, so that a
+// user's report of a failed request can be matched up with what went wrong.  The load balancer's
+// id is used if it sent one, so that its logs match up too.
+
+const REQUEST_ID_HEADER = "X-Request-Id"
+
+// Ids we're sent are only trusted if they look like ids
+var requestIdRegexp = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// requestInfo is what the request log needs to know about a request, filled in
+// as it's worked out.
+type requestInfo struct {
+	id      string
+	route   string
+	userId  string
+	sampled bool // Whether its log line can be left out when all is well
+}
+
+type requestInfoKey struct{}
+
+// requestFrom is what the request log knows about the request, which its
+// context carries, or nil.  Only the goroutine serving the request touches its
+// fields.
+func requestFrom(req *http.Request) *requestInfo {
+	r, _ := req.Context().Value(requestInfoKey{}).(*requestInfo)
+	return r
+}
+
+// RequestLogger is the middleware that hands out request ids, and logs each
+// request once it's been served.
+type RequestLogger struct{}
+
+func NewRequestLogger() *RequestLogger {
+	return &RequestLogger{}
+}
+
+func (l *RequestLogger) ServeHTTP(rw http.ResponseWriter, req *http.Request, next http.HandlerFunc) {
+	start := time.Now()
+
+	id := req.Header.Get(REQUEST_ID_HEADER)
+	if !requestIdRegexp.MatchString(id) {
+		id = uuid.New()
+	}
+	rw.Header().Set(REQUEST_ID_HEADER, id)
+
+	r := &requestInfo{id: id}
+	next(rw, req.WithContext(context.WithValue(req.Context(), requestInfoKey{}, r)))
+
+	status := http.StatusOK
+	size := 0
+	if nrw, ok := rw.(negroni.ResponseWriter); ok {
+		if nrw.Status() != 0 {
+			status = nrw.Status()
+		}
+		size = nrw.Size()
+	}
+
+	// Successful downloads are too many to log every one of
+	rate := utils.Live().DownloadLogSampleRate
+	if r.sampled && status < 400 && rate > 1 && rand.Intn(rate) != 0 {
+		return
+	}
+
+	fields := log.Fields{
+		"request_id":  id,
+		"method":      req.Method,
+		"path":        req.URL.Path,
+		"status":      status,
+		"size":        size,
+		"duration_ms": float64(time.Since(start).Nanoseconds()) / 1e6,
+		"remote":      clientIp(req),
+	}
+	if r.route != "" {
+		fields["route"] = r.route
+	}
+	if r.userId != "" {
+		fields["user_id"] = r.userId
+	}
+	if r.sampled && rate > 1 {
+		fields["sample_rate"] = rate
+	}
+	log.WithFields(fields).Info("Handled request")
+}
+
+// Sampled marks the endpoint's successful requests as ones that only need
+// logging now and then, for the busiest ones like downloads.
+func Sampled(h Handler) Handler {
+	return Handler(func(c *Context, w http.ResponseWriter, req *http.Request) {
+		if r := requestFrom(req); r != nil {
+			r.sampled = true
+		}
+		h(c, w, req)
+	})
+}
@@ -0,0 +1,188 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/mailer"
+	"github.com/ericflo/gradientzoo/models"
+	"github.com/ericflo/gradientzoo/search"
+)
+
+const (
+	maxSavedSearchNameLength  = 100
+	maxSavedSearchQueryLength = 200
+)
+
+// Saved searches are checked for new models this often
+const savedSearchInterval = 15 * time.Minute
+const savedSearchBatch = 100
+
+// Notifications list this many of the new models, and say if there are more
+const savedSearchMatches = 10
+
+// The filter params a search can be saved with.  Updated since is left out
+// since it would only go stale.
+var savedSearchParams = map[string]bool{
+	"framework":         true,
+	"framework_version": true,
+	"license":           true,
+	"max_size":          true,
+	"min_downloads":     true,
+}
+
+// savedSearchFilter turns the filter params a search was saved with into a
+// filter, checking them along the way.
+func savedSearchFilter(params map[string]string) (*models.ModelFilter, error) {
+	query := url.Values{}
+	for k, v := range params {
+		if !savedSearchParams[k] {
+			return nil, errors.New("Saved searches can only filter by framework, " +
+				"framework_version, license, max_size and min_downloads")
+		}
+		query.Set(k, v)
+	}
+	return parseModelFilter(query)
+}
+
+// checkSavedSearches runs forever, telling users about new public models that
+// match their saved searches.  It's meant to be run in its own goroutine.
+func checkSavedSearches(api *models.ApiCollection, mail mailer.Mailer) {
+	for {
+		checkSavedSearchesOnce(api, mail)
+		time.Sleep(savedSearchInterval)
+	}
+}
+
+func checkSavedSearchesOnce(api *models.ApiCollection, mail mailer.Mailer) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			log.WithField("err", rec).Error("Panic while checking saved searches")
+		}
+	}()
+
+	// New models are searched for with Postgres even when there's a search
+	// index, since one that hadn't been indexed yet would be missed for good
+	searcher := search.NewPostgresBackend(api)
+	now := time.Now().UTC()
+	for {
+		due, err := api.SavedSearch.Due(now, savedSearchBatch)
+		if err != nil {
+			log.WithField("err", err).Error("Could not look up saved searches")
+			return
+		}
+		for _, s := range due {
+			checkSavedSearch(api, mail, searcher, s, now)
+		}
+		if len(due) < savedSearchBatch {
+			return
+		}
+	}
+}
+
+// checkSavedSearch tells the user about public models that match the search
+// and were created between when it was last checked and now.
+func checkSavedSearch(api *models.ApiCollection, mail mailer.Mailer, searcher search.Backend, s *models.SavedSearch, now time.Time) {
+	clog := log.WithFields(log.Fields{
+		"user_id":         s.UserId,
+		"saved_search_id": s.Id,
+	})
+
+	// Filters are checked when searches are saved, so one that doesn't parse
+	// now never will, and there's no point trying it again
+	var results *search.Results
+	filter, err := savedSearchFilter(s.Filter)
+	if err != nil {
+		clog.WithField("err", err).Error("Could not read saved search filter")
+	} else {
+		filter.CreatedSince = s.CheckedTime
+		filter.CreatedBefore = now
+		// One more than will be listed, to know whether there are more
+		results, err = searcher.Search(context.Background(), s.Query, "", filter, savedSearchMatches+1, 0)
+		if err != nil && err != sql.ErrNoRows {
+			// It's tried again next time around, over the same models
+			clog.WithField("err", err).Error("Could not search for saved search")
+			return
+		}
+	}
+
+	// Marking it first means nobody gets told twice, at the cost of maybe not
+	// being told at all if sending fails
+	if err = api.SavedSearch.MarkChecked(s.Id, now); err != nil {
+		clog.WithField("err", err).Error("Could not mark saved search checked")
+		return
+	}
+	if results == nil {
+		return
+	}
+	// Nobody needs telling about their own models
+	matches := make([]*models.ModelMatch, 0, len(results.Matches))
+	for _, match := range results.Matches {
+		if match.UserId != s.UserId {
+			matches = append(matches, match)
+		}
+	}
+	if len(matches) == 0 {
+		return
+	}
+	more := len(matches) > savedSearchMatches
+	if more {
+		matches = matches[:savedSearchMatches]
+	}
+
+	owner, err := api.User.ById(s.UserId)
+	if err != nil {
+		clog.WithField("err", err).Error("Could not look up saved search owner")
+		return
+	}
+	userIds := make([]interface{}, 0, len(matches))
+	for _, match := range matches {
+		userIds = append(userIds, match.UserId)
+	}
+	users, err := api.User.ByIds(userIds)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up model owners")
+		return
+	}
+	usernames := make(map[string]string, len(users))
+	for _, u := range users {
+		usernames[u.Id] = u.Username
+	}
+
+	body := fmt.Sprintf("New models match your saved search \"%s\":\n", s.Name)
+	for _, match := range matches {
+		body += fmt.Sprintf("\n%s\n%s\n", match.Name,
+			modelUrl(usernames[match.UserId], match.Slug))
+	}
+	if more {
+		body += "\nAnd more besides.\n"
+	}
+	err = notify(api, mail, owner, models.NOTIFY_SAVED_SEARCH,
+		fmt.Sprintf("New models for \"%s\"", s.Name), body)
+	if err != nil {
+		clog.WithField("err", err).Error("Could not send saved search notification")
+	}
+}
+
+// ownSavedSearch looks up the signed in user's saved search named by the id
+// param, responding and returning nil if it can't.
+func ownSavedSearch(c *Context, w http.ResponseWriter, clog *log.Entry) *models.SavedSearch {
+	s, err := c.Api.SavedSearch.ById(c.Params.ByName("id"))
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up saved search")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not get that saved search, please try again soon"))
+		return nil
+	}
+	if s == nil || err == sql.ErrNoRows || s.UserId != c.User.Id {
+		c.Render.JSON(w, http.StatusNotFound, ApiErr(ERR_NOT_FOUND, "That saved search was not found"))
+		return nil
+	}
+	return s
+}
@@ -0,0 +1,92 @@
+package api
+
+import (
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/models"
+	"github.com/ericflo/gradientzoo/search"
+)
+
+const searchIndexInterval = 10 * time.Second
+
+// How many queued models are indexed at a time
+const searchIndexBatch = 100
+
+// Download counts change without queueing anything, so every model is queued
+// this often to pick them up
+const searchReindexInterval = 24 * time.Hour
+
+// indexSearch runs forever, indexing models as they're queued by changes to
+// them or their files.  The queue is drained even when the backend has no
+// index of its own, so that it doesn't grow forever.  It's meant to be run in
+// its own goroutine.
+func indexSearch(api *models.ApiCollection, backend search.Backend) {
+	lastReindex := time.Now()
+	for {
+		if time.Since(lastReindex) >= searchReindexInterval {
+			if err := api.SearchIndex.QueueAll(); err != nil {
+				log.WithField("err", err).Error("Could not queue models for reindexing")
+			} else {
+				lastReindex = time.Now()
+			}
+		}
+		// Keep going without a break while there's a backlog
+		if indexSearchOnce(api, backend) < searchIndexBatch {
+			time.Sleep(searchIndexInterval)
+		}
+	}
+}
+
+// indexSearchOnce indexes a batch of queued models, and returns how many
+// there were.
+func indexSearchOnce(api *models.ApiCollection, backend search.Backend) int {
+	defer func() {
+		if rec := recover(); rec != nil {
+			log.WithField("err", rec).Error("Panic while indexing models")
+		}
+	}()
+
+	entries, err := api.SearchIndex.Pending(searchIndexBatch)
+	if err != nil {
+		log.WithField("err", err).Error("Could not look up models to index")
+		return 0
+	}
+	if len(entries) == 0 {
+		return 0
+	}
+	ids := make([]string, 0, len(entries))
+	for _, e := range entries {
+		ids = append(ids, e.ModelId)
+	}
+	docs, err := api.SearchIndex.Docs(ids)
+	if err != nil {
+		log.WithField("err", err).Error("Could not build search documents")
+		return 0
+	}
+
+	// Whatever's queued but not there any more was deleted
+	found := make(map[string]bool, len(docs))
+	for _, doc := range docs {
+		found[doc.Id] = true
+	}
+	var removed []string
+	for _, id := range ids {
+		if !found[id] {
+			removed = append(removed, id)
+		}
+	}
+
+	if err = backend.Index(docs); err != nil {
+		log.WithField("err", err).Error("Could not index models")
+		return 0
+	}
+	if err = backend.Remove(removed); err != nil {
+		log.WithField("err", err).Error("Could not remove models from the index")
+		return 0
+	}
+	if err = api.SearchIndex.Done(entries); err != nil {
+		log.WithField("err", err).Error("Could not take indexed models off the queue")
+	}
+	return len(entries)
+}
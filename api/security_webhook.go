@@ -0,0 +1,165 @@
+package api
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/blobstorage"
+	"github.com/ericflo/gradientzoo/models"
+)
+
+// The events posted to users' webhooks.  Most are about security, but it's
+// the one webhook an account has, so owners hear about their models there too.
+const (
+	WEBHOOK_LOGIN_NEW_LOCATION  = "auth.login_new_location"
+	WEBHOOK_TOKEN_CREATED       = "auth.token_created"
+	WEBHOOK_TWO_FACTOR_DISABLED = "auth.two_factor_disabled"
+	WEBHOOK_TEST                = "auth.test"
+	WEBHOOK_DOWNLOAD_MILESTONE  = "model.download_milestone"
+	WEBHOOK_DOWNLOAD_SPIKE      = "model.download_spike"
+)
+
+const SIGNATURE_HEADER = "X-Gradientzoo-Signature"
+
+// securityWebhookEvent is the webhook event for an audited action, if there
+// is one.  Sign ins only count when they're from an IP address the user
+// hasn't signed in from before, which has to be checked before the sign in
+// itself is recorded.
+func securityWebhookEvent(c *Context, action, ownerId, ip string) string {
+	switch action {
+	case models.AUDIT_TOKEN_CREATE:
+		return WEBHOOK_TOKEN_CREATED
+	case models.AUDIT_TWO_FACTOR_DISABLE:
+		return WEBHOOK_TWO_FACTOR_DISABLED
+	case models.AUDIT_LOGIN:
+		seen, err := c.Api.AuditEvent.SeenIp(ownerId, models.AUDIT_LOGIN, ip)
+		if err != nil {
+			c.Log().WithFields(log.Fields{
+				"err":     err,
+				"user_id": ownerId,
+			}).Error("Could not look up previous sign ins")
+			return ""
+		}
+		if !seen {
+			return WEBHOOK_LOGIN_NEW_LOCATION
+		}
+	}
+	return ""
+}
+
+// signWebhook signs the body the way Stripe does, including the time so that
+// a captured delivery can't be replayed later on.  Receivers compute the
+// HMAC-SHA256 of "<t>.<body>" with their secret and compare it to v1.
+func signWebhook(secret string, body []byte, t time.Time) string {
+	ts := strconv.FormatInt(t.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts + "."))
+	mac.Write(body)
+	return fmt.Sprintf("t=%s,v1=%s", ts, hex.EncodeToString(mac.Sum(nil)))
+}
+
+// deliverSecurityWebhook posts the event to the hook and records how it went.
+// It returns the HTTP status, or 0 if the request couldn't be made at all.
+func deliverSecurityWebhook(api *models.ApiCollection, hook *models.SecurityWebhook, event string, e *models.AuditEvent) int {
+	clog := log.WithFields(log.Fields{
+		"user_id":             hook.UserId,
+		"security_webhook_id": hook.Id,
+		"event":               event,
+	})
+
+	body, _ := json.Marshal(map[string]interface{}{
+		"id":           e.Id,
+		"event":        event,
+		"user_id":      hook.UserId,
+		"ip":           e.Ip,
+		"user_agent":   e.UserAgent,
+		"details":      e.Details,
+		"created_time": e.CreatedTime,
+	})
+	now := time.Now().UTC()
+	status := 0
+	req, err := http.NewRequest("POST", hook.Url, bytes.NewReader(body))
+	if err == nil {
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(SIGNATURE_HEADER, signWebhook(hook.Secret, body, now))
+		var resp *http.Response
+		if resp, err = webhookClient.Do(req); err == nil {
+			resp.Body.Close()
+			status = resp.StatusCode
+		}
+	}
+	if err != nil {
+		clog.WithField("err", err).Info("Could not send security webhook")
+	} else if status >= 300 {
+		clog.WithField("status", status).Info("Security webhook was rejected")
+	}
+	if err = api.SecurityWebhook.MarkDelivery(hook.Id, status, now); err != nil {
+		clog.WithField("err", err).Error("Could not record security webhook delivery")
+	}
+	return status
+}
+
+// securityWebhookPayload is what a job to deliver a webhook event needs.
+type securityWebhookPayload struct {
+	UserId     string             `json:"user_id"`
+	Event      string             `json:"event"`
+	AuditEvent *models.AuditEvent `json:"audit_event"`
+}
+
+// sendSecurityWebhook queues the event to be posted to the user's webhook, if
+// they have one.  Deliveries that fail are retried for a while, in case the
+// receiver's down.
+func sendSecurityWebhook(api *models.ApiCollection, userId, event string, e *models.AuditEvent) {
+	clog := log.WithFields(log.Fields{"user_id": userId, "event": event})
+
+	_, err := api.SecurityWebhook.ByUserId(userId)
+	if err == sql.ErrNoRows {
+		return
+	}
+	if err != nil {
+		clog.WithField("err", err).Error("Could not look up security webhook")
+		return
+	}
+	_, err = enqueueJob(api, JOB_SECURITY_WEBHOOK, userId, &securityWebhookPayload{
+		UserId:     userId,
+		Event:      event,
+		AuditEvent: e,
+	})
+	if err != nil {
+		clog.WithField("err", err).Error("Could not queue security webhook")
+	}
+}
+
+// runSecurityWebhookJob posts the job's event to the user's webhook, as it is
+// now.  Receivers that can't be reached, or have trouble of their own, get it
+// again later; ones that reject it don't.
+func runSecurityWebhookJob(api *models.ApiCollection, blob blobstorage.BlobStorage, job *models.Job) error {
+	var payload securityWebhookPayload
+	if err := job.Decode(&payload); err != nil {
+		return err
+	}
+	hook, err := api.SecurityWebhook.ByUserId(payload.UserId)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	status := deliverSecurityWebhook(api, hook, payload.Event, payload.AuditEvent)
+	if status == 0 {
+		return fmt.Errorf("Could not reach the webhook")
+	}
+	if status >= 500 || status == http.StatusTooManyRequests {
+		return fmt.Errorf("The webhook responded with %d", status)
+	}
+	return nil
+}
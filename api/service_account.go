@@ -0,0 +1,65 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/models"
+)
+
+// canManageServiceAccount says whether user made the service account, or owns
+// the organization it belongs to.
+func canManageServiceAccount(api *models.ApiCollection, user, service *models.User) (bool, error) {
+	if !service.IsService() {
+		return false, nil
+	}
+	if service.ServiceOwnerId.String == user.Id {
+		return true, nil
+	}
+	if !service.ServiceOrgId.Valid {
+		return false, nil
+	}
+	org, err := api.Organization.ById(service.ServiceOrgId.String)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return org.OwnerId == user.Id, nil
+}
+
+// serviceAccountFor looks up the service account with the given id, if the
+// signed in user can manage it.  If not, it responds with why and returns nil.
+func serviceAccountFor(c *Context, w http.ResponseWriter, id string) *models.User {
+	clog := c.Log().WithFields(log.Fields{
+		"user_id":            c.User.Id,
+		"service_account_id": id,
+	})
+
+	service, err := c.Api.User.ById(id)
+	if err != nil && err != sql.ErrNoRows {
+		clog.WithField("err", err).Error("Could not look up service account")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not get that service account, please try again soon"))
+		return nil
+	}
+	ok := false
+	if service != nil {
+		if ok, err = canManageServiceAccount(c.Api, c.User, service); err != nil {
+			clog.WithField("err", err).Error("Could not look up organization")
+			c.Render.JSON(w, http.StatusBadGateway,
+				ApiErr(ERR_UNAVAILABLE, "Could not get that service account, please try again soon"))
+			return nil
+		}
+	}
+	// Accounts the user can't manage are reported as missing, so that this
+	// can't be used to tell which users are service accounts
+	if !ok {
+		c.Render.JSON(w, http.StatusNotFound,
+			ApiErr(ERR_NOT_FOUND, "There is no service account with that id"))
+		return nil
+	}
+	return service
+}
@@ -0,0 +1,114 @@
+package api
+
+import (
+	"crypto/hmac"
+	"net/http"
+	"time"
+
+	"github.com/ericflo/gradientzoo/models"
+	"github.com/ericflo/gradientzoo/utils"
+)
+
+// Browser sessions keep the session and refresh tokens in HTTP-only cookies,
+// so that scripts on the page (including injected ones) can't read them.
+// Anything other than a GET then has to send the CSRF token in a header,
+// which a page on another site has no way of knowing.
+const (
+	SESSION_COOKIE = "gz_session"
+	REFRESH_COOKIE = "gz_refresh"
+	CSRF_COOKIE    = "gz_csrf"
+
+	SESSION_MODE_HEADER = "X-Session-Mode"
+	CSRF_HEADER         = "X-CSRF-Token"
+)
+
+// cookieMode says whether the client asked for a browser session, instead of
+// being handed the tokens to send as headers itself.
+func cookieMode(req *http.Request) bool {
+	return req.Header.Get(SESSION_MODE_HEADER) == "cookie"
+}
+
+// csrfSafe says whether the request can't change anything, so doesn't need a
+// CSRF token.
+func csrfSafe(req *http.Request) bool {
+	return req.Method == "GET" || req.Method == "HEAD" || req.Method == "OPTIONS"
+}
+
+func checkCsrf(req *http.Request, sessionId string) bool {
+	sent := req.Header.Get(CSRF_HEADER)
+	return sent != "" && hmac.Equal([]byte(sent), []byte(utils.CsrfToken(sessionId)))
+}
+
+// setCookie sets the cookie with our SameSite mode, written out by hand since
+// http.Cookie doesn't know about SameSite.
+func setCookie(w http.ResponseWriter, cookie *http.Cookie) {
+	cookie.Domain = utils.Conf.CookieDomain
+	cookie.Secure = utils.Conf.Production
+	value := cookie.String()
+	if utils.Conf.CookieSameSite != "" {
+		value += "; SameSite=" + utils.Conf.CookieSameSite
+	}
+	w.Header().Add("Set-Cookie", value)
+}
+
+func setSessionCookies(w http.ResponseWriter, authToken *models.AuthToken, refreshToken *models.RefreshToken) {
+	setCookie(w, &http.Cookie{
+		Name:     SESSION_COOKIE,
+		Value:    authToken.Id,
+		Path:     "/",
+		Expires:  refreshToken.ExpiresTime,
+		HttpOnly: true,
+	})
+	// The refresh token is only ever needed to refresh or log out
+	setCookie(w, &http.Cookie{
+		Name:     REFRESH_COOKIE,
+		Value:    refreshToken.Id,
+		Path:     "/auth",
+		Expires:  refreshToken.ExpiresTime,
+		HttpOnly: true,
+	})
+	// Unlike the others, the page has to be able to read this one
+	setCookie(w, &http.Cookie{
+		Name:    CSRF_COOKIE,
+		Value:   utils.CsrfToken(authToken.Id),
+		Path:    "/",
+		Expires: refreshToken.ExpiresTime,
+	})
+}
+
+func clearSessionCookies(w http.ResponseWriter) {
+	expired := time.Unix(0, 0)
+	for name, path := range map[string]string{
+		SESSION_COOKIE: "/",
+		REFRESH_COOKIE: "/auth",
+		CSRF_COOKIE:    "/",
+	} {
+		setCookie(w, &http.Cookie{
+			Name:     name,
+			Value:    "",
+			Path:     path,
+			Expires:  expired,
+			MaxAge:   -1,
+			HttpOnly: name != CSRF_COOKIE,
+		})
+	}
+}
+
+// sessionRespond hands a newly started session to the client: as cookies for
+// browser sessions, or in the response for everyone else.  The user is left
+// out of the response if it's nil, e.g. when refreshing.
+func sessionRespond(c *Context, w http.ResponseWriter, req *http.Request, user *models.User, authToken *models.AuthToken, refreshToken *models.RefreshToken) {
+	resp := map[string]interface{}{}
+	if user != nil {
+		resp["auth_user"] = user
+	}
+	if cookieMode(req) {
+		setSessionCookies(w, authToken, refreshToken)
+		resp["csrf_token"] = utils.CsrfToken(authToken.Id)
+		resp["expires_time"] = authToken.ExpiresTime
+	} else {
+		resp["auth_token"] = authToken
+		resp["refresh_token"] = refreshToken
+	}
+	c.Render.JSON(w, http.StatusOK, resp)
+}
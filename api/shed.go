@@ -0,0 +1,58 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ericflo/gradientzoo/metrics"
+	"github.com/ericflo/gradientzoo/ratelimit"
+	"github.com/ericflo/gradientzoo/utils"
+	runner "gopkg.in/mgutz/dat.v1/sqlx-runner"
+)
+
+// shedder never sheds until Main sets it up
+var shedder = ratelimit.NewShedder(func() int { return 0 })
+
+var shedRequests = metrics.NewCounter("gradientzoo_http_requests_shed_total",
+	"Requests turned away while the server was overloaded, by why it was.", "reason")
+
+// newShedder makes the shedder the config asks for, which follows it as it's
+// reloaded.
+func newShedder(db *runner.DB) *ratelimit.Shedder {
+	maxInFlight := func() int {
+		return utils.Live().ShedInFlight
+	}
+	maxBytes := func() uint64 {
+		return uint64(utils.Live().ShedMemoryMB) << 20
+	}
+	// Connections past the idle limit are closed as soon as they're put back,
+	// so once every connection the pool may open is open, nearly all of them
+	// are in use, and queries start queueing for one
+	dbPool := func() string {
+		if utils.Live().ShedDbPool && db.DB.Stats().OpenConnections >= utils.Conf.PostgresqlMaxOpenConns {
+			return "db_pool"
+		}
+		return ""
+	}
+	return ratelimit.NewShedder(maxInFlight, ratelimit.MemoryCheck(maxBytes, time.Second), dbPool)
+}
+
+// Shed turns requests to the handler away with a 503 while the server is
+// overloaded, so that it can keep up with the rest.  It's for requests that
+// are cheap to retry and can wait, like listings and stats, never for
+// uploads or downloads.
+func Shed(h Handler) Handler {
+	return Handler(func(c *Context, w http.ResponseWriter, req *http.Request) {
+		if reason := shedder.Overloaded(); reason != "" {
+			// Not logged, since there'd be a flood of them just when the
+			// server can least afford it; the request log has the 503s
+			shedRequests.Inc(reason)
+			w.Header().Set("Retry-After", strconv.Itoa(utils.Live().ShedRetryAfterSeconds))
+			c.Render.JSON(w, http.StatusServiceUnavailable,
+				ApiErr(ERR_UNAVAILABLE, "The server is busy, please try again in a little while"))
+			return
+		}
+		h(c, w, req)
+	})
+}
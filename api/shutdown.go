@@ -0,0 +1,139 @@
+package api
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/models"
+	"github.com/ericflo/gradientzoo/utils"
+)
+
+// When the server is told to stop, it fails its health check for a while so
+// that the load balancer stops sending it anything new, then stops accepting
+// connections and waits for the requests it's in the middle of, which can be
+// multi-GB uploads and downloads, to finish.  Then it finishes off the work it
+// was doing in the background, like webhooks and buffered download counts,
+// and exits.  All of that has to fit in ShutdownTimeoutSeconds, after which
+// whatever is left is cut off.
+
+// Set once the server has been told to stop
+var shuttingDown int32
+
+func ShuttingDown() bool {
+	return atomic.LoadInt32(&shuttingDown) == 1
+}
+
+// background counts goroutines doing work for requests that have otherwise
+// finished, and jobs being run, which a shutdown waits for.  Nothing more is
+// counted once the shutdown has started waiting, since a WaitGroup can't be
+// added to while it's being waited on.
+var (
+	background       sync.WaitGroup
+	backgroundMu     sync.Mutex
+	backgroundClosed bool
+)
+
+// startBackground counts the caller as doing background work, which it has to
+// mark done with background.Done, or returns false if the shutdown is no
+// longer waiting for any more.
+func startBackground() bool {
+	backgroundMu.Lock()
+	defer backgroundMu.Unlock()
+	if backgroundClosed {
+		return false
+	}
+	background.Add(1)
+	return true
+}
+
+// waitBackground stops any more background work from being started, then
+// waits for what's already going, or until the deadline, and says whether it
+// all finished.
+func waitBackground(deadline time.Time) bool {
+	backgroundMu.Lock()
+	backgroundClosed = true
+	backgroundMu.Unlock()
+	return waitTimeout(&background, deadline)
+}
+
+// goBackground runs f in its own goroutine, which a shutdown waits for.  Once
+// the shutdown has stopped waiting, f still runs, but is cut off if it hasn't
+// finished by the time the server exits.
+func goBackground(f func()) {
+	if !startBackground() {
+		go f()
+		return
+	}
+	go func() {
+		defer background.Done()
+		f()
+	}()
+}
+
+// waitTimeout waits for the group, or until the deadline, and says whether
+// the group finished.
+func waitTimeout(wg *sync.WaitGroup, deadline time.Time) bool {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(deadline.Sub(time.Now())):
+		return false
+	}
+}
+
+// serve serves the handler until the server is told to stop, and then shuts
+// it down gracefully.
+func serve(api *models.ApiCollection, handler http.Handler) {
+	listener, err := net.Listen("tcp", ":"+utils.Conf.Port)
+	if err != nil {
+		log.WithField("err", err).Fatal("Could not listen")
+	}
+	server := &http.Server{Handler: handler}
+	go func() {
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			log.WithField("err", err).Fatal("Could not serve")
+		}
+	}()
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	sig := <-stop
+	atomic.StoreInt32(&shuttingDown, 1)
+	deadline := time.Now().Add(time.Duration(utils.Conf.ShutdownTimeoutSeconds) * time.Second)
+	log.WithField("signal", sig.String()).Info("Shutting down")
+
+	// Keep serving while the load balancer notices the failing health check
+	time.Sleep(time.Duration(utils.Conf.ShutdownDrainSeconds) * time.Second)
+
+	// Stop taking new connections, and close the ones that are left once
+	// they've finished their requests
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		server.Close()
+		log.Warn("Cut off requests that were still going at the shutdown deadline")
+	}
+
+	// No more requests are being handled, so the only background work left
+	// to start is jobs, which the workers stop claiming from here on
+	if !waitBackground(deadline) {
+		log.Warn("Cut off background work that was still going at the shutdown deadline")
+	}
+
+	// Now that nothing else can be downloaded, write out what was
+	flushDownloadsOnce(api)
+	log.Info("Shut down")
+}
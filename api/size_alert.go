@@ -0,0 +1,125 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/mailer"
+	"github.com/ericflo/gradientzoo/models"
+)
+
+var webhookClient = &http.Client{Timeout: 10 * time.Second}
+
+// sizeChangePercent works out how much newSize differs from oldSize, as a
+// percentage of oldSize.  Growing from nothing counts as an infinite change.
+func sizeChangePercent(oldSize, newSize int64) float64 {
+	if oldSize == 0 {
+		if newSize == 0 {
+			return 0
+		}
+		return math.Inf(1)
+	}
+	return float64(newSize-oldSize) / float64(oldSize) * 100
+}
+
+// checkFileSize compares a newly committed file's size against the previous
+// version of the same filename, and sends out the alerts configured in its
+// file policy if the size changed by more than the policy allows.  It's meant
+// to be run in its own goroutine so that uploads don't wait on webhooks or
+// mail servers.
+func checkFileSize(api *models.ApiCollection, mail mailer.Mailer, m *models.Model, owner *models.User, f *models.File) {
+	clog := log.WithFields(log.Fields{
+		"file_id":       f.Id,
+		"file_model_id": m.Id,
+		"filename":      f.Filename,
+	})
+
+	defer func() {
+		if rec := recover(); rec != nil {
+			clog.WithField("err", rec).Error("Panic while checking file size")
+		}
+	}()
+
+	policy, err := api.FilePolicy.ByModelIdFilename(m.Id, f.Filename)
+	if err != nil || policy == nil || policy.SizeAlertPercent <= 0 {
+		return
+	}
+	if policy.SizeAlertWebhook == "" && !policy.SizeAlertEmail {
+		return
+	}
+
+	// The log still has the sizes of versions that have been pruned
+	entries, err := api.FileLog.ByModelIdFilename(m.Id, f.Filename)
+	if err != nil {
+		clog.WithField("err", err).Error("Could not look up file size history")
+		return
+	}
+	var prev *models.FileLogEntry
+	for i, e := range entries {
+		if e.FileId == f.Id && i > 0 {
+			prev = entries[i-1]
+		}
+	}
+	if prev == nil {
+		return
+	}
+
+	change := sizeChangePercent(prev.SizeBytes, int64(f.SizeBytes))
+	if math.Abs(change) <= float64(policy.SizeAlertPercent) {
+		return
+	}
+
+	clog = clog.WithFields(log.Fields{
+		"previous_size_bytes": prev.SizeBytes,
+		"size_bytes":          f.SizeBytes,
+		"change_pct":          change,
+	})
+
+	if policy.SizeAlertWebhook != "" {
+		payload := map[string]interface{}{
+			"event":               "file.size_alert",
+			"username":            owner.Username,
+			"slug":                m.Slug,
+			"filename":            f.Filename,
+			"file_id":             f.Id,
+			"previous_file_id":    prev.FileId,
+			"size_bytes":          f.SizeBytes,
+			"previous_size_bytes": prev.SizeBytes,
+			"threshold_pct":       policy.SizeAlertPercent,
+		}
+		// JSON has no way to represent infinity
+		if !math.IsInf(change, 0) {
+			payload["change_pct"] = change
+		}
+		body, _ := json.Marshal(payload)
+		resp, err := webhookClient.Post(policy.SizeAlertWebhook,
+			"application/json", bytes.NewReader(body))
+		if err != nil {
+			clog.WithField("err", err).Info("Could not send size alert webhook")
+		} else {
+			resp.Body.Close()
+			if resp.StatusCode >= 300 {
+				clog.WithField("status", resp.StatusCode).Info("Size alert webhook was rejected")
+			}
+		}
+	}
+
+	if policy.SizeAlertEmail && owner.Email != "" {
+		subject := fmt.Sprintf("%s/%s: %s changed size", owner.Username, m.Slug, f.Filename)
+		body := fmt.Sprintf(
+			"The latest version of %s in %s/%s is %d bytes, compared to %d bytes "+
+				"for the version before it. Your size alert is set to %d%%.\n",
+			f.Filename, owner.Username, m.Slug, f.SizeBytes, prev.SizeBytes,
+			policy.SizeAlertPercent)
+		if err = mail.Send(owner.Email, subject, body); err != nil {
+			clog.WithField("err", err).Info("Could not send size alert e-mail")
+		}
+	}
+
+	clog.Info("Size alert sent")
+}
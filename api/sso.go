@@ -0,0 +1,91 @@
+package api
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/ericflo/gradientzoo/models"
+)
+
+// ssoDiscover fills in a connection's endpoints from its issuer's OpenID
+// Connect discovery document.
+func ssoDiscover(conn *models.SsoConnection) error {
+	var config struct {
+		Issuer                string `json:"issuer"`
+		AuthorizationEndpoint string `json:"authorization_endpoint"`
+		TokenEndpoint         string `json:"token_endpoint"`
+		UserinfoEndpoint      string `json:"userinfo_endpoint"`
+	}
+	u := strings.TrimRight(conn.Issuer, "/") + "/.well-known/openid-configuration"
+	if err := oauthGet(u, "", &config); err != nil {
+		return err
+	}
+	if config.AuthorizationEndpoint == "" || config.TokenEndpoint == "" ||
+		config.UserinfoEndpoint == "" {
+		return errors.New("Discovery document is missing endpoints")
+	}
+	conn.AuthUrl = config.AuthorizationEndpoint
+	conn.TokenUrl = config.TokenEndpoint
+	conn.UserinfoUrl = config.UserinfoEndpoint
+	return nil
+}
+
+// ssoProvider is the oauth provider for signing in through conn.  All
+// connections share one callback, since the state says which one it was.
+func ssoProvider(conn *models.SsoConnection) *oauthProvider {
+	return &oauthProvider{
+		Name:         conn.Provider(),
+		CallbackName: "sso",
+		AuthUrl:      conn.AuthUrl,
+		TokenUrl:     conn.TokenUrl,
+		Scope:        "openid email profile",
+		ClientId:     conn.ClientId,
+		ClientSecret: conn.ClientSecret,
+		Profile: func(accessToken string) (*oauthProfile, error) {
+			return ssoProfile(conn, accessToken)
+		},
+	}
+}
+
+func ssoProfile(conn *models.SsoConnection, accessToken string) (*oauthProfile, error) {
+	claims := map[string]interface{}{}
+	if err := oauthGet(conn.UserinfoUrl, "Bearer "+accessToken, &claims); err != nil {
+		return nil, err
+	}
+	sub, _ := claims["sub"].(string)
+	if sub == "" {
+		return nil, errors.New("No subject in userinfo response")
+	}
+	profile := &oauthProfile{Id: sub, Claims: claims}
+
+	// Only trust addresses in the connection's own domain, and if the provider
+	// says whether they're verified, only verified ones
+	email, _ := claims["email"].(string)
+	verified, ok := claims["email_verified"].(bool)
+	if models.EmailDomain(email) == conn.Domain && (!ok || verified) {
+		profile.Email = email
+		profile.Username = strings.SplitN(email, "@", 2)[0]
+	}
+	if name, _ := claims["preferred_username"].(string); name != "" {
+		profile.Username = name
+	}
+	return profile, nil
+}
+
+// ssoClaimValues reads a role claim, which providers send either as a single
+// string or as a list of them.
+func ssoClaimValues(claims map[string]interface{}, claim string) []string {
+	switch v := claims[claim].(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		values := []string{}
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return []string{}
+}
@@ -0,0 +1,60 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/ericflo/gradientzoo/models"
+)
+
+// The widest range that can be asked for at each granularity, so that a
+// single chart can't turn into tens of thousands of points
+var maxStatsRange = map[string]time.Duration{
+	models.GRANULARITY_HOUR: 7 * 24 * time.Hour,
+	models.GRANULARITY_DAY:  366 * 24 * time.Hour,
+}
+
+// And how far back the range goes when no start is given
+var defaultStatsRange = map[string]time.Duration{
+	models.GRANULARITY_HOUR: 24 * time.Hour,
+	models.GRANULARITY_DAY:  30 * 24 * time.Hour,
+}
+
+// statsGranularity checks the granularity query param of the series stats
+// handlers, which defaults to day.  It responds and returns false if it isn't
+// one we know.
+func statsGranularity(c *Context, w http.ResponseWriter, granularity string) (string, bool) {
+	if granularity == "" {
+		granularity = models.GRANULARITY_DAY
+	}
+	v := NewValidator()
+	v.Field("granularity", "Granularity").OneOf(granularity, models.GRANULARITY_HOUR,
+		models.GRANULARITY_DAY)
+	return granularity, !v.Refuse(c, w)
+}
+
+// cachedStats looks up stats of a kind for the model in the stats cache,
+// keyed by the granularity and the range as the request gave it.  The range
+// slides along with now unless the request fixed its end.
+func cachedStats(req *http.Request, kind, modelId, granularity string, start, end time.Time, fetch statsFetch) (*statsEntry, error) {
+	q := req.URL.Query()
+	key := statsKey(kind, modelId, granularity, q.Get("start"), q.Get("end"))
+	return modelStats.Get(key, start, end, q.Get("end") == "", fetch)
+}
+
+// statsRange reads the start and end query params of the stats handlers,
+// which default to the defaultRange up to now and can be at most maxRange
+// apart.  It responds and returns false if they aren't valid.
+func statsRange(c *Context, w http.ResponseWriter, req *http.Request, defaultRange, maxRange time.Duration) (time.Time, time.Time, bool) {
+	v := NewValidator()
+	end := time.Now().UTC()
+	v.Field("end", "End").Time(req.URL.Query().Get("end"), &end)
+	start := end.Add(-defaultRange)
+	v.Field("start", "Start").Time(req.URL.Query().Get("start"), &start)
+	if v.Valid() {
+		v.Field("start", "Start").
+			Check(start.Before(end), "must be before end").
+			Check(end.Sub(start) <= maxRange, "is too long before end, ask for a shorter range")
+	}
+	return start, end, !v.Refuse(c, w)
+}
@@ -0,0 +1,144 @@
+package api
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// Cached stats are served as they are for statsFreshTTL.  After that they're
+// still served for up to statsStaleTTL, but the first request to see them stale
+// has them worked out again in the background, so a dashboard being reloaded
+// over and over only ever costs one aggregation query every so often.
+const (
+	statsFreshTTL = 1 * time.Minute
+	statsStaleTTL = 10 * time.Minute
+)
+
+// Past this many entries, entries too old to be served are dropped, and then
+// arbitrary ones if that's not enough
+const statsCacheSize = 10000
+
+var modelStats = &statsCache{entries: map[string]*statsEntry{}}
+
+// statsFetch works out stats over a range.  It runs in the background when
+// stale stats are refreshed, so it mustn't touch the request.
+type statsFetch func(start, end time.Time) (interface{}, error)
+
+// statsEntry is one set of cached stats and the range they cover
+type statsEntry struct {
+	Value    interface{}
+	Start    time.Time
+	End      time.Time
+	Computed time.Time
+
+	// Whether the range follows now along, rather than being fixed
+	sliding    bool
+	refreshing bool
+}
+
+// statsCache keeps stats in memory by model, kind, granularity and range.
+// Whoever's asking has to be allowed to see the model before they get here,
+// since nothing in the cache is checked again.
+type statsCache struct {
+	mu      sync.Mutex
+	entries map[string]*statsEntry
+}
+
+// statsKey is what the stats are cached under.  The range is taken from the
+// query as it was given, so that every request for the default range shares
+// one entry rather than each getting its own up to the second.
+func statsKey(kind, modelId, granularity, startParam, endParam string) string {
+	return strings.Join([]string{kind, modelId, granularity, startParam, endParam}, "|")
+}
+
+// Get returns the stats under key, fetching them over start to end if they
+// aren't cached or are too stale to serve.  When the range is sliding it's
+// moved up to now whenever they're fetched again.
+func (s *statsCache) Get(key string, start, end time.Time, sliding bool, fetch statsFetch) (*statsEntry, error) {
+	s.mu.Lock()
+	e, ok := s.entries[key]
+	if ok {
+		age := time.Since(e.Computed)
+		if age < statsFreshTTL {
+			s.mu.Unlock()
+			return e, nil
+		}
+		if age < statsStaleTTL {
+			if !e.refreshing {
+				e.refreshing = true
+				go s.refresh(key, e, fetch)
+			}
+			s.mu.Unlock()
+			return e, nil
+		}
+	}
+	s.mu.Unlock()
+
+	value, err := fetch(start, end)
+	if err != nil {
+		return nil, err
+	}
+	e = &statsEntry{
+		Value:    value,
+		Start:    start,
+		End:      end,
+		Computed: time.Now().UTC(),
+		sliding:  sliding,
+	}
+	s.put(key, e)
+	return e, nil
+}
+
+func (s *statsCache) refresh(key string, old *statsEntry, fetch statsFetch) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			log.WithFields(log.Fields{"key": key, "err": rec}).Error(
+				"Panic while refreshing stats")
+		}
+	}()
+
+	start, end := old.Start, old.End
+	if old.sliding {
+		end = time.Now().UTC()
+		start = end.Add(-old.End.Sub(old.Start))
+	}
+	value, err := fetch(start, end)
+	if err != nil {
+		log.WithFields(log.Fields{"key": key, "err": err}).Error(
+			"Could not refresh stats")
+		// Let the next request try again
+		s.mu.Lock()
+		old.refreshing = false
+		s.mu.Unlock()
+		return
+	}
+	s.put(key, &statsEntry{
+		Value:    value,
+		Start:    start,
+		End:      end,
+		Computed: time.Now().UTC(),
+		sliding:  old.sliding,
+	})
+}
+
+func (s *statsCache) put(key string, e *statsEntry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.entries[key]; !ok && len(s.entries) >= statsCacheSize {
+		for k, old := range s.entries {
+			if time.Since(old.Computed) >= statsStaleTTL {
+				delete(s.entries, k)
+			}
+		}
+		for k := range s.entries {
+			if len(s.entries) < statsCacheSize {
+				break
+			}
+			delete(s.entries, k)
+		}
+	}
+	s.entries[key] = e
+}
@@ -0,0 +1,53 @@
+package api
+
+import (
+	"strconv"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/models"
+	"github.com/ericflo/gradientzoo/utils"
+)
+
+const trendingInterval = time.Hour
+
+// computeTrending runs forever, working out trending scores.  It's meant to
+// be run in its own goroutine.
+func computeTrending(api *models.ApiCollection) {
+	for {
+		computeTrendingOnce(api)
+		time.Sleep(trendingInterval)
+	}
+}
+
+func computeTrendingOnce(api *models.ApiCollection) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			log.WithField("err", rec).Error("Panic while computing trending models")
+		}
+	}()
+
+	anonymousWeight := float64(utils.Conf.TrendingAnonymousPercent) / 100
+	if err := api.ModelTrending.Recompute(anonymousWeight); err != nil {
+		log.WithField("err", err).Error("Could not compute trending models")
+	}
+}
+
+// Trending cursors start after the score and id of the last model on a page
+func trendingCursor(m *models.TrendingModel) string {
+	return encodeCursor("trending", &models.PageKey{
+		Keys: []string{strconv.FormatFloat(m.Score, 'g', -1, 64)},
+		Id:   m.Id,
+	})
+}
+
+func trendingAfter(key *models.PageKey) (float64, string, error) {
+	if len(key.Keys) != 1 || key.Id == "" {
+		return 0, "", errBadCursor
+	}
+	score, err := strconv.ParseFloat(key.Keys[0], 64)
+	if err != nil {
+		return 0, "", errBadCursor
+	}
+	return score, key.Id, nil
+}
@@ -0,0 +1,39 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/models"
+	"github.com/ericflo/gradientzoo/utils"
+)
+
+const totpIssuer = "Gradientzoo"
+
+// checkSecondFactor checks code against the user's authenticator app, or
+// failing that against their unused backup codes.  Either way the code is
+// used up, so it can't be used again.
+func checkSecondFactor(c *Context, user *models.User, code string) (bool, error) {
+	if counter := utils.CheckTotp(user.TotpSecret, code, time.Now()); counter >= 0 {
+		return c.Api.User.UseTotpCounter(user.Id, counter)
+	}
+	return c.Api.BackupCode.Use(user.Id, code)
+}
+
+// pendingRespond hands a user who has passed their first factor a pending
+// token, which HandleVerifyTwoFactor trades in for a session along with their
+// code.
+func pendingRespond(c *Context, w http.ResponseWriter, clog *log.Entry, user *models.User) {
+	pendingAuthToken := models.NewPendingAuthToken(user.Id)
+	if err := c.Api.AuthToken.Save(pendingAuthToken); err != nil {
+		clog.WithField("err", err).Error("Could not save pending auth token")
+		c.Render.JSON(w, http.StatusBadGateway,
+			ApiErr(ERR_UNAVAILABLE, "Could not log you in, please try again soon"))
+		return
+	}
+	c.Render.JSON(w, http.StatusOK, map[string]interface{}{
+		"two_factor_required": true,
+		"pending_auth_token":  pendingAuthToken,
+	})
+}
@@ -0,0 +1,190 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// FieldError is what's wrong with one field of a request.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Validator collects everything that's wrong with a request, so that it can
+// all be sent back at once, instead of one problem per try:
+//
+//	v := NewValidator()
+//	v.Field("slug", "Slug").MinLength(form.Slug, 3).Matches(form.Slug, SlugReg,
+//		"can contain only letters, numbers, and underscore")
+//	v.Field("visibility", "Visibility").OneOf(form.Visibility, "public", "private")
+//	if v.Refuse(c, w) {
+//		return
+//	}
+//
+// Only the first problem with each field is kept.
+type Validator struct {
+	Errors []*FieldError
+	fields map[string]bool
+}
+
+func NewValidator() *Validator {
+	return &Validator{fields: map[string]bool{}}
+}
+
+// Field starts the checks for one field, whose messages start with label.
+func (v *Validator) Field(name, label string) *FieldCheck {
+	return &FieldCheck{v: v, name: name, label: label}
+}
+
+// Add records msg against field, unless the field already has a problem.
+func (v *Validator) Add(field, msg string) {
+	if v.fields[field] {
+		return
+	}
+	v.fields[field] = true
+	v.Errors = append(v.Errors, &FieldError{Field: field, Message: msg})
+}
+
+func (v *Validator) Valid() bool {
+	return len(v.Errors) == 0
+}
+
+// Refuse sends a 400 listing every problem found, if there were any, and says
+// whether it did.  The error message is the first problem, for clients that
+// only show one.
+func (v *Validator) Refuse(c *Context, w http.ResponseWriter) bool {
+	if v.Valid() {
+		return false
+	}
+	e := ApiErr(ERR_INVALID_REQUEST, v.Errors[0].Message)
+	e.Fields = v.Errors
+	c.Render.JSON(w, http.StatusBadRequest, e)
+	return true
+}
+
+// FieldCheck checks one field.  Once a check fails, the ones after it are
+// skipped.
+type FieldCheck struct {
+	v     *Validator
+	name  string
+	label string
+}
+
+func (f *FieldCheck) failed() bool {
+	return f.v.fields[f.name]
+}
+
+// Check fails with "<label> <msg>" unless ok.
+func (f *FieldCheck) Check(ok bool, msg string) *FieldCheck {
+	if !ok && !f.failed() {
+		f.v.Add(f.name, f.label+" "+msg)
+	}
+	return f
+}
+
+func (f *FieldCheck) Required(value string) *FieldCheck {
+	return f.Check(value != "", "is required")
+}
+
+// MinLength, MaxLength and Length count characters, not bytes.
+func (f *FieldCheck) MinLength(value string, n int) *FieldCheck {
+	return f.Check(utf8.RuneCountInString(value) >= n,
+		fmt.Sprintf("must be at least %d characters long", n))
+}
+
+func (f *FieldCheck) MaxLength(value string, n int) *FieldCheck {
+	return f.Check(utf8.RuneCountInString(value) <= n,
+		fmt.Sprintf("must be at most %d characters", n))
+}
+
+func (f *FieldCheck) Length(value string, min, max int) *FieldCheck {
+	n := utf8.RuneCountInString(value)
+	return f.Check(n >= min && n <= max,
+		fmt.Sprintf("must be between %d and %d characters long", min, max))
+}
+
+func (f *FieldCheck) Matches(value string, re *regexp.Regexp, msg string) *FieldCheck {
+	return f.Check(re.MatchString(value), msg)
+}
+
+func (f *FieldCheck) OneOf(value string, options ...string) *FieldCheck {
+	for _, option := range options {
+		if value == option {
+			return f
+		}
+	}
+	return f.Check(false, "must be one of '"+strings.Join(options, "', '")+"'")
+}
+
+func (f *FieldCheck) Range(value, min, max int) *FieldCheck {
+	return f.Check(value >= min && value <= max,
+		fmt.Sprintf("must be between %d and %d", min, max))
+}
+
+// MaxItems checks the length n of a list.
+func (f *FieldCheck) MaxItems(n, max int) *FieldCheck {
+	return f.Check(n <= max, fmt.Sprintf("must be %d or fewer", max))
+}
+
+// Email only catches the obvious mistakes; the verification e-mail does the
+// rest.
+func (f *FieldCheck) Email(value string) *FieldCheck {
+	return f.Check(len(value) >= 4 && strings.Contains(value, "@"),
+		"isn't valid")
+}
+
+// WebUrl allows only http and https addresses, which are safe to link to.
+func (f *FieldCheck) WebUrl(value string) *FieldCheck {
+	u, err := url.Parse(value)
+	return f.Check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "",
+		"must be an http:// or https:// address")
+}
+
+// Int parses a query param into n, leaving n as it was if the param is
+// empty.
+func (f *FieldCheck) Int(value string, n *int) *FieldCheck {
+	if value == "" {
+		return f
+	}
+	i, err := strconv.Atoi(value)
+	if err == nil {
+		*n = i
+	}
+	return f.Check(err == nil, "must be a number")
+}
+
+// Time parses a query param into t, leaving t as it was if the param is
+// empty.
+func (f *FieldCheck) Time(value string, t *time.Time) *FieldCheck {
+	if value == "" {
+		return f
+	}
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err == nil {
+		*t = parsed
+	}
+	return f.Check(err == nil, "must be an RFC 3339 time, like 2016-04-01T00:00:00Z")
+}
+
+// decodeForm decodes a JSON body into form, or sends a 400 and says it did.
+// What is the name of the form in the message, e.g. "model".
+func decodeForm(c *Context, w http.ResponseWriter, req *http.Request, clog *log.Entry,
+	what string, form interface{}) bool {
+	if err := json.NewDecoder(req.Body).Decode(form); err != nil {
+		msg := "Could not decode " + what + " form"
+		clog.WithField("err", err).Error(msg)
+		c.Render.JSON(w, http.StatusBadRequest, ApiErr(ERR_INVALID_REQUEST, msg))
+		return false
+	}
+	return true
+}
@@ -0,0 +1,148 @@
+package apitest
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+
+	"github.com/ericflo/gradientzoo/models"
+)
+
+// Response is a response from the API, already read.
+type Response struct {
+	*http.Response
+	Body []byte
+}
+
+// Decode decodes the body as JSON into v, failing the test if it can't.
+func (r *Response) Decode(h *Harness, v interface{}) {
+	if err := json.Unmarshal(r.Body, v); err != nil {
+		h.T.Fatalf("Could not decode %s %s response: %v\n%s",
+			r.Request.Method, r.Request.URL.Path, err, r.Body)
+	}
+}
+
+// Error is the error code the response was sent with, or "" if there wasn't
+// one.
+func (r *Response) Error() string {
+	var e struct {
+		Code string `json:"code"`
+	}
+	json.Unmarshal(r.Body, &e)
+	return e.Code
+}
+
+// Do sends a request to the API as whoever token belongs to, or as nobody if
+// it's nil.  A body that isn't a []byte or an io.Reader is sent as JSON.
+func (h *Harness) Do(token *models.AuthToken, method, path string, body interface{}) *Response {
+	var r io.Reader
+	contentType := ""
+	switch b := body.(type) {
+	case nil:
+	case []byte:
+		r = bytes.NewReader(b)
+	case io.Reader:
+		r = b
+	default:
+		encoded, err := json.Marshal(b)
+		if err != nil {
+			h.T.Fatalf("Could not encode %s %s body: %v", method, path, err)
+		}
+		r = bytes.NewReader(encoded)
+		contentType = "application/json"
+	}
+
+	req, err := http.NewRequest(method, h.Url+path, r)
+	if err != nil {
+		h.T.Fatalf("Could not make %s %s request: %v", method, path, err)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if token != nil {
+		req.Header.Set("X-Auth-Token-Id", token.Id)
+	}
+	return h.send(req)
+}
+
+func (h *Harness) Get(token *models.AuthToken, path string) *Response {
+	return h.Do(token, "GET", path, nil)
+}
+
+func (h *Harness) Post(token *models.AuthToken, path string, body interface{}) *Response {
+	return h.Do(token, "POST", path, body)
+}
+
+// Upload uploads a file the way the clients do, with its metadata.
+func (h *Harness) Upload(token *models.AuthToken, username, slug, framework, filename string,
+	data []byte, metadata map[string]interface{}) *Response {
+	if metadata == nil {
+		metadata = map[string]interface{}{}
+	}
+	encoded, err := json.Marshal(metadata)
+	if err != nil {
+		h.T.Fatalf("Could not encode metadata for %s: %v", filename, err)
+	}
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	mw.WriteField("metadata", string(encoded))
+	part, err := mw.CreateFormFile("file", filename)
+	if err != nil {
+		h.T.Fatalf("Could not make upload of %s: %v", filename, err)
+	}
+	part.Write(data)
+	mw.Close()
+
+	path := "/file/" + username + "/" + slug + "/" + framework + "/" + filename
+	req, err := http.NewRequest("POST", h.Url+path, &body)
+	if err != nil {
+		h.T.Fatalf("Could not make upload of %s: %v", filename, err)
+	}
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	if token != nil {
+		req.Header.Set("X-Auth-Token-Id", token.Id)
+	}
+	return h.send(req)
+}
+
+// Download fetches the latest version of a file, following the URL the API
+// sends back to the blob store, and returns what's in it.  The test fails if
+// either request does.
+func (h *Harness) Download(token *models.AuthToken, username, slug, framework, filename string) []byte {
+	resp := h.Get(token, "/file/"+username+"/"+slug+"/"+framework+"/"+filename)
+	if resp.StatusCode != http.StatusOK {
+		h.T.Fatalf("Could not download %s: %d %s", filename, resp.StatusCode, resp.Body)
+	}
+	var found struct {
+		Url string `json:"url"`
+	}
+	resp.Decode(h, &found)
+
+	blob, err := http.Get(found.Url)
+	if err != nil {
+		h.T.Fatalf("Could not fetch blob of %s: %v", filename, err)
+	}
+	defer blob.Body.Close()
+	data, err := ioutil.ReadAll(blob.Body)
+	if err != nil || blob.StatusCode != http.StatusOK {
+		h.T.Fatalf("Could not fetch blob of %s: %d %v", filename, blob.StatusCode, err)
+	}
+	return data
+}
+
+func (h *Harness) send(req *http.Request) *Response {
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		h.T.Fatalf("Could not send %s %s: %v", req.Method, req.URL.Path, err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		h.T.Fatalf("Could not read %s %s response: %v", req.Method, req.URL.Path, err)
+	}
+	return &Response{Response: resp, Body: body}
+}
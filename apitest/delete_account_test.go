@@ -0,0 +1,137 @@
+package apitest_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ericflo/gradientzoo/apitest"
+	"github.com/ericflo/gradientzoo/models"
+	"gopkg.in/guregu/null.v3"
+)
+
+// TestDeleteAccount deletes a user who's referenced from every table with a
+// foreign key to auth_user, along with others' rows pointing at what they
+// own, and checks that nothing referencing them is left behind.
+func TestDeleteAccount(t *testing.T) {
+	h := apitest.Start(t)
+	defer h.Close()
+
+	ada, _ := h.User("ada")
+	grace, _ := h.User("grace")
+	m := h.Model(ada, "mnist")
+	f := h.File(m, "keras", "model.h5", []byte("weights"))
+	other := h.Model(grace, "cifar")
+	otherFile := h.File(other, "keras", "model.h5", []byte("other weights"))
+	now := time.Now().UTC()
+
+	must := func(what string, err error) {
+		if err != nil {
+			t.Fatalf("Could not %s: %v", what, err)
+		}
+	}
+
+	must("save impersonation token", h.Api.AuthToken.Save(models.NewImpersonationToken(grace.Id, ada.Id)))
+	must("mark download", h.Api.DownloadHour.MarkDownload(f.Id, grace.Id, "127.0.0.1", true, now))
+	must("mark download", h.Api.DownloadHour.MarkDownload(otherFile.Id, ada.Id, "127.0.0.1", true, now))
+	_, _, err := h.Api.File.UpdateMetadata(otherFile.Id, ada.Id, map[string]interface{}{"epoch": 1})
+	must("update metadata", err)
+	q := models.NewFileQuarantine(otherFile, models.QUARANTINE_REASON_OTHER, "", ada.Id)
+	_, err = h.Api.FileQuarantine.Record(q, ada.Id, models.QUARANTINE_ACTION_QUARANTINE, "")
+	must("quarantine file", err)
+	must("save refresh token", h.Api.RefreshToken.Save(models.NewRefreshToken(ada.Id)))
+	must("save identity", h.Api.UserIdentity.Save(models.NewUserIdentity(ada.Id, "github", "1", ada.Email)))
+	must("save oauth state", h.Api.UserIdentity.SaveState(models.NewOAuthState("github", ada.Id)))
+	_, err = h.Api.BackupCode.Generate(ada.Id)
+	must("generate backup codes", err)
+
+	org := models.NewOrganization("Ada's Lab", ada.Id)
+	must("save organization", h.Api.Organization.Save(org))
+	must("add member", h.Api.Organization.AddMember(org.Id, grace.Id))
+	otherOrg := models.NewOrganization("Grace's Lab", grace.Id)
+	must("save organization", h.Api.Organization.Save(otherOrg))
+	must("add member", h.Api.Organization.AddMember(otherOrg.Id, ada.Id))
+	service := models.NewServiceAccount("ada-ci", ada.Id, "")
+	must("save service account", h.Api.User.Save(service))
+
+	d, err := models.NewDeviceAuthorization("cli", []string{models.SCOPE_READ})
+	must("make device authorization", err)
+	d.UserId = null.StringFrom(ada.Id)
+	must("save device authorization", h.Api.DeviceAuthorization.Save(d))
+	must("save abuse flag", h.Api.AbuseFlag.Save(models.NewAbuseFlag(ada.Id, "uploads", nil, 0)))
+	resolved := models.NewAbuseFlag(grace.Id, "uploads", nil, 0)
+	resolved.ResolvedBy = null.StringFrom(ada.Id)
+	must("save abuse flag", h.Api.AbuseFlag.Save(resolved))
+	must("set preference", h.Api.Notification.SetPreference(ada.Id, models.NOTIFY_NEW_FOLLOWER, models.DELIVERY_OFF))
+	must("save notification", h.Api.Notification.Save(models.NewNotification(ada.Id, models.NOTIFY_NEW_FOLLOWER, "Hi", "Hi")))
+	must("save access request", h.Api.AccessRequest.Save(models.NewAccessRequest(other.Id, ada.Id, "")))
+	must("save access request", h.Api.AccessRequest.Save(models.NewAccessRequest(m.Id, grace.Id, "")))
+	hook, err := models.NewSecurityWebhook(ada.Id, "https://example.com/hook")
+	must("make security webhook", err)
+	must("save security webhook", h.Api.SecurityWebhook.Save(hook))
+	must("star model", h.Api.ModelStar.Star(other.Id, ada.Id))
+	must("star model", h.Api.ModelStar.Star(m.Id, grace.Id))
+	must("save analytics export", h.Api.AnalyticsExport.Save(models.NewAnalyticsExport(m.Id, ada.Id, "csv", now.AddDate(0, 0, -7), now)))
+	collection := models.NewCollection(grace.Id, "Favorites", "", "public")
+	must("save collection", h.Api.Collection.Save(collection))
+	must("add to collection", h.Api.Collection.SetModels(collection.Id, []string{m.Id, other.Id}))
+	must("save collection", h.Api.Collection.Save(models.NewCollection(ada.Id, "Mine", "", "public")))
+	s, err := models.NewSavedSearch(ada.Id, "mnist", "mnist", nil, false)
+	must("make saved search", err)
+	must("save saved search", h.Api.SavedSearch.Save(s))
+	j, err := models.NewJob("test", ada.Id, map[string]string{}, 1)
+	must("make job", err)
+	must("save job", h.Api.Job.Save(j))
+
+	// Every reference to auth_user, so that the test notices tables added
+	// after it was written
+	var refs []struct {
+		Table  string `db:"table_name"`
+		Column string `db:"column_name"`
+	}
+	err = h.DB.SQL(`
+		SELECT cl.relname AS table_name, a.attname AS column_name
+		FROM pg_constraint c
+		JOIN pg_class cl ON cl.oid = c.conrelid
+		JOIN pg_attribute a ON a.attrelid = c.conrelid AND a.attnum = c.conkey[1]
+		WHERE c.contype = 'f' AND c.confrelid = 'auth_user'::regclass
+	`).QueryStructs(&refs)
+	must("look up foreign keys", err)
+	count := func(table, column string) int {
+		var n int
+		err := h.DB.SQL("SELECT COUNT(*) FROM "+table+" WHERE "+column+" = $1", ada.Id).QueryScalar(&n)
+		must("count "+table, err)
+		return n
+	}
+	for _, ref := range refs {
+		if count(ref.Table, ref.Column) == 0 {
+			t.Errorf("No %s.%s refers to the user, so deleting them isn't tested", ref.Table, ref.Column)
+		}
+	}
+
+	// Service accounts are deleted before whoever made them, the way the
+	// account deletion job does it
+	must("delete service account", h.Api.User.DeleteAccount(service.Id))
+	must("delete account", h.Api.User.DeleteAccount(ada.Id))
+
+	for _, ref := range refs {
+		if n := count(ref.Table, ref.Column); n != 0 {
+			t.Errorf("%d rows of %s.%s still refer to the deleted user", n, ref.Table, ref.Column)
+		}
+	}
+	if n := count("auth_user", "id"); n != 0 {
+		t.Errorf("The user wasn't deleted")
+	}
+
+	// Takedowns they took part in are kept
+	if history, err := h.Api.FileQuarantine.ByFileId(otherFile.Id); err != nil || len(history) != 1 {
+		t.Errorf("Quarantine history is %v, %v, want the one quarantine", history, err)
+	}
+	// What others had of theirs is gone, and the rest is left alone
+	if _, err = h.Api.Model.ById(other.Id); err != nil {
+		t.Errorf("Could not look up another user's model: %v", err)
+	}
+	ids, err := h.Api.Collection.ModelIds(collection.Id)
+	if err != nil || len(ids) != 1 || ids[0] != other.Id {
+		t.Errorf("Collection has %v, %v, want only %s", ids, err, other.Id)
+	}
+}
@@ -0,0 +1,72 @@
+package apitest
+
+import (
+	"crypto/sha256"
+	"fmt"
+
+	"github.com/ericflo/gradientzoo/models"
+)
+
+// Password is the password of every user the harness makes.
+const Password = "password"
+
+// User makes a user, and a session token for them.  The username is made
+// unique by adding to it, so tests don't have to come up with their own.
+func (h *Harness) User(username string) (*models.User, *models.AuthToken) {
+	username = uniqueName(username)
+	user := models.NewUser(username+"@example.com", username, Password)
+	if err := h.Api.User.Save(user); err != nil {
+		h.T.Fatalf("Could not save user %s: %v", username, err)
+	}
+	return user, h.Token(user)
+}
+
+// Admin makes a user who is an admin, and a session token for them.
+func (h *Harness) Admin(username string) (*models.User, *models.AuthToken) {
+	user, token := h.User(username)
+	if err := h.Api.User.SetAdmin(user.Id, true); err != nil {
+		h.T.Fatalf("Could not make %s an admin: %v", user.Username, err)
+	}
+	user.IsAdmin = true
+	return user, token
+}
+
+// Token makes another session token for a user.
+func (h *Harness) Token(user *models.User) *models.AuthToken {
+	token := models.NewAuthToken(user.Id)
+	if err := h.Api.AuthToken.Save(token); err != nil {
+		h.T.Fatalf("Could not save token for %s: %v", user.Username, err)
+	}
+	return token
+}
+
+// Model makes a public model belonging to user.
+func (h *Harness) Model(user *models.User, slug string) *models.Model {
+	model := models.NewModel(user.Id, slug, slug, "", "public", 10)
+	if err := h.Api.Model.Save(model); err != nil {
+		h.T.Fatalf("Could not save model %s: %v", slug, err)
+	}
+	return model
+}
+
+// File makes the latest version of a file in a model, with its blob, without
+// going through the upload endpoint.
+func (h *Harness) File(model *models.Model, framework, filename string, data []byte) *models.File {
+	f, err := models.NewFile(model.UserId, model.Id, filename, framework, "", "",
+		len(data), map[string]interface{}{})
+	if err != nil {
+		h.T.Fatalf("Could not make file %s: %v", filename, err)
+	}
+	f.Sha256 = fmt.Sprintf("%x", sha256.Sum256(data))
+	if err = h.Blob.Save(data, f.BlobFilename(), "application/octet-stream"); err != nil {
+		h.T.Fatalf("Could not save blob for %s: %v", filename, err)
+	}
+	if err = h.Api.File.Save(f); err != nil {
+		h.T.Fatalf("Could not save file %s: %v", filename, err)
+	}
+	if err = h.Api.File.CommitPending(model.Id, filename, f.Id); err != nil {
+		h.T.Fatalf("Could not commit file %s: %v", filename, err)
+	}
+	f.Status = "latest"
+	return f
+}
@@ -0,0 +1,104 @@
+package apitest_test
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/ericflo/gradientzoo/apitest"
+	"github.com/ericflo/gradientzoo/models"
+)
+
+func TestMain(m *testing.M) {
+	apitest.Main(m)
+}
+
+// TestUploadPruneDownload uploads more versions of a file than its model
+// keeps, and checks that the oldest are pruned, blobs and all, while the
+// latest is what gets downloaded.
+func TestUploadPruneDownload(t *testing.T) {
+	h := apitest.Start(t)
+	defer h.Close()
+
+	user, token := h.User("ada")
+	m := h.Model(user, "mnist")
+	m.Keep = 2
+	if err := h.Api.Model.Save(m); err != nil {
+		t.Fatalf("Could not save model: %v", err)
+	}
+
+	var uploaded []*models.File
+	for i := 0; i < 4; i++ {
+		data := []byte(fmt.Sprintf("weights, version %d", i))
+		resp := h.Upload(token, user.Username, m.Slug, "keras", "model.h5", data,
+			map[string]interface{}{"epoch": i})
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Could not upload version %d: %d %s", i, resp.StatusCode, resp.Body)
+		}
+		var body struct {
+			File *models.File `json:"file"`
+		}
+		resp.Decode(h, &body)
+		uploaded = append(uploaded, body.File)
+	}
+
+	files, err := h.Api.File.ByModelIdFilename(m.Id, "model.h5")
+	if err != nil {
+		t.Fatalf("Could not look up files: %v", err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("Model kept %d versions, want 2", len(files))
+	}
+	kept := map[string]bool{}
+	for _, f := range files {
+		kept[f.Id] = true
+	}
+	for i, f := range uploaded {
+		wantKept := i >= len(uploaded)-2
+		if kept[f.Id] != wantKept {
+			t.Errorf("Version %d kept = %v, want %v", i, kept[f.Id], wantKept)
+		}
+		if exists := h.BlobExists(f.BlobFilename()); exists != wantKept {
+			t.Errorf("Version %d blob exists = %v, want %v", i, exists, wantKept)
+		}
+	}
+
+	data := h.Download(token, user.Username, m.Slug, "keras", "model.h5")
+	if want := []byte("weights, version 3"); !bytes.Equal(data, want) {
+		t.Errorf("Downloaded %q, want %q", data, want)
+	}
+
+	// Anybody can download from a public model
+	data = h.Download(nil, user.Username, m.Slug, "keras", "model.h5")
+	if want := []byte("weights, version 3"); !bytes.Equal(data, want) {
+		t.Errorf("Downloaded %q signed out, want %q", data, want)
+	}
+}
+
+// TestPrivateDownload checks that a private model's files can only be
+// downloaded by its owner.
+func TestPrivateDownload(t *testing.T) {
+	h := apitest.Start(t)
+	defer h.Close()
+
+	user, token := h.User("ada")
+	_, otherToken := h.User("grace")
+	m := h.Model(user, "secret")
+	m.Visibility = "private"
+	if err := h.Api.Model.Save(m); err != nil {
+		t.Fatalf("Could not save model: %v", err)
+	}
+	h.File(m, "keras", "model.h5", []byte("weights"))
+
+	path := "/file/" + user.Username + "/" + m.Slug + "/keras/model.h5"
+	if resp := h.Get(otherToken, path); resp.StatusCode == http.StatusOK {
+		t.Errorf("Another user downloaded a private file")
+	}
+	if resp := h.Get(nil, path); resp.StatusCode == http.StatusOK {
+		t.Errorf("Nobody downloaded a private file")
+	}
+	if data := h.Download(token, user.Username, m.Slug, "keras", "model.h5"); string(data) != "weights" {
+		t.Errorf("Owner downloaded %q, want %q", data, "weights")
+	}
+}
@@ -0,0 +1,39 @@
+package apitest
+
+import (
+	"sync"
+)
+
+// Message is an e-mail the API sent.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer keeps the e-mails the API sends, instead of sending them, so tests
+// can check them and follow the links in them.
+type Mailer struct {
+	mu   sync.Mutex
+	Sent []*Message
+}
+
+func (m *Mailer) Send(to, subject, body string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Sent = append(m.Sent, &Message{To: to, Subject: subject, Body: body})
+	return nil
+}
+
+// To is every e-mail sent to an address, oldest first.
+func (m *Mailer) To(address string) []*Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var msgs []*Message
+	for _, msg := range m.Sent {
+		if msg.To == address {
+			msgs = append(msgs, msg)
+		}
+	}
+	return msgs
+}
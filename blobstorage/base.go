@@ -1,12 +1,16 @@
 package blobstorage
 
 import (
+	"io"
 	"time"
 )
 
 //go:generate counterfeiter $GOFILE BlobStorage
 type BlobStorage interface {
 	Save(data []byte, filename, contentType string) error
+	Get(filename string) ([]byte, error)
+	Open(filename string) (io.ReadCloser, error)
 	Delete(filename string) error
+	Copy(srcFilename, dstFilename string) error
 	MakeUrl(filename string, expireTime time.Duration) (string, error)
 }
@@ -0,0 +1,91 @@
+package blobstorage
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var errBadFilename = errors.New("Blob filenames can't leave the blob directory")
+
+// FilesystemBlobStorage keeps blobs as files under a directory, for
+// development and tests, where there's no S3 to use.  Its URLs are under
+// baseUrl, which has to be served from the directory by something else, e.g.
+// an http.FileServer.  They don't expire.
+type FilesystemBlobStorage struct {
+	dir     string
+	baseUrl string
+}
+
+func NewFilesystemBlobStorage(dir, baseUrl string) *FilesystemBlobStorage {
+	return &FilesystemBlobStorage{
+		dir:     dir,
+		baseUrl: strings.TrimRight(baseUrl, "/"),
+	}
+}
+
+func (f *FilesystemBlobStorage) path(filename string) (string, error) {
+	clean := filepath.Clean("/" + filepath.FromSlash(filename))
+	if clean == string(filepath.Separator) || clean != "/"+filepath.FromSlash(filename) {
+		return "", errBadFilename
+	}
+	return filepath.Join(f.dir, clean), nil
+}
+
+func (f *FilesystemBlobStorage) Save(data []byte, filename, contentType string) error {
+	path, err := f.path(filename)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+func (f *FilesystemBlobStorage) Get(filename string) ([]byte, error) {
+	path, err := f.path(filename)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadFile(path)
+}
+
+func (f *FilesystemBlobStorage) Open(filename string) (io.ReadCloser, error) {
+	path, err := f.path(filename)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(path)
+}
+
+// Delete doesn't mind if the blob is already gone, the same as S3.
+func (f *FilesystemBlobStorage) Delete(filename string) error {
+	path, err := f.path(filename)
+	if err != nil {
+		return err
+	}
+	if err = os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (f *FilesystemBlobStorage) Copy(srcFilename, dstFilename string) error {
+	data, err := f.Get(srcFilename)
+	if err != nil {
+		return err
+	}
+	return f.Save(data, dstFilename, "application/octet-stream")
+}
+
+func (f *FilesystemBlobStorage) MakeUrl(filename string, expireTime time.Duration) (string, error) {
+	if _, err := f.path(filename); err != nil {
+		return "", err
+	}
+	return f.baseUrl + "/" + strings.TrimLeft(filename, "/"), nil
+}
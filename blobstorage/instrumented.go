@@ -0,0 +1,166 @@
+package blobstorage
+
+import (
+	"io"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/ericflo/gradientzoo/metrics"
+	"github.com/ericflo/gradientzoo/tracing"
+)
+
+var (
+	blobDuration = metrics.NewHistogram("gradientzoo_blob_operation_duration_seconds",
+		"How long blob storage operations take, by operation.", metrics.LatencyBuckets,
+		"operation")
+	blobErrors = metrics.NewCounter("gradientzoo_blob_operation_errors_total",
+		"Blob storage operations that failed, by operation.", "operation")
+	blobBytes = metrics.NewCounter("gradientzoo_blob_bytes_total",
+		"Bytes written to and read from blob storage, by direction.", "direction")
+)
+
+// InstrumentedBlobStorage times the operations on another BlobStorage, and
+// counts their failures and the bytes they move, for metrics and for the
+// trace of the request they're done for, if it's been given one by Traced.
+// It also keeps track of what's under way, for diagnosing where memory's
+// going during big uploads.
+type InstrumentedBlobStorage struct {
+	blob   BlobStorage
+	parent *tracing.Span
+	*counters
+}
+
+// counters are shared by an InstrumentedBlobStorage and its traced copies.
+type counters struct {
+	inFlight    int64
+	savingBytes int64
+}
+
+// Stats is what's under way in blob storage right now.  Every operation uses
+// a client of its own, so InFlight is also how many clients there are.
+type Stats struct {
+	InFlight    int64 `json:"in_flight"`
+	SavingBytes int64 `json:"saving_bytes"`
+}
+
+func NewInstrumentedBlobStorage(blob BlobStorage) *InstrumentedBlobStorage {
+	return &InstrumentedBlobStorage{blob: blob, counters: &counters{}}
+}
+
+// Traced is the same blob storage, with its operations traced as part of the
+// span.
+func (s *InstrumentedBlobStorage) Traced(parent *tracing.Span) *InstrumentedBlobStorage {
+	return &InstrumentedBlobStorage{blob: s.blob, parent: parent, counters: s.counters}
+}
+
+// Traced has blob's operations traced as part of the span, if blob is
+// instrumented, or else returns blob as it is.
+func Traced(blob BlobStorage, parent *tracing.Span) BlobStorage {
+	if s, ok := blob.(*InstrumentedBlobStorage); ok && parent != nil {
+		return s.Traced(parent)
+	}
+	return blob
+}
+
+// Stats says what's under way right now.
+func (s *InstrumentedBlobStorage) Stats() Stats {
+	return Stats{
+		InFlight:    atomic.LoadInt64(&s.inFlight),
+		SavingBytes: atomic.LoadInt64(&s.savingBytes),
+	}
+}
+
+type blobTimer struct {
+	operation string
+	start     time.Time
+	span      *tracing.Span
+	inFlight  *int64
+}
+
+func (s *InstrumentedBlobStorage) startOp(operation, filename string) *blobTimer {
+	span := s.parent.Child("blob "+operation, tracing.KIND_CLIENT)
+	span.SetAttribute("blob.filename", filename)
+	atomic.AddInt64(&s.inFlight, 1)
+	return &blobTimer{operation: operation, start: time.Now(), span: span, inFlight: &s.inFlight}
+}
+
+func (t *blobTimer) done(err error) {
+	atomic.AddInt64(t.inFlight, -1)
+	blobDuration.Observe(time.Since(t.start).Seconds(), t.operation)
+	if err != nil {
+		blobErrors.Inc(t.operation)
+		t.span.SetError(err)
+	}
+	t.span.Finish()
+}
+
+func (s *InstrumentedBlobStorage) Save(data []byte, filename, contentType string) error {
+	t := s.startOp("save", filename)
+	atomic.AddInt64(&s.savingBytes, int64(len(data)))
+	err := s.blob.Save(data, filename, contentType)
+	atomic.AddInt64(&s.savingBytes, -int64(len(data)))
+	t.span.SetAttribute("blob.size_bytes", strconv.Itoa(len(data)))
+	t.done(err)
+	if err == nil {
+		blobBytes.Add(float64(len(data)), "write")
+	}
+	return err
+}
+
+func (s *InstrumentedBlobStorage) Get(filename string) ([]byte, error) {
+	t := s.startOp("get", filename)
+	data, err := s.blob.Get(filename)
+	t.done(err)
+	blobBytes.Add(float64(len(data)), "read")
+	return data, err
+}
+
+// Open times how long it takes to start streaming the blob, and counts the
+// bytes read from it once it's closed.
+func (s *InstrumentedBlobStorage) Open(filename string) (io.ReadCloser, error) {
+	t := s.startOp("open", filename)
+	rc, err := s.blob.Open(filename)
+	t.done(err)
+	if err != nil {
+		return nil, err
+	}
+	return &countingReader{ReadCloser: rc}, nil
+}
+
+type countingReader struct {
+	io.ReadCloser
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+func (r *countingReader) Close() error {
+	blobBytes.Add(float64(r.n), "read")
+	return r.ReadCloser.Close()
+}
+
+func (s *InstrumentedBlobStorage) Delete(filename string) error {
+	t := s.startOp("delete", filename)
+	err := s.blob.Delete(filename)
+	t.done(err)
+	return err
+}
+
+func (s *InstrumentedBlobStorage) Copy(srcFilename, dstFilename string) error {
+	t := s.startOp("copy", srcFilename)
+	err := s.blob.Copy(srcFilename, dstFilename)
+	t.done(err)
+	return err
+}
+
+func (s *InstrumentedBlobStorage) MakeUrl(filename string, expireTime time.Duration) (string, error) {
+	t := s.startOp("make_url", filename)
+	u, err := s.blob.MakeUrl(filename, expireTime)
+	t.done(err)
+	return u, err
+}
@@ -2,6 +2,9 @@ package blobstorage
 
 import (
 	"bytes"
+	"io"
+	"io/ioutil"
+	"net/url"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
@@ -37,6 +40,32 @@ func (s *S3BlobStorage) Save(data []byte, filename, contentType string) error {
 	return err
 }
 
+func (s *S3BlobStorage) Get(filename string) ([]byte, error) {
+	svc := s.makeSvc()
+	resp, err := svc.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(filename),
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return ioutil.ReadAll(resp.Body)
+}
+
+// Open streams the blob, for ones too big to hold in memory.
+func (s *S3BlobStorage) Open(filename string) (io.ReadCloser, error) {
+	svc := s.makeSvc()
+	resp, err := svc.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(filename),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
 func (s *S3BlobStorage) Delete(filename string) error {
 	svc := s.makeSvc()
 	_, err := svc.DeleteObject(&s3.DeleteObjectInput{
@@ -46,6 +75,17 @@ func (s *S3BlobStorage) Delete(filename string) error {
 	return err
 }
 
+func (s *S3BlobStorage) Copy(srcFilename, dstFilename string) error {
+	svc := s.makeSvc()
+	src := &url.URL{Path: s.bucket + "/" + srcFilename}
+	_, err := svc.CopyObject(&s3.CopyObjectInput{
+		Bucket:     aws.String(s.bucket),
+		Key:        aws.String(dstFilename),
+		CopySource: aws.String(src.String()),
+	})
+	return err
+}
+
 func (s *S3BlobStorage) MakeUrl(filename string, expireTime time.Duration) (string, error) {
 	svc := s.makeSvc()
 	req, _ := svc.GetObjectRequest(&s3.GetObjectInput{
@@ -0,0 +1,99 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/gob"
+	"sync"
+	"time"
+
+	"github.com/ericflo/gradientzoo/metrics"
+)
+
+// Cache keeps values for hot lookups for a while, so that they don't have to
+// go to the database every time.  Values are bytes, and a key that's missing
+// or has expired is a miss rather than an error; errors are for when the
+// cache itself couldn't be reached.
+//
+//go:generate counterfeiter $GOFILE Cache
+type Cache interface {
+	Get(key string) ([]byte, bool, error)
+	Set(key string, value []byte, ttl time.Duration) error
+	Delete(keys ...string) error
+}
+
+var lookups = metrics.NewCounter("gradientzoo_cache_lookups_total",
+	"Cache lookups, by whether they were hits, misses, or errors.", "result")
+
+// Fetch fills v, a pointer, from the cache if it's there, and otherwise by
+// calling load, which fills v itself, and then caches it for ttl.  Values are
+// gob encoded, so that fields which are never sent as JSON are kept too.
+// Only one load for a key is in flight at once on this server; anyone else
+// who misses on it while that's happening waits for it and decodes its
+// value.  The cache being unreachable just means everything is loaded.
+func Fetch(c Cache, key string, ttl time.Duration, v interface{}, load func() error) error {
+	b, ok, err := c.Get(key)
+	switch {
+	case err != nil:
+		lookups.Inc("error")
+	case ok && gob.NewDecoder(bytes.NewReader(b)).Decode(v) == nil:
+		lookups.Inc("hit")
+		return nil
+	default:
+		lookups.Inc("miss")
+	}
+
+	b, shared, err := flights.do(key, func() ([]byte, error) {
+		if err := load(); err != nil {
+			return nil, err
+		}
+		var buf bytes.Buffer
+		if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+			return nil, err
+		}
+		// Not being able to cache it is no reason to fail the lookup
+		c.Set(key, buf.Bytes(), ttl)
+		return buf.Bytes(), nil
+	})
+	if err != nil || !shared {
+		return err
+	}
+	return gob.NewDecoder(bytes.NewReader(b)).Decode(v)
+}
+
+// flight is a load in progress
+type flight struct {
+	wg  sync.WaitGroup
+	val []byte
+	err error
+}
+
+type flightGroup struct {
+	sync.Mutex
+	byKey map[string]*flight
+}
+
+var flights = &flightGroup{byKey: map[string]*flight{}}
+
+// do calls fn, unless it's already being called for the key, in which case it
+// waits for that call instead and returns what it did, along with true.
+func (g *flightGroup) do(key string, fn func() ([]byte, error)) ([]byte, bool, error) {
+	g.Lock()
+	if f, ok := g.byKey[key]; ok {
+		g.Unlock()
+		f.wg.Wait()
+		return f.val, true, f.err
+	}
+	f := &flight{}
+	f.wg.Add(1)
+	g.byKey[key] = f
+	g.Unlock()
+
+	defer func() {
+		g.Lock()
+		delete(g.byKey, key)
+		g.Unlock()
+		f.wg.Done()
+	}()
+	f.val, f.err = fn()
+	return f.val, false, f.err
+}
@@ -0,0 +1,38 @@
+package cache
+
+import (
+	"time"
+
+	gocache "github.com/pmylund/go-cache"
+)
+
+// MemoryCache keeps values in this server's memory.  Other servers don't see
+// what it deletes, so with more than one server their copies can be stale for
+// as long as they're kept.
+type MemoryCache struct {
+	c *gocache.Cache
+}
+
+func NewMemoryCache() *MemoryCache {
+	return &MemoryCache{gocache.New(time.Minute, 5*time.Minute)}
+}
+
+func (m *MemoryCache) Get(key string) ([]byte, bool, error) {
+	v, ok := m.c.Get(key)
+	if !ok {
+		return nil, false, nil
+	}
+	return v.([]byte), true, nil
+}
+
+func (m *MemoryCache) Set(key string, value []byte, ttl time.Duration) error {
+	m.c.Set(key, value, ttl)
+	return nil
+}
+
+func (m *MemoryCache) Delete(keys ...string) error {
+	for _, key := range keys {
+		m.c.Delete(key)
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package cache
+
+import (
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// Every key is prefixed with this, so that the Redis can be shared
+const redisPrefix = "gradientzoo:"
+
+// RedisCache keeps values in Redis, where every server sees the same ones, so
+// deleting a key after a write is seen everywhere at once.
+type RedisCache struct {
+	pool *redis.Pool
+}
+
+// NewRedisCache uses the Redis at url, e.g. redis://:password@host:6379/0,
+// and makes sure it can be reached.
+func NewRedisCache(url string) (*RedisCache, error) {
+	pool := &redis.Pool{
+		MaxIdle:     8,
+		IdleTimeout: 4 * time.Minute,
+		Dial: func() (redis.Conn, error) {
+			return redis.DialURL(url)
+		},
+		TestOnBorrow: func(c redis.Conn, t time.Time) error {
+			if time.Since(t) < time.Minute {
+				return nil
+			}
+			_, err := c.Do("PING")
+			return err
+		},
+	}
+	conn := pool.Get()
+	defer conn.Close()
+	if _, err := conn.Do("PING"); err != nil {
+		pool.Close()
+		return nil, err
+	}
+	return &RedisCache{pool}, nil
+}
+
+func (r *RedisCache) Get(key string) ([]byte, bool, error) {
+	conn := r.pool.Get()
+	defer conn.Close()
+	b, err := redis.Bytes(conn.Do("GET", redisPrefix+key))
+	if err == redis.ErrNil {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return b, true, nil
+}
+
+func (r *RedisCache) Set(key string, value []byte, ttl time.Duration) error {
+	conn := r.pool.Get()
+	defer conn.Close()
+	_, err := conn.Do("SET", redisPrefix+key, value, "PX", int64(ttl/time.Millisecond))
+	return err
+}
+
+func (r *RedisCache) Delete(keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	args := make(redis.Args, 0, len(keys))
+	for _, key := range keys {
+		args = args.Add(redisPrefix + key)
+	}
+	conn := r.pool.Get()
+	defer conn.Close()
+	_, err := conn.Do("DEL", args...)
+	return err
+}
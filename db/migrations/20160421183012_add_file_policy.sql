@@ -0,0 +1,16 @@
+
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+CREATE TABLE file_policy (
+    id UUID PRIMARY KEY DEFAULT UUID_GENERATE_V1(),
+    model_id UUID NOT NULL,
+    filename TEXT NOT NULL,
+    keep INTEGER NOT NULL,
+    created_time TIMESTAMPTZ NOT NULL,
+    FOREIGN KEY (model_id) REFERENCES model(id) ON DELETE CASCADE,
+    UNIQUE(model_id, filename)
+);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+DROP TABLE file_policy;
@@ -0,0 +1,12 @@
+
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+ALTER TABLE file_policy ADD COLUMN metric_key TEXT NOT NULL DEFAULT '';
+ALTER TABLE file_policy ADD COLUMN metric_direction TEXT NOT NULL DEFAULT '';
+ALTER TABLE file_policy ADD COLUMN best_file_id UUID;
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+ALTER TABLE file_policy DROP COLUMN metric_key;
+ALTER TABLE file_policy DROP COLUMN metric_direction;
+ALTER TABLE file_policy DROP COLUMN best_file_id;
@@ -0,0 +1,10 @@
+
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+CREATE INDEX file_metadata_idx ON file USING GIN (metadata jsonb_path_ops);
+CREATE INDEX model_user_id_idx ON model (user_id);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+DROP INDEX model_user_id_idx;
+DROP INDEX file_metadata_idx;
@@ -0,0 +1,18 @@
+
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+CREATE TABLE file_structure (
+    file_id UUID PRIMARY KEY,
+    status TEXT NOT NULL DEFAULT 'pending',
+    format TEXT NOT NULL DEFAULT '',
+    structure JSONB NOT NULL DEFAULT '{}'::JSONB,
+    total_params BIGINT NOT NULL DEFAULT 0,
+    error TEXT NOT NULL DEFAULT '',
+    created_time TIMESTAMPTZ NOT NULL,
+    updated_time TIMESTAMPTZ NOT NULL,
+    FOREIGN KEY (file_id) REFERENCES file(id) ON DELETE CASCADE
+);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+DROP TABLE file_structure;
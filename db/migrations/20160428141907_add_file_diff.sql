@@ -0,0 +1,21 @@
+
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+CREATE TABLE file_diff (
+    id UUID PRIMARY KEY,
+    old_file_id UUID NOT NULL,
+    new_file_id UUID NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending',
+    format TEXT NOT NULL DEFAULT '',
+    diff JSONB NOT NULL DEFAULT '{}'::JSONB,
+    error TEXT NOT NULL DEFAULT '',
+    created_time TIMESTAMPTZ NOT NULL,
+    updated_time TIMESTAMPTZ NOT NULL,
+    FOREIGN KEY (old_file_id) REFERENCES file(id) ON DELETE CASCADE,
+    FOREIGN KEY (new_file_id) REFERENCES file(id) ON DELETE CASCADE,
+    UNIQUE (old_file_id, new_file_id)
+);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+DROP TABLE file_diff;
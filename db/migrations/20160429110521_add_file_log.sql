@@ -0,0 +1,38 @@
+
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+ALTER TABLE file ADD COLUMN sha256 TEXT NOT NULL DEFAULT '';
+
+CREATE TABLE file_log (
+    id UUID PRIMARY KEY,
+    model_id UUID NOT NULL,
+    seq BIGINT NOT NULL,
+    file_id UUID NOT NULL,
+    filename TEXT NOT NULL,
+    framework TEXT NOT NULL,
+    size_bytes BIGINT NOT NULL,
+    sha256 TEXT NOT NULL,
+    prev_hash TEXT NOT NULL,
+    hash TEXT NOT NULL,
+    created_time TIMESTAMPTZ NOT NULL,
+    FOREIGN KEY (model_id) REFERENCES model(id) ON DELETE CASCADE,
+    UNIQUE (model_id, seq)
+);
+
+-- Entries are append-only: once written they can never be changed
+-- +goose StatementBegin
+CREATE FUNCTION file_log_immutable() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'file_log entries cannot be modified';
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+CREATE TRIGGER file_log_no_update BEFORE UPDATE ON file_log
+    FOR EACH ROW EXECUTE PROCEDURE file_log_immutable();
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+DROP TABLE file_log;
+DROP FUNCTION file_log_immutable();
+ALTER TABLE file DROP COLUMN sha256;
@@ -0,0 +1,20 @@
+
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+CREATE TABLE file_metadata_revision (
+    id UUID PRIMARY KEY,
+    file_id UUID NOT NULL,
+    user_id UUID NOT NULL,
+    revision INTEGER NOT NULL,
+    patch JSONB NOT NULL,
+    previous_metadata JSONB NOT NULL,
+    metadata JSONB NOT NULL,
+    created_time TIMESTAMPTZ NOT NULL,
+    FOREIGN KEY (file_id) REFERENCES file(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES auth_user(id),
+    UNIQUE (file_id, revision)
+);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+DROP TABLE file_metadata_revision;
@@ -0,0 +1,20 @@
+
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+CREATE TABLE file_group (
+    id UUID PRIMARY KEY,
+    model_id UUID NOT NULL,
+    name TEXT NOT NULL,
+    filenames JSONB NOT NULL DEFAULT '[]'::JSONB,
+    keep INTEGER NOT NULL DEFAULT 0,
+    created_time TIMESTAMPTZ NOT NULL,
+    FOREIGN KEY (model_id) REFERENCES model(id) ON DELETE CASCADE,
+    UNIQUE (model_id, name)
+);
+
+ALTER TABLE file ADD COLUMN group_version UUID;
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+ALTER TABLE file DROP COLUMN group_version;
+DROP TABLE file_group;
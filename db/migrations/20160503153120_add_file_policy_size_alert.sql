@@ -0,0 +1,12 @@
+
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+ALTER TABLE file_policy ADD COLUMN size_alert_percent INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE file_policy ADD COLUMN size_alert_webhook TEXT NOT NULL DEFAULT '';
+ALTER TABLE file_policy ADD COLUMN size_alert_email BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+ALTER TABLE file_policy DROP COLUMN size_alert_email;
+ALTER TABLE file_policy DROP COLUMN size_alert_webhook;
+ALTER TABLE file_policy DROP COLUMN size_alert_percent;
@@ -0,0 +1,19 @@
+
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+CREATE TABLE file_share (
+    id UUID PRIMARY KEY,
+    file_id UUID NOT NULL,
+    model_id UUID NOT NULL,
+    note TEXT NOT NULL DEFAULT '',
+    expires_time TIMESTAMPTZ NOT NULL,
+    created_time TIMESTAMPTZ NOT NULL,
+    FOREIGN KEY (file_id) REFERENCES file(id) ON DELETE CASCADE,
+    FOREIGN KEY (model_id) REFERENCES model(id) ON DELETE CASCADE
+);
+CREATE INDEX file_share_file_id_idx ON file_share (file_id);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+DROP INDEX file_share_file_id_idx;
+DROP TABLE file_share;
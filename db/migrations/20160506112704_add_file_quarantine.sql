@@ -0,0 +1,45 @@
+
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+ALTER TABLE auth_user ADD COLUMN is_admin BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- There's deliberately no foreign key on file_id, so that the record of a
+-- takedown outlives the file itself
+CREATE TABLE file_quarantine (
+    id UUID PRIMARY KEY,
+    file_id UUID NOT NULL,
+    model_id UUID NOT NULL,
+    reason TEXT NOT NULL,
+    details TEXT NOT NULL DEFAULT '',
+    status TEXT NOT NULL,
+    appeal TEXT NOT NULL DEFAULT '',
+    created_by UUID NOT NULL,
+    created_time TIMESTAMPTZ NOT NULL,
+    resolved_time TIMESTAMPTZ,
+    FOREIGN KEY (model_id) REFERENCES model(id) ON DELETE CASCADE,
+    FOREIGN KEY (created_by) REFERENCES auth_user(id)
+);
+CREATE INDEX file_quarantine_file_id_idx ON file_quarantine (file_id);
+CREATE UNIQUE INDEX file_quarantine_active_idx ON file_quarantine (file_id)
+    WHERE status IN ('quarantined', 'appealed');
+
+CREATE TABLE file_quarantine_event (
+    id UUID PRIMARY KEY,
+    quarantine_id UUID NOT NULL,
+    user_id UUID NOT NULL,
+    action TEXT NOT NULL,
+    note TEXT NOT NULL DEFAULT '',
+    created_time TIMESTAMPTZ NOT NULL,
+    FOREIGN KEY (quarantine_id) REFERENCES file_quarantine(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES auth_user(id)
+);
+CREATE INDEX file_quarantine_event_quarantine_id_idx ON file_quarantine_event (quarantine_id);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+DROP INDEX file_quarantine_event_quarantine_id_idx;
+DROP TABLE file_quarantine_event;
+DROP INDEX file_quarantine_active_idx;
+DROP INDEX file_quarantine_file_id_idx;
+DROP TABLE file_quarantine;
+ALTER TABLE auth_user DROP COLUMN is_admin;
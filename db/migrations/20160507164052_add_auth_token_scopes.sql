@@ -0,0 +1,16 @@
+
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+ALTER TABLE auth_token ADD COLUMN kind TEXT NOT NULL DEFAULT 'session';
+ALTER TABLE auth_token ADD COLUMN name TEXT NOT NULL DEFAULT '';
+ALTER TABLE auth_token ADD COLUMN scopes JSONB NOT NULL DEFAULT '["read", "upload", "admin"]'::JSONB;
+ALTER TABLE auth_token ADD COLUMN last_used_time TIMESTAMPTZ;
+CREATE INDEX auth_token_user_id_idx ON auth_token (user_id);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+DROP INDEX auth_token_user_id_idx;
+ALTER TABLE auth_token DROP COLUMN last_used_time;
+ALTER TABLE auth_token DROP COLUMN scopes;
+ALTER TABLE auth_token DROP COLUMN name;
+ALTER TABLE auth_token DROP COLUMN kind;
@@ -0,0 +1,24 @@
+
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+ALTER TABLE auth_token ADD COLUMN expires_time TIMESTAMPTZ;
+
+-- Existing sessions have no refresh token, so give them a while before they
+-- expire rather than logging everyone out at once
+UPDATE auth_token SET expires_time = NOW() + INTERVAL '30 days' WHERE kind = 'session';
+
+CREATE TABLE refresh_token (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL,
+    created_time TIMESTAMPTZ NOT NULL,
+    expires_time TIMESTAMPTZ NOT NULL,
+    used_time TIMESTAMPTZ,
+    FOREIGN KEY (user_id) REFERENCES auth_user(id) ON DELETE CASCADE
+);
+CREATE INDEX refresh_token_user_id_idx ON refresh_token (user_id);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+DROP INDEX refresh_token_user_id_idx;
+DROP TABLE refresh_token;
+ALTER TABLE auth_token DROP COLUMN expires_time;
@@ -0,0 +1,29 @@
+
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+CREATE TABLE user_identity (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL,
+    provider TEXT NOT NULL,
+    provider_user_id TEXT NOT NULL,
+    email TEXT NOT NULL DEFAULT '',
+    created_time TIMESTAMPTZ NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES auth_user(id) ON DELETE CASCADE
+);
+CREATE UNIQUE INDEX user_identity_provider_user_id_idx ON user_identity (provider, provider_user_id);
+CREATE INDEX user_identity_user_id_idx ON user_identity (user_id);
+
+CREATE TABLE oauth_state (
+    id UUID PRIMARY KEY,
+    provider TEXT NOT NULL,
+    user_id UUID,
+    created_time TIMESTAMPTZ NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES auth_user(id) ON DELETE CASCADE
+);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+DROP TABLE oauth_state;
+DROP INDEX user_identity_user_id_idx;
+DROP INDEX user_identity_provider_user_id_idx;
+DROP TABLE user_identity;
@@ -0,0 +1,24 @@
+
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+ALTER TABLE auth_user ADD COLUMN totp_secret TEXT NOT NULL DEFAULT '';
+ALTER TABLE auth_user ADD COLUMN totp_enabled BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE auth_user ADD COLUMN totp_last_counter BIGINT NOT NULL DEFAULT 0;
+
+CREATE TABLE backup_code (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL,
+    code_hash TEXT NOT NULL,
+    created_time TIMESTAMPTZ NOT NULL,
+    used_time TIMESTAMPTZ,
+    FOREIGN KEY (user_id) REFERENCES auth_user(id) ON DELETE CASCADE
+);
+CREATE INDEX backup_code_user_id_idx ON backup_code (user_id);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+DROP INDEX backup_code_user_id_idx;
+DROP TABLE backup_code;
+ALTER TABLE auth_user DROP COLUMN totp_last_counter;
+ALTER TABLE auth_user DROP COLUMN totp_enabled;
+ALTER TABLE auth_user DROP COLUMN totp_secret;
@@ -0,0 +1,12 @@
+
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+ALTER TABLE auth_user ADD COLUMN email_verified BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Accounts from an OAuth provider came with a verified address
+UPDATE auth_user SET email_verified = TRUE
+WHERE id IN (SELECT user_id FROM user_identity);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+ALTER TABLE auth_user DROP COLUMN email_verified;
@@ -0,0 +1,29 @@
+
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- There are deliberately no foreign keys, so that the audit trail outlives
+-- whatever it's about
+CREATE TABLE audit_event (
+    seq BIGSERIAL PRIMARY KEY,
+    id UUID NOT NULL UNIQUE,
+    actor_id UUID,
+    owner_id UUID,
+    action TEXT NOT NULL,
+    object_type TEXT NOT NULL DEFAULT '',
+    object_id TEXT NOT NULL DEFAULT '',
+    details JSONB NOT NULL DEFAULT '{}',
+    ip TEXT NOT NULL DEFAULT '',
+    user_agent TEXT NOT NULL DEFAULT '',
+    created_time TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX audit_event_owner_id_idx ON audit_event (owner_id, seq);
+CREATE INDEX audit_event_actor_id_idx ON audit_event (actor_id, seq);
+CREATE INDEX audit_event_action_idx ON audit_event (action, seq);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+DROP INDEX audit_event_action_idx;
+DROP INDEX audit_event_actor_id_idx;
+DROP INDEX audit_event_owner_id_idx;
+DROP TABLE audit_event;
@@ -0,0 +1,14 @@
+
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+ALTER TABLE auth_user ADD COLUMN suspended_time TIMESTAMPTZ;
+ALTER TABLE auth_user ADD COLUMN suspended_reason TEXT NOT NULL DEFAULT '';
+
+-- Sessions an admin started as someone else, for support
+ALTER TABLE auth_token ADD COLUMN impersonator_id UUID REFERENCES auth_user(id) ON DELETE CASCADE;
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+ALTER TABLE auth_token DROP COLUMN impersonator_id;
+ALTER TABLE auth_user DROP COLUMN suspended_reason;
+ALTER TABLE auth_user DROP COLUMN suspended_time;
@@ -0,0 +1,17 @@
+
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+CREATE TABLE ip_allowlist (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL,
+    cidr CIDR NOT NULL,
+    note TEXT NOT NULL DEFAULT '',
+    created_time TIMESTAMPTZ NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES auth_user(id) ON DELETE CASCADE
+);
+CREATE INDEX ip_allowlist_user_id_idx ON ip_allowlist (user_id);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+DROP INDEX ip_allowlist_user_id_idx;
+DROP TABLE ip_allowlist;
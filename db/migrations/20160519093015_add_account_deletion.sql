@@ -0,0 +1,11 @@
+
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+ALTER TABLE auth_user ADD COLUMN deletion_time TIMESTAMPTZ;
+CREATE INDEX auth_user_deletion_time_idx ON auth_user (deletion_time)
+    WHERE deletion_time IS NOT NULL;
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+DROP INDEX auth_user_deletion_time_idx;
+ALTER TABLE auth_user DROP COLUMN deletion_time;
@@ -0,0 +1,26 @@
+
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+CREATE TABLE app_key (
+    id UUID PRIMARY KEY,
+    name TEXT NOT NULL,
+    contact_email TEXT NOT NULL,
+    rate_multiplier INTEGER NOT NULL DEFAULT 10,
+    created_by UUID,
+    created_time TIMESTAMPTZ NOT NULL,
+    revoked_time TIMESTAMPTZ
+);
+
+CREATE TABLE app_key_day (
+    app_key_id UUID NOT NULL,
+    day DATE NOT NULL,
+    requests INTEGER NOT NULL DEFAULT 0,
+    rate_limited INTEGER NOT NULL DEFAULT 0,
+    FOREIGN KEY (app_key_id) REFERENCES app_key(id) ON DELETE CASCADE,
+    UNIQUE(app_key_id, day)
+);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+DROP TABLE app_key_day;
+DROP TABLE app_key;
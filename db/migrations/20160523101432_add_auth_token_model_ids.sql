@@ -0,0 +1,8 @@
+
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+ALTER TABLE auth_token ADD COLUMN model_ids JSONB NOT NULL DEFAULT '[]'::JSONB;
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+ALTER TABLE auth_token DROP COLUMN model_ids;
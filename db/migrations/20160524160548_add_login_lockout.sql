@@ -0,0 +1,12 @@
+
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+ALTER TABLE auth_user ADD COLUMN failed_logins INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE auth_user ADD COLUMN last_failed_login TIMESTAMPTZ;
+ALTER TABLE auth_user ADD COLUMN locked_until TIMESTAMPTZ;
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+ALTER TABLE auth_user DROP COLUMN locked_until;
+ALTER TABLE auth_user DROP COLUMN last_failed_login;
+ALTER TABLE auth_user DROP COLUMN failed_logins;
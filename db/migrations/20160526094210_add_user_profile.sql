@@ -0,0 +1,16 @@
+
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+ALTER TABLE auth_user ADD COLUMN display_name TEXT NOT NULL DEFAULT '';
+ALTER TABLE auth_user ADD COLUMN bio TEXT NOT NULL DEFAULT '';
+ALTER TABLE auth_user ADD COLUMN affiliation TEXT NOT NULL DEFAULT '';
+ALTER TABLE auth_user ADD COLUMN website TEXT NOT NULL DEFAULT '';
+ALTER TABLE auth_user ADD COLUMN avatar_filename TEXT NOT NULL DEFAULT '';
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+ALTER TABLE auth_user DROP COLUMN avatar_filename;
+ALTER TABLE auth_user DROP COLUMN website;
+ALTER TABLE auth_user DROP COLUMN affiliation;
+ALTER TABLE auth_user DROP COLUMN bio;
+ALTER TABLE auth_user DROP COLUMN display_name;
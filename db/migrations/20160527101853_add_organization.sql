@@ -0,0 +1,27 @@
+
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+CREATE TABLE organization (
+    id UUID PRIMARY KEY,
+    name TEXT NOT NULL,
+    owner_id UUID NOT NULL,
+    keep INTEGER NOT NULL DEFAULT 10,
+    created_time TIMESTAMPTZ NOT NULL,
+    FOREIGN KEY (owner_id) REFERENCES auth_user(id)
+);
+
+CREATE TABLE organization_member (
+    organization_id UUID NOT NULL,
+    user_id UUID NOT NULL,
+    created_time TIMESTAMPTZ NOT NULL,
+    FOREIGN KEY (organization_id) REFERENCES organization(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES auth_user(id),
+    UNIQUE(user_id)
+);
+
+CREATE INDEX organization_member_organization_id_idx ON organization_member (organization_id);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+DROP TABLE organization_member;
+DROP TABLE organization;
@@ -0,0 +1,14 @@
+
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+ALTER TABLE auth_user ADD COLUMN service_owner_id UUID REFERENCES auth_user(id);
+ALTER TABLE auth_user ADD COLUMN service_organization_id UUID REFERENCES organization(id) ON DELETE SET NULL;
+CREATE INDEX auth_user_service_owner_id_idx ON auth_user (service_owner_id);
+CREATE INDEX auth_user_service_organization_id_idx ON auth_user (service_organization_id);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+DROP INDEX auth_user_service_organization_id_idx;
+DROP INDEX auth_user_service_owner_id_idx;
+ALTER TABLE auth_user DROP COLUMN service_organization_id;
+ALTER TABLE auth_user DROP COLUMN service_owner_id;
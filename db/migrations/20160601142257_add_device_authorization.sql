@@ -0,0 +1,20 @@
+
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+CREATE TABLE device_authorization (
+    id UUID PRIMARY KEY,
+    user_code TEXT NOT NULL,
+    client_name TEXT NOT NULL,
+    scopes JSONB NOT NULL DEFAULT '[]',
+    status TEXT NOT NULL,
+    user_id UUID,
+    created_time TIMESTAMPTZ NOT NULL,
+    expires_time TIMESTAMPTZ NOT NULL,
+    last_poll_time TIMESTAMPTZ,
+    FOREIGN KEY (user_id) REFERENCES auth_user(id),
+    UNIQUE(user_code)
+);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+DROP TABLE device_authorization;
@@ -0,0 +1,22 @@
+
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+CREATE TABLE abuse_flag (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL,
+    kind TEXT NOT NULL,
+    details JSONB NOT NULL DEFAULT '{}',
+    throttled_until TIMESTAMPTZ,
+    created_time TIMESTAMPTZ NOT NULL,
+    resolved_by UUID,
+    resolved_time TIMESTAMPTZ,
+    resolution_note TEXT NOT NULL DEFAULT '',
+    FOREIGN KEY (user_id) REFERENCES auth_user(id) ON DELETE CASCADE,
+    FOREIGN KEY (resolved_by) REFERENCES auth_user(id) ON DELETE SET NULL
+);
+
+CREATE INDEX abuse_flag_user_id_idx ON abuse_flag (user_id);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+DROP TABLE abuse_flag;
@@ -0,0 +1,31 @@
+
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+CREATE TABLE notification_preference (
+    user_id UUID NOT NULL,
+    kind TEXT NOT NULL,
+    delivery TEXT NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES auth_user(id) ON DELETE CASCADE,
+    UNIQUE(user_id, kind)
+);
+
+CREATE TABLE notification (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL,
+    kind TEXT NOT NULL,
+    subject TEXT NOT NULL,
+    body TEXT NOT NULL,
+    created_time TIMESTAMPTZ NOT NULL,
+    sent_time TIMESTAMPTZ,
+    FOREIGN KEY (user_id) REFERENCES auth_user(id) ON DELETE CASCADE
+);
+
+CREATE INDEX notification_unsent_idx ON notification (user_id, created_time) WHERE sent_time IS NULL;
+
+ALTER TABLE model ADD COLUMN download_milestone INTEGER NOT NULL DEFAULT 0;
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+ALTER TABLE model DROP COLUMN download_milestone;
+DROP TABLE notification;
+DROP TABLE notification_preference;
@@ -0,0 +1,23 @@
+
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+CREATE TABLE access_request (
+    id UUID PRIMARY KEY,
+    model_id UUID NOT NULL,
+    user_id UUID NOT NULL,
+    message TEXT NOT NULL DEFAULT '',
+    status TEXT NOT NULL,
+    created_time TIMESTAMPTZ NOT NULL,
+    decided_time TIMESTAMPTZ,
+    decided_by_id UUID,
+    expires_time TIMESTAMPTZ,
+    FOREIGN KEY (model_id) REFERENCES model(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES auth_user(id) ON DELETE CASCADE,
+    UNIQUE(model_id, user_id)
+);
+
+CREATE INDEX access_request_user_id_idx ON access_request (user_id);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+DROP TABLE access_request;
@@ -0,0 +1,20 @@
+
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+CREATE TABLE security_webhook (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL UNIQUE,
+    url TEXT NOT NULL,
+    secret TEXT NOT NULL,
+    created_time TIMESTAMPTZ NOT NULL,
+    last_delivery_time TIMESTAMPTZ,
+    last_status INTEGER NOT NULL DEFAULT 0,
+    FOREIGN KEY (user_id) REFERENCES auth_user(id) ON DELETE CASCADE
+);
+
+CREATE INDEX audit_event_owner_action_ip_idx ON audit_event (owner_id, action, ip);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+DROP INDEX audit_event_owner_action_ip_idx;
+DROP TABLE security_webhook;
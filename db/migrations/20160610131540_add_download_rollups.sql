@@ -0,0 +1,25 @@
+
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+CREATE TABLE download_day (
+    file_id UUID NOT NULL,
+    day DATE NOT NULL,
+    downloads INTEGER NOT NULL DEFAULT 0,
+    downloaders INTEGER NOT NULL DEFAULT 0,
+    UNIQUE (file_id, day)
+);
+
+CREATE TABLE download_month (
+    file_id UUID NOT NULL,
+    month DATE NOT NULL,
+    downloads INTEGER NOT NULL DEFAULT 0,
+    UNIQUE (file_id, month)
+);
+
+CREATE INDEX download_hour_hour_idx ON download_hour (hour);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+DROP INDEX download_hour_hour_idx;
+DROP TABLE download_month;
+DROP TABLE download_day;
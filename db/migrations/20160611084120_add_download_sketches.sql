@@ -0,0 +1,10 @@
+
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+ALTER TABLE download_day ADD COLUMN sketch BYTEA;
+ALTER TABLE download_month ADD COLUMN sketch BYTEA;
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+ALTER TABLE download_month DROP COLUMN sketch;
+ALTER TABLE download_day DROP COLUMN sketch;
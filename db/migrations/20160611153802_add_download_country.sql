@@ -0,0 +1,14 @@
+
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+CREATE TABLE download_country (
+    file_id UUID NOT NULL,
+    day DATE NOT NULL,
+    country CHAR(2) NOT NULL,
+    downloads INTEGER NOT NULL DEFAULT 0,
+    UNIQUE (file_id, day, country)
+);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+DROP TABLE download_country;
@@ -0,0 +1,15 @@
+
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+CREATE TABLE download_client (
+    file_id UUID NOT NULL,
+    day DATE NOT NULL,
+    client_name VARCHAR(64) NOT NULL,
+    framework VARCHAR(64) NOT NULL,
+    downloads INTEGER NOT NULL DEFAULT 0,
+    UNIQUE (file_id, day, client_name, framework)
+);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+DROP TABLE download_client;
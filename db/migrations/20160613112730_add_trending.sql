@@ -0,0 +1,27 @@
+
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+CREATE TABLE model_star (
+    model_id UUID NOT NULL,
+    user_id UUID NOT NULL,
+    created_time TIMESTAMPTZ NOT NULL,
+    UNIQUE (model_id, user_id),
+    FOREIGN KEY (model_id) REFERENCES model(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES auth_user(id) ON DELETE CASCADE
+);
+
+CREATE INDEX model_star_user_id_idx ON model_star (user_id);
+
+CREATE TABLE model_trending (
+    model_id UUID PRIMARY KEY,
+    score DOUBLE PRECISION NOT NULL,
+    computed_time TIMESTAMPTZ NOT NULL,
+    FOREIGN KEY (model_id) REFERENCES model(id) ON DELETE CASCADE
+);
+
+CREATE INDEX model_trending_score_idx ON model_trending (score DESC, model_id DESC);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+DROP TABLE model_trending;
+DROP TABLE model_star;
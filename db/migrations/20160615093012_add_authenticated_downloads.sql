@@ -0,0 +1,12 @@
+
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+ALTER TABLE download_hour ADD COLUMN authenticated INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE download_day ADD COLUMN authenticated INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE download_month ADD COLUMN authenticated INTEGER NOT NULL DEFAULT 0;
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+ALTER TABLE download_month DROP COLUMN authenticated;
+ALTER TABLE download_day DROP COLUMN authenticated;
+ALTER TABLE download_hour DROP COLUMN authenticated;
@@ -0,0 +1,17 @@
+
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+CREATE TABLE model_leaderboard (
+    visibility TEXT NOT NULL,
+    period TEXT NOT NULL,
+    rank INTEGER NOT NULL,
+    model_id UUID NOT NULL,
+    downloads INTEGER NOT NULL,
+    computed_time TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (visibility, period, rank),
+    FOREIGN KEY (model_id) REFERENCES model(id) ON DELETE CASCADE
+);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+DROP TABLE model_leaderboard;
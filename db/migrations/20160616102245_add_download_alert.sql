@@ -0,0 +1,18 @@
+
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+CREATE TABLE download_alert (
+    id UUID PRIMARY KEY,
+    model_id UUID NOT NULL UNIQUE,
+    multiplier DOUBLE PRECISION NOT NULL,
+    min_downloads INTEGER NOT NULL,
+    email BOOLEAN NOT NULL,
+    webhook BOOLEAN NOT NULL,
+    created_time TIMESTAMPTZ NOT NULL,
+    last_alert_time TIMESTAMPTZ,
+    FOREIGN KEY (model_id) REFERENCES model(id) ON DELETE CASCADE
+);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+DROP TABLE download_alert;
@@ -0,0 +1,10 @@
+
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+ALTER TABLE organization ADD COLUMN bandwidth_warned_percent INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE organization ADD COLUMN bandwidth_warned_time TIMESTAMPTZ;
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+ALTER TABLE organization DROP COLUMN bandwidth_warned_time;
+ALTER TABLE organization DROP COLUMN bandwidth_warned_percent;
@@ -0,0 +1,18 @@
+
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+CREATE TABLE download_event (
+    id BIGSERIAL PRIMARY KEY,
+    file_id UUID NOT NULL,
+    network_hash TEXT NOT NULL,
+    agent_class TEXT NOT NULL,
+    created_time TIMESTAMPTZ NOT NULL,
+    FOREIGN KEY (file_id) REFERENCES file(id) ON DELETE CASCADE
+);
+
+CREATE INDEX download_event_file_id_idx ON download_event (file_id);
+CREATE INDEX download_event_created_time_idx ON download_event (created_time);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+DROP TABLE download_event;
@@ -0,0 +1,44 @@
+
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+CREATE TABLE model_search (
+    model_id UUID PRIMARY KEY,
+    search_vector TSVECTOR NOT NULL,
+    FOREIGN KEY (model_id) REFERENCES model(id) ON DELETE CASCADE
+);
+
+CREATE INDEX model_search_vector_idx ON model_search USING GIN (search_vector);
+
+-- Kept out of the model table so that models are still selected whole without
+-- dragging the vector along.  Names and slugs count for the most, then
+-- descriptions, then readmes.
+-- +goose StatementBegin
+CREATE FUNCTION model_search_update() RETURNS trigger AS $$
+DECLARE
+    vector TSVECTOR;
+BEGIN
+    vector :=
+        setweight(to_tsvector('english', coalesce(NEW.name, '')), 'A') ||
+        setweight(to_tsvector('english', replace(coalesce(NEW.slug, ''), '-', ' ')), 'A') ||
+        setweight(to_tsvector('english', coalesce(NEW.description, '')), 'B') ||
+        setweight(to_tsvector('english', coalesce(NEW.readme, '')), 'C');
+    UPDATE model_search SET search_vector = vector WHERE model_id = NEW.id;
+    IF NOT FOUND THEN
+        INSERT INTO model_search (model_id, search_vector) VALUES (NEW.id, vector);
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+CREATE TRIGGER model_search_sync AFTER INSERT OR UPDATE ON model
+    FOR EACH ROW EXECUTE PROCEDURE model_search_update();
+
+-- Fires the trigger for every model that's already there
+UPDATE model SET name = name;
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+DROP TRIGGER model_search_sync ON model;
+DROP FUNCTION model_search_update();
+DROP TABLE model_search;
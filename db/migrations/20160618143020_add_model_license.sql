@@ -0,0 +1,10 @@
+
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+ALTER TABLE model ADD COLUMN license TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX model_license_idx ON model (license);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+ALTER TABLE model DROP COLUMN license;
@@ -0,0 +1,69 @@
+
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+CREATE TABLE search_index_queue (
+    model_id UUID PRIMARY KEY,
+    queued_time TIMESTAMPTZ NOT NULL
+);
+
+-- Models are queued to be indexed again whenever they or their files change,
+-- however they're changed.  There's no foreign key, since deleted models are
+-- queued too, to be taken out of the index.
+-- +goose StatementBegin
+CREATE FUNCTION search_index_enqueue(id UUID) RETURNS void AS $$
+BEGIN
+    UPDATE search_index_queue SET queued_time = clock_timestamp() WHERE model_id = id;
+    IF NOT FOUND THEN
+        BEGIN
+            INSERT INTO search_index_queue (model_id, queued_time) VALUES (id, clock_timestamp());
+        EXCEPTION WHEN unique_violation THEN
+            UPDATE search_index_queue SET queued_time = clock_timestamp() WHERE model_id = id;
+        END;
+    END IF;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE FUNCTION search_index_model_changed() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        PERFORM search_index_enqueue(OLD.id);
+    ELSE
+        PERFORM search_index_enqueue(NEW.id);
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE FUNCTION search_index_file_changed() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        PERFORM search_index_enqueue(OLD.model_id);
+    ELSE
+        PERFORM search_index_enqueue(NEW.model_id);
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+CREATE TRIGGER search_index_model AFTER INSERT OR UPDATE OR DELETE ON model
+    FOR EACH ROW EXECUTE PROCEDURE search_index_model_changed();
+
+CREATE TRIGGER search_index_file AFTER INSERT OR UPDATE OR DELETE ON file
+    FOR EACH ROW EXECUTE PROCEDURE search_index_file_changed();
+
+-- Everything that's already there needs indexing
+INSERT INTO search_index_queue (model_id, queued_time) SELECT id, NOW() FROM model;
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+DROP TRIGGER search_index_file ON file;
+DROP TRIGGER search_index_model ON model;
+DROP FUNCTION search_index_file_changed();
+DROP FUNCTION search_index_model_changed();
+DROP FUNCTION search_index_enqueue(UUID);
+DROP TABLE search_index_queue;
@@ -0,0 +1,10 @@
+
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+CREATE INDEX auth_user_username_prefix_idx ON auth_user (LOWER(username) text_pattern_ops);
+CREATE INDEX auth_user_display_name_prefix_idx ON auth_user (LOWER(display_name) text_pattern_ops);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+DROP INDEX auth_user_display_name_prefix_idx;
+DROP INDEX auth_user_username_prefix_idx;
@@ -0,0 +1,12 @@
+
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+CREATE INDEX model_visibility_created_time_idx ON model (visibility, created_time DESC);
+CREATE INDEX model_visibility_name_idx ON model (visibility, LOWER(name));
+CREATE INDEX file_model_id_created_time_idx ON file (model_id, created_time DESC);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+DROP INDEX file_model_id_created_time_idx;
+DROP INDEX model_visibility_name_idx;
+DROP INDEX model_visibility_created_time_idx;
@@ -0,0 +1,20 @@
+
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+CREATE TABLE model_related (
+    model_id UUID NOT NULL,
+    related_model_id UUID NOT NULL,
+    co_downloads INTEGER NOT NULL,
+    shared_framework BOOLEAN NOT NULL,
+    score DOUBLE PRECISION NOT NULL,
+    computed_time TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (model_id, related_model_id),
+    FOREIGN KEY (model_id) REFERENCES model(id) ON DELETE CASCADE,
+    FOREIGN KEY (related_model_id) REFERENCES model(id) ON DELETE CASCADE
+);
+
+CREATE INDEX model_related_score_idx ON model_related (model_id, score DESC);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+DROP TABLE model_related;
@@ -0,0 +1,31 @@
+
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+CREATE TABLE collection (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL,
+    title TEXT NOT NULL,
+    description TEXT NOT NULL,
+    visibility TEXT NOT NULL,
+    featured BOOLEAN NOT NULL DEFAULT FALSE,
+    created_time TIMESTAMPTZ NOT NULL,
+    updated_time TIMESTAMPTZ NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES auth_user(id) ON DELETE CASCADE
+);
+
+CREATE INDEX collection_user_id_idx ON collection (user_id);
+CREATE INDEX collection_visibility_idx ON collection (visibility, featured DESC, updated_time DESC);
+
+CREATE TABLE collection_model (
+    collection_id UUID NOT NULL,
+    model_id UUID NOT NULL,
+    position INTEGER NOT NULL,
+    PRIMARY KEY (collection_id, model_id),
+    FOREIGN KEY (collection_id) REFERENCES collection(id) ON DELETE CASCADE,
+    FOREIGN KEY (model_id) REFERENCES model(id) ON DELETE CASCADE
+);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+DROP TABLE collection_model;
+DROP TABLE collection;
@@ -0,0 +1,51 @@
+
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+ALTER TABLE model ADD COLUMN updated_time TIMESTAMPTZ NOT NULL DEFAULT NOW();
+
+UPDATE model M SET updated_time = GREATEST(M.created_time, COALESCE(
+    (SELECT MAX(F.created_time) FROM file F WHERE F.model_id = M.id),
+    M.created_time));
+
+CREATE INDEX model_visibility_updated_time_idx ON model (visibility, updated_time, id);
+
+-- Models are updated when anything people see about them changes, not when
+-- e.g. their download milestone does, and whenever a file is uploaded to them
+-- +goose StatementBegin
+CREATE FUNCTION model_touch() RETURNS trigger AS $$
+BEGIN
+    IF NEW.name IS DISTINCT FROM OLD.name
+       OR NEW.slug IS DISTINCT FROM OLD.slug
+       OR NEW.description IS DISTINCT FROM OLD.description
+       OR NEW.readme IS DISTINCT FROM OLD.readme
+       OR NEW.license IS DISTINCT FROM OLD.license
+       OR NEW.visibility IS DISTINCT FROM OLD.visibility THEN
+        NEW.updated_time := NOW();
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE FUNCTION model_touch_file() RETURNS trigger AS $$
+BEGIN
+    UPDATE model SET updated_time = NOW() WHERE id = NEW.model_id;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+CREATE TRIGGER model_touch BEFORE UPDATE ON model
+    FOR EACH ROW EXECUTE PROCEDURE model_touch();
+
+CREATE TRIGGER model_touch_file AFTER INSERT ON file
+    FOR EACH ROW EXECUTE PROCEDURE model_touch_file();
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+DROP TRIGGER model_touch_file ON file;
+DROP TRIGGER model_touch ON model;
+DROP FUNCTION model_touch_file();
+DROP FUNCTION model_touch();
+ALTER TABLE model DROP COLUMN updated_time;
@@ -0,0 +1,91 @@
+
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- The leading numbers of a version, like {1,2} for 1.2.0rc1, with trailing
+-- zeros dropped so that 1.2 and 1.2.0 compare the same.  NULL when a version
+-- doesn't start with a number.
+-- +goose StatementBegin
+CREATE FUNCTION version_parts(v TEXT) RETURNS NUMERIC[] AS $$
+DECLARE
+    parts NUMERIC[];
+BEGIN
+    parts := regexp_split_to_array(substring(v from '^\s*v?([0-9]+(\.[0-9]+)*)'), '\.')::NUMERIC[];
+    WHILE array_length(parts, 1) > 1 AND parts[array_length(parts, 1)] = 0 LOOP
+        parts := parts[1:array_length(parts, 1) - 1];
+    END LOOP;
+    RETURN parts;
+END;
+$$ LANGUAGE plpgsql IMMUTABLE;
+-- +goose StatementEnd
+
+-- Sums up each model's latest files by framework and version, so listings
+-- can filter on them without going through every file
+CREATE TABLE model_latest_file (
+    model_id UUID NOT NULL,
+    framework TEXT NOT NULL,
+    framework_version TEXT NOT NULL,
+    version_parts NUMERIC[],
+    files INTEGER NOT NULL,
+    size_bytes BIGINT NOT NULL,
+    PRIMARY KEY (model_id, framework, framework_version)
+);
+CREATE INDEX model_latest_file_framework_idx ON model_latest_file (framework, version_parts);
+
+INSERT INTO model_latest_file (model_id, framework, framework_version, version_parts, files, size_bytes)
+SELECT model_id, framework, framework_version, version_parts(framework_version), COUNT(*), SUM(size_bytes)
+FROM file
+WHERE status = 'latest'
+GROUP BY model_id, framework, framework_version;
+
+-- +goose StatementBegin
+CREATE FUNCTION refresh_model_latest_file(mid UUID) RETURNS VOID AS $$
+BEGIN
+    DELETE FROM model_latest_file WHERE model_id = mid;
+    INSERT INTO model_latest_file (model_id, framework, framework_version, version_parts, files, size_bytes)
+    SELECT model_id, framework, framework_version, version_parts(framework_version), COUNT(*), SUM(size_bytes)
+    FROM file
+    WHERE model_id = mid AND status = 'latest'
+    GROUP BY model_id, framework, framework_version;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE FUNCTION model_latest_file_refresh() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP <> 'DELETE' THEN
+        PERFORM refresh_model_latest_file(NEW.model_id);
+    END IF;
+    IF TG_OP = 'DELETE' OR OLD.model_id IS DISTINCT FROM NEW.model_id THEN
+        PERFORM refresh_model_latest_file(OLD.model_id);
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+CREATE TRIGGER model_latest_file_refresh AFTER INSERT OR UPDATE OR DELETE ON file
+    FOR EACH ROW EXECUTE PROCEDURE model_latest_file_refresh();
+
+-- +goose StatementBegin
+CREATE FUNCTION model_latest_file_delete() RETURNS trigger AS $$
+BEGIN
+    DELETE FROM model_latest_file WHERE model_id = OLD.id;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+CREATE TRIGGER model_latest_file_delete AFTER DELETE ON model
+    FOR EACH ROW EXECUTE PROCEDURE model_latest_file_delete();
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+DROP TRIGGER model_latest_file_delete ON model;
+DROP TRIGGER model_latest_file_refresh ON file;
+DROP FUNCTION model_latest_file_delete();
+DROP FUNCTION model_latest_file_refresh();
+DROP FUNCTION refresh_model_latest_file(UUID);
+DROP TABLE model_latest_file;
+DROP FUNCTION version_parts(TEXT);
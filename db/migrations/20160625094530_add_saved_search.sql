@@ -0,0 +1,21 @@
+
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+CREATE TABLE saved_search (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL,
+    name TEXT NOT NULL,
+    query TEXT NOT NULL,
+    filter JSONB NOT NULL DEFAULT '{}'::JSONB,
+    notify BOOLEAN NOT NULL,
+    created_time TIMESTAMPTZ NOT NULL,
+    checked_time TIMESTAMPTZ NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES auth_user(id) ON DELETE CASCADE
+);
+
+CREATE INDEX saved_search_user_id_idx ON saved_search (user_id, created_time);
+CREATE INDEX saved_search_checked_idx ON saved_search (checked_time) WHERE notify;
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+DROP TABLE saved_search;
@@ -0,0 +1,11 @@
+
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+-- Names that only differ in case, spacing or punctuation, like "MNIST CNN" and
+-- "mnist-cnn", have the same key, which is how duplicates are spotted
+CREATE INDEX model_name_key_idx ON model (regexp_replace(lower(name), '[^a-z0-9]+', '', 'g'))
+    WHERE visibility = 'public';
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+DROP INDEX model_name_key_idx;
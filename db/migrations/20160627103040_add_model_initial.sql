@@ -0,0 +1,18 @@
+
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+-- The letter names are browsed under, or '#' for names that don't start with
+-- one
+CREATE FUNCTION name_initial(TEXT) RETURNS TEXT AS $$
+    SELECT CASE WHEN lower($1) ~ '^[a-z]' THEN substr(lower($1), 1, 1) ELSE '#' END
+$$ LANGUAGE SQL IMMUTABLE;
+
+CREATE INDEX model_public_initial_idx ON model (name_initial(name), LOWER(name), id)
+    WHERE visibility = 'public';
+CREATE INDEX auth_user_initial_idx ON auth_user (name_initial(username), LOWER(username), id);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+DROP INDEX auth_user_initial_idx;
+DROP INDEX model_public_initial_idx;
+DROP FUNCTION name_initial(TEXT);
@@ -0,0 +1,83 @@
+
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+-- The language of the readme on the model itself; translations of it into
+-- other languages are kept alongside
+ALTER TABLE model ADD COLUMN readme_language TEXT NOT NULL DEFAULT 'en';
+
+CREATE TABLE model_readme (
+    model_id UUID NOT NULL,
+    language TEXT NOT NULL,
+    readme TEXT NOT NULL,
+    updated_time TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (model_id, language),
+    FOREIGN KEY (model_id) REFERENCES model(id) ON DELETE CASCADE
+);
+
+-- Translations are searched along with the readme, weighted the same
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION model_search_update() RETURNS trigger AS $$
+DECLARE
+    vector TSVECTOR;
+BEGIN
+    vector :=
+        setweight(to_tsvector('english', coalesce(NEW.name, '')), 'A') ||
+        setweight(to_tsvector('english', replace(coalesce(NEW.slug, ''), '-', ' ')), 'A') ||
+        setweight(to_tsvector('english', coalesce(NEW.description, '')), 'B') ||
+        setweight(to_tsvector('english', coalesce(NEW.readme, '')), 'C') ||
+        setweight(to_tsvector('english', coalesce((
+            SELECT string_agg(readme, ' ') FROM model_readme WHERE model_id = NEW.id
+        ), '')), 'C');
+    UPDATE model_search SET search_vector = vector WHERE model_id = NEW.id;
+    IF NOT FOUND THEN
+        INSERT INTO model_search (model_id, search_vector) VALUES (NEW.id, vector);
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- Changing a translation counts as changing the model, which also brings its
+-- search vector and the search index up to date
+-- +goose StatementBegin
+CREATE FUNCTION model_readme_changed() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        UPDATE model SET updated_time = NOW() WHERE id = OLD.model_id;
+    ELSE
+        UPDATE model SET updated_time = NOW() WHERE id = NEW.model_id;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+CREATE TRIGGER model_readme_touch AFTER INSERT OR UPDATE OR DELETE ON model_readme
+    FOR EACH ROW EXECUTE PROCEDURE model_readme_changed();
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+DROP TRIGGER model_readme_touch ON model_readme;
+DROP FUNCTION model_readme_changed();
+
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION model_search_update() RETURNS trigger AS $$
+DECLARE
+    vector TSVECTOR;
+BEGIN
+    vector :=
+        setweight(to_tsvector('english', coalesce(NEW.name, '')), 'A') ||
+        setweight(to_tsvector('english', replace(coalesce(NEW.slug, ''), '-', ' ')), 'A') ||
+        setweight(to_tsvector('english', coalesce(NEW.description, '')), 'B') ||
+        setweight(to_tsvector('english', coalesce(NEW.readme, '')), 'C');
+    UPDATE model_search SET search_vector = vector WHERE model_id = NEW.id;
+    IF NOT FOUND THEN
+        INSERT INTO model_search (model_id, search_vector) VALUES (NEW.id, vector);
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+DROP TABLE model_readme;
+ALTER TABLE model DROP COLUMN readme_language;
@@ -0,0 +1,27 @@
+
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+CREATE TABLE job (
+    id UUID PRIMARY KEY,
+    kind VARCHAR(40) NOT NULL,
+    user_id UUID,
+    payload JSONB NOT NULL DEFAULT '{}'::JSONB,
+    status VARCHAR(10) NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    max_attempts INTEGER NOT NULL,
+    last_error TEXT NOT NULL DEFAULT '',
+    run_time TIMESTAMPTZ NOT NULL,
+    locked_until TIMESTAMPTZ,
+    created_time TIMESTAMPTZ NOT NULL,
+    finished_time TIMESTAMPTZ,
+    FOREIGN KEY (user_id) REFERENCES auth_user(id) ON DELETE CASCADE
+);
+
+CREATE INDEX job_queued_idx ON job (run_time) WHERE status = 'queued';
+CREATE INDEX job_running_idx ON job (locked_until) WHERE status = 'running';
+CREATE INDEX job_status_idx ON job (status, created_time DESC);
+CREATE INDEX job_user_id_idx ON job (user_id);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+DROP TABLE job;
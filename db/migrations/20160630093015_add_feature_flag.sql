@@ -0,0 +1,15 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+CREATE TABLE feature_flag (
+    name VARCHAR(64) PRIMARY KEY,
+    description TEXT NOT NULL DEFAULT '',
+    enabled BOOLEAN NOT NULL DEFAULT FALSE,
+    percent INTEGER NOT NULL DEFAULT 0,
+    user_ids JSONB NOT NULL DEFAULT '[]'::JSONB,
+    organization_ids JSONB NOT NULL DEFAULT '[]'::JSONB,
+    updated_time TIMESTAMPTZ NOT NULL
+);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+DROP TABLE feature_flag;
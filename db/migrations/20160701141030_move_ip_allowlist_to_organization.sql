@@ -0,0 +1,18 @@
+
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+-- Allowlists belong to organizations now, which enforce them on their members,
+-- so entries users made for themselves don't carry over
+DELETE FROM ip_allowlist;
+DROP INDEX ip_allowlist_user_id_idx;
+ALTER TABLE ip_allowlist DROP COLUMN user_id;
+ALTER TABLE ip_allowlist ADD COLUMN organization_id UUID NOT NULL REFERENCES organization(id) ON DELETE CASCADE;
+CREATE INDEX ip_allowlist_organization_id_idx ON ip_allowlist (organization_id);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+DELETE FROM ip_allowlist;
+DROP INDEX ip_allowlist_organization_id_idx;
+ALTER TABLE ip_allowlist DROP COLUMN organization_id;
+ALTER TABLE ip_allowlist ADD COLUMN user_id UUID NOT NULL REFERENCES auth_user(id) ON DELETE CASCADE;
+CREATE INDEX ip_allowlist_user_id_idx ON ip_allowlist (user_id);
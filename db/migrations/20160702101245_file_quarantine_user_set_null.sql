@@ -0,0 +1,25 @@
+
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+-- A takedown's history outlives the accounts of whoever took part in it
+ALTER TABLE file_quarantine ALTER COLUMN created_by DROP NOT NULL;
+ALTER TABLE file_quarantine DROP CONSTRAINT file_quarantine_created_by_fkey;
+ALTER TABLE file_quarantine ADD CONSTRAINT file_quarantine_created_by_fkey
+    FOREIGN KEY (created_by) REFERENCES auth_user(id) ON DELETE SET NULL;
+ALTER TABLE file_quarantine_event ALTER COLUMN user_id DROP NOT NULL;
+ALTER TABLE file_quarantine_event DROP CONSTRAINT file_quarantine_event_user_id_fkey;
+ALTER TABLE file_quarantine_event ADD CONSTRAINT file_quarantine_event_user_id_fkey
+    FOREIGN KEY (user_id) REFERENCES auth_user(id) ON DELETE SET NULL;
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+DELETE FROM file_quarantine_event WHERE user_id IS NULL;
+ALTER TABLE file_quarantine_event DROP CONSTRAINT file_quarantine_event_user_id_fkey;
+ALTER TABLE file_quarantine_event ADD CONSTRAINT file_quarantine_event_user_id_fkey
+    FOREIGN KEY (user_id) REFERENCES auth_user(id);
+ALTER TABLE file_quarantine_event ALTER COLUMN user_id SET NOT NULL;
+DELETE FROM file_quarantine WHERE created_by IS NULL;
+ALTER TABLE file_quarantine DROP CONSTRAINT file_quarantine_created_by_fkey;
+ALTER TABLE file_quarantine ADD CONSTRAINT file_quarantine_created_by_fkey
+    FOREIGN KEY (created_by) REFERENCES auth_user(id);
+ALTER TABLE file_quarantine ALTER COLUMN created_by SET NOT NULL;
@@ -0,0 +1,67 @@
+package errorreport
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Event is something that went wrong badly enough that someone should look
+// at it, like a panic while serving a request.
+type Event struct {
+	Message string
+	Stack   string
+	Time    time.Time
+
+	// What was being served, if anything
+	RequestId string
+	Method    string
+	Route     string
+	Url       string
+	Headers   map[string]string
+
+	// Who it was being served to, and what it was about, e.g. the model
+	UserId   string
+	Username string
+	Tags     map[string]string
+}
+
+// Reporter sends events somewhere they'll be noticed.  Reporting mustn't
+// block for long, since it's done while serving the request that failed.
+//
+//go:generate counterfeiter $GOFILE Reporter
+type Reporter interface {
+	Report(e *Event)
+}
+
+// Anything named like one of these is left out of events, whether it's a
+// header, a query param or a tag
+var secretName = regexp.MustCompile(`(?i)auth|cookie|csrf|key|passw|secret|session|signature|token`)
+
+const redacted = "[redacted]"
+
+// Scrub redacts the secrets an event could carry, e.g. tokens in headers or
+// the query string, before it leaves the server.
+func Scrub(e *Event) {
+	for _, m := range []map[string]string{e.Headers, e.Tags} {
+		for k := range m {
+			if secretName.MatchString(k) {
+				m[k] = redacted
+			}
+		}
+	}
+	if u, err := url.Parse(e.Url); err == nil {
+		q := u.Query()
+		for k := range q {
+			if secretName.MatchString(k) {
+				q.Set(k, redacted)
+			}
+		}
+		u.RawQuery = q.Encode()
+		u.User = nil
+		e.Url = u.String()
+	} else {
+		e.Url = strings.SplitN(e.Url, "?", 2)[0]
+	}
+}
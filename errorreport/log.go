@@ -0,0 +1,21 @@
+package errorreport
+
+import (
+	log "github.com/Sirupsen/logrus"
+)
+
+// LogReporter only logs events, for when there's nowhere else to send them.
+type LogReporter struct{}
+
+func NewLogReporter() *LogReporter {
+	return &LogReporter{}
+}
+
+func (r *LogReporter) Report(e *Event) {
+	log.WithFields(log.Fields{
+		"request_id": e.RequestId,
+		"route":      e.Route,
+		"user_id":    e.UserId,
+		"tags":       e.Tags,
+	}).Error(e.Message + "\n" + e.Stack)
+}
@@ -0,0 +1,12 @@
+package geoip
+
+// Unknown is the country of addresses that can't be placed, from the range
+// ISO 3166 leaves for private use
+const Unknown = "ZZ"
+
+// Locator places IP addresses in countries, as ISO 3166 alpha-2 codes.
+//
+//go:generate counterfeiter $GOFILE Locator
+type Locator interface {
+	Country(ip string) string
+}
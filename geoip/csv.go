@@ -0,0 +1,84 @@
+package geoip
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strings"
+)
+
+type ipRange struct {
+	start   net.IP
+	end     net.IP
+	country string
+}
+
+// CsvLocator looks addresses up in a table of ranges, loaded into memory from
+// a CSV file with rows of first address, last address, and country code, like
+// the free country databases from DB-IP.  IPv4 and IPv6 can be mixed.
+type CsvLocator struct {
+	ranges []ipRange
+}
+
+// LoadCsvLocator reads the ranges from the CSV file at path.
+func LoadCsvLocator(path string) (*CsvLocator, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	var ranges []ipRange
+	for line := 1; ; line++ {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(record) < 3 {
+			return nil, fmt.Errorf("%s:%d: expected first address, last address, country", path, line)
+		}
+		start := net.ParseIP(strings.TrimSpace(record[0])).To16()
+		end := net.ParseIP(strings.TrimSpace(record[1])).To16()
+		if start == nil || end == nil {
+			return nil, fmt.Errorf("%s:%d: invalid address", path, line)
+		}
+		country := strings.ToUpper(strings.TrimSpace(record[2]))
+		if len(country) != 2 {
+			country = Unknown
+		}
+		ranges = append(ranges, ipRange{start, end, country})
+	}
+
+	sort.Sort(byStart(ranges))
+	return &CsvLocator{ranges: ranges}, nil
+}
+
+func (l *CsvLocator) Country(ip string) string {
+	addr := net.ParseIP(ip).To16()
+	if addr == nil {
+		return Unknown
+	}
+	// Find the last range starting at or before the address
+	i := sort.Search(len(l.ranges), func(i int) bool {
+		return bytes.Compare(l.ranges[i].start, addr) > 0
+	}) - 1
+	if i < 0 || bytes.Compare(addr, l.ranges[i].end) > 0 {
+		return Unknown
+	}
+	return l.ranges[i].country
+}
+
+type byStart []ipRange
+
+func (r byStart) Len() int           { return len(r) }
+func (r byStart) Swap(i, j int)      { r[i], r[j] = r[j], r[i] }
+func (r byStart) Less(i, j int) bool { return bytes.Compare(r[i].start, r[j].start) < 0 }
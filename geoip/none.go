@@ -0,0 +1,12 @@
+package geoip
+
+// NoLocator can't place anything, for when there's no GeoIP database.
+type NoLocator struct{}
+
+func NewNoLocator() *NoLocator {
+	return &NoLocator{}
+}
+
+func (l *NoLocator) Country(ip string) string {
+	return Unknown
+}
@@ -0,0 +1,418 @@
+package graphql
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// Result is what's sent back for a query.
+type Result struct {
+	Data   interface{} `json:"data,omitempty"`
+	Errors []*Error    `json:"errors,omitempty"`
+}
+
+// Error is something that went wrong, at the path of the field it went wrong
+// in, if any.
+type Error struct {
+	Message string        `json:"message"`
+	Path    []interface{} `json:"path,omitempty"`
+}
+
+// fields keeps the order they were selected in, which results have to follow.
+type fields struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+func (f *fields) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, key := range f.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		k, err := json.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+		v, err := json.Marshal(f.values[key])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(k)
+		buf.WriteByte(':')
+		buf.Write(v)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+func (f *fields) set(key string, value interface{}) {
+	if _, ok := f.values[key]; !ok {
+		f.keys = append(f.keys, key)
+	}
+	f.values[key] = value
+}
+
+type executor struct {
+	schema *Schema
+	ctx    interface{}
+	doc    *Document
+	vars   map[string]interface{}
+	errors []*Error
+
+	// The fields each fragment selects on each type, by fragment and type
+	// name, so that a fragment spread all over a query is collected once
+	fragments map[string][]*collected
+}
+
+// Execute runs the named operation (which can be left empty when there's
+// only one) in the document.
+func Execute(schema *Schema, ctx interface{}, doc *Document, operationName string, variables map[string]interface{}) *Result {
+	var op *Operation
+	for _, o := range doc.Operations {
+		if operationName == "" || o.Name == operationName {
+			if op != nil {
+				return errorResult("An operation name is needed when there's more than one operation")
+			}
+			op = o
+		}
+	}
+	if op == nil {
+		return errorResult(fmt.Sprintf("There's no operation named %q", operationName))
+	}
+	if op.Type != "query" {
+		return errorResult("Only queries are supported")
+	}
+
+	// Variables that weren't given fall back to their defaults
+	vars := map[string]interface{}{}
+	for _, def := range op.Variables {
+		if v, ok := variables[def.Name]; ok {
+			vars[def.Name] = v
+		} else {
+			vars[def.Name] = def.Default
+		}
+	}
+
+	if err := measure(schema, doc, op); err != nil {
+		return errorResult(err.Error())
+	}
+
+	e := &executor{schema: schema, ctx: ctx, doc: doc, vars: vars,
+		fragments: map[string][]*collected{}}
+	data := e.executeObjects(schema.Query, []interface{}{nil}, [][]interface{}{nil}, op.Selections, 1)
+	return &Result{Data: data[0], Errors: e.errors}
+}
+
+// Do parses and executes a query.
+func Do(schema *Schema, ctx interface{}, query, operationName string, variables map[string]interface{}) *Result {
+	doc, err := Parse(query)
+	if err != nil {
+		return errorResult(err.Error())
+	}
+	return Execute(schema, ctx, doc, operationName, variables)
+}
+
+func errorResult(msg string) *Result {
+	return &Result{Errors: []*Error{{Message: msg}}}
+}
+
+func (e *executor) errorf(path []interface{}, format string, args ...interface{}) {
+	e.errors = append(e.errors, &Error{Message: fmt.Sprintf(format, args...), Path: path})
+}
+
+func appendPath(path []interface{}, elem interface{}) []interface{} {
+	p := make([]interface{}, len(path), len(path)+1)
+	copy(p, path)
+	return append(p, elem)
+}
+
+// value fills in the variables in a parsed value.
+func (e *executor) value(v interface{}) interface{} {
+	switch v := v.(type) {
+	case Variable:
+		return e.vars[string(v)]
+	case []interface{}:
+		list := make([]interface{}, len(v))
+		for i, item := range v {
+			list[i] = e.value(item)
+		}
+		return list
+	case map[string]interface{}:
+		obj := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			obj[k] = e.value(item)
+		}
+		return obj
+	}
+	return v
+}
+
+func (e *executor) args(raw map[string]interface{}) Args {
+	args := make(Args, len(raw))
+	for k, v := range raw {
+		args[k] = e.value(v)
+	}
+	return args
+}
+
+// included checks @skip and @include.
+func (e *executor) included(dirs []*Directive) bool {
+	for _, d := range dirs {
+		args := e.args(d.Args)
+		if d.Name == "skip" && args.Bool("if", false) {
+			return false
+		}
+		if d.Name == "include" && !args.Bool("if", true) {
+			return false
+		}
+	}
+	return true
+}
+
+type collected struct {
+	key   string
+	nodes []*FieldNode
+}
+
+// merge adds a field node under its response key, unless it's already there
+// from the same fragment being spread more than once.
+func merge(into []*collected, key string, node *FieldNode) []*collected {
+	for _, c := range into {
+		if c.key != key {
+			continue
+		}
+		for _, n := range c.nodes {
+			if n == node {
+				return into
+			}
+		}
+		c.nodes = append(c.nodes, node)
+		return into
+	}
+	return append(into, &collected{key: key, nodes: []*FieldNode{node}})
+}
+
+// collect flattens fragments into the fields selected on obj, merging the
+// ones with the same response key.  A fragment spread again in the same
+// selection can only select the same fields again, so it's skipped, as seen
+// keeps track of.
+func (e *executor) collect(obj *Object, sels []Selection, into []*collected, seen map[string]bool) []*collected {
+	for _, sel := range sels {
+		switch sel := sel.(type) {
+		case *FieldNode:
+			if !e.included(sel.Directives) {
+				continue
+			}
+			key := sel.Alias
+			if key == "" {
+				key = sel.Name
+			}
+			into = merge(into, key, sel)
+		case *InlineFragment:
+			if !e.included(sel.Directives) {
+				continue
+			}
+			if sel.TypeCondition != "" && sel.TypeCondition != obj.Name {
+				continue
+			}
+			into = e.collect(obj, sel.Selections, into, seen)
+		case *FragmentSpread:
+			if seen[sel.Name] || !e.included(sel.Directives) {
+				continue
+			}
+			frag, ok := e.doc.Fragments[sel.Name]
+			if !ok {
+				e.errorf(nil, "There's no fragment named %q", sel.Name)
+				continue
+			}
+			if frag.TypeCondition != obj.Name || !e.included(frag.Directives) {
+				continue
+			}
+			seen[sel.Name] = true
+			for _, c := range e.fragmentFields(obj, frag) {
+				for _, node := range c.nodes {
+					into = merge(into, c.key, node)
+				}
+			}
+		}
+	}
+	return into
+}
+
+// fragmentFields collects the fields the fragment selects on obj, the first
+// time it's spread on obj.  measure has already made sure that fragments
+// don't spread themselves, so what they select doesn't depend on where.
+func (e *executor) fragmentFields(obj *Object, frag *Fragment) []*collected {
+	key := frag.Name + " on " + obj.Name
+	if fields, ok := e.fragments[key]; ok {
+		return fields
+	}
+	fields := e.collect(obj, frag.Selections, nil, map[string]bool{frag.Name: true})
+	e.fragments[key] = fields
+	return fields
+}
+
+// executeObjects resolves the selections on every one of the sources, all of
+// which are obj, at once, so batched fields are resolved once per level of the
+// query rather than once per source.
+func (e *executor) executeObjects(obj *Object, sources []interface{}, paths [][]interface{}, sels []Selection, depth int) []*fields {
+	results := make([]*fields, len(sources))
+	for i := range results {
+		results[i] = &fields{values: map[string]interface{}{}}
+	}
+	if e.schema.MaxDepth > 0 && depth > e.schema.MaxDepth {
+		e.errorf(paths[0], "Queries can't be nested more than %d deep", e.schema.MaxDepth)
+		return results
+	}
+
+	for _, c := range e.collect(obj, sels, nil, map[string]bool{}) {
+		node := c.nodes[0]
+		if node.Name == "__typename" {
+			for _, r := range results {
+				r.set(c.key, obj.Name)
+			}
+			continue
+		}
+		field, ok := obj.Fields[node.Name]
+		if !ok {
+			e.errorf(nil, "%s has no field named %q", obj.Name, node.Name)
+			continue
+		}
+
+		// Fields merged under one key share arguments, but not selections
+		var subSels []Selection
+		for _, n := range c.nodes {
+			subSels = append(subSels, n.Selections...)
+		}
+		fieldPaths := make([][]interface{}, len(sources))
+		for i := range sources {
+			fieldPaths[i] = appendPath(paths[i], c.key)
+		}
+
+		values := e.resolve(field, sources, fieldPaths, e.args(node.Args))
+		values = e.complete(field.Type, values, fieldPaths, subSels, depth)
+		for i, r := range results {
+			r.set(c.key, values[i])
+		}
+	}
+	return results
+}
+
+func (e *executor) resolve(field *Field, sources []interface{}, paths [][]interface{}, args Args) []interface{} {
+	if field.Batch != nil {
+		values, err := field.Batch(&BatchParams{Context: e.ctx, Sources: sources, Args: args})
+		if err == nil && len(values) != len(sources) {
+			err = fmt.Errorf("Resolved %d values for %d sources", len(values), len(sources))
+		}
+		if err != nil {
+			for _, path := range paths {
+				e.errorf(path, "%s", err)
+			}
+			return make([]interface{}, len(sources))
+		}
+		return values
+	}
+
+	values := make([]interface{}, len(sources))
+	for i, source := range sources {
+		if field.Resolve == nil {
+			continue
+		}
+		v, err := field.Resolve(&Params{Context: e.ctx, Source: source, Args: args})
+		if err != nil {
+			e.errorf(paths[i], "%s", err)
+			continue
+		}
+		values[i] = v
+	}
+	return values
+}
+
+func isNil(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Map, reflect.Interface:
+		return rv.IsNil()
+	}
+	return false
+}
+
+// complete turns resolved values of type t into what's sent back.  Objects
+// and lists are gathered up across all of the values so that each level of
+// the query below is still executed once.
+func (e *executor) complete(t Type, values []interface{}, paths [][]interface{}, sels []Selection, depth int) []interface{} {
+	out := make([]interface{}, len(values))
+	switch t := t.(type) {
+	case *Scalar:
+		if len(sels) > 0 && len(paths) > 0 {
+			e.errorf(paths[0], "%s can't have a selection of subfields", t)
+			return out
+		}
+		for i, v := range values {
+			if !isNil(v) {
+				out[i] = v
+			}
+		}
+	case *Object:
+		if len(sels) == 0 {
+			if len(paths) > 0 {
+				e.errorf(paths[0], "%s needs a selection of subfields", t)
+			}
+			return out
+		}
+		var sources []interface{}
+		var sourcePaths [][]interface{}
+		var indexes []int
+		for i, v := range values {
+			if isNil(v) {
+				continue
+			}
+			sources = append(sources, v)
+			sourcePaths = append(sourcePaths, paths[i])
+			indexes = append(indexes, i)
+		}
+		if len(sources) == 0 {
+			return out
+		}
+		for j, r := range e.executeObjects(t, sources, sourcePaths, sels, depth+1) {
+			out[indexes[j]] = r
+		}
+	case *List:
+		var items []interface{}
+		var itemPaths [][]interface{}
+		lengths := make([]int, len(values))
+		for i, v := range values {
+			lengths[i] = -1
+			if isNil(v) {
+				continue
+			}
+			rv := reflect.ValueOf(v)
+			if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+				e.errorf(paths[i], "Resolved a %T for a list", v)
+				continue
+			}
+			lengths[i] = rv.Len()
+			for j := 0; j < rv.Len(); j++ {
+				items = append(items, rv.Index(j).Interface())
+				itemPaths = append(itemPaths, appendPath(paths[i], j))
+			}
+		}
+		completed := e.complete(t.Of, items, itemPaths, sels, depth)
+		n := 0
+		for i, length := range lengths {
+			if length < 0 {
+				continue
+			}
+			out[i] = completed[n : n+length]
+			n += length
+		}
+	}
+	return out
+}
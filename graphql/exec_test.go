@@ -0,0 +1,198 @@
+package graphql
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testModel struct {
+	Id     string
+	Name   string
+	UserId string
+}
+
+// testSchema has models, and users that are looked up in batches, counting
+// how many batches it took.
+func testSchema() (*Schema, *int) {
+	batches := 0
+	user := &Object{Name: "User", Fields: map[string]*Field{
+		"username": {Type: String, Resolve: func(p *Params) (interface{}, error) {
+			return p.Source, nil
+		}},
+	}}
+	model := &Object{Name: "Model"}
+	model.Fields = map[string]*Field{
+		"id": {Type: ID, Resolve: func(p *Params) (interface{}, error) {
+			return p.Source.(*testModel).Id, nil
+		}},
+		"name": {Type: String, Resolve: func(p *Params) (interface{}, error) {
+			return p.Source.(*testModel).Name, nil
+		}},
+		"user": {Type: user, Batch: func(p *BatchParams) ([]interface{}, error) {
+			batches++
+			users := make([]interface{}, len(p.Sources))
+			for i, source := range p.Sources {
+				users[i] = source.(*testModel).UserId
+			}
+			return users, nil
+		}},
+		"broken": {Type: String, Resolve: func(p *Params) (interface{}, error) {
+			return nil, errors.New("Broken")
+		}},
+	}
+	models := []*testModel{
+		{Id: "1", Name: "mnist", UserId: "ada"},
+		{Id: "2", Name: "cifar", UserId: "grace"},
+	}
+	query := &Object{Name: "Query", Fields: map[string]*Field{
+		"models": {Type: ListOf(model), Resolve: func(p *Params) (interface{}, error) {
+			limit := p.Args.Int("limit", len(models))
+			if limit > len(models) {
+				limit = len(models)
+			}
+			return models[:limit], nil
+		}},
+		"model": {Type: model, Resolve: func(p *Params) (interface{}, error) {
+			for _, m := range models {
+				if m.Id == p.Args.String("id") {
+					return m, nil
+				}
+			}
+			return nil, nil
+		}},
+	}}
+	return &Schema{Query: query}, &batches
+}
+
+// run executes the query and returns the result as JSON.
+func run(t *testing.T, schema *Schema, query string, vars map[string]interface{}) string {
+	result := Do(schema, nil, query, "", vars)
+	encoded, err := json.Marshal(result)
+	if err != nil {
+		t.Fatalf("Could not encode result of %s: %v", query, err)
+	}
+	return string(encoded)
+}
+
+func TestExecute(t *testing.T) {
+	schema, batches := testSchema()
+	tests := []struct {
+		query string
+		vars  map[string]interface{}
+		want  string
+	}{
+		{`{ models { id name } }`,
+			nil,
+			`{"data":{"models":[{"id":"1","name":"mnist"},{"id":"2","name":"cifar"}]}}`},
+		// Results follow the order fields are selected in
+		{`{ first: model(id: "2") { name, __typename } missing: model(id: "3") { id } }`,
+			nil,
+			`{"data":{"first":{"name":"cifar","__typename":"Model"},"missing":null}}`},
+		{`query ($n: Int = 2) { models(limit: $n) { id } }`,
+			map[string]interface{}{"n": 1.0},
+			`{"data":{"models":[{"id":"1"}]}}`},
+		{`query ($n: Int = 1) { models(limit: $n) { id } }`,
+			nil,
+			`{"data":{"models":[{"id":"1"}]}}`},
+		{`{ models(limit: 1) { ...Names ... on Model { id } ... on User { username } } }
+		  fragment Names on Model { name }`,
+			nil,
+			`{"data":{"models":[{"name":"mnist","id":"1"}]}}`},
+		// Fields selected more than once are merged, selections and all
+		{`{ model(id: "1") { user { username } id user { username } } }`,
+			nil,
+			`{"data":{"model":{"user":{"username":"ada"},"id":"1"}}}`},
+		{`query ($skip: Boolean) { models(limit: 1) { id @skip(if: $skip) name @include(if: false) } }`,
+			map[string]interface{}{"skip": true},
+			`{"data":{"models":[{}]}}`},
+	}
+	for _, test := range tests {
+		if got := run(t, schema, test.query, test.vars); got != test.want {
+			t.Errorf("%s\n got %s\nwant %s", test.query, got, test.want)
+		}
+	}
+
+	// Users are resolved for every model at once
+	*batches = 0
+	want := `{"data":{"models":[{"user":{"username":"ada"}},{"user":{"username":"grace"}}]}}`
+	if got := run(t, schema, `{ models { user { username } } }`, nil); got != want {
+		t.Errorf("Got %s, want %s", got, want)
+	}
+	if *batches != 1 {
+		t.Errorf("Resolved users in %d batches, want 1", *batches)
+	}
+}
+
+func TestExecuteErrors(t *testing.T) {
+	schema, _ := testSchema()
+	schema.MaxDepth = 2
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{`{ nope }`, `Query has no field named \"nope\"`},
+		{`{ models { id { x } } }`, `ID can't have a selection of subfields`},
+		{`{ models }`, `Model needs a selection of subfields`},
+		{`{ model(id: "1") { broken } }`, `{"message":"Broken","path":["model","broken"]}`},
+		{`{ models { ...Nope } }`, `There's no fragment named \"Nope\"`},
+		{`{ model(id: "1") { user { username } } }`, `nested more than 2 deep`},
+		{`mutation { models { id } }`, `Only queries are supported`},
+		{`query A { models { id } } query B { models { id } }`, `An operation name is needed`},
+	}
+	for _, test := range tests {
+		if got := run(t, schema, test.query, nil); !strings.Contains(got, test.want) {
+			t.Errorf("%s\n got %s\nwant it to contain %s", test.query, got, test.want)
+		}
+	}
+}
+
+// fragmentChain is a query with n fragments, each spreading the next twice,
+// which selects 2^n fields once the fragments are expanded.
+func fragmentChain(n int) string {
+	query := "{ ...F0 }\n"
+	for i := 0; i < n; i++ {
+		query += fmt.Sprintf("fragment F%d on Query { ...F%d ...F%d }\n", i, i+1, i+1)
+	}
+	return query + fmt.Sprintf("fragment F%d on Query { models { id } }\n", n)
+}
+
+func TestExecuteRepeatedFragments(t *testing.T) {
+	schema, _ := testSchema()
+	query := fragmentChain(60)
+
+	// Without a limit it's still executed in no time, since each fragment
+	// is only collected once
+	start := time.Now()
+	want := `{"data":{"models":[{"id":"1"},{"id":"2"}]}}`
+	if got := run(t, schema, query, nil); got != want {
+		t.Errorf("Got %s, want %s", got, want)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Took %s to execute", elapsed)
+	}
+
+	schema.MaxComplexity = 100
+	want = `{"errors":[{"message":"Queries can't select more than 100 fields"}]}`
+	if got := run(t, schema, query, nil); got != want {
+		t.Errorf("Got %s, want %s", got, want)
+	}
+	if got := run(t, schema, fragmentChain(5), nil); strings.Contains(got, "errors") {
+		t.Errorf("Refused a query within the limit: %s", got)
+	}
+}
+
+func TestExecuteFragmentCycles(t *testing.T) {
+	schema, _ := testSchema()
+	for _, query := range []string{
+		`{ ...A } fragment A on Query { ...A }`,
+		`{ ...A } fragment A on Query { ...B } fragment B on Query { models { id } ...A }`,
+	} {
+		if got := run(t, schema, query, nil); !strings.Contains(got, "spreads itself") {
+			t.Errorf("%s\n got %s\nwant it refused", query, got)
+		}
+	}
+}
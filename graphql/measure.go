@@ -0,0 +1,118 @@
+package graphql
+
+import "fmt"
+
+// measurer works out how many fields an operation selects without executing
+// it, counting a fragment's fields every time it's spread.  Each fragment is
+// only measured once per type, so a small query that multiplies out to a huge
+// number of fields is cheap to measure and refuse.
+type measurer struct {
+	doc   *Document
+	limit int
+
+	// How many fields each fragment selects, by fragment and type name
+	sizes map[string]int
+
+	// The fragments being measured, to catch ones that spread themselves
+	spreading map[string]bool
+}
+
+// measure refuses operations with fragments that spread themselves, which
+// would never finish, and ones that select more fields than the schema's
+// MaxComplexity.
+func measure(schema *Schema, doc *Document, op *Operation) error {
+	m := &measurer{
+		doc:       doc,
+		limit:     schema.MaxComplexity,
+		sizes:     map[string]int{},
+		spreading: map[string]bool{},
+	}
+	size, err := m.size(schema.Query, op.Selections)
+	if err != nil {
+		return err
+	}
+	if m.limit > 0 && size > m.limit {
+		return fmt.Errorf("Queries can't select more than %d fields", m.limit)
+	}
+	return nil
+}
+
+// add adds up sizes, stopping just past the limit so they can't overflow.
+func (m *measurer) add(a, b int) int {
+	max := int(^uint(0) >> 1)
+	if m.limit > 0 {
+		max = m.limit + 1
+	}
+	if a > max-b {
+		return max
+	}
+	return a + b
+}
+
+func (m *measurer) size(obj *Object, sels []Selection) (int, error) {
+	n := 0
+	for _, sel := range sels {
+		var size int
+		var err error
+		switch sel := sel.(type) {
+		case *FieldNode:
+			size = 1
+			// Unknown fields are left for the executor to complain about
+			if field, ok := obj.Fields[sel.Name]; ok && len(sel.Selections) > 0 {
+				if sub := objectOf(field.Type); sub != nil {
+					var subSize int
+					subSize, err = m.size(sub, sel.Selections)
+					size = m.add(size, subSize)
+				}
+			}
+		case *InlineFragment:
+			if sel.TypeCondition == "" || sel.TypeCondition == obj.Name {
+				size, err = m.size(obj, sel.Selections)
+			}
+		case *FragmentSpread:
+			size, err = m.fragment(obj, sel.Name)
+		}
+		if err != nil {
+			return 0, err
+		}
+		n = m.add(n, size)
+	}
+	return n, nil
+}
+
+func (m *measurer) fragment(obj *Object, name string) (int, error) {
+	frag, ok := m.doc.Fragments[name]
+	if !ok || frag.TypeCondition != obj.Name {
+		return 0, nil
+	}
+	key := name + " on " + obj.Name
+	if size, ok := m.sizes[key]; ok {
+		return size, nil
+	}
+	if m.spreading[name] {
+		return 0, fmt.Errorf("Fragment %q spreads itself", name)
+	}
+	m.spreading[name] = true
+	size, err := m.size(obj, frag.Selections)
+	delete(m.spreading, name)
+	if err != nil {
+		return 0, err
+	}
+	m.sizes[key] = size
+	return size, nil
+}
+
+// objectOf is the object a field's values are, through any lists, or nil if
+// they're scalars.
+func objectOf(t Type) *Object {
+	for {
+		switch tt := t.(type) {
+		case *Object:
+			return tt
+		case *List:
+			t = tt.Of
+		default:
+			return nil
+		}
+	}
+}
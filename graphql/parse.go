@@ -0,0 +1,665 @@
+package graphql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Document is a parsed query document.
+type Document struct {
+	Operations []*Operation
+	Fragments  map[string]*Fragment
+}
+
+// Operation is a query (or, unsupported here, a mutation or subscription).
+type Operation struct {
+	Type       string
+	Name       string
+	Variables  []*VariableDef
+	Selections []Selection
+}
+
+// VariableDef declares a variable and its default.  Its type is parsed but
+// not checked; resolvers validate their own arguments.
+type VariableDef struct {
+	Name    string
+	Default interface{}
+}
+
+// Fragment is a named fragment.
+type Fragment struct {
+	Name          string
+	TypeCondition string
+	Directives    []*Directive
+	Selections    []Selection
+}
+
+// Selection is a *FieldNode, *FragmentSpread, or *InlineFragment.
+type Selection interface{}
+
+// FieldNode is a field being selected.
+type FieldNode struct {
+	Alias      string
+	Name       string
+	Args       map[string]interface{}
+	Directives []*Directive
+	Selections []Selection
+}
+
+// FragmentSpread is a ...Name spread of a named fragment.
+type FragmentSpread struct {
+	Name       string
+	Directives []*Directive
+}
+
+// InlineFragment is a ... on Type { } selection.
+type InlineFragment struct {
+	TypeCondition string
+	Directives    []*Directive
+	Selections    []Selection
+}
+
+// Directive is e.g. @include(if: $flag).
+type Directive struct {
+	Name string
+	Args map[string]interface{}
+}
+
+// Variable is a reference to a variable in a value.
+type Variable string
+
+// Enum is an enum value, which resolvers see as a string.
+type Enum string
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokPunct
+	tokName
+	tokInt
+	tokFloat
+	tokString
+)
+
+type token struct {
+	kind  tokenKind
+	value string
+	pos   int
+}
+
+type lexer struct {
+	src string
+	pos int
+}
+
+func (l *lexer) errorf(pos int, format string, args ...interface{}) error {
+	return fmt.Errorf("Syntax error at position %d: %s", pos, fmt.Sprintf(format, args...))
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z')
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func (l *lexer) next() (token, error) {
+	// Skip whitespace, commas, and comments, which are all insignificant
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		if c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',' {
+			l.pos++
+		} else if c == '#' {
+			for l.pos < len(l.src) && l.src[l.pos] != '\n' && l.src[l.pos] != '\r' {
+				l.pos++
+			}
+		} else if strings.HasPrefix(l.src[l.pos:], "\uFEFF") {
+			l.pos += len("\uFEFF")
+		} else {
+			break
+		}
+	}
+	start := l.pos
+	if l.pos >= len(l.src) {
+		return token{kind: tokEOF, pos: start}, nil
+	}
+
+	c := l.src[l.pos]
+	switch {
+	case strings.IndexByte("!$()[]{}:=@|&", c) >= 0:
+		l.pos++
+		return token{kind: tokPunct, value: string(c), pos: start}, nil
+	case c == '.':
+		if !strings.HasPrefix(l.src[l.pos:], "...") {
+			return token{}, l.errorf(start, "unexpected %q", c)
+		}
+		l.pos += 3
+		return token{kind: tokPunct, value: "...", pos: start}, nil
+	case isNameStart(c):
+		for l.pos < len(l.src) && (isNameStart(l.src[l.pos]) || isDigit(l.src[l.pos])) {
+			l.pos++
+		}
+		return token{kind: tokName, value: l.src[start:l.pos], pos: start}, nil
+	case c == '-' || isDigit(c):
+		return l.number()
+	case c == '"':
+		return l.string()
+	}
+	r, _ := utf8.DecodeRuneInString(l.src[l.pos:])
+	return token{}, l.errorf(start, "unexpected %q", r)
+}
+
+func (l *lexer) digits() int {
+	start := l.pos
+	for l.pos < len(l.src) && isDigit(l.src[l.pos]) {
+		l.pos++
+	}
+	return l.pos - start
+}
+
+func (l *lexer) number() (token, error) {
+	start := l.pos
+	kind := tokInt
+	if l.src[l.pos] == '-' {
+		l.pos++
+	}
+	if l.digits() == 0 {
+		return token{}, l.errorf(start, "invalid number")
+	}
+	if l.pos < len(l.src) && l.src[l.pos] == '.' {
+		kind = tokFloat
+		l.pos++
+		if l.digits() == 0 {
+			return token{}, l.errorf(start, "invalid number")
+		}
+	}
+	if l.pos < len(l.src) && (l.src[l.pos] == 'e' || l.src[l.pos] == 'E') {
+		kind = tokFloat
+		l.pos++
+		if l.pos < len(l.src) && (l.src[l.pos] == '+' || l.src[l.pos] == '-') {
+			l.pos++
+		}
+		if l.digits() == 0 {
+			return token{}, l.errorf(start, "invalid number")
+		}
+	}
+	return token{kind: kind, value: l.src[start:l.pos], pos: start}, nil
+}
+
+func (l *lexer) string() (token, error) {
+	start := l.pos
+
+	// Block strings are taken as they are, apart from escaped triple quotes
+	if strings.HasPrefix(l.src[l.pos:], `"""`) {
+		end := strings.Index(l.src[l.pos+3:], `"""`)
+		for end >= 0 && strings.HasSuffix(l.src[l.pos+3:l.pos+3+end], `\`) {
+			next := strings.Index(l.src[l.pos+3+end+3:], `"""`)
+			if next < 0 {
+				end = -1
+				break
+			}
+			end += 3 + next
+		}
+		if end < 0 {
+			return token{}, l.errorf(start, "unterminated string")
+		}
+		value := strings.Replace(l.src[l.pos+3:l.pos+3+end], `\"""`, `"""`, -1)
+		l.pos += 3 + end + 3
+		return token{kind: tokString, value: value, pos: start}, nil
+	}
+
+	l.pos++
+	var buf []byte
+	for {
+		if l.pos >= len(l.src) || l.src[l.pos] == '\n' || l.src[l.pos] == '\r' {
+			return token{}, l.errorf(start, "unterminated string")
+		}
+		c := l.src[l.pos]
+		if c == '"' {
+			l.pos++
+			return token{kind: tokString, value: string(buf), pos: start}, nil
+		}
+		if c != '\\' {
+			buf = append(buf, c)
+			l.pos++
+			continue
+		}
+		if l.pos+1 >= len(l.src) {
+			return token{}, l.errorf(start, "unterminated string")
+		}
+		esc := l.src[l.pos+1]
+		l.pos += 2
+		switch esc {
+		case '"', '\\', '/':
+			buf = append(buf, esc)
+		case 'b':
+			buf = append(buf, '\b')
+		case 'f':
+			buf = append(buf, '\f')
+		case 'n':
+			buf = append(buf, '\n')
+		case 'r':
+			buf = append(buf, '\r')
+		case 't':
+			buf = append(buf, '\t')
+		case 'u':
+			if l.pos+4 > len(l.src) {
+				return token{}, l.errorf(l.pos, "invalid unicode escape")
+			}
+			n, err := strconv.ParseUint(l.src[l.pos:l.pos+4], 16, 32)
+			if err != nil {
+				return token{}, l.errorf(l.pos, "invalid unicode escape")
+			}
+			var rb [utf8.UTFMax]byte
+			buf = append(buf, rb[:utf8.EncodeRune(rb[:], rune(n))]...)
+			l.pos += 4
+		default:
+			return token{}, l.errorf(l.pos-2, "invalid escape %q", esc)
+		}
+	}
+}
+
+type parser struct {
+	lex *lexer
+	tok token
+}
+
+// Parse parses a query document.
+func Parse(src string) (*Document, error) {
+	p := &parser{lex: &lexer{src: src}}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	doc := &Document{Fragments: map[string]*Fragment{}}
+	for p.tok.kind != tokEOF {
+		if p.peek(tokPunct, "{") {
+			sels, err := p.selectionSet()
+			if err != nil {
+				return nil, err
+			}
+			doc.Operations = append(doc.Operations, &Operation{Type: "query", Selections: sels})
+			continue
+		}
+		if p.tok.kind != tokName {
+			return nil, p.unexpected()
+		}
+		switch p.tok.value {
+		case "query", "mutation", "subscription":
+			op, err := p.operation()
+			if err != nil {
+				return nil, err
+			}
+			doc.Operations = append(doc.Operations, op)
+		case "fragment":
+			frag, err := p.fragment()
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := doc.Fragments[frag.Name]; ok {
+				return nil, fmt.Errorf("There can only be one fragment named %q", frag.Name)
+			}
+			doc.Fragments[frag.Name] = frag
+		default:
+			return nil, p.unexpected()
+		}
+	}
+	if len(doc.Operations) == 0 {
+		return nil, fmt.Errorf("The document has no operations")
+	}
+	return doc, nil
+}
+
+func (p *parser) advance() error {
+	tok, err := p.lex.next()
+	if err != nil {
+		return err
+	}
+	p.tok = tok
+	return nil
+}
+
+func (p *parser) peek(kind tokenKind, value string) bool {
+	return p.tok.kind == kind && p.tok.value == value
+}
+
+func (p *parser) unexpected() error {
+	if p.tok.kind == tokEOF {
+		return p.lex.errorf(p.tok.pos, "unexpected end of document")
+	}
+	return p.lex.errorf(p.tok.pos, "unexpected %q", p.tok.value)
+}
+
+// expect consumes the punctuator, or fails if it's something else.
+func (p *parser) expect(value string) error {
+	if !p.peek(tokPunct, value) {
+		return p.unexpected()
+	}
+	return p.advance()
+}
+
+// skip consumes the punctuator if it's next, saying whether it was.
+func (p *parser) skip(value string) (bool, error) {
+	if !p.peek(tokPunct, value) {
+		return false, nil
+	}
+	return true, p.advance()
+}
+
+func (p *parser) name() (string, error) {
+	if p.tok.kind != tokName {
+		return "", p.unexpected()
+	}
+	name := p.tok.value
+	return name, p.advance()
+}
+
+func (p *parser) operation() (*Operation, error) {
+	op := &Operation{Type: p.tok.value}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	var err error
+	if p.tok.kind == tokName {
+		if op.Name, err = p.name(); err != nil {
+			return nil, err
+		}
+	}
+	if ok, err := p.skip("("); err != nil {
+		return nil, err
+	} else if ok {
+		for !p.peek(tokPunct, ")") {
+			def, err := p.variableDef()
+			if err != nil {
+				return nil, err
+			}
+			op.Variables = append(op.Variables, def)
+		}
+		if err = p.advance(); err != nil {
+			return nil, err
+		}
+	}
+	if _, err = p.directives(); err != nil {
+		return nil, err
+	}
+	if op.Selections, err = p.selectionSet(); err != nil {
+		return nil, err
+	}
+	return op, nil
+}
+
+func (p *parser) variableDef() (*VariableDef, error) {
+	if err := p.expect("$"); err != nil {
+		return nil, err
+	}
+	name, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+	if err = p.expect(":"); err != nil {
+		return nil, err
+	}
+	if err = p.typeRef(); err != nil {
+		return nil, err
+	}
+	def := &VariableDef{Name: name}
+	if ok, err := p.skip("="); err != nil {
+		return nil, err
+	} else if ok {
+		if def.Default, err = p.value(true); err != nil {
+			return nil, err
+		}
+	}
+	if _, err = p.directives(); err != nil {
+		return nil, err
+	}
+	return def, nil
+}
+
+func (p *parser) typeRef() error {
+	if ok, err := p.skip("["); err != nil {
+		return err
+	} else if ok {
+		if err = p.typeRef(); err != nil {
+			return err
+		}
+		if err = p.expect("]"); err != nil {
+			return err
+		}
+	} else if _, err = p.name(); err != nil {
+		return err
+	}
+	_, err := p.skip("!")
+	return err
+}
+
+func (p *parser) fragment() (*Fragment, error) {
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	name, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+	if name == "on" {
+		return nil, p.lex.errorf(p.tok.pos, "a fragment can't be named \"on\"")
+	}
+	if !p.peek(tokName, "on") {
+		return nil, p.unexpected()
+	}
+	if err = p.advance(); err != nil {
+		return nil, err
+	}
+	frag := &Fragment{Name: name}
+	if frag.TypeCondition, err = p.name(); err != nil {
+		return nil, err
+	}
+	if frag.Directives, err = p.directives(); err != nil {
+		return nil, err
+	}
+	if frag.Selections, err = p.selectionSet(); err != nil {
+		return nil, err
+	}
+	return frag, nil
+}
+
+func (p *parser) selectionSet() ([]Selection, error) {
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	var sels []Selection
+	for !p.peek(tokPunct, "}") {
+		sel, err := p.selection()
+		if err != nil {
+			return nil, err
+		}
+		sels = append(sels, sel)
+	}
+	if len(sels) == 0 {
+		return nil, p.unexpected()
+	}
+	return sels, p.advance()
+}
+
+func (p *parser) selection() (Selection, error) {
+	var err error
+	if ok, err := p.skip("..."); err != nil {
+		return nil, err
+	} else if ok {
+		if p.tok.kind == tokName && p.tok.value != "on" {
+			spread := &FragmentSpread{}
+			if spread.Name, err = p.name(); err != nil {
+				return nil, err
+			}
+			if spread.Directives, err = p.directives(); err != nil {
+				return nil, err
+			}
+			return spread, nil
+		}
+		inline := &InlineFragment{}
+		if p.peek(tokName, "on") {
+			if err = p.advance(); err != nil {
+				return nil, err
+			}
+			if inline.TypeCondition, err = p.name(); err != nil {
+				return nil, err
+			}
+		}
+		if inline.Directives, err = p.directives(); err != nil {
+			return nil, err
+		}
+		if inline.Selections, err = p.selectionSet(); err != nil {
+			return nil, err
+		}
+		return inline, nil
+	}
+
+	field := &FieldNode{}
+	if field.Name, err = p.name(); err != nil {
+		return nil, err
+	}
+	if ok, err := p.skip(":"); err != nil {
+		return nil, err
+	} else if ok {
+		field.Alias = field.Name
+		if field.Name, err = p.name(); err != nil {
+			return nil, err
+		}
+	}
+	if field.Args, err = p.arguments(); err != nil {
+		return nil, err
+	}
+	if field.Directives, err = p.directives(); err != nil {
+		return nil, err
+	}
+	if p.peek(tokPunct, "{") {
+		if field.Selections, err = p.selectionSet(); err != nil {
+			return nil, err
+		}
+	}
+	return field, nil
+}
+
+func (p *parser) arguments() (map[string]interface{}, error) {
+	args := map[string]interface{}{}
+	if ok, err := p.skip("("); err != nil || !ok {
+		return args, err
+	}
+	for !p.peek(tokPunct, ")") {
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := args[name]; ok {
+			return nil, fmt.Errorf("There can only be one argument named %q", name)
+		}
+		if err = p.expect(":"); err != nil {
+			return nil, err
+		}
+		if args[name], err = p.value(false); err != nil {
+			return nil, err
+		}
+	}
+	return args, p.advance()
+}
+
+func (p *parser) directives() ([]*Directive, error) {
+	var dirs []*Directive
+	for p.peek(tokPunct, "@") {
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		args, err := p.arguments()
+		if err != nil {
+			return nil, err
+		}
+		dirs = append(dirs, &Directive{Name: name, Args: args})
+	}
+	return dirs, nil
+}
+
+// value parses a literal into plain Go values, leaving Variables in place to
+// be filled in when the operation is executed.
+func (p *parser) value(constant bool) (interface{}, error) {
+	tok := p.tok
+	switch tok.kind {
+	case tokInt:
+		n, err := strconv.Atoi(tok.value)
+		if err != nil {
+			return nil, p.lex.errorf(tok.pos, "%s is out of range", tok.value)
+		}
+		return n, p.advance()
+	case tokFloat:
+		f, err := strconv.ParseFloat(tok.value, 64)
+		if err != nil {
+			return nil, p.lex.errorf(tok.pos, "%s is out of range", tok.value)
+		}
+		return f, p.advance()
+	case tokString:
+		return tok.value, p.advance()
+	case tokName:
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		switch tok.value {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return nil, nil
+		}
+		return Enum(tok.value), nil
+	case tokPunct:
+		switch tok.value {
+		case "$":
+			if constant {
+				return nil, p.unexpected()
+			}
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			name, err := p.name()
+			return Variable(name), err
+		case "[":
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			list := []interface{}{}
+			for !p.peek(tokPunct, "]") {
+				v, err := p.value(constant)
+				if err != nil {
+					return nil, err
+				}
+				list = append(list, v)
+			}
+			return list, p.advance()
+		case "{":
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			obj := map[string]interface{}{}
+			for !p.peek(tokPunct, "}") {
+				name, err := p.name()
+				if err != nil {
+					return nil, err
+				}
+				if err = p.expect(":"); err != nil {
+					return nil, err
+				}
+				if obj[name], err = p.value(constant); err != nil {
+					return nil, err
+				}
+			}
+			return obj, p.advance()
+		}
+	}
+	return nil, p.unexpected()
+}
@@ -0,0 +1,132 @@
+package graphql
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	doc, err := Parse(`
+		# Comments, commas and byte order marks don't mean anything
+		query Models($limit: Int = 10, $user: String!) @cached {
+			latest: models(limit: $limit, sort: CREATED, tags: ["a", "b"]) {
+				id, name
+				...ModelUser @include(if: true)
+				... on Model { slug }
+			}
+			user(username: $user, filter: {stars: 1.5e1, public: true, note: null}) {
+				username
+			}
+		}
+
+		fragment ModelUser on Model {
+			user { username }
+		}
+	`)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	if len(doc.Operations) != 1 {
+		t.Fatalf("Parsed %d operations, want 1", len(doc.Operations))
+	}
+	op := doc.Operations[0]
+	if op.Type != "query" || op.Name != "Models" {
+		t.Errorf("Parsed %s %s, want query Models", op.Type, op.Name)
+	}
+	wantVars := []*VariableDef{{Name: "limit", Default: 10}, {Name: "user"}}
+	if !reflect.DeepEqual(op.Variables, wantVars) {
+		t.Errorf("Parsed variables %+v, want %+v", op.Variables, wantVars)
+	}
+
+	latest := op.Selections[0].(*FieldNode)
+	if latest.Alias != "latest" || latest.Name != "models" {
+		t.Errorf("Parsed field %s: %s, want latest: models", latest.Alias, latest.Name)
+	}
+	wantArgs := map[string]interface{}{
+		"limit": Variable("limit"),
+		"sort":  Enum("CREATED"),
+		"tags":  []interface{}{"a", "b"},
+	}
+	if !reflect.DeepEqual(latest.Args, wantArgs) {
+		t.Errorf("Parsed arguments %#v, want %#v", latest.Args, wantArgs)
+	}
+	if len(latest.Selections) != 4 {
+		t.Fatalf("Parsed %d selections, want 4", len(latest.Selections))
+	}
+	spread := latest.Selections[2].(*FragmentSpread)
+	if spread.Name != "ModelUser" || len(spread.Directives) != 1 ||
+		spread.Directives[0].Name != "include" {
+		t.Errorf("Parsed spread %+v, want ...ModelUser @include", spread)
+	}
+	inline := latest.Selections[3].(*InlineFragment)
+	if inline.TypeCondition != "Model" {
+		t.Errorf("Parsed inline fragment on %q, want Model", inline.TypeCondition)
+	}
+
+	user := op.Selections[1].(*FieldNode)
+	wantFilter := map[string]interface{}{"stars": 15.0, "public": true, "note": nil}
+	if !reflect.DeepEqual(user.Args["filter"], wantFilter) {
+		t.Errorf("Parsed filter %#v, want %#v", user.Args["filter"], wantFilter)
+	}
+
+	frag := doc.Fragments["ModelUser"]
+	if frag == nil || frag.TypeCondition != "Model" {
+		t.Errorf("Parsed fragment %+v, want ModelUser on Model", frag)
+	}
+}
+
+func TestParseShorthand(t *testing.T) {
+	doc, err := Parse(`{ models { id } }`)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if len(doc.Operations) != 1 || doc.Operations[0].Type != "query" {
+		t.Errorf("Parsed %+v, want one query", doc.Operations)
+	}
+}
+
+func TestParseStrings(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{`"plain"`, "plain"},
+		{`"tab\tquote\"slash\\"`, "tab\tquote\"slash\\"},
+		{`"caf\u00e9"`, "café"},
+		{`"""block "quoted" \n"""`, `block "quoted" \n`},
+	}
+	for _, test := range tests {
+		doc, err := Parse(`{ f(s: ` + test.src + `) }`)
+		if err != nil {
+			t.Errorf("Parse(%s): %v", test.src, err)
+			continue
+		}
+		got := doc.Operations[0].Selections[0].(*FieldNode).Args["s"]
+		if got != test.want {
+			t.Errorf("Parse(%s) = %q, want %q", test.src, got, test.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, src := range []string{
+		``,
+		`{`,
+		`{ }`,
+		`{ a(x: 1, x: 2) }`,
+		`{ a(x: $v) } fragment F on Q { a(x: [1 2) }`,
+		`query ($v: Int = $w) { a }`,
+		`fragment F on Q { a } fragment F on Q { b } { a }`,
+		`fragment on on Q { a } { a }`,
+		`fragment F { a } { a }`,
+		`{ a(x: 99999999999999999999) }`,
+		`{ a(x: 1.) }`,
+		`{ a(x: "unterminated) }`,
+		`{ a . b }`,
+	} {
+		if _, err := Parse(src); err == nil {
+			t.Errorf("Parse(%q) didn't fail", src)
+		}
+	}
+}
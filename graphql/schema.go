@@ -0,0 +1,114 @@
+package graphql
+
+// Type is a *Scalar, *Object, or *List.
+type Type interface {
+	String() string
+}
+
+// Scalar is a leaf type.  Resolved values are sent as they are, so they just
+// need to marshal to JSON sensibly.
+type Scalar struct {
+	Name string
+}
+
+func (s *Scalar) String() string { return s.Name }
+
+var (
+	String  = &Scalar{Name: "String"}
+	Int     = &Scalar{Name: "Int"}
+	Float   = &Scalar{Name: "Float"}
+	Boolean = &Scalar{Name: "Boolean"}
+	ID      = &Scalar{Name: "ID"}
+	Time    = &Scalar{Name: "Time"} // time.Time, sent as RFC 3339
+)
+
+// Object is a type with fields.  Objects refer to each other, so their fields
+// are usually filled in after they're all declared.
+type Object struct {
+	Name   string
+	Fields map[string]*Field
+}
+
+func (o *Object) String() string { return o.Name }
+
+// List is a list of another type.  Its resolved values must be slices.
+type List struct {
+	Of Type
+}
+
+func (l *List) String() string { return "[" + l.Of.String() + "]" }
+
+// ListOf makes a list of t.
+func ListOf(t Type) *List {
+	return &List{Of: t}
+}
+
+// Field is a field of an object.  It's resolved either one source at a time,
+// or in a batch with every source at the same level of the query, which is
+// how resolvers avoid making one query per source.
+type Field struct {
+	Type    Type
+	Resolve func(p *Params) (interface{}, error)
+	Batch   func(p *BatchParams) ([]interface{}, error)
+}
+
+// Params are what a field is resolved with.
+type Params struct {
+	Context interface{}
+	Source  interface{}
+	Args    Args
+}
+
+// BatchParams are what a batched field is resolved with.  The results must
+// line up with the sources.
+type BatchParams struct {
+	Context interface{}
+	Sources []interface{}
+	Args    Args
+}
+
+// Schema is the root of everything that can be queried.
+type Schema struct {
+	Query    *Object
+	MaxDepth int // How deeply selections can nest, 0 for no limit
+
+	// How many fields a query can select, counting a fragment's every time
+	// it's spread, 0 for no limit
+	MaxComplexity int
+}
+
+// Args are a field's arguments, with variables filled in.
+type Args map[string]interface{}
+
+// String gets a string (or enum) argument, or "" if it's missing or isn't one.
+func (a Args) String(name string) string {
+	switch v := a[name].(type) {
+	case string:
+		return v
+	case Enum:
+		return string(v)
+	}
+	return ""
+}
+
+// Int gets an integer argument, or def if it's missing or isn't one.
+// Variables come from JSON, so whole floats count.
+func (a Args) Int(name string, def int) int {
+	switch v := a[name].(type) {
+	case int:
+		return v
+	case float64:
+		if v == float64(int(v)) {
+			return int(v)
+		}
+	}
+	return def
+}
+
+// Bool gets a boolean argument, or def if it's missing or isn't one.
+func (a Args) Bool(name string, def bool) bool {
+	if v, ok := a[name].(bool); ok {
+		return v
+	}
+	return def
+}
@@ -0,0 +1,124 @@
+package inspect
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+)
+
+const (
+	FORMAT_HDF5    = "hdf5"
+	FORMAT_NPY     = "npy"
+	FORMAT_NPZ     = "npz"
+	FORMAT_PYTORCH = "pytorch"
+)
+
+// ErrUnsupported is returned when a file isn't in a format we know how to
+// inspect.
+var ErrUnsupported = errors.New("Unsupported file format")
+
+// Tensor describes a single named array of weights inside a checkpoint.
+type Tensor struct {
+	Name   string  `json:"name"`
+	Layer  string  `json:"layer"`
+	Shape  []int64 `json:"shape"`
+	Dtype  string  `json:"dtype"`
+	Params int64   `json:"params"`
+}
+
+// Layer groups together the tensors that share a name prefix, like
+// dense_1/kernel:0 and dense_1/bias:0.
+type Layer struct {
+	Name    string `json:"name"`
+	Tensors int    `json:"tensors"`
+	Params  int64  `json:"params"`
+}
+
+// Structure is a summary of what's inside of a checkpoint, without any of the
+// actual weight values.
+type Structure struct {
+	Format      string    `json:"format"`
+	Layers      []*Layer  `json:"layers"`
+	Tensors     []*Tensor `json:"tensors"`
+	TotalParams int64     `json:"total_params"`
+}
+
+func newStructure(format string) *Structure {
+	return &Structure{
+		Format:  format,
+		Layers:  []*Layer{},
+		Tensors: []*Tensor{},
+	}
+}
+
+// addTensor records a tensor, filling in its layer and parameter count.
+func (s *Structure) addTensor(name, dtype string, shape []int64) {
+	params := int64(1)
+	for _, dim := range shape {
+		params *= dim
+	}
+	if shape == nil {
+		shape = []int64{}
+	}
+
+	layer := layerName(name)
+
+	s.Tensors = append(s.Tensors, &Tensor{
+		Name:   name,
+		Layer:  layer,
+		Shape:  shape,
+		Dtype:  dtype,
+		Params: params,
+	})
+	s.TotalParams += params
+
+	for _, l := range s.Layers {
+		if l.Name == layer {
+			l.Tensors++
+			l.Params += params
+			return
+		}
+	}
+	s.Layers = append(s.Layers, &Layer{Name: layer, Tensors: 1, Params: params})
+}
+
+// layerName works out which layer a tensor belongs to from its name.
+func layerName(name string) string {
+	if i := strings.LastIndexAny(name, "./"); i >= 0 {
+		return name[:i]
+	}
+	return ""
+}
+
+var (
+	hdf5Magic = []byte("\x89HDF\r\n\x1a\n")
+	npyMagic  = []byte("\x93NUMPY")
+	zipMagic  = []byte("PK\x03\x04")
+)
+
+// Inspect sniffs the format of a checkpoint from its contents and summarizes
+// its structure.  ErrUnsupported is returned for formats we don't understand.
+func Inspect(data []byte) (*Structure, error) {
+	return InspectReader(bytes.NewReader(data), int64(len(data)))
+}
+
+// InspectReader is Inspect for a checkpoint of size bytes that's too big to
+// hold in memory, e.g. one in a temporary file.  Only as much of it as it
+// takes to find the structure is read, and none of the weights.
+func InspectReader(r io.ReaderAt, size int64) (*Structure, error) {
+	prefix := make([]byte, len(hdf5Magic))
+	n, _ := r.ReadAt(prefix, 0)
+	prefix = prefix[:n]
+	switch {
+	case bytes.HasPrefix(prefix, hdf5Magic):
+		return inspectHDF5(r, size)
+	case bytes.HasPrefix(prefix, npyMagic):
+		return inspectNPY(io.NewSectionReader(r, 0, size))
+	case bytes.HasPrefix(prefix, zipMagic):
+		return inspectZip(r, size)
+	case len(prefix) > 1 && prefix[0] == pickleProto:
+		return inspectLegacyPyTorch(io.NewSectionReader(r, 0, size), size)
+	}
+	return nil, ErrUnsupported
+}
@@ -0,0 +1,198 @@
+package inspect
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math"
+)
+
+// ErrFormatMismatch is returned when asked to compare checkpoints that are
+// stored in different formats.
+var ErrFormatMismatch = errors.New("Both versions must be in the same format")
+
+// LayerDiff summarizes how much the weights of one layer moved between two
+// versions of a checkpoint.  The norms are L2 norms over every value in the
+// layer, and RelativeChange is DeltaNorm / OldNorm, or zero if OldNorm is.
+type LayerDiff struct {
+	Name           string  `json:"name"`
+	Params         int64   `json:"params"`
+	Changed        int64   `json:"changed"`
+	NonFinite      int64   `json:"non_finite"`
+	DeltaNorm      float64 `json:"delta_norm"`
+	OldNorm        float64 `json:"old_norm"`
+	NewNorm        float64 `json:"new_norm"`
+	RelativeChange float64 `json:"relative_change"`
+
+	deltaSq, oldSq, newSq float64
+}
+
+// Diff compares the weights of two versions of a checkpoint.  Only tensors
+// with the same name and shape in both versions are compared; the rest are
+// listed by name.  Values that aren't finite in either version are counted
+// in NonFinite and otherwise ignored.
+type Diff struct {
+	Format   string       `json:"format"`
+	Layers   []*LayerDiff `json:"layers"`
+	Total    *LayerDiff   `json:"total"`
+	Added    []string     `json:"added"`
+	Removed  []string     `json:"removed"`
+	Reshaped []string     `json:"reshaped"`
+	Skipped  []string     `json:"skipped"`
+}
+
+// readTensors sniffs the format of a checkpoint of size bytes like
+// InspectReader does, and reads the values of all of its tensors.  The values
+// are held in memory, so it's up to the caller to limit how big a checkpoint
+// it's given.
+func readTensors(r io.ReaderAt, size int64) (*tensorSet, error) {
+	prefix := make([]byte, len(hdf5Magic))
+	n, _ := r.ReadAt(prefix, 0)
+	prefix = prefix[:n]
+	switch {
+	case bytes.HasPrefix(prefix, hdf5Magic):
+		return readHDF5Tensors(r, size)
+	case bytes.HasPrefix(prefix, npyMagic):
+		data := make([]byte, size)
+		if _, err := r.ReadAt(data, 0); err != nil && err != io.EOF {
+			return nil, err
+		}
+		t, err := readNPY(data)
+		if err != nil {
+			return nil, err
+		}
+		ts := newTensorSet(FORMAT_NPY)
+		ts.add("", t)
+		return ts, nil
+	case bytes.HasPrefix(prefix, zipMagic):
+		return readZipTensors(r, size)
+	case len(prefix) > 1 && prefix[0] == pickleProto:
+		return readLegacyPyTorchTensors(io.NewSectionReader(r, 0, size), size)
+	}
+	return nil, ErrUnsupported
+}
+
+// Compare works out how much the weights changed from oldData to newData.
+func Compare(oldData, newData []byte) (*Diff, error) {
+	return CompareReaders(bytes.NewReader(oldData), int64(len(oldData)),
+		bytes.NewReader(newData), int64(len(newData)))
+}
+
+// CompareReaders is Compare for checkpoints read from e.g. temporary files,
+// oldSize and newSize bytes long.  Every value in both is read into memory,
+// so callers should refuse ones that are too big first.
+func CompareReaders(oldR io.ReaderAt, oldSize int64, newR io.ReaderAt, newSize int64) (*Diff, error) {
+	oldSet, err := readTensors(oldR, oldSize)
+	if err != nil {
+		return nil, err
+	}
+	newSet, err := readTensors(newR, newSize)
+	if err != nil {
+		return nil, err
+	}
+	if oldSet.format != newSet.format {
+		return nil, ErrFormatMismatch
+	}
+
+	d := &Diff{
+		Format:   newSet.format,
+		Layers:   []*LayerDiff{},
+		Total:    &LayerDiff{},
+		Added:    []string{},
+		Removed:  []string{},
+		Reshaped: []string{},
+		Skipped:  []string{},
+	}
+	layers := map[string]*LayerDiff{}
+
+	for _, name := range oldSet.names {
+		if _, ok := newSet.tensors[name]; !ok {
+			d.Removed = append(d.Removed, name)
+		}
+	}
+
+	for _, name := range newSet.names {
+		oldT, ok := oldSet.tensors[name]
+		if !ok {
+			d.Added = append(d.Added, name)
+			continue
+		}
+		newT := newSet.tensors[name]
+		if oldT == nil || newT == nil {
+			d.Skipped = append(d.Skipped, name)
+			continue
+		}
+		if !sameShape(oldT.shape, newT.shape) {
+			d.Reshaped = append(d.Reshaped, name)
+			continue
+		}
+
+		layer, ok := layers[layerName(name)]
+		if !ok {
+			layer = &LayerDiff{Name: layerName(name)}
+			layers[layer.Name] = layer
+			d.Layers = append(d.Layers, layer)
+		}
+
+		n := newT.numel()
+		layer.Params += n
+		for i := int64(0); i < n; i++ {
+			oldV, newV := oldT.value(i), newT.value(i)
+			if math.IsNaN(oldV) || math.IsInf(oldV, 0) ||
+				math.IsNaN(newV) || math.IsInf(newV, 0) {
+				layer.NonFinite++
+				continue
+			}
+			if oldV != newV {
+				layer.Changed++
+			}
+			delta := newV - oldV
+			layer.deltaSq += delta * delta
+			layer.oldSq += oldV * oldV
+			layer.newSq += newV * newV
+		}
+	}
+
+	for _, layer := range d.Layers {
+		d.Total.Params += layer.Params
+		d.Total.Changed += layer.Changed
+		d.Total.NonFinite += layer.NonFinite
+		d.Total.deltaSq += layer.deltaSq
+		d.Total.oldSq += layer.oldSq
+		d.Total.newSq += layer.newSq
+		layer.finish()
+	}
+	d.Total.finish()
+
+	return d, nil
+}
+
+// finish turns the accumulated sums of squares into norms.  Sums that
+// overflowed are clamped so that the result can always be encoded as JSON.
+func (l *LayerDiff) finish() {
+	l.DeltaNorm = finiteSqrt(l.deltaSq)
+	l.OldNorm = finiteSqrt(l.oldSq)
+	l.NewNorm = finiteSqrt(l.newSq)
+	if l.OldNorm > 0 {
+		l.RelativeChange = l.DeltaNorm / l.OldNorm
+	}
+}
+
+func finiteSqrt(v float64) float64 {
+	if math.IsInf(v, 0) || math.IsNaN(v) {
+		return math.MaxFloat64
+	}
+	return math.Sqrt(v)
+}
+
+func sameShape(a, b []int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,519 @@
+package inspect
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// This reads just enough of the HDF5 format to list the datasets in a file
+// along with their shapes and types, which covers Keras and h5py checkpoints.
+// Values can be read from datasets that aren't chunked.
+// It understands groups stored as symbol tables (what h5py writes by default)
+// and compact link messages, but not dense link storage in fractal heaps.
+
+const (
+	hdf5MsgDataspace    = 0x0001
+	hdf5MsgLinkInfo     = 0x0002
+	hdf5MsgDatatype     = 0x0003
+	hdf5MsgLink         = 0x0006
+	hdf5MsgLayout       = 0x0008
+	hdf5MsgContinuation = 0x0010
+	hdf5MsgSymbolTable  = 0x0011
+)
+
+type hdf5Error string
+
+func (e hdf5Error) Error() string { return string(e) }
+
+type hdf5Reader struct {
+	src         io.ReaderAt
+	size        uint64
+	base        uint64
+	offsetSize  int
+	lengthSize  int
+	visited     map[uint64]bool
+	s           *Structure
+	tensors     *tensorSet
+	objectCount int
+}
+
+type hdf5Message struct {
+	typ  int
+	body []byte
+}
+
+func inspectHDF5(src io.ReaderAt, size int64) (*Structure, error) {
+	r, err := readHDF5(src, size, false)
+	if err != nil {
+		return nil, err
+	}
+	return r.s, nil
+}
+
+// readHDF5Tensors reads the values of every dataset that's stored compactly or
+// contiguously.  Chunked datasets, which may be compressed, are left unread.
+func readHDF5Tensors(src io.ReaderAt, size int64) (*tensorSet, error) {
+	r, err := readHDF5(src, size, true)
+	if err != nil {
+		return nil, err
+	}
+	return r.tensors, nil
+}
+
+func readHDF5(src io.ReaderAt, size int64, withValues bool) (r *hdf5Reader, err error) {
+	r = &hdf5Reader{
+		src:     src,
+		size:    uint64(size),
+		visited: map[uint64]bool{},
+		s:       newStructure(FORMAT_HDF5),
+	}
+	if withValues {
+		r.tensors = newTensorSet(FORMAT_HDF5)
+	}
+
+	// Malformed files surface as panics deep inside the parser
+	defer func() {
+		if rec := recover(); rec != nil {
+			if herr, ok := rec.(hdf5Error); ok {
+				r, err = nil, herr
+				return
+			}
+			panic(rec)
+		}
+	}()
+
+	rootAddr := r.readSuperblock()
+	r.walkObject("", rootAddr)
+	return r, nil
+}
+
+func (r *hdf5Reader) fail(format string, args ...interface{}) {
+	panic(hdf5Error(fmt.Sprintf("HDF5: "+format, args...)))
+}
+
+func (r *hdf5Reader) bytesAt(addr uint64, n int) []byte {
+	if n < 0 || addr > r.size || uint64(n) > r.size-addr {
+		r.fail("read of %d bytes at %d is out of bounds", n, addr)
+	}
+	b := make([]byte, n)
+	if read, err := r.src.ReadAt(b, int64(addr)); read < n {
+		r.fail("read of %d bytes at %d failed: %s", n, addr, err)
+	}
+	return b
+}
+
+func (r *hdf5Reader) uint(b []byte, pos, size int) uint64 {
+	if pos < 0 || pos+size > len(b) {
+		r.fail("truncated structure")
+	}
+	var v uint64
+	for i := size - 1; i >= 0; i-- {
+		v = v<<8 | uint64(b[pos+i])
+	}
+	return v
+}
+
+func (r *hdf5Reader) undefined(addr uint64) bool {
+	return addr == (uint64(1)<<(8*uint(r.offsetSize)))-1 || addr == ^uint64(0)
+}
+
+func (r *hdf5Reader) readSuperblock() uint64 {
+	sb := r.bytesAt(0, 12)
+	version := sb[8]
+	switch version {
+	case 0, 1:
+		sb = r.bytesAt(0, 24)
+		r.offsetSize = int(sb[13])
+		r.lengthSize = int(sb[14])
+		pos := 24
+		if version == 1 {
+			pos += 4
+		}
+		r.checkSizes()
+		sb = r.bytesAt(0, pos+4*r.offsetSize+2*r.offsetSize+8)
+		r.base = r.uint(sb, pos, r.offsetSize)
+		// Skip base, free-space, end-of-file, and driver info addresses to
+		// reach the root group's symbol table entry
+		pos += 4 * r.offsetSize
+		return r.uint(sb, pos+r.offsetSize, r.offsetSize)
+	case 2, 3:
+		r.offsetSize = int(sb[9])
+		r.lengthSize = int(sb[10])
+		r.checkSizes()
+		sb = r.bytesAt(0, 12+4*r.offsetSize)
+		r.base = r.uint(sb, 12, r.offsetSize)
+		return r.uint(sb, 12+3*r.offsetSize, r.offsetSize)
+	}
+	r.fail("unsupported superblock version %d", version)
+	return 0
+}
+
+func (r *hdf5Reader) checkSizes() {
+	for _, size := range []int{r.offsetSize, r.lengthSize} {
+		if size != 2 && size != 4 && size != 8 {
+			r.fail("unsupported offset/length size %d", size)
+		}
+	}
+}
+
+// walkObject records the object at addr if it's a dataset, or recurses into
+// its children if it's a group.
+func (r *hdf5Reader) walkObject(name string, addr uint64) {
+	addr += r.base
+	if r.visited[addr] {
+		return
+	}
+	r.visited[addr] = true
+	r.objectCount++
+	if r.objectCount > 100000 {
+		r.fail("too many objects")
+	}
+
+	msgs := r.readObjectHeader(addr)
+
+	var dataspace, datatype, layout []byte
+	for _, msg := range msgs {
+		switch msg.typ {
+		case hdf5MsgDataspace:
+			dataspace = msg.body
+		case hdf5MsgDatatype:
+			datatype = msg.body
+		case hdf5MsgLayout:
+			layout = msg.body
+		case hdf5MsgSymbolTable:
+			btree := r.uint(msg.body, 0, r.offsetSize)
+			heap := r.uint(msg.body, r.offsetSize, r.offsetSize)
+			r.walkSymbolTable(name, btree, heap)
+		case hdf5MsgLink:
+			r.walkLink(name, msg.body)
+		case hdf5MsgLinkInfo:
+			// Dense storage lives in a fractal heap, which we don't read.  Compact
+			// groups still have an (undefined) heap address here.
+			if len(msg.body) >= 2+r.offsetSize {
+				pos := 2
+				if msg.body[1]&0x01 != 0 {
+					pos += 8
+				}
+				if !r.undefined(r.uint(msg.body, pos, r.offsetSize)) {
+					r.fail("dense link storage is not supported")
+				}
+			}
+		}
+	}
+
+	if dataspace != nil && datatype != nil {
+		dtype, shape := r.dtype(datatype), r.shape(dataspace)
+		r.s.addTensor(name, dtype, shape)
+		if r.tensors != nil {
+			r.tensors.add(name, r.tensorData(dtype, shape, datatype, layout))
+		}
+	}
+}
+
+// tensorData finds the raw values of a dataset from its layout message, or
+// returns nil if they aren't stored in a way we can read.
+func (r *hdf5Reader) tensorData(dtype string, shape []int64, datatype, layout []byte) *tensorData {
+	size, ok := dtypeSizes[dtype]
+	if !ok || len(layout) < 2 {
+		return nil
+	}
+	t := &tensorData{
+		dtype: dtype,
+		shape: shape,
+		order: binary.LittleEndian,
+	}
+	if datatype[1]&0x01 != 0 {
+		t.order = binary.BigEndian
+	}
+	n := t.numel() * size
+	if n < 0 || n > int64(r.size) {
+		return nil
+	}
+
+	var class byte
+	var pos int
+	switch layout[0] {
+	case 1, 2:
+		if len(layout) < 8 {
+			return nil
+		}
+		class, pos = layout[2], 8
+		if class == 0 {
+			// Compact data follows the dimension sizes and its own size
+			pos += 4*int(layout[1]) + 4
+		}
+	case 3, 4:
+		class, pos = layout[1], 2
+		if class == 0 {
+			pos += 2
+		}
+	default:
+		return nil
+	}
+
+	switch class {
+	case 0:
+		if pos+int(n) > len(layout) {
+			return nil
+		}
+		t.data = layout[pos : pos+int(n)]
+	case 1:
+		addr := r.uint(layout, pos, r.offsetSize)
+		if r.undefined(addr) {
+			// Space for the data was never allocated
+			return nil
+		}
+		addr += r.base
+		if addr > r.size || uint64(n) > r.size-addr {
+			return nil
+		}
+		t.data = r.bytesAt(addr, int(n))
+	default:
+		return nil
+	}
+	return t
+}
+
+func (r *hdf5Reader) readObjectHeader(addr uint64) []hdf5Message {
+	if bytes.Equal(r.bytesAt(addr, 4), []byte("OHDR")) {
+		return r.readObjectHeaderV2(addr)
+	}
+
+	prefix := r.bytesAt(addr, 16)
+	if prefix[0] != 1 {
+		r.fail("unsupported object header version %d", prefix[0])
+	}
+	numMsgs := int(r.uint(prefix, 2, 2))
+	size := r.uint(prefix, 8, 4)
+
+	var msgs []hdf5Message
+	type block struct{ addr, size uint64 }
+	blocks := []block{{addr + 16, size}}
+	for i := 0; i < len(blocks) && len(msgs) < numMsgs; i++ {
+		if i > 1000 {
+			r.fail("too many object header continuations")
+		}
+		data := r.bytesAt(blocks[i].addr, int(blocks[i].size))
+		for pos := 0; pos+8 <= len(data) && len(msgs) < numMsgs; {
+			typ := int(r.uint(data, pos, 2))
+			msgSize := int(r.uint(data, pos+2, 2))
+			body := data[pos+8:]
+			if msgSize > len(body) {
+				r.fail("object header message overruns its block")
+			}
+			body = body[:msgSize]
+			if typ == hdf5MsgContinuation {
+				blocks = append(blocks, block{
+					r.uint(body, 0, r.offsetSize) + r.base,
+					r.uint(body, r.offsetSize, r.lengthSize),
+				})
+			}
+			msgs = append(msgs, hdf5Message{typ, body})
+			pos += 8 + msgSize
+		}
+	}
+	return msgs
+}
+
+func (r *hdf5Reader) readObjectHeaderV2(addr uint64) []hdf5Message {
+	prefix := r.bytesAt(addr, 6)
+	flags := prefix[5]
+	pos := addr + 6
+	if flags&0x20 != 0 {
+		pos += 16 // access, modification, change, and birth times
+	}
+	if flags&0x10 != 0 {
+		pos += 4 // attribute phase change values
+	}
+	sizeLen := 1 << (flags & 0x03)
+	size := r.uint(r.bytesAt(pos, sizeLen), 0, sizeLen)
+	pos += uint64(sizeLen)
+
+	type block struct{ addr, size uint64 }
+	blocks := []block{{pos, size}}
+	var msgs []hdf5Message
+	for i := 0; i < len(blocks); i++ {
+		if i > 1000 {
+			r.fail("too many object header continuations")
+		}
+		data := r.bytesAt(blocks[i].addr, int(blocks[i].size))
+		headerLen := 4
+		if flags&0x04 != 0 {
+			headerLen += 2
+		}
+		for p := 0; p+headerLen <= len(data); {
+			typ := int(data[p])
+			msgSize := int(r.uint(data, p+1, 2))
+			body := data[p+headerLen:]
+			if msgSize > len(body) {
+				r.fail("object header message overruns its block")
+			}
+			body = body[:msgSize]
+			if typ == hdf5MsgContinuation {
+				// Continuation blocks start with an OCHK signature and end with a
+				// checksum
+				blocks = append(blocks, block{
+					r.uint(body, 0, r.offsetSize) + r.base + 4,
+					r.uint(body, r.offsetSize, r.lengthSize) - 8,
+				})
+			}
+			msgs = append(msgs, hdf5Message{typ, body})
+			p += headerLen + msgSize
+		}
+	}
+	return msgs
+}
+
+func (r *hdf5Reader) childName(parent, name string) string {
+	if parent == "" {
+		return name
+	}
+	return parent + "/" + name
+}
+
+// walkSymbolTable walks a version 1 B-tree of symbol table nodes, which is how
+// old-style groups keep track of their children.
+func (r *hdf5Reader) walkSymbolTable(parent string, btreeAddr, heapAddr uint64) {
+	heap := r.bytesAt(heapAddr+r.base, 8+2*r.lengthSize+r.offsetSize)
+	if !bytes.Equal(heap[:4], []byte("HEAP")) {
+		r.fail("bad local heap signature")
+	}
+	heapData := r.uint(heap, 8+2*r.lengthSize, r.offsetSize) + r.base
+	heapSize := r.uint(heap, 8, r.lengthSize)
+
+	name := func(offset uint64) string {
+		if offset >= heapSize {
+			r.fail("symbol name offset is outside of the local heap")
+		}
+		b := r.bytesAt(heapData+offset, int(heapSize-offset))
+		if i := bytes.IndexByte(b, 0); i >= 0 {
+			b = b[:i]
+		}
+		return string(b)
+	}
+
+	nodes := []uint64{btreeAddr + r.base}
+	for count := 0; len(nodes) > 0; count++ {
+		addr := nodes[0]
+		nodes = nodes[1:]
+		if count > 100000 {
+			r.fail("too many B-tree nodes")
+		}
+
+		header := r.bytesAt(addr, 8+2*r.offsetSize)
+		if !bytes.Equal(header[:4], []byte("TREE")) {
+			r.fail("bad B-tree signature")
+		}
+		level := header[5]
+		entries := int(r.uint(header, 6, 2))
+		body := r.bytesAt(addr+uint64(len(header)),
+			entries*(r.lengthSize+r.offsetSize)+r.lengthSize)
+
+		for i := 0; i < entries; i++ {
+			child := r.uint(body, i*(r.lengthSize+r.offsetSize)+r.lengthSize, r.offsetSize) + r.base
+			if level > 0 {
+				nodes = append(nodes, child)
+				continue
+			}
+
+			snod := r.bytesAt(child, 8)
+			if !bytes.Equal(snod[:4], []byte("SNOD")) {
+				r.fail("bad symbol table node signature")
+			}
+			numSymbols := int(r.uint(snod, 6, 2))
+			entrySize := 2*r.offsetSize + 24
+			symbols := r.bytesAt(child+8, numSymbols*entrySize)
+			for j := 0; j < numSymbols; j++ {
+				nameOffset := r.uint(symbols, j*entrySize, r.offsetSize)
+				objAddr := r.uint(symbols, j*entrySize+r.offsetSize, r.offsetSize)
+				r.walkObject(r.childName(parent, name(nameOffset)), objAddr)
+			}
+		}
+	}
+}
+
+// walkLink follows a link message, which is how new-style compact groups
+// store their children.  Only hard links are followed.
+func (r *hdf5Reader) walkLink(parent string, body []byte) {
+	flags := body[1]
+	pos := 2
+	linkType := byte(0)
+	if flags&0x08 != 0 {
+		linkType = body[pos]
+		pos++
+	}
+	if flags&0x04 != 0 {
+		pos += 8 // creation order
+	}
+	if flags&0x10 != 0 {
+		pos++ // character set
+	}
+	lenSize := 1 << (flags & 0x03)
+	nameLen := int(r.uint(body, pos, lenSize))
+	pos += lenSize
+	if pos+nameLen > len(body) {
+		r.fail("link name overruns its message")
+	}
+	name := string(body[pos : pos+nameLen])
+	pos += nameLen
+
+	if linkType != 0 {
+		return
+	}
+	r.walkObject(r.childName(parent, name), r.uint(body, pos, r.offsetSize))
+}
+
+func (r *hdf5Reader) shape(body []byte) []int64 {
+	if len(body) < 4 {
+		r.fail("truncated dataspace message")
+	}
+	version := body[0]
+	rank := int(body[1])
+	pos := 8
+	if version >= 2 {
+		pos = 4
+		if body[3] == 2 {
+			// A null dataspace has no elements at all
+			return []int64{0}
+		}
+	}
+	shape := make([]int64, 0, rank)
+	for i := 0; i < rank; i++ {
+		shape = append(shape, int64(r.uint(body, pos+i*r.lengthSize, r.lengthSize)))
+	}
+	return shape
+}
+
+func (r *hdf5Reader) dtype(body []byte) string {
+	if len(body) < 8 {
+		r.fail("truncated datatype message")
+	}
+	class := body[0] & 0x0f
+	bits := r.uint(body, 4, 4) * 8
+	switch class {
+	case 0:
+		if body[1]&0x08 != 0 {
+			return fmt.Sprintf("int%d", bits)
+		}
+		return fmt.Sprintf("uint%d", bits)
+	case 1:
+		return fmt.Sprintf("float%d", bits)
+	case 3:
+		return "string"
+	case 6:
+		return "compound"
+	case 8:
+		// h5py stores numpy booleans as an enum over int8
+		if bits == 8 {
+			return "bool"
+		}
+		return "enum"
+	case 9:
+		return "vlen"
+	case 10:
+		return "array"
+	}
+	return "other"
+}
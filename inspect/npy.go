@@ -0,0 +1,330 @@
+package inspect
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	npyDescrReg   = regexp.MustCompile(`'descr'\s*:\s*'([^']*)'`)
+	npyShapeReg   = regexp.MustCompile(`'shape'\s*:\s*\(([^)]*)\)`)
+	npyFortranReg = regexp.MustCompile(`'fortran_order'\s*:\s*True`)
+)
+
+// npyDtypes maps numpy type codes (without the byte order) to dtype names
+var npyDtypes = map[string]string{
+	"b1": "bool",
+	"i1": "int8",
+	"i2": "int16",
+	"i4": "int32",
+	"i8": "int64",
+	"u1": "uint8",
+	"u2": "uint16",
+	"u4": "uint32",
+	"u8": "uint64",
+	"f2": "float16",
+	"f4": "float32",
+	"f8": "float64",
+	"c8": "complex64",
+}
+
+type npyHeader struct {
+	dtype   string
+	shape   []int64
+	order   binary.ByteOrder
+	fortran bool
+}
+
+func inspectNPY(r io.Reader) (*Structure, error) {
+	h, err := readNPYHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	s := newStructure(FORMAT_NPY)
+	s.addTensor("", h.dtype, h.shape)
+	return s, nil
+}
+
+// readNPYHeader reads just the header of a .npy file, which holds the dtype
+// and shape of the array that follows it.
+func readNPYHeader(r io.Reader) (*npyHeader, error) {
+	prefix := make([]byte, 8)
+	if _, err := io.ReadFull(r, prefix); err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(prefix, npyMagic) {
+		return nil, errors.New("Not a .npy file")
+	}
+
+	var headerLen uint32
+	switch prefix[6] {
+	case 1:
+		var l uint16
+		if err := binary.Read(r, binary.LittleEndian, &l); err != nil {
+			return nil, err
+		}
+		headerLen = uint32(l)
+	case 2, 3:
+		if err := binary.Read(r, binary.LittleEndian, &headerLen); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("Unknown .npy version %d", prefix[6])
+	}
+	if headerLen > 1024*1024 {
+		return nil, errors.New(".npy header is too large")
+	}
+
+	header := make([]byte, headerLen)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+
+	descr := npyDescrReg.FindSubmatch(header)
+	if descr == nil {
+		return nil, errors.New(".npy header has no descr")
+	}
+	h := &npyHeader{
+		order:   binary.LittleEndian,
+		fortran: npyFortranReg.Match(header),
+	}
+	if bytes.HasPrefix(descr[1], []byte(">")) {
+		h.order = binary.BigEndian
+	}
+	code := strings.TrimLeft(string(descr[1]), "<>|=")
+	dtype, ok := npyDtypes[code]
+	if !ok {
+		dtype = string(descr[1])
+	}
+	h.dtype = dtype
+
+	shapeMatch := npyShapeReg.FindSubmatch(header)
+	if shapeMatch == nil {
+		return nil, errors.New(".npy header has no shape")
+	}
+	h.shape = []int64{}
+	for _, dim := range strings.Split(string(shapeMatch[1]), ",") {
+		dim = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(dim), "L"))
+		if dim == "" {
+			continue
+		}
+		n, err := strconv.ParseInt(dim, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid .npy shape %q", shapeMatch[1])
+		}
+		h.shape = append(h.shape, n)
+	}
+
+	return h, nil
+}
+
+// readNPY reads a whole .npy file, values and all.
+func readNPY(data []byte) (*tensorData, error) {
+	r := bytes.NewReader(data)
+	h, err := readNPYHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	t := &tensorData{
+		dtype: h.dtype,
+		shape: h.shape,
+		data:  data[len(data)-r.Len():],
+		order: h.order,
+	}
+	if h.fortran {
+		t.stride = fortranStride(h.shape)
+	}
+	return t, nil
+}
+
+// inspectZip handles both .npz archives and the zip-based PyTorch format.
+func inspectZip(src io.ReaderAt, size int64) (*Structure, error) {
+	zr, err := zip.NewReader(src, size)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, f := range zr.File {
+		if path.Base(f.Name) == "data.pkl" {
+			return inspectZipPyTorch(f)
+		}
+	}
+
+	s := newStructure(FORMAT_NPZ)
+	for _, f := range zr.File {
+		if !strings.HasSuffix(f.Name, ".npy") {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		h, err := readNPYHeader(rc)
+		rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", f.Name, err)
+		}
+		s.addTensor(strings.TrimSuffix(f.Name, ".npy"), h.dtype, h.shape)
+	}
+	if len(s.Tensors) == 0 {
+		return nil, ErrUnsupported
+	}
+	return s, nil
+}
+
+func inspectZipPyTorch(f *zip.File) (*Structure, error) {
+	left := int64(maxZipInflated)
+	pkl, err := readZipFile(f, &left)
+	if err != nil {
+		return nil, err
+	}
+
+	u := newUnpickler(bytes.NewReader(pkl), int64(len(pkl)))
+	obj, err := u.load()
+	if err != nil {
+		return nil, err
+	}
+
+	s := newStructure(FORMAT_PYTORCH)
+	collectTensors(obj, func(name string, t *pickleTensor) {
+		s.addTensor(name, t.Dtype, t.Shape)
+	})
+	return s, nil
+}
+
+// readZipTensors reads the values of every tensor out of a .npz archive or a
+// zip-based PyTorch checkpoint.
+func readZipTensors(src io.ReaderAt, size int64) (*tensorSet, error) {
+	zr, err := zip.NewReader(src, size)
+	if err != nil {
+		return nil, err
+	}
+	left := int64(maxZipInflated)
+
+	files := map[string]*zip.File{}
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+	for _, f := range zr.File {
+		if path.Base(f.Name) == "data.pkl" {
+			return readZipPyTorchTensors(f, path.Dir(f.Name), files, &left)
+		}
+	}
+
+	ts := newTensorSet(FORMAT_NPZ)
+	for _, f := range zr.File {
+		if !strings.HasSuffix(f.Name, ".npy") {
+			continue
+		}
+		b, err := readZipFile(f, &left)
+		if err != nil {
+			return nil, err
+		}
+		t, err := readNPY(b)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", f.Name, err)
+		}
+		ts.add(strings.TrimSuffix(f.Name, ".npy"), t)
+	}
+	if len(ts.names) == 0 {
+		return nil, ErrUnsupported
+	}
+	return ts, nil
+}
+
+func readZipPyTorchTensors(f *zip.File, dir string, files map[string]*zip.File, left *int64) (*tensorSet, error) {
+	pkl, err := readZipFile(f, left)
+	if err != nil {
+		return nil, err
+	}
+	obj, err := newUnpickler(bytes.NewReader(pkl), int64(len(pkl))).load()
+	if err != nil {
+		return nil, err
+	}
+
+	// Storages are little endian unless the archive says otherwise
+	var order binary.ByteOrder = binary.LittleEndian
+	if bo, ok := files[dir+"/byteorder"]; ok {
+		b, err := readZipFile(bo, left)
+		if err != nil {
+			return nil, err
+		}
+		if strings.TrimSpace(string(b)) == "big" {
+			order = binary.BigEndian
+		}
+	}
+
+	ts := newTensorSet(FORMAT_PYTORCH)
+	storages := map[string][]byte{}
+	collectTensors(obj, func(name string, pt *pickleTensor) {
+		if err != nil {
+			return
+		}
+		if pt.Storage == nil {
+			ts.add(name, nil)
+			return
+		}
+		b, ok := storages[pt.Storage.Key]
+		if !ok {
+			sf, found := files[dir+"/data/"+pt.Storage.Key]
+			if !found {
+				ts.add(name, nil)
+				return
+			}
+			if b, err = readZipFile(sf, left); err != nil {
+				return
+			}
+			storages[pt.Storage.Key] = b
+		}
+		ts.add(name, &tensorData{
+			dtype:  pt.Dtype,
+			shape:  pt.Shape,
+			data:   b,
+			order:  order,
+			offset: pt.Offset,
+			stride: pt.Stride,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ts, nil
+}
+
+// A small archive can inflate to a huge amount of data, so no more than
+// maxZipInflated bytes are read out of any one, whatever its entries claim
+// their sizes are.
+const maxZipInflated = 1 << 30
+
+var errZipTooLarge = errors.New("Zip archive inflates to too much data")
+
+// readZipFile reads a whole entry, taking its size out of what's left of the
+// archive's budget.
+func readZipFile(f *zip.File, left *int64) ([]byte, error) {
+	if f.UncompressedSize64 > uint64(*left) {
+		return nil, errZipTooLarge
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	b, err := ioutil.ReadAll(io.LimitReader(rc, *left+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(b)) > *left {
+		return nil, errZipTooLarge
+	}
+	*left -= int64(len(b))
+	return b, nil
+}
@@ -0,0 +1,756 @@
+package inspect
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// This is a minimal pickle virtual machine, just capable enough to walk the
+// object graph of a PyTorch checkpoint.  It never imports or executes anything:
+// globals are recorded by name, and only the handful of torch rebuild
+// functions we care about are interpreted.
+
+const pickleProto = 0x80
+
+type pickleGlobal struct {
+	Module string
+	Name   string
+}
+
+type pickleDict struct {
+	Keys   []interface{}
+	Values []interface{}
+}
+
+func (d *pickleDict) set(k, v interface{}) {
+	d.Keys = append(d.Keys, k)
+	d.Values = append(d.Values, v)
+}
+
+type pickleList struct {
+	Items []interface{}
+}
+
+type pickleTuple []interface{}
+
+// pickleObject stands in for any object we don't specifically understand.
+type pickleObject struct {
+	Class interface{}
+	Args  interface{}
+	State interface{}
+}
+
+type pickleStorage struct {
+	Dtype string
+	Key   string
+}
+
+type pickleTensor struct {
+	Dtype   string
+	Shape   []int64
+	Storage *pickleStorage
+	Offset  int64
+	Stride  []int64
+}
+
+var torchStorageDtypes = map[string]string{
+	"FloatStorage":         "float32",
+	"DoubleStorage":        "float64",
+	"HalfStorage":          "float16",
+	"BFloat16Storage":      "bfloat16",
+	"LongStorage":          "int64",
+	"IntStorage":           "int32",
+	"ShortStorage":         "int16",
+	"CharStorage":          "int8",
+	"ByteStorage":          "uint8",
+	"BoolStorage":          "bool",
+	"ComplexFloatStorage":  "complex64",
+	"ComplexDoubleStorage": "complex128",
+}
+
+var errPickleTruncated = errors.New("Pickle data is truncated")
+
+type unpickler struct {
+	r         *bufio.Reader
+	left      int64
+	stack     []interface{}
+	metastack [][]interface{}
+	memo      map[int]interface{}
+}
+
+// newUnpickler reads pickles from r, which has size bytes left in it.  Knowing
+// the size means a corrupt length can't make it allocate more than that.
+func newUnpickler(r io.Reader, size int64) *unpickler {
+	return &unpickler{r: bufio.NewReader(r), left: size, memo: map[int]interface{}{}}
+}
+
+func (u *unpickler) read(n int) ([]byte, error) {
+	if n < 0 || int64(n) > u.left {
+		return nil, errPickleTruncated
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(u.r, b); err != nil {
+		return nil, errPickleTruncated
+	}
+	u.left -= int64(n)
+	return b, nil
+}
+
+func (u *unpickler) readLine() (string, error) {
+	line, err := u.r.ReadString('\n')
+	u.left -= int64(len(line))
+	if err != nil {
+		return "", errPickleTruncated
+	}
+	return line[:len(line)-1], nil
+}
+
+func (u *unpickler) readUint(n int) (uint64, error) {
+	b, err := u.read(n)
+	if err != nil {
+		return 0, err
+	}
+	var v uint64
+	for i := n - 1; i >= 0; i-- {
+		v = v<<8 | uint64(b[i])
+	}
+	return v, nil
+}
+
+func (u *unpickler) push(v interface{}) {
+	u.stack = append(u.stack, v)
+}
+
+func (u *unpickler) pop() (interface{}, error) {
+	if len(u.stack) == 0 {
+		return nil, errors.New("Pickle stack underflow")
+	}
+	v := u.stack[len(u.stack)-1]
+	u.stack = u.stack[:len(u.stack)-1]
+	return v, nil
+}
+
+func (u *unpickler) top() (interface{}, error) {
+	if len(u.stack) == 0 {
+		return nil, errors.New("Pickle stack underflow")
+	}
+	return u.stack[len(u.stack)-1], nil
+}
+
+func (u *unpickler) popMark() ([]interface{}, error) {
+	if len(u.metastack) == 0 {
+		return nil, errors.New("Pickle mark not found")
+	}
+	items := u.stack
+	u.stack = u.metastack[len(u.metastack)-1]
+	u.metastack = u.metastack[:len(u.metastack)-1]
+	return items, nil
+}
+
+// load runs the pickle program up to its STOP opcode and returns the result.
+// Several pickles may be stored back to back, so load can be called again.
+func (u *unpickler) load() (interface{}, error) {
+	u.stack = nil
+	u.metastack = nil
+	for {
+		opb, err := u.read(1)
+		if err != nil {
+			return nil, err
+		}
+		op := opb[0]
+
+		switch op {
+		case pickleProto:
+			_, err = u.read(1)
+		case 0x95: // FRAME
+			_, err = u.read(8)
+		case '.': // STOP
+			return u.pop()
+
+		case '(': // MARK
+			u.metastack = append(u.metastack, u.stack)
+			u.stack = nil
+		case '0': // POP
+			_, err = u.pop()
+		case '1': // POP_MARK
+			_, err = u.popMark()
+		case '2': // DUP
+			var v interface{}
+			if v, err = u.top(); err == nil {
+				u.push(v)
+			}
+
+		case 'N': // NONE
+			u.push(nil)
+		case 0x88: // NEWTRUE
+			u.push(true)
+		case 0x89: // NEWFALSE
+			u.push(false)
+		case 'J': // BININT
+			var v uint64
+			if v, err = u.readUint(4); err == nil {
+				u.push(int64(int32(v)))
+			}
+		case 'K': // BININT1
+			var v uint64
+			if v, err = u.readUint(1); err == nil {
+				u.push(int64(v))
+			}
+		case 'M': // BININT2
+			var v uint64
+			if v, err = u.readUint(2); err == nil {
+				u.push(int64(v))
+			}
+		case 0x8a, 0x8b: // LONG1, LONG4
+			size := 1
+			if op == 0x8b {
+				size = 4
+			}
+			var n uint64
+			if n, err = u.readUint(size); err != nil {
+				break
+			}
+			var b []byte
+			if b, err = u.read(int(n)); err == nil {
+				u.push(decodeLong(b))
+			}
+		case 'G': // BINFLOAT
+			var b []byte
+			if b, err = u.read(8); err == nil {
+				u.push(math.Float64frombits(binary.BigEndian.Uint64(b)))
+			}
+		case 'I', 'L': // INT, LONG
+			var line string
+			if line, err = u.readLine(); err != nil {
+				break
+			}
+			line = strings.TrimSuffix(line, "L")
+			switch line {
+			case "01":
+				u.push(true)
+			case "00":
+				u.push(false)
+			default:
+				var v int64
+				if v, err = strconv.ParseInt(line, 10, 64); err == nil {
+					u.push(v)
+				}
+			}
+		case 'F': // FLOAT
+			var line string
+			if line, err = u.readLine(); err != nil {
+				break
+			}
+			var v float64
+			if v, err = strconv.ParseFloat(line, 64); err == nil {
+				u.push(v)
+			}
+
+		case 'X', 0x8c, 0x8d, 'T', 'U', 'B', 'C', 0x8e: // (SHORT_)BINUNICODE(8), (SHORT_)BINSTRING, (SHORT_)BINBYTES(8)
+			size := 4
+			switch op {
+			case 0x8c, 'U', 'C':
+				size = 1
+			case 0x8d, 0x8e:
+				size = 8
+			}
+			var n uint64
+			if n, err = u.readUint(size); err != nil {
+				break
+			}
+			if n > uint64(u.left) {
+				err = errPickleTruncated
+				break
+			}
+			var b []byte
+			if b, err = u.read(int(n)); err == nil {
+				u.push(string(b))
+			}
+		case 'V', 'S': // UNICODE, STRING
+			var line string
+			if line, err = u.readLine(); err == nil {
+				if unquoted, uerr := strconv.Unquote(line); uerr == nil {
+					line = unquoted
+				}
+				u.push(line)
+			}
+
+		case '}': // EMPTY_DICT
+			u.push(&pickleDict{})
+		case ']': // EMPTY_LIST
+			u.push(&pickleList{})
+		case ')': // EMPTY_TUPLE
+			u.push(pickleTuple{})
+		case 0x8f: // EMPTY_SET
+			u.push(&pickleList{})
+		case 'd': // DICT
+			var items []interface{}
+			if items, err = u.popMark(); err == nil {
+				d := &pickleDict{}
+				for i := 0; i+1 < len(items); i += 2 {
+					d.set(items[i], items[i+1])
+				}
+				u.push(d)
+			}
+		case 'l': // LIST
+			var items []interface{}
+			if items, err = u.popMark(); err == nil {
+				u.push(&pickleList{Items: items})
+			}
+		case 't', 0x91: // TUPLE, FROZENSET
+			var items []interface{}
+			if items, err = u.popMark(); err == nil {
+				u.push(pickleTuple(items))
+			}
+		case 0x85, 0x86, 0x87: // TUPLE1, TUPLE2, TUPLE3
+			n := int(op - 0x84)
+			if len(u.stack) < n {
+				err = errors.New("Pickle stack underflow")
+				break
+			}
+			items := make(pickleTuple, n)
+			copy(items, u.stack[len(u.stack)-n:])
+			u.stack = u.stack[:len(u.stack)-n]
+			u.push(items)
+
+		case 'a': // APPEND
+			var v, l interface{}
+			if v, err = u.pop(); err != nil {
+				break
+			}
+			if l, err = u.top(); err == nil {
+				if list, ok := l.(*pickleList); ok {
+					list.Items = append(list.Items, v)
+				}
+			}
+		case 'e', 0x90: // APPENDS, ADDITEMS
+			var items []interface{}
+			if items, err = u.popMark(); err != nil {
+				break
+			}
+			var l interface{}
+			if l, err = u.top(); err == nil {
+				if list, ok := l.(*pickleList); ok {
+					list.Items = append(list.Items, items...)
+				}
+			}
+		case 's': // SETITEM
+			var k, v, d interface{}
+			if v, err = u.pop(); err != nil {
+				break
+			}
+			if k, err = u.pop(); err != nil {
+				break
+			}
+			if d, err = u.top(); err == nil {
+				if dict, ok := d.(*pickleDict); ok {
+					dict.set(k, v)
+				}
+			}
+		case 'u': // SETITEMS
+			var items []interface{}
+			if items, err = u.popMark(); err != nil {
+				break
+			}
+			var d interface{}
+			if d, err = u.top(); err == nil {
+				if dict, ok := d.(*pickleDict); ok {
+					for i := 0; i+1 < len(items); i += 2 {
+						dict.set(items[i], items[i+1])
+					}
+				}
+			}
+
+		case 'q', 'r', 'p', 0x94: // BINPUT, LONG_BINPUT, PUT, MEMOIZE
+			var idx int
+			switch op {
+			case 'q', 'r':
+				size := 1
+				if op == 'r' {
+					size = 4
+				}
+				var n uint64
+				n, err = u.readUint(size)
+				idx = int(n)
+			case 'p':
+				var line string
+				if line, err = u.readLine(); err == nil {
+					idx, err = strconv.Atoi(line)
+				}
+			case 0x94:
+				idx = len(u.memo)
+			}
+			if err != nil {
+				break
+			}
+			var v interface{}
+			if v, err = u.top(); err == nil {
+				u.memo[idx] = v
+			}
+		case 'h', 'j', 'g': // BINGET, LONG_BINGET, GET
+			var idx int
+			switch op {
+			case 'h', 'j':
+				size := 1
+				if op == 'j' {
+					size = 4
+				}
+				var n uint64
+				n, err = u.readUint(size)
+				idx = int(n)
+			case 'g':
+				var line string
+				if line, err = u.readLine(); err == nil {
+					idx, err = strconv.Atoi(line)
+				}
+			}
+			if err != nil {
+				break
+			}
+			v, ok := u.memo[idx]
+			if !ok {
+				err = fmt.Errorf("Pickle memo key %d not found", idx)
+				break
+			}
+			u.push(v)
+
+		case 'c': // GLOBAL
+			var module, name string
+			if module, err = u.readLine(); err != nil {
+				break
+			}
+			if name, err = u.readLine(); err == nil {
+				u.push(&pickleGlobal{Module: module, Name: name})
+			}
+		case 0x93: // STACK_GLOBAL
+			var module, name interface{}
+			if name, err = u.pop(); err != nil {
+				break
+			}
+			if module, err = u.pop(); err == nil {
+				u.push(&pickleGlobal{
+					Module: fmt.Sprint(module),
+					Name:   fmt.Sprint(name),
+				})
+			}
+		case 'R': // REDUCE
+			var args, callable interface{}
+			if args, err = u.pop(); err != nil {
+				break
+			}
+			if callable, err = u.pop(); err == nil {
+				u.push(reduce(callable, args))
+			}
+		case 0x81: // NEWOBJ
+			var args, cls interface{}
+			if args, err = u.pop(); err != nil {
+				break
+			}
+			if cls, err = u.pop(); err == nil {
+				u.push(&pickleObject{Class: cls, Args: args})
+			}
+		case 'b': // BUILD
+			var state, obj interface{}
+			if state, err = u.pop(); err != nil {
+				break
+			}
+			if obj, err = u.top(); err != nil {
+				break
+			}
+			switch o := obj.(type) {
+			case *pickleObject:
+				o.State = state
+			case *pickleDict:
+				if sd, ok := state.(*pickleDict); ok {
+					for i := range sd.Keys {
+						o.set(sd.Keys[i], sd.Values[i])
+					}
+				}
+			}
+		case 'Q': // BINPERSID
+			var pid interface{}
+			if pid, err = u.pop(); err == nil {
+				u.push(persistentLoad(pid))
+			}
+		case 'P': // PERSID
+			var line string
+			if line, err = u.readLine(); err == nil {
+				u.push(persistentLoad(line))
+			}
+
+		default:
+			return nil, fmt.Errorf("Unsupported pickle opcode 0x%02x", op)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// decodeLong decodes a little-endian two's complement integer.
+func decodeLong(b []byte) interface{} {
+	if len(b) == 0 {
+		return int64(0)
+	}
+	if len(b) <= 8 {
+		var v uint64
+		for i := len(b) - 1; i >= 0; i-- {
+			v = v<<8 | uint64(b[i])
+		}
+		if b[len(b)-1]&0x80 != 0 && len(b) < 8 {
+			v -= 1 << (8 * uint(len(b)))
+		}
+		return int64(v)
+	}
+	be := make([]byte, len(b))
+	for i := range b {
+		be[len(b)-1-i] = b[i]
+	}
+	n := new(big.Int).SetBytes(be)
+	if b[len(b)-1]&0x80 != 0 {
+		n.Sub(n, new(big.Int).Lsh(big.NewInt(1), uint(8*len(b))))
+	}
+	return n
+}
+
+// persistentLoad resolves the persistent ids that torch.save uses to refer to
+// tensor storages: ('storage', storage_type, key, location, numel, ...)
+func persistentLoad(pid interface{}) interface{} {
+	t, ok := pid.(pickleTuple)
+	if !ok || len(t) < 2 || t[0] != "storage" {
+		return &pickleObject{Args: pid}
+	}
+	storage := &pickleStorage{Dtype: "unknown"}
+	if len(t) >= 3 {
+		storage.Key = fmt.Sprint(t[2])
+	}
+	if g, ok := t[1].(*pickleGlobal); ok {
+		if dtype, ok := torchStorageDtypes[g.Name]; ok {
+			storage.Dtype = dtype
+		}
+	}
+	return storage
+}
+
+// reduce interprets calls to the torch functions that rebuild tensors and
+// parameters, and records everything else as an opaque object.
+func reduce(callable, args interface{}) interface{} {
+	g, _ := callable.(*pickleGlobal)
+	t, _ := args.(pickleTuple)
+	if g == nil {
+		return &pickleObject{Class: callable, Args: args}
+	}
+
+	switch {
+	case g.Module == "collections" && g.Name == "OrderedDict":
+		return &pickleDict{}
+	case g.Module == "torch._utils" && strings.HasPrefix(g.Name, "_rebuild_tensor"),
+		g.Module == "torch._utils" && g.Name == "_rebuild_qtensor":
+		if len(t) >= 3 {
+			tensor := &pickleTensor{Dtype: "unknown", Shape: []int64{}}
+			if storage, ok := t[0].(*pickleStorage); ok {
+				tensor.Dtype = storage.Dtype
+				tensor.Storage = storage
+			}
+			if offset, ok := t[1].(int64); ok {
+				tensor.Offset = offset
+			}
+			tensor.Shape = pickleInts(t[2])
+			if len(t) >= 4 {
+				tensor.Stride = pickleInts(t[3])
+			}
+			return tensor
+		}
+	case g.Module == "torch._utils" && strings.HasPrefix(g.Name, "_rebuild_parameter"):
+		if len(t) >= 1 {
+			return t[0]
+		}
+	}
+	return &pickleObject{Class: callable, Args: args}
+}
+
+// pickleInts converts a tuple of ints, like a tensor's size or stride.
+func pickleInts(v interface{}) []int64 {
+	ints := []int64{}
+	t, _ := v.(pickleTuple)
+	for _, item := range t {
+		if n, ok := item.(int64); ok {
+			ints = append(ints, n)
+		}
+	}
+	return ints
+}
+
+// collectTensors walks an unpickled object graph and calls visit for every
+// tensor it finds, named by the dict keys on the path to it.  Keys with a
+// leading underscore (like nn.Module's _parameters and _modules) are left out
+// of the name so that pickled modules produce the same names as their state
+// dicts.
+func collectTensors(obj interface{}, visit func(name string, t *pickleTensor)) {
+	walkPickle(visit, "", obj, map[interface{}]bool{}, 0)
+}
+
+func walkPickle(visit func(string, *pickleTensor), prefix string, obj interface{}, seen map[interface{}]bool, depth int) {
+	if depth > 100 {
+		return
+	}
+	join := func(k string) string {
+		if strings.HasPrefix(k, "_") {
+			return prefix
+		}
+		if prefix == "" {
+			return k
+		}
+		return prefix + "." + k
+	}
+
+	switch o := obj.(type) {
+	case *pickleTensor:
+		if seen[o] {
+			return
+		}
+		seen[o] = true
+		visit(prefix, o)
+	case *pickleDict:
+		if seen[o] {
+			return
+		}
+		seen[o] = true
+		for i, k := range o.Keys {
+			walkPickle(visit, join(fmt.Sprint(k)), o.Values[i], seen, depth+1)
+		}
+	case *pickleList:
+		if seen[o] {
+			return
+		}
+		seen[o] = true
+		for i, item := range o.Items {
+			walkPickle(visit, join(strconv.Itoa(i)), item, seen, depth+1)
+		}
+	case pickleTuple:
+		for _, item := range o {
+			walkPickle(visit, prefix, item, seen, depth+1)
+		}
+	case *pickleObject:
+		if seen[o] {
+			return
+		}
+		seen[o] = true
+		walkPickle(visit, prefix, o.State, seen, depth+1)
+	}
+}
+
+// loadLegacyPyTorch unpickles the pre-1.6 torch.save format, which is a series
+// of pickles: magic number, protocol version, system info, and then the saved
+// object itself.  The unpickler is left positioned just past the object.
+func loadLegacyPyTorch(r io.Reader, size int64) (*unpickler, interface{}, error) {
+	u := newUnpickler(r, size)
+	magic, err := u.load()
+	if err != nil {
+		return nil, nil, ErrUnsupported
+	}
+	if n, ok := magic.(*big.Int); !ok || n.Text(16) != "1950a86a20f9469cfc6c" {
+		return nil, nil, ErrUnsupported
+	}
+	for i := 0; i < 2; i++ {
+		if _, err = u.load(); err != nil {
+			return nil, nil, err
+		}
+	}
+	obj, err := u.load()
+	if err != nil {
+		return nil, nil, err
+	}
+	return u, obj, nil
+}
+
+func inspectLegacyPyTorch(r io.Reader, size int64) (*Structure, error) {
+	_, obj, err := loadLegacyPyTorch(r, size)
+	if err != nil {
+		return nil, err
+	}
+
+	s := newStructure(FORMAT_PYTORCH)
+	collectTensors(obj, func(name string, t *pickleTensor) {
+		s.addTensor(name, t.Dtype, t.Shape)
+	})
+	return s, nil
+}
+
+// readLegacyPyTorchTensors reads tensor values out of the pre-1.6 format.
+// After the saved object comes a pickled list of storage keys, and then each
+// of those storages in turn: an element count followed by the raw elements.
+func readLegacyPyTorchTensors(r io.Reader, size int64) (*tensorSet, error) {
+	u, obj, err := loadLegacyPyTorch(r, size)
+	if err != nil {
+		return nil, err
+	}
+
+	var tensors []*pickleTensor
+	var names []string
+	dtypes := map[string]string{}
+	collectTensors(obj, func(name string, t *pickleTensor) {
+		names = append(names, name)
+		tensors = append(tensors, t)
+		if t.Storage != nil {
+			dtypes[t.Storage.Key] = t.Storage.Dtype
+		}
+	})
+
+	keys, err := u.load()
+	if err != nil {
+		return nil, err
+	}
+	keyList, ok := keys.(*pickleList)
+	if !ok {
+		return nil, errors.New("Missing list of storage keys")
+	}
+
+	storages := map[string][]byte{}
+	for _, k := range keyList.Items {
+		key := fmt.Sprint(k)
+		numel, err := u.readUint(8)
+		if err != nil {
+			return nil, err
+		}
+		size, ok := dtypeSizes[dtypes[key]]
+		if !ok {
+			// Without knowing its element size we can't skip past this
+			// storage, so any that follow it are unreadable too
+			break
+		}
+		if numel > uint64(size) {
+			return nil, errPickleTruncated
+		}
+		b, err := u.read(int(numel) * int(size))
+		if err != nil {
+			return nil, err
+		}
+		storages[key] = b
+	}
+
+	ts := newTensorSet(FORMAT_PYTORCH)
+	for i, t := range tensors {
+		if t.Storage == nil || storages[t.Storage.Key] == nil {
+			ts.add(names[i], nil)
+			continue
+		}
+		ts.add(names[i], &tensorData{
+			dtype:  t.Dtype,
+			shape:  t.Shape,
+			data:   storages[t.Storage.Key],
+			order:  binary.LittleEndian,
+			offset: t.Offset,
+			stride: t.Stride,
+		})
+	}
+	return ts, nil
+}
@@ -0,0 +1,172 @@
+package inspect
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// dtypeSizes holds the size in bytes of each element type we can read values
+// out of.  Anything else (complex numbers, strings, compound types) is only
+// ever described, never read.
+var dtypeSizes = map[string]int64{
+	"bool":     1,
+	"int8":     1,
+	"uint8":    1,
+	"int16":    2,
+	"uint16":   2,
+	"float16":  2,
+	"bfloat16": 2,
+	"int32":    4,
+	"uint32":   4,
+	"float32":  4,
+	"int64":    8,
+	"uint64":   8,
+	"float64":  8,
+}
+
+// tensorData gives access to the values of a tensor stored somewhere inside a
+// checkpoint.  Offset and stride are counted in elements, and a nil stride
+// means the values are laid out contiguously in row-major order.
+type tensorData struct {
+	dtype  string
+	shape  []int64
+	data   []byte
+	order  binary.ByteOrder
+	offset int64
+	stride []int64
+}
+
+func (t *tensorData) numel() int64 {
+	n := int64(1)
+	for _, dim := range t.shape {
+		n *= dim
+	}
+	return n
+}
+
+// valid checks that every element the tensor refers to is actually inside of
+// its data, so that reading it can never go out of bounds.
+func (t *tensorData) valid() bool {
+	size, ok := dtypeSizes[t.dtype]
+	if !ok || t.offset < 0 {
+		return false
+	}
+	if len(t.stride) != 0 && len(t.stride) != len(t.shape) {
+		return false
+	}
+	n := t.numel()
+	if n <= 0 {
+		return n == 0
+	}
+	last := t.offset + n - 1
+	if t.stride != nil {
+		last = t.offset
+		for i, dim := range t.shape {
+			if t.stride[i] < 0 {
+				return false
+			}
+			last += (dim - 1) * t.stride[i]
+		}
+	}
+	return (last+1)*size <= int64(len(t.data))
+}
+
+// value returns the i-th element of the tensor, counting in row-major order.
+func (t *tensorData) value(i int64) float64 {
+	idx := t.offset + i
+	if t.stride != nil {
+		idx = t.offset
+		for d := len(t.shape) - 1; d >= 0; d-- {
+			dim := t.shape[d]
+			idx += (i % dim) * t.stride[d]
+			i /= dim
+		}
+	}
+
+	b := t.data[idx*dtypeSizes[t.dtype]:]
+	switch t.dtype {
+	case "bool", "uint8":
+		return float64(b[0])
+	case "int8":
+		return float64(int8(b[0]))
+	case "int16":
+		return float64(int16(t.order.Uint16(b)))
+	case "uint16":
+		return float64(t.order.Uint16(b))
+	case "float16":
+		return float16ToFloat64(t.order.Uint16(b))
+	case "bfloat16":
+		return float64(math.Float32frombits(uint32(t.order.Uint16(b)) << 16))
+	case "int32":
+		return float64(int32(t.order.Uint32(b)))
+	case "uint32":
+		return float64(t.order.Uint32(b))
+	case "float32":
+		return float64(math.Float32frombits(t.order.Uint32(b)))
+	case "int64":
+		return float64(int64(t.order.Uint64(b)))
+	case "uint64":
+		return float64(t.order.Uint64(b))
+	case "float64":
+		return math.Float64frombits(t.order.Uint64(b))
+	}
+	return math.NaN()
+}
+
+// fortranStride works out the strides of a column-major array.
+func fortranStride(shape []int64) []int64 {
+	stride := make([]int64, len(shape))
+	n := int64(1)
+	for i, dim := range shape {
+		stride[i] = n
+		n *= dim
+	}
+	return stride
+}
+
+func float16ToFloat64(h uint16) float64 {
+	sign := 1.0
+	if h&0x8000 != 0 {
+		sign = -1.0
+	}
+	exp := int(h>>10) & 0x1f
+	frac := float64(h & 0x3ff)
+	switch exp {
+	case 0:
+		return sign * math.Ldexp(frac, -24)
+	case 0x1f:
+		if frac != 0 {
+			return math.NaN()
+		}
+		return math.Inf(int(sign))
+	}
+	return sign * math.Ldexp(1+frac/1024, exp-15)
+}
+
+// tensorSet holds the values of every tensor in a checkpoint, in the order
+// they appear.  Tensors whose values can't be read are present with a nil
+// entry, so they can still be reported.
+type tensorSet struct {
+	format  string
+	names   []string
+	tensors map[string]*tensorData
+}
+
+func newTensorSet(format string) *tensorSet {
+	return &tensorSet{
+		format:  format,
+		names:   []string{},
+		tensors: map[string]*tensorData{},
+	}
+}
+
+func (ts *tensorSet) add(name string, t *tensorData) {
+	if _, ok := ts.tensors[name]; ok {
+		return
+	}
+	if t != nil && !t.valid() {
+		t = nil
+	}
+	ts.names = append(ts.names, name)
+	ts.tensors[name] = t
+}
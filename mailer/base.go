@@ -0,0 +1,12 @@
+package mailer
+
+import (
+	"errors"
+)
+
+var ErrMailDisabled = errors.New("Sending e-mail is not configured")
+
+//go:generate counterfeiter $GOFILE Mailer
+type Mailer interface {
+	Send(to, subject, body string) error
+}
@@ -0,0 +1,21 @@
+package mailer
+
+import (
+	log "github.com/Sirupsen/logrus"
+)
+
+// LogMailer logs e-mails instead of sending them, so that e.g. password reset
+// links can be followed in development without an SMTP server.
+type LogMailer struct{}
+
+func NewLogMailer() *LogMailer {
+	return &LogMailer{}
+}
+
+func (m *LogMailer) Send(to, subject, body string) error {
+	log.WithFields(log.Fields{
+		"to":      to,
+		"subject": subject,
+	}).Info("Not sending e-mail:\n" + body)
+	return nil
+}
@@ -0,0 +1,58 @@
+package mailer
+
+import (
+	"fmt"
+	"net/mail"
+	"net/smtp"
+	"strings"
+)
+
+type SMTPMailer struct {
+	host     string
+	port     int
+	user     string
+	password string
+	from     string
+}
+
+func NewSMTPMailer(host string, port int, user, password, from string) *SMTPMailer {
+	return &SMTPMailer{
+		host:     host,
+		port:     port,
+		user:     user,
+		password: password,
+		from:     from,
+	}
+}
+
+// Send sends a plain text e-mail through the SMTP server.
+func (m *SMTPMailer) Send(to, subject, body string) error {
+	if m.host == "" {
+		return ErrMailDisabled
+	}
+
+	from, err := mail.ParseAddress(m.from)
+	if err != nil {
+		return err
+	}
+
+	// Keep header injection out of the subject
+	subject = strings.NewReplacer("\r", " ", "\n", " ").Replace(subject)
+
+	msg := strings.Join([]string{
+		"From: " + m.from,
+		"To: " + to,
+		"Subject: " + subject,
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=utf-8",
+		"",
+		body,
+	}, "\r\n")
+
+	var auth smtp.Auth
+	if m.user != "" {
+		auth = smtp.PlainAuth("", m.user, m.password, m.host)
+	}
+	addr := fmt.Sprintf("%s:%d", m.host, m.port)
+	return smtp.SendMail(addr, auth, from.Address, []string{to}, []byte(msg))
+}
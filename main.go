@@ -1,7 +1,15 @@
 package main
 
-import "github.com/ericflo/gradientzoo/api"
+import (
+	"os"
+
+	"github.com/ericflo/gradientzoo/api"
+)
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		api.Migrate(os.Args[2:])
+		return
+	}
 	api.Main()
 }
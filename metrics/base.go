@@ -0,0 +1,181 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Metrics are kept in memory by each API server, and scraped from it by
+// Prometheus in its text exposition format.  This covers just the metric types
+// the service needs, rather than pulling in the whole client library.
+
+// Collector is a family of metrics sharing a name, e.g. a counter with one
+// series for each set of label values it's been given.
+type Collector interface {
+	Name() string
+	write(w *bufio.Writer)
+}
+
+// Registry is the set of metrics that are exposed together.
+type Registry struct {
+	mu         sync.Mutex
+	collectors map[string]Collector
+}
+
+func NewRegistry() *Registry {
+	return &Registry{collectors: map[string]Collector{}}
+}
+
+// Default is where the New* functions register their metrics
+var Default = NewRegistry()
+
+// Register adds the collector, panicking if there's one by that name already,
+// since metrics are made when the program starts and a clash is a bug.
+func (r *Registry) Register(c Collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.collectors[c.Name()]; ok {
+		panic("metrics: " + c.Name() + " is already registered")
+	}
+	r.collectors[c.Name()] = c
+}
+
+// Write writes every metric in the Prometheus text format, alphabetically.
+func (r *Registry) Write(w io.Writer) error {
+	r.mu.Lock()
+	names := make([]string, 0, len(r.collectors))
+	for name := range r.collectors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	collectors := make([]Collector, 0, len(names))
+	for _, name := range names {
+		collectors = append(collectors, r.collectors[name])
+	}
+	r.mu.Unlock()
+
+	bw := bufio.NewWriter(w)
+	for _, c := range collectors {
+		c.write(bw)
+	}
+	return bw.Flush()
+}
+
+// The content type of the text format, for responses to scrapes
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// family holds what all the metric types have in common: their description,
+// and one series per set of label values.
+type family struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+type series struct {
+	labelValues []string
+	value       float64
+	// Only for histograms, counts per bucket (not cumulative) and their sum
+	buckets []uint64
+	sum     float64
+}
+
+func newFamily(name, help, kind string, labels []string) *family {
+	return &family{
+		name:   name,
+		help:   help,
+		kind:   kind,
+		labels: labels,
+		series: map[string]*series{},
+	}
+}
+
+func (f *family) Name() string {
+	return f.name
+}
+
+// get finds or makes the series for the label values.  The family's lock must
+// be held.
+func (f *family) get(labelValues []string) *series {
+	if len(labelValues) != len(f.labels) {
+		panic(fmt.Sprintf("metrics: %s takes %d label values, not %d", f.name,
+			len(f.labels), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+	s, ok := f.series[key]
+	if !ok {
+		s = &series{labelValues: append([]string{}, labelValues...)}
+		f.series[key] = s
+	}
+	return s
+}
+
+// sorted lists the series in order of their label values, so that scrapes
+// come out the same each time.  The family's lock must be held.
+func (f *family) sorted() []*series {
+	keys := make([]string, 0, len(f.series))
+	for key := range f.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	ss := make([]*series, 0, len(keys))
+	for _, key := range keys {
+		ss = append(ss, f.series[key])
+	}
+	return ss
+}
+
+func (f *family) writeHeader(w *bufio.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", f.name, escapeHelp(f.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", f.name, f.kind)
+}
+
+// writeSample writes one line, with the family's labels and then any extra
+// ones, like a histogram bucket's "le".
+func (f *family) writeSample(w *bufio.Writer, name string, labelValues []string, value float64, extra ...string) {
+	w.WriteString(name)
+	pairs := make([]string, 0, len(labelValues)+len(extra)/2)
+	for i, v := range labelValues {
+		pairs = append(pairs, f.labels[i]+`="`+escapeLabel(v)+`"`)
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, extra[i]+`="`+escapeLabel(extra[i+1])+`"`)
+	}
+	if len(pairs) > 0 {
+		w.WriteString("{" + strings.Join(pairs, ",") + "}")
+	}
+	w.WriteString(" " + formatFloat(value) + "\n")
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var helpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+var labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
@@ -0,0 +1,94 @@
+package metrics
+
+import (
+	"bufio"
+)
+
+// Counter only ever goes up, e.g. requests served or bytes uploaded.  Label
+// values are passed along with each change, in the order the labels were
+// given when it was made.
+type Counter struct {
+	*family
+}
+
+func NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{newFamily(name, help, "counter", labels)}
+	Default.Register(c)
+	return c
+}
+
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds v, which mustn't be negative.
+func (c *Counter) Add(v float64, labelValues ...string) {
+	if v < 0 {
+		panic("metrics: " + c.name + " can't go down")
+	}
+	c.mu.Lock()
+	c.get(labelValues).value += v
+	c.mu.Unlock()
+}
+
+func (c *Counter) write(w *bufio.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.writeHeader(w)
+	for _, s := range c.sorted() {
+		c.writeSample(w, c.name, s.labelValues, s.value)
+	}
+}
+
+// Gauge goes up and down, e.g. requests in flight.
+type Gauge struct {
+	*family
+}
+
+func NewGauge(name, help string, labels ...string) *Gauge {
+	g := &Gauge{newFamily(name, help, "gauge", labels)}
+	Default.Register(g)
+	return g
+}
+
+func (g *Gauge) Set(v float64, labelValues ...string) {
+	g.mu.Lock()
+	g.get(labelValues).value = v
+	g.mu.Unlock()
+}
+
+func (g *Gauge) Add(v float64, labelValues ...string) {
+	g.mu.Lock()
+	g.get(labelValues).value += v
+	g.mu.Unlock()
+}
+
+func (g *Gauge) write(w *bufio.Writer) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.writeHeader(w)
+	for _, s := range g.sorted() {
+		g.writeSample(w, g.name, s.labelValues, s.value)
+	}
+}
+
+// GaugeFunc is a gauge whose value is looked up whenever it's scraped, e.g. how
+// long a queue is.  If looking it up fails, it's left out of that scrape.
+type GaugeFunc struct {
+	*family
+	f func() (float64, error)
+}
+
+func NewGaugeFunc(name, help string, f func() (float64, error)) *GaugeFunc {
+	g := &GaugeFunc{newFamily(name, help, "gauge", nil), f}
+	Default.Register(g)
+	return g
+}
+
+func (g *GaugeFunc) write(w *bufio.Writer) {
+	v, err := g.f()
+	g.writeHeader(w)
+	if err == nil {
+		g.writeSample(w, g.name, nil, v)
+	}
+}
@@ -0,0 +1,60 @@
+package metrics
+
+import (
+	"bufio"
+	"math"
+)
+
+// Buckets for latencies in seconds, from 5ms to 10s
+var LatencyBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Histogram counts observations, e.g. request latencies, into buckets by their
+// size.  Each bucket counts the observations less than or equal to its upper
+// bound, with a last one for everything bigger.
+type Histogram struct {
+	*family
+	bounds []float64
+}
+
+// NewHistogram makes a histogram with buckets going up to each of the bounds,
+// which must be in increasing order.
+func NewHistogram(name, help string, bounds []float64, labels ...string) *Histogram {
+	h := &Histogram{newFamily(name, help, "histogram", labels), bounds}
+	Default.Register(h)
+	return h
+}
+
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	i := 0
+	for i < len(h.bounds) && v > h.bounds[i] {
+		i++
+	}
+	h.mu.Lock()
+	s := h.get(labelValues)
+	if s.buckets == nil {
+		s.buckets = make([]uint64, len(h.bounds)+1)
+	}
+	s.buckets[i]++
+	s.sum += v
+	h.mu.Unlock()
+}
+
+func (h *Histogram) write(w *bufio.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.writeHeader(w)
+	for _, s := range h.sorted() {
+		var count uint64
+		for i, n := range s.buckets {
+			count += n
+			bound := math.Inf(1)
+			if i < len(h.bounds) {
+				bound = h.bounds[i]
+			}
+			h.writeSample(w, h.name+"_bucket", s.labelValues, float64(count),
+				"le", formatFloat(bound))
+		}
+		h.writeSample(w, h.name+"_sum", s.labelValues, s.sum)
+		h.writeSample(w, h.name+"_count", s.labelValues, float64(count))
+	}
+}
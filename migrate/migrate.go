@@ -0,0 +1,187 @@
+package migrate
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// goose's table, with a row each time a migration is applied or rolled back
+const VERSION_TABLE = "goose_db_version"
+
+// Migrations take this advisory lock, so that servers starting up together
+// don't apply the same one twice
+const lockKey = 7461626
+
+// Status is whether a migration has been applied, and when.
+type Status struct {
+	Migration   *Migration
+	Applied     bool
+	AppliedTime time.Time
+}
+
+// Statuses says which of the migrations have been applied, oldest first.
+func Statuses(db *sql.DB, ms []*Migration) ([]*Status, error) {
+	if err := ensureTable(db); err != nil {
+		return nil, err
+	}
+	applied, err := appliedVersions(db)
+	if err != nil {
+		return nil, err
+	}
+	statuses := make([]*Status, 0, len(ms))
+	for _, m := range ms {
+		t, ok := applied[m.Version]
+		statuses = append(statuses, &Status{Migration: m, Applied: ok, AppliedTime: t})
+	}
+	return statuses, nil
+}
+
+// Up applies every migration that hasn't been yet, oldest first, including
+// any older than the latest one applied, which happens when branches are
+// merged.  It returns the ones it applied.
+func Up(db *sql.DB, ms []*Migration) ([]*Migration, error) {
+	if err := ensureTable(db); err != nil {
+		return nil, err
+	}
+	done := []*Migration{}
+	for _, m := range ms {
+		ran, err := run(db, m, true)
+		if err != nil {
+			return done, fmt.Errorf("%s: %s", m.Filename, err)
+		}
+		if ran {
+			done = append(done, m)
+		}
+	}
+	return done, nil
+}
+
+// Down rolls back the migration applied most recently, returning it, or nil
+// if there aren't any to roll back.
+func Down(db *sql.DB, ms []*Migration) (*Migration, error) {
+	if err := ensureTable(db); err != nil {
+		return nil, err
+	}
+	var version int64
+	err := db.QueryRow(`
+	SELECT version_id FROM ` + VERSION_TABLE + ` V
+	WHERE is_applied AND version_id > 0 AND id = (
+		SELECT MAX(id) FROM ` + VERSION_TABLE + ` W WHERE W.version_id = V.version_id
+	)
+	ORDER BY id DESC
+	LIMIT 1
+	`).Scan(&version)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range ms {
+		if m.Version == version {
+			if _, err = run(db, m, false); err != nil {
+				return nil, fmt.Errorf("%s: %s", m.Filename, err)
+			}
+			return m, nil
+		}
+	}
+	return nil, fmt.Errorf("Version %d was applied, but there's no migration for it here", version)
+}
+
+// ensureTable makes goose's table if it isn't there, with the row goose
+// starts it with.
+func ensureTable(db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err = tx.Exec(`SELECT pg_advisory_xact_lock($1)`, lockKey); err != nil {
+		return err
+	}
+	var exists bool
+	err = tx.QueryRow(`SELECT to_regclass($1) IS NOT NULL`, VERSION_TABLE).Scan(&exists)
+	if err != nil || exists {
+		return err
+	}
+	_, err = tx.Exec(`
+	CREATE TABLE ` + VERSION_TABLE + ` (
+		id SERIAL NOT NULL,
+		version_id BIGINT NOT NULL,
+		is_applied BOOLEAN NOT NULL,
+		tstamp TIMESTAMP NULL DEFAULT NOW(),
+		PRIMARY KEY(id)
+	)`)
+	if err != nil {
+		return err
+	}
+	if _, err = tx.Exec(`INSERT INTO ` + VERSION_TABLE + ` (version_id, is_applied) VALUES (0, TRUE)`); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// appliedVersions are the versions whose latest row says they're applied,
+// with when they were.
+func appliedVersions(q interface {
+	Query(string, ...interface{}) (*sql.Rows, error)
+}) (map[int64]time.Time, error) {
+	rows, err := q.Query(`
+	SELECT DISTINCT ON (version_id) version_id, is_applied, tstamp
+	FROM ` + VERSION_TABLE + `
+	ORDER BY version_id, id DESC
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	applied := map[int64]time.Time{}
+	for rows.Next() {
+		var version int64
+		var isApplied bool
+		var t time.Time
+		if err = rows.Scan(&version, &isApplied, &t); err != nil {
+			return nil, err
+		}
+		if isApplied {
+			applied[version] = t
+		}
+	}
+	return applied, rows.Err()
+}
+
+// run applies or rolls back the migration in a transaction, unless another
+// server got to it first, and says whether it did.
+func run(db *sql.DB, m *Migration, up bool) (bool, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+	if _, err = tx.Exec(`SELECT pg_advisory_xact_lock($1)`, lockKey); err != nil {
+		return false, err
+	}
+	applied, err := appliedVersions(tx)
+	if err != nil {
+		return false, err
+	}
+	if _, ok := applied[m.Version]; ok == up {
+		return false, nil
+	}
+	stmts := m.Up
+	if !up {
+		stmts = m.Down
+	}
+	for _, stmt := range stmts {
+		if _, err = tx.Exec(stmt); err != nil {
+			return false, err
+		}
+	}
+	_, err = tx.Exec(`INSERT INTO `+VERSION_TABLE+` (version_id, is_applied) VALUES ($1, $2)`,
+		m.Version, up)
+	if err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
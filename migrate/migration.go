@@ -0,0 +1,144 @@
+package migrate
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Migrations are the SQL files in db/migrations, which ship alongside the
+// binary.  They're written for goose: each is named for its version, a
+// timestamp, and has "-- +goose Up" and "-- +goose Down" sections of
+// statements ending in semicolons, with "-- +goose StatementBegin" and
+// "-- +goose StatementEnd" around any, like function bodies, that have
+// semicolons of their own.  Which have been applied is kept in goose's table
+// too, so that databases migrated with goose carry on where they left off.
+
+type Migration struct {
+	Version  int64
+	Filename string
+	Up       []string
+	Down     []string
+}
+
+// byVersion sorts migrations oldest first
+type byVersion []*Migration
+
+func (a byVersion) Len() int           { return len(a) }
+func (a byVersion) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a byVersion) Less(i, j int) bool { return a[i].Version < a[j].Version }
+
+// Load reads every migration in dir, oldest first.
+func Load(dir string) ([]*Migration, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.sql"))
+	if err != nil {
+		return nil, err
+	}
+	ms := make([]*Migration, 0, len(paths))
+	seen := map[int64]string{}
+	for _, path := range paths {
+		m, err := loadMigration(path)
+		if err != nil {
+			return nil, err
+		}
+		if other, ok := seen[m.Version]; ok {
+			return nil, fmt.Errorf("%s and %s have the same version", other, m.Filename)
+		}
+		seen[m.Version] = m.Filename
+		ms = append(ms, m)
+	}
+	if len(ms) == 0 {
+		return nil, fmt.Errorf("There are no migrations in %s", dir)
+	}
+	sort.Sort(byVersion(ms))
+	return ms, nil
+}
+
+func loadMigration(path string) (*Migration, error) {
+	filename := filepath.Base(path)
+	i := strings.Index(filename, "_")
+	if i <= 0 {
+		return nil, fmt.Errorf("%s should be named like 20160101120000_what_it_does.sql", filename)
+	}
+	version, err := strconv.ParseInt(filename[:i], 10, 64)
+	if err != nil || version <= 0 {
+		return nil, fmt.Errorf("%s should be named like 20160101120000_what_it_does.sql", filename)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	up, down, err := parse(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", filename, err)
+	}
+	return &Migration{Version: version, Filename: filename, Up: up, Down: down}, nil
+}
+
+const commandPrefix = "-- +goose "
+
+// onlyComments is whether the lines have nothing but comments and blanks.
+func onlyComments(lines []string) bool {
+	for _, line := range lines {
+		if trimmed := strings.TrimSpace(line); trimmed != "" && !strings.HasPrefix(trimmed, "--") {
+			return false
+		}
+	}
+	return true
+}
+
+// parse splits a migration into its up and down statements.
+func parse(sql string) (up, down []string, err error) {
+	var section *[]string
+	var buf []string
+	inBlock := false
+	end := func() {
+		if !onlyComments(buf) && section != nil {
+			*section = append(*section, strings.TrimSpace(strings.Join(buf, "\n")))
+		}
+		buf = nil
+	}
+	for n, line := range strings.Split(sql, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, commandPrefix) {
+			switch cmd := strings.TrimSpace(trimmed[len(commandPrefix):]); cmd {
+			case "Up":
+				end()
+				section = &up
+			case "Down":
+				end()
+				section = &down
+			case "StatementBegin":
+				end()
+				inBlock = true
+			case "StatementEnd":
+				end()
+				inBlock = false
+			default:
+				return nil, nil, fmt.Errorf("line %d: unknown command %q", n+1, cmd)
+			}
+			continue
+		}
+		if section == nil {
+			continue
+		}
+		buf = append(buf, line)
+		if !inBlock && strings.HasSuffix(trimmed, ";") {
+			end()
+		}
+	}
+	if inBlock {
+		return nil, nil, fmt.Errorf("StatementBegin without a StatementEnd")
+	}
+	// Anything left over had better just be comments
+	if !onlyComments(buf) {
+		return nil, nil, fmt.Errorf("The last statement doesn't end with a semicolon")
+	}
+	if up == nil {
+		return nil, nil, fmt.Errorf("There's no \"-- +goose Up\" section")
+	}
+	return up, down, nil
+}
@@ -0,0 +1,184 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/pborman/uuid"
+	"gopkg.in/guregu/null.v3"
+	runner "gopkg.in/mgutz/dat.v1/sqlx-runner"
+)
+
+const ABUSE_FLAG_TABLE = "abuse_flag"
+
+const (
+	ABUSE_PRIVATE_DOWNLOADS = "private_downloads"
+)
+
+type AbuseFlagDb struct {
+	DB  *runner.DB
+	Api *ApiCollection
+}
+
+//go:generate counterfeiter $GOFILE AbuseFlagApi
+type AbuseFlagApi interface {
+	ById(id interface{}) (*AbuseFlag, error)
+	Delete(id interface{}) error
+	Save(*AbuseFlag) error
+	Truncate() error
+
+	Unresolved(limit int) ([]*AbuseFlag, error)
+	ThrottledUntil(userId string) (null.Time, error)
+}
+
+func NewAbuseFlagDb(db *runner.DB, api *ApiCollection) *AbuseFlagDb {
+	return &AbuseFlagDb{
+		DB:  db,
+		Api: api,
+	}
+}
+
+// AbuseFlag puts a user in the queue for admins to look at, after they did
+// something that looks like abuse, e.g. downloading many private models at
+// once with what may be a stolen token.  Until ThrottledUntil the user can't
+// download anything; admins can lift that early when they resolve the flag.
+type AbuseFlag struct {
+	Id             string                 `db:"id" json:"id"`
+	UserId         string                 `db:"user_id" json:"user_id"`
+	Kind           string                 `db:"kind" json:"kind"`
+	DetailsString  string                 `db:"details" json:"-"`
+	Details        map[string]interface{} `db:"-" json:"details"`
+	ThrottledUntil null.Time              `db:"throttled_until" json:"throttled_until"`
+	CreatedTime    time.Time              `db:"created_time" json:"created_time"`
+	ResolvedBy     null.String            `db:"resolved_by" json:"resolved_by"`
+	ResolvedTime   null.Time              `db:"resolved_time" json:"resolved_time"`
+	ResolutionNote string                 `db:"resolution_note" json:"resolution_note"`
+}
+
+func NewAbuseFlag(userId, kind string, details map[string]interface{}, throttleFor time.Duration) *AbuseFlag {
+	if details == nil {
+		details = map[string]interface{}{}
+	}
+	encoded, _ := json.Marshal(details)
+	now := time.Now().UTC()
+	flag := &AbuseFlag{
+		Id:            uuid.NewRandom().String(),
+		UserId:        userId,
+		Kind:          kind,
+		DetailsString: string(encoded),
+		Details:       details,
+		CreatedTime:   now,
+	}
+	if throttleFor > 0 {
+		flag.ThrottledUntil = null.TimeFrom(now.Add(throttleFor))
+	}
+	return flag
+}
+
+func (flag *AbuseFlag) FillDetails() error {
+	flag.Details = map[string]interface{}{}
+	if flag.DetailsString == "" {
+		return nil
+	}
+	return json.Unmarshal([]byte(flag.DetailsString), &flag.Details)
+}
+
+func (db *AbuseFlagDb) ById(id interface{}) (*AbuseFlag, error) {
+	var flag AbuseFlag
+	err := db.DB.
+		Select("*").
+		From(ABUSE_FLAG_TABLE).
+		Where("id = $1", id).
+		QueryStruct(&flag)
+	if err == sql.ErrNoRows {
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &flag, flag.FillDetails()
+}
+
+func (db *AbuseFlagDb) Delete(id interface{}) error {
+	_, err := db.DB.
+		DeleteFrom(ABUSE_FLAG_TABLE).
+		Where("id = $1", id).
+		Exec()
+	return err
+}
+
+func (db *AbuseFlagDb) Save(flag *AbuseFlag) error {
+	cols := []string{
+		"id",
+		"user_id",
+		"kind",
+		"details",
+		"throttled_until",
+		"created_time",
+		"resolved_by",
+		"resolved_time",
+		"resolution_note",
+	}
+	vals := []interface{}{
+		flag.Id,
+		flag.UserId,
+		flag.Kind,
+		flag.DetailsString,
+		flag.ThrottledUntil,
+		flag.CreatedTime,
+		flag.ResolvedBy,
+		flag.ResolvedTime,
+		flag.ResolutionNote,
+	}
+	_, err := db.DB.
+		Upsert(ABUSE_FLAG_TABLE).
+		Columns(cols...).
+		Values(vals...).
+		Where("id = $1", flag.Id).
+		Exec()
+	return err
+}
+
+func (db *AbuseFlagDb) Truncate() error {
+	_, err := db.DB.DeleteFrom(ABUSE_FLAG_TABLE).Exec()
+	return err
+}
+
+// -
+
+// Unresolved is the abuse queue, oldest first.
+func (db *AbuseFlagDb) Unresolved(limit int) ([]*AbuseFlag, error) {
+	var flags []*AbuseFlag
+	err := db.DB.
+		Select("*").
+		From(ABUSE_FLAG_TABLE).
+		Where("resolved_time IS NULL").
+		OrderBy("created_time ASC").
+		Limit(uint64(limit)).
+		QueryStructs(&flags)
+	if err != nil {
+		return nil, err
+	}
+	if flags == nil {
+		flags = []*AbuseFlag{}
+	}
+	for _, flag := range flags {
+		if err = flag.FillDetails(); err != nil {
+			return nil, err
+		}
+	}
+	return flags, nil
+}
+
+// ThrottledUntil is when the latest throttle on the user runs out, if they're
+// throttled at all.
+func (db *AbuseFlagDb) ThrottledUntil(userId string) (null.Time, error) {
+	var until null.Time
+	err := db.DB.
+		Select("MAX(throttled_until)").
+		From(ABUSE_FLAG_TABLE).
+		Where("user_id = $1 AND throttled_until > NOW()", userId).
+		QueryScalar(&until)
+	return until, err
+}
@@ -0,0 +1,222 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/pborman/uuid"
+	"gopkg.in/guregu/null.v3"
+	runner "gopkg.in/mgutz/dat.v1/sqlx-runner"
+)
+
+const ACCESS_REQUEST_TABLE = "access_request"
+
+const (
+	ACCESS_PENDING  = "pending"
+	ACCESS_APPROVED = "approved"
+	ACCESS_DENIED   = "denied"
+)
+
+type AccessRequestDb struct {
+	DB  *runner.DB
+	Api *ApiCollection
+}
+
+//go:generate counterfeiter $GOFILE AccessRequestApi
+type AccessRequestApi interface {
+	ById(id interface{}) (*AccessRequest, error)
+	Delete(id interface{}) error
+	Save(*AccessRequest) error
+	Truncate() error
+
+	ByModelIdUserId(modelId, userId string) (*AccessRequest, error)
+	ByModelId(modelId, status string) ([]*AccessRequest, error)
+	ByUserId(userId string) ([]*AccessRequest, error)
+	HasGrant(modelId, userId string) (bool, error)
+	GrantedModelIds(userId string, modelIds []string) (map[string]bool, error)
+}
+
+func NewAccessRequestDb(db *runner.DB, api *ApiCollection) *AccessRequestDb {
+	return &AccessRequestDb{
+		DB:  db,
+		Api: api,
+	}
+}
+
+// AccessRequest is a user asking the owner of a private model to let them
+// read it.  Once approved it's a grant to read the model's files, until
+// ExpiresTime if it's set.
+type AccessRequest struct {
+	Id          string      `db:"id" json:"id"`
+	ModelId     string      `db:"model_id" json:"model_id"`
+	UserId      string      `db:"user_id" json:"user_id"`
+	Message     string      `db:"message" json:"message"`
+	Status      string      `db:"status" json:"status"`
+	CreatedTime time.Time   `db:"created_time" json:"created_time"`
+	DecidedTime null.Time   `db:"decided_time" json:"decided_time"`
+	DecidedById null.String `db:"decided_by_id" json:"decided_by_id"`
+	ExpiresTime null.Time   `db:"expires_time" json:"expires_time"`
+}
+
+func NewAccessRequest(modelId, userId, message string) *AccessRequest {
+	return &AccessRequest{
+		Id:          uuid.NewRandom().String(),
+		ModelId:     modelId,
+		UserId:      userId,
+		Message:     message,
+		Status:      ACCESS_PENDING,
+		CreatedTime: time.Now().UTC(),
+	}
+}
+
+// Active says whether the request is an approved grant that hasn't expired.
+func (r *AccessRequest) Active() bool {
+	if r.Status != ACCESS_APPROVED {
+		return false
+	}
+	return !r.ExpiresTime.Valid || time.Now().Before(r.ExpiresTime.Time)
+}
+
+func (db *AccessRequestDb) ById(id interface{}) (*AccessRequest, error) {
+	var r AccessRequest
+	err := db.DB.
+		Select("*").
+		From(ACCESS_REQUEST_TABLE).
+		Where("id = $1", id).
+		QueryStruct(&r)
+	if err == sql.ErrNoRows {
+		return nil, err
+	}
+	return &r, err
+}
+
+func (db *AccessRequestDb) Delete(id interface{}) error {
+	_, err := db.DB.
+		DeleteFrom(ACCESS_REQUEST_TABLE).
+		Where("id = $1", id).
+		Exec()
+	return err
+}
+
+func (db *AccessRequestDb) Save(r *AccessRequest) error {
+	cols := []string{
+		"id",
+		"model_id",
+		"user_id",
+		"message",
+		"status",
+		"created_time",
+		"decided_time",
+		"decided_by_id",
+		"expires_time",
+	}
+	vals := []interface{}{
+		r.Id,
+		r.ModelId,
+		r.UserId,
+		r.Message,
+		r.Status,
+		r.CreatedTime,
+		r.DecidedTime,
+		r.DecidedById,
+		r.ExpiresTime,
+	}
+	_, err := db.DB.
+		Upsert(ACCESS_REQUEST_TABLE).
+		Columns(cols...).
+		Values(vals...).
+		Where("id = $1", r.Id).
+		Exec()
+	return err
+}
+
+func (db *AccessRequestDb) Truncate() error {
+	_, err := db.DB.DeleteFrom(ACCESS_REQUEST_TABLE).Exec()
+	return err
+}
+
+// -
+
+func (db *AccessRequestDb) ByModelIdUserId(modelId, userId string) (*AccessRequest, error) {
+	var r AccessRequest
+	err := db.DB.
+		Select("*").
+		From(ACCESS_REQUEST_TABLE).
+		Where("model_id = $1 AND user_id = $2", modelId, userId).
+		QueryStruct(&r)
+	if err == sql.ErrNoRows {
+		return nil, err
+	}
+	return &r, err
+}
+
+// ByModelId lists the requests for a model, newest first.  An empty status
+// lists all of them.
+func (db *AccessRequestDb) ByModelId(modelId, status string) ([]*AccessRequest, error) {
+	where := "model_id = $1"
+	args := []interface{}{modelId}
+	if status != "" {
+		where += " AND status = $2"
+		args = append(args, status)
+	}
+	var rs []*AccessRequest
+	err := db.DB.
+		Select("*").
+		From(ACCESS_REQUEST_TABLE).
+		Where(where, args...).
+		OrderBy("created_time DESC").
+		QueryStructs(&rs)
+	if rs == nil {
+		rs = []*AccessRequest{}
+	}
+	return rs, err
+}
+
+func (db *AccessRequestDb) ByUserId(userId string) ([]*AccessRequest, error) {
+	var rs []*AccessRequest
+	err := db.DB.
+		Select("*").
+		From(ACCESS_REQUEST_TABLE).
+		Where("user_id = $1", userId).
+		OrderBy("created_time DESC").
+		QueryStructs(&rs)
+	if rs == nil {
+		rs = []*AccessRequest{}
+	}
+	return rs, err
+}
+
+// HasGrant says whether the user has been approved to read the model, and the
+// approval hasn't expired.
+func (db *AccessRequestDb) HasGrant(modelId, userId string) (bool, error) {
+	var count int
+	err := db.DB.
+		Select("COUNT(*)").
+		From(ACCESS_REQUEST_TABLE).
+		Where(`model_id = $1 AND user_id = $2 AND status = $3
+		  AND (expires_time IS NULL OR expires_time > NOW())`,
+			modelId, userId, ACCESS_APPROVED).
+		QueryScalar(&count)
+	return count > 0, err
+}
+
+// GrantedModelIds is HasGrant for many models at once, saying which of them
+// the user has been approved to read.
+func (db *AccessRequestDb) GrantedModelIds(userId string, modelIds []string) (map[string]bool, error) {
+	granted := map[string]bool{}
+	if len(modelIds) == 0 {
+		return granted, nil
+	}
+	var ids []string
+	err := db.DB.
+		Select("DISTINCT model_id").
+		From(ACCESS_REQUEST_TABLE).
+		Where(`model_id IN $1 AND user_id = $2 AND status = $3
+		  AND (expires_time IS NULL OR expires_time > NOW())`,
+			modelIds, userId, ACCESS_APPROVED).
+		QuerySlice(&ids)
+	for _, id := range ids {
+		granted[id] = true
+	}
+	return granted, err
+}
@@ -0,0 +1,130 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/pborman/uuid"
+	"gopkg.in/guregu/null.v3"
+	runner "gopkg.in/mgutz/dat.v1/sqlx-runner"
+)
+
+const ANALYTICS_EXPORT_TABLE = "analytics_export"
+
+// Exports too big to stream are generated in the background, going from
+// pending to ready once they're in blob storage, or to failed
+const (
+	EXPORT_PENDING = "pending"
+	EXPORT_READY   = "ready"
+	EXPORT_FAILED  = "failed"
+)
+
+type AnalyticsExportDb struct {
+	DB  *runner.DB
+	Api *ApiCollection
+}
+
+//go:generate counterfeiter $GOFILE AnalyticsExportApi
+type AnalyticsExportApi interface {
+	ById(id interface{}) (*AnalyticsExport, error)
+	Delete(id interface{}) error
+	Save(*AnalyticsExport) error
+	Truncate() error
+}
+
+func NewAnalyticsExportDb(db *runner.DB, api *ApiCollection) *AnalyticsExportDb {
+	return &AnalyticsExportDb{
+		DB:  db,
+		Api: api,
+	}
+}
+
+// AnalyticsExport is a file of a model's download events from StartTime up to
+// EndTime, asked for by UserId.
+type AnalyticsExport struct {
+	Id            string    `db:"id" json:"id"`
+	ModelId       string    `db:"model_id" json:"model_id"`
+	UserId        string    `db:"user_id" json:"user_id"`
+	Format        string    `db:"format" json:"format"`
+	StartTime     time.Time `db:"start_time" json:"start_time"`
+	EndTime       time.Time `db:"end_time" json:"end_time"`
+	Status        string    `db:"status" json:"status"`
+	BlobFilename  string    `db:"blob_filename" json:"-"`
+	CreatedTime   time.Time `db:"created_time" json:"created_time"`
+	CompletedTime null.Time `db:"completed_time" json:"completed_time"`
+}
+
+func NewAnalyticsExport(modelId, userId, format string, start, end time.Time) *AnalyticsExport {
+	id := uuid.NewRandom().String()
+	return &AnalyticsExport{
+		Id:           id,
+		ModelId:      modelId,
+		UserId:       userId,
+		Format:       format,
+		StartTime:    start,
+		EndTime:      end,
+		Status:       EXPORT_PENDING,
+		BlobFilename: "analytics/" + id + "." + format,
+		CreatedTime:  time.Now().UTC(),
+	}
+}
+
+func (db *AnalyticsExportDb) ById(id interface{}) (*AnalyticsExport, error) {
+	var export AnalyticsExport
+	err := db.DB.
+		Select("*").
+		From(ANALYTICS_EXPORT_TABLE).
+		Where("id = $1", id).
+		QueryStruct(&export)
+	if err == sql.ErrNoRows {
+		return nil, err
+	}
+	return &export, err
+}
+
+func (db *AnalyticsExportDb) Delete(id interface{}) error {
+	_, err := db.DB.
+		DeleteFrom(ANALYTICS_EXPORT_TABLE).
+		Where("id = $1", id).
+		Exec()
+	return err
+}
+
+func (db *AnalyticsExportDb) Save(export *AnalyticsExport) error {
+	cols := []string{
+		"id",
+		"model_id",
+		"user_id",
+		"format",
+		"start_time",
+		"end_time",
+		"status",
+		"blob_filename",
+		"created_time",
+		"completed_time",
+	}
+	vals := []interface{}{
+		export.Id,
+		export.ModelId,
+		export.UserId,
+		export.Format,
+		export.StartTime,
+		export.EndTime,
+		export.Status,
+		export.BlobFilename,
+		export.CreatedTime,
+		export.CompletedTime,
+	}
+	_, err := db.DB.
+		Upsert(ANALYTICS_EXPORT_TABLE).
+		Columns(cols...).
+		Values(vals...).
+		Where("id = $1", export.Id).
+		Exec()
+	return err
+}
+
+func (db *AnalyticsExportDb) Truncate() error {
+	_, err := db.DB.DeleteFrom(ANALYTICS_EXPORT_TABLE).Exec()
+	return err
+}
@@ -0,0 +1,184 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/pborman/uuid"
+	"gopkg.in/guregu/null.v3"
+	runner "gopkg.in/mgutz/dat.v1/sqlx-runner"
+)
+
+const APP_KEY_TABLE = "app_key"
+const APP_KEY_DAY_TABLE = "app_key_day"
+
+const DEFAULT_APP_KEY_RATE_MULTIPLIER = 10
+
+type AppKeyDb struct {
+	DB  *runner.DB
+	Api *ApiCollection
+}
+
+//go:generate counterfeiter $GOFILE AppKeyApi
+type AppKeyApi interface {
+	ById(id interface{}) (*AppKey, error)
+	Delete(id interface{}) error
+	Save(*AppKey) error
+	Truncate() error
+
+	All() ([]*AppKey, error)
+	MarkRequest(id string, t time.Time, rateLimited bool) error
+	Usage(id string, since time.Time) ([]*AppKeyDay, error)
+}
+
+func NewAppKeyDb(db *runner.DB, api *ApiCollection) *AppKeyDb {
+	return &AppKeyDb{
+		DB:  db,
+		Api: api,
+	}
+}
+
+// AppKey identifies a third-party tool that reads public data, without
+// belonging to any user.  Requests made with one are still anonymous, they
+// just get RateMultiplier times the anonymous rate limits, and are counted
+// per day so the tool's authors (and we) can see how much it's used.
+type AppKey struct {
+	Id             string    `db:"id" json:"id"`
+	Name           string    `db:"name" json:"name"`
+	ContactEmail   string    `db:"contact_email" json:"contact_email"`
+	RateMultiplier int       `db:"rate_multiplier" json:"rate_multiplier"`
+	CreatedBy      string    `db:"created_by" json:"-"`
+	CreatedTime    time.Time `db:"created_time" json:"created_time"`
+	RevokedTime    null.Time `db:"revoked_time" json:"revoked_time"`
+}
+
+type AppKeyDay struct {
+	Day         time.Time `db:"day" json:"day"`
+	Requests    int       `db:"requests" json:"requests"`
+	RateLimited int       `db:"rate_limited" json:"rate_limited"`
+}
+
+func NewAppKey(name, contactEmail, createdBy string) *AppKey {
+	return &AppKey{
+		Id:             uuid.NewRandom().String(),
+		Name:           name,
+		ContactEmail:   contactEmail,
+		RateMultiplier: DEFAULT_APP_KEY_RATE_MULTIPLIER,
+		CreatedBy:      createdBy,
+		CreatedTime:    time.Now().UTC(),
+	}
+}
+
+func (k *AppKey) Revoked() bool {
+	return k.RevokedTime.Valid
+}
+
+func (db *AppKeyDb) ById(id interface{}) (*AppKey, error) {
+	var k AppKey
+	err := db.DB.
+		Select("*").
+		From(APP_KEY_TABLE).
+		Where("id = $1", id).
+		QueryStruct(&k)
+	if err == sql.ErrNoRows {
+		return nil, err
+	}
+	return &k, err
+}
+
+func (db *AppKeyDb) Delete(id interface{}) error {
+	_, err := db.DB.
+		DeleteFrom(APP_KEY_TABLE).
+		Where("id = $1", id).
+		Exec()
+	return err
+}
+
+func (db *AppKeyDb) Save(k *AppKey) error {
+	cols := []string{
+		"id",
+		"name",
+		"contact_email",
+		"rate_multiplier",
+		"created_by",
+		"created_time",
+		"revoked_time",
+	}
+	vals := []interface{}{
+		k.Id,
+		k.Name,
+		k.ContactEmail,
+		k.RateMultiplier,
+		k.CreatedBy,
+		k.CreatedTime,
+		k.RevokedTime,
+	}
+	_, err := db.DB.
+		Upsert(APP_KEY_TABLE).
+		Columns(cols...).
+		Values(vals...).
+		Where("id = $1", k.Id).
+		Exec()
+	return err
+}
+
+func (db *AppKeyDb) Truncate() error {
+	if _, err := db.DB.DeleteFrom(APP_KEY_DAY_TABLE).Exec(); err != nil {
+		return err
+	}
+	_, err := db.DB.DeleteFrom(APP_KEY_TABLE).Exec()
+	return err
+}
+
+// -
+
+func (db *AppKeyDb) All() ([]*AppKey, error) {
+	var keys []*AppKey
+	err := db.DB.
+		Select("*").
+		From(APP_KEY_TABLE).
+		OrderBy("created_time DESC").
+		QueryStructs(&keys)
+	if keys == nil {
+		keys = []*AppKey{}
+	}
+	return keys, err
+}
+
+// MarkRequest counts a request made with the key on t's day, and whether it
+// was turned away for going over the rate limit.
+func (db *AppKeyDb) MarkRequest(id string, t time.Time, rateLimited bool) error {
+	limited := 0
+	if rateLimited {
+		limited = 1
+	}
+
+	sql := `
+  INSERT INTO
+    app_key_day (app_key_id, day, requests, rate_limited)
+  VALUES ($1, $2, 1, $3)
+  ON CONFLICT ON CONSTRAINT app_key_day_app_key_id_day_key
+    DO UPDATE SET
+      requests = app_key_day.requests + 1,
+      rate_limited = app_key_day.rate_limited + $3
+  `
+
+	_, err := db.DB.Exec(sql, id, t.UTC().Format("2006-01-02"), limited)
+	return err
+}
+
+// Usage lists the key's daily request counts since the given day, oldest
+// first.  Days without any requests are left out.
+func (db *AppKeyDb) Usage(id string, since time.Time) ([]*AppKeyDay, error) {
+	var days []*AppKeyDay
+	err := db.DB.
+		Select("day, requests, rate_limited").
+		From(APP_KEY_DAY_TABLE).
+		Where("app_key_id = $1 AND day >= $2", id, since.UTC().Format("2006-01-02")).
+		OrderBy("day ASC").
+		QueryStructs(&days)
+	if days == nil {
+		days = []*AppKeyDay{}
+	}
+	return days, err
+}
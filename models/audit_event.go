@@ -0,0 +1,225 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/pborman/uuid"
+	"gopkg.in/guregu/null.v3"
+	runner "gopkg.in/mgutz/dat.v1/sqlx-runner"
+)
+
+const AUDIT_EVENT_TABLE = "audit_event"
+
+const (
+	AUDIT_LOGIN                 = "login"
+	AUDIT_LOGIN_FAILED          = "login_failed"
+	AUDIT_REGISTER              = "register"
+	AUDIT_OAUTH_LINK            = "oauth_link"
+	AUDIT_OAUTH_UNLINK          = "oauth_unlink"
+	AUDIT_TWO_FACTOR_FAILED     = "two_factor_failed"
+	AUDIT_TWO_FACTOR_ENABLE     = "two_factor_enable"
+	AUDIT_TWO_FACTOR_DISABLE    = "two_factor_disable"
+	AUDIT_PASSWORD_RESET        = "password_reset"
+	AUDIT_TOKEN_CREATE          = "token_create"
+	AUDIT_TOKEN_DELETE          = "token_delete"
+	AUDIT_TOKEN_REVOKE_ALL      = "token_revoke_all"
+	AUDIT_MODEL_CREATE          = "model_create"
+	AUDIT_MODEL_DELETE          = "model_delete"
+	AUDIT_FILE_DELETE           = "file_delete"
+	AUDIT_FILE_SHARE_CREATE     = "file_share_create"
+	AUDIT_FILE_SHARE_DELETE     = "file_share_delete"
+	AUDIT_FILE_QUARANTINE       = "file_quarantine"
+	AUDIT_FILE_QUARANTINE_DONE  = "file_quarantine_resolve"
+	AUDIT_USER_SUSPEND          = "user_suspend"
+	AUDIT_USER_UNSUSPEND        = "user_unsuspend"
+	AUDIT_MODEL_PLAN_CHANGE     = "model_plan_change"
+	AUDIT_IMPERSONATE           = "impersonate"
+	AUDIT_IP_ALLOWLIST_ADD      = "ip_allowlist_add"
+	AUDIT_IP_ALLOWLIST_DELETE   = "ip_allowlist_delete"
+	AUDIT_SSO_CONNECTION_SAVE   = "sso_connection_save"
+	AUDIT_SSO_CONNECTION_DELETE = "sso_connection_delete"
+	AUDIT_SSO_ROLE_CHANGE       = "sso_role_change"
+	AUDIT_ACCOUNT_DELETE        = "account_delete"
+	AUDIT_ACCOUNT_DELETE_CANCEL = "account_delete_cancel"
+	AUDIT_ACCOUNT_DELETED       = "account_deleted"
+	AUDIT_TAKEOUT               = "takeout"
+	AUDIT_APP_KEY_CREATE        = "app_key_create"
+	AUDIT_APP_KEY_REVOKE        = "app_key_revoke"
+	AUDIT_ACCOUNT_LOCK          = "account_lock"
+	AUDIT_ACCOUNT_UNLOCK        = "account_unlock"
+	AUDIT_ORG_CREATE            = "org_create"
+	AUDIT_ORG_MEMBER_ADD        = "org_member_add"
+	AUDIT_ORG_MEMBER_REMOVE     = "org_member_remove"
+	AUDIT_ORG_PLAN_CHANGE       = "org_plan_change"
+	AUDIT_ORG_TWO_FACTOR        = "org_two_factor"
+	AUDIT_SERVICE_ACCT_ADD      = "service_account_add"
+	AUDIT_SERVICE_ACCT_DELETE   = "service_account_delete"
+	AUDIT_ABUSE_FLAG            = "abuse_flag"
+	AUDIT_ABUSE_RESOLVE         = "abuse_resolve"
+	AUDIT_ACCESS_REQUEST        = "access_request"
+	AUDIT_ACCESS_GRANT          = "access_grant"
+	AUDIT_ACCESS_DENY           = "access_deny"
+	AUDIT_ACCESS_REVOKE         = "access_revoke"
+	AUDIT_ADMIN_REVOKE_TOKENS   = "admin_revoke_tokens"
+	AUDIT_SECURITY_HOOK_SAVE    = "security_webhook_save"
+	AUDIT_SECURITY_HOOK_DELETE  = "security_webhook_delete"
+	AUDIT_DOWNLOAD_MILESTONE    = "download_milestone"
+	AUDIT_DOWNLOAD_SPIKE        = "download_spike"
+	AUDIT_CONFIG_RELOAD         = "config_reload"
+	AUDIT_FEATURE_FLAG_SAVE     = "feature_flag_save"
+	AUDIT_FEATURE_FLAG_DELETE   = "feature_flag_delete"
+)
+
+type AuditEventDb struct {
+	DB  *runner.DB
+	Api *ApiCollection
+}
+
+//go:generate counterfeiter $GOFILE AuditEventApi
+type AuditEventApi interface {
+	Truncate() error
+
+	Record(*AuditEvent) error
+	ByOwnerId(ownerId string, before int64, limit int) ([]*AuditEvent, error)
+	Search(filter *AuditFilter, before int64, limit int) ([]*AuditEvent, error)
+	SeenIp(ownerId, action, ip string) (bool, error)
+}
+
+func NewAuditEventDb(db *runner.DB, api *ApiCollection) *AuditEventDb {
+	return &AuditEventDb{
+		DB:  db,
+		Api: api,
+	}
+}
+
+// AuditEvent records that ActorId did something security-relevant, from
+// which IP and client.  OwnerId is whose account it concerns, which is who
+// gets to see it besides admins; for failed logins to unknown accounts
+// there's neither.  Seq orders events and is what pages are keyed on.
+type AuditEvent struct {
+	Seq           int64                  `db:"seq" json:"seq"`
+	Id            string                 `db:"id" json:"id"`
+	ActorId       null.String            `db:"actor_id" json:"actor_id"`
+	OwnerId       null.String            `db:"owner_id" json:"owner_id"`
+	Action        string                 `db:"action" json:"action"`
+	ObjectType    string                 `db:"object_type" json:"object_type"`
+	ObjectId      string                 `db:"object_id" json:"object_id"`
+	DetailsString string                 `db:"details" json:"-"`
+	Details       map[string]interface{} `db:"-" json:"details"`
+	Ip            string                 `db:"ip" json:"ip"`
+	UserAgent     string                 `db:"user_agent" json:"user_agent"`
+	CreatedTime   time.Time              `db:"created_time" json:"created_time"`
+}
+
+// AuditFilter narrows down admin searches, empty fields match everything.
+type AuditFilter struct {
+	ActorId string
+	OwnerId string
+	Action  string
+}
+
+func NewAuditEvent(actorId, ownerId, action, objectType, objectId string, details map[string]interface{}) *AuditEvent {
+	if details == nil {
+		details = map[string]interface{}{}
+	}
+	encoded, _ := json.Marshal(details)
+	return &AuditEvent{
+		Id:            uuid.NewUUID().String(),
+		ActorId:       null.NewString(actorId, actorId != ""),
+		OwnerId:       null.NewString(ownerId, ownerId != ""),
+		Action:        action,
+		ObjectType:    objectType,
+		ObjectId:      objectId,
+		DetailsString: string(encoded),
+		Details:       details,
+		CreatedTime:   time.Now().UTC(),
+	}
+}
+
+func (e *AuditEvent) FillDetails() error {
+	e.Details = map[string]interface{}{}
+	if e.DetailsString == "" {
+		return nil
+	}
+	return json.Unmarshal([]byte(e.DetailsString), &e.Details)
+}
+
+func (db *AuditEventDb) Truncate() error {
+	_, err := db.DB.DeleteFrom(AUDIT_EVENT_TABLE).Exec()
+	return err
+}
+
+// -
+
+func (db *AuditEventDb) Record(e *AuditEvent) error {
+	_, err := db.DB.
+		InsertInto(AUDIT_EVENT_TABLE).
+		Columns("id", "actor_id", "owner_id", "action", "object_type",
+			"object_id", "details", "ip", "user_agent", "created_time").
+		Values(e.Id, e.ActorId, e.OwnerId, e.Action, e.ObjectType, e.ObjectId,
+			e.DetailsString, e.Ip, e.UserAgent, e.CreatedTime).
+		Exec()
+	return err
+}
+
+func (db *AuditEventDb) ByOwnerId(ownerId string, before int64, limit int) ([]*AuditEvent, error) {
+	return db.Search(&AuditFilter{OwnerId: ownerId}, before, limit)
+}
+
+// Search returns the newest events matching the filter, older than before
+// unless it's 0.
+func (db *AuditEventDb) Search(filter *AuditFilter, before int64, limit int) ([]*AuditEvent, error) {
+	where := "TRUE"
+	args := []interface{}{}
+	add := func(clause string, arg interface{}) {
+		args = append(args, arg)
+		where += fmt.Sprintf(" AND %s $%d", clause, len(args))
+	}
+	if filter.ActorId != "" {
+		add("actor_id::TEXT =", filter.ActorId)
+	}
+	if filter.OwnerId != "" {
+		add("owner_id::TEXT =", filter.OwnerId)
+	}
+	if filter.Action != "" {
+		add("action =", filter.Action)
+	}
+	if before > 0 {
+		add("seq <", before)
+	}
+
+	var events []*AuditEvent
+	err := db.DB.
+		Select("*").
+		From(AUDIT_EVENT_TABLE).
+		Where(where, args...).
+		OrderBy("seq DESC").
+		Limit(uint64(limit)).
+		QueryStructs(&events)
+	if events == nil {
+		events = []*AuditEvent{}
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range events {
+		if err = e.FillDetails(); err != nil {
+			return nil, err
+		}
+	}
+	return events, nil
+}
+
+// SeenIp says whether the action has been recorded for the owner from the IP
+// address before, e.g. whether they've ever signed in from there.
+func (db *AuditEventDb) SeenIp(ownerId, action, ip string) (bool, error) {
+	var count int
+	err := db.DB.
+		Select("COUNT(*)").
+		From(AUDIT_EVENT_TABLE).
+		Where("owner_id = $1 AND action = $2 AND ip = $3", ownerId, action, ip).
+		QueryScalar(&count)
+	return count > 0, err
+}
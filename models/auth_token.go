@@ -2,9 +2,12 @@ package models
 
 import (
 	"database/sql"
+	"encoding/json"
 	"time"
 
+	"github.com/ericflo/gradientzoo/utils"
 	"github.com/pborman/uuid"
+	"gopkg.in/guregu/null.v3"
 
 	runner "gopkg.in/mgutz/dat.v1/sqlx-runner"
 )
@@ -24,6 +27,11 @@ type AuthTokenApi interface {
 	Save(*AuthToken) error
 	Hydrate([]*AuthToken) error
 	Truncate() error
+
+	ByUserIdKind(userId, kind string) ([]*AuthToken, error)
+	MarkUsed(authToken *AuthToken, t time.Time) error
+	DeleteByUserIdKind(userId, kind string) error
+	DeleteByKind(kind string, userIds []string) error
 }
 
 func NewAuthTokenDb(db *runner.DB, api *ApiCollection) *AuthTokenDb {
@@ -33,18 +41,166 @@ func NewAuthTokenDb(db *runner.DB, api *ApiCollection) *AuthTokenDb {
 	}
 }
 
+const (
+	TOKEN_KIND_SESSION = "session"
+	TOKEN_KIND_API     = "api"
+	TOKEN_KIND_PENDING = "pending_2fa"
+)
+
+// How long someone has to enter their two-factor code after their password
+const PENDING_TOKEN_TTL = 5 * time.Minute
+
+const (
+	SCOPE_READ   = "read"
+	SCOPE_UPLOAD = "upload"
+	SCOPE_ADMIN  = "admin"
+)
+
+// All of the scopes, which session tokens always have
+var ALL_SCOPES = []string{SCOPE_READ, SCOPE_UPLOAD, SCOPE_ADMIN}
+
+// AuthToken is either a session, created by logging in, or a named API token
+// that a user minted for e.g. a CI job.  API tokens can be limited to some of
+// the scopes: read lets a token see private models, upload lets it upload and
+// annotate files, and admin lets it manage models and the account itself.
+// Sessions expire after a short while and are renewed with a RefreshToken,
+// while API tokens last until they're revoked.  Users with two-factor
+// authentication get a pending token with no scopes after their password,
+// which can only be traded in for a session along with their code.  Sessions
+// with an ImpersonatorId were started by that admin, for support.  API tokens
+// with ModelIds can only change those models, e.g. a CI token that can only
+// upload to one model; without any, they can change all of the user's models.
 type AuthToken struct {
-	Id          string    `db:"id" json:"id"`
-	UserId      string    `db:"user_id" json:"user_id"`
-	CreatedTime time.Time `db:"created_time" json:"created_time"`
+	Id             string      `db:"id" json:"id"`
+	UserId         string      `db:"user_id" json:"user_id"`
+	Kind           string      `db:"kind" json:"kind"`
+	Name           string      `db:"name" json:"name"`
+	ScopesString   string      `db:"scopes" json:"-"`
+	Scopes         []string    `db:"-" json:"scopes"`
+	ModelIdsString string      `db:"model_ids" json:"-"`
+	ModelIds       []string    `db:"-" json:"model_ids"`
+	LastUsedTime   null.Time   `db:"last_used_time" json:"last_used_time"`
+	ExpiresTime    null.Time   `db:"expires_time" json:"expires_time"`
+	ImpersonatorId null.String `db:"impersonator_id" json:"impersonator_id"`
+	CreatedTime    time.Time   `db:"created_time" json:"created_time"`
 }
 
 func NewAuthToken(userId string) *AuthToken {
-	return &AuthToken{
+	now := time.Now().UTC()
+	ttl := time.Duration(utils.Conf.SessionTTLMinutes) * time.Minute
+	authToken := &AuthToken{
+		Id:          uuid.NewRandom().String(),
+		UserId:      userId,
+		Kind:        TOKEN_KIND_SESSION,
+		ExpiresTime: null.TimeFrom(now.Add(ttl)),
+		CreatedTime: now,
+	}
+	authToken.SetScopes(ALL_SCOPES)
+	authToken.SetModelIds(nil)
+	return authToken
+}
+
+func NewPendingAuthToken(userId string) *AuthToken {
+	now := time.Now().UTC()
+	authToken := &AuthToken{
+		Id:          uuid.NewRandom().String(),
+		UserId:      userId,
+		Kind:        TOKEN_KIND_PENDING,
+		ExpiresTime: null.TimeFrom(now.Add(PENDING_TOKEN_TTL)),
+		CreatedTime: now,
+	}
+	authToken.SetScopes([]string{})
+	authToken.SetModelIds(nil)
+	return authToken
+}
+
+// NewImpersonationToken lets an admin see the site as the user does, for
+// support.  It's a session, but can't be refreshed.
+func NewImpersonationToken(userId, adminId string) *AuthToken {
+	authToken := NewAuthToken(userId)
+	authToken.ImpersonatorId = null.StringFrom(adminId)
+	return authToken
+}
+
+func NewApiToken(userId, name string, scopes, modelIds []string) *AuthToken {
+	authToken := &AuthToken{
 		Id:          uuid.NewRandom().String(),
 		UserId:      userId,
+		Kind:        TOKEN_KIND_API,
+		Name:        name,
 		CreatedTime: time.Now().UTC(),
 	}
+	authToken.SetScopes(scopes)
+	authToken.SetModelIds(modelIds)
+	return authToken
+}
+
+func ValidScope(scope string) bool {
+	return scope == SCOPE_READ || scope == SCOPE_UPLOAD || scope == SCOPE_ADMIN
+}
+
+func (authToken *AuthToken) SetScopes(scopes []string) {
+	encoded, _ := json.Marshal(scopes)
+	authToken.Scopes = scopes
+	authToken.ScopesString = string(encoded)
+}
+
+// FillScopes fills in both the scopes and the model ids, which are stored the
+// same way.
+func (authToken *AuthToken) FillScopes() error {
+	authToken.Scopes = []string{}
+	authToken.ModelIds = []string{}
+	if authToken.ScopesString != "" {
+		err := json.Unmarshal([]byte(authToken.ScopesString), &authToken.Scopes)
+		if err != nil {
+			return err
+		}
+	}
+	if authToken.ModelIdsString == "" {
+		return nil
+	}
+	return json.Unmarshal([]byte(authToken.ModelIdsString), &authToken.ModelIds)
+}
+
+func (authToken *AuthToken) SetModelIds(modelIds []string) {
+	if modelIds == nil {
+		modelIds = []string{}
+	}
+	encoded, _ := json.Marshal(modelIds)
+	authToken.ModelIds = modelIds
+	authToken.ModelIdsString = string(encoded)
+}
+
+func (authToken *AuthToken) Expired() bool {
+	return authToken.ExpiresTime.Valid && !time.Now().Before(authToken.ExpiresTime.Time)
+}
+
+// AccountWide is false for tokens limited to some models, which can't be used
+// to manage the account itself either.
+func (authToken *AuthToken) AccountWide() bool {
+	return len(authToken.ModelIds) == 0
+}
+
+// AllowsModel says whether the token may be used to change the model.
+func (authToken *AuthToken) AllowsModel(modelId string) bool {
+	if authToken.AccountWide() {
+		return true
+	}
+	for _, id := range authToken.ModelIds {
+		if id == modelId {
+			return true
+		}
+	}
+	return false
+}
+
+func (authToken *AuthToken) HasScope(scope string) bool {
+	for _, s := range authToken.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
 }
 
 func (db *AuthTokenDb) ById(id interface{}) (*AuthToken, error) {
@@ -57,6 +213,9 @@ func (db *AuthTokenDb) ById(id interface{}) (*AuthToken, error) {
 	if err == sql.ErrNoRows {
 		return nil, err
 	}
+	if err = authToken.FillScopes(); err != nil {
+		return nil, err
+	}
 	return &authToken, err
 }
 
@@ -73,6 +232,11 @@ func (db *AuthTokenDb) ByIds(ids []interface{}) ([]*AuthToken, error) {
 	if authTokens == nil {
 		authTokens = []*AuthToken{}
 	}
+	for _, authToken := range authTokens {
+		if err = authToken.FillScopes(); err != nil {
+			return nil, err
+		}
+	}
 	return authTokens, err
 }
 
@@ -87,8 +251,12 @@ func (db *AuthTokenDb) Delete(id interface{}) error {
 func (db *AuthTokenDb) Save(authToken *AuthToken) error {
 	_, err := db.DB.
 		InsertInto(AUTH_TOKEN_TABLE).
-		Columns("id", "user_id", "created_time").
-		Values(authToken.Id, authToken.UserId, authToken.CreatedTime).
+		Columns("id", "user_id", "kind", "name", "scopes", "model_ids",
+			"expires_time", "impersonator_id", "created_time").
+		Values(authToken.Id, authToken.UserId, authToken.Kind, authToken.Name,
+			authToken.ScopesString, authToken.ModelIdsString,
+			authToken.ExpiresTime, authToken.ImpersonatorId,
+			authToken.CreatedTime).
 		Exec()
 	return err
 }
@@ -101,3 +269,65 @@ func (db *AuthTokenDb) Truncate() error {
 	_, err := db.DB.DeleteFrom(AUTH_TOKEN_TABLE).Exec()
 	return err
 }
+
+// -
+
+func (db *AuthTokenDb) ByUserIdKind(userId, kind string) ([]*AuthToken, error) {
+	var authTokens []*AuthToken
+	err := db.DB.
+		Select("*").
+		From(AUTH_TOKEN_TABLE).
+		Where("user_id = $1 AND kind = $2", userId, kind).
+		OrderBy("created_time DESC").
+		QueryStructs(&authTokens)
+	if authTokens == nil {
+		authTokens = []*AuthToken{}
+	}
+	for _, authToken := range authTokens {
+		if err = authToken.FillScopes(); err != nil {
+			return nil, err
+		}
+	}
+	return authTokens, err
+}
+
+// MarkUsed records that the token was used at t.  To avoid a write on every
+// request, it only does so if the last recorded use was over a minute ago.
+func (db *AuthTokenDb) MarkUsed(authToken *AuthToken, t time.Time) error {
+	if authToken.LastUsedTime.Valid && t.Sub(authToken.LastUsedTime.Time) < time.Minute {
+		return nil
+	}
+	_, err := db.DB.
+		Update(AUTH_TOKEN_TABLE).
+		Set("last_used_time", t).
+		Where("id = $1", authToken.Id).
+		Exec()
+	if err == nil {
+		authToken.LastUsedTime = null.TimeFrom(t)
+	}
+	return err
+}
+
+func (db *AuthTokenDb) DeleteByUserIdKind(userId, kind string) error {
+	_, err := db.DB.
+		DeleteFrom(AUTH_TOKEN_TABLE).
+		Where("user_id = $1 AND kind = $2", userId, kind).
+		Exec()
+	return err
+}
+
+// DeleteByKind deletes the given users' tokens of one kind, or everyone's if
+// userIds is nil.
+func (db *AuthTokenDb) DeleteByKind(kind string, userIds []string) error {
+	where := "kind = $1"
+	args := []interface{}{kind}
+	if userIds != nil {
+		where += " AND user_id IN $2"
+		args = append(args, userIds)
+	}
+	_, err := db.DB.
+		DeleteFrom(AUTH_TOKEN_TABLE).
+		Where(where, args...).
+		Exec()
+	return err
+}
@@ -0,0 +1,146 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pborman/uuid"
+	"gopkg.in/guregu/null.v3"
+	runner "gopkg.in/mgutz/dat.v1/sqlx-runner"
+)
+
+const BACKUP_CODE_TABLE = "backup_code"
+
+// How many backup codes a user gets each time they're generated
+const BACKUP_CODE_COUNT = 10
+
+type BackupCodeDb struct {
+	DB  *runner.DB
+	Api *ApiCollection
+}
+
+//go:generate counterfeiter $GOFILE BackupCodeApi
+type BackupCodeApi interface {
+	Truncate() error
+
+	Generate(userId string) ([]string, error)
+	Use(userId, code string) (bool, error)
+	CountUnused(userId string) (int, error)
+	DeleteByUserId(userId string) error
+}
+
+func NewBackupCodeDb(db *runner.DB, api *ApiCollection) *BackupCodeDb {
+	return &BackupCodeDb{
+		DB:  db,
+		Api: api,
+	}
+}
+
+// BackupCode lets someone with two-factor authentication sign in once without
+// their authenticator app.  Only a hash of the code is stored, the code
+// itself is shown to the user once when it's generated.
+type BackupCode struct {
+	Id          string    `db:"id" json:"id"`
+	UserId      string    `db:"user_id" json:"user_id"`
+	CodeHash    string    `db:"code_hash" json:"-"`
+	CreatedTime time.Time `db:"created_time" json:"created_time"`
+	UsedTime    null.Time `db:"used_time" json:"used_time"`
+}
+
+func hashBackupCode(code string) string {
+	code = strings.ToLower(strings.Replace(code, "-", "", -1))
+	sum := sha256.Sum256([]byte(strings.TrimSpace(code)))
+	return hex.EncodeToString(sum[:])
+}
+
+func newBackupCode() (string, error) {
+	buf := make([]byte, 5)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	code := hex.EncodeToString(buf)
+	return fmt.Sprintf("%s-%s", code[:5], code[5:]), nil
+}
+
+func (db *BackupCodeDb) Truncate() error {
+	_, err := db.DB.DeleteFrom(BACKUP_CODE_TABLE).Exec()
+	return err
+}
+
+// -
+
+// Generate replaces all of the user's backup codes with new ones, and returns
+// the new codes.
+func (db *BackupCodeDb) Generate(userId string) ([]string, error) {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.AutoRollback()
+
+	_, err = tx.
+		DeleteFrom(BACKUP_CODE_TABLE).
+		Where("user_id = $1", userId).
+		Exec()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	codes := make([]string, BACKUP_CODE_COUNT)
+	for i := range codes {
+		if codes[i], err = newBackupCode(); err != nil {
+			return nil, err
+		}
+		_, err = tx.
+			InsertInto(BACKUP_CODE_TABLE).
+			Columns("id", "user_id", "code_hash", "created_time").
+			Values(uuid.NewUUID().String(), userId, hashBackupCode(codes[i]), now).
+			Exec()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// Use marks the matching unused code as used, and returns whether there was
+// one.
+func (db *BackupCodeDb) Use(userId, code string) (bool, error) {
+	res, err := db.DB.
+		Update(BACKUP_CODE_TABLE).
+		Set("used_time", time.Now().UTC()).
+		Where("user_id = $1 AND code_hash = $2 AND used_time IS NULL",
+			userId, hashBackupCode(code)).
+		Exec()
+	if err != nil {
+		return false, err
+	}
+	return res.RowsAffected > 0, nil
+}
+
+func (db *BackupCodeDb) CountUnused(userId string) (int, error) {
+	var count int
+	err := db.DB.
+		Select("COUNT(*)").
+		From(BACKUP_CODE_TABLE).
+		Where("user_id = $1 AND used_time IS NULL", userId).
+		QueryScalar(&count)
+	return count, err
+}
+
+func (db *BackupCodeDb) DeleteByUserId(userId string) error {
+	_, err := db.DB.
+		DeleteFrom(BACKUP_CODE_TABLE).
+		Where("user_id = $1", userId).
+		Exec()
+	return err
+}
@@ -3,10 +3,11 @@ package models
 import (
 	"database/sql"
 	"fmt"
+	"strings"
 	"time"
 
+	"github.com/ericflo/gradientzoo/cache"
 	"github.com/ericflo/gradientzoo/utils"
-	_ "github.com/lib/pq"
 	dat "gopkg.in/mgutz/dat.v1"
 	runner "gopkg.in/mgutz/dat.v1/sqlx-runner"
 )
@@ -20,20 +21,104 @@ type BackendModel interface {
 }
 
 type ApiCollection struct {
-	User         UserApi
-	AuthToken    AuthTokenApi
-	Model        ModelApi
-	File         FileApi
-	DownloadHour DownloadHourApi
+	User                 UserApi
+	AuthToken            AuthTokenApi
+	Model                ModelApi
+	File                 FileApi
+	DownloadHour         DownloadHourApi
+	DownloadCountry      DownloadCountryApi
+	DownloadClient       DownloadClientApi
+	FilePolicy           FilePolicyApi
+	FileStructure        FileStructureApi
+	FileDiff             FileDiffApi
+	FileLog              FileLogApi
+	FileMetadataRevision FileMetadataRevisionApi
+	FileGroup            FileGroupApi
+	FileShare            FileShareApi
+	FileQuarantine       FileQuarantineApi
+	RefreshToken         RefreshTokenApi
+	UserIdentity         UserIdentityApi
+	BackupCode           BackupCodeApi
+	AuditEvent           AuditEventApi
+	IpAllowlist          IpAllowlistApi
+	SsoConnection        SsoConnectionApi
+	AppKey               AppKeyApi
+	Organization         OrganizationApi
+	DeviceAuthorization  DeviceAuthorizationApi
+	AbuseFlag            AbuseFlagApi
+	Notification         NotificationApi
+	AccessRequest        AccessRequestApi
+	SecurityWebhook      SecurityWebhookApi
+	ModelStar            ModelStarApi
+	ModelTrending        ModelTrendingApi
+	ModelLeaderboard     ModelLeaderboardApi
+	DownloadAlert        DownloadAlertApi
+	RawDownload          RawDownloadApi
+	SearchIndex          SearchIndexApi
+	ModelRelated         ModelRelatedApi
+	Collection           CollectionApi
+	AnalyticsExport      AnalyticsExportApi
+	SavedSearch          SavedSearchApi
+	ModelReadme          ModelReadmeApi
+	Job                  JobApi
+	FeatureFlag          FeatureFlagApi
+
+	primary *runner.DB
+
+	// Where reads that can stand to be behind go, if anywhere, and the
+	// collection that sends them there, or whether this is it
+	replica      *runner.DB
+	reading      *ApiCollection
+	readsReplica bool
+
+	// Where hot lookups are kept, if anywhere, and for how long
+	cache    cache.Cache
+	cacheTTL time.Duration
 }
 
 func NewApiCollection(db *runner.DB) *ApiCollection {
-	api := &ApiCollection{}
+	api := &ApiCollection{primary: db}
 	api.User = NewUserDb(db, api)
 	api.AuthToken = NewAuthTokenDb(db, api)
 	api.Model = NewModelDb(db, api)
 	api.File = NewFileDb(db, api)
 	api.DownloadHour = NewDownloadHourDb(db, api)
+	api.DownloadCountry = NewDownloadCountryDb(db, api)
+	api.DownloadClient = NewDownloadClientDb(db, api)
+	api.FilePolicy = NewFilePolicyDb(db, api)
+	api.FileStructure = NewFileStructureDb(db, api)
+	api.FileDiff = NewFileDiffDb(db, api)
+	api.FileLog = NewFileLogDb(db, api)
+	api.FileMetadataRevision = NewFileMetadataRevisionDb(db, api)
+	api.FileGroup = NewFileGroupDb(db, api)
+	api.FileShare = NewFileShareDb(db, api)
+	api.FileQuarantine = NewFileQuarantineDb(db, api)
+	api.RefreshToken = NewRefreshTokenDb(db, api)
+	api.UserIdentity = NewUserIdentityDb(db, api)
+	api.BackupCode = NewBackupCodeDb(db, api)
+	api.AuditEvent = NewAuditEventDb(db, api)
+	api.IpAllowlist = NewIpAllowlistDb(db, api)
+	api.SsoConnection = NewSsoConnectionDb(db, api)
+	api.AppKey = NewAppKeyDb(db, api)
+	api.Organization = NewOrganizationDb(db, api)
+	api.DeviceAuthorization = NewDeviceAuthorizationDb(db, api)
+	api.AbuseFlag = NewAbuseFlagDb(db, api)
+	api.Notification = NewNotificationDb(db, api)
+	api.AccessRequest = NewAccessRequestDb(db, api)
+	api.SecurityWebhook = NewSecurityWebhookDb(db, api)
+	api.ModelStar = NewModelStarDb(db, api)
+	api.ModelTrending = NewModelTrendingDb(db, api)
+	api.ModelLeaderboard = NewModelLeaderboardDb(db, api)
+	api.DownloadAlert = NewDownloadAlertDb(db, api)
+	api.RawDownload = NewRawDownloadDb(db, api)
+	api.SearchIndex = NewSearchIndexDb(db, api)
+	api.ModelRelated = NewModelRelatedDb(db, api)
+	api.Collection = NewCollectionDb(db, api)
+	api.AnalyticsExport = NewAnalyticsExportDb(db, api)
+	api.SavedSearch = NewSavedSearchDb(db, api)
+	api.ModelReadme = NewModelReadmeDb(db, api)
+	api.Job = NewJobDb(db, api)
+	api.FeatureFlag = NewFeatureFlagDb(db, api)
 	return api
 }
 
@@ -44,6 +129,42 @@ func (api *ApiCollection) BackendModels() []BackendModel {
 		BackendModel(api.Model),
 		BackendModel(api.File),
 		BackendModel(api.DownloadHour),
+		BackendModel(api.DownloadCountry),
+		BackendModel(api.DownloadClient),
+		BackendModel(api.FilePolicy),
+		BackendModel(api.FileStructure),
+		BackendModel(api.FileDiff),
+		BackendModel(api.FileLog),
+		BackendModel(api.FileMetadataRevision),
+		BackendModel(api.FileGroup),
+		BackendModel(api.FileShare),
+		BackendModel(api.FileQuarantine),
+		BackendModel(api.RefreshToken),
+		BackendModel(api.UserIdentity),
+		BackendModel(api.BackupCode),
+		BackendModel(api.AuditEvent),
+		BackendModel(api.IpAllowlist),
+		BackendModel(api.SsoConnection),
+		BackendModel(api.AppKey),
+		BackendModel(api.Organization),
+		BackendModel(api.DeviceAuthorization),
+		BackendModel(api.AbuseFlag),
+		BackendModel(api.Notification),
+		BackendModel(api.AccessRequest),
+		BackendModel(api.SecurityWebhook),
+		BackendModel(api.ModelStar),
+		BackendModel(api.ModelTrending),
+		BackendModel(api.ModelLeaderboard),
+		BackendModel(api.DownloadAlert),
+		BackendModel(api.RawDownload),
+		BackendModel(api.SearchIndex),
+		BackendModel(api.ModelRelated),
+		BackendModel(api.Collection),
+		BackendModel(api.AnalyticsExport),
+		BackendModel(api.SavedSearch),
+		BackendModel(api.ModelReadme),
+		BackendModel(api.Job),
+		BackendModel(api.FeatureFlag),
 	}
 }
 
@@ -59,14 +180,26 @@ func (api *ApiCollection) Truncate() error {
 // DB Opener Util
 
 func NewDB() (*runner.DB, error) {
-	db, err := sql.Open("postgres", fmt.Sprintf(
-		"dbname=%s user=%s password=%s host=%s port=%d sslmode=%s",
+	aggregateSlots = make(chan struct{}, utils.Conf.AggregateMaxConns)
+	return openDB(utils.Conf.PostgresqlHost)
+}
+
+// NewReplicaDB connects to the read replica, which has the same database and
+// credentials as the primary.
+func NewReplicaDB() (*runner.DB, error) {
+	return openDB(utils.Conf.PostgresqlReplicaHost)
+}
+
+func openDB(host string) (*runner.DB, error) {
+	db, err := sql.Open(INSTRUMENTED_DRIVER, fmt.Sprintf(
+		"dbname=%s user=%s password=%s host=%s port=%d sslmode=%s statement_timeout=%d",
 		utils.Conf.PostgresqlDbName,
 		utils.Conf.PostgresqlUser,
 		utils.Conf.PostgresqlPassword,
-		utils.Conf.PostgresqlHost,
+		host,
 		utils.Conf.PostgresqlPort,
 		utils.Conf.PostgresqlSslMode,
+		utils.Conf.StatementTimeoutMs,
 	))
 	if err != nil {
 		return nil, err
@@ -74,9 +207,9 @@ func NewDB() (*runner.DB, error) {
 
 	//runner.MustPing(db)
 
-	// Set to reasonable values for production
-	db.SetMaxIdleConns(2)
-	db.SetMaxOpenConns(4)
+	db.SetMaxIdleConns(utils.Conf.PostgresqlMaxIdleConns)
+	db.SetMaxOpenConns(utils.Conf.PostgresqlMaxOpenConns)
+	db.SetConnMaxLifetime(time.Duration(utils.Conf.PostgresqlConnMaxLifetimeSeconds) * time.Second)
 
 	dat.EnableInterpolation = true
 	dat.Strict = false
@@ -87,6 +220,33 @@ func NewDB() (*runner.DB, error) {
 	return runner.NewDB(db, "postgres"), nil
 }
 
+// Each of the big download aggregations holds a slot while it runs
+var aggregateSlots chan struct{}
+
+// beginAggregate starts a transaction for one of the big download
+// aggregations, once there's a slot free for it, with AggregateTimeoutMs
+// instead of the usual statement timeout.  Calling end rolls the transaction
+// back if it wasn't committed, and frees the slot.
+func beginAggregate(db *runner.DB) (tx *runner.Tx, end func(), err error) {
+	aggregateSlots <- struct{}{}
+	release := func() { <-aggregateSlots }
+
+	if tx, err = db.Begin(); err != nil {
+		release()
+		return nil, nil, err
+	}
+	end = func() {
+		tx.AutoRollback()
+		release()
+	}
+	_, err = tx.SQL(fmt.Sprintf("SET LOCAL statement_timeout = %d", utils.Conf.AggregateTimeoutMs)).Exec()
+	if err != nil {
+		end()
+		return nil, nil, err
+	}
+	return tx, end, nil
+}
+
 func IdStrings(ids []interface{}) []string {
 	idStrs := make([]string, len(ids))
 	for i, id := range ids {
@@ -94,3 +254,78 @@ func IdStrings(ids []interface{}) []string {
 	}
 	return idStrs
 }
+
+// likeEscaper escapes the wildcards in user input that goes into a LIKE
+// pattern
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// PageKey is where a page of a keyset-paginated listing starts: just after
+// the row with these sort keys and this id.  Keys go to and from the database
+// as text.
+type PageKey struct {
+	Keys []string
+	Id   string
+}
+
+// keyCol is a column (or any expression) that listings sort by, and the type
+// its keys are cast back to.
+type keyCol struct {
+	Expr string
+	Type string
+}
+
+// afterSql is the predicate for the rows after the key, in a listing ordered
+// by the columns and then idExpr, either all descending or all ascending.
+func (k *PageKey) afterSql(cols []keyCol, idExpr string, desc bool, args *sqlArgs) string {
+	if k == nil || len(k.Keys) != len(cols) {
+		return "TRUE"
+	}
+	exprs := make([]string, 0, len(cols)+1)
+	params := make([]string, 0, len(cols)+1)
+	for i, col := range cols {
+		exprs = append(exprs, col.Expr)
+		params = append(params, args.Add(k.Keys[i])+"::"+col.Type)
+	}
+	exprs = append(exprs, idExpr)
+	params = append(params, args.Add(k.Id)+"::UUID")
+	op := ">"
+	if desc {
+		op = "<"
+	}
+	return "(" + strings.Join(exprs, ", ") + ") " + op + " (" + strings.Join(params, ", ") + ")"
+}
+
+// keysSql selects the columns as text, as key_0, key_1, and so on, for
+// building the PageKey of the last row on a page.
+func keysSql(cols []keyCol) string {
+	sels := make([]string, len(cols))
+	for i, col := range cols {
+		sels[i] = fmt.Sprintf("(%s)::TEXT AS key_%d", col.Expr, i)
+	}
+	return strings.Join(sels, ", ")
+}
+
+// orderSql orders by the columns and then idExpr.
+func orderSql(cols []keyCol, idExpr string, desc bool) string {
+	dir := " ASC"
+	if desc {
+		dir = " DESC"
+	}
+	order := make([]string, 0, len(cols)+1)
+	for _, col := range cols {
+		order = append(order, col.Expr+dir)
+	}
+	return strings.Join(append(order, idExpr+dir), ", ")
+}
+
+// pageKeys is embedded in the rows of keyset-paginated listings to scan the
+// keys selected by keysSql.
+type pageKeys struct {
+	Key0 string `db:"key_0" json:"-"`
+	Key1 string `db:"key_1" json:"-"`
+}
+
+func (k *pageKeys) pageKey(n int, id string) *PageKey {
+	keys := []string{k.Key0, k.Key1}
+	return &PageKey{Keys: keys[:n], Id: id}
+}
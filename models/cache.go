@@ -0,0 +1,79 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/cache"
+)
+
+// The hottest lookups, users and models by id and by name, and the latest
+// version of a file, go through a cache if there is one.  Anything that
+// changes one of them deletes it from the cache once the change is made.
+// Lookups by name only cache the id they found, and check what that id leads
+// to still has the name, so that renames never need to know the old name.
+
+// SetCache has hot lookups kept in c for ttl.
+func (api *ApiCollection) SetCache(c cache.Cache, ttl time.Duration) {
+	api.cache = c
+	api.cacheTTL = ttl
+	if api.reading != nil {
+		api.reading.SetCache(c, ttl)
+	}
+}
+
+// cached fills v from the cache at key, or else by calling load, which fills
+// v from the database.
+func (api *ApiCollection) cached(key string, v interface{}, load func() error) error {
+	if api.cache == nil {
+		return load()
+	}
+	return cache.Fetch(api.cache, key, api.cacheTTL, v, load)
+}
+
+// uncache deletes keys after whatever they're for has changed.  It isn't an
+// error for the change if it can't, since the keys run out soon anyway.
+func (api *ApiCollection) uncache(keys ...string) {
+	if api.cache == nil || len(keys) == 0 {
+		return
+	}
+	if err := api.cache.Delete(keys...); err != nil {
+		log.WithFields(log.Fields{
+			"err":  err,
+			"keys": keys,
+		}).Error("Could not delete from the cache")
+	}
+}
+
+func userKey(id string) string {
+	return "user:" + id
+}
+
+func usernameKey(username string) string {
+	return "username:" + strings.ToUpper(username)
+}
+
+func modelKey(id string) string {
+	return "model:" + id
+}
+
+func modelSlugKey(userId, slug string) string {
+	return "model_slug:" + userId + ":" + slug
+}
+
+func latestFileKey(modelId, filename string) string {
+	return "latest_file:" + modelId + ":" + filename
+}
+
+func userKeys(ids []string) []string {
+	keys := make([]string, 0, len(ids))
+	for _, id := range ids {
+		keys = append(keys, userKey(id))
+	}
+	return keys
+}
+
+func featureFlagsKey() string {
+	return "feature_flags"
+}
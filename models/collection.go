@@ -0,0 +1,214 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/pborman/uuid"
+	runner "gopkg.in/mgutz/dat.v1/sqlx-runner"
+)
+
+const COLLECTION_TABLE = "collection"
+const COLLECTION_MODEL_TABLE = "collection_model"
+
+// The most models a collection can have
+const MAX_COLLECTION_MODELS = 100
+
+type CollectionDb struct {
+	DB  *runner.DB
+	Api *ApiCollection
+}
+
+//go:generate counterfeiter $GOFILE CollectionApi
+type CollectionApi interface {
+	ById(id interface{}) (*Collection, error)
+	Delete(id interface{}) error
+	Save(*Collection) error
+	Truncate() error
+
+	ByUserId(userId string, limit int, after *PageKey) ([]*Collection, *PageKey, error)
+	Public(limit int, after *PageKey) ([]*Collection, *PageKey, error)
+	ModelIds(collectionId string) ([]string, error)
+	SetModels(collectionId string, modelIds []string) error
+}
+
+func NewCollectionDb(db *runner.DB, api *ApiCollection) *CollectionDb {
+	return &CollectionDb{
+		DB:  db,
+		Api: api,
+	}
+}
+
+// Collection is an ordered list of models put together around some theme,
+// like getting started with image classification.  Admins can feature public
+// ones, which puts them first in the listing.
+type Collection struct {
+	Id          string    `db:"id" json:"id"`
+	UserId      string    `db:"user_id" json:"user_id"`
+	Title       string    `db:"title" json:"title"`
+	Description string    `db:"description" json:"description"`
+	Visibility  string    `db:"visibility" json:"visibility"`
+	Featured    bool      `db:"featured" json:"featured"`
+	CreatedTime time.Time `db:"created_time" json:"created_time"`
+	UpdatedTime time.Time `db:"updated_time" json:"updated_time"`
+}
+
+func NewCollection(userId, title, description, visibility string) *Collection {
+	now := time.Now().UTC()
+	return &Collection{
+		Id:          uuid.NewRandom().String(),
+		UserId:      userId,
+		Title:       title,
+		Description: description,
+		Visibility:  visibility,
+		CreatedTime: now,
+		UpdatedTime: now,
+	}
+}
+
+func (db *CollectionDb) ById(id interface{}) (*Collection, error) {
+	var collection Collection
+	err := db.DB.
+		Select("*").
+		From(COLLECTION_TABLE).
+		Where("id = $1", id).
+		QueryStruct(&collection)
+	if err == sql.ErrNoRows {
+		return nil, err
+	}
+	return &collection, err
+}
+
+func (db *CollectionDb) Delete(id interface{}) error {
+	_, err := db.DB.
+		DeleteFrom(COLLECTION_TABLE).
+		Where("id = $1", id).
+		Exec()
+	return err
+}
+
+func (db *CollectionDb) Save(collection *Collection) error {
+	cols := []string{
+		"id",
+		"user_id",
+		"title",
+		"description",
+		"visibility",
+		"featured",
+		"created_time",
+		"updated_time",
+	}
+	vals := []interface{}{
+		collection.Id,
+		collection.UserId,
+		collection.Title,
+		collection.Description,
+		collection.Visibility,
+		collection.Featured,
+		collection.CreatedTime,
+		collection.UpdatedTime,
+	}
+	_, err := db.DB.
+		Upsert(COLLECTION_TABLE).
+		Columns(cols...).
+		Values(vals...).
+		Where("id = $1", collection.Id).
+		Exec()
+	return err
+}
+
+func (db *CollectionDb) Truncate() error {
+	_, err := db.DB.DeleteFrom(COLLECTION_TABLE).Exec()
+	return err
+}
+
+// -
+
+// How collections are listed: a user's most recently updated first, and
+// public ones with featured ones first and then the most recently updated
+var userCollectionsOrder = []keyCol{{"C.updated_time", "TIMESTAMPTZ"}}
+var publicCollectionsOrder = []keyCol{{"C.featured", "BOOLEAN"}, {"C.updated_time", "TIMESTAMPTZ"}}
+
+// ByUserId lists a page of the user's collections starting after the key.  It
+// also returns the key the next page starts after, if there might be one.
+func (db *CollectionDb) ByUserId(userId string, limit int, after *PageKey) ([]*Collection, *PageKey, error) {
+	var args sqlArgs
+	where := "C.user_id = " + args.Add(userId)
+	return db.page(where, userCollectionsOrder, limit, after, args)
+}
+
+// Public lists a page of public collections starting after the key.  It also
+// returns the key the next page starts after, if there might be one.
+func (db *CollectionDb) Public(limit int, after *PageKey) ([]*Collection, *PageKey, error) {
+	return db.page("C.visibility = 'public'", publicCollectionsOrder, limit, after, nil)
+}
+
+func (db *CollectionDb) page(where string, order []keyCol, limit int, after *PageKey, args sqlArgs) ([]*Collection, *PageKey, error) {
+	sql := `
+	SELECT C.*, ` + keysSql(order) + `
+	FROM ` + COLLECTION_TABLE + ` C
+	WHERE ` + where + `
+	  AND ` + after.afterSql(order, "C.id", true, &args) + `
+	ORDER BY ` + orderSql(order, "C.id", true) + `
+	LIMIT ` + args.Add(limit)
+	var rows []*keyedCollection
+	err := db.Api.reader(db.DB).SQL(sql, args...).QueryStructs(&rows)
+	collections := make([]*Collection, 0, len(rows))
+	for _, row := range rows {
+		collections = append(collections, &row.Collection)
+	}
+	var next *PageKey
+	if len(rows) == limit {
+		last := rows[len(rows)-1]
+		next = last.pageKey(len(order), last.Id)
+	}
+	return collections, next, err
+}
+
+type keyedCollection struct {
+	Collection
+	pageKeys
+}
+
+// ModelIds lists the ids of the collection's models in order.
+func (db *CollectionDb) ModelIds(collectionId string) ([]string, error) {
+	var ids []string
+	err := db.DB.
+		Select("model_id").
+		From(COLLECTION_MODEL_TABLE).
+		Where("collection_id = $1", collectionId).
+		OrderBy("position ASC").
+		QuerySlice(&ids)
+	if ids == nil {
+		ids = []string{}
+	}
+	return ids, err
+}
+
+// SetModels replaces the collection's models with the given ones, in order.
+func (db *CollectionDb) SetModels(collectionId string, modelIds []string) error {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.AutoRollback()
+
+	_, err = tx.
+		DeleteFrom(COLLECTION_MODEL_TABLE).
+		Where("collection_id = $1", collectionId).
+		Exec()
+	if err != nil {
+		return err
+	}
+	for i, modelId := range modelIds {
+		_, err = tx.
+			InsertInto(COLLECTION_MODEL_TABLE).
+			Columns("collection_id", "model_id", "position").
+			Values(collectionId, modelId, i).
+			Exec()
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,239 @@
+package models
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/pborman/uuid"
+	"gopkg.in/guregu/null.v3"
+	runner "gopkg.in/mgutz/dat.v1/sqlx-runner"
+)
+
+const DEVICE_AUTHORIZATION_TABLE = "device_authorization"
+
+const (
+	DEVICE_PENDING  = "pending"
+	DEVICE_APPROVED = "approved"
+	DEVICE_DENIED   = "denied"
+)
+
+// How long the user has to enter their code, and how often the client may
+// check whether they have
+const DEVICE_AUTHORIZATION_TTL = 10 * time.Minute
+const DEVICE_POLL_INTERVAL = 5 * time.Second
+
+// User codes leave out vowels, so they never spell anything, and letters
+// that look like digits
+const userCodeAlphabet = "BCDFGHJKLMNPQRSTVWXZ"
+
+type DeviceAuthorizationDb struct {
+	DB  *runner.DB
+	Api *ApiCollection
+}
+
+//go:generate counterfeiter $GOFILE DeviceAuthorizationApi
+type DeviceAuthorizationApi interface {
+	ById(id interface{}) (*DeviceAuthorization, error)
+	Delete(id interface{}) error
+	Save(*DeviceAuthorization) error
+	Truncate() error
+
+	ByUserCode(userCode string) (*DeviceAuthorization, error)
+	Claim(id string) (*DeviceAuthorization, error)
+	DeleteExpired() error
+}
+
+func NewDeviceAuthorizationDb(db *runner.DB, api *ApiCollection) *DeviceAuthorizationDb {
+	return &DeviceAuthorizationDb{
+		DB:  db,
+		Api: api,
+	}
+}
+
+// DeviceAuthorization lets a client that can't easily take a password, like
+// the command line client, sign in through the site instead.  The client
+// gets the Id, which it keeps secret and polls with, and shows the user the
+// short UserCode, which they enter on the site while signed in to approve the
+// client.  Once approved, the next poll trades it in for an API token.
+type DeviceAuthorization struct {
+	Id           string      `db:"id" json:"-"`
+	UserCode     string      `db:"user_code" json:"user_code"`
+	ClientName   string      `db:"client_name" json:"client_name"`
+	ScopesString string      `db:"scopes" json:"-"`
+	Scopes       []string    `db:"-" json:"scopes"`
+	Status       string      `db:"status" json:"status"`
+	UserId       null.String `db:"user_id" json:"-"`
+	CreatedTime  time.Time   `db:"created_time" json:"created_time"`
+	ExpiresTime  time.Time   `db:"expires_time" json:"expires_time"`
+	LastPollTime null.Time   `db:"last_poll_time" json:"-"`
+}
+
+func NewDeviceAuthorization(clientName string, scopes []string) (*DeviceAuthorization, error) {
+	userCode, err := newUserCode()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	d := &DeviceAuthorization{
+		Id:          uuid.NewRandom().String(),
+		UserCode:    userCode,
+		ClientName:  clientName,
+		Status:      DEVICE_PENDING,
+		CreatedTime: now,
+		ExpiresTime: now.Add(DEVICE_AUTHORIZATION_TTL),
+	}
+	d.SetScopes(scopes)
+	return d, nil
+}
+
+// newUserCode makes a code like "BDWP-HQZK", short enough to type in from
+// another screen.
+func newUserCode() (string, error) {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	code := make([]byte, 0, 9)
+	for i, b := range buf {
+		if i == 4 {
+			code = append(code, '-')
+		}
+		code = append(code, userCodeAlphabet[int(b)%len(userCodeAlphabet)])
+	}
+	return string(code), nil
+}
+
+// NormalizeUserCode undoes the ways people tend to mistype a user code.
+func NormalizeUserCode(userCode string) string {
+	userCode = strings.ToUpper(strings.Replace(strings.TrimSpace(userCode), "-", "", -1))
+	if len(userCode) != 8 {
+		return userCode
+	}
+	return userCode[:4] + "-" + userCode[4:]
+}
+
+func (d *DeviceAuthorization) SetScopes(scopes []string) {
+	encoded, _ := json.Marshal(scopes)
+	d.Scopes = scopes
+	d.ScopesString = string(encoded)
+}
+
+func (d *DeviceAuthorization) FillScopes() error {
+	d.Scopes = []string{}
+	if d.ScopesString == "" {
+		return nil
+	}
+	return json.Unmarshal([]byte(d.ScopesString), &d.Scopes)
+}
+
+func (d *DeviceAuthorization) Expired() bool {
+	return !time.Now().Before(d.ExpiresTime)
+}
+
+func (db *DeviceAuthorizationDb) ById(id interface{}) (*DeviceAuthorization, error) {
+	var d DeviceAuthorization
+	err := db.DB.
+		Select("*").
+		From(DEVICE_AUTHORIZATION_TABLE).
+		Where("id = $1", id).
+		QueryStruct(&d)
+	if err == sql.ErrNoRows {
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &d, d.FillScopes()
+}
+
+func (db *DeviceAuthorizationDb) Delete(id interface{}) error {
+	_, err := db.DB.
+		DeleteFrom(DEVICE_AUTHORIZATION_TABLE).
+		Where("id = $1", id).
+		Exec()
+	return err
+}
+
+func (db *DeviceAuthorizationDb) Save(d *DeviceAuthorization) error {
+	cols := []string{
+		"id",
+		"user_code",
+		"client_name",
+		"scopes",
+		"status",
+		"user_id",
+		"created_time",
+		"expires_time",
+		"last_poll_time",
+	}
+	vals := []interface{}{
+		d.Id,
+		d.UserCode,
+		d.ClientName,
+		d.ScopesString,
+		d.Status,
+		d.UserId,
+		d.CreatedTime,
+		d.ExpiresTime,
+		d.LastPollTime,
+	}
+	_, err := db.DB.
+		Upsert(DEVICE_AUTHORIZATION_TABLE).
+		Columns(cols...).
+		Values(vals...).
+		Where("id = $1", d.Id).
+		Exec()
+	return err
+}
+
+func (db *DeviceAuthorizationDb) Truncate() error {
+	_, err := db.DB.DeleteFrom(DEVICE_AUTHORIZATION_TABLE).Exec()
+	return err
+}
+
+// -
+
+func (db *DeviceAuthorizationDb) ByUserCode(userCode string) (*DeviceAuthorization, error) {
+	var d DeviceAuthorization
+	err := db.DB.
+		Select("*").
+		From(DEVICE_AUTHORIZATION_TABLE).
+		Where("user_code = $1", userCode).
+		QueryStruct(&d)
+	if err == sql.ErrNoRows {
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &d, d.FillScopes()
+}
+
+// Claim deletes an approved authorization and returns it, in one statement so
+// that two polls racing each other can't both get a token for it.
+func (db *DeviceAuthorizationDb) Claim(id string) (*DeviceAuthorization, error) {
+	var d DeviceAuthorization
+	err := db.DB.SQL(`
+	DELETE FROM device_authorization
+	WHERE id = $1 AND status = $2 AND expires_time > NOW()
+	RETURNING *
+	`, id, DEVICE_APPROVED).QueryStruct(&d)
+	if err == sql.ErrNoRows {
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &d, d.FillScopes()
+}
+
+func (db *DeviceAuthorizationDb) DeleteExpired() error {
+	_, err := db.DB.
+		DeleteFrom(DEVICE_AUTHORIZATION_TABLE).
+		Where("expires_time <= NOW()").
+		Exec()
+	return err
+}
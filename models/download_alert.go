@@ -0,0 +1,194 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/pborman/uuid"
+	"gopkg.in/guregu/null.v3"
+	runner "gopkg.in/mgutz/dat.v1/sqlx-runner"
+)
+
+const DOWNLOAD_ALERT_TABLE = "download_alert"
+
+// Spikes are measured against the average hour over this long before
+const DOWNLOAD_ALERT_TRAILING = 7 * 24 * time.Hour
+
+type DownloadAlertDb struct {
+	DB  *runner.DB
+	Api *ApiCollection
+}
+
+//go:generate counterfeiter $GOFILE DownloadAlertApi
+type DownloadAlertApi interface {
+	ById(id interface{}) (*DownloadAlert, error)
+	Delete(id interface{}) error
+	Save(*DownloadAlert) error
+	Truncate() error
+
+	ByModelId(modelId string) (*DownloadAlert, error)
+	Spiking(hour time.Time, quietSince time.Time) ([]*DownloadSpike, error)
+	MarkAlerted(id string, t time.Time) error
+}
+
+func NewDownloadAlertDb(db *runner.DB, api *ApiCollection) *DownloadAlertDb {
+	return &DownloadAlertDb{
+		DB:  db,
+		Api: api,
+	}
+}
+
+// DownloadAlert is how an owner wants to hear about their model's downloads
+// spiking: when an hour has more than Multiplier times the average hour, and
+// at least MinDownloads, so that a quiet model going from 1 to 5 doesn't
+// count.  They can hear about it by e-mail, on their webhook, or both.
+type DownloadAlert struct {
+	Id            string    `db:"id" json:"id"`
+	ModelId       string    `db:"model_id" json:"model_id"`
+	Multiplier    float64   `db:"multiplier" json:"multiplier"`
+	MinDownloads  int       `db:"min_downloads" json:"min_downloads"`
+	Email         bool      `db:"email" json:"email"`
+	Webhook       bool      `db:"webhook" json:"webhook"`
+	CreatedTime   time.Time `db:"created_time" json:"created_time"`
+	LastAlertTime null.Time `db:"last_alert_time" json:"last_alert_time"`
+}
+
+func NewDownloadAlert(modelId string, multiplier float64, minDownloads int, email, webhook bool) *DownloadAlert {
+	return &DownloadAlert{
+		Id:           uuid.NewRandom().String(),
+		ModelId:      modelId,
+		Multiplier:   multiplier,
+		MinDownloads: minDownloads,
+		Email:        email,
+		Webhook:      webhook,
+		CreatedTime:  time.Now().UTC(),
+	}
+}
+
+// DownloadSpike is an alert that has gone off, with the model it's for, that
+// hour's downloads, and the average hour it was measured against.
+type DownloadSpike struct {
+	DownloadAlert
+	UserId    string  `db:"user_id"`
+	Name      string  `db:"name"`
+	Slug      string  `db:"slug"`
+	Downloads int     `db:"downloads"`
+	Average   float64 `db:"average"`
+}
+
+func (db *DownloadAlertDb) ById(id interface{}) (*DownloadAlert, error) {
+	var alert DownloadAlert
+	err := db.DB.
+		Select("*").
+		From(DOWNLOAD_ALERT_TABLE).
+		Where("id = $1", id).
+		QueryStruct(&alert)
+	if err == sql.ErrNoRows {
+		return nil, err
+	}
+	return &alert, err
+}
+
+func (db *DownloadAlertDb) Delete(id interface{}) error {
+	_, err := db.DB.
+		DeleteFrom(DOWNLOAD_ALERT_TABLE).
+		Where("id = $1", id).
+		Exec()
+	return err
+}
+
+func (db *DownloadAlertDb) Save(alert *DownloadAlert) error {
+	cols := []string{
+		"id",
+		"model_id",
+		"multiplier",
+		"min_downloads",
+		"email",
+		"webhook",
+		"created_time",
+		"last_alert_time",
+	}
+	vals := []interface{}{
+		alert.Id,
+		alert.ModelId,
+		alert.Multiplier,
+		alert.MinDownloads,
+		alert.Email,
+		alert.Webhook,
+		alert.CreatedTime,
+		alert.LastAlertTime,
+	}
+	_, err := db.DB.
+		Upsert(DOWNLOAD_ALERT_TABLE).
+		Columns(cols...).
+		Values(vals...).
+		Where("id = $1", alert.Id).
+		Exec()
+	return err
+}
+
+func (db *DownloadAlertDb) Truncate() error {
+	_, err := db.DB.DeleteFrom(DOWNLOAD_ALERT_TABLE).Exec()
+	return err
+}
+
+// -
+
+func (db *DownloadAlertDb) ByModelId(modelId string) (*DownloadAlert, error) {
+	var alert DownloadAlert
+	err := db.DB.
+		Select("*").
+		From(DOWNLOAD_ALERT_TABLE).
+		Where("model_id = $1", modelId).
+		QueryStruct(&alert)
+	if err == sql.ErrNoRows {
+		return nil, err
+	}
+	return &alert, err
+}
+
+// Spiking finds the alerts that go off for the hour starting at hour, leaving
+// out any that have gone off since quietSince.  The hour can still be under
+// way, since a spike only gets bigger as it goes on.
+func (db *DownloadAlertDb) Spiking(hour time.Time, quietSince time.Time) ([]*DownloadSpike, error) {
+	sql := `
+  SELECT A.*, M.user_id, M.name, M.slug, D.downloads, D.average
+  FROM download_alert A
+  JOIN model M ON (M.id = A.model_id)
+  JOIN (
+    SELECT
+      F.model_id,
+      SUM(CASE WHEN DH.t >= $1 AND DH.t < $1 + INTERVAL '1 hour' THEN DH.downloads ELSE 0 END) AS downloads,
+      SUM(CASE WHEN DH.t < $1 THEN DH.downloads ELSE 0 END) / $2::DOUBLE PRECISION AS average
+    FROM (` + DownloadsSql("file_id IN (SELECT F.id FROM file F JOIN download_alert A ON (A.model_id = F.model_id))") + `) DH
+    JOIN file F ON (F.id = DH.file_id)
+    WHERE DH.t >= $1 - $2 * INTERVAL '1 hour' AND DH.t < $1 + INTERVAL '1 hour'
+    GROUP BY F.model_id
+  ) D ON (D.model_id = A.model_id)
+  WHERE D.downloads >= A.min_downloads
+    AND D.downloads > A.multiplier * D.average
+    AND (A.last_alert_time IS NULL OR A.last_alert_time < $3)
+  `
+	tx, end, err := beginAggregate(db.DB)
+	if err != nil {
+		return nil, err
+	}
+	defer end()
+
+	var spikes []*DownloadSpike
+	err = tx.SQL(sql, hour, DOWNLOAD_ALERT_TRAILING.Hours(), quietSince).
+		QueryStructs(&spikes)
+	if spikes == nil {
+		spikes = []*DownloadSpike{}
+	}
+	return spikes, err
+}
+
+func (db *DownloadAlertDb) MarkAlerted(id string, t time.Time) error {
+	_, err := db.DB.
+		Update(DOWNLOAD_ALERT_TABLE).
+		Set("last_alert_time", t).
+		Where("id = $1", id).
+		Exec()
+	return err
+}
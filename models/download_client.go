@@ -0,0 +1,115 @@
+package models
+
+import (
+	"time"
+
+	runner "gopkg.in/mgutz/dat.v1/sqlx-runner"
+)
+
+const DOWNLOAD_CLIENT_TABLE = "download_client"
+
+// What downloads are counted as when the client doesn't say what it is
+const CLIENT_UNKNOWN = "unknown"
+
+type DownloadClientDb struct {
+	DB  *runner.DB
+	Api *ApiCollection
+}
+
+// ClientDownloads is how many times something was downloaded by one client,
+// e.g. python-keras or curl, for one framework.
+type ClientDownloads struct {
+	ClientName string `db:"client_name" json:"client_name"`
+	Framework  string `db:"framework" json:"framework"`
+	Downloads  int    `db:"downloads" json:"downloads"`
+}
+
+// DownloadClient is a day's downloads of a file by one client and framework.
+type DownloadClient struct {
+	FileId     string    `db:"file_id" json:"file_id"`
+	Day        time.Time `db:"day" json:"day"`
+	ClientName string    `db:"client_name" json:"client_name"`
+	Framework  string    `db:"framework" json:"framework"`
+	Downloads  int       `db:"downloads" json:"downloads"`
+}
+
+//go:generate counterfeiter $GOFILE DownloadClientApi
+type DownloadClientApi interface {
+	MarkDownload(fileId, clientName, framework string, t time.Time) error
+	MarkDownloads(downloads []*DownloadClient) error
+	ByModelId(modelId string, start, end time.Time) ([]*ClientDownloads, error)
+	Truncate() error
+}
+
+func NewDownloadClientDb(db *runner.DB, api *ApiCollection) *DownloadClientDb {
+	return &DownloadClientDb{
+		DB:  db,
+		Api: api,
+	}
+}
+
+func (db *DownloadClientDb) MarkDownload(fileId, clientName, framework string, t time.Time) error {
+	sql := `
+  INSERT INTO
+    download_client (file_id, day, client_name, framework, downloads)
+  VALUES ($1, ($2::TIMESTAMPTZ AT TIME ZONE 'UTC')::DATE, $3, $4, 1)
+  ON CONFLICT ON CONSTRAINT download_client_file_id_day_client_name_framework_key
+    DO UPDATE SET downloads = download_client.downloads + 1
+  `
+
+	_, err := db.DB.Exec(sql, fileId, t, clientName, framework)
+	return err
+}
+
+// MarkDownloads adds a batch of downloads counted up elsewhere, all at once.
+func (db *DownloadClientDb) MarkDownloads(downloads []*DownloadClient) error {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.AutoRollback()
+
+	sql := `
+  INSERT INTO
+    download_client (file_id, day, client_name, framework, downloads)
+  VALUES ($1, ($2::TIMESTAMPTZ AT TIME ZONE 'UTC')::DATE, $3, $4, $5)
+  ON CONFLICT ON CONSTRAINT download_client_file_id_day_client_name_framework_key
+    DO UPDATE SET downloads = download_client.downloads + EXCLUDED.downloads
+  `
+	for _, d := range downloads {
+		if _, err = tx.SQL(sql, d.FileId, d.Day, d.ClientName, d.Framework,
+			d.Downloads).Exec(); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// ByModelId totals the downloads of all the model's files by client and
+// framework, over the days from start up to end, most downloads first.
+func (db *DownloadClientDb) ByModelId(modelId string, start, end time.Time) ([]*ClientDownloads, error) {
+	sql := `
+  SELECT
+    DC.client_name AS client_name,
+    DC.framework AS framework,
+    SUM(DC.downloads) AS downloads
+  FROM download_client DC
+  JOIN file F ON (F.id = DC.file_id)
+  WHERE F.model_id = $1
+    AND DC.day >= ($2::TIMESTAMPTZ AT TIME ZONE 'UTC')::DATE
+    AND DC.day < ($3::TIMESTAMPTZ AT TIME ZONE 'UTC')::DATE
+  GROUP BY DC.client_name, DC.framework
+  ORDER BY downloads DESC, client_name ASC, framework ASC
+  `
+	var clients []*ClientDownloads
+	err := db.Api.reader(db.DB).SQL(sql, modelId, start, end).QueryStructs(&clients)
+	if clients == nil {
+		clients = []*ClientDownloads{}
+	}
+	return clients, err
+}
+
+func (db *DownloadClientDb) Truncate() error {
+	_, err := db.DB.DeleteFrom(DOWNLOAD_CLIENT_TABLE).Exec()
+	return err
+}
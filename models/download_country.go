@@ -0,0 +1,109 @@
+package models
+
+import (
+	"time"
+
+	runner "gopkg.in/mgutz/dat.v1/sqlx-runner"
+)
+
+const DOWNLOAD_COUNTRY_TABLE = "download_country"
+
+type DownloadCountryDb struct {
+	DB  *runner.DB
+	Api *ApiCollection
+}
+
+// CountryDownloads is how many times something was downloaded from one
+// country.  Only days and countries are kept, never addresses or users, so
+// none of this can be traced back to who downloaded what.
+type CountryDownloads struct {
+	Country   string `db:"country" json:"country"`
+	Downloads int    `db:"downloads" json:"downloads"`
+}
+
+// DownloadCountry is a day's downloads of a file from one country.
+type DownloadCountry struct {
+	FileId    string    `db:"file_id" json:"file_id"`
+	Day       time.Time `db:"day" json:"day"`
+	Country   string    `db:"country" json:"country"`
+	Downloads int       `db:"downloads" json:"downloads"`
+}
+
+//go:generate counterfeiter $GOFILE DownloadCountryApi
+type DownloadCountryApi interface {
+	MarkDownload(fileId, country string, t time.Time) error
+	MarkDownloads(downloads []*DownloadCountry) error
+	ByModelId(modelId string, start, end time.Time) ([]*CountryDownloads, error)
+	Truncate() error
+}
+
+func NewDownloadCountryDb(db *runner.DB, api *ApiCollection) *DownloadCountryDb {
+	return &DownloadCountryDb{
+		DB:  db,
+		Api: api,
+	}
+}
+
+func (db *DownloadCountryDb) MarkDownload(fileId, country string, t time.Time) error {
+	sql := `
+  INSERT INTO
+    download_country (file_id, day, country, downloads)
+  VALUES ($1, ($2::TIMESTAMPTZ AT TIME ZONE 'UTC')::DATE, $3, 1)
+  ON CONFLICT ON CONSTRAINT download_country_file_id_day_country_key
+    DO UPDATE SET downloads = download_country.downloads + 1
+  `
+
+	_, err := db.DB.Exec(sql, fileId, t, country)
+	return err
+}
+
+// MarkDownloads adds a batch of downloads counted up elsewhere, all at once.
+func (db *DownloadCountryDb) MarkDownloads(downloads []*DownloadCountry) error {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.AutoRollback()
+
+	sql := `
+  INSERT INTO
+    download_country (file_id, day, country, downloads)
+  VALUES ($1, ($2::TIMESTAMPTZ AT TIME ZONE 'UTC')::DATE, $3, $4)
+  ON CONFLICT ON CONSTRAINT download_country_file_id_day_country_key
+    DO UPDATE SET downloads = download_country.downloads + EXCLUDED.downloads
+  `
+	for _, d := range downloads {
+		if _, err = tx.SQL(sql, d.FileId, d.Day, d.Country, d.Downloads).Exec(); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// ByModelId totals the downloads of all the model's files by country, over
+// the days from start up to end, most downloads first.
+func (db *DownloadCountryDb) ByModelId(modelId string, start, end time.Time) ([]*CountryDownloads, error) {
+	sql := `
+  SELECT
+    DC.country AS country,
+    SUM(DC.downloads) AS downloads
+  FROM download_country DC
+  JOIN file F ON (F.id = DC.file_id)
+  WHERE F.model_id = $1
+    AND DC.day >= ($2::TIMESTAMPTZ AT TIME ZONE 'UTC')::DATE
+    AND DC.day < ($3::TIMESTAMPTZ AT TIME ZONE 'UTC')::DATE
+  GROUP BY DC.country
+  ORDER BY downloads DESC, country ASC
+  `
+	var countries []*CountryDownloads
+	err := db.Api.reader(db.DB).SQL(sql, modelId, start, end).QueryStructs(&countries)
+	if countries == nil {
+		countries = []*CountryDownloads{}
+	}
+	return countries, err
+}
+
+func (db *DownloadCountryDb) Truncate() error {
+	_, err := db.DB.DeleteFrom(DOWNLOAD_COUNTRY_TABLE).Exec()
+	return err
+}
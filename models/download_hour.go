@@ -1,23 +1,210 @@
 package models
 
 import (
+	"fmt"
 	"time"
 
+	"github.com/ericflo/gradientzoo/utils"
+	"gopkg.in/guregu/null.v3"
 	runner "gopkg.in/mgutz/dat.v1/sqlx-runner"
 )
 
 const DOWNLOAD_HOUR_TABLE = "download_hour"
 
+// Downloads since the start of yesterday (UTC) are counted from download_hour,
+// which leaves the rollup a whole day to catch up on each day once it's over.
+// Before that, whole days come from download_day and whole months from
+// download_month.
+const downloadCutoffSql = `(date_trunc('day', NOW() AT TIME ZONE 'UTC') - INTERVAL '1 day')`
+
+// Days are counted one by one back to the start of the month that was a month
+// before the cutoff, so that windows of up to a month never have to split one
+// of download_month's rows
+const downloadDaysFromSql = `date_trunc('month', ` + downloadCutoffSql + ` - INTERVAL '31 days')::DATE`
+
+// DownloadsSql selects the downloads of the files matching fileWhere from
+// whichever of download_hour, download_day, and download_month has them at the
+// finest grain still around, as rows of (file_id, t, ip, downloads,
+// authenticated).  Rows from the rollups have no ip, and hourly rows from
+// before the cutoff are kept for their ip but count no downloads, since the
+// rollups have those already.
+// fileWhere is repeated once per table, so it can only refer to file_id.
+func DownloadsSql(fileWhere string) string {
+	return fmt.Sprintf(`
+    SELECT file_id, hour AS t, ip,
+      CASE WHEN hour >= %[2]s AT TIME ZONE 'UTC' THEN downloads ELSE 0 END AS downloads,
+      CASE WHEN hour >= %[2]s AT TIME ZONE 'UTC' THEN authenticated ELSE 0 END AS authenticated
+    FROM download_hour
+    WHERE %[1]s
+    UNION ALL
+    SELECT file_id, day::TIMESTAMP AT TIME ZONE 'UTC', NULL, downloads, authenticated
+    FROM download_day
+    WHERE %[1]s AND day < %[2]s::DATE AND day >= %[3]s
+    UNION ALL
+    SELECT file_id, month::TIMESTAMP AT TIME ZONE 'UTC', NULL, downloads, authenticated
+    FROM download_month
+    WHERE %[1]s AND month < %[3]s
+  `, fileWhere, downloadCutoffSql, downloadDaysFromSql)
+}
+
 type DownloadHourDb struct {
 	DB  *runner.DB
 	Api *ApiCollection
 }
 
+// DownloadCounts tallies downloads over the last day, week, month, and all
+// time.  Downloaders counts distinct IP addresses over however long hourly
+// downloads are kept, which gives a better idea of how widely something is
+// used than raw downloads do.  The Unique counts estimate distinct downloaders
+// over each window from sketches that are kept forever, so one busy CI job
+// can't make something look popular however long ago it ran.  The
+// Authenticated counts are the downloads made while signed in, such as by the
+// owner's own CI, and the rest were anonymous.
 type DownloadCounts struct {
-	Day   int `json:"day"`
-	Week  int `json:"week"`
-	Month int `json:"month"`
-	All   int `json:"all"`
+	Day                int `json:"day"`
+	Week               int `json:"week"`
+	Month              int `json:"month"`
+	All                int `json:"all"`
+	Downloaders        int `json:"downloaders"`
+	AuthenticatedDay   int `db:"authenticated_day" json:"authenticated_day"`
+	AuthenticatedWeek  int `db:"authenticated_week" json:"authenticated_week"`
+	AuthenticatedMonth int `db:"authenticated_month" json:"authenticated_month"`
+	AuthenticatedAll   int `db:"authenticated_all" json:"authenticated_all"`
+	UniqueDay          int `db:"-" json:"unique_day"`
+	UniqueWeek         int `db:"-" json:"unique_week"`
+	UniqueMonth        int `db:"-" json:"unique_month"`
+	UniqueAll          int `db:"-" json:"unique_all"`
+}
+
+// The columns of DownloadCounts, added up from DownloadsSql rows called DH
+const downloadCountsSql = `
+    COALESCE(SUM(CASE WHEN DH.t >= (NOW() - INTERVAL '1 day') THEN DH.downloads ELSE 0 END), 0) AS day,
+    COALESCE(SUM(CASE WHEN DH.t >= (NOW() - INTERVAL '1 week') THEN DH.downloads ELSE 0 END), 0) AS week,
+    COALESCE(SUM(CASE WHEN DH.t >= (NOW() - INTERVAL '1 month') THEN DH.downloads ELSE 0 END), 0) AS month,
+    COALESCE(SUM(DH.downloads), 0) AS all,
+    COUNT(DISTINCT DH.ip) AS downloaders,
+    COALESCE(SUM(CASE WHEN DH.t >= (NOW() - INTERVAL '1 day') THEN DH.authenticated ELSE 0 END), 0) AS authenticated_day,
+    COALESCE(SUM(CASE WHEN DH.t >= (NOW() - INTERVAL '1 week') THEN DH.authenticated ELSE 0 END), 0) AS authenticated_week,
+    COALESCE(SUM(CASE WHEN DH.t >= (NOW() - INTERVAL '1 month') THEN DH.authenticated ELSE 0 END), 0) AS authenticated_month,
+    COALESCE(SUM(DH.authenticated), 0) AS authenticated_all`
+
+// Who a download counts towards for unique downloaders.  download_hour's
+// user_id is the owner of the file, not whoever downloaded it, so this can only
+// go by IP address.
+const downloaderSql = `COALESCE(ip, '')`
+
+// downloadSketch is either a sketch of downloaders from one of the rollups or,
+// for recent downloads, the one downloader it stands for.
+type downloadSketch struct {
+	FileId  string      `db:"file_id"`
+	ModelId string      `db:"model_id"`
+	T       time.Time   `db:"t"`
+	Sketch  []byte      `db:"sketch"`
+	Who     null.String `db:"who"`
+}
+
+// uniqueSketches gathers downloaders over each of DownloadCounts' windows
+type uniqueSketches struct {
+	day, week, month, all *utils.HyperLogLog
+}
+
+func newUniqueSketches() *uniqueSketches {
+	return &uniqueSketches{
+		day:   utils.NewHyperLogLog(),
+		week:  utils.NewHyperLogLog(),
+		month: utils.NewHyperLogLog(),
+		all:   utils.NewHyperLogLog(),
+	}
+}
+
+func (u *uniqueSketches) add(s *downloadSketch, now time.Time) error {
+	windows := []*utils.HyperLogLog{u.all}
+	if !s.T.Before(now.AddDate(0, -1, 0)) {
+		windows = append(windows, u.month)
+	}
+	if !s.T.Before(now.AddDate(0, 0, -7)) {
+		windows = append(windows, u.week)
+	}
+	if !s.T.Before(now.AddDate(0, 0, -1)) {
+		windows = append(windows, u.day)
+	}
+
+	if s.Sketch == nil {
+		for _, h := range windows {
+			h.Add(s.Who.String)
+		}
+		return nil
+	}
+	sketch, err := utils.ParseHyperLogLog(s.Sketch)
+	if err != nil {
+		return err
+	}
+	for _, h := range windows {
+		h.Merge(sketch)
+	}
+	return nil
+}
+
+func (u *uniqueSketches) apply(counts *DownloadCounts) {
+	counts.UniqueDay = u.day.Count()
+	counts.UniqueWeek = u.week.Count()
+	counts.UniqueMonth = u.month.Count()
+	counts.UniqueAll = u.all.Count()
+}
+
+// DownloadHour is one row of download_hour, the downloads of one file from
+// one IP address in one hour.
+type DownloadHour struct {
+	FileId    string      `db:"file_id" json:"file_id"`
+	Hour      time.Time   `db:"hour" json:"hour"`
+	Ip        null.String `db:"ip" json:"ip"`
+	UserId    null.String `db:"user_id" json:"user_id"`
+	Downloads int         `db:"downloads" json:"downloads"`
+
+	// How many of the downloads were made while signed in
+	Authenticated int `db:"authenticated" json:"authenticated"`
+}
+
+// Download series can be bucketed by hour, going back as far as hourly
+// downloads are kept, or by day, going back forever
+const (
+	GRANULARITY_HOUR = "hour"
+	GRANULARITY_DAY  = "day"
+)
+
+// DownloadPoint is how many times one filename was downloaded, counting all of
+// its versions, in the hour or day starting at Time.
+type DownloadPoint struct {
+	Filename  string    `db:"filename" json:"filename"`
+	Time      time.Time `db:"t" json:"time"`
+	Downloads int       `db:"downloads" json:"downloads"`
+}
+
+// ModelPoint is how many times any of a model's files were downloaded in the
+// hour or day starting at Time.
+type ModelPoint struct {
+	Time      time.Time `db:"t" json:"time"`
+	Downloads int       `db:"downloads" json:"downloads"`
+}
+
+// VersionPoint is how many times one version of a file was downloaded in the
+// hour or day starting at Time.
+type VersionPoint struct {
+	FileId    string    `db:"file_id" json:"file_id"`
+	Time      time.Time `db:"t" json:"time"`
+	Downloads int       `db:"downloads" json:"downloads"`
+}
+
+// DownloadEvent is one row of download_hour along with the name of the file,
+// for analytics exports.  The IP address is only there to be hashed before it
+// goes anywhere.
+type DownloadEvent struct {
+	FileId    string      `db:"file_id" json:"file_id"`
+	Filename  string      `db:"filename" json:"filename"`
+	Framework string      `db:"framework" json:"framework"`
+	Hour      time.Time   `db:"hour" json:"hour"`
+	Ip        null.String `db:"ip" json:"-"`
+	Downloads int         `db:"downloads" json:"downloads"`
 }
 
 type FileDownloads struct {
@@ -32,11 +219,19 @@ type ModelDownloads struct {
 
 //go:generate counterfeiter $GOFILE DownloadHourApi
 type DownloadHourApi interface {
-	MarkDownload(fileId, userId, ip string, t time.Time) error
+	MarkDownload(fileId, userId, ip string, authenticated bool, t time.Time) error
+	MarkDownloads(downloads []*DownloadHour) error
 	CountByFile(fileId string) (DownloadCounts, error)
 	CountsByFiles(fileIds []string) (map[string]DownloadCounts, error)
 	CountByModel(modelId string) (DownloadCounts, error)
 	CountsByModels(modelIds []string) (map[string]DownloadCounts, error)
+	CountAcrossModels(modelIds []string) (DownloadCounts, error)
+	SeriesByModel(modelId, granularity string, start, end time.Time) ([]*DownloadPoint, error)
+	TotalSeries(modelId, granularity string, start, end time.Time) ([]*ModelPoint, error)
+	VersionSeries(modelId, filename, granularity string, start, end time.Time) ([]*VersionPoint, error)
+	EventsByModel(modelId string, start, end time.Time) ([]*DownloadEvent, error)
+	Rollup(keepSince time.Time) error
+	DailyByUserId(userId string) ([]*FileDownloadDay, error)
 	Truncate() error
 }
 
@@ -47,36 +242,116 @@ func NewDownloadHourDb(db *runner.DB, api *ApiCollection) *DownloadHourDb {
 	}
 }
 
-func (db *DownloadHourDb) MarkDownload(fileId, userId, ip string, t time.Time) error {
+func (db *DownloadHourDb) MarkDownload(fileId, userId, ip string, authenticated bool, t time.Time) error {
 	t = t.Truncate(time.Hour)
 
 	sql := `
   INSERT INTO
-    download_hour (file_id, user_id, ip, hour, downloads)
-  VALUES ($1, $2, $3, $4, 1)
+    download_hour (file_id, user_id, ip, hour, downloads, authenticated)
+  VALUES ($1, $2, $3, $4, 1, CASE WHEN $5 THEN 1 ELSE 0 END)
   ON CONFLICT ON CONSTRAINT download_hour_file_id_hour_ip_key
-    DO UPDATE SET downloads = download_hour.downloads + 1
+    DO UPDATE SET
+      downloads = download_hour.downloads + 1,
+      authenticated = download_hour.authenticated + EXCLUDED.authenticated
   RETURNING *
   `
 
-	_, err := db.DB.Exec(sql, fileId, userId, ip, t)
+	_, err := db.DB.Exec(sql, fileId, userId, ip, t, authenticated)
 	return err
 }
 
+// MarkDownloads adds a batch of downloads counted up elsewhere, all at once.
+func (db *DownloadHourDb) MarkDownloads(downloads []*DownloadHour) error {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.AutoRollback()
+
+	sql := `
+  INSERT INTO
+    download_hour (file_id, user_id, ip, hour, downloads, authenticated)
+  VALUES ($1, $2, $3, $4, $5, $6)
+  ON CONFLICT ON CONSTRAINT download_hour_file_id_hour_ip_key
+    DO UPDATE SET
+      downloads = download_hour.downloads + EXCLUDED.downloads,
+      authenticated = download_hour.authenticated + EXCLUDED.authenticated
+  `
+	for _, d := range downloads {
+		_, err = tx.SQL(sql, d.FileId, d.UserId, d.Ip, d.Hour.Truncate(time.Hour),
+			d.Downloads, d.Authenticated).Exec()
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// uniqueCounts estimates unique downloaders of the files matching fileWhere,
+// split up by whatever keyOf picks out of each file.  Like DownloadsSql, it
+// reads each stretch of time from the finest grain still around.
+func (db *DownloadHourDb) uniqueCounts(fileWhere string, arg interface{}, keyOf func(*downloadSketch) string) (map[string]*uniqueSketches, error) {
+	sql := fmt.Sprintf(`
+  SELECT S.file_id, F.model_id, S.t, S.sketch, S.who
+  FROM (
+    SELECT file_id, hour AS t, NULL::BYTEA AS sketch, %[4]s AS who
+    FROM download_hour
+    WHERE %[1]s AND hour >= %[2]s AT TIME ZONE 'UTC'
+    UNION ALL
+    SELECT file_id, day::TIMESTAMP AT TIME ZONE 'UTC', sketch, NULL
+    FROM download_day
+    WHERE %[1]s AND day < %[2]s::DATE AND day >= %[3]s AND sketch IS NOT NULL
+    UNION ALL
+    SELECT file_id, month::TIMESTAMP AT TIME ZONE 'UTC', sketch, NULL
+    FROM download_month
+    WHERE %[1]s AND month < %[3]s AND sketch IS NOT NULL
+  ) S
+  JOIN file F ON (F.id = S.file_id)
+  `, fileWhere, downloadCutoffSql, downloadDaysFromSql, downloaderSql)
+
+	var sketches []*downloadSketch
+	if err := db.Api.reader(db.DB).SQL(sql, arg).QueryStructs(&sketches); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	uniques := map[string]*uniqueSketches{}
+	for _, s := range sketches {
+		key := keyOf(s)
+		if uniques[key] == nil {
+			uniques[key] = newUniqueSketches()
+		}
+		if err := uniques[key].add(s, now); err != nil {
+			return nil, err
+		}
+	}
+	return uniques, nil
+}
+
+func uniqueByFile(s *downloadSketch) string  { return s.FileId }
+func uniqueByModel(s *downloadSketch) string { return s.ModelId }
+func uniqueByAll(s *downloadSketch) string   { return "" }
+
 func (db *DownloadHourDb) CountByFile(fileId string) (DownloadCounts, error) {
 	sql := `
   SELECT
-    COALESCE(SUM(CASE WHEN DH.hour >= (NOW() - INTERVAL '1 day') THEN DH.downloads ELSE 0 END)) AS day,
-    COALESCE(SUM(CASE WHEN DH.hour >= (NOW() - INTERVAL '1 week') THEN DH.downloads ELSE 0 END)) AS week,
-    COALESCE(SUM(CASE WHEN DH.hour >= (NOW() - INTERVAL '1 month') THEN DH.downloads ELSE 0 END)) AS month,
-    COALESCE(SUM(DH.downloads), 0) AS all
-  FROM download_hour DH
-  WHERE DH.file_id = $1
+    ` + downloadCountsSql + `
+  FROM (` + DownloadsSql("file_id = $1") + `) DH
   `
 
 	var downloads DownloadCounts
-	err := db.DB.SQL(sql, fileId).QueryStruct(&downloads)
-	return downloads, err
+	if err := db.Api.reader(db.DB).SQL(sql, fileId).QueryStruct(&downloads); err != nil {
+		return downloads, err
+	}
+
+	uniques, err := db.uniqueCounts("file_id = $1", fileId, uniqueByAll)
+	if err != nil {
+		return downloads, err
+	}
+	if u, ok := uniques[""]; ok {
+		u.apply(&downloads)
+	}
+	return downloads, nil
 }
 
 func (db *DownloadHourDb) CountsByFiles(fileIds []string) (map[string]DownloadCounts, error) {
@@ -87,16 +362,16 @@ func (db *DownloadHourDb) CountsByFiles(fileIds []string) (map[string]DownloadCo
 	sql := `
   SELECT
     DH.file_id AS file_id,
-    COALESCE(SUM(CASE WHEN DH.hour >= (NOW() - INTERVAL '1 day') THEN DH.downloads ELSE 0 END)) AS day,
-    COALESCE(SUM(CASE WHEN DH.hour >= (NOW() - INTERVAL '1 week') THEN DH.downloads ELSE 0 END)) AS week,
-    COALESCE(SUM(CASE WHEN DH.hour >= (NOW() - INTERVAL '1 month') THEN DH.downloads ELSE 0 END)) AS month,
-    COALESCE(SUM(DH.downloads), 0) AS all
-  FROM download_hour DH
-  WHERE DH.file_id IN $1
+    ` + downloadCountsSql + `
+  FROM (` + DownloadsSql("file_id IN $1") + `) DH
   GROUP BY DH.file_id
   `
 	var fileDownloads []*FileDownloads
-	err := db.DB.SQL(sql, fileIds).QueryStructs(&fileDownloads)
+	err := db.Api.reader(db.DB).SQL(sql, fileIds).QueryStructs(&fileDownloads)
+	if err != nil {
+		return nil, err
+	}
+	uniques, err := db.uniqueCounts("file_id IN $1", fileIds, uniqueByFile)
 	if err != nil {
 		return nil, err
 	}
@@ -107,12 +382,11 @@ func (db *DownloadHourDb) CountsByFiles(fileIds []string) (map[string]DownloadCo
 		resp[fileId] = DownloadCounts{}
 	}
 	for _, fileDownload := range fileDownloads {
-		resp[fileDownload.FileId] = DownloadCounts{
-			Day:   fileDownload.Day,
-			Week:  fileDownload.Week,
-			Month: fileDownload.Month,
-			All:   fileDownload.All,
+		counts := fileDownload.DownloadCounts
+		if u, ok := uniques[fileDownload.FileId]; ok {
+			u.apply(&counts)
 		}
+		resp[fileDownload.FileId] = counts
 	}
 
 	return resp, nil
@@ -121,18 +395,24 @@ func (db *DownloadHourDb) CountsByFiles(fileIds []string) (map[string]DownloadCo
 func (db *DownloadHourDb) CountByModel(modelId string) (DownloadCounts, error) {
 	sql := `
   SELECT
-    COALESCE(SUM(CASE WHEN DH.hour >= (NOW() - INTERVAL '1 day') THEN DH.downloads ELSE 0 END)) AS day,
-    COALESCE(SUM(CASE WHEN DH.hour >= (NOW() - INTERVAL '1 week') THEN DH.downloads ELSE 0 END)) AS week,
-    COALESCE(SUM(CASE WHEN DH.hour >= (NOW() - INTERVAL '1 month') THEN DH.downloads ELSE 0 END)) AS month,
-    COALESCE(SUM(DH.downloads), 0) AS all
-  FROM download_hour DH
-  LEFT JOIN file F ON (F.id = DH.file_id)
-  WHERE F.model_id = $1
+    ` + downloadCountsSql + `
+  FROM (` + DownloadsSql("file_id IN (SELECT id FROM file WHERE model_id = $1)") + `) DH
   `
 
 	var downloads DownloadCounts
-	err := db.DB.SQL(sql, modelId).QueryStruct(&downloads)
-	return downloads, err
+	if err := db.Api.reader(db.DB).SQL(sql, modelId).QueryStruct(&downloads); err != nil {
+		return downloads, err
+	}
+
+	uniques, err := db.uniqueCounts("file_id IN (SELECT id FROM file WHERE model_id = $1)",
+		modelId, uniqueByAll)
+	if err != nil {
+		return downloads, err
+	}
+	if u, ok := uniques[""]; ok {
+		u.apply(&downloads)
+	}
+	return downloads, nil
 }
 
 func (db *DownloadHourDb) CountsByModels(modelIds []string) (map[string]DownloadCounts, error) {
@@ -143,17 +423,18 @@ func (db *DownloadHourDb) CountsByModels(modelIds []string) (map[string]Download
 	sql := `
   SELECT
     F.model_id AS model_id,
-    COALESCE(SUM(CASE WHEN DH.hour >= (NOW() - INTERVAL '1 day') THEN DH.downloads ELSE 0 END)) AS day,
-    COALESCE(SUM(CASE WHEN DH.hour >= (NOW() - INTERVAL '1 week') THEN DH.downloads ELSE 0 END)) AS week,
-    COALESCE(SUM(CASE WHEN DH.hour >= (NOW() - INTERVAL '1 month') THEN DH.downloads ELSE 0 END)) AS month,
-    COALESCE(SUM(DH.downloads), 0) AS all
-  FROM download_hour DH
+    ` + downloadCountsSql + `
+  FROM (` + DownloadsSql("file_id IN (SELECT id FROM file WHERE model_id IN $1)") + `) DH
   LEFT JOIN file F ON (F.id = DH.file_id)
-  WHERE F.model_id IN $1
   GROUP BY F.model_id
   `
 	var modelDownloads []*ModelDownloads
-	err := db.DB.SQL(sql, modelIds).QueryStructs(&modelDownloads)
+	err := db.Api.reader(db.DB).SQL(sql, modelIds).QueryStructs(&modelDownloads)
+	if err != nil {
+		return nil, err
+	}
+	uniques, err := db.uniqueCounts("file_id IN (SELECT id FROM file WHERE model_id IN $1)",
+		modelIds, uniqueByModel)
 	if err != nil {
 		return nil, err
 	}
@@ -164,18 +445,341 @@ func (db *DownloadHourDb) CountsByModels(modelIds []string) (map[string]Download
 		resp[modelId] = DownloadCounts{}
 	}
 	for _, modelDownload := range modelDownloads {
-		resp[modelDownload.ModelId] = DownloadCounts{
-			Day:   modelDownload.Day,
-			Week:  modelDownload.Week,
-			Month: modelDownload.Month,
-			All:   modelDownload.All,
+		counts := modelDownload.DownloadCounts
+		if u, ok := uniques[modelDownload.ModelId]; ok {
+			u.apply(&counts)
 		}
+		resp[modelDownload.ModelId] = counts
 	}
 
 	return resp, nil
 }
 
+// CountAcrossModels tallies the downloads of all the given models together,
+// so that someone who downloaded several of them is one downloader, not many.
+func (db *DownloadHourDb) CountAcrossModels(modelIds []string) (DownloadCounts, error) {
+	if len(modelIds) == 0 {
+		return DownloadCounts{}, nil
+	}
+
+	sql := `
+  SELECT
+    ` + downloadCountsSql + `
+  FROM (` + DownloadsSql("file_id IN (SELECT id FROM file WHERE model_id IN $1)") + `) DH
+  `
+
+	var downloads DownloadCounts
+	if err := db.Api.reader(db.DB).SQL(sql, modelIds).QueryStruct(&downloads); err != nil {
+		return downloads, err
+	}
+
+	uniques, err := db.uniqueCounts("file_id IN (SELECT id FROM file WHERE model_id IN $1)",
+		modelIds, uniqueByAll)
+	if err != nil {
+		return downloads, err
+	}
+	if u, ok := uniques[""]; ok {
+		u.apply(&downloads)
+	}
+	return downloads, nil
+}
+
+// seriesSql selects the downloads of the files matching fileWhere as rows of
+// (file_id, t, downloads), with t being the start of the hour or day they're
+// counted in.  Like DownloadsSql, fileWhere can only refer to file_id.
+func seriesSql(granularity, fileWhere string) string {
+	if granularity == GRANULARITY_HOUR {
+		return `
+    SELECT file_id, hour AS t, downloads
+    FROM download_hour
+    WHERE ` + fileWhere + `
+    `
+	}
+	return `
+    SELECT file_id, date_trunc('day', hour AT TIME ZONE 'UTC') AT TIME ZONE 'UTC' AS t, downloads
+    FROM download_hour
+    WHERE ` + fileWhere + `
+      AND hour >= ` + downloadCutoffSql + ` AT TIME ZONE 'UTC'
+    UNION ALL
+    SELECT file_id, day::TIMESTAMP AT TIME ZONE 'UTC', downloads
+    FROM download_day
+    WHERE ` + fileWhere + `
+      AND day < ` + downloadCutoffSql + `::DATE
+    `
+}
+
+// SeriesByModel buckets the downloads of each of the model's filenames from
+// start up to end by hour or day, oldest first.  Buckets without any downloads
+// are left out.
+func (db *DownloadHourDb) SeriesByModel(modelId, granularity string, start, end time.Time) ([]*DownloadPoint, error) {
+	source := seriesSql(granularity, "file_id IN (SELECT id FROM file WHERE model_id = $1)")
+	sql := `
+  SELECT
+    F.filename AS filename,
+    D.t AS t,
+    SUM(D.downloads) AS downloads
+  FROM (` + source + `) D
+  JOIN file F ON (F.id = D.file_id)
+  WHERE D.t >= $2 AND D.t < $3
+  GROUP BY F.filename, D.t
+  ORDER BY D.t ASC, F.filename ASC
+  `
+	var points []*DownloadPoint
+	err := db.Api.reader(db.DB).SQL(sql, modelId, start, end).QueryStructs(&points)
+	if points == nil {
+		points = []*DownloadPoint{}
+	}
+	return points, err
+}
+
+// TotalSeries buckets the downloads of all of the model's files from start up
+// to end by hour or day, oldest first.  Buckets without any downloads are left
+// out.
+func (db *DownloadHourDb) TotalSeries(modelId, granularity string, start, end time.Time) ([]*ModelPoint, error) {
+	source := seriesSql(granularity, "file_id IN (SELECT id FROM file WHERE model_id = $1)")
+	sql := `
+  SELECT
+    D.t AS t,
+    SUM(D.downloads) AS downloads
+  FROM (` + source + `) D
+  WHERE D.t >= $2 AND D.t < $3
+  GROUP BY D.t
+  ORDER BY D.t ASC
+  `
+	var points []*ModelPoint
+	err := db.Api.reader(db.DB).SQL(sql, modelId, start, end).QueryStructs(&points)
+	if points == nil {
+		points = []*ModelPoint{}
+	}
+	return points, err
+}
+
+// VersionSeries buckets the downloads of each version of one of the model's
+// filenames from start up to end by hour or day, oldest first, so it can be
+// seen how quickly downloaders move on to a new version.  Buckets without any
+// downloads are left out.
+func (db *DownloadHourDb) VersionSeries(modelId, filename, granularity string, start, end time.Time) ([]*VersionPoint, error) {
+	source := seriesSql(granularity,
+		"file_id IN (SELECT id FROM file WHERE model_id = $1 AND filename = $4)")
+	sql := `
+  SELECT
+    D.file_id AS file_id,
+    D.t AS t,
+    SUM(D.downloads) AS downloads
+  FROM (` + source + `) D
+  WHERE D.t >= $2 AND D.t < $3
+  GROUP BY D.file_id, D.t
+  ORDER BY D.t ASC, D.file_id ASC
+  `
+	var points []*VersionPoint
+	err := db.Api.reader(db.DB).SQL(sql, modelId, start, end, filename).QueryStructs(&points)
+	if points == nil {
+		points = []*VersionPoint{}
+	}
+	return points, err
+}
+
+// EventsByModel lists the hourly downloads of the model's files from start up
+// to end, oldest first, going back as far as hourly downloads are kept.
+func (db *DownloadHourDb) EventsByModel(modelId string, start, end time.Time) ([]*DownloadEvent, error) {
+	sql := `
+  SELECT
+    DH.file_id AS file_id,
+    F.filename AS filename,
+    F.framework AS framework,
+    DH.hour AS hour,
+    DH.ip AS ip,
+    DH.downloads AS downloads
+  FROM download_hour DH
+  JOIN file F ON (F.id = DH.file_id)
+  WHERE F.model_id = $1 AND DH.hour >= $2 AND DH.hour < $3
+  ORDER BY DH.hour ASC, F.filename ASC
+  `
+	var events []*DownloadEvent
+	err := db.DB.SQL(sql, modelId, start, end).QueryStructs(&events)
+	if events == nil {
+		events = []*DownloadEvent{}
+	}
+	return events, err
+}
+
+// Rollup adds up hourly downloads into download_day and download_month, then
+// prunes hourly rows from before keepSince.  Each time around it starts again
+// from the day before the latest one rolled up, so a day is finished off the
+// next time this runs after it's over, however long that turns out to be.
+func (db *DownloadHourDb) Rollup(keepSince time.Time) error {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.AutoRollback()
+
+	var from time.Time
+	err = tx.SQL(`SELECT COALESCE(MAX(day) - 1, DATE '1970-01-01') FROM download_day`).
+		QueryScalar(&from)
+	if err != nil {
+		return err
+	}
+
+	stmts := []string{
+		`INSERT INTO download_day (file_id, day, downloads, downloaders, authenticated)
+		 SELECT file_id, (hour AT TIME ZONE 'UTC')::DATE AS d, SUM(downloads), COUNT(DISTINCT ip),
+		   SUM(authenticated)
+		 FROM download_hour
+		 WHERE hour >= $1::DATE::TIMESTAMP AT TIME ZONE 'UTC'
+		 GROUP BY file_id, d
+		 ON CONFLICT ON CONSTRAINT download_day_file_id_day_key
+		   DO UPDATE SET downloads = EXCLUDED.downloads, downloaders = EXCLUDED.downloaders,
+		     authenticated = EXCLUDED.authenticated`,
+		`INSERT INTO download_month (file_id, month, downloads, authenticated)
+		 SELECT file_id, date_trunc('month', day)::DATE AS m, SUM(downloads), SUM(authenticated)
+		 FROM download_day
+		 WHERE day >= date_trunc('month', $1::DATE)::DATE
+		 GROUP BY file_id, m
+		 ON CONFLICT ON CONSTRAINT download_month_file_id_month_key
+		   DO UPDATE SET downloads = EXCLUDED.downloads, authenticated = EXCLUDED.authenticated`,
+	}
+	for _, stmt := range stmts {
+		if _, err = tx.SQL(stmt, from).Exec(); err != nil {
+			return err
+		}
+	}
+	if err = rollupSketches(tx, from); err != nil {
+		return err
+	}
+
+	// Never prune anything that might not have been rolled up yet, or that
+	// DownloadsSql still reads downloads from
+	_, err = tx.SQL(`
+  DELETE FROM download_hour
+  WHERE hour < LEAST($1, $2::DATE::TIMESTAMP AT TIME ZONE 'UTC', `+downloadCutoffSql+` AT TIME ZONE 'UTC')
+  `, keepSince, from).Exec()
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+type downloadWho struct {
+	FileId string    `db:"file_id"`
+	Day    time.Time `db:"day"`
+	Who    string    `db:"who"`
+}
+
+type sketchKey struct {
+	fileId string
+	date   string
+}
+
+// rollupSketches sketches who downloaded each file on each day since from, and
+// merges those into each month's sketch.  Merging in the same downloaders again
+// changes nothing, so a day can be rolled up as many times as it takes.
+func rollupSketches(tx *runner.Tx, from time.Time) error {
+	var whos []*downloadWho
+	err := tx.SQL(`
+  SELECT DISTINCT file_id, (hour AT TIME ZONE 'UTC')::DATE AS day, `+downloaderSql+` AS who
+  FROM download_hour
+  WHERE hour >= $1::DATE::TIMESTAMP AT TIME ZONE 'UTC'
+  `, from).QueryStructs(&whos)
+	if err != nil || len(whos) == 0 {
+		return err
+	}
+
+	days := map[sketchKey]*utils.HyperLogLog{}
+	for _, w := range whos {
+		key := sketchKey{w.FileId, w.Day.Format("2006-01-02")}
+		if days[key] == nil {
+			days[key] = utils.NewHyperLogLog()
+		}
+		days[key].Add(w.Who)
+	}
+
+	months := map[sketchKey]*utils.HyperLogLog{}
+	fileIdKeys := map[string]bool{}
+	for key, h := range days {
+		_, err = tx.SQL(`UPDATE download_day SET sketch = $3 WHERE file_id = $1 AND day = $2`,
+			key.fileId, key.date, h.Bytes()).Exec()
+		if err != nil {
+			return err
+		}
+		monthKey := sketchKey{key.fileId, key.date[:len("2006-01")] + "-01"}
+		if months[monthKey] == nil {
+			months[monthKey] = utils.NewHyperLogLog()
+		}
+		months[monthKey].Merge(h)
+		fileIdKeys[key.fileId] = true
+	}
+
+	// Fold in what the months had already, from days rolled up before
+	fileIds := make([]string, 0, len(fileIdKeys))
+	for fileId := range fileIdKeys {
+		fileIds = append(fileIds, fileId)
+	}
+	var existing []*downloadSketch
+	err = tx.SQL(`
+  SELECT file_id, month::TIMESTAMP AS t, sketch
+  FROM download_month
+  WHERE file_id IN $1 AND month >= date_trunc('month', $2::DATE)::DATE AND sketch IS NOT NULL
+  `, fileIds, from).QueryStructs(&existing)
+	if err != nil {
+		return err
+	}
+	for _, s := range existing {
+		key := sketchKey{s.FileId, s.T.Format("2006-01-02")}
+		if months[key] == nil {
+			continue
+		}
+		sketch, err := utils.ParseHyperLogLog(s.Sketch)
+		if err != nil {
+			return err
+		}
+		months[key].Merge(sketch)
+	}
+
+	for key, h := range months {
+		_, err = tx.SQL(`UPDATE download_month SET sketch = $3 WHERE file_id = $1 AND month = $2`,
+			key.fileId, key.date, h.Bytes()).Exec()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (db *DownloadHourDb) Truncate() error {
-	_, err := db.DB.DeleteFrom(DOWNLOAD_HOUR_TABLE).Exec()
-	return err
+	for _, table := range []string{DOWNLOAD_HOUR_TABLE, "download_day", "download_month"} {
+		if _, err := db.DB.DeleteFrom(table).Exec(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FileDownloadDay is how many times a file was downloaded in a day.
+type FileDownloadDay struct {
+	FileId    string    `db:"file_id" json:"file_id"`
+	Day       time.Time `db:"day" json:"day"`
+	Downloads int64     `db:"downloads" json:"downloads"`
+}
+
+// DailyByUserId counts the downloads of the user's files, by file and day,
+// newest first.  download_hour's user_id is the file's owner, not whoever
+// downloaded it, so this only ever counts: where the downloads came from is
+// about other people.  Downloads from before daily rollups are kept are
+// counted by month, on the month's first day.
+func (db *DownloadHourDb) DailyByUserId(userId string) ([]*FileDownloadDay, error) {
+	sql := `
+  SELECT D.file_id, date_trunc('day', D.t AT TIME ZONE 'UTC') AS day,
+    SUM(D.downloads) AS downloads
+  FROM (` + DownloadsSql("file_id IN (SELECT id FROM file WHERE user_id = $1)") + `) D
+  GROUP BY D.file_id, day
+  HAVING SUM(D.downloads) > 0
+  ORDER BY day DESC, D.file_id ASC
+  `
+	var days []*FileDownloadDay
+	err := db.DB.SQL(sql, userId).QueryStructs(&days)
+	if days == nil {
+		days = []*FileDownloadDay{}
+	}
+	return days, err
 }
@@ -0,0 +1,225 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"hash/fnv"
+	"regexp"
+	"time"
+
+	runner "gopkg.in/mgutz/dat.v1/sqlx-runner"
+)
+
+const FEATURE_FLAG_TABLE = "feature_flag"
+
+// Flag names are like upload_dedup
+var FlagNameReg = regexp.MustCompile("^[a-z0-9_]{1,64}$")
+
+type FeatureFlagDb struct {
+	DB  *runner.DB
+	Api *ApiCollection
+}
+
+//go:generate counterfeiter $GOFILE FeatureFlagApi
+type FeatureFlagApi interface {
+	ByName(name string) (*FeatureFlag, error)
+	Delete(name string) error
+	Save(*FeatureFlag) error
+	Truncate() error
+
+	All() ([]*FeatureFlag, error)
+}
+
+func NewFeatureFlagDb(db *runner.DB, api *ApiCollection) *FeatureFlagDb {
+	return &FeatureFlagDb{
+		DB:  db,
+		Api: api,
+	}
+}
+
+// FeatureFlag turns something that's being rolled out on for some users: the
+// ones listed, the members of the organizations listed, and a percentage of
+// everybody else.  Turning Enabled off turns it off for everybody at once,
+// whoever it was rolled out to.  Flags that don't exist are off.
+type FeatureFlag struct {
+	Name                  string    `db:"name" json:"name"`
+	Description           string    `db:"description" json:"description"`
+	Enabled               bool      `db:"enabled" json:"enabled"`
+	Percent               int       `db:"percent" json:"percent"`
+	UserIdsString         string    `db:"user_ids" json:"-"`
+	UserIds               []string  `db:"-" json:"user_ids"`
+	OrganizationIdsString string    `db:"organization_ids" json:"-"`
+	OrganizationIds       []string  `db:"-" json:"organization_ids"`
+	UpdatedTime           time.Time `db:"updated_time" json:"updated_time"`
+}
+
+func NewFeatureFlag(name, description string) *FeatureFlag {
+	f := &FeatureFlag{
+		Name:        name,
+		Description: description,
+		UpdatedTime: time.Now().UTC(),
+	}
+	f.SetTargets(nil, nil)
+	return f
+}
+
+// SetTargets sets the users and organizations the flag is on for, whatever
+// its percentage.
+func (f *FeatureFlag) SetTargets(userIds, organizationIds []string) {
+	if userIds == nil {
+		userIds = []string{}
+	}
+	if organizationIds == nil {
+		organizationIds = []string{}
+	}
+	encodedUsers, _ := json.Marshal(userIds)
+	encodedOrgs, _ := json.Marshal(organizationIds)
+	f.UserIds = userIds
+	f.UserIdsString = string(encodedUsers)
+	f.OrganizationIds = organizationIds
+	f.OrganizationIdsString = string(encodedOrgs)
+}
+
+// FillTargets decodes the users and organizations from what's stored.
+func (f *FeatureFlag) FillTargets() error {
+	f.UserIds = []string{}
+	f.OrganizationIds = []string{}
+	if f.UserIdsString != "" {
+		if err := json.Unmarshal([]byte(f.UserIdsString), &f.UserIds); err != nil {
+			return err
+		}
+	}
+	if f.OrganizationIdsString == "" {
+		return nil
+	}
+	return json.Unmarshal([]byte(f.OrganizationIdsString), &f.OrganizationIds)
+}
+
+// EnabledFor says whether the flag is on for the user, who's a member of the
+// organization, either of which can be "".  Which users fall within the
+// percentage depends on the flag, so it isn't always the same users who get
+// to try everything first, but the same user always gets the same answer
+// as long as the percentage doesn't go down.  Anonymous users only get a
+// flag once it's at 100%.
+func (f *FeatureFlag) EnabledFor(userId, organizationId string) bool {
+	if f == nil || !f.Enabled {
+		return false
+	}
+	if userId != "" && containsString(f.UserIds, userId) {
+		return true
+	}
+	if organizationId != "" && containsString(f.OrganizationIds, organizationId) {
+		return true
+	}
+	if f.Percent >= 100 {
+		return true
+	}
+	if userId == "" || f.Percent <= 0 {
+		return false
+	}
+	h := fnv.New32a()
+	h.Write([]byte(f.Name + ":" + userId))
+	return int(h.Sum32()%100) < f.Percent
+}
+
+// NeedsOrganization says whether EnabledFor could depend on the user's
+// organization, so that it doesn't have to be looked up otherwise.
+func (f *FeatureFlag) NeedsOrganization(userId string) bool {
+	return f != nil && f.Enabled && len(f.OrganizationIds) > 0 && !containsString(f.UserIds, userId)
+}
+
+func containsString(strs []string, s string) bool {
+	for _, str := range strs {
+		if str == s {
+			return true
+		}
+	}
+	return false
+}
+
+// ByName finds the flag among all of them, which are cached together, since
+// there are only ever a few, and most lookups are for flags that are off.
+func (db *FeatureFlagDb) ByName(name string) (*FeatureFlag, error) {
+	flags, err := db.All()
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range flags {
+		if f.Name == name {
+			return f, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+// All lists every flag, by name.  Changes to a flag are seen at once by the
+// server that made them, and by the rest once their cache runs out, unless
+// the cache is shared.
+func (db *FeatureFlagDb) All() ([]*FeatureFlag, error) {
+	var flags []*FeatureFlag
+	err := db.Api.cached(featureFlagsKey(), &flags, func() error {
+		flags = nil
+		err := db.DB.
+			Select("*").
+			From(FEATURE_FLAG_TABLE).
+			OrderBy("name ASC").
+			QueryStructs(&flags)
+		if err != nil {
+			return err
+		}
+		for _, f := range flags {
+			if err = f.FillTargets(); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if flags == nil {
+		flags = []*FeatureFlag{}
+	}
+	return flags, err
+}
+
+func (db *FeatureFlagDb) Delete(name string) error {
+	_, err := db.DB.
+		DeleteFrom(FEATURE_FLAG_TABLE).
+		Where("name = $1", name).
+		Exec()
+	db.Api.uncache(featureFlagsKey())
+	return err
+}
+
+func (db *FeatureFlagDb) Save(f *FeatureFlag) error {
+	cols := []string{
+		"name",
+		"description",
+		"enabled",
+		"percent",
+		"user_ids",
+		"organization_ids",
+		"updated_time",
+	}
+	vals := []interface{}{
+		f.Name,
+		f.Description,
+		f.Enabled,
+		f.Percent,
+		f.UserIdsString,
+		f.OrganizationIdsString,
+		f.UpdatedTime,
+	}
+	_, err := db.DB.
+		Upsert(FEATURE_FLAG_TABLE).
+		Columns(cols...).
+		Values(vals...).
+		Where("name = $1", f.Name).
+		Exec()
+	db.Api.uncache(featureFlagsKey())
+	return err
+}
+
+func (db *FeatureFlagDb) Truncate() error {
+	_, err := db.DB.DeleteFrom(FEATURE_FLAG_TABLE).Exec()
+	db.Api.uncache(featureFlagsKey())
+	return err
+}
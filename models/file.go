@@ -3,10 +3,14 @@ package models
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/pborman/uuid"
+	"gopkg.in/guregu/null.v3"
 	runner "gopkg.in/mgutz/dat.v1/sqlx-runner"
 )
 
@@ -28,12 +32,25 @@ type FileApi interface {
 
 	// TODO: Potentially this should be a separate interface
 	ByModelIdFilenameLatest(modelId, filename string) (*File, error)
-	ByModelIdFrameworkFilename(modelId, framework, filename string) ([]*File, error)
+	ByModelIdFrameworkFilename(modelId, framework, filename string, limit int, after *PageKey) ([]*File, *PageKey, error)
 	ByModelIdLatest(modelId string) ([]*File, error)
+	LatestByModelIds(modelIds []interface{}) ([]*File, error)
 	ByModelId(modelId string) ([]*File, error)
+	ByModelIdFilename(modelId, filename string) ([]*File, error)
+	Rename(modelId, filename, newFilename string) error
+	UpdateMetadata(id, userId string, patch map[string]interface{}) (*File, *FileMetadataRevision, error)
 	DeletePending(modelId, filename string) error
 	CommitPending(modelId, filename, fileId string) error
+	CommitGroup(modelId string, filenames []string) ([]*File, []string, error)
 	ToDelete(modelId, filename string, n int) ([]*File, error)
+	ToDeleteGroup(modelId string, filenames []string, n int) ([]*File, error)
+	NextToDelete(modelId, filename string, n int) ([]*File, error)
+	History(modelId string, since, until time.Time) ([]*File, error)
+	Releases(modelId string, limit int) ([]*File, error)
+	Compatibility(modelId string) ([]*FrameworkCompatibility, error)
+	FrameworkUploads(granularity, versions string, start, end time.Time) ([]*FrameworkUploads, error)
+	SearchMetadata(userId string, includePrivate bool, preds []*MetadataPredicate, limit int) ([]*File, error)
+	BySha256(sha256, viewerId string, limit int) ([]*File, error)
 }
 
 func NewFileDb(db *runner.DB, api *ApiCollection) *FileDb {
@@ -53,12 +70,15 @@ type File struct {
 	FrameworkVersion string                 `db:"framework_version" json:"framework_version"`
 	ClientName       string                 `db:"client_name" json:"client_name"`
 	SizeBytes        int                    `db:"size_bytes" json:"size_bytes"`
+	Sha256           string                 `db:"sha256" json:"sha256"`
+	GroupVersion     null.String            `db:"group_version" json:"group_version"`
 	MetadataString   string                 `db:"metadata" json:"-"`
 	Metadata         map[string]interface{} `db:"-" json:"metadata"`
 	CreatedTime      time.Time              `db:"created_time" json:"created_time"`
 
 	// Hydrated fields
-	Downloads *DownloadCounts `db:"-" json:"downloads,omitempty"`
+	Downloads  *DownloadCounts `db:"-" json:"downloads,omitempty"`
+	Quarantine *FileQuarantine `db:"-" json:"quarantine,omitempty"`
 }
 
 func NewFile(userId, modelId, filename, framework, frameworkVersion,
@@ -84,6 +104,78 @@ func NewFile(userId, modelId, filename, framework, frameworkVersion,
 	return f, nil
 }
 
+// FrameworkCompatibility summarizes which versions of a file were uploaded
+// from a particular framework version.
+type FrameworkCompatibility struct {
+	Filename         string    `db:"filename" json:"filename"`
+	Framework        string    `db:"framework" json:"framework"`
+	FrameworkVersion string    `db:"framework_version" json:"framework_version"`
+	Versions         int       `db:"versions" json:"versions"`
+	IsLatest         bool      `db:"is_latest" json:"is_latest"`
+	LatestTime       time.Time `db:"latest_time" json:"latest_time"`
+}
+
+// How finely FrameworkUploads splits up each framework's versions: by major
+// version (e.g. 1.x), by exact version, or not at all
+const (
+	VERSIONS_MAJOR = "major"
+	VERSIONS_FULL  = "full"
+	VERSIONS_NONE  = "none"
+)
+
+// FrameworkUploads is how many files were uploaded to public models from one
+// framework version in the day, week, or month starting at Time.
+type FrameworkUploads struct {
+	Time             time.Time `db:"t" json:"time"`
+	Framework        string    `db:"framework" json:"framework"`
+	FrameworkVersion string    `db:"framework_version" json:"framework_version"`
+	Uploads          int       `db:"uploads" json:"uploads"`
+}
+
+// MetadataPredicate is a single key/value condition on file metadata, like
+// epoch>50 or optimizer=adam.
+type MetadataPredicate struct {
+	Key   string      `json:"key"`
+	Op    string      `json:"op"`
+	Value interface{} `json:"value"`
+}
+
+// Longer operators come first so that ">=" isn't parsed as ">"
+var metadataOps = []string{">=", "<=", "!=", "=", ">", "<"}
+
+// ParseMetadataPredicate parses strings of the form key<op>value, where op is
+// one of =, !=, >, >=, <, <=.  Values that look like numbers or booleans are
+// treated as such, and double quotes can be used to force a string.
+func ParseMetadataPredicate(s string) (*MetadataPredicate, error) {
+	for i := 0; i < len(s); i++ {
+		for _, op := range metadataOps {
+			if !strings.HasPrefix(s[i:], op) {
+				continue
+			}
+			key := strings.TrimSpace(s[:i])
+			raw := strings.TrimSpace(s[i+len(op):])
+			if key == "" {
+				return nil, errors.New("Metadata predicate is missing a key")
+			}
+			var value interface{}
+			if n, err := strconv.ParseFloat(raw, 64); err == nil {
+				value = n
+			} else if raw == "true" || raw == "false" {
+				value = raw == "true"
+			} else if unquoted, err := strconv.Unquote(raw); err == nil {
+				value = unquoted
+			} else {
+				value = raw
+			}
+			if _, isNum := value.(float64); !isNum && op != "=" && op != "!=" {
+				return nil, fmt.Errorf("Operator %s needs a numeric value", op)
+			}
+			return &MetadataPredicate{Key: key, Op: op, Value: value}, nil
+		}
+	}
+	return nil, fmt.Errorf("Could not find an operator in %q", s)
+}
+
 func (f *File) FillMetadata() error {
 	if f.MetadataString == "" {
 		f.Metadata = map[string]interface{}{}
@@ -95,6 +187,78 @@ func (f *File) FillMetadata() error {
 	return nil
 }
 
+// FlattenMetadata turns nested metadata into a single level map, joining keys
+// with dots, so that {"eval": {"loss": 0.1}} becomes {"eval.loss": 0.1}.
+// Arrays are left as they are.
+func FlattenMetadata(metadata map[string]interface{}) map[string]interface{} {
+	flat := map[string]interface{}{}
+	var flatten func(prefix string, m map[string]interface{})
+	flatten = func(prefix string, m map[string]interface{}) {
+		for k, v := range m {
+			if nested, ok := v.(map[string]interface{}); ok && len(nested) > 0 {
+				flatten(prefix+k+".", nested)
+				continue
+			}
+			flat[prefix+k] = v
+		}
+	}
+	flatten("", metadata)
+	return flat
+}
+
+// ProjectMetadata picks out just the given keys from metadata.  Keys can use
+// dots to reach into nested objects, like "eval.loss", and the result keeps
+// the same nesting as the original.  Keys that aren't present are left out.
+func ProjectMetadata(metadata map[string]interface{}, keys []string) map[string]interface{} {
+	projected := map[string]interface{}{}
+	included := map[string]bool{}
+	for _, key := range keys {
+		parts := strings.Split(key, ".")
+
+		// Find the value, giving up on keys that aren't there
+		var v interface{} = metadata
+		found := true
+		for _, part := range parts {
+			m, ok := v.(map[string]interface{})
+			if !ok {
+				found = false
+				break
+			}
+			if v, found = m[part]; !found {
+				break
+			}
+		}
+		if !found {
+			continue
+		}
+
+		// Skip keys whose parent has already been included in full, since
+		// the parent's map is shared with the original metadata
+		covered := false
+		for i := 1; i < len(parts); i++ {
+			if included[strings.Join(parts[:i], ".")] {
+				covered = true
+			}
+		}
+		if covered {
+			continue
+		}
+		included[key] = true
+
+		dst := projected
+		for _, part := range parts[:len(parts)-1] {
+			next, ok := dst[part].(map[string]interface{})
+			if !ok {
+				next = map[string]interface{}{}
+				dst[part] = next
+			}
+			dst = next
+		}
+		dst[parts[len(parts)-1]] = v
+	}
+	return projected
+}
+
 func (f *File) BlobFilename() string {
 	return fmt.Sprintf("files/%s/%s/%s__%d__%s",
 		f.UserId,
@@ -140,10 +304,14 @@ func (db *FileDb) ByIds(ids []interface{}) ([]*File, error) {
 }
 
 func (db *FileDb) Delete(id interface{}) error {
-	_, err := db.DB.
-		DeleteFrom(FILE_TABLE).
-		Where("id = $1", id).
-		Exec()
+	var f File
+	err := db.DB.
+		SQL("DELETE FROM "+FILE_TABLE+" WHERE id = $1 RETURNING model_id, filename", id).
+		QueryStruct(&f)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	db.Api.uncache(latestFileKey(f.ModelId, f.Filename))
 	return err
 }
 
@@ -158,6 +326,8 @@ func (db *FileDb) Save(f *File) error {
 		"framework_version",
 		"client_name",
 		"size_bytes",
+		"sha256",
+		"group_version",
 		"metadata",
 		"created_time",
 	}
@@ -171,6 +341,8 @@ func (db *FileDb) Save(f *File) error {
 		f.FrameworkVersion,
 		f.ClientName,
 		f.SizeBytes,
+		f.Sha256,
+		f.GroupVersion,
 		f.MetadataString,
 		f.CreatedTime,
 	}
@@ -180,6 +352,8 @@ func (db *FileDb) Save(f *File) error {
 		Values(vals...).
 		Where("id = $1", f.Id).
 		Exec()
+	// Uploading a file also changes when its model was updated
+	db.Api.uncache(latestFileKey(f.ModelId, f.Filename), modelKey(f.ModelId))
 	return err
 }
 
@@ -194,9 +368,15 @@ func (db *FileDb) Hydrate(files []*File) error {
 		return err
 	}
 
+	quarantines, err := db.Api.FileQuarantine.ActiveByFileIds(fileIds)
+	if err != nil {
+		return err
+	}
+
 	for _, file := range files {
 		c := counts[file.Id]
 		file.Downloads = &c
+		file.Quarantine = quarantines[file.Id]
 	}
 	return nil
 }
@@ -210,12 +390,14 @@ func (db *FileDb) Truncate() error {
 
 func (db *FileDb) ByModelIdFilenameLatest(modelId, filename string) (*File, error) {
 	var f File
-	err := db.DB.
-		Select("*").
-		From(FILE_TABLE).
-		Where("model_id = $1 AND filename = $2 AND status = $3",
-			modelId, filename, "latest").
-		QueryStruct(&f)
+	err := db.Api.cached(latestFileKey(modelId, filename), &f, func() error {
+		return db.DB.
+			Select("*").
+			From(FILE_TABLE).
+			Where("model_id = $1 AND filename = $2 AND status = $3",
+				modelId, filename, "latest").
+			QueryStruct(&f)
+	})
 	if err == sql.ErrNoRows {
 		return nil, err
 	}
@@ -225,16 +407,52 @@ func (db *FileDb) ByModelIdFilenameLatest(modelId, filename string) (*File, erro
 	return &f, err
 }
 
-func (db *FileDb) ByModelIdFrameworkFilename(modelId, framework, filename string) ([]*File, error) {
+// fileVersionsOrder lists versions of a file newest first
+var fileVersionsOrder = []keyCol{{"F.created_time", "TIMESTAMPTZ"}}
+
+// ByModelIdFrameworkFilename lists a page of the committed versions of a
+// file, newest first, starting after the key.  It also returns the key the
+// next page starts after, if there might be one.
+func (db *FileDb) ByModelIdFrameworkFilename(modelId, framework, filename string, limit int, after *PageKey) ([]*File, *PageKey, error) {
+	var args sqlArgs
+	sql := `
+	SELECT F.*, ` + keysSql(fileVersionsOrder) + `
+	FROM file F
+	WHERE F.model_id = ` + args.Add(modelId) + `
+	  AND F.framework = ` + args.Add(framework) + `
+	  AND F.filename = ` + args.Add(filename) + `
+	  AND F.status IN ('latest', 'old')
+	  AND ` + after.afterSql(fileVersionsOrder, "F.id", true, &args) + `
+	ORDER BY ` + orderSql(fileVersionsOrder, "F.id", true) + `
+	LIMIT ` + args.Add(limit)
+	var rows []*keyedFile
+	err := db.DB.SQL(sql, args...).QueryStructs(&rows)
+	files := make([]*File, 0, len(rows))
+	for _, row := range rows {
+		if err := row.FillMetadata(); err != nil {
+			return nil, nil, err
+		}
+		files = append(files, &row.File)
+	}
+	var next *PageKey
+	if len(rows) == limit {
+		last := rows[len(rows)-1]
+		next = last.pageKey(len(fileVersionsOrder), last.Id)
+	}
+	return files, next, err
+}
+
+type keyedFile struct {
+	File
+	pageKeys
+}
+
+func (db *FileDb) ByModelIdLatest(modelId string) ([]*File, error) {
 	var files []*File
 	err := db.DB.
 		Select("*").
 		From(FILE_TABLE).
-		Where("model_id = $1 AND "+
-			"framework = $2 AND "+
-			"filename = $3 AND "+
-			"(status = $4 OR status = $5)",
-			modelId, framework, filename, "latest", "old").
+		Where("model_id = $1 AND status = $2", modelId, "latest").
 		QueryStructs(&files)
 	if files == nil {
 		files = []*File{}
@@ -247,12 +465,16 @@ func (db *FileDb) ByModelIdFrameworkFilename(modelId, framework, filename string
 	return files, err
 }
 
-func (db *FileDb) ByModelIdLatest(modelId string) ([]*File, error) {
+// LatestByModelIds is ByModelIdLatest for many models at once.
+func (db *FileDb) LatestByModelIds(modelIds []interface{}) ([]*File, error) {
+	if len(modelIds) == 0 {
+		return []*File{}, nil
+	}
 	var files []*File
-	err := db.DB.
+	err := db.Api.reader(db.DB).
 		Select("*").
 		From(FILE_TABLE).
-		Where("model_id = $1 AND status = $2", modelId, "latest").
+		Where("model_id IN $1 AND status = $2", IdStrings(modelIds), "latest").
 		QueryStructs(&files)
 	if files == nil {
 		files = []*File{}
@@ -283,6 +505,138 @@ func (db *FileDb) ByModelId(modelId string) ([]*File, error) {
 	return files, err
 }
 
+func (db *FileDb) ByModelIdFilename(modelId, filename string) ([]*File, error) {
+	var files []*File
+	err := db.DB.
+		Select("*").
+		From(FILE_TABLE).
+		Where("model_id = $1 AND filename = $2", modelId, filename).
+		OrderBy("created_time DESC").
+		QueryStructs(&files)
+	if files == nil {
+		files = []*File{}
+	}
+	for _, f := range files {
+		if err = f.FillMetadata(); err != nil {
+			return nil, err
+		}
+	}
+	return files, err
+}
+
+// Rename only touches the filename column, so the file ids (and therefore the
+// download_hour rows that point at them) stay the same.
+func (db *FileDb) Rename(modelId, filename, newFilename string) error {
+	_, err := db.DB.
+		Update(FILE_TABLE).
+		Set("filename", newFilename).
+		Where("model_id = $1 AND filename = $2", modelId, filename).
+		Exec()
+	db.Api.uncache(latestFileKey(modelId, filename), latestFileKey(modelId, newFilename))
+	return err
+}
+
+// UpdateMetadata merges patch into a file's metadata and records the change as
+// a new revision.  The file's row is locked for the duration, so concurrent
+// updates are applied one after the other rather than overwriting each other.
+func (db *FileDb) UpdateMetadata(id, userId string, patch map[string]interface{}) (*File, *FileMetadataRevision, error) {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.AutoRollback()
+
+	var f File
+	err = tx.
+		SQL("SELECT * FROM "+FILE_TABLE+" WHERE id = $1 FOR UPDATE", id).
+		QueryStruct(&f)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err = f.FillMetadata(); err != nil {
+		return nil, nil, err
+	}
+
+	var revision int
+	err = tx.
+		SQL("SELECT COUNT(*) FROM "+FILE_METADATA_REVISION_TABLE+" WHERE file_id = $1", id).
+		QueryScalar(&revision)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	metadata := MergeMetadata(f.Metadata, patch)
+	encodedPatch, err := json.Marshal(patch)
+	if err != nil {
+		return nil, nil, err
+	}
+	encodedMetadata, err := json.Marshal(metadata)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	r := &FileMetadataRevision{
+		Id:                     uuid.NewUUID().String(),
+		FileId:                 f.Id,
+		UserId:                 userId,
+		Revision:               revision + 1,
+		PatchString:            string(encodedPatch),
+		Patch:                  patch,
+		PreviousMetadataString: f.MetadataString,
+		PreviousMetadata:       f.Metadata,
+		MetadataString:         string(encodedMetadata),
+		Metadata:               metadata,
+		CreatedTime:            time.Now().UTC(),
+	}
+
+	_, err = tx.
+		Update(FILE_TABLE).
+		Set("metadata", r.MetadataString).
+		Where("id = $1", f.Id).
+		Exec()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cols := []string{
+		"id",
+		"file_id",
+		"user_id",
+		"revision",
+		"patch",
+		"previous_metadata",
+		"metadata",
+		"created_time",
+	}
+	vals := []interface{}{
+		r.Id,
+		r.FileId,
+		r.UserId,
+		r.Revision,
+		r.PatchString,
+		r.PreviousMetadataString,
+		r.MetadataString,
+		r.CreatedTime,
+	}
+	_, err = tx.
+		InsertInto(FILE_METADATA_REVISION_TABLE).
+		Columns(cols...).
+		Values(vals...).
+		Exec()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, nil, err
+	}
+	db.Api.uncache(latestFileKey(f.ModelId, f.Filename))
+
+	f.MetadataString = r.MetadataString
+	f.Metadata = metadata
+	return &f, r, nil
+}
+
 func (db *FileDb) DeletePending(modelId, filename string) error {
 	var ids []interface{}
 
@@ -316,15 +670,157 @@ func (db *FileDb) CommitPending(modelId, filename, fileId string) error {
     SET status = (CASE WHEN id = $1 THEN 'latest' ELSE 'old' END)
     WHERE model_id = $2 AND
           filename = $3`, fileId, modelId, filename)
+	db.Api.uncache(latestFileKey(modelId, filename))
 	return err
 }
 
+// CommitGroup promotes the pending versions of a group of filenames to latest
+// all at once, tagging them with a shared group version.  If any filename
+// doesn't have a pending version yet nothing is changed, and the filenames
+// still missing are returned instead of the committed files.
+func (db *FileDb) CommitGroup(modelId string, filenames []string) ([]*File, []string, error) {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.AutoRollback()
+
+	// Lock the model so that two uploads finishing a group at the same time
+	// can't both commit it
+	var lockedId string
+	err = tx.
+		SQL("SELECT id FROM model WHERE id = $1 FOR UPDATE", modelId).
+		QueryScalar(&lockedId)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var pending []*File
+	err = tx.
+		Select("*").
+		From(FILE_TABLE).
+		Where("model_id = $1 AND filename IN $2 AND status = 'pending'",
+			modelId, filenames).
+		OrderBy("created_time DESC").
+		QueryStructs(&pending)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, nil, err
+	}
+
+	byFilename := map[string]*File{}
+	for _, f := range pending {
+		if _, ok := byFilename[f.Filename]; !ok {
+			byFilename[f.Filename] = f
+		}
+	}
+	missing := []string{}
+	for _, filename := range filenames {
+		if _, ok := byFilename[filename]; !ok {
+			missing = append(missing, filename)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, missing, nil
+	}
+
+	groupVersion := uuid.NewUUID().String()
+	committed := make([]*File, 0, len(filenames))
+	for _, filename := range filenames {
+		f := byFilename[filename]
+		_, err = tx.Exec(`
+		UPDATE file
+		SET status = (CASE WHEN id = $1 THEN 'latest' ELSE 'old' END),
+		    group_version = (CASE WHEN id = $1 THEN $4 ELSE group_version END)
+		WHERE model_id = $2 AND
+		      filename = $3`, f.Id, modelId, filename, groupVersion)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err = f.FillMetadata(); err != nil {
+			return nil, nil, err
+		}
+		f.Status = "latest"
+		f.GroupVersion = null.StringFrom(groupVersion)
+		committed = append(committed, f)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, nil, err
+	}
+	keys := make([]string, 0, len(filenames))
+	for _, filename := range filenames {
+		keys = append(keys, latestFileKey(modelId, filename))
+	}
+	db.Api.uncache(keys...)
+	return committed, []string{}, nil
+}
+
+// ToDelete returns the versions of a file that fall outside of its retention
+// window.  The model-level keep count n is used unless a per-filename policy
+// lowers it, and the version aliased as "best" by a policy is never returned.
+// Policies can't raise it, so that they stop keeping more than the plan
+// allows once the model's plan is downgraded.
 func (db *FileDb) ToDelete(modelId, filename string, n int) ([]*File, error) {
+	policy, err := db.Api.FilePolicy.ByModelIdFilename(modelId, filename)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	bestFileId := ""
+	if policy != nil {
+		if policy.Keep > 0 && policy.Keep < n {
+			n = policy.Keep
+		}
+		bestFileId = policy.BestFileId.String
+	}
+
 	var files []*File
-	err := db.DB.
+	err = db.DB.
 		Select("*").
 		From(FILE_TABLE).
-		Where("model_id = $1 AND filename = $2", modelId, filename).
+		Where("model_id = $1 AND filename = $2 AND id::TEXT != $3",
+			modelId, filename, bestFileId).
+		OrderBy("created_time DESC").
+		Limit(10000).
+		Offset(uint64(n)).
+		QueryStructs(&files)
+	if files == nil {
+		files = []*File{}
+	}
+	for _, f := range files {
+		if err = f.FillMetadata(); err != nil {
+			return nil, err
+		}
+	}
+	return files, err
+}
+
+// NextToDelete returns the committed versions of a file that the next upload
+// would push out of its retention window, working out the keep count the same
+// way ToDelete does.  The new upload takes up one of the kept slots, so only
+// the n-1 most recent versions (plus the "best" version) survive it.
+func (db *FileDb) NextToDelete(modelId, filename string, n int) ([]*File, error) {
+	policy, err := db.Api.FilePolicy.ByModelIdFilename(modelId, filename)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	bestFileId := ""
+	if policy != nil {
+		if policy.Keep > 0 && policy.Keep < n {
+			n = policy.Keep
+		}
+		bestFileId = policy.BestFileId.String
+	}
+	if n > 0 {
+		n--
+	}
+
+	var files []*File
+	err = db.DB.
+		Select("*").
+		From(FILE_TABLE).
+		Where("model_id = $1 AND filename = $2 AND id::TEXT != $3 AND "+
+			"status IN ('latest', 'old')",
+			modelId, filename, bestFileId).
 		OrderBy("created_time DESC").
 		Limit(10000).
 		Offset(uint64(n)).
@@ -339,3 +835,236 @@ func (db *FileDb) ToDelete(modelId, filename string, n int) ([]*File, error) {
 	}
 	return files, err
 }
+
+// ToDeleteGroup is ToDelete for a group of filenames: it returns every file in
+// the group outside of the n most recent group versions.  Versions committed
+// before the group existed each count as a version of their own.  Group
+// versions that include a file aliased as "best" are never returned.
+func (db *FileDb) ToDeleteGroup(modelId string, filenames []string, n int) ([]*File, error) {
+	var files []*File
+	err := db.DB.SQL(`
+	WITH generation AS (
+		SELECT COALESCE(group_version, id) AS id, MAX(created_time) AS created_time
+		FROM file
+		WHERE model_id = $1 AND
+		      filename IN $2 AND
+		      status != 'pending'
+		GROUP BY COALESCE(group_version, id)
+		HAVING NOT bool_or(id IN (
+			SELECT best_file_id
+			FROM file_policy
+			WHERE model_id = $1 AND best_file_id IS NOT NULL
+		))
+		ORDER BY MAX(created_time) DESC
+		OFFSET $3
+	)
+	SELECT *
+	FROM file
+	WHERE model_id = $1 AND
+	      filename IN $2 AND
+	      status != 'pending' AND
+	      COALESCE(group_version, id) IN (SELECT id FROM generation)
+	`, modelId, filenames, n).QueryStructs(&files)
+	if files == nil {
+		files = []*File{}
+	}
+	for _, f := range files {
+		if err = f.FillMetadata(); err != nil {
+			return nil, err
+		}
+	}
+	return files, err
+}
+
+// History returns every committed version of every file in a model, oldest
+// first.  Zero times leave that end of the range open.
+func (db *FileDb) History(modelId string, since, until time.Time) ([]*File, error) {
+	conds := "model_id = $1 AND status IN ('latest', 'old')"
+	args := []interface{}{modelId}
+	if !since.IsZero() {
+		args = append(args, since)
+		conds += fmt.Sprintf(" AND created_time >= $%d", len(args))
+	}
+	if !until.IsZero() {
+		args = append(args, until)
+		conds += fmt.Sprintf(" AND created_time < $%d", len(args))
+	}
+
+	var files []*File
+	err := db.Api.reader(db.DB).
+		Select("*").
+		From(FILE_TABLE).
+		Where(conds, args...).
+		OrderBy("created_time ASC").
+		QueryStructs(&files)
+	if files == nil {
+		files = []*File{}
+	}
+	for _, f := range files {
+		if err = f.FillMetadata(); err != nil {
+			return nil, err
+		}
+	}
+	return files, err
+}
+
+// Releases returns the limit most recently committed files in a model, newest
+// first.
+func (db *FileDb) Releases(modelId string, limit int) ([]*File, error) {
+	var files []*File
+	err := db.Api.reader(db.DB).
+		Select("*").
+		From(FILE_TABLE).
+		Where("model_id = $1 AND status IN ('latest', 'old')", modelId).
+		OrderBy("created_time DESC, id ASC").
+		Limit(uint64(limit)).
+		QueryStructs(&files)
+	if files == nil {
+		files = []*File{}
+	}
+	for _, f := range files {
+		if err = f.FillMetadata(); err != nil {
+			return nil, err
+		}
+	}
+	return files, err
+}
+
+// Compatibility groups a model's committed files by filename, framework, and
+// framework version.
+func (db *FileDb) Compatibility(modelId string) ([]*FrameworkCompatibility, error) {
+	var compat []*FrameworkCompatibility
+	err := db.Api.reader(db.DB).SQL(`
+	SELECT filename,
+	       framework,
+	       framework_version,
+	       COUNT(*) AS versions,
+	       bool_or(status = 'latest') AS is_latest,
+	       MAX(created_time) AS latest_time
+	FROM file
+	WHERE model_id = $1 AND status IN ('latest', 'old')
+	GROUP BY filename, framework, framework_version
+	ORDER BY filename, framework, framework_version
+	`, modelId).QueryStructs(&compat)
+	if compat == nil {
+		compat = []*FrameworkCompatibility{}
+	}
+	return compat, err
+}
+
+// FrameworkUploads counts the files uploaded to public models from start up to
+// end by framework and version, bucketed by granularity (day, week, or month),
+// oldest first.
+func (db *FileDb) FrameworkUploads(granularity, versions string, start, end time.Time) ([]*FrameworkUploads, error) {
+	version := "split_part(F.framework_version, '.', 1) || '.x'"
+	switch versions {
+	case VERSIONS_FULL:
+		version = "F.framework_version"
+	case VERSIONS_NONE:
+		version = "''"
+	}
+	sql := `
+  SELECT
+    date_trunc($1, F.created_time AT TIME ZONE 'UTC') AT TIME ZONE 'UTC' AS t,
+    F.framework AS framework,
+    ` + version + ` AS framework_version,
+    COUNT(*) AS uploads
+  FROM file F
+  JOIN model M ON (M.id = F.model_id)
+  WHERE M.visibility = 'public'
+    AND F.status IN ('latest', 'old')
+    AND F.created_time >= $2 AND F.created_time < $3
+  GROUP BY t, F.framework, ` + version + `
+  ORDER BY t ASC, uploads DESC, framework ASC, framework_version ASC
+  `
+	var uploads []*FrameworkUploads
+	err := db.Api.reader(db.DB).SQL(sql, granularity, start, end).QueryStructs(&uploads)
+	if uploads == nil {
+		uploads = []*FrameworkUploads{}
+	}
+	return uploads, err
+}
+
+// SearchMetadata finds committed files across all of a user's models whose
+// metadata satisfies every predicate.  Equality checks are expressed as JSONB
+// containment so they can use the GIN index on file.metadata.
+func (db *FileDb) SearchMetadata(userId string, includePrivate bool, preds []*MetadataPredicate, limit int) ([]*File, error) {
+	conds := []string{"M.user_id = $1", "F.status IN ('latest', 'old')"}
+	args := []interface{}{userId}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if !includePrivate {
+		conds = append(conds, "M.visibility = 'public'")
+	}
+
+	for _, pred := range preds {
+		switch pred.Op {
+		case "=", "!=":
+			encoded, err := json.Marshal(map[string]interface{}{pred.Key: pred.Value})
+			if err != nil {
+				return nil, err
+			}
+			cond := "F.metadata @> " + arg(string(encoded)) + "::JSONB"
+			if pred.Op == "!=" {
+				cond = "NOT (" + cond + ")"
+			}
+			conds = append(conds, cond)
+		case ">", ">=", "<", "<=":
+			key := arg(pred.Key)
+			conds = append(conds, fmt.Sprintf(
+				"jsonb_typeof(F.metadata -> %s) = 'number' AND "+
+					"(F.metadata ->> %s)::FLOAT8 %s %s",
+				key, key, pred.Op, arg(pred.Value)))
+		default:
+			return nil, fmt.Errorf("Unknown metadata operator %s", pred.Op)
+		}
+	}
+
+	sql := `
+	SELECT F.*
+	FROM file F
+	INNER JOIN model M ON (M.id = F.model_id)
+	WHERE ` + strings.Join(conds, " AND ") + `
+	ORDER BY F.created_time DESC
+	LIMIT ` + arg(limit)
+
+	var files []*File
+	err := db.Api.reader(db.DB).SQL(sql, args...).QueryStructs(&files)
+	if files == nil {
+		files = []*File{}
+	}
+	for _, f := range files {
+		if err = f.FillMetadata(); err != nil {
+			return nil, err
+		}
+	}
+	return files, err
+}
+
+// BySha256 finds committed files whose contents hash to sha256, across every
+// public model plus any private models owned by viewerId (which may be empty).
+func (db *FileDb) BySha256(sha256, viewerId string, limit int) ([]*File, error) {
+	var files []*File
+	err := db.Api.reader(db.DB).SQL(`
+	SELECT F.*
+	FROM file F
+	INNER JOIN model M ON (M.id = F.model_id)
+	WHERE F.sha256 = $1
+	  AND F.status IN ('latest', 'old')
+	  AND (M.visibility = 'public' OR M.user_id::TEXT = $2)
+	ORDER BY F.created_time ASC
+	LIMIT $3
+	`, sha256, viewerId, limit).QueryStructs(&files)
+	if files == nil {
+		files = []*File{}
+	}
+	for _, f := range files {
+		if err = f.FillMetadata(); err != nil {
+			return nil, err
+		}
+	}
+	return files, err
+}
@@ -0,0 +1,177 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/ericflo/gradientzoo/inspect"
+	"github.com/pborman/uuid"
+	runner "gopkg.in/mgutz/dat.v1/sqlx-runner"
+)
+
+const FILE_DIFF_TABLE = "file_diff"
+
+const (
+	DIFF_PENDING     = "pending"
+	DIFF_DONE        = "done"
+	DIFF_UNSUPPORTED = "unsupported"
+	DIFF_FAILED      = "failed"
+)
+
+type FileDiffDb struct {
+	DB  *runner.DB
+	Api *ApiCollection
+}
+
+//go:generate counterfeiter $GOFILE FileDiffApi
+type FileDiffApi interface {
+	ById(id interface{}) (*FileDiff, error)
+	Delete(id interface{}) error
+	Save(*FileDiff) error
+	Truncate() error
+
+	ByFileIds(oldFileId, newFileId string) (*FileDiff, error)
+}
+
+func NewFileDiffDb(db *runner.DB, api *ApiCollection) *FileDiffDb {
+	return &FileDiffDb{
+		DB:  db,
+		Api: api,
+	}
+}
+
+// FileDiff is the result of comparing the weights in two versions of a file:
+// how far each layer moved from the old version to the new one.
+type FileDiff struct {
+	Id          string        `db:"id" json:"id"`
+	OldFileId   string        `db:"old_file_id" json:"old_file_id"`
+	NewFileId   string        `db:"new_file_id" json:"new_file_id"`
+	Status      string        `db:"status" json:"status"`
+	Format      string        `db:"format" json:"format"`
+	DiffString  string        `db:"diff" json:"-"`
+	Diff        *inspect.Diff `db:"-" json:"diff"`
+	Error       string        `db:"error" json:"error,omitempty"`
+	CreatedTime time.Time     `db:"created_time" json:"created_time"`
+	UpdatedTime time.Time     `db:"updated_time" json:"updated_time"`
+}
+
+func NewFileDiff(oldFileId, newFileId string) *FileDiff {
+	now := time.Now().UTC()
+	return &FileDiff{
+		Id:          uuid.NewUUID().String(),
+		OldFileId:   oldFileId,
+		NewFileId:   newFileId,
+		Status:      DIFF_PENDING,
+		DiffString:  "{}",
+		CreatedTime: now,
+		UpdatedTime: now,
+	}
+}
+
+// SetDiff records a successful comparison.
+func (fd *FileDiff) SetDiff(d *inspect.Diff) error {
+	encoded, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	fd.Status = DIFF_DONE
+	fd.Format = d.Format
+	fd.Diff = d
+	fd.DiffString = string(encoded)
+	fd.Error = ""
+	fd.UpdatedTime = time.Now().UTC()
+	return nil
+}
+
+func (fd *FileDiff) FillDiff() error {
+	if fd.Status != DIFF_DONE || fd.DiffString == "" {
+		fd.Diff = nil
+		return nil
+	}
+	var d inspect.Diff
+	if err := json.Unmarshal([]byte(fd.DiffString), &d); err != nil {
+		return err
+	}
+	fd.Diff = &d
+	return nil
+}
+
+func (db *FileDiffDb) ById(id interface{}) (*FileDiff, error) {
+	var fd FileDiff
+	err := db.DB.
+		Select("*").
+		From(FILE_DIFF_TABLE).
+		Where("id = $1", id).
+		QueryStruct(&fd)
+	if err == sql.ErrNoRows {
+		return nil, err
+	}
+	if err = fd.FillDiff(); err != nil {
+		return nil, err
+	}
+	return &fd, err
+}
+
+func (db *FileDiffDb) Delete(id interface{}) error {
+	_, err := db.DB.
+		DeleteFrom(FILE_DIFF_TABLE).
+		Where("id = $1", id).
+		Exec()
+	return err
+}
+
+func (db *FileDiffDb) Save(fd *FileDiff) error {
+	cols := []string{
+		"id",
+		"old_file_id",
+		"new_file_id",
+		"status",
+		"format",
+		"diff",
+		"error",
+		"created_time",
+		"updated_time",
+	}
+	vals := []interface{}{
+		fd.Id,
+		fd.OldFileId,
+		fd.NewFileId,
+		fd.Status,
+		fd.Format,
+		fd.DiffString,
+		fd.Error,
+		fd.CreatedTime,
+		fd.UpdatedTime,
+	}
+	_, err := db.DB.
+		Upsert(FILE_DIFF_TABLE).
+		Columns(cols...).
+		Values(vals...).
+		Where("id = $1", fd.Id).
+		Exec()
+	return err
+}
+
+func (db *FileDiffDb) Truncate() error {
+	_, err := db.DB.DeleteFrom(FILE_DIFF_TABLE).Exec()
+	return err
+}
+
+// -
+
+func (db *FileDiffDb) ByFileIds(oldFileId, newFileId string) (*FileDiff, error) {
+	var fd FileDiff
+	err := db.DB.
+		Select("*").
+		From(FILE_DIFF_TABLE).
+		Where("old_file_id = $1 AND new_file_id = $2", oldFileId, newFileId).
+		QueryStruct(&fd)
+	if err == sql.ErrNoRows {
+		return nil, err
+	}
+	if err = fd.FillDiff(); err != nil {
+		return nil, err
+	}
+	return &fd, err
+}
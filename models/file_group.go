@@ -0,0 +1,250 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/pborman/uuid"
+	runner "gopkg.in/mgutz/dat.v1/sqlx-runner"
+)
+
+const FILE_GROUP_TABLE = "file_group"
+
+type FileGroupDb struct {
+	DB  *runner.DB
+	Api *ApiCollection
+}
+
+//go:generate counterfeiter $GOFILE FileGroupApi
+type FileGroupApi interface {
+	ById(id interface{}) (*FileGroup, error)
+	Delete(id interface{}) error
+	Save(*FileGroup) error
+	Truncate() error
+
+	ByModelId(modelId string) ([]*FileGroup, error)
+	ByModelIdName(modelId, name string) (*FileGroup, error)
+	ByModelIdFilename(modelId, filename string) (*FileGroup, error)
+	RenameFilename(modelId, filename, newFilename string) error
+	RemoveFilename(modelId, filename string) error
+}
+
+func NewFileGroupDb(db *runner.DB, api *ApiCollection) *FileGroupDb {
+	return &FileGroupDb{
+		DB:  db,
+		Api: api,
+	}
+}
+
+// FileGroup ties together filenames whose versions only make sense as a set,
+// like weights, optimizer state, and a tokenizer.  Uploads to a grouped
+// filename stay pending until every filename in the group has a pending
+// version, and then they're all promoted to latest at once.  Retention counts
+// these sets rather than individual versions, so old sets are pruned whole.
+// Keep overrides the model-level keep count, and zero means use the model's.
+type FileGroup struct {
+	Id              string    `db:"id" json:"id"`
+	ModelId         string    `db:"model_id" json:"model_id"`
+	Name            string    `db:"name" json:"name"`
+	FilenamesString string    `db:"filenames" json:"-"`
+	Filenames       []string  `db:"-" json:"filenames"`
+	Keep            int       `db:"keep" json:"keep"`
+	CreatedTime     time.Time `db:"created_time" json:"created_time"`
+}
+
+func NewFileGroup(modelId, name string, filenames []string, keep int) (*FileGroup, error) {
+	g := &FileGroup{
+		Id:          uuid.NewUUID().String(),
+		ModelId:     modelId,
+		Name:        name,
+		Keep:        keep,
+		CreatedTime: time.Now().UTC(),
+	}
+	if err := g.SetFilenames(filenames); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+func (g *FileGroup) SetFilenames(filenames []string) error {
+	encoded, err := json.Marshal(filenames)
+	if err != nil {
+		return err
+	}
+	g.Filenames = filenames
+	g.FilenamesString = string(encoded)
+	return nil
+}
+
+func (g *FileGroup) FillFilenames() error {
+	g.Filenames = []string{}
+	if g.FilenamesString == "" {
+		return nil
+	}
+	return json.Unmarshal([]byte(g.FilenamesString), &g.Filenames)
+}
+
+func (db *FileGroupDb) ById(id interface{}) (*FileGroup, error) {
+	var g FileGroup
+	err := db.DB.
+		Select("*").
+		From(FILE_GROUP_TABLE).
+		Where("id = $1", id).
+		QueryStruct(&g)
+	if err == sql.ErrNoRows {
+		return nil, err
+	}
+	if err = g.FillFilenames(); err != nil {
+		return nil, err
+	}
+	return &g, err
+}
+
+func (db *FileGroupDb) Delete(id interface{}) error {
+	_, err := db.DB.
+		DeleteFrom(FILE_GROUP_TABLE).
+		Where("id = $1", id).
+		Exec()
+	return err
+}
+
+func (db *FileGroupDb) Save(g *FileGroup) error {
+	cols := []string{
+		"id",
+		"model_id",
+		"name",
+		"filenames",
+		"keep",
+		"created_time",
+	}
+	vals := []interface{}{
+		g.Id,
+		g.ModelId,
+		g.Name,
+		g.FilenamesString,
+		g.Keep,
+		g.CreatedTime,
+	}
+	_, err := db.DB.
+		Upsert(FILE_GROUP_TABLE).
+		Columns(cols...).
+		Values(vals...).
+		Where("id = $1", g.Id).
+		Exec()
+	return err
+}
+
+func (db *FileGroupDb) Truncate() error {
+	_, err := db.DB.DeleteFrom(FILE_GROUP_TABLE).Exec()
+	return err
+}
+
+// -
+
+func (db *FileGroupDb) ByModelId(modelId string) ([]*FileGroup, error) {
+	var groups []*FileGroup
+	err := db.DB.
+		Select("*").
+		From(FILE_GROUP_TABLE).
+		Where("model_id = $1", modelId).
+		OrderBy("name ASC").
+		QueryStructs(&groups)
+	if groups == nil {
+		groups = []*FileGroup{}
+	}
+	for _, g := range groups {
+		if err = g.FillFilenames(); err != nil {
+			return nil, err
+		}
+	}
+	return groups, err
+}
+
+func (db *FileGroupDb) ByModelIdName(modelId, name string) (*FileGroup, error) {
+	var g FileGroup
+	err := db.DB.
+		Select("*").
+		From(FILE_GROUP_TABLE).
+		Where("model_id = $1 AND name = $2", modelId, name).
+		QueryStruct(&g)
+	if err == sql.ErrNoRows {
+		return nil, err
+	}
+	if err = g.FillFilenames(); err != nil {
+		return nil, err
+	}
+	return &g, err
+}
+
+// ByModelIdFilename finds the group that a filename belongs to, if any.  A
+// filename can only be in one group per model.
+func (db *FileGroupDb) ByModelIdFilename(modelId, filename string) (*FileGroup, error) {
+	encoded, err := json.Marshal([]string{filename})
+	if err != nil {
+		return nil, err
+	}
+	var g FileGroup
+	err = db.DB.
+		Select("*").
+		From(FILE_GROUP_TABLE).
+		Where("model_id = $1 AND filenames @> $2::JSONB", modelId, string(encoded)).
+		Limit(1).
+		QueryStruct(&g)
+	if err == sql.ErrNoRows {
+		return nil, err
+	}
+	if err = g.FillFilenames(); err != nil {
+		return nil, err
+	}
+	return &g, err
+}
+
+// RenameFilename keeps a group's membership up to date when one of its files
+// is renamed.
+func (db *FileGroupDb) RenameFilename(modelId, filename, newFilename string) error {
+	g, err := db.ByModelIdFilename(modelId, filename)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	filenames := make([]string, 0, len(g.Filenames))
+	for _, fn := range g.Filenames {
+		if fn == filename {
+			fn = newFilename
+		}
+		filenames = append(filenames, fn)
+	}
+	if err = g.SetFilenames(filenames); err != nil {
+		return err
+	}
+	return db.Save(g)
+}
+
+// RemoveFilename takes a filename out of its group, so that a deleted file
+// doesn't hold back every future commit of the rest of the group.  A group
+// left with no filenames is deleted.
+func (db *FileGroupDb) RemoveFilename(modelId, filename string) error {
+	g, err := db.ByModelIdFilename(modelId, filename)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	filenames := make([]string, 0, len(g.Filenames))
+	for _, fn := range g.Filenames {
+		if fn != filename {
+			filenames = append(filenames, fn)
+		}
+	}
+	if len(filenames) == 0 {
+		return db.Delete(g.Id)
+	}
+	if err = g.SetFilenames(filenames); err != nil {
+		return err
+	}
+	return db.Save(g)
+}
@@ -0,0 +1,235 @@
+package models
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pborman/uuid"
+	runner "gopkg.in/mgutz/dat.v1/sqlx-runner"
+)
+
+const FILE_LOG_TABLE = "file_log"
+
+// The first entry in every model's log points back at this hash
+var FILE_LOG_GENESIS_HASH = strings.Repeat("0", 64)
+
+type FileLogDb struct {
+	DB  *runner.DB
+	Api *ApiCollection
+}
+
+//go:generate counterfeiter $GOFILE FileLogApi
+type FileLogApi interface {
+	ById(id interface{}) (*FileLogEntry, error)
+	Truncate() error
+
+	ByModelId(modelId string) ([]*FileLogEntry, error)
+	ByModelIdFilename(modelId, filename string) ([]*FileLogEntry, error)
+	Append(f *File) (*FileLogEntry, error)
+}
+
+func NewFileLogDb(db *runner.DB, api *ApiCollection) *FileLogDb {
+	return &FileLogDb{
+		DB:  db,
+		Api: api,
+	}
+}
+
+// FileLogEntry records a single committed file version in its model's
+// append-only log.  Each entry's hash covers its own contents and the hash of
+// the entry before it, so rewriting or removing any entry breaks the chain
+// from that point on.
+type FileLogEntry struct {
+	Id          string    `db:"id" json:"id"`
+	ModelId     string    `db:"model_id" json:"model_id"`
+	Seq         int64     `db:"seq" json:"seq"`
+	FileId      string    `db:"file_id" json:"file_id"`
+	Filename    string    `db:"filename" json:"filename"`
+	Framework   string    `db:"framework" json:"framework"`
+	SizeBytes   int64     `db:"size_bytes" json:"size_bytes"`
+	Sha256      string    `db:"sha256" json:"sha256"`
+	PrevHash    string    `db:"prev_hash" json:"prev_hash"`
+	Hash        string    `db:"hash" json:"hash"`
+	CreatedTime time.Time `db:"created_time" json:"created_time"`
+}
+
+// ComputeHash works out what the entry's hash should be from its contents.
+// Clients can recompute this themselves to verify the log independently.
+func (e *FileLogEntry) ComputeHash() string {
+	content := strings.Join([]string{
+		e.PrevHash,
+		fmt.Sprint(e.Seq),
+		e.ModelId,
+		e.FileId,
+		e.Filename,
+		e.Framework,
+		fmt.Sprint(e.SizeBytes),
+		e.Sha256,
+		e.CreatedTime.UTC().Format(time.RFC3339Nano),
+	}, "\n")
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(content)))
+}
+
+// VerifyFileLog checks that entries, ordered by seq, form an unbroken chain.
+// If they don't, the seq of the first bad entry is returned along with an
+// error describing what's wrong with it.
+func VerifyFileLog(entries []*FileLogEntry) (int64, error) {
+	prevHash := FILE_LOG_GENESIS_HASH
+	for i, e := range entries {
+		if e.Seq != int64(i+1) {
+			return e.Seq, fmt.Errorf("Entry %d is out of sequence", e.Seq)
+		}
+		if e.PrevHash != prevHash {
+			return e.Seq, fmt.Errorf("Entry %d does not follow the entry before it", e.Seq)
+		}
+		if e.ComputeHash() != e.Hash {
+			return e.Seq, fmt.Errorf("Entry %d does not match its hash", e.Seq)
+		}
+		prevHash = e.Hash
+	}
+	return 0, nil
+}
+
+func (db *FileLogDb) ById(id interface{}) (*FileLogEntry, error) {
+	var e FileLogEntry
+	err := db.DB.
+		Select("*").
+		From(FILE_LOG_TABLE).
+		Where("id = $1", id).
+		QueryStruct(&e)
+	if err == sql.ErrNoRows {
+		return nil, err
+	}
+	return &e, err
+}
+
+func (db *FileLogDb) Truncate() error {
+	_, err := db.DB.DeleteFrom(FILE_LOG_TABLE).Exec()
+	return err
+}
+
+// -
+
+func (db *FileLogDb) ByModelId(modelId string) ([]*FileLogEntry, error) {
+	var entries []*FileLogEntry
+	err := db.DB.
+		Select("*").
+		From(FILE_LOG_TABLE).
+		Where("model_id = $1", modelId).
+		OrderBy("seq ASC").
+		QueryStructs(&entries)
+	if entries == nil {
+		entries = []*FileLogEntry{}
+	}
+	return entries, err
+}
+
+// ByModelIdFilename returns every version of a filename that was ever
+// committed, oldest first, including versions that have since been pruned.
+func (db *FileLogDb) ByModelIdFilename(modelId, filename string) ([]*FileLogEntry, error) {
+	var entries []*FileLogEntry
+	err := db.DB.
+		Select("*").
+		From(FILE_LOG_TABLE).
+		Where("model_id = $1 AND filename = $2", modelId, filename).
+		OrderBy("seq ASC").
+		QueryStructs(&entries)
+	if entries == nil {
+		entries = []*FileLogEntry{}
+	}
+	return entries, err
+}
+
+// Append adds a newly committed file to the end of its model's log.  The
+// model's row is locked while doing so, so that concurrent uploads can't both
+// claim the same place in the chain.
+func (db *FileLogDb) Append(f *File) (*FileLogEntry, error) {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.AutoRollback()
+
+	var modelId string
+	err = tx.
+		SQL("SELECT id FROM model WHERE id = $1 FOR UPDATE", f.ModelId).
+		QueryScalar(&modelId)
+	if err != nil {
+		return nil, err
+	}
+
+	// Postgres only keeps microseconds, and the hash has to match what's read
+	// back out, so the created time is truncated to match
+	e := &FileLogEntry{
+		Id:          uuid.NewUUID().String(),
+		ModelId:     f.ModelId,
+		Seq:         1,
+		FileId:      f.Id,
+		Filename:    f.Filename,
+		Framework:   f.Framework,
+		SizeBytes:   int64(f.SizeBytes),
+		Sha256:      f.Sha256,
+		PrevHash:    FILE_LOG_GENESIS_HASH,
+		CreatedTime: time.Now().UTC().Truncate(time.Microsecond),
+	}
+
+	var prev FileLogEntry
+	err = tx.
+		Select("*").
+		From(FILE_LOG_TABLE).
+		Where("model_id = $1", f.ModelId).
+		OrderBy("seq DESC").
+		Limit(1).
+		QueryStruct(&prev)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	if err == nil {
+		e.Seq = prev.Seq + 1
+		e.PrevHash = prev.Hash
+	}
+	e.Hash = e.ComputeHash()
+
+	cols := []string{
+		"id",
+		"model_id",
+		"seq",
+		"file_id",
+		"filename",
+		"framework",
+		"size_bytes",
+		"sha256",
+		"prev_hash",
+		"hash",
+		"created_time",
+	}
+	vals := []interface{}{
+		e.Id,
+		e.ModelId,
+		e.Seq,
+		e.FileId,
+		e.Filename,
+		e.Framework,
+		e.SizeBytes,
+		e.Sha256,
+		e.PrevHash,
+		e.Hash,
+		e.CreatedTime,
+	}
+	_, err = tx.
+		InsertInto(FILE_LOG_TABLE).
+		Columns(cols...).
+		Values(vals...).
+		Exec()
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
@@ -0,0 +1,126 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	runner "gopkg.in/mgutz/dat.v1/sqlx-runner"
+)
+
+const FILE_METADATA_REVISION_TABLE = "file_metadata_revision"
+
+type FileMetadataRevisionDb struct {
+	DB  *runner.DB
+	Api *ApiCollection
+}
+
+//go:generate counterfeiter $GOFILE FileMetadataRevisionApi
+type FileMetadataRevisionApi interface {
+	ById(id interface{}) (*FileMetadataRevision, error)
+	Truncate() error
+
+	ByFileId(fileId string) ([]*FileMetadataRevision, error)
+}
+
+func NewFileMetadataRevisionDb(db *runner.DB, api *ApiCollection) *FileMetadataRevisionDb {
+	return &FileMetadataRevisionDb{
+		DB:  db,
+		Api: api,
+	}
+}
+
+// FileMetadataRevision records one change to a file's metadata after it was
+// uploaded: who made it, the patch they sent, and the metadata before and
+// after it was applied.  Revisions are numbered from 1 for each file.
+type FileMetadataRevision struct {
+	Id                     string                 `db:"id" json:"id"`
+	FileId                 string                 `db:"file_id" json:"file_id"`
+	UserId                 string                 `db:"user_id" json:"user_id"`
+	Revision               int                    `db:"revision" json:"revision"`
+	PatchString            string                 `db:"patch" json:"-"`
+	Patch                  map[string]interface{} `db:"-" json:"patch"`
+	PreviousMetadataString string                 `db:"previous_metadata" json:"-"`
+	PreviousMetadata       map[string]interface{} `db:"-" json:"previous_metadata"`
+	MetadataString         string                 `db:"metadata" json:"-"`
+	Metadata               map[string]interface{} `db:"-" json:"metadata"`
+	CreatedTime            time.Time              `db:"created_time" json:"created_time"`
+}
+
+func (r *FileMetadataRevision) FillMetadata() error {
+	if err := json.Unmarshal([]byte(r.PatchString), &r.Patch); err != nil {
+		return err
+	}
+	if err := json.Unmarshal([]byte(r.PreviousMetadataString), &r.PreviousMetadata); err != nil {
+		return err
+	}
+	if err := json.Unmarshal([]byte(r.MetadataString), &r.Metadata); err != nil {
+		return err
+	}
+	return nil
+}
+
+// MergeMetadata applies patch to metadata using JSON merge patch semantics
+// (RFC 7386): null values remove keys, objects are merged recursively, and
+// anything else replaces what was there.  Neither argument is modified.
+func MergeMetadata(metadata, patch map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{}, len(metadata)+len(patch))
+	for k, v := range metadata {
+		merged[k] = v
+	}
+	for k, v := range patch {
+		if v == nil {
+			delete(merged, k)
+			continue
+		}
+		if patchObj, ok := v.(map[string]interface{}); ok {
+			existing, _ := merged[k].(map[string]interface{})
+			merged[k] = MergeMetadata(existing, patchObj)
+			continue
+		}
+		merged[k] = v
+	}
+	return merged
+}
+
+func (db *FileMetadataRevisionDb) ById(id interface{}) (*FileMetadataRevision, error) {
+	var r FileMetadataRevision
+	err := db.DB.
+		Select("*").
+		From(FILE_METADATA_REVISION_TABLE).
+		Where("id = $1", id).
+		QueryStruct(&r)
+	if err == sql.ErrNoRows {
+		return nil, err
+	}
+	if err = r.FillMetadata(); err != nil {
+		return nil, err
+	}
+	return &r, err
+}
+
+func (db *FileMetadataRevisionDb) Truncate() error {
+	_, err := db.DB.DeleteFrom(FILE_METADATA_REVISION_TABLE).Exec()
+	return err
+}
+
+// -
+
+func (db *FileMetadataRevisionDb) ByFileId(fileId string) ([]*FileMetadataRevision, error) {
+	var revisions []*FileMetadataRevision
+	err := db.DB.
+		Select("*").
+		From(FILE_METADATA_REVISION_TABLE).
+		Where("file_id = $1", fileId).
+		OrderBy("revision ASC").
+		QueryStructs(&revisions)
+	if revisions == nil {
+		revisions = []*FileMetadataRevision{}
+	}
+	for _, r := range revisions {
+		if err = r.FillMetadata(); err != nil {
+			return nil, err
+		}
+	}
+	return revisions, err
+}
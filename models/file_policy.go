@@ -0,0 +1,227 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/pborman/uuid"
+	"gopkg.in/guregu/null.v3"
+	runner "gopkg.in/mgutz/dat.v1/sqlx-runner"
+)
+
+const FILE_POLICY_TABLE = "file_policy"
+
+type FilePolicyDb struct {
+	DB  *runner.DB
+	Api *ApiCollection
+}
+
+//go:generate counterfeiter $GOFILE FilePolicyApi
+type FilePolicyApi interface {
+	ById(id interface{}) (*FilePolicy, error)
+	Delete(id interface{}) error
+	Save(*FilePolicy) error
+	Truncate() error
+
+	ByModelId(modelId string) ([]*FilePolicy, error)
+	ByModelIdFilename(modelId, filename string) (*FilePolicy, error)
+	Rename(modelId, filename, newFilename string) error
+	UpdateBest(modelId, filename string) (*FilePolicy, error)
+}
+
+func NewFilePolicyDb(db *runner.DB, api *ApiCollection) *FilePolicyDb {
+	return &FilePolicyDb{
+		DB:  db,
+		Api: api,
+	}
+}
+
+const (
+	METRIC_MINIMIZE = "minimize"
+	METRIC_MAXIMIZE = "maximize"
+)
+
+// FilePolicy holds per-filename settings.  Keep overrides the model-level keep
+// count (zero means use the model's), so that e.g. weights can keep a long
+// history while optimizer state keeps only the last couple of versions.  When
+// MetricKey is set, BestFileId tracks the version whose metadata has the best
+// value for that key.  When SizeAlertPercent is set, uploads whose size
+// differs from the previous version's by more than that percentage trigger an
+// alert to SizeAlertWebhook and/or the owner's e-mail.
+type FilePolicy struct {
+	Id               string      `db:"id" json:"id"`
+	ModelId          string      `db:"model_id" json:"model_id"`
+	Filename         string      `db:"filename" json:"filename"`
+	Keep             int         `db:"keep" json:"keep"`
+	MetricKey        string      `db:"metric_key" json:"metric_key"`
+	MetricDirection  string      `db:"metric_direction" json:"metric_direction"`
+	BestFileId       null.String `db:"best_file_id" json:"best_file_id"`
+	SizeAlertPercent int         `db:"size_alert_percent" json:"size_alert_percent"`
+	SizeAlertWebhook string      `db:"size_alert_webhook" json:"size_alert_webhook"`
+	SizeAlertEmail   bool        `db:"size_alert_email" json:"size_alert_email"`
+	CreatedTime      time.Time   `db:"created_time" json:"created_time"`
+}
+
+func NewFilePolicy(modelId, filename string, keep int) *FilePolicy {
+	return &FilePolicy{
+		Id:          uuid.NewUUID().String(),
+		ModelId:     modelId,
+		Filename:    filename,
+		Keep:        keep,
+		CreatedTime: time.Now().UTC(),
+	}
+}
+
+func ValidMetricDirection(direction string) bool {
+	return direction == METRIC_MINIMIZE || direction == METRIC_MAXIMIZE
+}
+
+func (db *FilePolicyDb) ById(id interface{}) (*FilePolicy, error) {
+	var policy FilePolicy
+	err := db.DB.
+		Select("*").
+		From(FILE_POLICY_TABLE).
+		Where("id = $1", id).
+		QueryStruct(&policy)
+	if err == sql.ErrNoRows {
+		return nil, err
+	}
+	return &policy, err
+}
+
+func (db *FilePolicyDb) Delete(id interface{}) error {
+	_, err := db.DB.
+		DeleteFrom(FILE_POLICY_TABLE).
+		Where("id = $1", id).
+		Exec()
+	return err
+}
+
+func (db *FilePolicyDb) Save(policy *FilePolicy) error {
+	cols := []string{
+		"id",
+		"model_id",
+		"filename",
+		"keep",
+		"metric_key",
+		"metric_direction",
+		"best_file_id",
+		"size_alert_percent",
+		"size_alert_webhook",
+		"size_alert_email",
+		"created_time",
+	}
+	vals := []interface{}{
+		policy.Id,
+		policy.ModelId,
+		policy.Filename,
+		policy.Keep,
+		policy.MetricKey,
+		policy.MetricDirection,
+		policy.BestFileId,
+		policy.SizeAlertPercent,
+		policy.SizeAlertWebhook,
+		policy.SizeAlertEmail,
+		policy.CreatedTime,
+	}
+	_, err := db.DB.
+		Upsert(FILE_POLICY_TABLE).
+		Columns(cols...).
+		Values(vals...).
+		Where("id = $1", policy.Id).
+		Exec()
+	return err
+}
+
+func (db *FilePolicyDb) Truncate() error {
+	_, err := db.DB.DeleteFrom(FILE_POLICY_TABLE).Exec()
+	return err
+}
+
+// -
+
+func (db *FilePolicyDb) ByModelId(modelId string) ([]*FilePolicy, error) {
+	var policies []*FilePolicy
+	err := db.DB.
+		Select("*").
+		From(FILE_POLICY_TABLE).
+		Where("model_id = $1", modelId).
+		OrderBy("filename ASC").
+		QueryStructs(&policies)
+	if policies == nil {
+		policies = []*FilePolicy{}
+	}
+	return policies, err
+}
+
+func (db *FilePolicyDb) ByModelIdFilename(modelId, filename string) (*FilePolicy, error) {
+	var policy FilePolicy
+	err := db.DB.
+		Select("*").
+		From(FILE_POLICY_TABLE).
+		Where("model_id = $1 AND filename = $2", modelId, filename).
+		QueryStruct(&policy)
+	if err == sql.ErrNoRows {
+		return nil, err
+	}
+	return &policy, err
+}
+
+func (db *FilePolicyDb) Rename(modelId, filename, newFilename string) error {
+	_, err := db.DB.
+		Update(FILE_POLICY_TABLE).
+		Set("filename", newFilename).
+		Where("model_id = $1 AND filename = $2", modelId, filename).
+		Exec()
+	return err
+}
+
+// UpdateBest recomputes which committed version of the file has the best
+// value for the policy's metric and stores it as the "best" alias.  Versions
+// whose metadata lacks a numeric value for the metric are never chosen.
+func (db *FilePolicyDb) UpdateBest(modelId, filename string) (*FilePolicy, error) {
+	policy, err := db.ByModelIdFilename(modelId, filename)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if policy.MetricKey == "" || !ValidMetricDirection(policy.MetricDirection) {
+		return policy, nil
+	}
+
+	order := "ASC"
+	if policy.MetricDirection == METRIC_MAXIMIZE {
+		order = "DESC"
+	}
+
+	sql := `
+	SELECT id
+	FROM file
+	WHERE model_id = $1 AND
+	      filename = $2 AND
+	      status IN ('latest', 'old') AND
+	      jsonb_typeof(metadata -> $3) = 'number'
+	ORDER BY (metadata ->> $3)::FLOAT8 ` + order + `, created_time DESC
+	LIMIT 1
+	`
+	var bestIds []string
+	err = db.DB.SQL(sql, modelId, filename, policy.MetricKey).QuerySlice(&bestIds)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(bestIds) == 0 {
+		policy.BestFileId = null.String{}
+	} else {
+		policy.BestFileId = null.StringFrom(bestIds[0])
+	}
+
+	_, err = db.DB.
+		Update(FILE_POLICY_TABLE).
+		Set("best_file_id", policy.BestFileId).
+		Where("id = $1", policy.Id).
+		Exec()
+	return policy, err
+}
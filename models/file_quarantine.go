@@ -0,0 +1,304 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/pborman/uuid"
+	"gopkg.in/guregu/null.v3"
+	runner "gopkg.in/mgutz/dat.v1/sqlx-runner"
+)
+
+const FILE_QUARANTINE_TABLE = "file_quarantine"
+const FILE_QUARANTINE_EVENT_TABLE = "file_quarantine_event"
+
+const (
+	QUARANTINE_REASON_DMCA    = "dmca"
+	QUARANTINE_REASON_MALWARE = "malware"
+	QUARANTINE_REASON_LICENSE = "license"
+	QUARANTINE_REASON_OTHER   = "other"
+)
+
+const (
+	QUARANTINE_QUARANTINED = "quarantined"
+	QUARANTINE_APPEALED    = "appealed"
+	QUARANTINE_RESTORED    = "restored"
+)
+
+const (
+	QUARANTINE_ACTION_QUARANTINE  = "quarantine"
+	QUARANTINE_ACTION_APPEAL      = "appeal"
+	QUARANTINE_ACTION_DENY_APPEAL = "deny_appeal"
+	QUARANTINE_ACTION_RESTORE     = "restore"
+)
+
+type FileQuarantineDb struct {
+	DB  *runner.DB
+	Api *ApiCollection
+}
+
+//go:generate counterfeiter $GOFILE FileQuarantineApi
+type FileQuarantineApi interface {
+	ById(id interface{}) (*FileQuarantine, error)
+	Truncate() error
+
+	ByFileId(fileId string) ([]*FileQuarantine, error)
+	ActiveByFileId(fileId string) (*FileQuarantine, error)
+	ActiveByFileIds(fileIds []string) (map[string]*FileQuarantine, error)
+	ByStatus(status string, limit int) ([]*FileQuarantine, error)
+	Events(quarantineId string) ([]*FileQuarantineEvent, error)
+	EventsByQuarantineIds(quarantineIds []string) (map[string][]*FileQuarantineEvent, error)
+	Record(q *FileQuarantine, userId, action, note string) (*FileQuarantineEvent, error)
+}
+
+func NewFileQuarantineDb(db *runner.DB, api *ApiCollection) *FileQuarantineDb {
+	return &FileQuarantineDb{
+		DB:  db,
+		Api: api,
+	}
+}
+
+// FileQuarantine takes a file version down, so that nobody (including its
+// owner) can download it while the quarantine is active.  Owners can appeal,
+// and admins either restore the file or deny the appeal.  Every step is
+// recorded as a FileQuarantineEvent.
+type FileQuarantine struct {
+	Id           string      `db:"id" json:"id"`
+	FileId       string      `db:"file_id" json:"file_id"`
+	ModelId      string      `db:"model_id" json:"model_id"`
+	Reason       string      `db:"reason" json:"reason"`
+	Details      string      `db:"details" json:"details"`
+	Status       string      `db:"status" json:"status"`
+	Appeal       string      `db:"appeal" json:"appeal"`
+	CreatedBy    null.String `db:"created_by" json:"-"` // Null once their account is deleted
+	CreatedTime  time.Time   `db:"created_time" json:"created_time"`
+	ResolvedTime null.Time   `db:"resolved_time" json:"resolved_time"`
+}
+
+type FileQuarantineEvent struct {
+	Id           string      `db:"id" json:"id"`
+	QuarantineId string      `db:"quarantine_id" json:"quarantine_id"`
+	UserId       null.String `db:"user_id" json:"-"` // Null once their account is deleted
+	Action       string      `db:"action" json:"action"`
+	Note         string      `db:"note" json:"note"`
+	CreatedTime  time.Time   `db:"created_time" json:"created_time"`
+}
+
+func NewFileQuarantine(f *File, reason, details, createdBy string) *FileQuarantine {
+	return &FileQuarantine{
+		Id:          uuid.NewUUID().String(),
+		FileId:      f.Id,
+		ModelId:     f.ModelId,
+		Reason:      reason,
+		Details:     details,
+		Status:      QUARANTINE_QUARANTINED,
+		CreatedBy:   null.StringFrom(createdBy),
+		CreatedTime: time.Now().UTC(),
+	}
+}
+
+func ValidQuarantineReason(reason string) bool {
+	switch reason {
+	case QUARANTINE_REASON_DMCA, QUARANTINE_REASON_MALWARE,
+		QUARANTINE_REASON_LICENSE, QUARANTINE_REASON_OTHER:
+		return true
+	}
+	return false
+}
+
+func (q *FileQuarantine) Active() bool {
+	return q.Status == QUARANTINE_QUARANTINED || q.Status == QUARANTINE_APPEALED
+}
+
+func (db *FileQuarantineDb) ById(id interface{}) (*FileQuarantine, error) {
+	var q FileQuarantine
+	err := db.DB.
+		Select("*").
+		From(FILE_QUARANTINE_TABLE).
+		Where("id = $1", id).
+		QueryStruct(&q)
+	if err == sql.ErrNoRows {
+		return nil, err
+	}
+	return &q, err
+}
+
+func (db *FileQuarantineDb) Truncate() error {
+	if _, err := db.DB.DeleteFrom(FILE_QUARANTINE_EVENT_TABLE).Exec(); err != nil {
+		return err
+	}
+	_, err := db.DB.DeleteFrom(FILE_QUARANTINE_TABLE).Exec()
+	return err
+}
+
+// -
+
+func (db *FileQuarantineDb) ByFileId(fileId string) ([]*FileQuarantine, error) {
+	var quarantines []*FileQuarantine
+	err := db.DB.
+		Select("*").
+		From(FILE_QUARANTINE_TABLE).
+		Where("file_id = $1", fileId).
+		OrderBy("created_time DESC").
+		QueryStructs(&quarantines)
+	if quarantines == nil {
+		quarantines = []*FileQuarantine{}
+	}
+	return quarantines, err
+}
+
+func (db *FileQuarantineDb) ActiveByFileId(fileId string) (*FileQuarantine, error) {
+	var q FileQuarantine
+	err := db.DB.
+		Select("*").
+		From(FILE_QUARANTINE_TABLE).
+		Where("file_id = $1 AND status IN ($2, $3)",
+			fileId, QUARANTINE_QUARANTINED, QUARANTINE_APPEALED).
+		QueryStruct(&q)
+	if err == sql.ErrNoRows {
+		return nil, err
+	}
+	return &q, err
+}
+
+func (db *FileQuarantineDb) ActiveByFileIds(fileIds []string) (map[string]*FileQuarantine, error) {
+	resp := map[string]*FileQuarantine{}
+	if len(fileIds) == 0 {
+		return resp, nil
+	}
+	var quarantines []*FileQuarantine
+	err := db.DB.
+		Select("*").
+		From(FILE_QUARANTINE_TABLE).
+		Where("file_id IN $1 AND status IN ($2, $3)",
+			fileIds, QUARANTINE_QUARANTINED, QUARANTINE_APPEALED).
+		QueryStructs(&quarantines)
+	if err != nil {
+		return nil, err
+	}
+	for _, q := range quarantines {
+		resp[q.FileId] = q
+	}
+	return resp, nil
+}
+
+// ByStatus lists quarantines in the given status, oldest first, so that
+// admins can work through e.g. pending appeals in order.
+func (db *FileQuarantineDb) ByStatus(status string, limit int) ([]*FileQuarantine, error) {
+	var quarantines []*FileQuarantine
+	err := db.DB.
+		Select("*").
+		From(FILE_QUARANTINE_TABLE).
+		Where("status = $1", status).
+		OrderBy("created_time ASC").
+		Limit(uint64(limit)).
+		QueryStructs(&quarantines)
+	if quarantines == nil {
+		quarantines = []*FileQuarantine{}
+	}
+	return quarantines, err
+}
+
+func (db *FileQuarantineDb) Events(quarantineId string) ([]*FileQuarantineEvent, error) {
+	var events []*FileQuarantineEvent
+	err := db.DB.
+		Select("*").
+		From(FILE_QUARANTINE_EVENT_TABLE).
+		Where("quarantine_id = $1", quarantineId).
+		OrderBy("created_time ASC").
+		QueryStructs(&events)
+	if events == nil {
+		events = []*FileQuarantineEvent{}
+	}
+	return events, err
+}
+
+// EventsByQuarantineIds is Events for many quarantines at once, with every one
+// of them in the map even if it has no events.
+func (db *FileQuarantineDb) EventsByQuarantineIds(quarantineIds []string) (map[string][]*FileQuarantineEvent, error) {
+	byQuarantine := make(map[string][]*FileQuarantineEvent, len(quarantineIds))
+	for _, id := range quarantineIds {
+		byQuarantine[id] = []*FileQuarantineEvent{}
+	}
+	if len(quarantineIds) == 0 {
+		return byQuarantine, nil
+	}
+	var events []*FileQuarantineEvent
+	err := db.DB.
+		Select("*").
+		From(FILE_QUARANTINE_EVENT_TABLE).
+		Where("quarantine_id IN $1", quarantineIds).
+		OrderBy("created_time ASC").
+		QueryStructs(&events)
+	for _, e := range events {
+		byQuarantine[e.QuarantineId] = append(byQuarantine[e.QuarantineId], e)
+	}
+	return byQuarantine, err
+}
+
+// Record saves the quarantine along with an event describing what userId just
+// did to it, in the same transaction, so that there's never a change to a
+// quarantine without a record of who made it.
+func (db *FileQuarantineDb) Record(q *FileQuarantine, userId, action, note string) (*FileQuarantineEvent, error) {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.AutoRollback()
+
+	cols := []string{
+		"id",
+		"file_id",
+		"model_id",
+		"reason",
+		"details",
+		"status",
+		"appeal",
+		"created_by",
+		"created_time",
+		"resolved_time",
+	}
+	vals := []interface{}{
+		q.Id,
+		q.FileId,
+		q.ModelId,
+		q.Reason,
+		q.Details,
+		q.Status,
+		q.Appeal,
+		q.CreatedBy,
+		q.CreatedTime,
+		q.ResolvedTime,
+	}
+	_, err = tx.
+		Upsert(FILE_QUARANTINE_TABLE).
+		Columns(cols...).
+		Values(vals...).
+		Where("id = $1", q.Id).
+		Exec()
+	if err != nil {
+		return nil, err
+	}
+
+	e := &FileQuarantineEvent{
+		Id:           uuid.NewUUID().String(),
+		QuarantineId: q.Id,
+		UserId:       null.StringFrom(userId),
+		Action:       action,
+		Note:         note,
+		CreatedTime:  time.Now().UTC(),
+	}
+	_, err = tx.
+		InsertInto(FILE_QUARANTINE_EVENT_TABLE).
+		Columns("id", "quarantine_id", "user_id", "action", "note", "created_time").
+		Values(e.Id, e.QuarantineId, e.UserId, e.Action, e.Note, e.CreatedTime).
+		Exec()
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
@@ -0,0 +1,129 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/pborman/uuid"
+	runner "gopkg.in/mgutz/dat.v1/sqlx-runner"
+)
+
+const FILE_SHARE_TABLE = "file_share"
+
+type FileShareDb struct {
+	DB  *runner.DB
+	Api *ApiCollection
+}
+
+//go:generate counterfeiter $GOFILE FileShareApi
+type FileShareApi interface {
+	ById(id interface{}) (*FileShare, error)
+	Delete(id interface{}) error
+	Save(*FileShare) error
+	Truncate() error
+
+	ByFileId(fileId string) ([]*FileShare, error)
+}
+
+func NewFileShareDb(db *runner.DB, api *ApiCollection) *FileShareDb {
+	return &FileShareDb{
+		DB:  db,
+		Api: api,
+	}
+}
+
+// FileShare lets anyone who has its id see and download one version of a
+// file, even in a private model, until ExpiresTime.  After that, the version
+// is only available to the model's owner again.  Ids are random, so they're
+// safe to hand out as links.
+type FileShare struct {
+	Id          string    `db:"id" json:"id"`
+	FileId      string    `db:"file_id" json:"file_id"`
+	ModelId     string    `db:"model_id" json:"model_id"`
+	Note        string    `db:"note" json:"note"`
+	ExpiresTime time.Time `db:"expires_time" json:"expires_time"`
+	CreatedTime time.Time `db:"created_time" json:"created_time"`
+}
+
+func NewFileShare(fileId, modelId, note string, expiresTime time.Time) *FileShare {
+	return &FileShare{
+		Id:          uuid.NewRandom().String(),
+		FileId:      fileId,
+		ModelId:     modelId,
+		Note:        note,
+		ExpiresTime: expiresTime.UTC(),
+		CreatedTime: time.Now().UTC(),
+	}
+}
+
+func (s *FileShare) Expired() bool {
+	return !time.Now().Before(s.ExpiresTime)
+}
+
+func (db *FileShareDb) ById(id interface{}) (*FileShare, error) {
+	var s FileShare
+	err := db.DB.
+		Select("*").
+		From(FILE_SHARE_TABLE).
+		Where("id = $1", id).
+		QueryStruct(&s)
+	if err == sql.ErrNoRows {
+		return nil, err
+	}
+	return &s, err
+}
+
+func (db *FileShareDb) Delete(id interface{}) error {
+	_, err := db.DB.
+		DeleteFrom(FILE_SHARE_TABLE).
+		Where("id = $1", id).
+		Exec()
+	return err
+}
+
+func (db *FileShareDb) Save(s *FileShare) error {
+	cols := []string{
+		"id",
+		"file_id",
+		"model_id",
+		"note",
+		"expires_time",
+		"created_time",
+	}
+	vals := []interface{}{
+		s.Id,
+		s.FileId,
+		s.ModelId,
+		s.Note,
+		s.ExpiresTime,
+		s.CreatedTime,
+	}
+	_, err := db.DB.
+		Upsert(FILE_SHARE_TABLE).
+		Columns(cols...).
+		Values(vals...).
+		Where("id = $1", s.Id).
+		Exec()
+	return err
+}
+
+func (db *FileShareDb) Truncate() error {
+	_, err := db.DB.DeleteFrom(FILE_SHARE_TABLE).Exec()
+	return err
+}
+
+// -
+
+func (db *FileShareDb) ByFileId(fileId string) ([]*FileShare, error) {
+	var shares []*FileShare
+	err := db.DB.
+		Select("*").
+		From(FILE_SHARE_TABLE).
+		Where("file_id = $1", fileId).
+		OrderBy("created_time DESC").
+		QueryStructs(&shares)
+	if shares == nil {
+		shares = []*FileShare{}
+	}
+	return shares, err
+}
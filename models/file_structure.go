@@ -0,0 +1,153 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/ericflo/gradientzoo/inspect"
+	runner "gopkg.in/mgutz/dat.v1/sqlx-runner"
+)
+
+const FILE_STRUCTURE_TABLE = "file_structure"
+
+const (
+	STRUCTURE_PENDING     = "pending"
+	STRUCTURE_DONE        = "done"
+	STRUCTURE_UNSUPPORTED = "unsupported"
+	STRUCTURE_FAILED      = "failed"
+)
+
+type FileStructureDb struct {
+	DB  *runner.DB
+	Api *ApiCollection
+}
+
+//go:generate counterfeiter $GOFILE FileStructureApi
+type FileStructureApi interface {
+	ById(fileId interface{}) (*FileStructure, error)
+	Delete(fileId interface{}) error
+	Save(*FileStructure) error
+	Truncate() error
+}
+
+func NewFileStructureDb(db *runner.DB, api *ApiCollection) *FileStructureDb {
+	return &FileStructureDb{
+		DB:  db,
+		Api: api,
+	}
+}
+
+// FileStructure is the result of inspecting an uploaded checkpoint: which
+// layers and tensors it holds, and how many parameters in total.  It's keyed
+// by the id of the file it describes.
+type FileStructure struct {
+	FileId          string             `db:"file_id" json:"file_id"`
+	Status          string             `db:"status" json:"status"`
+	Format          string             `db:"format" json:"format"`
+	StructureString string             `db:"structure" json:"-"`
+	Structure       *inspect.Structure `db:"-" json:"structure"`
+	TotalParams     int64              `db:"total_params" json:"total_params"`
+	Error           string             `db:"error" json:"error,omitempty"`
+	CreatedTime     time.Time          `db:"created_time" json:"created_time"`
+	UpdatedTime     time.Time          `db:"updated_time" json:"updated_time"`
+}
+
+func NewFileStructure(fileId string) *FileStructure {
+	now := time.Now().UTC()
+	return &FileStructure{
+		FileId:          fileId,
+		Status:          STRUCTURE_PENDING,
+		StructureString: "{}",
+		CreatedTime:     now,
+		UpdatedTime:     now,
+	}
+}
+
+// SetStructure records a successful inspection.
+func (fs *FileStructure) SetStructure(s *inspect.Structure) error {
+	encoded, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	fs.Status = STRUCTURE_DONE
+	fs.Format = s.Format
+	fs.Structure = s
+	fs.StructureString = string(encoded)
+	fs.TotalParams = s.TotalParams
+	fs.Error = ""
+	fs.UpdatedTime = time.Now().UTC()
+	return nil
+}
+
+func (fs *FileStructure) FillStructure() error {
+	if fs.Status != STRUCTURE_DONE || fs.StructureString == "" {
+		fs.Structure = nil
+		return nil
+	}
+	var s inspect.Structure
+	if err := json.Unmarshal([]byte(fs.StructureString), &s); err != nil {
+		return err
+	}
+	fs.Structure = &s
+	return nil
+}
+
+func (db *FileStructureDb) ById(fileId interface{}) (*FileStructure, error) {
+	var fs FileStructure
+	err := db.DB.
+		Select("*").
+		From(FILE_STRUCTURE_TABLE).
+		Where("file_id = $1", fileId).
+		QueryStruct(&fs)
+	if err == sql.ErrNoRows {
+		return nil, err
+	}
+	if err = fs.FillStructure(); err != nil {
+		return nil, err
+	}
+	return &fs, err
+}
+
+func (db *FileStructureDb) Delete(fileId interface{}) error {
+	_, err := db.DB.
+		DeleteFrom(FILE_STRUCTURE_TABLE).
+		Where("file_id = $1", fileId).
+		Exec()
+	return err
+}
+
+func (db *FileStructureDb) Save(fs *FileStructure) error {
+	cols := []string{
+		"file_id",
+		"status",
+		"format",
+		"structure",
+		"total_params",
+		"error",
+		"created_time",
+		"updated_time",
+	}
+	vals := []interface{}{
+		fs.FileId,
+		fs.Status,
+		fs.Format,
+		fs.StructureString,
+		fs.TotalParams,
+		fs.Error,
+		fs.CreatedTime,
+		fs.UpdatedTime,
+	}
+	_, err := db.DB.
+		Upsert(FILE_STRUCTURE_TABLE).
+		Columns(cols...).
+		Values(vals...).
+		Where("file_id = $1", fs.FileId).
+		Exec()
+	return err
+}
+
+func (db *FileStructureDb) Truncate() error {
+	_, err := db.DB.DeleteFrom(FILE_STRUCTURE_TABLE).Exec()
+	return err
+}
@@ -0,0 +1,130 @@
+package models
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"strings"
+	"time"
+
+	"github.com/ericflo/gradientzoo/metrics"
+	"github.com/lib/pq"
+)
+
+// The Postgres driver, timing every query for metrics
+const INSTRUMENTED_DRIVER = "postgres-instrumented"
+
+var (
+	dbQueryDuration = metrics.NewHistogram("gradientzoo_db_query_duration_seconds",
+		"How long database queries take, by operation.", metrics.LatencyBuckets,
+		"operation")
+	dbQueryErrors = metrics.NewCounter("gradientzoo_db_query_errors_total",
+		"Database queries that failed, by operation.", "operation")
+)
+
+func init() {
+	sql.Register(INSTRUMENTED_DRIVER, &instrumentedDriver{&pq.Driver{}})
+}
+
+// queryOperation is what kind of query it is, going by its first word, which
+// keeps the metrics down to a handful of series.
+func queryOperation(query string) string {
+	fields := strings.Fields(query)
+	if len(fields) == 0 {
+		return "other"
+	}
+	switch op := strings.ToLower(fields[0]); op {
+	case "select", "insert", "update", "delete", "with":
+		return op
+	}
+	return "other"
+}
+
+// queryTimer times a query for metrics.  Queries aren't traced, since dat
+// doesn't hand the driver a context that would say which request they're
+// run for.
+type queryTimer struct {
+	operation string
+	start     time.Time
+}
+
+func startQuery(query string) *queryTimer {
+	return &queryTimer{operation: queryOperation(query), start: time.Now()}
+}
+
+func (t *queryTimer) done(err error) {
+	if err == driver.ErrSkip {
+		// The driver didn't run it, so it's about to be prepared and run instead
+		return
+	}
+	dbQueryDuration.Observe(time.Since(t.start).Seconds(), t.operation)
+	if err != nil {
+		dbQueryErrors.Inc(t.operation)
+	}
+}
+
+type instrumentedDriver struct {
+	driver.Driver
+}
+
+func (d *instrumentedDriver) Open(name string) (driver.Conn, error) {
+	conn, err := d.Driver.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &instrumentedConn{conn}, nil
+}
+
+type instrumentedConn struct {
+	driver.Conn
+}
+
+func (c *instrumentedConn) Prepare(query string) (driver.Stmt, error) {
+	stmt, err := c.Conn.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	return &instrumentedStmt{stmt, query}, nil
+}
+
+// Exec and Query pass queries without args straight to the driver, the way
+// most of ours are run since dat interpolates them, if the driver can.
+func (c *instrumentedConn) Exec(query string, args []driver.Value) (driver.Result, error) {
+	execer, ok := c.Conn.(driver.Execer)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	t := startQuery(query)
+	result, err := execer.Exec(query, args)
+	t.done(err)
+	return result, err
+}
+
+func (c *instrumentedConn) Query(query string, args []driver.Value) (driver.Rows, error) {
+	queryer, ok := c.Conn.(driver.Queryer)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	t := startQuery(query)
+	rows, err := queryer.Query(query, args)
+	t.done(err)
+	return rows, err
+}
+
+type instrumentedStmt struct {
+	driver.Stmt
+	query string
+}
+
+func (s *instrumentedStmt) Exec(args []driver.Value) (driver.Result, error) {
+	t := startQuery(s.query)
+	result, err := s.Stmt.Exec(args)
+	t.done(err)
+	return result, err
+}
+
+func (s *instrumentedStmt) Query(args []driver.Value) (driver.Rows, error) {
+	t := startQuery(s.query)
+	rows, err := s.Stmt.Query(args)
+	t.done(err)
+	return rows, err
+}
@@ -0,0 +1,139 @@
+package models
+
+import (
+	"database/sql"
+	"net"
+	"time"
+
+	"github.com/pborman/uuid"
+	runner "gopkg.in/mgutz/dat.v1/sqlx-runner"
+)
+
+const IP_ALLOWLIST_TABLE = "ip_allowlist"
+
+type IpAllowlistDb struct {
+	DB  *runner.DB
+	Api *ApiCollection
+}
+
+//go:generate counterfeiter $GOFILE IpAllowlistApi
+type IpAllowlistApi interface {
+	ById(id interface{}) (*IpAllowlistEntry, error)
+	Delete(id interface{}) error
+	Save(*IpAllowlistEntry) error
+	Truncate() error
+
+	ByOrganizationId(orgId string) ([]*IpAllowlistEntry, error)
+}
+
+func NewIpAllowlistDb(db *runner.DB, api *ApiCollection) *IpAllowlistDb {
+	return &IpAllowlistDb{
+		DB:  db,
+		Api: api,
+	}
+}
+
+// IpAllowlistEntry is a network that an organization's members may use their
+// tokens from.  Once an organization has any entries, none of its members'
+// tokens work from anywhere else, whether they're API tokens or sessions.
+type IpAllowlistEntry struct {
+	Id             string    `db:"id" json:"id"`
+	OrganizationId string    `db:"organization_id" json:"organization_id"`
+	Cidr           string    `db:"cidr" json:"cidr"`
+	Note           string    `db:"note" json:"note"`
+	CreatedTime    time.Time `db:"created_time" json:"created_time"`
+}
+
+func NewIpAllowlistEntry(orgId, cidr, note string) *IpAllowlistEntry {
+	return &IpAllowlistEntry{
+		Id:             uuid.NewUUID().String(),
+		OrganizationId: orgId,
+		Cidr:           cidr,
+		Note:           note,
+		CreatedTime:    time.Now().UTC(),
+	}
+}
+
+// IpAllowed says whether ip is inside any of the entries.  An empty list
+// allows everything.
+func IpAllowed(entries []*IpAllowlistEntry, ip string) bool {
+	if len(entries) == 0 {
+		return true
+	}
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, e := range entries {
+		if _, network, err := net.ParseCIDR(e.Cidr); err == nil && network.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+func (db *IpAllowlistDb) ById(id interface{}) (*IpAllowlistEntry, error) {
+	var e IpAllowlistEntry
+	err := db.DB.
+		Select("id, organization_id, cidr::TEXT AS cidr, note, created_time").
+		From(IP_ALLOWLIST_TABLE).
+		Where("id = $1", id).
+		QueryStruct(&e)
+	if err == sql.ErrNoRows {
+		return nil, err
+	}
+	return &e, err
+}
+
+func (db *IpAllowlistDb) Delete(id interface{}) error {
+	_, err := db.DB.
+		DeleteFrom(IP_ALLOWLIST_TABLE).
+		Where("id = $1", id).
+		Exec()
+	return err
+}
+
+func (db *IpAllowlistDb) Save(e *IpAllowlistEntry) error {
+	cols := []string{
+		"id",
+		"organization_id",
+		"cidr",
+		"note",
+		"created_time",
+	}
+	vals := []interface{}{
+		e.Id,
+		e.OrganizationId,
+		e.Cidr,
+		e.Note,
+		e.CreatedTime,
+	}
+	_, err := db.DB.
+		Upsert(IP_ALLOWLIST_TABLE).
+		Columns(cols...).
+		Values(vals...).
+		Where("id = $1", e.Id).
+		Exec()
+	return err
+}
+
+func (db *IpAllowlistDb) Truncate() error {
+	_, err := db.DB.DeleteFrom(IP_ALLOWLIST_TABLE).Exec()
+	return err
+}
+
+// -
+
+func (db *IpAllowlistDb) ByOrganizationId(orgId string) ([]*IpAllowlistEntry, error) {
+	var entries []*IpAllowlistEntry
+	err := db.DB.
+		Select("id, organization_id, cidr::TEXT AS cidr, note, created_time").
+		From(IP_ALLOWLIST_TABLE).
+		Where("organization_id = $1", orgId).
+		OrderBy("created_time ASC").
+		QueryStructs(&entries)
+	if entries == nil {
+		entries = []*IpAllowlistEntry{}
+	}
+	return entries, err
+}
@@ -0,0 +1,295 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/pborman/uuid"
+	"gopkg.in/guregu/null.v3"
+	runner "gopkg.in/mgutz/dat.v1/sqlx-runner"
+)
+
+const JOB_TABLE = "job"
+
+// Jobs wait queued until their run time, are running while a worker has them,
+// and end up done, or dead once they've failed every attempt they get.  A
+// worker holds a job until LockedUntil, after which it's taken to have died
+// and the job is claimed again.
+const (
+	JOB_QUEUED  = "queued"
+	JOB_RUNNING = "running"
+	JOB_DONE    = "done"
+	JOB_DEAD    = "dead"
+)
+
+type JobDb struct {
+	DB  *runner.DB
+	Api *ApiCollection
+}
+
+//go:generate counterfeiter $GOFILE JobApi
+type JobApi interface {
+	ById(id interface{}) (*Job, error)
+	Delete(id interface{}) error
+	Save(*Job) error
+	Truncate() error
+
+	Claim(lease time.Duration) (*Job, error)
+	Finish(j *Job) error
+	Retry(id string) (bool, error)
+	ByStatus(status, kind string, limit int) ([]*Job, error)
+	Depths() ([]*JobDepth, error)
+	DeleteFinished(before time.Time) (int64, error)
+}
+
+func NewJobDb(db *runner.DB, api *ApiCollection) *JobDb {
+	return &JobDb{
+		DB:  db,
+		Api: api,
+	}
+}
+
+// Job is a piece of work to be done in the background, of a kind the workers
+// know how to do, with whatever it needs to know in its payload.  UserId is
+// who it's being done for, if anyone, who can check on how it's going.
+type Job struct {
+	Id            string          `db:"id" json:"id"`
+	Kind          string          `db:"kind" json:"kind"`
+	UserId        null.String     `db:"user_id" json:"user_id"`
+	PayloadString string          `db:"payload" json:"-"`
+	Payload       json.RawMessage `db:"-" json:"payload"`
+	Status        string          `db:"status" json:"status"`
+	Attempts      int             `db:"attempts" json:"attempts"`
+	MaxAttempts   int             `db:"max_attempts" json:"max_attempts"`
+	LastError     string          `db:"last_error" json:"last_error"`
+	RunTime       time.Time       `db:"run_time" json:"run_time"`
+	LockedUntil   null.Time       `db:"locked_until" json:"locked_until"`
+	CreatedTime   time.Time       `db:"created_time" json:"created_time"`
+	FinishedTime  null.Time       `db:"finished_time" json:"finished_time"`
+}
+
+// JobDepth is how many jobs of a kind are in a status, and when the one that's
+// been waiting longest was due to run.
+type JobDepth struct {
+	Kind       string    `db:"kind" json:"kind"`
+	Status     string    `db:"status" json:"status"`
+	Count      int       `db:"count" json:"count"`
+	OldestTime time.Time `db:"oldest_time" json:"oldest_time"`
+}
+
+func NewJob(kind, userId string, payload interface{}, maxAttempts int) (*Job, error) {
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	j := &Job{
+		Id:            uuid.NewRandom().String(),
+		Kind:          kind,
+		PayloadString: string(encoded),
+		Payload:       json.RawMessage(encoded),
+		Status:        JOB_QUEUED,
+		MaxAttempts:   maxAttempts,
+		RunTime:       now,
+		CreatedTime:   now,
+	}
+	if userId != "" {
+		j.UserId = null.StringFrom(userId)
+	}
+	return j, nil
+}
+
+func (j *Job) FillPayload() {
+	j.Payload = json.RawMessage(j.PayloadString)
+}
+
+// Decode decodes the job's payload into v.
+func (j *Job) Decode(v interface{}) error {
+	return json.Unmarshal([]byte(j.PayloadString), v)
+}
+
+// LastAttempt is whether the job's dead if this attempt at it fails.
+func (j *Job) LastAttempt() bool {
+	return j.Attempts >= j.MaxAttempts
+}
+
+func (db *JobDb) ById(id interface{}) (*Job, error) {
+	var j Job
+	err := db.DB.
+		Select("*").
+		From(JOB_TABLE).
+		Where("id = $1", id).
+		QueryStruct(&j)
+	if err == sql.ErrNoRows {
+		return nil, err
+	}
+	j.FillPayload()
+	return &j, err
+}
+
+func (db *JobDb) Delete(id interface{}) error {
+	_, err := db.DB.
+		DeleteFrom(JOB_TABLE).
+		Where("id = $1", id).
+		Exec()
+	return err
+}
+
+func (db *JobDb) Save(j *Job) error {
+	cols := []string{
+		"id",
+		"kind",
+		"user_id",
+		"payload",
+		"status",
+		"attempts",
+		"max_attempts",
+		"last_error",
+		"run_time",
+		"locked_until",
+		"created_time",
+		"finished_time",
+	}
+	vals := []interface{}{
+		j.Id,
+		j.Kind,
+		j.UserId,
+		j.PayloadString,
+		j.Status,
+		j.Attempts,
+		j.MaxAttempts,
+		j.LastError,
+		j.RunTime,
+		j.LockedUntil,
+		j.CreatedTime,
+		j.FinishedTime,
+	}
+	_, err := db.DB.
+		Upsert(JOB_TABLE).
+		Columns(cols...).
+		Values(vals...).
+		Where("id = $1", j.Id).
+		Exec()
+	return err
+}
+
+func (db *JobDb) Truncate() error {
+	_, err := db.DB.DeleteFrom(JOB_TABLE).Exec()
+	return err
+}
+
+// -
+
+// Claim takes the job that's been due longest, or one whose worker died
+// holding it, and holds it for the lease.  It's one statement, skipping jobs
+// other workers are claiming at the same time, so that no two get the same
+// one.  It returns sql.ErrNoRows if there's nothing to do.
+func (db *JobDb) Claim(lease time.Duration) (*Job, error) {
+	var j Job
+	err := db.DB.SQL(`
+	UPDATE `+JOB_TABLE+`
+	SET status = $1, attempts = attempts + 1, locked_until = NOW() + $2 * INTERVAL '1 second'
+	WHERE id = (
+		SELECT id FROM `+JOB_TABLE+`
+		WHERE (status = $3 AND run_time <= NOW()) OR (status = $1 AND locked_until < NOW())
+		ORDER BY run_time ASC
+		LIMIT 1
+		FOR UPDATE SKIP LOCKED
+	)
+	RETURNING *
+	`, JOB_RUNNING, int(lease.Seconds()), JOB_QUEUED).QueryStruct(&j)
+	if err != nil {
+		return nil, err
+	}
+	j.FillPayload()
+	return &j, nil
+}
+
+// Finish records how the worker's attempt at the job went: its status, last
+// error, and next run time.  It's only recorded if the worker still holds the
+// job, rather than having taken so long that it was claimed again.
+func (db *JobDb) Finish(j *Job) error {
+	_, err := db.DB.
+		Update(JOB_TABLE).
+		Set("status", j.Status).
+		Set("last_error", j.LastError).
+		Set("run_time", j.RunTime).
+		Set("locked_until", nil).
+		Set("finished_time", j.FinishedTime).
+		Where("id = $1 AND status = $2 AND attempts = $3", j.Id, JOB_RUNNING, j.Attempts).
+		Exec()
+	return err
+}
+
+// Retry queues a dead job to run again right away, with all its attempts, and
+// returns false if it wasn't dead.
+func (db *JobDb) Retry(id string) (bool, error) {
+	res, err := db.DB.
+		Update(JOB_TABLE).
+		Set("status", JOB_QUEUED).
+		Set("attempts", 0).
+		Set("run_time", time.Now().UTC()).
+		Set("finished_time", nil).
+		Where("id = $1 AND status = $2", id, JOB_DEAD).
+		Exec()
+	if err != nil {
+		return false, err
+	}
+	return res.RowsAffected > 0, nil
+}
+
+// ByStatus lists the jobs in a status, of the kind if it's not empty, newest
+// first.
+func (db *JobDb) ByStatus(status, kind string, limit int) ([]*Job, error) {
+	where := "status = $1"
+	args := []interface{}{status}
+	if kind != "" {
+		where += " AND kind = $2"
+		args = append(args, kind)
+	}
+	var jobs []*Job
+	err := db.DB.
+		Select("*").
+		From(JOB_TABLE).
+		Where(where, args...).
+		OrderBy("created_time DESC").
+		Limit(uint64(limit)).
+		QueryStructs(&jobs)
+	if jobs == nil {
+		jobs = []*Job{}
+	}
+	for _, j := range jobs {
+		j.FillPayload()
+	}
+	return jobs, err
+}
+
+// Depths counts the jobs that aren't done, by kind and status.
+func (db *JobDb) Depths() ([]*JobDepth, error) {
+	var depths []*JobDepth
+	err := db.DB.
+		Select("kind, status, COUNT(*) AS count, MIN(run_time) AS oldest_time").
+		From(JOB_TABLE).
+		Where("status <> $1", JOB_DONE).
+		GroupBy("kind, status").
+		OrderBy("kind, status").
+		QueryStructs(&depths)
+	if depths == nil {
+		depths = []*JobDepth{}
+	}
+	return depths, err
+}
+
+// DeleteFinished deletes the jobs that were done before the time, and returns
+// how many there were.  Dead ones are kept until someone looks at them.
+func (db *JobDb) DeleteFinished(before time.Time) (int64, error) {
+	res, err := db.DB.
+		DeleteFrom(JOB_TABLE).
+		Where("status = $1 AND finished_time < $2", JOB_DONE, before).
+		Exec()
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected, nil
+}
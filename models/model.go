@@ -2,16 +2,68 @@ package models
 
 import (
 	"database/sql"
+	"fmt"
+	"html"
+	"strings"
 	"time"
 
-	log "github.com/Sirupsen/logrus"
+	"github.com/ericflo/gradientzoo/utils"
 	"github.com/pborman/uuid"
+	"gopkg.in/guregu/null.v3"
 	"gopkg.in/guregu/null.v3/zero"
 	runner "gopkg.in/mgutz/dat.v1/sqlx-runner"
 )
 
 const MODEL_TABLE = "model"
 
+// The plans a model can be on, by how many versions of each file they keep
+var PLAN_KEEPS = []int{10, 100, 1000, 10000}
+
+func ValidPlanKeep(keep int) bool {
+	for _, k := range PLAN_KEEPS {
+		if k == keep {
+			return true
+		}
+	}
+	return false
+}
+
+// How model listings can be sorted
+const (
+	MODEL_SORT_CREATED   = "created"   // Newest first
+	MODEL_SORT_UPDATED   = "updated"   // Most recently uploaded to first
+	MODEL_SORT_DOWNLOADS = "downloads" // Most downloaded of all time first
+	MODEL_SORT_STARS     = "stars"     // Most starred first
+	MODEL_SORT_NAME      = "name"      // Alphabetically by name
+)
+
+// modelSort orders models M by some columns, with ties broken by id so that
+// the order is always the same and pages can start after any model.
+type modelSort struct {
+	cols []keyCol
+	desc bool
+}
+
+var modelSorts = map[string]*modelSort{
+	MODEL_SORT_CREATED: {cols: []keyCol{{"M.created_time", "TIMESTAMPTZ"}}, desc: true},
+	MODEL_SORT_UPDATED: {cols: []keyCol{{`COALESCE(
+		(SELECT MAX(F.created_time) FROM file F WHERE F.model_id = M.id),
+		M.created_time)`, "TIMESTAMPTZ"}}, desc: true},
+	MODEL_SORT_DOWNLOADS: {cols: []keyCol{{`(
+		SELECT COALESCE(SUM(DH.downloads), 0)
+		FROM (` + DownloadsSql("file_id IN (SELECT id FROM file WHERE model_id = M.id)") + `) DH
+		)`, "BIGINT"}}, desc: true},
+	MODEL_SORT_STARS: {cols: []keyCol{{`(
+		SELECT COUNT(*) FROM model_star S WHERE S.model_id = M.id
+		)`, "BIGINT"}}, desc: true},
+	MODEL_SORT_NAME: {cols: []keyCol{{"LOWER(M.name)", "TEXT"}}},
+}
+
+func ValidModelSort(sort string) bool {
+	_, ok := modelSorts[sort]
+	return ok
+}
+
 type ModelDb struct {
 	DB  *runner.DB
 	Api *ApiCollection
@@ -28,9 +80,21 @@ type ModelApi interface {
 
 	// TODO: Potentially this should be a separate interface
 	ByUserId(userId string) ([]*Model, error)
+	ByUserIdPage(userId string, limit int, after *PageKey) ([]*Model, *PageKey, error)
 	ByUserIdSlug(userId, slug string) (*Model, error)
-	ByVisibility(visibility string, limit int, last string) ([]*Model, error)
-	ByDownloads(visibility string, start, end time.Time, limit int, last string) ([]*Model, error)
+	ByVisibility(visibility string, filter *ModelFilter, sort string, limit int, after *PageKey) ([]*Model, *PageKey, error)
+	CountByVisibility(visibility string) (int, error)
+	Feed(afterTime time.Time, afterId string, limit int) ([]*FeedModel, error)
+	FeedPageEnds(pageSize int) ([]*FeedModel, error)
+	PastDownloadMilestone(milestones []int) ([]*ModelTotal, error)
+	SiteStats(topFrameworks int) (*SiteStats, error)
+	DashboardByUserId(userId string) ([]*DashboardModel, error)
+	Search(query, userId string, filter *ModelFilter, limit, offset int) ([]*ModelMatch, error)
+	PossibleDuplicates(name, description, excludeId string, limit int) ([]*DuplicateModel, error)
+	Initials() ([]*InitialCount, error)
+	ByInitial(initial string, limit int, after *PageKey) ([]*Model, *PageKey, error)
+	NamespaceInitials() ([]*InitialCount, error)
+	Namespaces(initial string, limit int, after *PageKey) ([]*Namespace, *PageKey, error)
 }
 
 func NewModelDb(db *runner.DB, api *ApiCollection) *ModelDb {
@@ -49,13 +113,61 @@ type Model struct {
 	Visibility  string    `db:"visibility" json:"visibility"`
 	Keep        int       `db:"keep" json:"keep"`
 	Readme      string    `db:"readme" json:"-"`
+	License     string    `db:"license" json:"license"`
 	CreatedTime time.Time `db:"created_time" json:"created_time"`
 
+	// The language Readme is in.  It can be translated into others, which are
+	// kept by ModelReadme.
+	ReadmeLanguage string `db:"readme_language" json:"readme_language"`
+
+	// Kept up to date by the database whenever the model or its files change,
+	// so it's never saved
+	UpdatedTime time.Time `db:"updated_time" json:"updated_time"`
+
+	// The last download milestone the owner was told about
+	DownloadMilestone int `db:"download_milestone" json:"-"`
+
 	// Hydrated fields
 	Downloads      *DownloadCounts `db:"-" json:"downloads,omitempty"`
+	Stars          int             `db:"-" json:"stars"`
+	Badges         []*Badge        `db:"-" json:"badges,omitempty"`
 	HydratedReadme zero.String     `db:"-" json:"readme,omitempty"`
 }
 
+// Badge is something a model has earned, for the frontend to show off
+type Badge struct {
+	Name  string `json:"name"`
+	Label string `json:"label"`
+}
+
+// DownloadBadges are the badges for each of the milestones up to and
+// including the one reached, e.g. downloads_1k and downloads_10k.
+func DownloadBadges(milestones []int, reached int) []*Badge {
+	var badges []*Badge
+	for _, milestone := range milestones {
+		if milestone > reached {
+			continue
+		}
+		short := shortCount(milestone)
+		badges = append(badges, &Badge{
+			Name:  "downloads_" + short,
+			Label: short + " downloads",
+		})
+	}
+	return badges
+}
+
+// shortCount writes round numbers the short way, e.g. 10k or 1m
+func shortCount(n int) string {
+	switch {
+	case n >= 1000000 && n%1000000 == 0:
+		return fmt.Sprintf("%dm", n/1000000)
+	case n >= 1000 && n%1000 == 0:
+		return fmt.Sprintf("%dk", n/1000)
+	}
+	return fmt.Sprintf("%d", n)
+}
+
 func NewModel(userId, slug, name, description, visibility string, keep int) *Model {
 	model := &Model{
 		Id:          uuid.NewUUID().String(),
@@ -66,17 +178,21 @@ func NewModel(userId, slug, name, description, visibility string, keep int) *Mod
 		Visibility:  visibility,
 		Keep:        keep,
 		CreatedTime: time.Now().UTC(),
+
+		ReadmeLanguage: DEFAULT_README_LANGUAGE,
 	}
 	return model
 }
 
 func (db *ModelDb) ById(id interface{}) (*Model, error) {
 	var model Model
-	err := db.DB.
-		Select("*").
-		From(MODEL_TABLE).
-		Where("id = $1", id).
-		QueryStruct(&model)
+	err := db.Api.cached(modelKey(fmt.Sprint(id)), &model, func() error {
+		return db.DB.
+			Select("*").
+			From(MODEL_TABLE).
+			Where("id = $1", id).
+			QueryStruct(&model)
+	})
 	if err == sql.ErrNoRows {
 		return nil, err
 	}
@@ -88,7 +204,7 @@ func (db *ModelDb) ByIds(ids []interface{}) ([]*Model, error) {
 		return []*Model{}, nil
 	}
 	var models []*Model
-	err := db.DB.
+	err := db.Api.reader(db.DB).
 		Select("*").
 		From(MODEL_TABLE).
 		Where("id IN $1", IdStrings(ids)).
@@ -104,6 +220,7 @@ func (db *ModelDb) Delete(id interface{}) error {
 		DeleteFrom(MODEL_TABLE).
 		Where("id = $1", id).
 		Exec()
+	db.Api.uncache(modelKey(fmt.Sprint(id)))
 	return err
 }
 
@@ -117,7 +234,10 @@ func (db *ModelDb) Save(model *Model) error {
 		"visibility",
 		"keep",
 		"readme",
+		"license",
 		"created_time",
+		"download_milestone",
+		"readme_language",
 	}
 	vals := []interface{}{
 		model.Id,
@@ -128,7 +248,10 @@ func (db *ModelDb) Save(model *Model) error {
 		model.Visibility,
 		model.Keep,
 		model.Readme,
+		model.License,
 		model.CreatedTime,
+		model.DownloadMilestone,
+		model.ReadmeLanguage,
 	}
 	_, err := db.DB.
 		Upsert(MODEL_TABLE).
@@ -136,6 +259,7 @@ func (db *ModelDb) Save(model *Model) error {
 		Values(vals...).
 		Where("id = $1", model.Id).
 		Exec()
+	db.Api.uncache(modelKey(model.Id))
 	return err
 }
 
@@ -149,10 +273,16 @@ func (db *ModelDb) Hydrate(models []*Model) error {
 	if err != nil {
 		return err
 	}
+	stars, err := db.Api.ModelStar.CountsByModelIds(modelIds)
+	if err != nil {
+		return err
+	}
 
 	for _, model := range models {
 		c := counts[model.Id]
 		model.Downloads = &c
+		model.Stars = stars[model.Id]
+		model.Badges = DownloadBadges(utils.Conf.DownloadMilestones, model.DownloadMilestone)
 		model.HydratedReadme = zero.StringFrom(model.Readme)
 	}
 	return nil
@@ -179,6 +309,30 @@ func (db *ModelDb) ByUserId(userId string) ([]*Model, error) {
 }
 
 func (db *ModelDb) ByUserIdSlug(userId, slug string) (*Model, error) {
+	if db.Api.cache == nil {
+		return db.byUserIdSlug(userId, slug)
+	}
+	var id string
+	err := db.Api.cached(modelSlugKey(userId, slug), &id, func() error {
+		return db.DB.
+			Select("id").
+			From(MODEL_TABLE).
+			Where("user_id = $1 AND slug = $2", userId, slug).
+			QueryScalar(&id)
+	})
+	if err != nil {
+		return nil, err
+	}
+	model, err := db.ById(id)
+	if err != sql.ErrNoRows && (err != nil || (model.UserId == userId && model.Slug == slug)) {
+		return model, err
+	}
+	// The model has since been renamed, moved, or deleted
+	db.Api.uncache(modelSlugKey(userId, slug))
+	return db.byUserIdSlug(userId, slug)
+}
+
+func (db *ModelDb) byUserIdSlug(userId, slug string) (*Model, error) {
 	var model Model
 	err := db.DB.
 		Select("*").
@@ -191,51 +345,723 @@ func (db *ModelDb) ByUserIdSlug(userId, slug string) (*Model, error) {
 	return &model, err
 }
 
-func (db *ModelDb) ByVisibility(visibility string, limit int, last string) ([]*Model, error) {
-	if last != "" {
-		log.Error("ByVisibility does not yet handle pagination, 'last' param ignored")
+// userModelsOrder lists a user's models newest first
+var userModelsOrder = []keyCol{{"M.created_time", "TIMESTAMPTZ"}}
+
+// ByUserIdPage lists a page of the user's models, newest first, starting after
+// the key.  It also returns the key the next page starts after, if there might
+// be one.
+func (db *ModelDb) ByUserIdPage(userId string, limit int, after *PageKey) ([]*Model, *PageKey, error) {
+	var args sqlArgs
+	sql := `
+	SELECT M.*, ` + keysSql(userModelsOrder) + `
+	FROM model M
+	WHERE M.user_id = ` + args.Add(userId) + `
+	  AND ` + after.afterSql(userModelsOrder, "M.id", true, &args) + `
+	ORDER BY ` + orderSql(userModelsOrder, "M.id", true) + `
+	LIMIT ` + args.Add(limit)
+	var rows []*keyedModel
+	err := db.Api.reader(db.DB).SQL(sql, args...).QueryStructs(&rows)
+	models := make([]*Model, 0, len(rows))
+	for _, row := range rows {
+		models = append(models, &row.Model)
 	}
-	var models []*Model
-	err := db.DB.
-		Select("*").
+	var next *PageKey
+	if len(rows) == limit {
+		last := rows[len(rows)-1]
+		next = last.pageKey(len(userModelsOrder), last.Id)
+	}
+	return models, next, err
+}
+
+// ByVisibility lists a page of the models with the visibility that get
+// through the filter, in the order given by sort, starting after the key.  It
+// also returns the key the next page starts after, if there might be one.
+func (db *ModelDb) ByVisibility(visibility string, filter *ModelFilter, sort string, limit int, after *PageKey) ([]*Model, *PageKey, error) {
+	order, ok := modelSorts[sort]
+	if !ok {
+		return nil, nil, fmt.Errorf("Unknown model sort %q", sort)
+	}
+	var args sqlArgs
+	sql := `
+	SELECT M.*, ` + keysSql(order.cols) + `
+	FROM model M
+	WHERE M.visibility = ` + args.Add(visibility) + `
+	  AND ` + filter.whereSql(&args) + `
+	  AND ` + after.afterSql(order.cols, "M.id", order.desc, &args) + `
+	ORDER BY ` + orderSql(order.cols, "M.id", order.desc) + `
+	LIMIT ` + args.Add(limit)
+	var rows []*keyedModel
+	err := db.Api.reader(db.DB).SQL(sql, args...).QueryStructs(&rows)
+	models := make([]*Model, 0, len(rows))
+	for _, row := range rows {
+		models = append(models, &row.Model)
+	}
+	var next *PageKey
+	if len(rows) == limit {
+		last := rows[len(rows)-1]
+		next = last.pageKey(len(order.cols), last.Id)
+	}
+	return models, next, err
+}
+
+type keyedModel struct {
+	Model
+	pageKeys
+}
+
+// CountByVisibility counts the models with the visibility.
+func (db *ModelDb) CountByVisibility(visibility string) (int, error) {
+	var count int
+	err := db.Api.reader(db.DB).
+		Select("COUNT(*)").
 		From(MODEL_TABLE).
 		Where("visibility = $1", visibility).
-		OrderBy("created_time DESC").
-		Limit(uint64(limit)).
-		QueryStructs(&models)
-	if models == nil {
-		models = []*Model{}
+		QueryScalar(&count)
+	return count, err
+}
+
+// FeedModel is what feeds and sitemaps need to know about a public model.
+type FeedModel struct {
+	Id          string    `db:"id" json:"id"`
+	Username    string    `db:"username" json:"username"`
+	Slug        string    `db:"slug" json:"slug"`
+	Name        string    `db:"name" json:"name"`
+	Description string    `db:"description" json:"description"`
+	License     string    `db:"license" json:"license"`
+	CreatedTime time.Time `db:"created_time" json:"created_time"`
+	UpdatedTime time.Time `db:"updated_time" json:"updated_time"`
+}
+
+// Feed lists public models updated after the (afterTime, afterId) key, oldest
+// update first, so that callers can keep coming back for whatever changed.
+// Leave afterId empty to start at (and include) afterTime.
+func (db *ModelDb) Feed(afterTime time.Time, afterId string, limit int) ([]*FeedModel, error) {
+	if afterId == "" {
+		afterId = "00000000-0000-0000-0000-000000000000"
 	}
-	return models, err
+	sql := `
+  SELECT
+    M.id AS id,
+    U.username AS username,
+    M.slug AS slug,
+    M.name AS name,
+    M.description AS description,
+    M.license AS license,
+    M.created_time AS created_time,
+    M.updated_time AS updated_time
+  FROM model M
+  JOIN auth_user U ON (U.id = M.user_id)
+  WHERE M.visibility = 'public'
+    AND (M.updated_time, M.id) > ($1, $2)
+  ORDER BY M.updated_time ASC, M.id ASC
+  LIMIT $3
+  `
+	var feed []*FeedModel
+	err := db.Api.reader(db.DB).SQL(sql, afterTime, afterId, limit).QueryStructs(&feed)
+	if feed == nil {
+		feed = []*FeedModel{}
+	}
+	return feed, err
 }
 
-func (db *ModelDb) ByDownloads(visibility string, start, end time.Time, limit int, last string) ([]*Model, error) {
-	if last != "" {
-		log.Error("ByDownloads does not yet handle pagination, 'last' param ignored")
+// FeedPageEnds finds the key of the last model on every full page of the feed
+// of the given size, so that pages can be linked to without offsets.
+func (db *ModelDb) FeedPageEnds(pageSize int) ([]*FeedModel, error) {
+	sql := `
+  SELECT id, updated_time
+  FROM (
+    SELECT
+      M.id AS id,
+      M.updated_time AS updated_time,
+      ROW_NUMBER() OVER (ORDER BY M.updated_time ASC, M.id ASC) AS n
+    FROM model M
+    WHERE M.visibility = 'public'
+  ) P
+  WHERE P.n % $1 = 0
+  ORDER BY P.n ASC
+  `
+	var ends []*FeedModel
+	err := db.Api.reader(db.DB).SQL(sql, pageSize).QueryStructs(&ends)
+	if ends == nil {
+		ends = []*FeedModel{}
 	}
+	return ends, err
+}
+
+// SiteStats sums up everything public on the site.
+type SiteStats struct {
+	Models        int               `db:"models" json:"models"`
+	Files         int               `db:"files" json:"files"`
+	WeekDownloads int               `db:"week_downloads" json:"week_downloads"`
+	Frameworks    []*FrameworkUsage `db:"-" json:"frameworks"`
+}
+
+// FrameworkUsage is how many public models have a latest file for a framework.
+type FrameworkUsage struct {
+	Framework string `db:"framework" json:"framework"`
+	Models    int    `db:"models" json:"models"`
+}
+
+// SiteStats counts public models, their latest files, and their downloads over
+// the last week, along with the topFrameworks frameworks most of them use.
+func (db *ModelDb) SiteStats(topFrameworks int) (*SiteStats, error) {
+	sql := `
+  SELECT
+    (SELECT COUNT(*) FROM model WHERE visibility = 'public') AS models,
+    (SELECT COUNT(*)
+     FROM file F
+     JOIN model M ON (M.id = F.model_id)
+     WHERE M.visibility = 'public' AND F.status = 'latest') AS files,
+    (SELECT COALESCE(SUM(DH.downloads), 0)
+     FROM (` + DownloadsSql("file_id IN (SELECT F.id FROM file F JOIN model M ON (M.id = F.model_id) WHERE M.visibility = 'public')") + `) DH
+     WHERE DH.t >= NOW() - INTERVAL '7 days') AS week_downloads
+  `
+	tx, end, err := beginAggregate(db.Api.reader(db.DB))
+	if err != nil {
+		return nil, err
+	}
+	defer end()
+
+	var stats SiteStats
+	if err = tx.SQL(sql).QueryStruct(&stats); err != nil {
+		return nil, err
+	}
+
+	sql = `
+  SELECT F.framework AS framework, COUNT(DISTINCT F.model_id) AS models
+  FROM file F
+  JOIN model M ON (M.id = F.model_id)
+  WHERE M.visibility = 'public' AND F.status = 'latest'
+  GROUP BY F.framework
+  ORDER BY models DESC, framework ASC
+  LIMIT $1
+  `
+	err = tx.SQL(sql, topFrameworks).QueryStructs(&stats.Frameworks)
+	if stats.Frameworks == nil {
+		stats.Frameworks = []*FrameworkUsage{}
+	}
+	return &stats, err
+}
+
+// DashboardModel sums up one of a user's models for their home page.
+type DashboardModel struct {
+	Id               string      `db:"id" json:"id"`
+	Slug             string      `db:"slug" json:"slug"`
+	Name             string      `db:"name" json:"name"`
+	Visibility       string      `db:"visibility" json:"visibility"`
+	CreatedTime      time.Time   `db:"created_time" json:"created_time"`
+	StorageBytes     int64       `db:"storage_bytes" json:"storage_bytes"`
+	Stars            int         `db:"stars" json:"stars"`
+	LatestFileId     null.String `db:"latest_file_id" json:"latest_file_id"`
+	LatestFilename   null.String `db:"latest_filename" json:"latest_filename"`
+	LatestUploadTime null.Time   `db:"latest_upload_time" json:"latest_upload_time"`
+	Downloads7Days   int         `db:"downloads_7_days" json:"downloads_7_days"`
+	Downloads30Days  int         `db:"downloads_30_days" json:"downloads_30_days"`
+}
+
+// DashboardByUserId sums up all of the user's models at once, newest first,
+// rather than hydrating each of them.
+func (db *ModelDb) DashboardByUserId(userId string) ([]*DashboardModel, error) {
+	sql := `
+  SELECT
+    M.id AS id,
+    M.slug AS slug,
+    M.name AS name,
+    M.visibility AS visibility,
+    M.created_time AS created_time,
+    COALESCE(S.storage_bytes, 0) AS storage_bytes,
+    COALESCE(ST.stars, 0) AS stars,
+    L.id AS latest_file_id,
+    L.filename AS latest_filename,
+    L.created_time AS latest_upload_time,
+    COALESCE(D.downloads_7_days, 0) AS downloads_7_days,
+    COALESCE(D.downloads_30_days, 0) AS downloads_30_days
+  FROM model M
+  LEFT JOIN (
+    SELECT model_id, SUM(size_bytes) AS storage_bytes
+    FROM file
+    WHERE model_id IN (SELECT id FROM model WHERE user_id = $1)
+      AND status IN ('latest', 'old')
+    GROUP BY model_id
+  ) S ON (S.model_id = M.id)
+  LEFT JOIN (
+    SELECT model_id, COUNT(*) AS stars
+    FROM model_star
+    WHERE model_id IN (SELECT id FROM model WHERE user_id = $1)
+    GROUP BY model_id
+  ) ST ON (ST.model_id = M.id)
+  LEFT JOIN (
+    SELECT DISTINCT ON (model_id) model_id, id, filename, created_time
+    FROM file
+    WHERE model_id IN (SELECT id FROM model WHERE user_id = $1)
+      AND status IN ('latest', 'old')
+    ORDER BY model_id, created_time DESC
+  ) L ON (L.model_id = M.id)
+  LEFT JOIN (
+    SELECT
+      F.model_id,
+      SUM(CASE WHEN DH.t >= NOW() - INTERVAL '7 days' THEN DH.downloads ELSE 0 END) AS downloads_7_days,
+      SUM(DH.downloads) AS downloads_30_days
+    FROM (` + DownloadsSql("file_id IN (SELECT F.id FROM file F JOIN model M ON (M.id = F.model_id) WHERE M.user_id = $1)") + `) DH
+    JOIN file F ON (F.id = DH.file_id)
+    WHERE DH.t >= NOW() - INTERVAL '30 days'
+    GROUP BY F.model_id
+  ) D ON (D.model_id = M.id)
+  WHERE M.user_id = $1
+  ORDER BY M.created_time DESC
+  `
+	var summaries []*DashboardModel
+	err := db.DB.SQL(sql, userId).QueryStructs(&summaries)
+	if summaries == nil {
+		summaries = []*DashboardModel{}
+	}
+	return summaries, err
+}
+
+// ModelTotal is a model along with its all-time download total
+type ModelTotal struct {
+	Model
+	Total int `db:"total"`
+}
+
+// PastDownloadMilestone finds models whose all-time downloads have reached
+// the next of the milestones after the one their owner was last told about.
+func (db *ModelDb) PastDownloadMilestone(milestones []int) ([]*ModelTotal, error) {
+	if len(milestones) == 0 {
+		return []*ModelTotal{}, nil
+	}
+	values := make([]string, 0, len(milestones))
+	for _, milestone := range milestones {
+		values = append(values, fmt.Sprintf("(%d)", milestone))
+	}
+	sql := `
+	SELECT
+		M.*,
+		SUM(DH.downloads) AS total
+	FROM model M
+	JOIN file F ON (F.model_id = M.id)
+	JOIN (` + DownloadsSql("TRUE") + `) DH ON (DH.file_id = F.id)
+	GROUP BY M.id
+	HAVING SUM(DH.downloads) >= (
+		SELECT MIN(V.milestone)
+		FROM (VALUES ` + strings.Join(values, ", ") + `) AS V (milestone)
+		WHERE V.milestone > M.download_milestone
+	)
+	`
+	tx, end, err := beginAggregate(db.DB)
+	if err != nil {
+		return nil, err
+	}
+	defer end()
+
+	var totals []*ModelTotal
+	err = tx.SQL(sql).QueryStructs(&totals)
+	if totals == nil {
+		totals = []*ModelTotal{}
+	}
+	return totals, err
+}
+
+// ModelMatch is a model found by Search, with how well it matched and a bit
+// of its description or readme with the matching words marked.  It also says
+// which fields matched, and has the name, description and readme with the
+// matching words marked, for whichever of them matched.  Those are HTML, with
+// the words in <b> and everything else escaped.
+type ModelMatch struct {
+	Model         `json:"-"`
+	Rank          float64           `db:"rank" json:"rank"`
+	Snippet       string            `db:"snippet" json:"snippet"`
+	MatchedFields []string          `db:"-" json:"matched_fields"`
+	Highlights    map[string]string `db:"-" json:"highlights"`
+
+	// What the highlights are filled in from
+	MatchedString        string `db:"matched_fields" json:"-"`
+	NameHighlight        string `db:"name_highlight" json:"-"`
+	DescriptionHighlight string `db:"description_highlight" json:"-"`
+	ReadmeHighlight      string `db:"readme_highlight" json:"-"`
+}
+
+var highlightUnescaper = strings.NewReplacer("&lt;b&gt;", "<b>", "&lt;/b&gt;", "</b>")
+
+// EscapeHighlight escapes text with matching words marked in <b>, leaving
+// the marks alone.
+func EscapeHighlight(s string) string {
+	return highlightUnescaper.Replace(html.EscapeString(s))
+}
+
+func (m *ModelMatch) fillHighlights() {
+	m.Snippet = EscapeHighlight(m.Snippet)
+	m.MatchedFields = []string{}
+	m.Highlights = map[string]string{}
+	if m.MatchedString == "" {
+		return
+	}
+	m.MatchedFields = strings.Split(m.MatchedString, ",")
+	highlights := map[string]string{
+		"name":        m.NameHighlight,
+		"description": m.DescriptionHighlight,
+		"readme":      m.ReadmeHighlight,
+	}
+	for _, field := range m.MatchedFields {
+		if h, ok := highlights[field]; ok {
+			m.Highlights[field] = EscapeHighlight(h)
+		}
+	}
+}
+
+// ModelFilter narrows down which models are listed.  Anything left as its
+// zero value isn't filtered on.
+type ModelFilter struct {
+	Framework    string    // Has a latest file for the framework
+	License      string    // Is under the license
+	MaxSizeBytes int64     // Its latest files add up to no more than this
+	MinDownloads int       // Has been downloaded at least this many times
+	UpdatedSince time.Time // Was created or had a file uploaded since
+
+	// Was created at or after CreatedSince and before CreatedBefore
+	CreatedSince  time.Time
+	CreatedBefore time.Time
+
+	// And that latest file's framework version satisfies all of these, which
+	// must be Comparable
+	FrameworkVersions []*VersionConstraint
+}
+
+// Postgres' operators for each of the version constraint operators
+var versionOpSql = map[string]string{
+	">=": ">=",
+	"<=": "<=",
+	">":  ">",
+	"<":  "<",
+	"==": "=",
+	"!=": "<>",
+}
+
+// Empty says whether the filter lets every model through.
+func (f *ModelFilter) Empty() bool {
+	return f == nil || (f.Framework == "" && f.License == "" && f.MaxSizeBytes == 0 &&
+		f.MinDownloads == 0 && f.UpdatedSince.IsZero() && f.CreatedSince.IsZero() &&
+		f.CreatedBefore.IsZero() && len(f.FrameworkVersions) == 0)
+}
+
+// sqlArgs collects the args of a query as it's built up.
+type sqlArgs []interface{}
+
+// Add appends the arg and returns its placeholder.
+func (a *sqlArgs) Add(arg interface{}) string {
+	*a = append(*a, arg)
+	return fmt.Sprintf("$%d", len(*a))
+}
+
+// whereSql turns the filter into predicates on models M.
+func (f *ModelFilter) whereSql(args *sqlArgs) string {
+	preds := []string{"TRUE"}
+	if f == nil {
+		return preds[0]
+	}
+	if f.Framework != "" {
+		latest := "L.model_id = M.id AND L.framework = " + args.Add(f.Framework)
+		for _, c := range f.FrameworkVersions {
+			parts, _ := versionParts(c.Version)
+			latest += " AND L.version_parts " + versionOpSql[c.Op] + " " + args.Add(parts) + "::NUMERIC[]"
+		}
+		preds = append(preds, `EXISTS (
+		SELECT 1 FROM model_latest_file L
+		WHERE `+latest+`)`)
+	}
+	if f.License != "" {
+		preds = append(preds, "M.license = "+args.Add(f.License))
+	}
+	if f.MaxSizeBytes > 0 {
+		preds = append(preds, `(
+		SELECT COALESCE(SUM(L.size_bytes), 0) FROM model_latest_file L
+		WHERE L.model_id = M.id) <= `+args.Add(f.MaxSizeBytes))
+	}
+	if f.MinDownloads > 0 {
+		preds = append(preds, `(
+		SELECT COALESCE(SUM(DH.downloads), 0)
+		FROM (`+DownloadsSql("file_id IN (SELECT id FROM file WHERE model_id = M.id)")+`) DH
+		) >= `+args.Add(f.MinDownloads))
+	}
+	if !f.UpdatedSince.IsZero() {
+		since := args.Add(f.UpdatedSince)
+		preds = append(preds, `(M.created_time >= `+since+` OR EXISTS (
+		SELECT 1 FROM file F
+		WHERE F.model_id = M.id AND F.created_time >= `+since+`))`)
+	}
+	if !f.CreatedSince.IsZero() {
+		preds = append(preds, "M.created_time >= "+args.Add(f.CreatedSince))
+	}
+	if !f.CreatedBefore.IsZero() {
+		preds = append(preds, "M.created_time < "+args.Add(f.CreatedBefore))
+	}
+	return strings.Join(preds, "\n\t  AND ")
+}
+
+// visibleSql limits models M to the ones userId can see: public ones, their
+// own, and ones they've been granted access to.  Nobody's signed in when
+// userId is empty.
+func visibleSql(userId string, args *sqlArgs) string {
+	if userId == "" {
+		return "M.visibility <> 'private'"
+	}
+	u := args.Add(userId)
+	return `(M.visibility <> 'private' OR M.user_id = ` + u + ` OR M.id IN (
+		SELECT model_id FROM ` + ACCESS_REQUEST_TABLE + `
+		WHERE user_id = ` + u + ` AND status = ` + args.Add(ACCESS_APPROVED) + `
+		  AND (expires_time IS NULL OR expires_time > NOW())))`
+}
+
+// Search finds the models userId can see that get through the filter and
+// whose name, slug, description or readme match the words in query, best
+// matches first.  Without a query every model that gets through the filter
+// matches, newest first.
+func (db *ModelDb) Search(query, userId string, filter *ModelFilter, limit, offset int) ([]*ModelMatch, error) {
+	var args sqlArgs
+	if query == "" {
+		sql := `
+	SELECT
+		M.*,
+		0 AS rank,
+		'' AS snippet
+	FROM model M
+	WHERE ` + visibleSql(userId, &args) + `
+	  AND ` + filter.whereSql(&args) + `
+	ORDER BY M.created_time DESC
+	LIMIT ` + args.Add(limit) + ` OFFSET ` + args.Add(offset)
+
+		var matches []*ModelMatch
+		err := db.Api.reader(db.DB).SQL(sql, args...).QueryStructs(&matches)
+		if matches == nil {
+			matches = []*ModelMatch{}
+		}
+		for _, m := range matches {
+			m.fillHighlights()
+		}
+		return matches, err
+	}
+
+	// The page of matches is found first, so that working out how each one
+	// matched is only done for the models on it
+	q := args.Add(query)
 	sql := `
 	SELECT
-		M.*
-	FROM download_hour DH
-	LEFT JOIN file F ON (F.id = DH.file_id)
-	LEFT JOIN model M ON (M.id = F.model_id)
-	WHERE M.visibility = $1
-	GROUP BY M.id,
-					 M.user_id,
-					 M.slug,
-					 M.name,
-					 M.description,
-					 M.visibility,
-					 M.keep,
-					 M.readme,
-					 M.created_time
-	ORDER BY COALESCE(SUM(CASE WHEN DH.hour >= $2 AND DH.hour < $3 THEN DH.downloads ELSE 0 END)) DESC
+		X.*,
+		ts_headline('english', X.description || ' ' || T.readme, Q,
+			'MaxWords=30, MinWords=10, MaxFragments=2') AS snippet,
+		concat_ws(',',
+			CASE WHEN to_tsvector('english', X.name) @@ Q THEN 'name' END,
+			CASE WHEN to_tsvector('english', replace(X.slug, '-', ' ')) @@ Q THEN 'slug' END,
+			CASE WHEN to_tsvector('english', X.description) @@ Q THEN 'description' END,
+			CASE WHEN to_tsvector('english', T.readme) @@ Q THEN 'readme' END
+		) AS matched_fields,
+		ts_headline('english', X.name, Q, 'HighlightAll=TRUE') AS name_highlight,
+		ts_headline('english', X.description, Q, 'HighlightAll=TRUE') AS description_highlight,
+		ts_headline('english', T.readme, Q,
+			'MaxWords=30, MinWords=10, MaxFragments=3') AS readme_highlight
+	FROM (
+		SELECT M.*, ts_rank_cd(S.search_vector, Q) AS rank
+		FROM model M
+		JOIN model_search S ON (S.model_id = M.id),
+			plainto_tsquery('english', ` + q + `) Q
+		WHERE S.search_vector @@ Q
+		  AND ` + visibleSql(userId, &args) + `
+		  AND ` + filter.whereSql(&args) + `
+		ORDER BY rank DESC, M.created_time DESC
+		LIMIT ` + args.Add(limit) + ` OFFSET ` + args.Add(offset) + `
+	) X
+	CROSS JOIN plainto_tsquery('english', ` + q + `) Q
+	-- Readmes are matched along with their translations
+	CROSS JOIN LATERAL (
+		SELECT concat_ws(' ', X.readme, string_agg(R.readme, ' ')) AS readme
+		FROM model_readme R WHERE R.model_id = X.id
+	) T
+	ORDER BY X.rank DESC, X.created_time DESC`
+
+	var matches []*ModelMatch
+	err := db.Api.reader(db.DB).SQL(sql, args...).QueryStructs(&matches)
+	if matches == nil {
+		matches = []*ModelMatch{}
+	}
+	for _, m := range matches {
+		m.fillHighlights()
+	}
+	return matches, err
+}
+
+// Why a model might be a duplicate of another
+const (
+	DUPLICATE_NAME        = "name"        // Their names are the same but for case and punctuation
+	DUPLICATE_DESCRIPTION = "description" // Every word of the name and description is in it
+	DUPLICATE_FILE        = "file"        // It has a file with the same contents
+)
+
+// DuplicateModel is a model that might be a duplicate of another, and why.
+type DuplicateModel struct {
+	Model
+	Reason string `db:"reason"`
+}
+
+// PossibleDuplicates finds public models, other than excludeId, that a model
+// with the name and description might be a duplicate of, oldest first, since
+// that's most likely the original.
+func (db *ModelDb) PossibleDuplicates(name, description, excludeId string, limit int) ([]*DuplicateModel, error) {
+	sql := `
+	SELECT * FROM (
+		SELECT DISTINCT ON (M.id) M.*, D.reason
+		FROM (
+			SELECT id, 1 AS o, '` + DUPLICATE_NAME + `' AS reason
+			FROM model
+			WHERE visibility = 'public'
+			  AND regexp_replace(lower(name), '[^a-z0-9]+', '', 'g') =
+			      regexp_replace(lower($1), '[^a-z0-9]+', '', 'g')
+			UNION ALL
+			SELECT model_id, 2, '` + DUPLICATE_DESCRIPTION + `'
+			FROM model_search
+			WHERE $2 <> ''
+			  AND search_vector @@ plainto_tsquery('english', $1 || ' ' || $2)
+		) D
+		JOIN model M ON (M.id = D.id)
+		WHERE M.visibility = 'public'
+		  AND M.id::TEXT <> $3
+		ORDER BY M.id, D.o
+	) X
+	ORDER BY created_time ASC
 	LIMIT $4
 	`
-	var models []*Model
-	err := db.DB.SQL(sql, visibility, start, end, limit).QueryStructs(&models)
-	if models == nil {
-		models = []*Model{}
+	var dups []*DuplicateModel
+	err := db.Api.reader(db.DB).SQL(sql, name, description, excludeId, limit).QueryStructs(&dups)
+	if dups == nil {
+		dups = []*DuplicateModel{}
 	}
-	return models, err
+	return dups, err
+}
+
+// Public models are browsed alphabetically by the letter their names start
+// with, which is '#' for names that start with anything else, and by the
+// users who own them, the same way.
+
+// InitialCount is how many public models, or owners of them, there are under
+// a letter.
+type InitialCount struct {
+	Initial string `db:"initial" json:"initial"`
+	Count   int    `db:"count" json:"count"`
+}
+
+// Namespace is a user who owns public models, and how many.
+type Namespace struct {
+	UserId   string `db:"user_id" json:"-"`
+	Username string `db:"username" json:"username"`
+	Models   int    `db:"models" json:"models"`
+}
+
+// ValidInitial says whether models can be browsed under initial: a lowercase
+// letter or '#'.
+func ValidInitial(initial string) bool {
+	return initial == "#" || (len(initial) == 1 && initial[0] >= 'a' && initial[0] <= 'z')
+}
+
+type keyedNamespace struct {
+	Namespace
+	pageKeys
+}
+
+var initialModelsOrder = []keyCol{{"LOWER(M.name)", "TEXT"}}
+var namespacesOrder = []keyCol{{"LOWER(U.username)", "TEXT"}}
+
+// Initials counts public models by the letter their names start with, in
+// alphabetical order, leaving out letters with none.
+func (db *ModelDb) Initials() ([]*InitialCount, error) {
+	var counts []*InitialCount
+	err := db.Api.reader(db.DB).SQL(`
+	SELECT name_initial(name) AS initial, COUNT(*) AS count
+	FROM model
+	WHERE visibility = 'public'
+	GROUP BY 1
+	ORDER BY 1
+	`).QueryStructs(&counts)
+	if counts == nil {
+		counts = []*InitialCount{}
+	}
+	return counts, err
+}
+
+// ByInitial lists a page of the public models whose names start with the
+// letter, alphabetically, starting after the key.  It also returns the key
+// the next page starts after, if there might be one.
+func (db *ModelDb) ByInitial(initial string, limit int, after *PageKey) ([]*Model, *PageKey, error) {
+	var args sqlArgs
+	sql := `
+	SELECT M.*, ` + keysSql(initialModelsOrder) + `
+	FROM model M
+	WHERE M.visibility = 'public'
+	  AND name_initial(M.name) = ` + args.Add(initial) + `
+	  AND ` + after.afterSql(initialModelsOrder, "M.id", false, &args) + `
+	ORDER BY ` + orderSql(initialModelsOrder, "M.id", false) + `
+	LIMIT ` + args.Add(limit)
+	var rows []*keyedModel
+	err := db.Api.reader(db.DB).SQL(sql, args...).QueryStructs(&rows)
+	models := make([]*Model, 0, len(rows))
+	for _, row := range rows {
+		models = append(models, &row.Model)
+	}
+	var next *PageKey
+	if len(rows) == limit {
+		last := rows[len(rows)-1]
+		next = last.pageKey(len(initialModelsOrder), last.Id)
+	}
+	return models, next, err
+}
+
+// NamespaceInitials counts the users who own public models by the letter
+// their usernames start with, in alphabetical order, leaving out letters with
+// none.
+func (db *ModelDb) NamespaceInitials() ([]*InitialCount, error) {
+	var counts []*InitialCount
+	err := db.Api.reader(db.DB).SQL(`
+	SELECT name_initial(U.username) AS initial, COUNT(*) AS count
+	FROM auth_user U
+	WHERE EXISTS (
+		SELECT 1 FROM model M WHERE M.user_id = U.id AND M.visibility = 'public')
+	GROUP BY 1
+	ORDER BY 1
+	`).QueryStructs(&counts)
+	if counts == nil {
+		counts = []*InitialCount{}
+	}
+	return counts, err
+}
+
+// Namespaces lists a page of the users who own public models, with how many,
+// alphabetically, starting after the key.  With an initial, only usernames
+// starting with that letter are listed.  It also returns the key the next
+// page starts after, if there might be one.
+func (db *ModelDb) Namespaces(initial string, limit int, after *PageKey) ([]*Namespace, *PageKey, error) {
+	var args sqlArgs
+	where := "TRUE"
+	if initial != "" {
+		where = "name_initial(U.username) = " + args.Add(initial)
+	}
+	sql := `
+	SELECT U.id AS user_id, U.username, COUNT(*) AS models, ` + keysSql(namespacesOrder) + `
+	FROM auth_user U
+	JOIN model M ON (M.user_id = U.id AND M.visibility = 'public')
+	WHERE ` + where + `
+	  AND ` + after.afterSql(namespacesOrder, "U.id", false, &args) + `
+	GROUP BY U.id
+	ORDER BY ` + orderSql(namespacesOrder, "U.id", false) + `
+	LIMIT ` + args.Add(limit)
+	var rows []*keyedNamespace
+	err := db.Api.reader(db.DB).SQL(sql, args...).QueryStructs(&rows)
+	namespaces := make([]*Namespace, 0, len(rows))
+	for _, row := range rows {
+		namespaces = append(namespaces, &row.Namespace)
+	}
+	var next *PageKey
+	if len(rows) == limit {
+		last := rows[len(rows)-1]
+		next = last.pageKey(len(namespacesOrder), last.UserId)
+	}
+	return namespaces, next, err
 }
@@ -0,0 +1,104 @@
+package models
+
+import (
+	"time"
+
+	"gopkg.in/guregu/null.v3"
+	runner "gopkg.in/mgutz/dat.v1/sqlx-runner"
+)
+
+const MODEL_LEADERBOARD_TABLE = "model_leaderboard"
+
+// How far back each leaderboard counts downloads, where 0 means forever
+var LeaderboardPeriods = map[string]time.Duration{
+	"day":   24 * time.Hour,
+	"week":  7 * 24 * time.Hour,
+	"month": 30 * 24 * time.Hour,
+	"all":   0,
+}
+
+type ModelLeaderboardDb struct {
+	DB  *runner.DB
+	Api *ApiCollection
+}
+
+//go:generate counterfeiter $GOFILE ModelLeaderboardApi
+type ModelLeaderboardApi interface {
+	Refresh(visibility string, size int) error
+	Top(visibility, period string, limit int) ([]*Model, error)
+	Truncate() error
+}
+
+func NewModelLeaderboardDb(db *runner.DB, api *ApiCollection) *ModelLeaderboardDb {
+	return &ModelLeaderboardDb{
+		DB:  db,
+		Api: api,
+	}
+}
+
+// Refresh works out the size most downloaded models with the given visibility
+// over each of the LeaderboardPeriods, replacing the old leaderboards all at
+// once.  It's the same aggregation ByDownloads does, just done ahead of time.
+func (db *ModelLeaderboardDb) Refresh(visibility string, size int) error {
+	tx, end, err := beginAggregate(db.DB)
+	if err != nil {
+		return err
+	}
+	defer end()
+
+	_, err = tx.SQL(`DELETE FROM model_leaderboard WHERE visibility = $1`, visibility).Exec()
+	if err != nil {
+		return err
+	}
+
+	sql := `
+  INSERT INTO model_leaderboard (visibility, period, rank, model_id, downloads, computed_time)
+  SELECT $1, $2, ROW_NUMBER() OVER (ORDER BY L.downloads DESC, L.model_id ASC),
+    L.model_id, L.downloads, NOW()
+  FROM (
+    SELECT
+      F.model_id AS model_id,
+      COALESCE(SUM(CASE WHEN $3::TIMESTAMPTZ IS NULL OR DH.t >= $3 THEN DH.downloads ELSE 0 END), 0) AS downloads
+    FROM (` + DownloadsSql("file_id IN (SELECT F.id FROM file F JOIN model M ON (M.id = F.model_id) WHERE M.visibility = $1)") + `) DH
+    JOIN file F ON (F.id = DH.file_id)
+    GROUP BY F.model_id
+    ORDER BY downloads DESC, model_id ASC
+    LIMIT $4
+  ) L
+  `
+	now := time.Now().UTC()
+	for period, window := range LeaderboardPeriods {
+		since := null.Time{}
+		if window > 0 {
+			since = null.TimeFrom(now.Add(-window))
+		}
+		if _, err = tx.SQL(sql, visibility, period, since, size).Exec(); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Top lists the first limit models on a leaderboard, most downloaded first,
+// leaving out any whose visibility has changed since it was refreshed.
+func (db *ModelLeaderboardDb) Top(visibility, period string, limit int) ([]*Model, error) {
+	sql := `
+  SELECT M.*
+  FROM model_leaderboard L
+  JOIN model M ON (M.id = L.model_id)
+  WHERE L.visibility = $1 AND L.period = $2 AND M.visibility = $1
+  ORDER BY L.rank ASC
+  LIMIT $3
+  `
+	var models []*Model
+	err := db.Api.reader(db.DB).SQL(sql, visibility, period, limit).QueryStructs(&models)
+	if models == nil {
+		models = []*Model{}
+	}
+	return models, err
+}
+
+func (db *ModelLeaderboardDb) Truncate() error {
+	_, err := db.DB.DeleteFrom(MODEL_LEADERBOARD_TABLE).Exec()
+	return err
+}
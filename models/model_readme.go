@@ -0,0 +1,109 @@
+package models
+
+import (
+	"database/sql"
+	"regexp"
+	"time"
+
+	runner "gopkg.in/mgutz/dat.v1/sqlx-runner"
+)
+
+const MODEL_README_TABLE = "model_readme"
+
+// The language readmes are in unless their owners say otherwise
+const DEFAULT_README_LANGUAGE = "en"
+
+// Language codes are BCP 47 tags like "en", "pt-br" or "zh-hant", kept in
+// lowercase
+var languageRegexp = regexp.MustCompile(`^[a-z]{2,3}(-[a-z0-9]{2,8})*$`)
+
+func ValidLanguage(language string) bool {
+	return len(language) <= 35 && languageRegexp.MatchString(language)
+}
+
+type ModelReadmeDb struct {
+	DB  *runner.DB
+	Api *ApiCollection
+}
+
+//go:generate counterfeiter $GOFILE ModelReadmeApi
+type ModelReadmeApi interface {
+	Get(modelId, language string) (*ModelReadme, error)
+	Put(modelId, language, readme string) error
+	Remove(modelId, language string) error
+	Languages(modelId string) ([]string, error)
+	Truncate() error
+}
+
+func NewModelReadmeDb(db *runner.DB, api *ApiCollection) *ModelReadmeDb {
+	return &ModelReadmeDb{
+		DB:  db,
+		Api: api,
+	}
+}
+
+// ModelReadme is a translation of a model's readme into another language
+// than the one on the model itself.
+type ModelReadme struct {
+	ModelId     string    `db:"model_id" json:"model_id"`
+	Language    string    `db:"language" json:"language"`
+	Readme      string    `db:"readme" json:"readme"`
+	UpdatedTime time.Time `db:"updated_time" json:"updated_time"`
+}
+
+func (db *ModelReadmeDb) Get(modelId, language string) (*ModelReadme, error) {
+	var r ModelReadme
+	err := db.DB.
+		Select("*").
+		From(MODEL_README_TABLE).
+		Where("model_id = $1 AND language = $2", modelId, language).
+		QueryStruct(&r)
+	if err == sql.ErrNoRows {
+		return nil, err
+	}
+	return &r, err
+}
+
+// Put adds the translation, or replaces the one that's there.
+func (db *ModelReadmeDb) Put(modelId, language, readme string) error {
+	sql := `
+  INSERT INTO
+    model_readme (model_id, language, readme, updated_time)
+  VALUES ($1, $2, $3, $4)
+  ON CONFLICT (model_id, language)
+    DO UPDATE SET readme = $3, updated_time = $4
+  `
+	_, err := db.DB.Exec(sql, modelId, language, readme, time.Now().UTC())
+	db.Api.uncache(modelKey(modelId))
+	return err
+}
+
+func (db *ModelReadmeDb) Remove(modelId, language string) error {
+	_, err := db.DB.
+		DeleteFrom(MODEL_README_TABLE).
+		Where("model_id = $1 AND language = $2", modelId, language).
+		Exec()
+	db.Api.uncache(modelKey(modelId))
+	return err
+}
+
+// Languages lists the languages the model's readme has been translated into,
+// alphabetically.
+func (db *ModelReadmeDb) Languages(modelId string) ([]string, error) {
+	var languages []string
+	err := db.DB.
+		Select("language").
+		From(MODEL_README_TABLE).
+		Where("model_id = $1", modelId).
+		OrderBy("language ASC").
+		QuerySlice(&languages)
+	if languages == nil {
+		languages = []string{}
+	}
+	return languages, err
+}
+
+func (db *ModelReadmeDb) Truncate() error {
+	_, err := db.DB.DeleteFrom(MODEL_README_TABLE).Exec()
+	return err
+}
@@ -0,0 +1,139 @@
+package models
+
+import (
+	"time"
+
+	runner "gopkg.in/mgutz/dat.v1/sqlx-runner"
+)
+
+const MODEL_RELATED_TABLE = "model_related"
+
+type ModelRelatedDb struct {
+	DB  *runner.DB
+	Api *ApiCollection
+}
+
+// RelatedModel is a model suggested alongside another, and why
+type RelatedModel struct {
+	Model           `json:"-"`
+	CoDownloads     int     `db:"co_downloads" json:"co_downloads"`
+	SharedFramework bool    `db:"shared_framework" json:"shared_framework"`
+	Score           float64 `db:"score" json:"score"`
+}
+
+//go:generate counterfeiter $GOFILE ModelRelatedApi
+type ModelRelatedApi interface {
+	Refresh(since time.Time, minCoDownloads, maxModelsPerIp int, frameworkWeight float64, size int) error
+	ByModelId(modelId string, limit int) ([]*RelatedModel, error)
+	Truncate() error
+}
+
+func NewModelRelatedDb(db *runner.DB, api *ApiCollection) *ModelRelatedDb {
+	return &ModelRelatedDb{
+		DB:  db,
+		Api: api,
+	}
+}
+
+// Refresh works out up to size related models for every public model,
+// replacing the old ones all at once.  Models are related by how many of the
+// same addresses downloaded both since the given time, counting only pairs
+// with at least minCoDownloads of them, and by sharing a framework, which
+// counts as much as frameworkWeight addresses.  Sharing a framework on its own
+// only relates a model to the most downloaded ones, or everything would be
+// related to everything.  Addresses that downloaded more than maxModelsPerIp
+// models are mirrors or crawlers, and don't say anything about relatedness.
+func (db *ModelRelatedDb) Refresh(since time.Time, minCoDownloads, maxModelsPerIp int, frameworkWeight float64, size int) error {
+	tx, end, err := beginAggregate(db.DB)
+	if err != nil {
+		return err
+	}
+	defer end()
+
+	if _, err = tx.DeleteFrom(MODEL_RELATED_TABLE).Exec(); err != nil {
+		return err
+	}
+
+	sql := `
+  WITH downloaders AS (
+    SELECT DISTINCT F.model_id, DH.ip
+    FROM download_hour DH
+    JOIN file F ON (F.id = DH.file_id)
+    JOIN model M ON (M.id = F.model_id)
+    WHERE M.visibility = 'public' AND DH.hour >= $1
+      AND DH.ip IS NOT NULL AND DH.ip <> ''
+  ), people AS (
+    SELECT ip FROM downloaders GROUP BY ip HAVING COUNT(*) <= $3
+  ), co AS (
+    SELECT A.model_id, B.model_id AS related_model_id, COUNT(*) AS co_downloads
+    FROM downloaders A
+    JOIN downloaders B ON (B.ip = A.ip AND B.model_id <> A.model_id)
+    WHERE A.ip IN (SELECT ip FROM people)
+    GROUP BY A.model_id, B.model_id
+    HAVING COUNT(*) >= $2
+  ), frameworks AS (
+    SELECT DISTINCT F.model_id, F.framework
+    FROM file F
+    JOIN model M ON (M.id = F.model_id)
+    WHERE M.visibility = 'public' AND F.status = 'latest'
+  ), same_framework AS (
+    SELECT DISTINCT A.model_id, B.model_id AS related_model_id
+    FROM frameworks A
+    JOIN frameworks B ON (B.framework = A.framework AND B.model_id <> A.model_id)
+  ), pairs AS (
+    SELECT model_id, related_model_id FROM co
+    UNION
+    SELECT S.model_id, S.related_model_id
+    FROM same_framework S
+    JOIN model_leaderboard L ON (L.model_id = S.related_model_id
+      AND L.visibility = 'public' AND L.period = 'all')
+  ), scored AS (
+    SELECT
+      P.model_id,
+      P.related_model_id,
+      COALESCE(C.co_downloads, 0) AS co_downloads,
+      S.model_id IS NOT NULL AS shared_framework
+    FROM pairs P
+    LEFT JOIN co C ON (C.model_id = P.model_id AND C.related_model_id = P.related_model_id)
+    LEFT JOIN same_framework S ON (S.model_id = P.model_id AND S.related_model_id = P.related_model_id)
+  )
+  INSERT INTO model_related (model_id, related_model_id, co_downloads, shared_framework, score, computed_time)
+  SELECT model_id, related_model_id, co_downloads, shared_framework, score, NOW()
+  FROM (
+    SELECT *, ROW_NUMBER() OVER (PARTITION BY model_id ORDER BY score DESC, related_model_id ASC) AS rank
+    FROM (
+      SELECT *, co_downloads + CASE WHEN shared_framework THEN $4 ELSE 0 END AS score
+      FROM scored
+    ) R
+  ) R
+  WHERE rank <= $5
+  `
+	if _, err = tx.SQL(sql, since, minCoDownloads, maxModelsPerIp, frameworkWeight, size).Exec(); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ByModelId lists the models related to the model, most related first,
+// leaving out any that have been made private since they were worked out.
+func (db *ModelRelatedDb) ByModelId(modelId string, limit int) ([]*RelatedModel, error) {
+	sql := `
+  SELECT M.*, R.co_downloads, R.shared_framework, R.score
+  FROM model_related R
+  JOIN model M ON (M.id = R.related_model_id)
+  WHERE R.model_id = $1 AND M.visibility = 'public'
+  ORDER BY R.score DESC, R.related_model_id ASC
+  LIMIT $2
+  `
+	var related []*RelatedModel
+	err := db.Api.reader(db.DB).SQL(sql, modelId, limit).QueryStructs(&related)
+	if related == nil {
+		related = []*RelatedModel{}
+	}
+	return related, err
+}
+
+func (db *ModelRelatedDb) Truncate() error {
+	_, err := db.DB.DeleteFrom(MODEL_RELATED_TABLE).Exec()
+	return err
+}
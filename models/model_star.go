@@ -0,0 +1,89 @@
+package models
+
+import (
+	"time"
+
+	runner "gopkg.in/mgutz/dat.v1/sqlx-runner"
+)
+
+const MODEL_STAR_TABLE = "model_star"
+
+type ModelStarDb struct {
+	DB  *runner.DB
+	Api *ApiCollection
+}
+
+type modelStarCount struct {
+	ModelId string `db:"model_id"`
+	Stars   int    `db:"stars"`
+}
+
+//go:generate counterfeiter $GOFILE ModelStarApi
+type ModelStarApi interface {
+	Star(modelId, userId string) error
+	Unstar(modelId, userId string) error
+	HasStarred(modelId, userId string) (bool, error)
+	CountsByModelIds(modelIds []string) (map[string]int, error)
+	Truncate() error
+}
+
+func NewModelStarDb(db *runner.DB, api *ApiCollection) *ModelStarDb {
+	return &ModelStarDb{
+		DB:  db,
+		Api: api,
+	}
+}
+
+// Star marks the model as starred by the user, which they can only do once.
+func (db *ModelStarDb) Star(modelId, userId string) error {
+	sql := `
+  INSERT INTO
+    model_star (model_id, user_id, created_time)
+  VALUES ($1, $2, $3)
+  ON CONFLICT ON CONSTRAINT model_star_model_id_user_id_key DO NOTHING
+  `
+	_, err := db.DB.Exec(sql, modelId, userId, time.Now().UTC())
+	return err
+}
+
+func (db *ModelStarDb) Unstar(modelId, userId string) error {
+	_, err := db.DB.
+		DeleteFrom(MODEL_STAR_TABLE).
+		Where("model_id = $1 AND user_id = $2", modelId, userId).
+		Exec()
+	return err
+}
+
+func (db *ModelStarDb) HasStarred(modelId, userId string) (bool, error) {
+	var count int
+	err := db.DB.SQL(`
+  SELECT COUNT(*) FROM model_star WHERE model_id = $1 AND user_id = $2
+  `, modelId, userId).QueryScalar(&count)
+	return count > 0, err
+}
+
+func (db *ModelStarDb) CountsByModelIds(modelIds []string) (map[string]int, error) {
+	counts := map[string]int{}
+	if len(modelIds) == 0 {
+		return counts, nil
+	}
+	var stars []*modelStarCount
+	err := db.Api.reader(db.DB).SQL(`
+  SELECT model_id, COUNT(*) AS stars
+  FROM model_star
+  WHERE model_id IN $1
+  GROUP BY model_id
+  `, modelIds).QueryStructs(&stars)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range stars {
+		counts[s.ModelId] = s.Stars
+	}
+	return counts, nil
+}
+
+func (db *ModelStarDb) Truncate() error {
+	_, err := db.DB.DeleteFrom(MODEL_STAR_TABLE).Exec()
+	return err
+}
@@ -0,0 +1,133 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	runner "gopkg.in/mgutz/dat.v1/sqlx-runner"
+)
+
+const MODEL_TRENDING_TABLE = "model_trending"
+
+// A model's trending score adds up its downloads, its stars, and how recently
+// a file was uploaded to it, each one counting for half as much every
+// TRENDING_HALF_LIFE.  A star is worth TRENDING_STAR_WEIGHT downloads, and a
+// brand new upload TRENDING_UPLOAD_WEIGHT.  Downloads from longer ago than
+// TRENDING_WINDOW are too decayed to bother adding up.  Anonymous downloads
+// can be made to count for more or less than signed in ones, which are mostly
+// owners and their CI.
+const (
+	TRENDING_HALF_LIFE     = 48 * time.Hour
+	TRENDING_WINDOW        = 14 * 24 * time.Hour
+	TRENDING_STAR_WEIGHT   = 5
+	TRENDING_UPLOAD_WEIGHT = 10
+)
+
+type ModelTrendingDb struct {
+	DB  *runner.DB
+	Api *ApiCollection
+}
+
+// TrendingModel is a public model along with its trending score as of the
+// last time they were worked out.
+type TrendingModel struct {
+	Model
+	Score float64 `db:"score" json:"score"`
+}
+
+//go:generate counterfeiter $GOFILE ModelTrendingApi
+type ModelTrendingApi interface {
+	Recompute(anonymousWeight float64) error
+	Page(limit int, afterScore float64, afterModelId string) ([]*TrendingModel, error)
+	Truncate() error
+}
+
+func NewModelTrendingDb(db *runner.DB, api *ApiCollection) *ModelTrendingDb {
+	return &ModelTrendingDb{
+		DB:  db,
+		Api: api,
+	}
+}
+
+// Recompute works out every public model's score from scratch, replacing the
+// old ones all at once.  Each anonymous download counts as anonymousWeight
+// signed in ones.
+func (db *ModelTrendingDb) Recompute(anonymousWeight float64) error {
+	tx, end, err := beginAggregate(db.DB)
+	if err != nil {
+		return err
+	}
+	defer end()
+
+	if _, err = tx.SQL(`DELETE FROM model_trending`).Exec(); err != nil {
+		return err
+	}
+
+	// How much something from a given time ago counts for
+	decay := func(t string) string {
+		return fmt.Sprintf("POWER(0.5, EXTRACT(EPOCH FROM NOW() - %s) / $1)", t)
+	}
+	sql := `
+  INSERT INTO model_trending (model_id, score, computed_time)
+  SELECT
+    M.id,
+    COALESCE(D.score, 0) + COALESCE(S.score, 0) + COALESCE(U.score, 0),
+    NOW()
+  FROM model M
+  LEFT JOIN (
+    SELECT F.model_id, SUM((DH.authenticated + (DH.downloads - DH.authenticated) * $5) *
+      ` + decay("DH.t") + `) AS score
+    FROM (` + DownloadsSql("TRUE") + `) DH
+    JOIN file F ON (F.id = DH.file_id)
+    WHERE DH.t >= NOW() - $2 * INTERVAL '1 second'
+    GROUP BY F.model_id
+  ) D ON (D.model_id = M.id)
+  LEFT JOIN (
+    SELECT model_id, SUM($3 * ` + decay("created_time") + `) AS score
+    FROM model_star
+    GROUP BY model_id
+  ) S ON (S.model_id = M.id)
+  LEFT JOIN (
+    SELECT model_id, $4 * ` + decay("MAX(created_time)") + ` AS score
+    FROM file
+    GROUP BY model_id
+  ) U ON (U.model_id = M.id)
+  WHERE M.visibility = 'public'
+  `
+	_, err = tx.SQL(sql, TRENDING_HALF_LIFE.Seconds(), TRENDING_WINDOW.Seconds(),
+		TRENDING_STAR_WEIGHT, TRENDING_UPLOAD_WEIGHT, anonymousWeight).Exec()
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Page lists public models by trending score, highest first, starting after
+// the given score and model id, or from the top if afterModelId is empty.
+func (db *ModelTrendingDb) Page(limit int, afterScore float64, afterModelId string) ([]*TrendingModel, error) {
+	where := "M.visibility = 'public'"
+	args := []interface{}{}
+	if afterModelId != "" {
+		where += " AND (T.score, T.model_id) < ($1, $2::UUID)"
+		args = append(args, afterScore, afterModelId)
+	}
+	sql := `
+  SELECT M.*, T.score
+  FROM model_trending T
+  JOIN model M ON (M.id = T.model_id)
+  WHERE ` + where + `
+  ORDER BY T.score DESC, T.model_id DESC
+  LIMIT ` + fmt.Sprintf("%d", limit)
+
+	var models []*TrendingModel
+	err := db.Api.reader(db.DB).SQL(sql, args...).QueryStructs(&models)
+	if models == nil {
+		models = []*TrendingModel{}
+	}
+	return models, err
+}
+
+func (db *ModelTrendingDb) Truncate() error {
+	_, err := db.DB.DeleteFrom(MODEL_TRENDING_TABLE).Exec()
+	return err
+}
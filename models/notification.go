@@ -0,0 +1,259 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/pborman/uuid"
+	"gopkg.in/guregu/null.v3"
+	runner "gopkg.in/mgutz/dat.v1/sqlx-runner"
+)
+
+const NOTIFICATION_TABLE = "notification"
+const NOTIFICATION_PREFERENCE_TABLE = "notification_preference"
+
+// The kinds of notifications.  Followers and comments don't exist yet, but
+// users can already choose how they'd like to hear about them.
+const (
+	NOTIFY_NEW_FOLLOWER       = "new_follower"
+	NOTIFY_MODEL_COMMENT      = "model_comment"
+	NOTIFY_DOWNLOAD_MILESTONE = "download_milestone"
+	NOTIFY_STORAGE_QUOTA      = "storage_quota"
+	NOTIFY_DOWNLOAD_SPIKE     = "download_spike"
+	NOTIFY_BANDWIDTH_QUOTA    = "bandwidth_quota"
+	NOTIFY_SAVED_SEARCH       = "saved_search"
+)
+
+var NOTIFICATION_KINDS = []string{
+	NOTIFY_NEW_FOLLOWER,
+	NOTIFY_MODEL_COMMENT,
+	NOTIFY_DOWNLOAD_MILESTONE,
+	NOTIFY_STORAGE_QUOTA,
+	NOTIFY_DOWNLOAD_SPIKE,
+	NOTIFY_BANDWIDTH_QUOTA,
+	NOTIFY_SAVED_SEARCH,
+}
+
+// How a kind of notification gets delivered: not at all, in its own e-mail
+// right away, or gathered up into a weekly digest
+const (
+	DELIVERY_OFF       = "off"
+	DELIVERY_IMMEDIATE = "immediate"
+	DELIVERY_DIGEST    = "digest"
+)
+
+// What users get until they choose otherwise.  Running out of storage or
+// bandwidth is urgent, and so is a spike in downloads since it's over by the time a digest
+// goes out.  The rest can wait for the digest.
+var DEFAULT_DELIVERY = map[string]string{
+	NOTIFY_NEW_FOLLOWER:       DELIVERY_DIGEST,
+	NOTIFY_MODEL_COMMENT:      DELIVERY_IMMEDIATE,
+	NOTIFY_DOWNLOAD_MILESTONE: DELIVERY_DIGEST,
+	NOTIFY_STORAGE_QUOTA:      DELIVERY_IMMEDIATE,
+	NOTIFY_DOWNLOAD_SPIKE:     DELIVERY_IMMEDIATE,
+	NOTIFY_BANDWIDTH_QUOTA:    DELIVERY_IMMEDIATE,
+	NOTIFY_SAVED_SEARCH:       DELIVERY_DIGEST,
+}
+
+func ValidNotificationKind(kind string) bool {
+	_, ok := DEFAULT_DELIVERY[kind]
+	return ok
+}
+
+func ValidDelivery(delivery string) bool {
+	return delivery == DELIVERY_OFF || delivery == DELIVERY_IMMEDIATE ||
+		delivery == DELIVERY_DIGEST
+}
+
+type NotificationDb struct {
+	DB  *runner.DB
+	Api *ApiCollection
+}
+
+//go:generate counterfeiter $GOFILE NotificationApi
+type NotificationApi interface {
+	ById(id interface{}) (*Notification, error)
+	Delete(id interface{}) error
+	Save(*Notification) error
+	Truncate() error
+
+	Preferences(userId string) (map[string]string, error)
+	SetPreference(userId, kind, delivery string) error
+	DigestUserIds(olderThan time.Time, limit int) ([]string, error)
+	Unsent(userId string) ([]*Notification, error)
+	MarkSent(ids []string, t time.Time) error
+}
+
+func NewNotificationDb(db *runner.DB, api *ApiCollection) *NotificationDb {
+	return &NotificationDb{
+		DB:  db,
+		Api: api,
+	}
+}
+
+// Notification is something a user is told about by e-mail.  Ones that are
+// delivered right away are saved already sent, for the record; ones waiting
+// for the weekly digest have no SentTime until it goes out.
+type Notification struct {
+	Id          string    `db:"id" json:"id"`
+	UserId      string    `db:"user_id" json:"user_id"`
+	Kind        string    `db:"kind" json:"kind"`
+	Subject     string    `db:"subject" json:"subject"`
+	Body        string    `db:"body" json:"body"`
+	CreatedTime time.Time `db:"created_time" json:"created_time"`
+	SentTime    null.Time `db:"sent_time" json:"sent_time"`
+}
+
+func NewNotification(userId, kind, subject, body string) *Notification {
+	return &Notification{
+		Id:          uuid.NewRandom().String(),
+		UserId:      userId,
+		Kind:        kind,
+		Subject:     subject,
+		Body:        body,
+		CreatedTime: time.Now().UTC(),
+	}
+}
+
+func (db *NotificationDb) ById(id interface{}) (*Notification, error) {
+	var n Notification
+	err := db.DB.
+		Select("*").
+		From(NOTIFICATION_TABLE).
+		Where("id = $1", id).
+		QueryStruct(&n)
+	if err == sql.ErrNoRows {
+		return nil, err
+	}
+	return &n, err
+}
+
+func (db *NotificationDb) Delete(id interface{}) error {
+	_, err := db.DB.
+		DeleteFrom(NOTIFICATION_TABLE).
+		Where("id = $1", id).
+		Exec()
+	return err
+}
+
+func (db *NotificationDb) Save(n *Notification) error {
+	cols := []string{
+		"id",
+		"user_id",
+		"kind",
+		"subject",
+		"body",
+		"created_time",
+		"sent_time",
+	}
+	vals := []interface{}{
+		n.Id,
+		n.UserId,
+		n.Kind,
+		n.Subject,
+		n.Body,
+		n.CreatedTime,
+		n.SentTime,
+	}
+	_, err := db.DB.
+		Upsert(NOTIFICATION_TABLE).
+		Columns(cols...).
+		Values(vals...).
+		Where("id = $1", n.Id).
+		Exec()
+	return err
+}
+
+func (db *NotificationDb) Truncate() error {
+	if _, err := db.DB.DeleteFrom(NOTIFICATION_PREFERENCE_TABLE).Exec(); err != nil {
+		return err
+	}
+	_, err := db.DB.DeleteFrom(NOTIFICATION_TABLE).Exec()
+	return err
+}
+
+// -
+
+// Preferences returns how the user wants each kind of notification
+// delivered, filling in the defaults for kinds they haven't chosen.
+func (db *NotificationDb) Preferences(userId string) (map[string]string, error) {
+	var rows []*struct {
+		Kind     string `db:"kind"`
+		Delivery string `db:"delivery"`
+	}
+	err := db.DB.
+		Select("kind, delivery").
+		From(NOTIFICATION_PREFERENCE_TABLE).
+		Where("user_id = $1", userId).
+		QueryStructs(&rows)
+	if err != nil {
+		return nil, err
+	}
+	prefs := map[string]string{}
+	for kind, delivery := range DEFAULT_DELIVERY {
+		prefs[kind] = delivery
+	}
+	for _, row := range rows {
+		prefs[row.Kind] = row.Delivery
+	}
+	return prefs, nil
+}
+
+func (db *NotificationDb) SetPreference(userId, kind, delivery string) error {
+	sql := `
+  INSERT INTO
+    notification_preference (user_id, kind, delivery)
+  VALUES ($1, $2, $3)
+  ON CONFLICT ON CONSTRAINT notification_preference_user_id_kind_key
+    DO UPDATE SET delivery = $3
+  `
+
+	_, err := db.DB.Exec(sql, userId, kind, delivery)
+	return err
+}
+
+// DigestUserIds lists users who have had a notification waiting for the
+// digest since before olderThan, i.e. whose digest is due.
+func (db *NotificationDb) DigestUserIds(olderThan time.Time, limit int) ([]string, error) {
+	var userIds []string
+	err := db.DB.
+		Select("user_id").
+		From(NOTIFICATION_TABLE).
+		Where("sent_time IS NULL").
+		GroupBy("user_id").
+		Having("MIN(created_time) <= $1", olderThan).
+		Limit(uint64(limit)).
+		QuerySlice(&userIds)
+	if userIds == nil {
+		userIds = []string{}
+	}
+	return userIds, err
+}
+
+// Unsent lists the user's notifications that are waiting for the digest,
+// oldest first.
+func (db *NotificationDb) Unsent(userId string) ([]*Notification, error) {
+	var ns []*Notification
+	err := db.DB.
+		Select("*").
+		From(NOTIFICATION_TABLE).
+		Where("user_id = $1 AND sent_time IS NULL", userId).
+		OrderBy("created_time ASC").
+		QueryStructs(&ns)
+	if ns == nil {
+		ns = []*Notification{}
+	}
+	return ns, err
+}
+
+func (db *NotificationDb) MarkSent(ids []string, t time.Time) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	_, err := db.DB.
+		Update(NOTIFICATION_TABLE).
+		Set("sent_time", t).
+		Where("id IN $1", ids).
+		Exec()
+	return err
+}
@@ -0,0 +1,307 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/pborman/uuid"
+	"gopkg.in/guregu/null.v3"
+	runner "gopkg.in/mgutz/dat.v1/sqlx-runner"
+)
+
+const ORGANIZATION_TABLE = "organization"
+const ORGANIZATION_MEMBER_TABLE = "organization_member"
+
+const gigabyte = 1024 * 1024 * 1024
+
+// What each organization plan, by how many versions of each file its members'
+// models keep, allows in total across all of its members.  Bandwidth is per
+// calendar month.
+var ORG_STORAGE_QUOTAS = map[int]int64{
+	10:    10 * gigabyte,
+	100:   100 * gigabyte,
+	1000:  1000 * gigabyte,
+	10000: 10000 * gigabyte,
+}
+var ORG_BANDWIDTH_QUOTAS = map[int]int64{
+	10:    50 * gigabyte,
+	100:   500 * gigabyte,
+	1000:  5000 * gigabyte,
+	10000: 50000 * gigabyte,
+}
+
+type OrganizationDb struct {
+	DB  *runner.DB
+	Api *ApiCollection
+}
+
+//go:generate counterfeiter $GOFILE OrganizationApi
+type OrganizationApi interface {
+	ById(id interface{}) (*Organization, error)
+	Delete(id interface{}) error
+	Save(*Organization) error
+	Truncate() error
+
+	ByUserId(userId string) (*Organization, error)
+	OrganizationIds(userIds []string) (map[string]string, error)
+	AddMember(orgId, userId string) error
+	RemoveMember(orgId, userId string) error
+	Usage(orgId string, since time.Time) ([]*MemberUsage, error)
+	UsageByUserId(userId string, since time.Time) (*MemberUsage, error)
+	All() ([]*Organization, error)
+	MarkBandwidthWarned(id string, percent int, t time.Time) error
+}
+
+func NewOrganizationDb(db *runner.DB, api *ApiCollection) *OrganizationDb {
+	return &OrganizationDb{
+		DB:  db,
+		Api: api,
+	}
+}
+
+// Organization lets a team share one plan.  Its members' models can use the
+// organization's plan without paying for their own, and their storage and
+// bandwidth are counted together against the plan's quotas.  Each user
+// belongs to at most one organization, and the owner pays for it.
+type Organization struct {
+	Id          string    `db:"id" json:"id"`
+	Name        string    `db:"name" json:"name"`
+	OwnerId     string    `db:"owner_id" json:"owner_id"`
+	Keep        int       `db:"keep" json:"keep"`
+	CreatedTime time.Time `db:"created_time" json:"created_time"`
+
+	// Members can't use their tokens until they've turned on two-factor
+	RequireTwoFactor bool `db:"require_two_factor" json:"require_two_factor"`
+
+	// The highest percentage of its bandwidth quota the owner has been warned
+	// about, and when, so each warning goes out once per month
+	BandwidthWarnedPercent int       `db:"bandwidth_warned_percent" json:"-"`
+	BandwidthWarnedTime    null.Time `db:"bandwidth_warned_time" json:"-"`
+}
+
+// MemberUsage is how much one member of an organization is storing, and how
+// much their files have been downloaded.
+type MemberUsage struct {
+	UserId         string `db:"user_id" json:"user_id"`
+	Username       string `db:"username" json:"username"`
+	StorageBytes   int64  `db:"storage_bytes" json:"storage_bytes"`
+	Downloads      int64  `db:"downloads" json:"downloads"`
+	BandwidthBytes int64  `db:"bandwidth_bytes" json:"bandwidth_bytes"`
+}
+
+func NewOrganization(name, ownerId string) *Organization {
+	return &Organization{
+		Id:          uuid.NewRandom().String(),
+		Name:        name,
+		OwnerId:     ownerId,
+		Keep:        10,
+		CreatedTime: time.Now().UTC(),
+	}
+}
+
+func (org *Organization) StorageQuota() int64 {
+	return ORG_STORAGE_QUOTAS[org.Keep]
+}
+
+func (org *Organization) BandwidthQuota() int64 {
+	return ORG_BANDWIDTH_QUOTAS[org.Keep]
+}
+
+// BandwidthWarned is the highest percentage of its bandwidth quota the owner
+// has been warned about since the month began.
+func (org *Organization) BandwidthWarned(monthStart time.Time) int {
+	if !org.BandwidthWarnedTime.Valid || org.BandwidthWarnedTime.Time.Before(monthStart) {
+		return 0
+	}
+	return org.BandwidthWarnedPercent
+}
+
+func (db *OrganizationDb) ById(id interface{}) (*Organization, error) {
+	var org Organization
+	err := db.DB.
+		Select("*").
+		From(ORGANIZATION_TABLE).
+		Where("id = $1", id).
+		QueryStruct(&org)
+	if err == sql.ErrNoRows {
+		return nil, err
+	}
+	return &org, err
+}
+
+func (db *OrganizationDb) Delete(id interface{}) error {
+	_, err := db.DB.
+		DeleteFrom(ORGANIZATION_TABLE).
+		Where("id = $1", id).
+		Exec()
+	return err
+}
+
+func (db *OrganizationDb) Save(org *Organization) error {
+	cols := []string{
+		"id",
+		"name",
+		"owner_id",
+		"keep",
+		"created_time",
+		"require_two_factor",
+	}
+	vals := []interface{}{
+		org.Id,
+		org.Name,
+		org.OwnerId,
+		org.Keep,
+		org.CreatedTime,
+		org.RequireTwoFactor,
+	}
+	_, err := db.DB.
+		Upsert(ORGANIZATION_TABLE).
+		Columns(cols...).
+		Values(vals...).
+		Where("id = $1", org.Id).
+		Exec()
+	return err
+}
+
+func (db *OrganizationDb) Truncate() error {
+	if _, err := db.DB.DeleteFrom(ORGANIZATION_MEMBER_TABLE).Exec(); err != nil {
+		return err
+	}
+	_, err := db.DB.DeleteFrom(ORGANIZATION_TABLE).Exec()
+	return err
+}
+
+// -
+
+// ByUserId finds the organization the user is a member of.
+func (db *OrganizationDb) ByUserId(userId string) (*Organization, error) {
+	var org Organization
+	err := db.DB.
+		Select("O.*").
+		From("organization O JOIN organization_member OM ON (OM.organization_id = O.id)").
+		Where("OM.user_id = $1", userId).
+		QueryStruct(&org)
+	if err == sql.ErrNoRows {
+		return nil, err
+	}
+	return &org, err
+}
+
+// OrganizationIds looks up the organization each of the users is a member
+// of, by user id.  Users that aren't in one are left out.
+func (db *OrganizationDb) OrganizationIds(userIds []string) (map[string]string, error) {
+	orgIds := map[string]string{}
+	if len(userIds) == 0 {
+		return orgIds, nil
+	}
+	var members []struct {
+		UserId         string `db:"user_id"`
+		OrganizationId string `db:"organization_id"`
+	}
+	err := db.DB.
+		Select("user_id, organization_id").
+		From(ORGANIZATION_MEMBER_TABLE).
+		Where("user_id IN $1", userIds).
+		QueryStructs(&members)
+	for _, m := range members {
+		orgIds[m.UserId] = m.OrganizationId
+	}
+	return orgIds, err
+}
+
+func (db *OrganizationDb) AddMember(orgId, userId string) error {
+	_, err := db.DB.
+		InsertInto(ORGANIZATION_MEMBER_TABLE).
+		Columns("organization_id", "user_id", "created_time").
+		Values(orgId, userId, time.Now().UTC()).
+		Exec()
+	return err
+}
+
+func (db *OrganizationDb) RemoveMember(orgId, userId string) error {
+	_, err := db.DB.
+		DeleteFrom(ORGANIZATION_MEMBER_TABLE).
+		Where("organization_id = $1 AND user_id = $2", orgId, userId).
+		Exec()
+	return err
+}
+
+// The columns of MemberUsage for the user U, with downloads counted since $2
+var memberUsageSql = `
+    U.id AS user_id,
+    U.username AS username,
+    COALESCE((
+      SELECT SUM(F.size_bytes)
+      FROM file F
+      WHERE F.user_id = U.id AND F.status IN ('latest', 'old')
+    ), 0) AS storage_bytes,
+    COALESCE((
+      SELECT SUM(DH.downloads)
+      FROM (` + DownloadsSql("file_id IN (SELECT id FROM file WHERE user_id = U.id)") + `) DH
+      WHERE DH.t >= $2
+    ), 0) AS downloads,
+    COALESCE((
+      SELECT SUM(DH.downloads::BIGINT * F.size_bytes)
+      FROM (` + DownloadsSql("file_id IN (SELECT id FROM file WHERE user_id = U.id)") + `) DH
+      JOIN file F ON (F.id = DH.file_id)
+      WHERE DH.t >= $2
+    ), 0) AS bandwidth_bytes`
+
+// Usage breaks down the organization's storage by member, along with the
+// downloads of each member's files since the given time and the bandwidth they
+// took.  Files are counted whether or not their models are public.
+func (db *OrganizationDb) Usage(orgId string, since time.Time) ([]*MemberUsage, error) {
+	sql := `
+  SELECT ` + memberUsageSql + `
+  FROM organization_member OM
+  JOIN auth_user U ON (U.id = OM.user_id)
+  WHERE OM.organization_id = $1
+  ORDER BY U.username ASC
+  `
+
+	var usage []*MemberUsage
+	err := db.DB.SQL(sql, orgId, since).QueryStructs(&usage)
+	if usage == nil {
+		usage = []*MemberUsage{}
+	}
+	return usage, err
+}
+
+// UsageByUserId is how much the user is storing, and how much their files have
+// been downloaded since the given time, whether or not they belong to an
+// organization.
+func (db *OrganizationDb) UsageByUserId(userId string, since time.Time) (*MemberUsage, error) {
+	sql := `
+  SELECT ` + memberUsageSql + `
+  FROM auth_user U
+  WHERE U.id = $1
+  `
+	var usage MemberUsage
+	if err := db.DB.SQL(sql, userId, since).QueryStruct(&usage); err != nil {
+		return nil, err
+	}
+	return &usage, nil
+}
+
+func (db *OrganizationDb) All() ([]*Organization, error) {
+	var orgs []*Organization
+	err := db.DB.
+		Select("*").
+		From(ORGANIZATION_TABLE).
+		OrderBy("created_time ASC").
+		QueryStructs(&orgs)
+	if orgs == nil {
+		orgs = []*Organization{}
+	}
+	return orgs, err
+}
+
+func (db *OrganizationDb) MarkBandwidthWarned(id string, percent int, t time.Time) error {
+	_, err := db.DB.
+		Update(ORGANIZATION_TABLE).
+		Set("bandwidth_warned_percent", percent).
+		Set("bandwidth_warned_time", t).
+		Where("id = $1", id).
+		Exec()
+	return err
+}
@@ -0,0 +1,82 @@
+package models
+
+import (
+	"time"
+
+	runner "gopkg.in/mgutz/dat.v1/sqlx-runner"
+)
+
+const DOWNLOAD_EVENT_TABLE = "download_event"
+
+// What kind of thing made a download, going by its User-Agent
+const (
+	AGENT_CLIENT  = "client"  // One of our own clients
+	AGENT_SCRIPT  = "script"  // curl, wget, an HTTP library, and so on
+	AGENT_BROWSER = "browser" // Someone clicking a link
+	AGENT_BOT     = "bot"     // A crawler
+	AGENT_OTHER   = "other"
+)
+
+type RawDownloadDb struct {
+	DB  *runner.DB
+	Api *ApiCollection
+}
+
+// RawDownload is a single download, kept for a while for analytics that the
+// hourly counts can't answer.  Nothing in it identifies who downloaded the
+// file: NetworkHash is a keyed hash of the network their address was in, not
+// the address itself, and AgentClass is a handful of broad kinds of client.
+type RawDownload struct {
+	Id          int64     `db:"id" json:"-"`
+	FileId      string    `db:"file_id" json:"file_id"`
+	NetworkHash string    `db:"network_hash" json:"network_hash"`
+	AgentClass  string    `db:"agent_class" json:"agent_class"`
+	CreatedTime time.Time `db:"created_time" json:"created_time"`
+}
+
+//go:generate counterfeiter $GOFILE RawDownloadApi
+type RawDownloadApi interface {
+	Record(downloads []*RawDownload) error
+	Scrub(before time.Time) (int64, error)
+	Truncate() error
+}
+
+func NewRawDownloadDb(db *runner.DB, api *ApiCollection) *RawDownloadDb {
+	return &RawDownloadDb{
+		DB:  db,
+		Api: api,
+	}
+}
+
+// Record adds a batch of downloads all at once.
+func (db *RawDownloadDb) Record(downloads []*RawDownload) error {
+	if len(downloads) == 0 {
+		return nil
+	}
+	b := db.DB.
+		InsertInto(DOWNLOAD_EVENT_TABLE).
+		Columns("file_id", "network_hash", "agent_class", "created_time")
+	for _, d := range downloads {
+		b = b.Values(d.FileId, d.NetworkHash, d.AgentClass, d.CreatedTime)
+	}
+	_, err := b.Exec()
+	return err
+}
+
+// Scrub deletes every download from before the given time, and returns how
+// many it deleted.
+func (db *RawDownloadDb) Scrub(before time.Time) (int64, error) {
+	res, err := db.DB.
+		DeleteFrom(DOWNLOAD_EVENT_TABLE).
+		Where("created_time < $1", before).
+		Exec()
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected, nil
+}
+
+func (db *RawDownloadDb) Truncate() error {
+	_, err := db.DB.DeleteFrom(DOWNLOAD_EVENT_TABLE).Exec()
+	return err
+}
@@ -0,0 +1,156 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/ericflo/gradientzoo/utils"
+	"github.com/pborman/uuid"
+	"gopkg.in/guregu/null.v3"
+	runner "gopkg.in/mgutz/dat.v1/sqlx-runner"
+)
+
+const REFRESH_TOKEN_TABLE = "refresh_token"
+
+type RefreshTokenDb struct {
+	DB  *runner.DB
+	Api *ApiCollection
+}
+
+//go:generate counterfeiter $GOFILE RefreshTokenApi
+type RefreshTokenApi interface {
+	ById(id interface{}) (*RefreshToken, error)
+	Delete(id interface{}) error
+	Save(*RefreshToken) error
+	Truncate() error
+
+	Use(id string) (*RefreshToken, error)
+	DeleteByUserId(userId string) error
+	DeleteByUserIds(userIds []string) error
+}
+
+func NewRefreshTokenDb(db *runner.DB, api *ApiCollection) *RefreshTokenDb {
+	return &RefreshTokenDb{
+		DB:  db,
+		Api: api,
+	}
+}
+
+// RefreshToken can be traded in once for a new session and a new refresh
+// token.  Since each one can only be used once, seeing a used one again means
+// it was copied, and the user's sessions should all be revoked.
+type RefreshToken struct {
+	Id          string    `db:"id" json:"id"`
+	UserId      string    `db:"user_id" json:"user_id"`
+	CreatedTime time.Time `db:"created_time" json:"created_time"`
+	ExpiresTime time.Time `db:"expires_time" json:"expires_time"`
+	UsedTime    null.Time `db:"used_time" json:"-"`
+}
+
+func NewRefreshToken(userId string) *RefreshToken {
+	now := time.Now().UTC()
+	ttl := time.Duration(utils.Conf.RefreshTTLDays) * 24 * time.Hour
+	return &RefreshToken{
+		Id:          uuid.NewRandom().String(),
+		UserId:      userId,
+		CreatedTime: now,
+		ExpiresTime: now.Add(ttl),
+	}
+}
+
+func (rt *RefreshToken) Expired() bool {
+	return !time.Now().Before(rt.ExpiresTime)
+}
+
+func (db *RefreshTokenDb) ById(id interface{}) (*RefreshToken, error) {
+	var rt RefreshToken
+	err := db.DB.
+		Select("*").
+		From(REFRESH_TOKEN_TABLE).
+		Where("id = $1", id).
+		QueryStruct(&rt)
+	if err == sql.ErrNoRows {
+		return nil, err
+	}
+	return &rt, err
+}
+
+func (db *RefreshTokenDb) Delete(id interface{}) error {
+	_, err := db.DB.
+		DeleteFrom(REFRESH_TOKEN_TABLE).
+		Where("id = $1", id).
+		Exec()
+	return err
+}
+
+func (db *RefreshTokenDb) Save(rt *RefreshToken) error {
+	cols := []string{
+		"id",
+		"user_id",
+		"created_time",
+		"expires_time",
+		"used_time",
+	}
+	vals := []interface{}{
+		rt.Id,
+		rt.UserId,
+		rt.CreatedTime,
+		rt.ExpiresTime,
+		rt.UsedTime,
+	}
+	_, err := db.DB.
+		Upsert(REFRESH_TOKEN_TABLE).
+		Columns(cols...).
+		Values(vals...).
+		Where("id = $1", rt.Id).
+		Exec()
+	return err
+}
+
+func (db *RefreshTokenDb) Truncate() error {
+	_, err := db.DB.DeleteFrom(REFRESH_TOKEN_TABLE).Exec()
+	return err
+}
+
+// -
+
+// Use marks the refresh token as used and returns it.  Marking it is done in
+// the same statement that checks it, so that two requests racing with the
+// same token can't both succeed.  A token that was already used is returned
+// as it is, with UsedTime set, so callers can tell reuse apart from a token
+// that doesn't exist.
+func (db *RefreshTokenDb) Use(id string) (*RefreshToken, error) {
+	var rt RefreshToken
+	err := db.DB.SQL(`
+	UPDATE refresh_token
+	SET used_time = NOW()
+	WHERE id = $1 AND used_time IS NULL
+	RETURNING id, user_id, created_time, expires_time, NULL AS used_time
+	`, id).QueryStruct(&rt)
+	if err == sql.ErrNoRows {
+		return db.ById(id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &rt, nil
+}
+
+func (db *RefreshTokenDb) DeleteByUserId(userId string) error {
+	_, err := db.DB.
+		DeleteFrom(REFRESH_TOKEN_TABLE).
+		Where("user_id = $1", userId).
+		Exec()
+	return err
+}
+
+// DeleteByUserIds deletes the given users' refresh tokens, or everyone's if
+// userIds is nil.
+func (db *RefreshTokenDb) DeleteByUserIds(userIds []string) error {
+	q := db.DB.DeleteFrom(REFRESH_TOKEN_TABLE)
+	if userIds != nil {
+		q = q.Where("user_id IN $1", userIds)
+	}
+	_, err := q.Exec()
+	return err
+}
@@ -0,0 +1,79 @@
+package models
+
+import (
+	"sync/atomic"
+
+	runner "gopkg.in/mgutz/dat.v1/sqlx-runner"
+)
+
+// Reads that can stand to be a moment behind, like listings, stats, and the
+// counts and users that hydrate them, can go to a read replica.  They only do
+// when they're made through the ApiCollection that ReadingReplica returns,
+// which is what GET requests from people who haven't just written something
+// they'd expect to see are given.  Everything else, including every write and
+// all background work, goes to the primary.  When the replica falls too far
+// behind, or can't be reached, everything goes to the primary until it
+// catches up.
+
+// Set while the replica is close enough to the primary to use
+var replicaHealthy int32
+
+// SetReplica has reads that can go to a replica go to this one, when they're
+// made through ReadingReplica.
+func (api *ApiCollection) SetReplica(db *runner.DB) {
+	api.replica = db
+	reading := NewApiCollection(api.primary)
+	reading.replica = db
+	reading.readsReplica = true
+	reading.cache, reading.cacheTTL = api.cache, api.cacheTTL
+	api.reading = reading
+	atomic.StoreInt32(&replicaHealthy, 1)
+}
+
+// Replica is the read replica, or nil if there isn't one.
+func (api *ApiCollection) Replica() *runner.DB {
+	return api.replica
+}
+
+// ReadingReplica is the same as api, except that reads that can stand to be
+// behind go to the replica.  It's api itself if there's no replica.
+func (api *ApiCollection) ReadingReplica() *ApiCollection {
+	if api.reading == nil {
+		return api
+	}
+	return api.reading
+}
+
+// SetReplicaHealthy says whether the replica's close enough to the primary to
+// read from.
+func SetReplicaHealthy(healthy bool) {
+	var v int32
+	if healthy {
+		v = 1
+	}
+	atomic.StoreInt32(&replicaHealthy, v)
+}
+
+// reader is where a read that can stand to be behind should go: the replica
+// if this is the collection that reads from it and it's healthy, or else the
+// primary.
+func (api *ApiCollection) reader(primary *runner.DB) *runner.DB {
+	if !api.readsReplica || atomic.LoadInt32(&replicaHealthy) == 0 {
+		return primary
+	}
+	return api.replica
+}
+
+// ReplicaLag is how many seconds the replica is behind the primary.  A replica
+// that's replayed everything it's received is caught up, however long ago the
+// last write was.
+func (api *ApiCollection) ReplicaLag() (float64, error) {
+	var lag float64
+	err := api.replica.SQL(`
+	SELECT CASE
+		WHEN pg_last_xlog_receive_location() = pg_last_xlog_replay_location() THEN 0
+		ELSE COALESCE(EXTRACT(EPOCH FROM NOW() - pg_last_xact_replay_timestamp()), 0)
+	END
+	`).QueryScalar(&lag)
+	return lag, err
+}
@@ -0,0 +1,201 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/pborman/uuid"
+	runner "gopkg.in/mgutz/dat.v1/sqlx-runner"
+)
+
+const SAVED_SEARCH_TABLE = "saved_search"
+
+// The most searches a user can save
+const MAX_SAVED_SEARCHES = 50
+
+type SavedSearchDb struct {
+	DB  *runner.DB
+	Api *ApiCollection
+}
+
+//go:generate counterfeiter $GOFILE SavedSearchApi
+type SavedSearchApi interface {
+	ById(id interface{}) (*SavedSearch, error)
+	Delete(id interface{}) error
+	Save(*SavedSearch) error
+	Truncate() error
+
+	ByUserId(userId string) ([]*SavedSearch, error)
+	Due(checkedBefore time.Time, limit int) ([]*SavedSearch, error)
+	MarkChecked(id string, t time.Time) error
+}
+
+func NewSavedSearchDb(db *runner.DB, api *ApiCollection) *SavedSearchDb {
+	return &SavedSearchDb{
+		DB:  db,
+		Api: api,
+	}
+}
+
+// SavedSearch is a search a user wants to come back to: the text they
+// searched for, and the filter query params that went with it, like
+// {"framework": "keras"}.  With Notify on, they're told about new public
+// models that match it, as of CheckedTime.
+type SavedSearch struct {
+	Id           string            `db:"id" json:"id"`
+	UserId       string            `db:"user_id" json:"user_id"`
+	Name         string            `db:"name" json:"name"`
+	Query        string            `db:"query" json:"query"`
+	FilterString string            `db:"filter" json:"-"`
+	Filter       map[string]string `db:"-" json:"filter"`
+	Notify       bool              `db:"notify" json:"notify"`
+	CreatedTime  time.Time         `db:"created_time" json:"created_time"`
+	CheckedTime  time.Time         `db:"checked_time" json:"checked_time"`
+}
+
+func NewSavedSearch(userId, name, query string, filter map[string]string, notify bool) (*SavedSearch, error) {
+	now := time.Now().UTC()
+	s := &SavedSearch{
+		Id:          uuid.NewRandom().String(),
+		UserId:      userId,
+		Name:        name,
+		Query:       query,
+		Notify:      notify,
+		CreatedTime: now,
+		CheckedTime: now,
+	}
+	if err := s.SetFilter(filter); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *SavedSearch) SetFilter(filter map[string]string) error {
+	encoded, err := json.Marshal(filter)
+	if err != nil {
+		return err
+	}
+	s.Filter = filter
+	s.FilterString = string(encoded)
+	return nil
+}
+
+func (s *SavedSearch) FillFilter() error {
+	s.Filter = map[string]string{}
+	if s.FilterString == "" {
+		return nil
+	}
+	return json.Unmarshal([]byte(s.FilterString), &s.Filter)
+}
+
+func (db *SavedSearchDb) ById(id interface{}) (*SavedSearch, error) {
+	var s SavedSearch
+	err := db.DB.
+		Select("*").
+		From(SAVED_SEARCH_TABLE).
+		Where("id = $1", id).
+		QueryStruct(&s)
+	if err == sql.ErrNoRows {
+		return nil, err
+	}
+	if err = s.FillFilter(); err != nil {
+		return nil, err
+	}
+	return &s, err
+}
+
+func (db *SavedSearchDb) Delete(id interface{}) error {
+	_, err := db.DB.
+		DeleteFrom(SAVED_SEARCH_TABLE).
+		Where("id = $1", id).
+		Exec()
+	return err
+}
+
+func (db *SavedSearchDb) Save(s *SavedSearch) error {
+	cols := []string{
+		"id",
+		"user_id",
+		"name",
+		"query",
+		"filter",
+		"notify",
+		"created_time",
+		"checked_time",
+	}
+	vals := []interface{}{
+		s.Id,
+		s.UserId,
+		s.Name,
+		s.Query,
+		s.FilterString,
+		s.Notify,
+		s.CreatedTime,
+		s.CheckedTime,
+	}
+	_, err := db.DB.
+		Upsert(SAVED_SEARCH_TABLE).
+		Columns(cols...).
+		Values(vals...).
+		Where("id = $1", s.Id).
+		Exec()
+	return err
+}
+
+func (db *SavedSearchDb) Truncate() error {
+	_, err := db.DB.DeleteFrom(SAVED_SEARCH_TABLE).Exec()
+	return err
+}
+
+// -
+
+func (db *SavedSearchDb) ByUserId(userId string) ([]*SavedSearch, error) {
+	var searches []*SavedSearch
+	err := db.DB.
+		Select("*").
+		From(SAVED_SEARCH_TABLE).
+		Where("user_id = $1", userId).
+		OrderBy("created_time ASC").
+		QueryStructs(&searches)
+	if searches == nil {
+		searches = []*SavedSearch{}
+	}
+	for _, s := range searches {
+		if err = s.FillFilter(); err != nil {
+			return nil, err
+		}
+	}
+	return searches, err
+}
+
+// Due lists the searches that want notifications and haven't been checked
+// since checkedBefore, the longest waiting first.
+func (db *SavedSearchDb) Due(checkedBefore time.Time, limit int) ([]*SavedSearch, error) {
+	var searches []*SavedSearch
+	err := db.DB.
+		Select("*").
+		From(SAVED_SEARCH_TABLE).
+		Where("notify AND checked_time < $1", checkedBefore).
+		OrderBy("checked_time ASC").
+		Limit(uint64(limit)).
+		QueryStructs(&searches)
+	if searches == nil {
+		searches = []*SavedSearch{}
+	}
+	for _, s := range searches {
+		if err = s.FillFilter(); err != nil {
+			return nil, err
+		}
+	}
+	return searches, err
+}
+
+func (db *SavedSearchDb) MarkChecked(id string, t time.Time) error {
+	_, err := db.DB.
+		Update(SAVED_SEARCH_TABLE).
+		Set("checked_time", t).
+		Where("id = $1", id).
+		Exec()
+	return err
+}
@@ -0,0 +1,167 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	runner "gopkg.in/mgutz/dat.v1/sqlx-runner"
+)
+
+const SEARCH_INDEX_QUEUE_TABLE = "search_index_queue"
+
+type SearchIndexDb struct {
+	DB  *runner.DB
+	Api *ApiCollection
+}
+
+// SearchIndexEntry is a model waiting to be indexed again.  Triggers queue
+// models whenever they or their files change, so nothing else has to.
+type SearchIndexEntry struct {
+	ModelId    string    `db:"model_id"`
+	QueuedTime time.Time `db:"queued_time"`
+}
+
+// SearchDoc is everything an external search index keeps about a model
+type SearchDoc struct {
+	Id          string    `db:"id" json:"id"`
+	UserId      string    `db:"user_id" json:"user_id"`
+	Slug        string    `db:"slug" json:"slug"`
+	Name        string    `db:"name" json:"name"`
+	Description string    `db:"description" json:"description"`
+	Readme      string    `db:"readme" json:"readme"` // With its translations after it
+	License     string    `db:"license" json:"license"`
+	Visibility  string    `db:"visibility" json:"visibility"`
+	SizeBytes   int64     `db:"size_bytes" json:"size_bytes"`
+	Downloads   int       `db:"downloads" json:"downloads"`
+	CreatedTime time.Time `db:"created_time" json:"created_time"`
+	UpdatedTime time.Time `db:"updated_time" json:"updated_time"`
+
+	// Frameworks its latest files are for
+	FrameworkList string   `db:"frameworks" json:"-"`
+	Frameworks    []string `db:"-" json:"frameworks"`
+}
+
+//go:generate counterfeiter $GOFILE SearchIndexApi
+type SearchIndexApi interface {
+	Pending(limit int) ([]*SearchIndexEntry, error)
+	Done(entries []*SearchIndexEntry) error
+	QueueAll() error
+	Depth() (int, error)
+	Docs(modelIds []string) ([]*SearchDoc, error)
+	Truncate() error
+}
+
+func NewSearchIndexDb(db *runner.DB, api *ApiCollection) *SearchIndexDb {
+	return &SearchIndexDb{
+		DB:  db,
+		Api: api,
+	}
+}
+
+// Pending lists the models that have waited longest to be indexed.
+func (db *SearchIndexDb) Pending(limit int) ([]*SearchIndexEntry, error) {
+	var entries []*SearchIndexEntry
+	err := db.DB.
+		Select("*").
+		From(SEARCH_INDEX_QUEUE_TABLE).
+		OrderBy("queued_time ASC").
+		Limit(uint64(limit)).
+		QueryStructs(&entries)
+	if entries == nil {
+		entries = []*SearchIndexEntry{}
+	}
+	return entries, err
+}
+
+// Done takes the entries off the queue, unless their models were queued again
+// since, in which case they stay on it to be indexed once more.
+func (db *SearchIndexDb) Done(entries []*SearchIndexEntry) error {
+	for _, e := range entries {
+		_, err := db.DB.
+			DeleteFrom(SEARCH_INDEX_QUEUE_TABLE).
+			Where("model_id = $1 AND queued_time = $2", e.ModelId, e.QueuedTime).
+			Exec()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// QueueAll queues every model, for the things that change without a trigger
+// firing, like download counts.
+func (db *SearchIndexDb) QueueAll() error {
+	sql := `
+	INSERT INTO ` + SEARCH_INDEX_QUEUE_TABLE + ` (model_id, queued_time)
+	SELECT M.id, NOW()
+	FROM model M
+	WHERE NOT EXISTS (
+		SELECT 1 FROM ` + SEARCH_INDEX_QUEUE_TABLE + ` Q WHERE Q.model_id = M.id
+	)
+	`
+	_, err := db.DB.SQL(sql).Exec()
+	return err
+}
+
+// Depth is how many models are waiting to be indexed.
+func (db *SearchIndexDb) Depth() (int, error) {
+	var depth int
+	err := db.DB.
+		Select("COUNT(*)").
+		From(SEARCH_INDEX_QUEUE_TABLE).
+		QueryScalar(&depth)
+	return depth, err
+}
+
+// Docs builds the search documents for the models.  Models that no longer
+// exist are left out.
+func (db *SearchIndexDb) Docs(modelIds []string) ([]*SearchDoc, error) {
+	if len(modelIds) == 0 {
+		return []*SearchDoc{}, nil
+	}
+	sql := `
+	SELECT
+		M.id, M.user_id, M.slug, M.name, M.description, M.license,
+		concat_ws(E'\n\n', M.readme, (
+			SELECT string_agg(R.readme, E'\n\n' ORDER BY R.language)
+			FROM model_readme R WHERE R.model_id = M.id
+		)) AS readme,
+		M.visibility, M.created_time,
+		COALESCE(L.size_bytes, 0) AS size_bytes,
+		COALESCE(L.frameworks, '') AS frameworks,
+		GREATEST(M.created_time, COALESCE(L.updated_time, M.created_time)) AS updated_time,
+		COALESCE((
+			SELECT SUM(DH.downloads)
+			FROM (` + DownloadsSql("file_id IN (SELECT id FROM file WHERE model_id = M.id)") + `) DH
+		), 0) AS downloads
+	FROM model M
+	LEFT JOIN (
+		SELECT
+			model_id,
+			SUM(size_bytes) AS size_bytes,
+			string_agg(DISTINCT framework, ',') AS frameworks,
+			MAX(created_time) AS updated_time
+		FROM file
+		WHERE model_id IN $1 AND status = 'latest'
+		GROUP BY model_id
+	) L ON (L.model_id = M.id)
+	WHERE M.id IN $1
+	`
+	var docs []*SearchDoc
+	err := db.DB.SQL(sql, modelIds).QueryStructs(&docs)
+	if docs == nil {
+		docs = []*SearchDoc{}
+	}
+	for _, doc := range docs {
+		doc.Frameworks = []string{}
+		if doc.FrameworkList != "" {
+			doc.Frameworks = strings.Split(doc.FrameworkList, ",")
+		}
+	}
+	return docs, err
+}
+
+func (db *SearchIndexDb) Truncate() error {
+	_, err := db.DB.DeleteFrom(SEARCH_INDEX_QUEUE_TABLE).Exec()
+	return err
+}
@@ -0,0 +1,144 @@
+package models
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"time"
+
+	"github.com/pborman/uuid"
+	"gopkg.in/guregu/null.v3"
+	runner "gopkg.in/mgutz/dat.v1/sqlx-runner"
+)
+
+const SECURITY_WEBHOOK_TABLE = "security_webhook"
+
+type SecurityWebhookDb struct {
+	DB  *runner.DB
+	Api *ApiCollection
+}
+
+//go:generate counterfeiter $GOFILE SecurityWebhookApi
+type SecurityWebhookApi interface {
+	ById(id interface{}) (*SecurityWebhook, error)
+	Delete(id interface{}) error
+	Save(*SecurityWebhook) error
+	Truncate() error
+
+	ByUserId(userId string) (*SecurityWebhook, error)
+	MarkDelivery(id string, status int, t time.Time) error
+}
+
+func NewSecurityWebhookDb(db *runner.DB, api *ApiCollection) *SecurityWebhookDb {
+	return &SecurityWebhookDb{
+		DB:  db,
+		Api: api,
+	}
+}
+
+// SecurityWebhook is where a user wants their account's security events, like
+// sign ins from somewhere new, to be posted.  Each delivery is signed with
+// Secret, so the receiver can tell it really came from us.  LastStatus is the
+// HTTP status of the last delivery, or 0 if it couldn't be made at all.
+type SecurityWebhook struct {
+	Id               string    `db:"id" json:"id"`
+	UserId           string    `db:"user_id" json:"user_id"`
+	Url              string    `db:"url" json:"url"`
+	Secret           string    `db:"secret" json:"-"`
+	CreatedTime      time.Time `db:"created_time" json:"created_time"`
+	LastDeliveryTime null.Time `db:"last_delivery_time" json:"last_delivery_time"`
+	LastStatus       int       `db:"last_status" json:"last_status"`
+}
+
+func NewSecurityWebhook(userId, url string) (*SecurityWebhook, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, err
+	}
+	return &SecurityWebhook{
+		Id:          uuid.NewRandom().String(),
+		UserId:      userId,
+		Url:         url,
+		Secret:      hex.EncodeToString(buf),
+		CreatedTime: time.Now().UTC(),
+	}, nil
+}
+
+func (db *SecurityWebhookDb) ById(id interface{}) (*SecurityWebhook, error) {
+	var hook SecurityWebhook
+	err := db.DB.
+		Select("*").
+		From(SECURITY_WEBHOOK_TABLE).
+		Where("id = $1", id).
+		QueryStruct(&hook)
+	if err == sql.ErrNoRows {
+		return nil, err
+	}
+	return &hook, err
+}
+
+func (db *SecurityWebhookDb) Delete(id interface{}) error {
+	_, err := db.DB.
+		DeleteFrom(SECURITY_WEBHOOK_TABLE).
+		Where("id = $1", id).
+		Exec()
+	return err
+}
+
+func (db *SecurityWebhookDb) Save(hook *SecurityWebhook) error {
+	cols := []string{
+		"id",
+		"user_id",
+		"url",
+		"secret",
+		"created_time",
+		"last_delivery_time",
+		"last_status",
+	}
+	vals := []interface{}{
+		hook.Id,
+		hook.UserId,
+		hook.Url,
+		hook.Secret,
+		hook.CreatedTime,
+		hook.LastDeliveryTime,
+		hook.LastStatus,
+	}
+	_, err := db.DB.
+		Upsert(SECURITY_WEBHOOK_TABLE).
+		Columns(cols...).
+		Values(vals...).
+		Where("id = $1", hook.Id).
+		Exec()
+	return err
+}
+
+func (db *SecurityWebhookDb) Truncate() error {
+	_, err := db.DB.DeleteFrom(SECURITY_WEBHOOK_TABLE).Exec()
+	return err
+}
+
+// -
+
+func (db *SecurityWebhookDb) ByUserId(userId string) (*SecurityWebhook, error) {
+	var hook SecurityWebhook
+	err := db.DB.
+		Select("*").
+		From(SECURITY_WEBHOOK_TABLE).
+		Where("user_id = $1", userId).
+		QueryStruct(&hook)
+	if err == sql.ErrNoRows {
+		return nil, err
+	}
+	return &hook, err
+}
+
+func (db *SecurityWebhookDb) MarkDelivery(id string, status int, t time.Time) error {
+	_, err := db.DB.
+		Update(SECURITY_WEBHOOK_TABLE).
+		Set("last_status", status).
+		Set("last_delivery_time", t).
+		Where("id = $1", id).
+		Exec()
+	return err
+}
@@ -0,0 +1,230 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/pborman/uuid"
+	runner "gopkg.in/mgutz/dat.v1/sqlx-runner"
+)
+
+const SSO_CONNECTION_TABLE = "sso_connection"
+
+const (
+	SSO_ROLE_MEMBER = "member"
+	SSO_ROLE_ADMIN  = "admin"
+)
+
+type SsoConnectionDb struct {
+	DB  *runner.DB
+	Api *ApiCollection
+}
+
+//go:generate counterfeiter $GOFILE SsoConnectionApi
+type SsoConnectionApi interface {
+	ById(id interface{}) (*SsoConnection, error)
+	Delete(id interface{}) error
+	Save(*SsoConnection) error
+	Truncate() error
+
+	ByDomain(domain string) (*SsoConnection, error)
+	All() ([]*SsoConnection, error)
+}
+
+func NewSsoConnectionDb(db *runner.DB, api *ApiCollection) *SsoConnectionDb {
+	return &SsoConnectionDb{
+		DB:  db,
+		Api: api,
+	}
+}
+
+// SsoConnection delegates signing in for everybody with an e-mail address at
+// Domain to an OpenID Connect identity provider.  Users are created the first
+// time they sign in, and RoleMap maps the values of the provider's RoleClaim
+// to the role they get here, which is checked again on every sign in.
+type SsoConnection struct {
+	Id            string            `db:"id" json:"id"`
+	Domain        string            `db:"domain" json:"domain"`
+	Issuer        string            `db:"issuer" json:"issuer"`
+	AuthUrl       string            `db:"auth_url" json:"auth_url"`
+	TokenUrl      string            `db:"token_url" json:"token_url"`
+	UserinfoUrl   string            `db:"userinfo_url" json:"userinfo_url"`
+	ClientId      string            `db:"client_id" json:"client_id"`
+	ClientSecret  string            `db:"client_secret" json:"-"`
+	RoleClaim     string            `db:"role_claim" json:"role_claim"`
+	RoleMapString string            `db:"role_map" json:"-"`
+	RoleMap       map[string]string `db:"-" json:"role_map"`
+	Enabled       bool              `db:"enabled" json:"enabled"`
+	CreatedTime   time.Time         `db:"created_time" json:"created_time"`
+}
+
+func NewSsoConnection(domain string) *SsoConnection {
+	return &SsoConnection{
+		Id:            uuid.NewUUID().String(),
+		Domain:        strings.ToLower(domain),
+		RoleMapString: "{}",
+		RoleMap:       map[string]string{},
+		Enabled:       true,
+		CreatedTime:   time.Now().UTC(),
+	}
+}
+
+func ValidSsoRole(role string) bool {
+	return role == SSO_ROLE_MEMBER || role == SSO_ROLE_ADMIN
+}
+
+// EmailDomain is the lowercased part of email after the @, which is what
+// connections are looked up by.
+func EmailDomain(email string) string {
+	parts := strings.Split(email, "@")
+	if len(parts) != 2 {
+		return ""
+	}
+	return strings.ToLower(parts[1])
+}
+
+// Provider is the name identities and sign-in states for this connection are
+// saved under.
+func (s *SsoConnection) Provider() string {
+	return "sso:" + s.Id
+}
+
+// Role picks the role for someone whose role claim had the given values.
+// Admin wins if any value maps to it, and anyone else is a member.
+func (s *SsoConnection) Role(values []string) string {
+	for _, v := range values {
+		if s.RoleMap[v] == SSO_ROLE_ADMIN {
+			return SSO_ROLE_ADMIN
+		}
+	}
+	return SSO_ROLE_MEMBER
+}
+
+func (s *SsoConnection) SetRoleMap(roleMap map[string]string) error {
+	if roleMap == nil {
+		roleMap = map[string]string{}
+	}
+	encoded, err := json.Marshal(roleMap)
+	if err != nil {
+		return err
+	}
+	s.RoleMap = roleMap
+	s.RoleMapString = string(encoded)
+	return nil
+}
+
+func (s *SsoConnection) FillRoleMap() error {
+	s.RoleMap = map[string]string{}
+	if s.RoleMapString == "" {
+		return nil
+	}
+	return json.Unmarshal([]byte(s.RoleMapString), &s.RoleMap)
+}
+
+func (db *SsoConnectionDb) ById(id interface{}) (*SsoConnection, error) {
+	var s SsoConnection
+	err := db.DB.
+		Select("*").
+		From(SSO_CONNECTION_TABLE).
+		Where("id = $1", id).
+		QueryStruct(&s)
+	if err == sql.ErrNoRows {
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &s, s.FillRoleMap()
+}
+
+func (db *SsoConnectionDb) Delete(id interface{}) error {
+	_, err := db.DB.
+		DeleteFrom(SSO_CONNECTION_TABLE).
+		Where("id = $1", id).
+		Exec()
+	return err
+}
+
+func (db *SsoConnectionDb) Save(s *SsoConnection) error {
+	cols := []string{
+		"id",
+		"domain",
+		"issuer",
+		"auth_url",
+		"token_url",
+		"userinfo_url",
+		"client_id",
+		"client_secret",
+		"role_claim",
+		"role_map",
+		"enabled",
+		"created_time",
+	}
+	vals := []interface{}{
+		s.Id,
+		s.Domain,
+		s.Issuer,
+		s.AuthUrl,
+		s.TokenUrl,
+		s.UserinfoUrl,
+		s.ClientId,
+		s.ClientSecret,
+		s.RoleClaim,
+		s.RoleMapString,
+		s.Enabled,
+		s.CreatedTime,
+	}
+	_, err := db.DB.
+		Upsert(SSO_CONNECTION_TABLE).
+		Columns(cols...).
+		Values(vals...).
+		Where("id = $1", s.Id).
+		Exec()
+	return err
+}
+
+func (db *SsoConnectionDb) Truncate() error {
+	_, err := db.DB.DeleteFrom(SSO_CONNECTION_TABLE).Exec()
+	return err
+}
+
+// -
+
+func (db *SsoConnectionDb) ByDomain(domain string) (*SsoConnection, error) {
+	var s SsoConnection
+	err := db.DB.
+		Select("*").
+		From(SSO_CONNECTION_TABLE).
+		Where("domain = $1", strings.ToLower(domain)).
+		QueryStruct(&s)
+	if err == sql.ErrNoRows {
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &s, s.FillRoleMap()
+}
+
+func (db *SsoConnectionDb) All() ([]*SsoConnection, error) {
+	var conns []*SsoConnection
+	err := db.DB.
+		Select("*").
+		From(SSO_CONNECTION_TABLE).
+		OrderBy("domain ASC").
+		QueryStructs(&conns)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range conns {
+		if err = s.FillRoleMap(); err != nil {
+			return nil, err
+		}
+	}
+	if conns == nil {
+		conns = []*SsoConnection{}
+	}
+	return conns, nil
+}
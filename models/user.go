@@ -2,10 +2,13 @@ package models
 
 import (
 	"database/sql"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/pborman/uuid"
 	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/guregu/null.v3"
 	"gopkg.in/guregu/null.v3/zero"
 	runner "gopkg.in/mgutz/dat.v1/sqlx-runner"
 )
@@ -30,6 +33,16 @@ type UserApi interface {
 	// TODO: Potentially this should be a separate interface
 	ByEmail(email string) (*User, error)
 	ByUsername(username string) (*User, error)
+	SetAdmin(userId string, isAdmin bool) error
+	UseTotpCounter(userId string, counter int64) (bool, error)
+	Search(query string, limit int, after *PageKey) ([]*User, *PageKey, error)
+	ByPrefix(prefix string, limit, offset int) ([]*User, error)
+	DueForDeletion(now time.Time, limit int) ([]*User, error)
+	RecordFailedLogin(userId string, window time.Duration, lockAfter int, lockFor time.Duration) (*User, error)
+	ResetFailedLogins(userId string) error
+	ServiceAccounts(ownerId, orgId string) ([]*User, error)
+	RequirePasswordChange(userIds []string) (int64, error)
+	DeleteAccount(userId string) error
 }
 
 func NewUserDb(db *runner.DB, api *ApiCollection) *UserDb {
@@ -40,15 +53,37 @@ func NewUserDb(db *runner.DB, api *ApiCollection) *UserDb {
 }
 
 type User struct {
-	Id               string    `db:"id" json:"id"`
-	Email            string    `db:"email" json:"-"`
-	Username         string    `db:"username" json:"username"`
-	PasswordHash     string    `db:"password_hash" json:"-"`
-	StripeCustomerId string    `db:"stripe_customer_id" json:"-"`
-	CreatedTime      time.Time `db:"created_time" json:"created_time"`
+	Id                 string      `db:"id" json:"id"`
+	Email              string      `db:"email" json:"-"`
+	EmailVerified      bool        `db:"email_verified" json:"-"`
+	Username           string      `db:"username" json:"username"`
+	PasswordHash       string      `db:"password_hash" json:"-"`
+	StripeCustomerId   string      `db:"stripe_customer_id" json:"-"`
+	IsAdmin            bool        `db:"is_admin" json:"-"`
+	TotpSecret         string      `db:"totp_secret" json:"-"`
+	TotpEnabled        bool        `db:"totp_enabled" json:"-"`
+	TotpLastCounter    int64       `db:"totp_last_counter" json:"-"`
+	SuspendedTime      null.Time   `db:"suspended_time" json:"-"`
+	SuspendedReason    string      `db:"suspended_reason" json:"-"`
+	DeletionTime       null.Time   `db:"deletion_time" json:"-"`
+	FailedLogins       int         `db:"failed_logins" json:"-"`
+	LastFailedLogin    null.Time   `db:"last_failed_login" json:"-"`
+	LockedUntil        null.Time   `db:"locked_until" json:"-"`
+	DisplayName        string      `db:"display_name" json:"display_name"`
+	Bio                string      `db:"bio" json:"bio"`
+	Affiliation        string      `db:"affiliation" json:"affiliation"`
+	Website            string      `db:"website" json:"website"`
+	AvatarFilename     string      `db:"avatar_filename" json:"-"`
+	ServiceOwnerId     null.String `db:"service_owner_id" json:"-"`
+	ServiceOrgId       null.String `db:"service_organization_id" json:"-"`
+	MustChangePassword bool        `db:"must_change_password" json:"-"`
+	CreatedTime        time.Time   `db:"created_time" json:"created_time"`
 
 	// Hydrated fields
 	HasStripeCustomerId zero.Bool `json:"has_stripe_customer_id,omitempty"`
+	HasTwoFactor        zero.Bool `json:"has_two_factor,omitempty"`
+	HasVerifiedEmail    zero.Bool `json:"has_verified_email,omitempty"`
+	IsServiceAccount    zero.Bool `json:"is_service_account,omitempty"`
 }
 
 func NewUser(email, username, password string) *User {
@@ -62,6 +97,25 @@ func NewUser(email, username, password string) *User {
 	return user
 }
 
+// NewServiceAccount makes a user for automation, like a CI pipeline, that's
+// managed by ownerId, and by the organization's owner too if orgId is given.
+// Service accounts have no password and no real e-mail address, so they can
+// only be used through API tokens.
+func NewServiceAccount(username, ownerId, orgId string) *User {
+	id := uuid.NewUUID().String()
+	user := &User{
+		Id:             id,
+		Email:          id + "@service.invalid",
+		Username:       username,
+		ServiceOwnerId: null.StringFrom(ownerId),
+		CreatedTime:    time.Now().UTC(),
+	}
+	if orgId != "" {
+		user.ServiceOrgId = null.StringFrom(orgId)
+	}
+	return user
+}
+
 func (user *User) SetPassword(password string) error {
 	hsh, err := bcrypt.GenerateFromPassword([]byte(password), BCRYPT_COST)
 	if err != nil {
@@ -71,6 +125,34 @@ func (user *User) SetPassword(password string) error {
 	return nil
 }
 
+// HasPassword is false for users who signed up through an OAuth provider and
+// never set a password, so they can only sign in through that provider.
+func (user *User) HasPassword() bool {
+	return user.PasswordHash != ""
+}
+
+// Suspended users can still sign in and download their files, but can't
+// upload or change anything.
+func (user *User) Suspended() bool {
+	return user.SuspendedTime.Valid
+}
+
+func (user *User) IsService() bool {
+	return user.ServiceOwnerId.Valid
+}
+
+// Locked users can't sign in with their password until the lock runs out, or
+// they unlock their account from the e-mail they were sent.
+func (user *User) Locked() bool {
+	return user.LockedUntil.Valid && time.Now().Before(user.LockedUntil.Time)
+}
+
+// AvatarBlobFilename is where a newly uploaded avatar is stored.  Each upload
+// gets its own name, so that caches never serve the old one.
+func (user *User) AvatarBlobFilename(t time.Time) string {
+	return fmt.Sprintf("avatars/%s/%d.png", user.Id, t.UnixNano())
+}
+
 func (user *User) CheckPassword(password string) error {
 	return bcrypt.CompareHashAndPassword(
 		[]byte(user.PasswordHash),
@@ -80,11 +162,13 @@ func (user *User) CheckPassword(password string) error {
 
 func (db *UserDb) ById(id interface{}) (*User, error) {
 	var user User
-	err := db.DB.
-		Select("*").
-		From(USER_TABLE).
-		Where("id = $1", id).
-		QueryStruct(&user)
+	err := db.Api.cached(userKey(fmt.Sprint(id)), &user, func() error {
+		return db.DB.
+			Select("*").
+			From(USER_TABLE).
+			Where("id = $1", id).
+			QueryStruct(&user)
+	})
 	if err == sql.ErrNoRows {
 		return nil, err
 	}
@@ -96,7 +180,7 @@ func (db *UserDb) ByIds(ids []interface{}) ([]*User, error) {
 		return []*User{}, nil
 	}
 	var users []*User
-	err := db.DB.
+	err := db.Api.reader(db.DB).
 		Select("*").
 		From(USER_TABLE).
 		Where("id IN $1", IdStrings(ids)).
@@ -112,24 +196,56 @@ func (db *UserDb) Delete(id interface{}) error {
 		DeleteFrom(USER_TABLE).
 		Where("id = $1", id).
 		Exec()
+	db.Api.uncache(userKey(fmt.Sprint(id)))
 	return err
 }
 
+// Save leaves is_admin alone, so that admins are only ever made on purpose by
+// SetAdmin, totp_last_counter alone, since only UseTotpCounter moves it, and
+// the failed login columns alone, since they're counted atomically
 func (db *UserDb) Save(user *User) error {
 	cols := []string{
 		"id",
 		"email",
+		"email_verified",
 		"username",
 		"password_hash",
 		"stripe_customer_id",
+		"totp_secret",
+		"totp_enabled",
+		"suspended_time",
+		"suspended_reason",
+		"deletion_time",
+		"display_name",
+		"bio",
+		"affiliation",
+		"website",
+		"avatar_filename",
+		"service_owner_id",
+		"service_organization_id",
+		"must_change_password",
 		"created_time",
 	}
 	vals := []interface{}{
 		user.Id,
 		user.Email,
+		user.EmailVerified,
 		user.Username,
 		user.PasswordHash,
 		user.StripeCustomerId,
+		user.TotpSecret,
+		user.TotpEnabled,
+		user.SuspendedTime,
+		user.SuspendedReason,
+		user.DeletionTime,
+		user.DisplayName,
+		user.Bio,
+		user.Affiliation,
+		user.Website,
+		user.AvatarFilename,
+		user.ServiceOwnerId,
+		user.ServiceOrgId,
+		user.MustChangePassword,
 		user.CreatedTime,
 	}
 	_, err := db.DB.
@@ -138,12 +254,16 @@ func (db *UserDb) Save(user *User) error {
 		Values(vals...).
 		Where("id = $1", user.Id).
 		Exec()
+	db.Api.uncache(userKey(user.Id))
 	return err
 }
 
 func (db *UserDb) Hydrate(users []*User) error {
 	for _, user := range users {
 		user.HasStripeCustomerId = zero.BoolFrom(user.StripeCustomerId != "")
+		user.HasTwoFactor = zero.BoolFrom(user.TotpEnabled)
+		user.HasVerifiedEmail = zero.BoolFrom(user.EmailVerified)
+		user.IsServiceAccount = zero.BoolFrom(user.IsService())
 	}
 	return nil
 }
@@ -169,6 +289,30 @@ func (db *UserDb) ByEmail(email string) (*User, error) {
 }
 
 func (db *UserDb) ByUsername(username string) (*User, error) {
+	if db.Api.cache == nil {
+		return db.byUsername(username)
+	}
+	var id string
+	err := db.Api.cached(usernameKey(username), &id, func() error {
+		return db.DB.
+			Select("id").
+			From(USER_TABLE).
+			Where("UPPER(username) = UPPER($1)", username).
+			QueryScalar(&id)
+	})
+	if err != nil {
+		return nil, err
+	}
+	user, err := db.ById(id)
+	if err != sql.ErrNoRows && (err != nil || strings.EqualFold(user.Username, username)) {
+		return user, err
+	}
+	// Whoever had the username has since been renamed or deleted
+	db.Api.uncache(usernameKey(username))
+	return db.byUsername(username)
+}
+
+func (db *UserDb) byUsername(username string) (*User, error) {
 	var user User
 	err := db.DB.
 		Select("*").
@@ -180,3 +324,253 @@ func (db *UserDb) ByUsername(username string) (*User, error) {
 	}
 	return &user, err
 }
+
+func (db *UserDb) SetAdmin(userId string, isAdmin bool) error {
+	_, err := db.DB.
+		Update(USER_TABLE).
+		Set("is_admin", isAdmin).
+		Where("id = $1", userId).
+		Exec()
+	db.Api.uncache(userKey(userId))
+	return err
+}
+
+// UseTotpCounter records that the TOTP code for counter was used, and returns
+// false if it (or a later one) was already used, so that codes can't be
+// replayed.
+func (db *UserDb) UseTotpCounter(userId string, counter int64) (bool, error) {
+	res, err := db.DB.
+		Update(USER_TABLE).
+		Set("totp_last_counter", counter).
+		Where("id = $1 AND totp_last_counter < $2", userId, counter).
+		Exec()
+	if err != nil {
+		return false, err
+	}
+	db.Api.uncache(userKey(userId))
+	return res.RowsAffected > 0, nil
+}
+
+// How users are searched: newest first
+var userSearchOrder = []keyCol{{"U.created_time", "TIMESTAMPTZ"}}
+
+// Search finds a page of users whose username or e-mail contains query, newest
+// first, starting after the key.  An empty query matches everybody.  It also
+// returns the key the next page starts after, if there might be one.
+func (db *UserDb) Search(query string, limit int, after *PageKey) ([]*User, *PageKey, error) {
+	var args sqlArgs
+	pattern := args.Add("%" + likeEscaper.Replace(query) + "%")
+	sql := `
+	SELECT U.*, ` + keysSql(userSearchOrder) + `
+	FROM ` + USER_TABLE + ` U
+	WHERE (U.username ILIKE ` + pattern + ` OR U.email ILIKE ` + pattern + `)
+	  AND ` + after.afterSql(userSearchOrder, "U.id", true, &args) + `
+	ORDER BY ` + orderSql(userSearchOrder, "U.id", true) + `
+	LIMIT ` + args.Add(limit)
+	var rows []*keyedUser
+	err := db.Api.reader(db.DB).SQL(sql, args...).QueryStructs(&rows)
+	users := make([]*User, 0, len(rows))
+	for _, row := range rows {
+		users = append(users, &row.User)
+	}
+	var next *PageKey
+	if len(rows) == limit {
+		last := rows[len(rows)-1]
+		next = last.pageKey(len(userSearchOrder), last.Id)
+	}
+	return users, next, err
+}
+
+type keyedUser struct {
+	User
+	pageKeys
+}
+
+// ByPrefix finds users whose username, or any word of whose display name,
+// starts with prefix.  An exact username comes first, then usernames starting
+// with it shortest first, then display names.  Service accounts and users who
+// are suspended or about to be deleted are left out.
+func (db *UserDb) ByPrefix(prefix string, limit, offset int) ([]*User, error) {
+	pattern := strings.ToLower(likeEscaper.Replace(prefix)) + "%"
+	sql := `
+	SELECT *
+	FROM ` + USER_TABLE + `
+	WHERE (LOWER(username) LIKE $1
+	       OR LOWER(display_name) LIKE $1
+	       OR LOWER(display_name) LIKE '% ' || $1)
+	  AND service_owner_id IS NULL
+	  AND suspended_time IS NULL
+	  AND deletion_time IS NULL
+	ORDER BY
+	  LOWER(username) = LOWER($2) DESC,
+	  LOWER(username) LIKE $1 DESC,
+	  LENGTH(username) ASC,
+	  username ASC
+	LIMIT $3 OFFSET $4
+	`
+	var users []*User
+	err := db.Api.reader(db.DB).SQL(sql, pattern, prefix, limit, offset).QueryStructs(&users)
+	if users == nil {
+		users = []*User{}
+	}
+	return users, err
+}
+
+// DueForDeletion lists users whose scheduled deletion time has come.
+func (db *UserDb) DueForDeletion(now time.Time, limit int) ([]*User, error) {
+	var users []*User
+	err := db.DB.
+		Select("*").
+		From(USER_TABLE).
+		Where("deletion_time IS NOT NULL AND deletion_time <= $1", now).
+		OrderBy("deletion_time ASC").
+		Limit(uint64(limit)).
+		QueryStructs(&users)
+	if users == nil {
+		users = []*User{}
+	}
+	return users, err
+}
+
+// DeleteAccount removes the user along with their models, files, tokens, any
+// organizations they own, and the downloads they made or that were made of
+// their files.  Blobs aren't touched, so callers have to delete those first.
+// Audit events and takedowns the user took part in are kept, since they're how
+// abuse gets investigated after the fact.
+func (db *UserDb) DeleteAccount(userId string) error {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.AutoRollback()
+
+	stmts := []string{
+		`DELETE FROM organization_member WHERE user_id = $1
+		   OR organization_id IN (SELECT id FROM organization WHERE owner_id = $1)`,
+		`DELETE FROM organization WHERE owner_id = $1`,
+		`DELETE FROM download_hour WHERE user_id = $1
+		   OR file_id IN (SELECT id FROM file WHERE user_id = $1)`,
+		`DELETE FROM download_day WHERE file_id IN (SELECT id FROM file WHERE user_id = $1)`,
+		`DELETE FROM download_month WHERE file_id IN (SELECT id FROM file WHERE user_id = $1)`,
+		`DELETE FROM download_country WHERE file_id IN (SELECT id FROM file WHERE user_id = $1)`,
+		`DELETE FROM download_client WHERE file_id IN (SELECT id FROM file WHERE user_id = $1)`,
+		`DELETE FROM file_metadata_revision WHERE user_id = $1`,
+		`DELETE FROM file WHERE user_id = $1`,
+		`DELETE FROM access_request WHERE user_id = $1
+		   OR model_id IN (SELECT id FROM model WHERE user_id = $1)`,
+		`DELETE FROM model WHERE user_id = $1`,
+		`DELETE FROM auth_token WHERE user_id = $1`,
+		`DELETE FROM device_authorization WHERE user_id = $1`,
+		`DELETE FROM notification_preference WHERE user_id = $1`,
+		`DELETE FROM notification WHERE user_id = $1`,
+		`DELETE FROM security_webhook WHERE user_id = $1`,
+		`DELETE FROM auth_user WHERE id = $1`,
+	}
+	var modelIds []string
+	err = tx.SQL(`SELECT id FROM model WHERE user_id = $1`, userId).QuerySlice(&modelIds)
+	if err != nil {
+		return err
+	}
+	for _, stmt := range stmts {
+		if _, err = tx.SQL(stmt, userId).Exec(); err != nil {
+			return err
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+
+	keys := []string{userKey(userId)}
+	for _, id := range modelIds {
+		keys = append(keys, modelKey(id))
+	}
+	db.Api.uncache(keys...)
+	return nil
+}
+
+// RecordFailedLogin counts a wrong password for the user, starting over if the
+// last one was longer than window ago, and locks the account for lockFor once
+// there have been lockAfter of them.  It returns the user as they are now.
+func (db *UserDb) RecordFailedLogin(userId string, window time.Duration, lockAfter int, lockFor time.Duration) (*User, error) {
+	var user User
+	err := db.DB.SQL(`
+	UPDATE auth_user
+	SET
+	  failed_logins = CASE
+	    WHEN last_failed_login IS NULL OR last_failed_login < NOW() - $2 * INTERVAL '1 second' THEN 1
+	    ELSE failed_logins + 1
+	  END,
+	  last_failed_login = NOW()
+	WHERE id = $1
+	RETURNING *
+	`, userId, int(window.Seconds())).QueryStruct(&user)
+	if err != nil {
+		return nil, err
+	}
+	db.Api.uncache(userKey(userId))
+	if user.FailedLogins < lockAfter || user.Locked() {
+		return &user, nil
+	}
+	user.LockedUntil = null.TimeFrom(time.Now().UTC().Add(lockFor))
+	_, err = db.DB.
+		Update(USER_TABLE).
+		Set("locked_until", user.LockedUntil).
+		Where("id = $1", userId).
+		Exec()
+	db.Api.uncache(userKey(userId))
+	return &user, err
+}
+
+// ResetFailedLogins clears the user's failed logins, and any lock they caused.
+func (db *UserDb) ResetFailedLogins(userId string) error {
+	_, err := db.DB.
+		Update(USER_TABLE).
+		Set("failed_logins", 0).
+		Set("last_failed_login", nil).
+		Set("locked_until", nil).
+		Where("id = $1", userId).
+		Exec()
+	db.Api.uncache(userKey(userId))
+	return err
+}
+
+// ServiceAccounts lists the service accounts that ownerId made, along with
+// those belonging to the organization orgId, if it's given.
+func (db *UserDb) ServiceAccounts(ownerId, orgId string) ([]*User, error) {
+	var users []*User
+	err := db.DB.
+		Select("*").
+		From(USER_TABLE).
+		Where("service_owner_id = $1 OR (service_organization_id IS NOT NULL AND "+
+			"service_organization_id::TEXT = $2)", ownerId, orgId).
+		OrderBy("created_time ASC").
+		QueryStructs(&users)
+	if users == nil {
+		users = []*User{}
+	}
+	return users, err
+}
+
+// RequirePasswordChange makes the users choose a new password before they can
+// sign in with one again, and returns how many were affected.  A nil userIds
+// means everyone who has a password, for after a leak of the whole table.
+func (db *UserDb) RequirePasswordChange(userIds []string) (int64, error) {
+	where := "password_hash <> ''"
+	args := []interface{}{}
+	if userIds != nil {
+		where += " AND id IN $1"
+		args = append(args, userIds)
+	}
+	var changed []string
+	err := db.DB.
+		Update(USER_TABLE).
+		Set("must_change_password", true).
+		Where(where, args...).
+		Returning("id").
+		QuerySlice(&changed)
+	if err != nil {
+		return 0, err
+	}
+	db.Api.uncache(userKeys(changed)...)
+	return int64(len(changed)), nil
+}
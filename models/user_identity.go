@@ -0,0 +1,202 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/pborman/uuid"
+	"gopkg.in/guregu/null.v3"
+	runner "gopkg.in/mgutz/dat.v1/sqlx-runner"
+)
+
+const USER_IDENTITY_TABLE = "user_identity"
+const OAUTH_STATE_TABLE = "oauth_state"
+
+// How long someone has to finish signing in with a provider
+const OAUTH_STATE_TTL = 10 * time.Minute
+
+type UserIdentityDb struct {
+	DB  *runner.DB
+	Api *ApiCollection
+}
+
+//go:generate counterfeiter $GOFILE UserIdentityApi
+type UserIdentityApi interface {
+	ById(id interface{}) (*UserIdentity, error)
+	Delete(id interface{}) error
+	Save(*UserIdentity) error
+	Truncate() error
+
+	ByProvider(provider, providerUserId string) (*UserIdentity, error)
+	ByUserId(userId string) ([]*UserIdentity, error)
+	SaveState(*OAuthState) error
+	TakeState(id string) (*OAuthState, error)
+}
+
+func NewUserIdentityDb(db *runner.DB, api *ApiCollection) *UserIdentityDb {
+	return &UserIdentityDb{
+		DB:  db,
+		Api: api,
+	}
+}
+
+// UserIdentity links a user to an account with an OAuth provider like GitHub
+// or Google, so that they can sign in with it instead of a password.
+type UserIdentity struct {
+	Id             string    `db:"id" json:"id"`
+	UserId         string    `db:"user_id" json:"user_id"`
+	Provider       string    `db:"provider" json:"provider"`
+	ProviderUserId string    `db:"provider_user_id" json:"-"`
+	Email          string    `db:"email" json:"email"`
+	CreatedTime    time.Time `db:"created_time" json:"created_time"`
+}
+
+// OAuthState is handed to the provider when starting a sign in, and has to
+// come back with the callback so that we know the sign in was started here.
+// If UserId is set, the identity gets linked to that user instead of signing
+// in.
+type OAuthState struct {
+	Id          string      `db:"id" json:"id"`
+	Provider    string      `db:"provider" json:"provider"`
+	UserId      null.String `db:"user_id" json:"-"`
+	CreatedTime time.Time   `db:"created_time" json:"created_time"`
+}
+
+func NewUserIdentity(userId, provider, providerUserId, email string) *UserIdentity {
+	return &UserIdentity{
+		Id:             uuid.NewUUID().String(),
+		UserId:         userId,
+		Provider:       provider,
+		ProviderUserId: providerUserId,
+		Email:          email,
+		CreatedTime:    time.Now().UTC(),
+	}
+}
+
+func NewOAuthState(provider, userId string) *OAuthState {
+	return &OAuthState{
+		Id:          uuid.NewRandom().String(),
+		Provider:    provider,
+		UserId:      null.NewString(userId, userId != ""),
+		CreatedTime: time.Now().UTC(),
+	}
+}
+
+func (s *OAuthState) Expired() bool {
+	return time.Since(s.CreatedTime) > OAUTH_STATE_TTL
+}
+
+func (db *UserIdentityDb) ById(id interface{}) (*UserIdentity, error) {
+	var ident UserIdentity
+	err := db.DB.
+		Select("*").
+		From(USER_IDENTITY_TABLE).
+		Where("id = $1", id).
+		QueryStruct(&ident)
+	if err == sql.ErrNoRows {
+		return nil, err
+	}
+	return &ident, err
+}
+
+func (db *UserIdentityDb) Delete(id interface{}) error {
+	_, err := db.DB.
+		DeleteFrom(USER_IDENTITY_TABLE).
+		Where("id = $1", id).
+		Exec()
+	return err
+}
+
+func (db *UserIdentityDb) Save(ident *UserIdentity) error {
+	cols := []string{
+		"id",
+		"user_id",
+		"provider",
+		"provider_user_id",
+		"email",
+		"created_time",
+	}
+	vals := []interface{}{
+		ident.Id,
+		ident.UserId,
+		ident.Provider,
+		ident.ProviderUserId,
+		ident.Email,
+		ident.CreatedTime,
+	}
+	_, err := db.DB.
+		Upsert(USER_IDENTITY_TABLE).
+		Columns(cols...).
+		Values(vals...).
+		Where("id = $1", ident.Id).
+		Exec()
+	return err
+}
+
+func (db *UserIdentityDb) Truncate() error {
+	if _, err := db.DB.DeleteFrom(OAUTH_STATE_TABLE).Exec(); err != nil {
+		return err
+	}
+	_, err := db.DB.DeleteFrom(USER_IDENTITY_TABLE).Exec()
+	return err
+}
+
+// -
+
+func (db *UserIdentityDb) ByProvider(provider, providerUserId string) (*UserIdentity, error) {
+	var ident UserIdentity
+	err := db.DB.
+		Select("*").
+		From(USER_IDENTITY_TABLE).
+		Where("provider = $1 AND provider_user_id = $2", provider, providerUserId).
+		QueryStruct(&ident)
+	if err == sql.ErrNoRows {
+		return nil, err
+	}
+	return &ident, err
+}
+
+func (db *UserIdentityDb) ByUserId(userId string) ([]*UserIdentity, error) {
+	var idents []*UserIdentity
+	err := db.DB.
+		Select("*").
+		From(USER_IDENTITY_TABLE).
+		Where("user_id = $1", userId).
+		OrderBy("created_time ASC").
+		QueryStructs(&idents)
+	if idents == nil {
+		idents = []*UserIdentity{}
+	}
+	return idents, err
+}
+
+func (db *UserIdentityDb) SaveState(s *OAuthState) error {
+	_, err := db.DB.
+		InsertInto(OAUTH_STATE_TABLE).
+		Columns("id", "provider", "user_id", "created_time").
+		Values(s.Id, s.Provider, s.UserId, s.CreatedTime).
+		Exec()
+	return err
+}
+
+// TakeState deletes the state and returns it, so that each state can only be
+// used for one callback.  Expired states are cleaned up along the way.
+func (db *UserIdentityDb) TakeState(id string) (*OAuthState, error) {
+	var s OAuthState
+	err := db.DB.SQL(`
+	DELETE FROM oauth_state
+	WHERE id = $1
+	RETURNING *
+	`, id).QueryStruct(&s)
+	if err == sql.ErrNoRows {
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	_, err = db.DB.
+		DeleteFrom(OAUTH_STATE_TABLE).
+		Where("created_time < $1", time.Now().UTC().Add(-OAUTH_STATE_TTL)).
+		Exec()
+	return &s, err
+}
@@ -0,0 +1,146 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// VersionConstraint is a single comparison against a framework version, like
+// <=1.2 or !=1.0.5.
+type VersionConstraint struct {
+	Op      string `json:"op"`
+	Version string `json:"version"`
+}
+
+// Longer operators come first so that "<=" isn't parsed as "<"
+var versionOps = []string{">=", "<=", "==", "!=", ">", "<", "="}
+
+// ParseFrameworkConstraint parses a requirement like "keras<=1.2" or
+// "keras>=1.0,<1.2" into a framework name and the constraints that its version
+// must satisfy.  A bare framework name has no constraints.
+func ParseFrameworkConstraint(s string) (string, []*VersionConstraint, error) {
+	s = strings.TrimSpace(s)
+	i := strings.IndexAny(s, "<>=!")
+	if i < 0 {
+		if s == "" {
+			return "", nil, errors.New("Framework constraint must not be empty")
+		}
+		return s, []*VersionConstraint{}, nil
+	}
+	framework := strings.TrimSpace(s[:i])
+	if framework == "" {
+		return "", nil, errors.New("Framework constraint is missing a framework")
+	}
+
+	constraints := []*VersionConstraint{}
+	for _, part := range strings.Split(s[i:], ",") {
+		part = strings.TrimSpace(part)
+		var c *VersionConstraint
+		for _, op := range versionOps {
+			if strings.HasPrefix(part, op) {
+				c = &VersionConstraint{
+					Op:      op,
+					Version: strings.TrimSpace(part[len(op):]),
+				}
+				break
+			}
+		}
+		if c == nil || c.Version == "" || strings.ContainsAny(c.Version, "<>=!") {
+			return "", nil, fmt.Errorf("Could not parse version constraint %q", part)
+		}
+		if c.Op == "=" {
+			c.Op = "=="
+		}
+		constraints = append(constraints, c)
+	}
+	return framework, constraints, nil
+}
+
+func (c *VersionConstraint) Matches(version string) bool {
+	cmp := CompareVersions(version, c.Version)
+	switch c.Op {
+	case ">=":
+		return cmp >= 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case "<":
+		return cmp < 0
+	case "!=":
+		return cmp != 0
+	}
+	return cmp == 0
+}
+
+// CompareVersions compares dotted version strings piece by piece, numerically
+// where both pieces are numbers, and returns -1, 0, or 1.  Missing pieces
+// count as zero, so 1.2 == 1.2.0.
+func CompareVersions(a, b string) int {
+	as := strings.Split(a, ".")
+	bs := strings.Split(b, ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		ap, bp := "0", "0"
+		if i < len(as) {
+			ap = as[i]
+		}
+		if i < len(bs) {
+			bp = bs[i]
+		}
+		an, aErr := strconv.Atoi(ap)
+		bn, bErr := strconv.Atoi(bp)
+		switch {
+		case aErr == nil && bErr == nil:
+			if an != bn {
+				if an < bn {
+					return -1
+				}
+				return 1
+			}
+		case ap != bp:
+			if ap < bp {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+var leadingVersion = regexp.MustCompile(`^\s*v?([0-9]+(\.[0-9]+)*)`)
+
+// versionParts is the leading numbers of a version as a Postgres array, the
+// same way the version_parts function in the database works them out, so
+// that versions can be compared in queries.  It's false if the version
+// doesn't start with a number.
+func versionParts(version string) (string, bool) {
+	m := leadingVersion.FindStringSubmatch(version)
+	if m == nil {
+		return "", false
+	}
+	parts := strings.Split(m[1], ".")
+	for len(parts) > 1 {
+		if n, err := strconv.ParseInt(parts[len(parts)-1], 10, 64); err != nil || n != 0 {
+			break
+		}
+		parts = parts[:len(parts)-1]
+	}
+	return "{" + strings.Join(parts, ",") + "}", true
+}
+
+// Comparable says whether the constraint can be checked in a query, which
+// takes a version that starts with a number.
+func (c *VersionConstraint) Comparable() bool {
+	_, ok := versionParts(c.Version)
+	return ok
+}
+
+// ByVersion sorts version strings from oldest to newest.
+type ByVersion []string
+
+func (v ByVersion) Len() int           { return len(v) }
+func (v ByVersion) Swap(i, j int)      { v[i], v[j] = v[j], v[i] }
+func (v ByVersion) Less(i, j int) bool { return CompareVersions(v[i], v[j]) < 0 }
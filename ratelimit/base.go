@@ -0,0 +1,31 @@
+package ratelimit
+
+import (
+	"time"
+)
+
+// Limit allows Count requests per Period, in bursts of up to Count.
+type Limit struct {
+	Name   string
+	Count  int
+	Period time.Duration
+}
+
+func (l Limit) Enabled() bool {
+	return l.Count > 0 && l.Period > 0
+}
+
+// Result describes the bucket after taking from it, for the X-RateLimit-*
+// headers.
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	Reset      time.Time     // When the bucket will be full again
+	RetryAfter time.Duration // When the next request will be allowed, if not now
+}
+
+//go:generate counterfeiter $GOFILE Limiter
+type Limiter interface {
+	Take(key string, limit Limit) (Result, error)
+}
@@ -0,0 +1,39 @@
+package ratelimit
+
+import (
+	"sync"
+)
+
+// Concurrency counts requests that are still in flight per key, so that no
+// one key can tie up all of a server's connections, e.g. with many slow
+// uploads at once.  Like MemoryLimiter, each API server counts separately.
+type Concurrency struct {
+	mu       sync.Mutex
+	inFlight map[string]int
+}
+
+func NewConcurrency() *Concurrency {
+	return &Concurrency{inFlight: map[string]int{}}
+}
+
+// Acquire starts a request for key, unless max are already in flight, and
+// says whether it did.  Every successful Acquire must be followed by Release.
+func (c *Concurrency) Acquire(key string, max int) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.inFlight[key] >= max {
+		return false
+	}
+	c.inFlight[key]++
+	return true
+}
+
+func (c *Concurrency) Release(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.inFlight[key] <= 1 {
+		delete(c.inFlight, key)
+	} else {
+		c.inFlight[key]--
+	}
+}
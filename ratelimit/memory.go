@@ -0,0 +1,79 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// How often idle buckets are thrown away
+const sweepInterval = 10 * time.Minute
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	period  time.Duration
+}
+
+// MemoryLimiter keeps token buckets in memory, so each API server enforces
+// its limits separately.
+type MemoryLimiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+func NewMemoryLimiter() *MemoryLimiter {
+	return &MemoryLimiter{
+		buckets:   map[string]*bucket{},
+		lastSweep: time.Now(),
+	}
+}
+
+func (m *MemoryLimiter) Take(key string, limit Limit) (Result, error) {
+	now := time.Now()
+	key = limit.Name + ":" + key
+	capacity := float64(limit.Count)
+	perToken := limit.Period / time.Duration(limit.Count)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sweep(now)
+
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: capacity, updated: now, period: limit.Period}
+		m.buckets[key] = b
+	}
+
+	// Refill for the time that's passed since the last request
+	elapsed := now.Sub(b.updated)
+	b.tokens = math.Min(capacity, b.tokens+float64(elapsed)/float64(perToken))
+	b.updated = now
+
+	res := Result{Limit: limit.Count}
+	if b.tokens >= 1 {
+		b.tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = time.Duration((1 - b.tokens) * float64(perToken))
+	}
+	res.Remaining = int(b.tokens)
+	res.Reset = now.Add(time.Duration((capacity - b.tokens) * float64(perToken)))
+	return res, nil
+}
+
+// sweep drops buckets that would have refilled completely by now, since
+// they're no different from a new bucket.  It's called with the lock held.
+func (m *MemoryLimiter) sweep(now time.Time) {
+	if now.Sub(m.lastSweep) < sweepInterval {
+		return
+	}
+	for key, b := range m.buckets {
+		if now.Sub(b.updated) > b.period {
+			delete(m.buckets, key)
+		}
+	}
+	m.lastSweep = now
+}
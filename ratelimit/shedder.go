@@ -0,0 +1,84 @@
+package ratelimit
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Shedder decides when a server is too busy to take on work that can wait,
+// so that the work that can't, like uploads and downloads already under way,
+// still gets done instead of everything timing out together.  It counts the
+// requests in flight itself, and asks its checks about everything else.
+type Shedder struct {
+	inFlight    int64
+	maxInFlight func() int
+	checks      []ShedCheck
+}
+
+// ShedCheck says why the server is overloaded, or "" if it isn't.
+type ShedCheck func() string
+
+// NewShedder makes a shedder that's overloaded with more than maxInFlight
+// requests in flight, or when any of the checks say so.  The limit is asked
+// for every time, so it can change, and 0 means there's no limit.
+func NewShedder(maxInFlight func() int, checks ...ShedCheck) *Shedder {
+	return &Shedder{maxInFlight: maxInFlight, checks: checks}
+}
+
+// Begin counts a request as in flight.  Every Begin must be followed by End.
+func (s *Shedder) Begin() {
+	atomic.AddInt64(&s.inFlight, 1)
+}
+
+func (s *Shedder) End() {
+	atomic.AddInt64(&s.inFlight, -1)
+}
+
+// InFlight is how many requests are in flight right now.
+func (s *Shedder) InFlight() int64 {
+	return atomic.LoadInt64(&s.inFlight)
+}
+
+// Overloaded says why the server is overloaded, e.g. "in_flight", or "" if it
+// isn't.
+func (s *Shedder) Overloaded() string {
+	if max := int64(s.maxInFlight()); max > 0 && atomic.LoadInt64(&s.inFlight) > max {
+		return "in_flight"
+	}
+	for _, check := range s.checks {
+		if reason := check(); reason != "" {
+			return reason
+		}
+	}
+	return ""
+}
+
+// MemoryCheck is overloaded while the heap is bigger than maxBytes, which
+// like NewShedder's limit is asked for every time, and 0 means there's no
+// limit.  Reading the heap size stops the world for a moment, so it's only
+// read once per every, and the last reading is used in between.
+func MemoryCheck(maxBytes func() uint64, every time.Duration) ShedCheck {
+	var mu sync.Mutex
+	var checked time.Time
+	var heap uint64
+	return func() string {
+		max := maxBytes()
+		if max == 0 {
+			return ""
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if time.Since(checked) >= every {
+			var stats runtime.MemStats
+			runtime.ReadMemStats(&stats)
+			heap = stats.HeapAlloc
+			checked = time.Now()
+		}
+		if heap > max {
+			return "memory"
+		}
+		return ""
+	}
+}
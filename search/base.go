@@ -0,0 +1,33 @@
+package search
+
+import (
+	"context"
+
+	"github.com/ericflo/gradientzoo/models"
+)
+
+// Facet is how many matching models have one value of a field
+type Facet struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+// Results are the models that matched a search, best first
+type Results struct {
+	Matches []*models.ModelMatch
+
+	// Matching models counted by framework and by license, or nil if the
+	// backend can't count them
+	Facets map[string][]*Facet
+}
+
+// Backend finds models.  Backends with an index of their own are kept up to
+// date through Index and Remove; the others can ignore them.  Searches are
+// traced as part of the span ctx carries, if any.
+//
+//go:generate counterfeiter $GOFILE Backend
+type Backend interface {
+	Search(ctx context.Context, query, userId string, filter *models.ModelFilter, limit, offset int) (*Results, error)
+	Index(docs []*models.SearchDoc) error
+	Remove(modelIds []string) error
+}
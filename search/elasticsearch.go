@@ -0,0 +1,359 @@
+package search
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ericflo/gradientzoo/models"
+	"github.com/ericflo/gradientzoo/tracing"
+)
+
+// How many facet values are counted for each field
+const facetSize = 20
+
+// The index's mapping.  Text fields are analyzed for matching, everything
+// else is kept as is for filtering and facets.
+var elasticsearchMapping = map[string]interface{}{
+	"mappings": map[string]interface{}{
+		"properties": map[string]interface{}{
+			"id":           map[string]string{"type": "keyword"},
+			"user_id":      map[string]string{"type": "keyword"},
+			"slug":         map[string]string{"type": "text"},
+			"name":         map[string]string{"type": "text"},
+			"description":  map[string]string{"type": "text"},
+			"readme":       map[string]string{"type": "text"},
+			"license":      map[string]string{"type": "keyword"},
+			"visibility":   map[string]string{"type": "keyword"},
+			"frameworks":   map[string]string{"type": "keyword"},
+			"size_bytes":   map[string]string{"type": "long"},
+			"downloads":    map[string]string{"type": "long"},
+			"created_time": map[string]string{"type": "date"},
+			"updated_time": map[string]string{"type": "date"},
+		},
+	},
+}
+
+// ElasticsearchBackend searches an Elasticsearch or OpenSearch index, which
+// tolerates typos and can count facets.  The index only decides which models
+// match and in what order; the models themselves are always loaded from the
+// database, so nothing stale or since made private is ever shown.
+//
+// Only public models and the searcher's own are searched, since the index
+// doesn't keep track of who has been granted access to private ones.
+type ElasticsearchBackend struct {
+	url    string
+	index  string
+	api    *models.ApiCollection
+	client *http.Client
+}
+
+// NewElasticsearchBackend uses the index at url, creating it if it doesn't
+// exist yet.
+func NewElasticsearchBackend(url, index string, api *models.ApiCollection) (*ElasticsearchBackend, error) {
+	b := &ElasticsearchBackend{
+		url:    strings.TrimRight(url, "/"),
+		index:  index,
+		api:    api,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+	status, err := b.do(context.Background(), "HEAD", "/"+index, nil, nil)
+	if status == http.StatusNotFound {
+		_, err = b.do(context.Background(), "PUT", "/"+index, elasticsearchMapping, nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// do sends a request with body encoded as JSON, or as is if it's already
+// bytes, and decodes the response into out if it isn't nil.  It returns the
+// HTTP status along with an error for anything but a 2xx.
+func (b *ElasticsearchBackend) do(ctx context.Context, method, path string, body, out interface{}) (int, error) {
+	var r io.Reader
+	switch v := body.(type) {
+	case nil:
+	case []byte:
+		r = bytes.NewReader(v)
+	default:
+		encoded, err := json.Marshal(v)
+		if err != nil {
+			return 0, err
+		}
+		r = bytes.NewReader(encoded)
+	}
+	req, err := http.NewRequest(method, b.url+path, r)
+	if err != nil {
+		return 0, err
+	}
+	req = req.WithContext(ctx)
+	if strings.HasSuffix(path, "/_bulk") {
+		req.Header.Set("Content-Type", "application/x-ndjson")
+	} else if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	span := tracing.StartChild(ctx, "elasticsearch "+method, tracing.KIND_CLIENT)
+	defer span.Finish()
+	span.SetAttribute("http.url", b.url+path)
+	tracing.Inject(span, req.Header)
+	resp, err := b.client.Do(req)
+	if err != nil {
+		span.SetError(err)
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		err = fmt.Errorf("Elasticsearch %s %s: %d %s", method, path,
+			resp.StatusCode, msg)
+		span.SetError(err)
+		return resp.StatusCode, err
+	}
+	if out != nil {
+		return resp.StatusCode, json.NewDecoder(resp.Body).Decode(out)
+	}
+	return resp.StatusCode, nil
+}
+
+// bulk sends a batch of actions, each followed by its document if it has one.
+func (b *ElasticsearchBackend) bulk(lines []interface{}) error {
+	if len(lines) == 0 {
+		return nil
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, line := range lines {
+		if err := enc.Encode(line); err != nil {
+			return err
+		}
+	}
+	var resp struct {
+		Errors bool `json:"errors"`
+		Items  []map[string]struct {
+			Id     string          `json:"_id"`
+			Status int             `json:"status"`
+			Error  json.RawMessage `json:"error"`
+		} `json:"items"`
+	}
+	if _, err := b.do(context.Background(), "POST", "/"+b.index+"/_bulk", buf.Bytes(), &resp); err != nil {
+		return err
+	}
+	if !resp.Errors {
+		return nil
+	}
+	for _, item := range resp.Items {
+		for action, result := range item {
+			// Removing something that was never indexed is fine
+			if action == "delete" && result.Status == http.StatusNotFound {
+				continue
+			}
+			if result.Status >= 300 {
+				return fmt.Errorf("Elasticsearch could not %s %s: %s",
+					action, result.Id, result.Error)
+			}
+		}
+	}
+	return nil
+}
+
+func (b *ElasticsearchBackend) Index(docs []*models.SearchDoc) error {
+	lines := make([]interface{}, 0, 2*len(docs))
+	for _, doc := range docs {
+		lines = append(lines,
+			map[string]interface{}{"index": map[string]string{"_id": doc.Id}},
+			doc)
+	}
+	return b.bulk(lines)
+}
+
+func (b *ElasticsearchBackend) Remove(modelIds []string) error {
+	lines := make([]interface{}, 0, len(modelIds))
+	for _, id := range modelIds {
+		lines = append(lines, map[string]interface{}{"delete": map[string]string{"_id": id}})
+	}
+	return b.bulk(lines)
+}
+
+// filterClauses turns the filter into Elasticsearch filter clauses, limited to
+// the models userId can search.
+func filterClauses(userId string, filter *models.ModelFilter) []interface{} {
+	visible := []interface{}{
+		map[string]interface{}{"term": map[string]string{"visibility": "public"}},
+	}
+	if userId != "" {
+		visible = append(visible,
+			map[string]interface{}{"term": map[string]string{"user_id": userId}})
+	}
+	clauses := []interface{}{
+		map[string]interface{}{"bool": map[string]interface{}{
+			"should":               visible,
+			"minimum_should_match": 1,
+		}},
+	}
+	if filter == nil {
+		return clauses
+	}
+	if filter.Framework != "" {
+		clauses = append(clauses,
+			map[string]interface{}{"term": map[string]string{"frameworks": filter.Framework}})
+	}
+	if filter.License != "" {
+		clauses = append(clauses,
+			map[string]interface{}{"term": map[string]string{"license": filter.License}})
+	}
+	if filter.MaxSizeBytes > 0 {
+		clauses = append(clauses, map[string]interface{}{"range": map[string]interface{}{
+			"size_bytes": map[string]int64{"lte": filter.MaxSizeBytes}}})
+	}
+	if filter.MinDownloads > 0 {
+		clauses = append(clauses, map[string]interface{}{"range": map[string]interface{}{
+			"downloads": map[string]int{"gte": filter.MinDownloads}}})
+	}
+	if !filter.UpdatedSince.IsZero() {
+		clauses = append(clauses, map[string]interface{}{"range": map[string]interface{}{
+			"updated_time": map[string]time.Time{"gte": filter.UpdatedSince}}})
+	}
+	if !filter.CreatedSince.IsZero() || !filter.CreatedBefore.IsZero() {
+		created := map[string]time.Time{}
+		if !filter.CreatedSince.IsZero() {
+			created["gte"] = filter.CreatedSince
+		}
+		if !filter.CreatedBefore.IsZero() {
+			created["lt"] = filter.CreatedBefore
+		}
+		clauses = append(clauses, map[string]interface{}{"range": map[string]interface{}{
+			"created_time": created}})
+	}
+	return clauses
+}
+
+// The fields searches match, in the order they're listed as having matched,
+// which is the same as the Postgres backend's
+var matchFields = []string{"name", "slug", "description", "readme"}
+
+func (b *ElasticsearchBackend) Search(ctx context.Context, query, userId string, filter *models.ModelFilter, limit, offset int) (*Results, error) {
+	// Framework versions aren't indexed, so only Postgres can filter on them
+	if filter != nil && len(filter.FrameworkVersions) > 0 {
+		return NewPostgresBackend(b.api).Search(ctx, query, userId, filter, limit, offset)
+	}
+
+	must := interface{}(map[string]interface{}{"match_all": map[string]interface{}{}})
+	sort := []interface{}{"_score", map[string]string{"created_time": "desc"}}
+	if query != "" {
+		must = map[string]interface{}{"multi_match": map[string]interface{}{
+			"query":     query,
+			"fields":    []string{"name^3", "slug^3", "description^2", "readme"},
+			"fuzziness": "AUTO",
+		}}
+	} else {
+		sort = sort[1:]
+	}
+	body := map[string]interface{}{
+		"from": offset,
+		"size": limit,
+		"sort": sort,
+		"query": map[string]interface{}{"bool": map[string]interface{}{
+			"must":   must,
+			"filter": filterClauses(userId, filter),
+		}},
+		"highlight": map[string]interface{}{
+			"pre_tags":  []string{"<b>"},
+			"post_tags": []string{"</b>"},
+			"encoder":   "html",
+			"fields": map[string]interface{}{
+				"name":        map[string]interface{}{"number_of_fragments": 0},
+				"slug":        map[string]interface{}{"number_of_fragments": 0},
+				"description": map[string]interface{}{"number_of_fragments": 0},
+				"readme": map[string]interface{}{
+					"fragment_size":       150,
+					"number_of_fragments": 2,
+				},
+			},
+		},
+		"aggs": map[string]interface{}{
+			"framework": map[string]interface{}{
+				"terms": map[string]interface{}{"field": "frameworks", "size": facetSize}},
+			"license": map[string]interface{}{
+				"terms": map[string]interface{}{"field": "license", "size": facetSize}},
+		},
+	}
+
+	var resp struct {
+		Hits struct {
+			Hits []struct {
+				Id        string              `json:"_id"`
+				Score     float64             `json:"_score"`
+				Highlight map[string][]string `json:"highlight"`
+			} `json:"hits"`
+		} `json:"hits"`
+		Aggregations map[string]struct {
+			Buckets []struct {
+				Key      string `json:"key"`
+				DocCount int    `json:"doc_count"`
+			} `json:"buckets"`
+		} `json:"aggregations"`
+	}
+	if _, err := b.do(ctx, "POST", "/"+b.index+"/_search", body, &resp); err != nil {
+		return nil, err
+	}
+
+	ids := make([]interface{}, 0, len(resp.Hits.Hits))
+	for _, hit := range resp.Hits.Hits {
+		ids = append(ids, hit.Id)
+	}
+	ms, err := b.api.Model.ByIds(ids)
+	if err != nil {
+		return nil, err
+	}
+	byId := make(map[string]*models.Model, len(ms))
+	for _, m := range ms {
+		byId[m.Id] = m
+	}
+
+	results := &Results{
+		Matches: make([]*models.ModelMatch, 0, len(resp.Hits.Hits)),
+		Facets:  map[string][]*Facet{},
+	}
+	for _, hit := range resp.Hits.Hits {
+		m, ok := byId[hit.Id]
+		// Deleted, or made private, since it was last indexed
+		if !ok || (m.Visibility == "private" && m.UserId != userId) {
+			continue
+		}
+		snippet := append(hit.Highlight["description"], hit.Highlight["readme"]...)
+		match := &models.ModelMatch{
+			Model:         *m,
+			Rank:          hit.Score,
+			Snippet:       strings.Join(snippet, " ... "),
+			MatchedFields: []string{},
+			Highlights:    map[string]string{},
+		}
+		// Only the fields that matched are highlighted
+		for _, field := range matchFields {
+			fragments, ok := hit.Highlight[field]
+			if !ok {
+				continue
+			}
+			match.MatchedFields = append(match.MatchedFields, field)
+			if field != "slug" {
+				match.Highlights[field] = strings.Join(fragments, " ... ")
+			}
+		}
+		results.Matches = append(results.Matches, match)
+	}
+	for name, agg := range resp.Aggregations {
+		facets := make([]*Facet, 0, len(agg.Buckets))
+		for _, bucket := range agg.Buckets {
+			facets = append(facets, &Facet{Value: bucket.Key, Count: bucket.DocCount})
+		}
+		results.Facets[name] = facets
+	}
+	return results, nil
+}
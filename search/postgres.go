@@ -0,0 +1,33 @@
+package search
+
+import (
+	"context"
+
+	"github.com/ericflo/gradientzoo/models"
+)
+
+// PostgresBackend searches with Postgres full-text search, which is kept up to
+// date by triggers in the database itself.
+type PostgresBackend struct {
+	api *models.ApiCollection
+}
+
+func NewPostgresBackend(api *models.ApiCollection) *PostgresBackend {
+	return &PostgresBackend{api: api}
+}
+
+func (b *PostgresBackend) Search(ctx context.Context, query, userId string, filter *models.ModelFilter, limit, offset int) (*Results, error) {
+	matches, err := b.api.Model.Search(query, userId, filter, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	return &Results{Matches: matches}, nil
+}
+
+func (b *PostgresBackend) Index(docs []*models.SearchDoc) error {
+	return nil
+}
+
+func (b *PostgresBackend) Remove(modelIds []string) error {
+	return nil
+}
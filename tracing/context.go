@@ -0,0 +1,30 @@
+package tracing
+
+import "context"
+
+// The span of the request being served is carried in the request's context.
+// Layers below that don't take a context, like blob storage, are given the
+// span along with whatever they're asked to do.  Work handed off to other
+// goroutines isn't traced as part of the request.
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx that carries the span.
+func NewContext(ctx context.Context, s *Span) context.Context {
+	if s == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, contextKey{}, s)
+}
+
+// FromContext is the span ctx carries, or nil if there isn't one.
+func FromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(contextKey{}).(*Span)
+	return s
+}
+
+// StartChild starts a span as part of the one ctx carries, or returns nil if
+// it doesn't carry one.
+func StartChild(ctx context.Context, name string, kind int) *Span {
+	return FromContext(ctx).Child(name, kind)
+}
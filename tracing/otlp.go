@@ -0,0 +1,181 @@
+package tracing
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// Finished spans are queued, and sent in batches this big or this often,
+// whichever comes first.  If the collector can't keep up, spans are dropped
+// rather than letting the queue grow without end.
+const (
+	batchSize     = 512
+	batchInterval = 5 * time.Second
+	queueSize     = 8192
+)
+
+type exporter struct {
+	url     string
+	headers map[string]string
+	service string
+	ratio   float64
+	client  *http.Client
+	queue   chan *Span
+}
+
+// The exporter, or nil while tracing is off
+var exp *exporter
+
+// Start turns tracing on, sending spans to the OTLP/HTTP collector at
+// endpoint, e.g. "http://localhost:4318".  headers are sent along with them,
+// given as "key=value,key=value" the way OTEL_EXPORTER_OTLP_HEADERS is.  Of
+// the traces that begin here, rather than carrying on from a caller, ratio of
+// them are kept.  It must be called before any requests are served.
+func Start(endpoint, headers, service string, ratio float64) {
+	e := &exporter{
+		url:     strings.TrimRight(endpoint, "/") + "/v1/traces",
+		headers: map[string]string{},
+		service: service,
+		ratio:   ratio,
+		client:  &http.Client{Timeout: 10 * time.Second},
+		queue:   make(chan *Span, queueSize),
+	}
+	for _, pair := range strings.Split(headers, ",") {
+		if i := strings.Index(pair, "="); i > 0 {
+			e.headers[strings.TrimSpace(pair[:i])] = strings.TrimSpace(pair[i+1:])
+		}
+	}
+	exp = e
+	go e.run()
+}
+
+func (e *exporter) add(s *Span) {
+	if e == nil {
+		return
+	}
+	select {
+	case e.queue <- s:
+	default:
+		// Dropped, the queue is full
+	}
+}
+
+func (e *exporter) run() {
+	ticker := time.NewTicker(batchInterval)
+	batch := make([]*Span, 0, batchSize)
+	for {
+		select {
+		case s := <-e.queue:
+			if batch = append(batch, s); len(batch) < batchSize {
+				continue
+			}
+		case <-ticker.C:
+			if len(batch) == 0 {
+				continue
+			}
+		}
+		if err := e.send(batch); err != nil {
+			log.WithFields(log.Fields{
+				"err":   err,
+				"spans": len(batch),
+			}).Error("Could not export trace spans")
+		}
+		batch = make([]*Span, 0, batchSize)
+	}
+}
+
+// The OTLP JSON encoding, just as much of it as we use
+type otlpAttribute struct {
+	Key   string `json:"key"`
+	Value struct {
+		StringValue string `json:"stringValue"`
+	} `json:"value"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceId           string          `json:"traceId"`
+	SpanId            string          `json:"spanId"`
+	ParentSpanId      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes"`
+	Status            otlpStatus      `json:"status"`
+}
+
+func attributes(m map[string]string) []otlpAttribute {
+	attrs := make([]otlpAttribute, 0, len(m))
+	for k, v := range m {
+		a := otlpAttribute{Key: k}
+		a.Value.StringValue = v
+		attrs = append(attrs, a)
+	}
+	return attrs
+}
+
+func (e *exporter) send(batch []*Span) error {
+	spans := make([]otlpSpan, 0, len(batch))
+	for _, s := range batch {
+		s.mu.Lock()
+		o := otlpSpan{
+			TraceId:           s.TraceId,
+			SpanId:            s.SpanId,
+			ParentSpanId:      s.ParentId,
+			Name:              s.Name,
+			Kind:              s.Kind,
+			StartTimeUnixNano: fmt.Sprintf("%d", s.Start.UnixNano()),
+			EndTimeUnixNano:   fmt.Sprintf("%d", s.End.UnixNano()),
+			Attributes:        attributes(s.attributes),
+		}
+		if s.Error != "" {
+			o.Status = otlpStatus{Code: 2, Message: s.Error}
+		}
+		s.mu.Unlock()
+		spans = append(spans, o)
+	}
+	body := map[string]interface{}{
+		"resourceSpans": []interface{}{map[string]interface{}{
+			"resource": map[string]interface{}{
+				"attributes": attributes(map[string]string{"service.name": e.service}),
+			},
+			"scopeSpans": []interface{}{map[string]interface{}{
+				"scope": map[string]string{"name": e.service},
+				"spans": spans,
+			}},
+		}},
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", e.url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range e.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("Collector responded %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,180 @@
+package tracing
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Spans are sent to an OpenTelemetry collector over OTLP, and follow W3C trace
+// context so that traces carry on from whatever called us.  Tracing is off
+// until Start is called, and then every method here is safe on a nil *Span,
+// which is what requests that aren't sampled get, so that callers don't have
+// to check.
+
+// Kinds of span, as OTLP numbers them
+const (
+	KIND_INTERNAL = 1
+	KIND_SERVER   = 2
+	KIND_CLIENT   = 3
+)
+
+type Span struct {
+	TraceId  string
+	SpanId   string
+	ParentId string
+	Name     string
+	Kind     int
+	Start    time.Time
+	End      time.Time
+	Error    string
+
+	mu         sync.Mutex
+	attributes map[string]string
+	ended      bool
+}
+
+func newId(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func newSpan(traceId, parentId, name string, kind int) *Span {
+	return &Span{
+		TraceId:    traceId,
+		SpanId:     newId(8),
+		ParentId:   parentId,
+		Name:       name,
+		Kind:       kind,
+		Start:      time.Now(),
+		attributes: map[string]string{},
+	}
+}
+
+// StartRequest starts the span for serving a request, carrying on the trace
+// in its traceparent header if it has one.  A trace the caller sampled is
+// always kept, one it didn't never is, and new ones are kept at the sample
+// ratio.  It returns nil if tracing is off or the request isn't sampled.
+func StartRequest(req *http.Request, name string) *Span {
+	if exp == nil {
+		return nil
+	}
+	traceId, parentId, sampled, ok := parseTraceparent(req.Header.Get("Traceparent"))
+	if !ok {
+		traceId, parentId = newId(16), ""
+		sampled = sampleTrace(traceId, exp.ratio)
+	}
+	if !sampled {
+		return nil
+	}
+	return newSpan(traceId, parentId, name, KIND_SERVER)
+}
+
+// sampleTrace picks traces by their id, so that every server deciding on the
+// same trace decides the same way.
+func sampleTrace(traceId string, ratio float64) bool {
+	if ratio >= 1 {
+		return true
+	}
+	var n uint64
+	fmt.Sscanf(traceId[16:], "%x", &n)
+	return float64(n) < ratio*math.MaxUint64
+}
+
+// Child starts a span for some part of the span's work.
+func (s *Span) Child(name string, kind int) *Span {
+	if s == nil {
+		return nil
+	}
+	return newSpan(s.TraceId, s.SpanId, name, kind)
+}
+
+func (s *Span) SetAttribute(key, value string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.attributes[key] = value
+	s.mu.Unlock()
+}
+
+// SetError marks the span as failed, if err isn't nil.
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	s.Error = err.Error()
+	s.mu.Unlock()
+}
+
+// Finish ends the span and sends it off.  Only the first call counts.
+func (s *Span) Finish() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.End = time.Now()
+	s.mu.Unlock()
+	exp.add(s)
+}
+
+// Traceparent is the header to send along with requests made as part of the
+// span, so that whatever serves them can carry on the trace.
+func (s *Span) Traceparent() string {
+	if s == nil {
+		return ""
+	}
+	return "00-" + s.TraceId + "-" + s.SpanId + "-01"
+}
+
+// Inject adds the span's traceparent to an outgoing request's headers.
+func Inject(s *Span, header http.Header) {
+	if s != nil {
+		header.Set("Traceparent", s.Traceparent())
+	}
+}
+
+// parseTraceparent reads a header like
+// "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01" into the trace id,
+// the caller's span id, and whether the caller sampled it.
+func parseTraceparent(header string) (traceId, parentId string, sampled, ok bool) {
+	parts := strings.Split(strings.TrimSpace(header), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" ||
+		!validId(parts[1], 32) || !validId(parts[2], 16) || len(parts[3]) != 2 {
+		return "", "", false, false
+	}
+	// Version 00 has exactly four parts, later ones may add more
+	if parts[0] == "00" && len(parts) != 4 {
+		return "", "", false, false
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil {
+		return "", "", false, false
+	}
+	return parts[1], parts[2], flags[0]&1 == 1, true
+}
+
+// validId is a lowercase hex id of the length that isn't all zeros.
+func validId(id string, length int) bool {
+	if len(id) != length || strings.Trim(id, "0") == "" {
+		return false
+	}
+	for _, r := range id {
+		if !(r >= '0' && r <= '9' || r >= 'a' && r <= 'f') {
+			return false
+		}
+	}
+	return true
+}
@@ -2,6 +2,7 @@ package utils
 
 import (
 	"fmt"
+	"io/ioutil"
 	"log"
 	"os"
 	"strconv"
@@ -17,55 +18,368 @@ type Config struct {
 	PostgresqlPort     int
 	PostgresqlDbName   string
 	PostgresqlUser     string
-	PostgresqlPassword string
+	PostgresqlPassword string `secret:"true"`
 	PostgresqlSslMode  string
 
-	StripeSecretLive string
-	StripeSecretTest string
+	// Connections to the database (and to the replica, separately) are
+	// pooled, and closed once they're PostgresqlConnMaxLifetimeSeconds old,
+	// 0 to keep them forever.  Postgres cancels any statement that's run
+	// for StatementTimeoutMs, or AggregateTimeoutMs for the big download
+	// aggregations done in the background, 0 for no limit.  No more than
+	// AggregateMaxConns of those run at once, so however slow they get
+	// there are connections left for everything else.
+	PostgresqlMaxOpenConns           int
+	PostgresqlMaxIdleConns           int
+	PostgresqlConnMaxLifetimeSeconds int
+	StatementTimeoutMs               int
+	AggregateTimeoutMs               int
+	AggregateMaxConns                int
+
+	// A read replica of the database, if there is one, for reads that can be
+	// a little behind.  Someone who's just written something reads from the
+	// primary for ReplicaStalenessSeconds after, and nobody reads from the
+	// replica while it's more than ReplicaMaxLagSeconds behind.
+	PostgresqlReplicaHost   string
+	ReplicaStalenessSeconds int
+	ReplicaMaxLagSeconds    int
+
+	StripeSecretLive string `secret:"true"`
+	StripeSecretTest string `secret:"true"`
 
 	AWSBucket          string
 	AWSRegion          string
 	AWSAccessKeyId     string // Unused, just used to remind you to set the env
-	AWSSecretAccessKey string // vars AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY
+	AWSSecretAccessKey string `secret:"true"` // vars AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY
+
+	SMTPHost     string // Leave empty to log e-mails instead of sending them
+	SMTPPort     int
+	SMTPUser     string
+	SMTPPassword string `secret:"true"`
+	MailFrom     string
+
+	SessionTTLMinutes int // How long access tokens from logging in last
+	RefreshTTLDays    int // How long they can be refreshed for
+
+	// Browser sessions keep their tokens in cookies, sent with this SameSite
+	// mode (Strict, Lax, or None) and for this domain if it's set
+	CookieSameSite string
+	CookieDomain   string
+
+	OAuthRedirectUrl   string // Frontend page providers send users back to
+	GitHubClientId     string // Leave empty to disable GitHub sign in
+	GitHubClientSecret string `secret:"true"`
+	GoogleClientId     string // Leave empty to disable Google sign in
+	GoogleClientSecret string `secret:"true"`
+
+	RequireAdminTwoFactor bool // Admins can't use admin endpoints without 2FA
+
+	SecretKey string `secret:"true"` // Signs e.g. password reset links
+	WwwUrl    string // Where the frontend lives, for links in e-mails
+
+	// How many addresses the proxies in front of us add to the end of
+	// X-Forwarded-For, which are the only ones clients can't make up: 2
+	// behind Google's load balancer, which adds the client's and its own, 1
+	// behind one that only adds the client's, and 0 with no proxy at all
+	TrustedProxyHops int
+
+	// Requests per minute per user (or IP, when signed out), 0 to disable
+	RateLimitLogin    int
+	RateLimitUpload   int
+	RateLimitDownload int
+	RateLimitList     int
+
+	AccountDeletionDays int // How long deleted accounts can still be restored
+
+	// Whether organizations' files stop being downloadable once they've used
+	// all of their bandwidth for the month, rather than just warning them
+	BandwidthHardCutoff bool
+
+	// How long hourly downloads are kept once they're rolled up into days
+	DownloadHourRetentionDays int
+
+	// How long single downloads are kept for analytics, with their addresses
+	// reduced to a hash of the network they're in, 0 to not keep them at all
+	DownloadEventRetentionDays int
+
+	// Downloads are counted in memory and written out this often, 0 to write
+	// each one as it happens.  They're journaled to DownloadJournal first, if
+	// it's set, so they're replayed rather than lost if the server dies.
+	DownloadFlushSeconds int
+	DownloadJournal      string
+
+	// Owners hear about it, and models get a badge, when their downloads reach
+	// each of these
+	DownloadMilestones []int
+
+	// How much an anonymous download counts towards trending, as a percentage
+	// of a signed in one
+	TrendingAnonymousPercent int
+
+	// Downloads are placed in countries by a header from the CDN in front of
+	// us if there is one (e.g. CF-IPCountry), otherwise by looking the address
+	// up in a CSV of IP ranges
+	CountryHeader string
+	GeoIpCsv      string
+
+	// Models are searched with Postgres full-text search, or with an
+	// Elasticsearch or OpenSearch index if SearchBackend is "elasticsearch"
+	SearchBackend      string
+	ElasticsearchUrl   string
+	ElasticsearchIndex string
+
+	// Hot lookups, like users and models by name, are cached for
+	// CacheTTLSeconds in this server's memory, in Redis if CacheBackend is
+	// "redis", or not at all if it's "none".  With more than one server,
+	// only Redis sees changes made on the others before they run out.
+	CacheBackend    string
+	RedisUrl        string `secret:"true"`
+	CacheTTLSeconds int
+
+	// Failed logins within an hour before an account or IP address is locked
+	LoginLockAccount int
+	LoginLockIp      int
+	LoginLockMinutes int    // How long the lock lasts
+	AlertEmail       string // Where to send brute force alerts, if anywhere
+
+	MaxConcurrentRequests int // In-flight requests per user, 0 to disable
+
+	// Listings and stats are turned away with a 503 while the server is
+	// overloaded: more than ShedInFlight requests in flight, more than
+	// ShedMemoryMB of heap, or every database connection taken.  0 or false
+	// turns each check off.  Uploads and downloads are never turned away.
+	ShedInFlight          int
+	ShedMemoryMB          int
+	ShedDbPool            bool
+	ShedRetryAfterSeconds int
+
+	// Signed in users who download this many different private models within
+	// AbuseWindowMinutes are flagged, and can't download for a while
+	AbusePrivateModels   int
+	AbuseWindowMinutes   int
+	AbuseThrottleMinutes int
+
+	// Scrapes of /metrics have to send this as a bearer token.  If it's empty,
+	// metrics are only served outside of production.
+	MetricsToken string `secret:"true"`
+
+	// Only one in this many successful downloads is logged, 1 to log them all
+	DownloadLogSampleRate int
+
+	// When told to stop, the server fails its health check for
+	// ShutdownDrainSeconds while the load balancer notices, then waits for
+	// requests to finish for up to ShutdownTimeoutSeconds in all
+	ShutdownDrainSeconds   int
+	ShutdownTimeoutSeconds int
+
+	// Traces are sent to an OpenTelemetry collector over OTLP/HTTP, if
+	// there's an endpoint for one, e.g. http://localhost:4318, along with the
+	// headers (as key=value,key=value).  Of the traces that start here rather
+	// than carrying on from a caller, this percentage are kept.
+	TraceEndpoint      string
+	TraceHeaders       string `secret:"true"`
+	TraceServiceName   string
+	TraceSamplePercent int
+
+	// Panics, with what was being served and to whom, are sent to Sentry, or
+	// anything else that takes Sentry's events, if there's a DSN for it, e.g.
+	// https://key@sentry.example.com/1.  They're always logged.
+	ErrorReportDsn string `secret:"true"`
+
+	// The biggest file that can be uploaded to a model, by its plan (how many
+	// versions of each file it keeps).  Plans that aren't listed get the
+	// smallest limit there is.
+	UploadLimits map[int]int64
+
+	// Where the SQL migrations are, and whether the server applies any that
+	// are pending as it starts, rather than waiting for "gradientzoo migrate up"
+	MigrationsDir  string
+	MigrateOnStart bool
+
+	// Queued jobs each server runs at once
+	JobWorkers int
+
+	// Versions of a file are only compared when both are at most this big,
+	// since every weight in each of them is held in memory while they are
+	MaxCompareMB int
+
+	// Usernames nobody can sign up with, e.g. because they'd be confused with
+	// pages on the site, or with us
+	ReservedNames []string
 }
 
-func (c Config) Valid() bool {
-	strs := []string{
-		c.Port,
-		c.AWSBucket,
-		c.AWSRegion,
+// The config file, if CONFIG_FILE names one, has a KEY=value setting on each
+// line, with the same names as the environment variables, which take
+// precedence over it.  Blank lines and ones starting with # are skipped.
+var ConfigFile = os.Getenv("CONFIG_FILE")
+var fileValues = loadConfigFile(ConfigFile)
+
+// Problems reading the config, which Validate reports along with the rest
+// rather than dying on the first one
+var confErrors []string
+
+func loadConfigFile(path string) map[string]string {
+	values := map[string]string{}
+	if path == "" {
+		return values
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		confErrors = append(confErrors, fmt.Sprintf("Could not read CONFIG_FILE: %s", err))
+		return values
 	}
-	for _, s := range strs {
-		if s == "" {
-			return false
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		eq := strings.Index(line, "=")
+		if eq <= 0 {
+			confErrors = append(confErrors, fmt.Sprintf(
+				"%s line %d should look like KEY=value", path, i+1))
+			continue
+		}
+		value := strings.TrimSpace(line[eq+1:])
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
 		}
+		values[strings.TrimSpace(line[:eq])] = value
 	}
-	return true
+	return values
 }
 
-var Conf Config = Config{
-	Flavor:     os.Getenv("FLAVOR"),
-	Production: os.Getenv("FLAVOR") == "production",
-	Port:       EnvDef("PORT", "8000"),
-
-	PostgresqlHost:     HostDef("GRADIENTZOO_POSTGRES_SVC", EnvDefInt("POSTGRESQL_PORT", 5432), "localhost"),
-	PostgresqlPort:     EnvDefInt("POSTGRESQL_PORT", 5432),
-	PostgresqlDbName:   EnvDef("POSTGRESQL_NAME", "gradientzoo"),
-	PostgresqlUser:     EnvDef("POSTGRESQL_USER", "gradientzoo"),
-	PostgresqlPassword: EnvDef("POSTGRESQL_PASSWORD", "gradientzoo"),
-	PostgresqlSslMode:  EnvDef("POSTGRESQL_SSLMODE", "disable"),
-
-	StripeSecretLive: EnvDef("STRIPE_SECRET_LIVE", ""),
-	StripeSecretTest: EnvDef("STRIPE_SECRET_TEST", ""),
-
-	AWSBucket:          EnvDef("AWS_BUCKET", "gradientzoo-1"),
-	AWSRegion:          EnvDef("AWS_REGION", "us-west-2"),
-	AWSAccessKeyId:     EnvDef("AWS_ACCESS_KEY_ID", ""),
-	AWSSecretAccessKey: EnvDef("AWS_SECRET_ACCESS_KEY", ""),
+var Conf Config = loadConfig()
+
+// loadConfig reads the config from the environment and the config file.
+func loadConfig() Config {
+	return Config{
+		Flavor:     EnvDef("FLAVOR", ""),
+		Production: EnvDef("FLAVOR", "") == "production",
+		Port:       EnvDef("PORT", "8000"),
+
+		PostgresqlHost:     HostDef("GRADIENTZOO_POSTGRES_SVC", EnvDefInt("POSTGRESQL_PORT", 5432), "localhost"),
+		PostgresqlPort:     EnvDefInt("POSTGRESQL_PORT", 5432),
+		PostgresqlDbName:   EnvDef("POSTGRESQL_NAME", "gradientzoo"),
+		PostgresqlUser:     EnvDef("POSTGRESQL_USER", "gradientzoo"),
+		PostgresqlPassword: EnvDef("POSTGRESQL_PASSWORD", "gradientzoo"),
+		PostgresqlSslMode:  EnvDef("POSTGRESQL_SSLMODE", "disable"),
+
+		PostgresqlMaxOpenConns:           EnvDefInt("POSTGRESQL_MAX_OPEN_CONNS", 4),
+		PostgresqlMaxIdleConns:           EnvDefInt("POSTGRESQL_MAX_IDLE_CONNS", 2),
+		PostgresqlConnMaxLifetimeSeconds: EnvDefInt("POSTGRESQL_CONN_MAX_LIFETIME_SECONDS", 1800),
+		StatementTimeoutMs:               EnvDefInt("STATEMENT_TIMEOUT_MS", 30000),
+		AggregateTimeoutMs:               EnvDefInt("AGGREGATE_TIMEOUT_MS", 300000),
+		AggregateMaxConns:                EnvDefInt("AGGREGATE_MAX_CONNS", 1),
+
+		PostgresqlReplicaHost:   EnvDef("POSTGRESQL_REPLICA_HOST", ""),
+		ReplicaStalenessSeconds: EnvDefInt("REPLICA_STALENESS_SECONDS", 5),
+		ReplicaMaxLagSeconds:    EnvDefInt("REPLICA_MAX_LAG_SECONDS", 30),
+
+		StripeSecretLive: EnvDef("STRIPE_SECRET_LIVE", ""),
+		StripeSecretTest: EnvDef("STRIPE_SECRET_TEST", ""),
+
+		AWSBucket:          EnvDef("AWS_BUCKET", "gradientzoo-1"),
+		AWSRegion:          EnvDef("AWS_REGION", "us-west-2"),
+		AWSAccessKeyId:     EnvDef("AWS_ACCESS_KEY_ID", ""),
+		AWSSecretAccessKey: EnvDef("AWS_SECRET_ACCESS_KEY", ""),
+
+		SMTPHost:     EnvDef("SMTP_HOST", ""),
+		SMTPPort:     EnvDefInt("SMTP_PORT", 587),
+		SMTPUser:     EnvDef("SMTP_USER", ""),
+		SMTPPassword: EnvDef("SMTP_PASSWORD", ""),
+		MailFrom:     EnvDef("MAIL_FROM", "Gradientzoo <noreply@gradientzoo.com>"),
+
+		SessionTTLMinutes: EnvDefInt("SESSION_TTL_MINUTES", 60),
+		RefreshTTLDays:    EnvDefInt("REFRESH_TTL_DAYS", 30),
+
+		CookieSameSite: EnvDef("COOKIE_SAMESITE", "Lax"),
+		CookieDomain:   EnvDef("COOKIE_DOMAIN", ""),
+
+		OAuthRedirectUrl:   EnvDef("OAUTH_REDIRECT_URL", "http://localhost:3000/oauth"),
+		GitHubClientId:     EnvDef("GITHUB_CLIENT_ID", ""),
+		GitHubClientSecret: EnvDef("GITHUB_CLIENT_SECRET", ""),
+		GoogleClientId:     EnvDef("GOOGLE_CLIENT_ID", ""),
+		GoogleClientSecret: EnvDef("GOOGLE_CLIENT_SECRET", ""),
+
+		RequireAdminTwoFactor: EnvDef("REQUIRE_ADMIN_2FA", "") == "true",
+
+		SecretKey: EnvDef("SECRET_KEY", "development-secret-key"),
+		WwwUrl:    EnvDef("WWW_URL", "http://localhost:3000"),
+
+		TrustedProxyHops: EnvDefInt("TRUSTED_PROXY_HOPS", 2),
+
+		RateLimitLogin:    EnvDefInt("RATE_LIMIT_LOGIN", 10),
+		RateLimitUpload:   EnvDefInt("RATE_LIMIT_UPLOAD", 60),
+		RateLimitDownload: EnvDefInt("RATE_LIMIT_DOWNLOAD", 300),
+		RateLimitList:     EnvDefInt("RATE_LIMIT_LIST", 600),
+
+		AccountDeletionDays: EnvDefInt("ACCOUNT_DELETION_DAYS", 14),
+		BandwidthHardCutoff: EnvDef("BANDWIDTH_HARD_CUTOFF", "") == "true",
+
+		DownloadHourRetentionDays:  EnvDefInt("DOWNLOAD_HOUR_RETENTION_DAYS", 35),
+		DownloadMilestones:         EnvDefInts("DOWNLOAD_MILESTONES", "1000,10000,100000"),
+		DownloadEventRetentionDays: EnvDefInt("DOWNLOAD_EVENT_RETENTION_DAYS", 30),
+		DownloadFlushSeconds:       EnvDefInt("DOWNLOAD_FLUSH_SECONDS", 5),
+		DownloadJournal:            EnvDef("DOWNLOAD_JOURNAL", ""),
+		TrendingAnonymousPercent:   EnvDefInt("TRENDING_ANONYMOUS_PERCENT", 100),
+
+		CountryHeader: EnvDef("COUNTRY_HEADER", ""),
+		GeoIpCsv:      EnvDef("GEOIP_CSV", ""),
+
+		SearchBackend:      EnvDef("SEARCH_BACKEND", "postgres"),
+		ElasticsearchUrl:   EnvDef("ELASTICSEARCH_URL", "http://localhost:9200"),
+		ElasticsearchIndex: EnvDef("ELASTICSEARCH_INDEX", "gradientzoo-models"),
+
+		CacheBackend:    EnvDef("CACHE_BACKEND", "memory"),
+		RedisUrl:        EnvDef("REDIS_URL", "redis://localhost:6379/0"),
+		CacheTTLSeconds: EnvDefInt("CACHE_TTL_SECONDS", 60),
+
+		LoginLockAccount: EnvDefInt("LOGIN_LOCK_ACCOUNT", 10),
+		LoginLockIp:      EnvDefInt("LOGIN_LOCK_IP", 50),
+		LoginLockMinutes: EnvDefInt("LOGIN_LOCK_MINUTES", 30),
+		AlertEmail:       EnvDef("ALERT_EMAIL", ""),
+
+		MaxConcurrentRequests: EnvDefInt("MAX_CONCURRENT_REQUESTS", 10),
+
+		ShedInFlight:          EnvDefInt("SHED_IN_FLIGHT", 200),
+		ShedMemoryMB:          EnvDefInt("SHED_MEMORY_MB", 0),
+		ShedDbPool:            EnvDef("SHED_DB_POOL", "true") == "true",
+		ShedRetryAfterSeconds: EnvDefInt("SHED_RETRY_AFTER_SECONDS", 5),
+
+		AbusePrivateModels:   EnvDefInt("ABUSE_PRIVATE_MODELS", 20),
+		AbuseWindowMinutes:   EnvDefInt("ABUSE_WINDOW_MINUTES", 10),
+		AbuseThrottleMinutes: EnvDefInt("ABUSE_THROTTLE_MINUTES", 60),
+
+		MetricsToken:          EnvDef("METRICS_TOKEN", ""),
+		DownloadLogSampleRate: EnvDefInt("DOWNLOAD_LOG_SAMPLE_RATE", 1),
+
+		ShutdownDrainSeconds:   EnvDefInt("SHUTDOWN_DRAIN_SECONDS", 10),
+		ShutdownTimeoutSeconds: EnvDefInt("SHUTDOWN_TIMEOUT_SECONDS", 600),
+
+		TraceEndpoint:      EnvDef("OTEL_EXPORTER_OTLP_ENDPOINT", ""),
+		TraceHeaders:       EnvDef("OTEL_EXPORTER_OTLP_HEADERS", ""),
+		TraceServiceName:   EnvDef("OTEL_SERVICE_NAME", "gradientzoo"),
+		TraceSamplePercent: EnvDefInt("TRACE_SAMPLE_PERCENT", 10),
+
+		ErrorReportDsn: EnvDef("ERROR_REPORT_DSN", ""),
+
+		UploadLimits: EnvDefSizes("UPLOAD_LIMITS", "10:500MB,100:1GB,1000:2GB,10000:4GB"),
+
+		MigrationsDir:  EnvDef("MIGRATIONS_DIR", "db/migrations"),
+		MigrateOnStart: EnvDef("MIGRATE_ON_START", "") == "true",
+
+		JobWorkers:   EnvDefInt("JOB_WORKERS", 4),
+		MaxCompareMB: EnvDefInt("MAX_COMPARE_MB", 512),
+
+		ReservedNames: EnvDefStrings("RESERVED_NAMES",
+			"about,admin,api,auth,blog,help,login,logout,me,org,settings,signup,support,www"),
+	}
 }
 
 func EnvDef(name, def string) string {
 	ret := os.Getenv(name)
+	if ret == "" {
+		ret = fileValues[name]
+	}
 	if ret == "" {
 		ret = def
 	}
@@ -89,13 +403,99 @@ func EnvInt(name string) int {
 }
 
 func EnvDefInt(name string, def int) int {
-	i, err := strconv.Atoi(EnvDef(name, fmt.Sprintf("%d", def)))
+	s := EnvDef(name, fmt.Sprintf("%d", def))
+	i, err := strconv.Atoi(s)
 	if err != nil {
-		log.Fatalln(err)
+		confErrors = append(confErrors, fmt.Sprintf("%s must be a whole number, not %q", name, s))
+		return def
 	}
 	return i
 }
 
+// EnvDefInts reads a comma-separated list of numbers, e.g. 1000,10000
+func EnvDefInts(name, def string) []int {
+	var ints []int
+	for _, field := range strings.Split(EnvDef(name, def), ",") {
+		if field = strings.TrimSpace(field); field == "" {
+			continue
+		}
+		i, err := strconv.Atoi(field)
+		if err != nil {
+			confErrors = append(confErrors, fmt.Sprintf(
+				"%s must be a list of whole numbers, like %s", name, def))
+			return nil
+		}
+		ints = append(ints, i)
+	}
+	return ints
+}
+
+// EnvDefStrings reads a comma-separated list, e.g. admin,api
+func EnvDefStrings(name, def string) []string {
+	var strs []string
+	for _, field := range strings.Split(EnvDef(name, def), ",") {
+		if field = strings.TrimSpace(field); field != "" {
+			strs = append(strs, field)
+		}
+	}
+	return strs
+}
+
+// EnvDefSizes reads a comma-separated list of numbers and the sizes they go
+// with, e.g. 10:500MB,100:1GB
+func EnvDefSizes(name, def string) map[int]int64 {
+	sizes := map[int]int64{}
+	for _, field := range strings.Split(EnvDef(name, def), ",") {
+		if field = strings.TrimSpace(field); field == "" {
+			continue
+		}
+		parts := strings.SplitN(field, ":", 2)
+		if len(parts) != 2 {
+			confErrors = append(confErrors, fmt.Sprintf(
+				"%s must be a list of numbers and sizes, like %s", name, def))
+			return nil
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+		if err != nil {
+			confErrors = append(confErrors, fmt.Sprintf(
+				"%s must be a list of numbers and sizes, like %s", name, def))
+			return nil
+		}
+		size, err := ParseSize(parts[1])
+		if err != nil {
+			confErrors = append(confErrors, fmt.Sprintf("%s: %s", name, err))
+			return nil
+		}
+		sizes[n] = size
+	}
+	return sizes
+}
+
+var sizeUnits = map[string]int64{
+	"":   1,
+	"B":  1,
+	"KB": 1 << 10,
+	"MB": 1 << 20,
+	"GB": 1 << 30,
+	"TB": 1 << 40,
+}
+
+// ParseSize reads a size in bytes, which can be given in KB, MB, GB or TB,
+// e.g. 500MB.  Those are powers of 1024.
+func ParseSize(s string) (int64, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	i := strings.IndexFunc(s, func(r rune) bool { return r < '0' || r > '9' })
+	if i < 0 {
+		i = len(s)
+	}
+	unit, ok := sizeUnits[strings.TrimSpace(s[i:])]
+	n, err := strconv.ParseInt(s[:i], 10, 64)
+	if !ok || err != nil {
+		return 0, fmt.Errorf("%q is not a size, like 500MB", s)
+	}
+	return n * unit, nil
+}
+
 func Host(name string, port int) string {
 	return HostDef(name, port, "")
 }
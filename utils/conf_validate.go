@@ -0,0 +1,154 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Validate checks the config makes sense, returning everything that's wrong
+// with it, so that the server can refuse to start rather than misbehaving
+// later on.
+func (c Config) Validate() []error {
+	errs := []error{}
+	for _, msg := range confErrors {
+		errs = append(errs, errors.New(msg))
+	}
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	port, err := strconv.Atoi(c.Port)
+	check(err == nil && port > 0 && port < 65536, "PORT must be a port number, not %q", c.Port)
+	check(c.PostgresqlPort > 0 && c.PostgresqlPort < 65536,
+		"POSTGRESQL_PORT must be a port number, not %d", c.PostgresqlPort)
+	check(c.PostgresqlMaxOpenConns > 0, "POSTGRESQL_MAX_OPEN_CONNS must be more than zero")
+	check(c.PostgresqlMaxIdleConns >= 0 && c.PostgresqlMaxIdleConns <= c.PostgresqlMaxOpenConns,
+		"POSTGRESQL_MAX_IDLE_CONNS must be between zero and POSTGRESQL_MAX_OPEN_CONNS")
+	check(c.PostgresqlConnMaxLifetimeSeconds >= 0,
+		"POSTGRESQL_CONN_MAX_LIFETIME_SECONDS must not be negative")
+	check(c.StatementTimeoutMs >= 0, "STATEMENT_TIMEOUT_MS must not be negative")
+	check(c.AggregateTimeoutMs >= 0, "AGGREGATE_TIMEOUT_MS must not be negative")
+	check(c.AggregateMaxConns > 0 && c.AggregateMaxConns < c.PostgresqlMaxOpenConns,
+		"AGGREGATE_MAX_CONNS must be more than zero and less than POSTGRESQL_MAX_OPEN_CONNS")
+	check(c.ReplicaStalenessSeconds >= 0, "REPLICA_STALENESS_SECONDS must not be negative")
+	check(c.ReplicaMaxLagSeconds > 0, "REPLICA_MAX_LAG_SECONDS must be more than zero")
+	check(c.AWSBucket != "", "AWS_BUCKET must be set")
+	check(c.AWSRegion != "", "AWS_REGION must be set")
+	if c.SMTPHost != "" {
+		check(c.SMTPPort > 0 && c.SMTPPort < 65536,
+			"SMTP_PORT must be a port number, not %d", c.SMTPPort)
+	}
+	check(c.CookieSameSite == "Strict" || c.CookieSameSite == "Lax" || c.CookieSameSite == "None",
+		"COOKIE_SAMESITE must be one of Strict, Lax or None, not %q", c.CookieSameSite)
+	check(c.SearchBackend == "postgres" || c.SearchBackend == "elasticsearch",
+		"SEARCH_BACKEND must be one of postgres or elasticsearch, not %q", c.SearchBackend)
+	check(c.CacheBackend == "none" || c.CacheBackend == "memory" || c.CacheBackend == "redis",
+		"CACHE_BACKEND must be one of none, memory or redis, not %q", c.CacheBackend)
+	check(c.CacheTTLSeconds > 0, "CACHE_TTL_SECONDS must be more than zero")
+
+	check(c.SessionTTLMinutes > 0, "SESSION_TTL_MINUTES must be more than zero")
+	check(c.RefreshTTLDays > 0, "REFRESH_TTL_DAYS must be more than zero")
+	check(c.AccountDeletionDays >= 0, "ACCOUNT_DELETION_DAYS must not be negative")
+	check(c.DownloadHourRetentionDays > 0, "DOWNLOAD_HOUR_RETENTION_DAYS must be more than zero")
+	check(c.DownloadEventRetentionDays >= 0, "DOWNLOAD_EVENT_RETENTION_DAYS must not be negative")
+	check(c.DownloadFlushSeconds >= 0, "DOWNLOAD_FLUSH_SECONDS must not be negative")
+	check(c.DownloadLogSampleRate >= 1, "DOWNLOAD_LOG_SAMPLE_RATE must be at least 1")
+	for _, m := range c.DownloadMilestones {
+		check(m > 0, "DOWNLOAD_MILESTONES must all be more than zero")
+	}
+	check(c.TrendingAnonymousPercent >= 0 && c.TrendingAnonymousPercent <= 100,
+		"TRENDING_ANONYMOUS_PERCENT must be from 0 to 100")
+	check(c.TraceSamplePercent >= 0 && c.TraceSamplePercent <= 100,
+		"TRACE_SAMPLE_PERCENT must be from 0 to 100")
+	if c.ErrorReportDsn != "" {
+		u, err := url.Parse(c.ErrorReportDsn)
+		check(err == nil && u.User != nil && u.Host != "" && strings.Trim(u.Path, "/") != "",
+			"ERROR_REPORT_DSN must look like https://key@sentry.example.com/1")
+	}
+
+	check(c.LoginLockAccount >= 0, "LOGIN_LOCK_ACCOUNT must not be negative")
+	check(c.LoginLockIp >= 0, "LOGIN_LOCK_IP must not be negative")
+	check(c.LoginLockMinutes > 0, "LOGIN_LOCK_MINUTES must be more than zero")
+	check(c.MaxConcurrentRequests >= 0, "MAX_CONCURRENT_REQUESTS must not be negative")
+	check(c.ShedInFlight >= 0, "SHED_IN_FLIGHT must not be negative")
+	check(c.ShedMemoryMB >= 0, "SHED_MEMORY_MB must not be negative")
+	check(c.ShedRetryAfterSeconds > 0, "SHED_RETRY_AFTER_SECONDS must be more than zero")
+	check(c.AbuseWindowMinutes > 0, "ABUSE_WINDOW_MINUTES must be more than zero")
+	check(c.AbuseThrottleMinutes > 0, "ABUSE_THROTTLE_MINUTES must be more than zero")
+
+	check(c.ShutdownDrainSeconds >= 0, "SHUTDOWN_DRAIN_SECONDS must not be negative")
+	check(c.ShutdownTimeoutSeconds >= c.ShutdownDrainSeconds,
+		"SHUTDOWN_TIMEOUT_SECONDS must be at least SHUTDOWN_DRAIN_SECONDS")
+
+	check(len(c.UploadLimits) > 0, "UPLOAD_LIMITS must give a limit for at least one plan")
+	for keep, limit := range c.UploadLimits {
+		check(limit > 0, "UPLOAD_LIMITS must be more than zero, not %d for plan %d", limit, keep)
+	}
+	check(c.JobWorkers >= 0, "JOB_WORKERS must not be negative")
+
+	if c.MigrateOnStart {
+		check(c.MigrationsDir != "", "MIGRATIONS_DIR must be set to migrate on start")
+	}
+	return errs
+}
+
+// Redacted is the config as it can be shown to admins, with secrets that are
+// set replaced so that they only show whether they're set.
+func (c Config) Redacted() map[string]interface{} {
+	redacted := map[string]interface{}{}
+	v := reflect.ValueOf(c)
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		value := v.Field(i).Interface()
+		if field.Tag.Get("secret") == "true" && value != "" {
+			value = "[redacted]"
+		}
+		redacted[field.Name] = jsonValue(value)
+	}
+	return redacted
+}
+
+// jsonValue is a setting as it can be sent as JSON, which only has string
+// keys.
+func jsonValue(value interface{}) interface{} {
+	if limits, ok := value.(map[int]int64); ok {
+		byPlan := map[string]int64{}
+		for keep, limit := range limits {
+			byPlan[strconv.Itoa(keep)] = limit
+		}
+		return byPlan
+	}
+	return value
+}
+
+// Reserved says whether nobody can sign up with the username.
+func (c Config) Reserved(username string) bool {
+	for _, name := range c.ReservedNames {
+		if strings.EqualFold(name, username) {
+			return true
+		}
+	}
+	return false
+}
+
+// UploadLimit is the biggest file that can be uploaded to a model on the plan
+// that keeps that many versions.
+func (c Config) UploadLimit(keep int) int64 {
+	if limit, ok := c.UploadLimits[keep]; ok {
+		return limit
+	}
+	var smallest int64
+	for _, limit := range c.UploadLimits {
+		if smallest == 0 || limit < smallest {
+			smallest = limit
+		}
+	}
+	return smallest
+}
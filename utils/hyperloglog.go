@@ -0,0 +1,142 @@
+package utils
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/fnv"
+	"math"
+)
+
+const (
+	HllPrecision = 10 // Bits of the hash that pick a register
+	HllRegisters = 1 << HllPrecision
+)
+
+// How a sketch is laid out once it's encoded, in its first byte
+const (
+	hllDense  = 1 // Every register, one byte each
+	hllSparse = 2 // Just the registers that are set, as 2-byte index, 1-byte value
+)
+
+var ErrBadSketch = errors.New("Not a valid HyperLogLog sketch")
+
+// HyperLogLog estimates how many distinct values it has been given, to within
+// a few percent, in a kilobyte or less no matter how many there are.  Sketches
+// can be merged, so one per day adds up to a good estimate for a week or a
+// month without counting anyone twice.
+type HyperLogLog struct {
+	registers []uint8
+}
+
+func NewHyperLogLog() *HyperLogLog {
+	return &HyperLogLog{registers: make([]uint8, HllRegisters)}
+}
+
+// ParseHyperLogLog decodes a sketch made by Bytes.
+func ParseHyperLogLog(b []byte) (*HyperLogLog, error) {
+	h := NewHyperLogLog()
+	if len(b) == 0 {
+		return nil, ErrBadSketch
+	}
+	switch b[0] {
+	case hllDense:
+		if len(b) != HllRegisters+1 {
+			return nil, ErrBadSketch
+		}
+		copy(h.registers, b[1:])
+	case hllSparse:
+		if (len(b)-1)%3 != 0 {
+			return nil, ErrBadSketch
+		}
+		for i := 1; i < len(b); i += 3 {
+			idx := binary.BigEndian.Uint16(b[i : i+2])
+			if int(idx) >= HllRegisters {
+				return nil, ErrBadSketch
+			}
+			h.registers[idx] = b[i+2]
+		}
+	default:
+		return nil, ErrBadSketch
+	}
+	return h, nil
+}
+
+// Add counts value, which does nothing if it's been counted already.
+func (h *HyperLogLog) Add(value string) {
+	hash := fnv.New64a()
+	hash.Write([]byte(value))
+	x := mix64(hash.Sum64())
+
+	idx := x >> (64 - HllPrecision)
+	rest := x << HllPrecision
+	rank := uint8(1)
+	for rest&(1<<63) == 0 && rank <= 64-HllPrecision {
+		rank++
+		rest <<= 1
+	}
+	if rank > h.registers[idx] {
+		h.registers[idx] = rank
+	}
+}
+
+// Merge folds other into h, so that h counts everything either of them did.
+func (h *HyperLogLog) Merge(other *HyperLogLog) {
+	for i, r := range other.registers {
+		if r > h.registers[i] {
+			h.registers[i] = r
+		}
+	}
+}
+
+// Count estimates how many distinct values have been added.
+func (h *HyperLogLog) Count() int {
+	m := float64(HllRegisters)
+	sum := 0.0
+	zeros := 0
+	for _, r := range h.registers {
+		sum += math.Pow(2, -float64(r))
+		if r == 0 {
+			zeros++
+		}
+	}
+	estimate := 0.7213 / (1 + 1.079/m) * m * m / sum
+
+	// Small counts are much more accurate going by how many registers are
+	// still empty
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return int(estimate + 0.5)
+}
+
+// Bytes encodes the sketch for storage, which for the handful of values most
+// sketches end up with is a lot smaller than the registers themselves.
+func (h *HyperLogLog) Bytes() []byte {
+	set := 0
+	for _, r := range h.registers {
+		if r != 0 {
+			set++
+		}
+	}
+	if set*3 >= HllRegisters {
+		return append([]byte{hllDense}, h.registers...)
+	}
+	b := make([]byte, 1, 1+set*3)
+	b[0] = hllSparse
+	for i, r := range h.registers {
+		if r != 0 {
+			b = append(b, byte(i>>8), byte(i), r)
+		}
+	}
+	return b
+}
+
+// mix64 spreads FNV's bits out, since HyperLogLog leans hard on the top ones
+func mix64(x uint64) uint64 {
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
@@ -0,0 +1,98 @@
+package utils
+
+import (
+	"reflect"
+	"sync"
+	"sync/atomic"
+)
+
+// Reloadable are the settings Reload changes while the server runs, so that
+// they can be tuned during an incident without dropping the uploads under
+// way.  Code that reads them goes through Live rather than Conf.  The rest
+// are read once as the server starts, and changing them needs a restart.
+var Reloadable = map[string]bool{
+	"RateLimitLogin":        true,
+	"RateLimitUpload":       true,
+	"RateLimitDownload":     true,
+	"RateLimitList":         true,
+	"MaxConcurrentRequests": true,
+	"ShedInFlight":          true,
+	"ShedMemoryMB":          true,
+	"ShedDbPool":            true,
+	"ShedRetryAfterSeconds": true,
+	"DownloadLogSampleRate": true,
+	"UploadLimits":          true,
+	"ReservedNames":         true,
+}
+
+var live atomic.Value
+var reloadMu sync.Mutex
+
+func init() {
+	c := Conf
+	live.Store(&c)
+}
+
+// Live is the config as it was last reloaded.  It mustn't be changed, since
+// other requests are reading it at the same time; use SetLive instead.
+func Live() *Config {
+	return live.Load().(*Config)
+}
+
+// SetLive replaces the live config all at once, e.g. for tests that need
+// different limits.
+func SetLive(c Config) {
+	live.Store(&c)
+}
+
+// ConfigChange is a setting that was found changed when reloading.
+type ConfigChange struct {
+	Name    string      `json:"name"`
+	Old     interface{} `json:"old"`
+	New     interface{} `json:"new"`
+	Applied bool        `json:"applied"` // Whether it took effect, or needs a restart
+}
+
+// Reload reads the environment and the config file again, and if the config
+// they make is valid, makes its reloadable settings live.  It returns every
+// setting that changed, including the ones that need a restart, or what's
+// wrong with the new config, in which case nothing is changed.
+func Reload() ([]*ConfigChange, []error) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	confErrors = nil
+	fileValues = loadConfigFile(ConfigFile)
+	fresh := loadConfig()
+	if errs := fresh.Validate(); len(errs) > 0 {
+		return nil, errs
+	}
+
+	next := *Live()
+	changes := []*ConfigChange{}
+	oldV := reflect.ValueOf(Live()).Elem()
+	newV := reflect.ValueOf(&fresh).Elem()
+	nextV := reflect.ValueOf(&next).Elem()
+	t := oldV.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if reflect.DeepEqual(oldV.Field(i).Interface(), newV.Field(i).Interface()) {
+			continue
+		}
+		change := &ConfigChange{
+			Name:    field.Name,
+			Old:     jsonValue(oldV.Field(i).Interface()),
+			New:     jsonValue(newV.Field(i).Interface()),
+			Applied: Reloadable[field.Name],
+		}
+		if field.Tag.Get("secret") == "true" {
+			change.Old, change.New = "[redacted]", "[redacted]"
+		}
+		if change.Applied {
+			nextV.Field(i).Set(newV.Field(i))
+		}
+		changes = append(changes, change)
+	}
+	live.Store(&next)
+	return changes, nil
+}
@@ -0,0 +1,82 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidToken = errors.New("Token is not valid")
+var ErrExpiredToken = errors.New("Token has expired")
+
+// MakeSignedToken makes a token that proves we handed it to someone for the
+// given purpose and user, until expires.  Anything passed as state has to be
+// the same when the token is checked, so e.g. passing the password hash makes
+// a reset token stop working once the password changes.  The user id can be
+// read back out with ParseSignedToken, but state can't.
+func MakeSignedToken(purpose, userId, state string, expires time.Time) string {
+	payload := fmt.Sprintf("%s.%d", userId, expires.Unix())
+	encoded := base64.URLEncoding.EncodeToString([]byte(payload))
+	return encoded + "." + signToken(purpose, payload, state)
+}
+
+// ParseSignedToken reads the user id out of the token without checking it,
+// so that callers can look up the state to pass to CheckSignedToken.
+func ParseSignedToken(token string) (string, error) {
+	userId, _, _, err := splitToken(token)
+	return userId, err
+}
+
+func CheckSignedToken(token, purpose, state string) error {
+	userId, expires, sig, err := splitToken(token)
+	if err != nil {
+		return err
+	}
+	payload := fmt.Sprintf("%s.%d", userId, expires.Unix())
+	if !hmac.Equal([]byte(sig), []byte(signToken(purpose, payload, state))) {
+		return ErrInvalidToken
+	}
+	if !time.Now().Before(expires) {
+		return ErrExpiredToken
+	}
+	return nil
+}
+
+// CsrfToken is the token a browser session has to send back along with any
+// request that changes something.  It's derived from the session id, so
+// there's nothing to store, and a page on another site can't work it out.
+func CsrfToken(sessionId string) string {
+	return signToken("csrf", sessionId, "")
+}
+
+func signToken(purpose, payload, state string) string {
+	mac := hmac.New(sha256.New, []byte(Conf.SecretKey))
+	mac.Write([]byte(purpose + "\x00" + payload + "\x00" + state))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func splitToken(token string) (string, time.Time, string, error) {
+	parts := strings.SplitN(token, ".", 2)
+	if len(parts) != 2 {
+		return "", time.Time{}, "", ErrInvalidToken
+	}
+	decoded, err := base64.URLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return "", time.Time{}, "", ErrInvalidToken
+	}
+	payload := strings.SplitN(string(decoded), ".", 2)
+	if len(payload) != 2 {
+		return "", time.Time{}, "", ErrInvalidToken
+	}
+	unix, err := strconv.ParseInt(payload[1], 10, 64)
+	if err != nil {
+		return "", time.Time{}, "", ErrInvalidToken
+	}
+	return payload[0], time.Unix(unix, 0), parts[1], nil
+}
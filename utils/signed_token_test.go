@@ -0,0 +1,64 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignedToken(t *testing.T) {
+	Conf.SecretKey = "test secret"
+	expires := time.Now().Add(time.Hour)
+	token := MakeSignedToken("reset", "user-id", "hash", expires)
+
+	userId, err := ParseSignedToken(token)
+	if err != nil || userId != "user-id" {
+		t.Errorf("ParseSignedToken = %q, %v, want user-id", userId, err)
+	}
+
+	// The user id half of a token for someone else, with this one's signature
+	parts := strings.SplitN(token, ".", 2)
+	other := strings.SplitN(MakeSignedToken("reset", "other-id", "hash", expires), ".", 2)
+
+	tests := []struct {
+		name    string
+		token   string
+		purpose string
+		state   string
+		want    error
+	}{
+		{"valid", token, "reset", "hash", nil},
+		{"other purpose", token, "verify", "hash", ErrInvalidToken},
+		{"changed state", token, "reset", "new hash", ErrInvalidToken},
+		{"expired", MakeSignedToken("reset", "user-id", "hash", time.Now().Add(-time.Second)),
+			"reset", "hash", ErrExpiredToken},
+		{"tampered signature", token[:len(token)-1] + "x", "reset", "hash", ErrInvalidToken},
+		{"no signature", parts[0], "reset", "hash", ErrInvalidToken},
+		{"garbage", "not a token", "reset", "hash", ErrInvalidToken},
+		{"other user", other[0] + "." + parts[1], "reset", "hash", ErrInvalidToken},
+	}
+	for _, test := range tests {
+		if err := CheckSignedToken(test.token, test.purpose, test.state); err != test.want {
+			t.Errorf("CheckSignedToken(%s) = %v, want %v", test.name, err, test.want)
+		}
+	}
+}
+
+func TestSignedTokenSecretKey(t *testing.T) {
+	Conf.SecretKey = "old secret"
+	token := MakeSignedToken("reset", "user-id", "", time.Now().Add(time.Hour))
+	Conf.SecretKey = "new secret"
+	if err := CheckSignedToken(token, "reset", ""); err != ErrInvalidToken {
+		t.Errorf("CheckSignedToken after changing the secret = %v, want %v", err, ErrInvalidToken)
+	}
+}
+
+func TestCsrfToken(t *testing.T) {
+	Conf.SecretKey = "test secret"
+	if CsrfToken("session") != CsrfToken("session") {
+		t.Error("CsrfToken differs for the same session")
+	}
+	if CsrfToken("session") == CsrfToken("other session") {
+		t.Error("CsrfToken is the same for different sessions")
+	}
+}
@@ -0,0 +1,80 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	TotpPeriod = 30 // Seconds each code is good for
+	TotpDigits = 6
+	TotpSkew   = 1 // How many periods either side of now to accept
+)
+
+// NewTotpSecret makes a random base32 secret for an authenticator app.
+func NewTotpSecret() (string, error) {
+	buf := make([]byte, 20)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return strings.TrimRight(base32.StdEncoding.EncodeToString(buf), "="), nil
+}
+
+// TotpUri is what goes in the QR code that authenticator apps scan.
+func TotpUri(issuer, account, secret string) string {
+	label := strings.Replace(url.QueryEscape(issuer+":"+account), "+", "%20", -1)
+	return "otpauth://totp/" + label + "?" + url.Values{
+		"secret": {secret},
+		"issuer": {issuer},
+		"digits": {fmt.Sprintf("%d", TotpDigits)},
+		"period": {fmt.Sprintf("%d", TotpPeriod)},
+	}.Encode()
+}
+
+// TotpCode works out the code for the given counter, as in RFC 6238.
+func TotpCode(secret string, counter int64) (string, error) {
+	secret = strings.ToUpper(secret)
+	if n := len(secret) % 8; n != 0 {
+		secret += strings.Repeat("=", 8-n)
+	}
+	key, err := base32.StdEncoding.DecodeString(secret)
+	if err != nil {
+		return "", err
+	}
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, uint64(counter))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg)
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0xf
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", TotpDigits, value%1000000), nil
+}
+
+// CheckTotp returns the counter that code is valid for around time t, or -1 if
+// it isn't valid.  Callers should remember the counter so that the same code
+// can't be used twice.
+func CheckTotp(secret, code string, t time.Time) int64 {
+	code = strings.Replace(code, " ", "", -1)
+	if len(code) != TotpDigits {
+		return -1
+	}
+	now := t.Unix() / TotpPeriod
+	for counter := now - TotpSkew; counter <= now+TotpSkew; counter++ {
+		expected, err := TotpCode(secret, counter)
+		if err != nil {
+			return -1
+		}
+		if hmac.Equal([]byte(expected), []byte(code)) {
+			return counter
+		}
+	}
+	return -1
+}
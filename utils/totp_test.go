@@ -0,0 +1,92 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// The SHA-1 test vectors from RFC 6238, cut down to six digits
+var totpVectors = []struct {
+	unix int64
+	code string
+}{
+	{59, "287082"},
+	{1111111109, "081804"},
+	{1111111111, "050471"},
+	{1234567890, "005924"},
+	{2000000000, "279037"},
+}
+
+// The RFC's secret, "12345678901234567890", in base32
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTotpCode(t *testing.T) {
+	for _, v := range totpVectors {
+		code, err := TotpCode(rfcSecret, v.unix/TotpPeriod)
+		if err != nil {
+			t.Fatalf("TotpCode at %d: %v", v.unix, err)
+		}
+		if code != v.code {
+			t.Errorf("TotpCode at %d = %s, want %s", v.unix, code, v.code)
+		}
+	}
+}
+
+func TestTotpCodeLowercaseUnpadded(t *testing.T) {
+	// Authenticator apps show secrets without padding, and people retype
+	// them in whatever case
+	secret, err := NewTotpSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	upper, err := TotpCode(secret, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lower, err := TotpCode(strings.ToLower(secret), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if upper != lower {
+		t.Errorf("TotpCode differs by case: %s and %s", upper, lower)
+	}
+}
+
+func TestCheckTotp(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	counter := now.Unix() / TotpPeriod
+	code := func(counter int64) string {
+		c, err := TotpCode(rfcSecret, counter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	tests := []struct {
+		name string
+		code string
+		want int64
+	}{
+		{"current", code(counter), counter},
+		{"spaced", code(counter)[:3] + " " + code(counter)[3:], counter},
+		{"previous period", code(counter - TotpSkew), counter - TotpSkew},
+		{"next period", code(counter + TotpSkew), counter + TotpSkew},
+		{"too old", code(counter - TotpSkew - 1), -1},
+		{"too new", code(counter + TotpSkew + 1), -1},
+		{"too short", code(counter)[:5], -1},
+		{"wrong", "000000", -1},
+	}
+	for _, test := range tests {
+		if got := CheckTotp(rfcSecret, test.code, now); got != test.want {
+			t.Errorf("CheckTotp(%s) = %d, want %d", test.name, got, test.want)
+		}
+	}
+}
+
+func TestCheckTotpBadSecret(t *testing.T) {
+	if got := CheckTotp("not base32!", "123456", time.Now()); got != -1 {
+		t.Errorf("CheckTotp with a bad secret = %d, want -1", got)
+	}
+}